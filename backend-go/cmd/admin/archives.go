@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+)
+
+func orgBackup(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("org backup", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization ID")
+	out := fs.String("out", "", "file to write the archive to")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the passphrase to encrypt the archive with")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org", "out", "passphrase-file"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.OrganizationID = "org_archive_job", *orgID
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	archives, err := a.orgArchives(ctx)
+	if err != nil {
+		return err
+	}
+	job, err := archives.RequestBackup(ctx, *orgID, a.actor, passphrase)
+	if err != nil {
+		return err
+	}
+	entry.ResourceID = job.ID
+	if job, err = runArchiveJob(ctx, archives, job); err != nil {
+		return err
+	}
+
+	_, content, err := archives.Download(ctx, *orgID, job.ID)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, content, 0o600); err != nil {
+		return err
+	}
+	entry.Metadata = map[string]interface{}{"counts": job.Counts, "sha256": job.SHA256, "encrypted": job.Encrypted}
+	log.Printf("ADMIN: wrote %d-byte backup of %s to %s", len(content), *orgID, *out)
+	return a.printJSON(job)
+}
+
+func orgRestore(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("org restore", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization to restore into")
+	in := fs.String("in", "", "archive file")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the archive's passphrase")
+	dryRun := fs.Bool("dry-run", false, "validate the archive and report what would be restored")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org", "in"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.OrganizationID = "org_archive_job", *orgID
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+	archive, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+
+	archives, err := a.orgArchives(ctx)
+	if err != nil {
+		return err
+	}
+	job, err := archives.RequestRestore(ctx, *orgID, a.actor, archive, passphrase, *dryRun)
+	if err != nil {
+		return err
+	}
+	entry.ResourceID = job.ID
+	job, err = runArchiveJob(ctx, archives, job)
+	if job != nil {
+		entry.Metadata = map[string]interface{}{"counts": job.Counts, "dry_run": *dryRun, "source_organization_id": job.SourceOrganizationID}
+	}
+	if err != nil {
+		return err
+	}
+	for _, warning := range job.Warnings {
+		log.Printf("ADMIN: warning: %s", warning)
+	}
+	return a.printJSON(job)
+}
+
+// runArchiveJob processes the job in the foreground, logging its progress. If a server's
+// worker claimed the job first, it waits for that worker to finish it instead.
+func runArchiveJob(ctx context.Context, archives *services.OrgArchiveService, job *data.OrgArchiveJob) (*data.OrgArchiveJob, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		last := data.OrgArchiveProgress{}
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			current, err := archives.Get(ctx, job.OrganizationID, job.ID)
+			if err == nil && current.Progress != last {
+				last = current.Progress
+				log.Printf("ADMIN: %s %s: %s %d/%d", job.Kind, job.ID, last.Phase, last.Done, last.Total)
+			}
+		}
+	}()
+
+	processErr := archives.Process(ctx, job.ID)
+	for {
+		current, err := archives.Get(ctx, job.OrganizationID, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		switch current.Status {
+		case services.ArchiveCompleted:
+			return current, nil
+		case services.ArchiveFailed:
+			if processErr == nil {
+				processErr = fmt.Errorf("%s", current.Error)
+			}
+			return current, processErr
+		case services.ArchiveExpired:
+			return current, fmt.Errorf("%s %s expired", job.Kind, job.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return current, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// readPassphrase reads a passphrase from a file, so it stays out of shell history
+func readPassphrase(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	passphrase := strings.TrimRight(string(raw), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return passphrase, nil
+}
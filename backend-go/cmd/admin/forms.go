@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// formExportFile is the JSON document written by form export and read by form import
+type formExportFile struct {
+	OrganizationID string      `json:"organization_id"`
+	ExportedAt     time.Time   `json:"exported_at"`
+	Forms          []data.Form `json:"forms"`
+}
+
+func formExport(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("form export", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization ID")
+	formID := fs.String("form", "", "export only this form")
+	out := fs.String("out", "", "write to FILE instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "form", *formID, *orgID
+
+	var docs []*firestore.DocumentSnapshot
+	if *formID != "" {
+		doc, err := a.client.Collection("forms").Doc(*formID).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			return fmt.Errorf("form %s not found", *formID)
+		}
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	} else {
+		var err error
+		docs, err = a.client.Collection("forms").Where("organizationId", "==", *orgID).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+	}
+
+	export := formExportFile{OrganizationID: *orgID, ExportedAt: time.Now().UTC(), Forms: []data.Form{}}
+	for _, doc := range docs {
+		var form data.Form
+		if err := doc.DataTo(&form); err != nil {
+			return fmt.Errorf("failed to parse form %s: %w", doc.Ref.ID, err)
+		}
+		if form.OrganizationID != *orgID {
+			return fmt.Errorf("form %s does not belong to organization %s", doc.Ref.ID, *orgID)
+		}
+		if form.DeletedAt != nil {
+			if *formID != "" {
+				return fmt.Errorf("form %s is in the trash", doc.Ref.ID)
+			}
+			continue
+		}
+		form.ID = doc.Ref.ID
+		export.Forms = append(export.Forms, form)
+	}
+	entry.Metadata = map[string]interface{}{"forms": len(export.Forms)}
+
+	if *out == "" {
+		return a.printJSON(export)
+	}
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, body, 0o600); err != nil {
+		return err
+	}
+	log.Printf("ADMIN: exported %d form(s) of %s to %s", len(export.Forms), *orgID, *out)
+	return nil
+}
+
+func formImport(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("form import", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization that receives the forms")
+	in := fs.String("in", "", "export file to read")
+	keepIDs := fs.Bool("keep-ids", false, "reuse the exported form IDs instead of assigning new ones")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org", "in"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.OrganizationID = "form", *orgID
+
+	body, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	var export formExportFile
+	if err := json.Unmarshal(body, &export); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", *in, err)
+	}
+	if _, err := a.client.Collection("organizations").Doc(*orgID).Get(ctx); status.Code(err) == codes.NotFound {
+		return fmt.Errorf("organization %s not found", *orgID)
+	} else if err != nil {
+		return err
+	}
+
+	// Each form is its own transaction so a failure part-way leaves the earlier ones in
+	// place; the mapping printed at the end shows what was created
+	created := map[string]string{}
+	for _, form := range export.Forms {
+		sourceID := form.ID
+		docRef := a.client.Collection("forms").NewDoc()
+		if *keepIDs && sourceID != "" {
+			docRef = a.client.Collection("forms").Doc(sourceID)
+		}
+
+		now := time.Now().UTC()
+		form.ID = ""
+		form.OrganizationID = *orgID
+		form.CreatedAt, form.UpdatedAt = now, now
+		form.CreatedBy, form.UpdatedBy = a.actor, a.actor
+
+		err := a.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			if err := tx.Create(docRef, form); err != nil {
+				return nil, err
+			}
+			return []data.DomainEvent{
+				services.NewDomainEvent(services.DomainFormCreated, *orgID, "form", docRef.ID, a.actor, nil),
+			}, nil
+		})
+		if status.Code(err) == codes.AlreadyExists {
+			err = fmt.Errorf("form %s already exists; import without -keep-ids to copy it", docRef.ID)
+		}
+		if err != nil {
+			entry.Metadata = map[string]interface{}{"created": len(created), "failed_form": sourceID}
+			a.printJSON(created)
+			return err
+		}
+		created[sourceID] = docRef.ID
+	}
+
+	entry.Metadata = map[string]interface{}{"created": len(created), "source_organization_id": export.OrganizationID}
+	log.Printf("ADMIN: imported %d form(s) into %s", len(created), *orgID)
+	return a.printJSON(created)
+}
+
+func responseReindex(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("response reindex", flag.ContinueOnError)
+	orgID := fs.String("org", "", "reindex every response of the organization")
+	responseID := fs.String("response", "", "reindex a single response")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*orgID == "") == (*responseID == "") {
+		return fmt.Errorf("exactly one of -org and -response is required")
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "response", *responseID, *orgID
+
+	var refs []*firestore.DocumentRef
+	if *responseID != "" {
+		refs = append(refs, a.client.Collection("form_responses").Doc(*responseID))
+	} else {
+		docs, err := a.client.Collection("form_responses").Where("organizationId", "==", *orgID).Select().Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			refs = append(refs, doc.Ref)
+		}
+	}
+
+	rewritten, failed := 0, 0
+	for _, ref := range refs {
+		changed, err := a.encryptor.ReindexResponse(ctx, ref)
+		if err != nil {
+			if *responseID != "" {
+				return err
+			}
+			log.Printf("ADMIN: failed to reindex response %s: %v", ref.ID, err)
+			failed++
+			continue
+		}
+		if changed {
+			rewritten++
+		}
+	}
+
+	result := map[string]interface{}{"scanned": len(refs), "rewritten": rewritten, "failed": failed}
+	entry.Metadata = result
+	if failed > 0 {
+		a.printJSON(result)
+		return fmt.Errorf("%d response(s) could not be reindexed", failed)
+	}
+	return a.printJSON(result)
+}
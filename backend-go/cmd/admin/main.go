@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"backend-go/internal/config"
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"firebase.google.com/go/v4/auth"
+	"github.com/redis/go-redis/v9"
+)
+
+// command is one subcommand. run fills in the audit entry's resource fields; the
+// timestamp, actor, action and outcome are set by main.
+type command struct {
+	group, name string
+	args        string
+	help        string
+	run         func(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error
+}
+
+var commands = []command{
+	{"org", "create", "-id ID -name NAME [-email EMAIL] [-phone PHONE] [-timezone TZ]", "create an organization", orgCreate},
+	{"org", "list", "", "list organizations", orgList},
+	{"org", "inspect", "-id ID", "show an organization with member, form and response counts", orgInspect},
+	{"org", "backup", "-org ID -out FILE -passphrase-file FILE", "write the organization to a portable archive", orgBackup},
+	{"org", "restore", "-org ID -in FILE [-passphrase-file FILE] [-dry-run]", "restore an archive into an organization", orgRestore},
+	{"member", "grant", "-org ID -user UID", "make a user a member of an organization", memberGrant},
+	{"member", "revoke", "-org ID -user UID", "remove a member and end their sessions", memberRevoke},
+	{"form", "export", "-org ID [-form ID] [-out FILE]", "write forms as JSON", formExport},
+	{"form", "import", "-org ID -in FILE [-keep-ids]", "create forms from an export", formImport},
+	{"response", "reindex", "-org ID | -response ID", "recompute derived fields and reseal responses", responseReindex},
+	{"cache", "flush", "-org ID", "drop the organization's cached forms", cacheFlush},
+	{"lock", "list", "", "show held distributed locks", lockList},
+	{"lock", "release", "-resource NAME", "force-release a distributed lock", lockRelease},
+	{"session", "revoke", "-user UID | -org ID", "end a user's or an organization's sessions", sessionRevoke},
+	{"retention", "dry-run", "-org ID", "show what the retention sweep would remove", retentionDryRun},
+	{"migrate", "status", "", "show the state of every schema migration", migrateStatus},
+	{"migrate", "run", "[-dry-run] [-to ID]", "apply pending schema migrations", migrateRun},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: admin [-actor name] <group> <command> [flags]\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %-50s %s\n", cmd.group+" "+cmd.name, cmd.args, cmd.help)
+	}
+}
+
+// admin runs maintenance tasks against the same Firestore, Redis and key material as the
+// server, through the same service code. Every command, including read-only ones, is
+// recorded in the audit trail under the operator given by -actor.
+//
+//	admin [-actor name] <group> <command> [flags]
+//
+// Results are printed to stdout as JSON; progress goes to stderr.
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+// run executes the command named by args, printing its result to stdout, and returns the
+// exit status: 0 on success, 1 when the command fails and 2 for a usage error
+func run(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("admin", flag.ContinueOnError)
+	actor := flags.String("actor", defaultActor(), "operator recorded in the audit trail")
+	flags.Usage = usage
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 2 {
+		usage()
+		return 2
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].group == flags.Arg(0) && commands[i].name == flags.Arg(1) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(flags.Args()[:2], " "))
+		usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Printf("Invalid configuration:\n%v", err)
+		return 1
+	}
+	a, err := newAdminEnv(ctx, cfg, *actor, stdout)
+	if err != nil {
+		log.Printf("ADMIN: %v", err)
+		return 1
+	}
+
+	entry := services.AuditEntry{}
+	runErr := cmd.run(ctx, a, flags.Args()[2:], &entry)
+
+	entry.Timestamp = time.Now().UTC()
+	entry.UserID = a.actor
+	entry.Action = "ADMIN_" + strings.ToUpper(strings.ReplaceAll(cmd.group+"_"+cmd.name, "-", "_"))
+	entry.UserAgent = "cmd/admin"
+	entry.Success = runErr == nil
+	if runErr != nil {
+		entry.ErrorMsg = runErr.Error()
+	}
+	if entry.ResourceType == "" {
+		entry.ResourceType = cmd.group
+	}
+	if err := a.audit.LogAccessSync(ctx, entry); err != nil {
+		log.Printf("ADMIN: failed to write audit entry: %v", err)
+	}
+	a.close()
+
+	if runErr != nil {
+		if errors.Is(runErr, flag.ErrHelp) {
+			return 2
+		}
+		log.Printf("ADMIN: %s %s failed: %v", cmd.group, cmd.name, runErr)
+		return 1
+	}
+	return 0
+}
+
+func defaultActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "admin-cli:" + u.Username
+	}
+	return "admin-cli"
+}
+
+// adminEnv holds the clients a command may use. Redis and Firebase Auth are connected
+// on first use, so commands that only touch Firestore work without them.
+type adminEnv struct {
+	cfg       *config.Config
+	actor     string
+	client    *firestore.Client
+	encryptor *services.FieldEncryptor
+	audit     *services.AuditTrail
+	events    *services.EventBus
+	out       io.Writer
+
+	rdb      *redis.Client
+	auth     *auth.Client
+	archives *services.OrgArchiveService
+}
+
+func newAdminEnv(ctx context.Context, cfg *config.Config, actor string, out io.Writer) (*adminEnv, error) {
+	if strings.TrimSpace(actor) == "" {
+		return nil, fmt.Errorf("-actor must not be empty")
+	}
+
+	var client *firestore.Client
+	var err error
+	if cfg.Offline() {
+		// The dev server's in-memory stores listen on fixed loopback addresses
+		client, err = dev.DialFirestore(ctx, cfg.Dev.FirestoreAddr, cfg.GCP.ProjectID)
+		cfg.Redis.Addr = cfg.Dev.RedisAddr
+		cfg.Redis.TLSEnabled = false
+	} else {
+		client, err = data.NewFirestoreClient(ctx, cfg.GCP.ProjectID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Firestore client: %w", err)
+	}
+	data.ConfigureRedis(cfg.Redis)
+
+	provider, err := services.NewKeyProvider(ctx, cfg.Keys)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create key provider: %w", err)
+	}
+	encryptor := services.NewFieldEncryptor(client, provider)
+	services.SetCacheEncryptor(encryptor)
+
+	audit, err := services.NewAuditTrailFromConfig(cfg.GCP.ProjectID, client, cfg.Audit)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to create audit trail: %w", err)
+	}
+
+	return &adminEnv{
+		cfg:       cfg,
+		actor:     actor,
+		client:    client,
+		encryptor: encryptor,
+		audit:     audit,
+		events:    services.NewEventBus(client, nil),
+		out:       out,
+	}, nil
+}
+
+// redis returns the shared Redis client, failing if the server cannot be reached
+func (a *adminEnv) redis() (*redis.Client, error) {
+	if a.rdb == nil {
+		a.rdb = data.GetRedisClient()
+		if a.rdb == nil {
+			return nil, fmt.Errorf("redis unavailable at %s: %v", a.cfg.Redis.Addr, data.GetRedisStats().LastError)
+		}
+	}
+	return a.rdb, nil
+}
+
+// firebaseAuth returns the Firebase Auth client, or nil in the dev profile where tokens
+// are signed locally and carry no stored claims
+func (a *adminEnv) firebaseAuth(ctx context.Context) (*auth.Client, error) {
+	if a.cfg.Offline() {
+		return nil, nil
+	}
+	if a.auth == nil {
+		client, _, err := data.NewFirebaseAuthClient(ctx, a.cfg.GCP.ProjectID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Firebase Auth client: %w", err)
+		}
+		a.auth = client
+	}
+	return a.auth, nil
+}
+
+// orgArchives returns the archive service. Redis is optional: without it the job's
+// distributed lock is skipped and the claim transaction alone keeps jobs from running twice.
+func (a *adminEnv) orgArchives(ctx context.Context) (*services.OrgArchiveService, error) {
+	if a.archives == nil {
+		store, err := services.NewBlobStore(ctx, a.cfg.Attachments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create blob store: %w", err)
+		}
+		rdb, err := a.redis()
+		if err != nil {
+			log.Printf("ADMIN: running without a job lock: %v", err)
+		}
+		a.archives = services.NewOrgArchiveService(a.client, rdb, store, a.encryptor, services.NewUploadSanitizer(a.audit), a.audit)
+	}
+	return a.archives, nil
+}
+
+// close waits for background re-encryption and flushes the audit trail before the
+// clients they write through go away. The shared Redis client is left open: it cannot be
+// reopened in this process, and the process exits after the command.
+func (a *adminEnv) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := a.encryptor.Drain(ctx); err != nil {
+		log.Printf("ADMIN: re-encryption did not finish: %v", err)
+	}
+	if err := a.audit.Close(); err != nil {
+		log.Printf("ADMIN: failed to flush audit trail: %v", err)
+	}
+	a.client.Close()
+}
+
+// require reports the first missing mandatory flag
+func require(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		if fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+	return nil
+}
+
+// printJSON writes a command's result to stdout
+func (a *adminEnv) printJSON(v interface{}) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
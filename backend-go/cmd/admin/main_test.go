@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+)
+
+// The shared Redis client is created once per process, so every test uses one dev Redis
+var (
+	sharedRedisOnce sync.Once
+	sharedRedisAddr string
+	sharedRedisErr  error
+)
+
+// adminFixture points the dev profile at a fresh in-memory Firestore and Redis, with key
+// material, attachments and the audit file in a temporary directory
+type adminFixture struct {
+	client *firestore.Client
+	rdb    *redis.Client
+	dir    string
+}
+
+func newAdminFixture(t *testing.T) *adminFixture {
+	t.Helper()
+	firestoreFake, err := dev.StartFirestore("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start firestore: %v", err)
+	}
+	t.Cleanup(firestoreFake.Stop)
+	sharedRedisOnce.Do(func() {
+		var fake *dev.Redis
+		if fake, sharedRedisErr = dev.StartRedis("127.0.0.1:0"); sharedRedisErr == nil {
+			sharedRedisAddr = fake.Addr()
+		}
+	})
+	if sharedRedisErr != nil {
+		t.Fatalf("start redis: %v", sharedRedisErr)
+	}
+
+	dir := t.TempDir()
+	t.Setenv("ENVIRONMENT", "dev")
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("GCP_PROJECT_ID", "admin-test")
+	t.Setenv("DEV_FIRESTORE_ADDR", firestoreFake.Addr())
+	t.Setenv("DEV_REDIS_ADDR", sharedRedisAddr)
+	t.Setenv("LOCAL_KEY_FILE", filepath.Join(dir, "keys.json"))
+	t.Setenv("ATTACHMENT_DIR", filepath.Join(dir, "blobs"))
+	t.Setenv("AUDIT_LOG_FILE", filepath.Join(dir, "audit.log"))
+
+	client, err := dev.DialFirestore(context.Background(), firestoreFake.Addr(), "admin-test")
+	if err != nil {
+		t.Fatalf("dial firestore: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	rdb := redis.NewClient(&redis.Options{Addr: sharedRedisAddr})
+	t.Cleanup(func() { rdb.Close() })
+	if err := rdb.FlushAll(context.Background()).Err(); err != nil {
+		t.Fatalf("flush redis: %v", err)
+	}
+	return &adminFixture{client: client, rdb: rdb, dir: dir}
+}
+
+// createSession stores a session the way the server does. Commands install their own
+// cache encryptor, so the fixture's is installed again first.
+func (f *adminFixture) createSession(t *testing.T, sessionID, userID, orgID string) {
+	t.Helper()
+	keys, err := services.NewLocalKeyProvider(filepath.Join(f.dir, "keys.json"), true)
+	if err != nil {
+		t.Fatalf("key provider: %v", err)
+	}
+	services.SetCacheEncryptor(services.NewFieldEncryptor(f.client, keys))
+	session := &data.UserSession{UserID: userID, OrganizationID: orgID}
+	if err := services.CreateSession(context.Background(), f.rdb, sessionID, session, time.Hour); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+}
+
+// run executes one admin command as operator test-operator and returns its exit status
+// and stdout
+func (f *adminFixture) run(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout bytes.Buffer
+	code := run(append([]string{"-actor", "test-operator"}, args...), &stdout)
+	return code, stdout.String()
+}
+
+// mustRun executes a command that must succeed and decodes its output into out
+func (f *adminFixture) mustRun(t *testing.T, out interface{}, args ...string) {
+	t.Helper()
+	code, stdout := f.run(t, args...)
+	if code != 0 {
+		t.Fatalf("admin %s exited %d", strings.Join(args, " "), code)
+	}
+	if out != nil {
+		if err := json.Unmarshal([]byte(stdout), out); err != nil {
+			t.Fatalf("admin %s printed %q: %v", strings.Join(args, " "), stdout, err)
+		}
+	}
+}
+
+// mustFail executes a command that must fail with exit status 1
+func (f *adminFixture) mustFail(t *testing.T, args ...string) {
+	t.Helper()
+	if code, _ := f.run(t, args...); code != 1 {
+		t.Fatalf("admin %s exited %d, want 1", strings.Join(args, " "), code)
+	}
+}
+
+// countOutcomes returns how many audit records of an action succeeded and failed, checking
+// that each names the operator
+func (f *adminFixture) countOutcomes(t *testing.T, action string) (succeeded, failed int) {
+	t.Helper()
+	docs, err := f.client.Collection("audit_log").Where("action", "==", action).Documents(context.Background()).GetAll()
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	for _, doc := range docs {
+		var record services.AuditRecord
+		if err := doc.DataTo(&record); err != nil {
+			t.Fatalf("decode audit record: %v", err)
+		}
+		if record.UserID != "test-operator" {
+			t.Fatalf("%s recorded for %q", action, record.UserID)
+		}
+		if record.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	return succeeded, failed
+}
+
+func TestRunRejectsUsageErrors(t *testing.T) {
+	f := newAdminFixture(t)
+	for _, args := range [][]string{
+		{},
+		{"org"},
+		{"org", "frobnicate"},
+		{"-no-such-flag", "org", "list"},
+		{"org", "list", "-h"},
+	} {
+		var stdout bytes.Buffer
+		if code := run(args, &stdout); code != 2 {
+			t.Errorf("admin %s exited %d, want 2", strings.Join(args, " "), code)
+		}
+	}
+	if code := run([]string{"-actor", " ", "org", "list"}, &bytes.Buffer{}); code != 1 {
+		t.Errorf("blank -actor exited %d, want 1", code)
+	}
+
+	t.Setenv("ENVIRONMENT", "no-such-profile")
+	f.mustFail(t, "org", "list")
+}
+
+func TestOrgAndMemberCommands(t *testing.T) {
+	f := newAdminFixture(t)
+
+	f.mustFail(t, "org", "create", "-id", "org-a")
+	f.mustFail(t, "org", "create", "-id", "org-a", "-name", "Clinic A", "-timezone", "Mars/Olympus")
+	var org data.Organization
+	f.mustRun(t, &org, "org", "create", "-id", "org-a", "-name", "Clinic A", "-email", "a@example.com")
+	if org.UID != "org-a" || org.Name != "Clinic A" || org.Settings.Timezone != "America/New_York" {
+		t.Fatalf("created %+v", org)
+	}
+	f.mustFail(t, "org", "create", "-id", "org-a", "-name", "Clinic A again")
+	if succeeded, failed := f.countOutcomes(t, "ADMIN_ORG_CREATE"); succeeded != 1 || failed != 3 {
+		t.Fatalf("org create audited %d successes and %d failures", succeeded, failed)
+	}
+
+	var rows []struct{ ID, Name string }
+	f.mustRun(t, &rows, "org", "list")
+	if len(rows) != 1 || rows[0].ID != "org-a" || rows[0].Name != "Clinic A" {
+		t.Fatalf("org list: %+v", rows)
+	}
+
+	f.mustFail(t, "member", "grant", "-org", "org-a")
+	f.mustFail(t, "member", "grant", "-org", "org-missing", "-user", "clinician-1")
+	var member data.OrganizationMember
+	f.mustRun(t, &member, "member", "grant", "-org", "org-a", "-user", "clinician-1")
+	if member.UserID != "clinician-1" || member.GrantedBy != "test-operator" {
+		t.Fatalf("granted %+v", member)
+	}
+
+	var inspected struct {
+		Members []data.OrganizationMember `json:"members"`
+		Counts  map[string]int            `json:"counts"`
+	}
+	f.mustRun(t, &inspected, "org", "inspect", "-id", "org-a")
+	if len(inspected.Members) != 1 || inspected.Members[0].UserID != "clinician-1" || inspected.Counts["forms"] != 0 {
+		t.Fatalf("org inspect: %+v", inspected)
+	}
+	f.mustFail(t, "org", "inspect", "-id", "org-missing")
+
+	f.createSession(t, "session-1", "clinician-1", "org-a")
+	var revoked struct {
+		SessionsRevoked int `json:"sessions_revoked"`
+	}
+	f.mustRun(t, &revoked, "member", "revoke", "-org", "org-a", "-user", "clinician-1")
+	if revoked.SessionsRevoked != 1 {
+		t.Fatalf("member revoke ended %d sessions", revoked.SessionsRevoked)
+	}
+	f.mustRun(t, &inspected, "org", "inspect", "-id", "org-a")
+	if len(inspected.Members) != 0 {
+		t.Fatalf("revoked member still listed: %+v", inspected.Members)
+	}
+}
+
+func TestFormExportAndImport(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+	f.mustRun(t, nil, "org", "create", "-id", "org-a", "-name", "Clinic A")
+	f.mustRun(t, nil, "org", "create", "-id", "org-b", "-name", "Clinic B")
+	form := data.Form{Title: "Intake", OrganizationID: "org-a", SurveyJSON: map[string]interface{}{"pages": []interface{}{}}}
+	if _, err := f.client.Collection("forms").Doc("form-1").Set(ctx, form); err != nil {
+		t.Fatalf("seed form: %v", err)
+	}
+
+	f.mustFail(t, "form", "export")
+	f.mustFail(t, "form", "export", "-org", "org-b", "-form", "form-1")
+	var export formExportFile
+	f.mustRun(t, &export, "form", "export", "-org", "org-a")
+	if len(export.Forms) != 1 || export.Forms[0].ID != "form-1" || export.Forms[0].Title != "Intake" {
+		t.Fatalf("export: %+v", export)
+	}
+	path := filepath.Join(f.dir, "forms.json")
+	if code, stdout := f.run(t, "form", "export", "-org", "org-a", "-out", path); code != 0 || stdout != "" {
+		t.Fatalf("export to file exited %d and printed %q", code, stdout)
+	}
+
+	f.mustFail(t, "form", "import", "-org", "org-b")
+	f.mustFail(t, "form", "import", "-org", "org-missing", "-in", path)
+	f.mustFail(t, "form", "import", "-org", "org-a", "-in", path, "-keep-ids")
+	var created map[string]string
+	f.mustRun(t, &created, "form", "import", "-org", "org-b", "-in", path)
+	copyID := created["form-1"]
+	if copyID == "" || copyID == "form-1" {
+		t.Fatalf("import created %v", created)
+	}
+	doc, err := f.client.Collection("forms").Doc(copyID).Get(ctx)
+	if err != nil {
+		t.Fatalf("imported form: %v", err)
+	}
+	var copied data.Form
+	if err := doc.DataTo(&copied); err != nil || copied.OrganizationID != "org-b" || copied.Title != "Intake" || copied.CreatedBy != "test-operator" {
+		t.Fatalf("imported %+v, %v", copied, err)
+	}
+	if succeeded, failed := f.countOutcomes(t, "ADMIN_FORM_IMPORT"); succeeded != 1 || failed != 3 {
+		t.Fatalf("form import audited %d successes and %d failures", succeeded, failed)
+	}
+}
+
+func TestResponseReindex(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+	response := map[string]interface{}{
+		"organizationId": "org-a",
+		"formId":         "form-1",
+		"responses":      map[string]interface{}{"first_name": "Ada", "last_name": "Lovelace"},
+	}
+	if _, err := f.client.Collection("form_responses").Doc("response-1").Set(ctx, response); err != nil {
+		t.Fatalf("seed response: %v", err)
+	}
+
+	f.mustFail(t, "response", "reindex")
+	f.mustFail(t, "response", "reindex", "-org", "org-a", "-response", "response-1")
+	f.mustFail(t, "response", "reindex", "-response", "response-missing")
+	var result struct{ Scanned, Rewritten, Failed int }
+	f.mustRun(t, &result, "response", "reindex", "-org", "org-a")
+	if result.Scanned != 1 || result.Rewritten != 1 || result.Failed != 0 {
+		t.Fatalf("reindex: %+v", result)
+	}
+	f.mustRun(t, &result, "response", "reindex", "-response", "response-1")
+	if result.Scanned != 1 || result.Rewritten != 0 {
+		t.Fatalf("second reindex: %+v", result)
+	}
+}
+
+func TestCacheLockAndSessionCommands(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+
+	f.mustFail(t, "cache", "flush")
+	var flushed struct {
+		KeysRemoved int `json:"keys_removed"`
+	}
+	f.mustRun(t, &flushed, "cache", "flush", "-org", "org-a")
+
+	lock := services.NewDistributedLock(f.rdb, "pdf-gen:response-1", time.Minute)
+	if acquired, err := lock.Acquire(ctx); err != nil || !acquired {
+		t.Fatalf("acquire: %v %v", acquired, err)
+	}
+	var locks struct {
+		ActiveLocks []struct{ Resource string } `json:"active_locks"`
+		TotalActive int                         `json:"total_active"`
+	}
+	f.mustRun(t, &locks, "lock", "list")
+	if locks.TotalActive != 1 || locks.ActiveLocks[0].Resource != "lock:pdf-gen:response-1" {
+		t.Fatalf("lock list: %+v", locks)
+	}
+	f.mustFail(t, "lock", "release")
+	f.mustRun(t, nil, "lock", "release", "-resource", "pdf-gen:response-1")
+	if held, err := lock.IsHeld(ctx); err != nil || held {
+		t.Fatalf("lock still held after release: %v %v", held, err)
+	}
+	f.mustFail(t, "lock", "release", "-resource", "pdf-gen:response-1")
+
+	f.createSession(t, "session-1", "clinician-1", "org-a")
+	f.createSession(t, "session-2", "clinician-2", "org-a")
+	f.createSession(t, "session-3", "clinician-3", "org-b")
+	f.mustFail(t, "session", "revoke")
+	f.mustFail(t, "session", "revoke", "-user", "clinician-1", "-org", "org-a")
+	var revoked struct {
+		SessionsRevoked int `json:"sessions_revoked"`
+	}
+	f.mustRun(t, &revoked, "session", "revoke", "-org", "org-a")
+	if revoked.SessionsRevoked != 2 {
+		t.Fatalf("revoked %d sessions of org-a, want 2", revoked.SessionsRevoked)
+	}
+	f.mustRun(t, &revoked, "session", "revoke", "-user", "clinician-3")
+	if revoked.SessionsRevoked != 1 {
+		t.Fatalf("revoked %d sessions of clinician-3, want 1", revoked.SessionsRevoked)
+	}
+}
+
+func TestRetentionDryRun(t *testing.T) {
+	f := newAdminFixture(t)
+	f.mustFail(t, "retention", "dry-run")
+	var report struct {
+		Counts map[string]int `json:"counts"`
+	}
+	f.mustRun(t, &report, "retention", "dry-run", "-org", "org-a")
+	if succeeded, failed := f.countOutcomes(t, "ADMIN_RETENTION_DRY_RUN"); succeeded != 1 || failed != 1 {
+		t.Fatalf("retention dry-run audited %d successes and %d failures", succeeded, failed)
+	}
+}
+
+func TestMigrateCommands(t *testing.T) {
+	f := newAdminFixture(t)
+	var records []data.MigrationRecord
+	f.mustRun(t, &records, "migrate", "status")
+	if len(records) == 0 {
+		t.Fatal("no migrations registered")
+	}
+	for _, record := range records {
+		if record.Status != "pending" {
+			t.Fatalf("fresh database reports %+v", record)
+		}
+	}
+
+	f.mustFail(t, "migrate", "run", "-to", "many")
+	f.mustRun(t, &records, "migrate", "run", "-dry-run")
+	f.mustRun(t, &records, "migrate", "status")
+	for _, record := range records {
+		if record.Status != "pending" {
+			t.Fatalf("dry run recorded %+v", record)
+		}
+	}
+
+	f.mustRun(t, &records, "migrate", "run")
+	f.mustRun(t, &records, "migrate", "status")
+	for _, record := range records {
+		if record.Status != "completed" {
+			t.Fatalf("after migrate run: %+v", record)
+		}
+	}
+}
+
+func TestOrgBackupAndRestore(t *testing.T) {
+	f := newAdminFixture(t)
+	ctx := context.Background()
+	f.mustRun(t, nil, "org", "create", "-id", "org-a", "-name", "Clinic A")
+	form := data.Form{Title: "Intake", OrganizationID: "org-a", SurveyJSON: map[string]interface{}{"pages": []interface{}{}}}
+	if _, err := f.client.Collection("forms").Doc("form-1").Set(ctx, form); err != nil {
+		t.Fatalf("seed form: %v", err)
+	}
+	passphrase := filepath.Join(f.dir, "passphrase")
+	if err := os.WriteFile(passphrase, []byte("correct horse battery staple\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(f.dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(f.dir, "org-a.zip")
+
+	f.mustFail(t, "org", "backup", "-org", "org-a", "-out", archive)
+	f.mustFail(t, "org", "backup", "-org", "org-a", "-out", archive, "-passphrase-file", empty)
+	var job data.OrgArchiveJob
+	f.mustRun(t, &job, "org", "backup", "-org", "org-a", "-out", archive, "-passphrase-file", passphrase)
+	if job.Status != services.ArchiveCompleted || !job.Encrypted {
+		t.Fatalf("backup: %+v", job)
+	}
+	if info, err := os.Stat(archive); err != nil || info.Size() == 0 {
+		t.Fatalf("archive not written: %v", err)
+	}
+
+	f.mustFail(t, "org", "restore", "-org", "org-a", "-in", archive)
+	f.mustRun(t, &job, "org", "restore", "-org", "org-a", "-in", archive, "-passphrase-file", passphrase, "-dry-run")
+	if job.Status != services.ArchiveCompleted || job.SourceOrganizationID != "org-a" {
+		t.Fatalf("restore dry run: %+v", job)
+	}
+}
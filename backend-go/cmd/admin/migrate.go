@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"backend-go/internal/data"
+	"backend-go/internal/migrations"
+	"backend-go/internal/services"
+)
+
+func migrateStatus(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("migrate status", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	records, err := migrations.NewRunner(a.client, nil, a.encryptor, a.cfg.Migrations.BatchSize).Status(ctx)
+	if err != nil {
+		return err
+	}
+	return a.printJSON(records)
+}
+
+func migrateRun(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("migrate run", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	to := fs.Int("to", 0, "stop after the migration with this ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entry.ResourceType = "migration"
+
+	// The lock is only needed for writes; a dry run works without Redis
+	rdb, err := a.redis()
+	if err != nil && !*dryRun {
+		return err
+	}
+	verb := "changed"
+	if *dryRun {
+		verb = "would change"
+	}
+	runner := migrations.NewRunner(a.client, rdb, a.encryptor, a.cfg.Migrations.BatchSize)
+	records, err := runner.Run(ctx, migrations.Options{
+		DryRun: *dryRun,
+		To:     *to,
+		Progress: func(record data.MigrationRecord) {
+			log.Printf("ADMIN: %04d %s: %d scanned, %d %s", record.ID, record.Name, record.Scanned, record.Changed, verb)
+		},
+	})
+
+	changed := map[string]int{}
+	for _, record := range records {
+		changed[record.Name] = record.Changed
+	}
+	entry.Metadata = map[string]interface{}{"dry_run": *dryRun, "changed": changed}
+	if printErr := a.printJSON(records); err == nil {
+		err = printErr
+	}
+	return err
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func orgCreate(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("org create", flag.ContinueOnError)
+	id := fs.String("id", "", "organization ID (the owner's UID)")
+	name := fs.String("name", "", "organization name")
+	email := fs.String("email", "", "contact email")
+	phone := fs.String("phone", "", "contact phone")
+	timezone := fs.String("timezone", "America/New_York", "IANA time zone for reminders")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "id", "name"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "organization", *id, *id
+	if _, err := time.LoadLocation(*timezone); err != nil {
+		return fmt.Errorf("invalid -timezone: %w", err)
+	}
+
+	now := time.Now().UTC()
+	org := data.Organization{
+		UID:   *id,
+		Name:  *name,
+		Email: *email,
+		Phone: *phone,
+		Settings: data.OrganizationSettings{
+			HIPAACompliant: true,
+			Timezone:       *timezone,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := a.client.Collection("organizations").Doc(*id).Create(ctx, org); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return fmt.Errorf("organization %s already exists", *id)
+		}
+		return err
+	}
+	log.Printf("ADMIN: created organization %s", *id)
+	return a.printJSON(org)
+}
+
+func orgList(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("org list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	docs, err := a.client.Collection("organizations").Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	type row struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Email     string    `json:"email,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	rows := make([]row, 0, len(docs))
+	for _, doc := range docs {
+		var org data.Organization
+		if err := doc.DataTo(&org); err != nil {
+			log.Printf("ADMIN: skipping unreadable organization %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		rows = append(rows, row{ID: doc.Ref.ID, Name: org.Name, Email: org.Email, CreatedAt: org.CreatedAt})
+	}
+	entry.Metadata = map[string]interface{}{"count": len(rows)}
+	return a.printJSON(rows)
+}
+
+func orgInspect(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("org inspect", flag.ContinueOnError)
+	id := fs.String("id", "", "organization ID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "id"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "organization", *id, *id
+
+	doc, err := a.client.Collection("organizations").Doc(*id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("organization %s not found", *id)
+	}
+	if err != nil {
+		return err
+	}
+	var org data.Organization
+	if err := doc.DataTo(&org); err != nil {
+		return err
+	}
+	org.ID = doc.Ref.ID
+
+	members := []data.OrganizationMember{}
+	memberDocs, err := doc.Ref.Collection("members").Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, m := range memberDocs {
+		var member data.OrganizationMember
+		if err := m.DataTo(&member); err == nil {
+			members = append(members, member)
+		}
+	}
+
+	counts := map[string]int{}
+	for _, collection := range []string{"forms", "form_responses", "share_links", "attachments", "legal_holds"} {
+		refs, err := a.client.Collection(collection).Where("organizationId", "==", *id).Select().Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %w", collection, err)
+		}
+		counts[collection] = len(refs)
+	}
+	_, err = a.client.Collection("data_keys").Doc(*id).Get(ctx)
+	hasKeys := err == nil
+
+	return a.printJSON(map[string]interface{}{
+		"organization": org,
+		"members":      members,
+		"counts":       counts,
+		"has_data_key": hasKeys,
+	})
+}
+
+func memberGrant(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("member grant", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization ID")
+	userID := fs.String("user", "", "user UID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org", "user"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "member", *userID, *orgID
+
+	orgRef := a.client.Collection("organizations").Doc(*orgID)
+	if _, err := orgRef.Get(ctx); status.Code(err) == codes.NotFound {
+		return fmt.Errorf("organization %s not found", *orgID)
+	} else if err != nil {
+		return err
+	}
+
+	member := data.OrganizationMember{UserID: *userID, GrantedBy: a.actor, GrantedAt: time.Now().UTC()}
+	authClient, err := a.firebaseAuth(ctx)
+	if err != nil {
+		return err
+	}
+	if authClient != nil {
+		user, err := authClient.GetUser(ctx, *userID)
+		if err != nil {
+			return fmt.Errorf("failed to look up user %s: %w", *userID, err)
+		}
+		member.Email = user.Email
+		claims := map[string]interface{}{}
+		for k, v := range user.CustomClaims {
+			claims[k] = v
+		}
+		if previous, _ := claims["organization_id"].(string); previous != "" && previous != *orgID {
+			entry.Metadata = map[string]interface{}{"previous_organization_id": previous}
+			log.Printf("ADMIN: %s moves from organization %s", *userID, previous)
+		}
+		claims["organization_id"] = *orgID
+		if err := authClient.SetCustomUserClaims(ctx, *userID, claims); err != nil {
+			return fmt.Errorf("failed to set organization claim: %w", err)
+		}
+	} else {
+		log.Printf("ADMIN: dev profile: no claim stored; dev tokens always act for their own UID")
+	}
+
+	if _, err := orgRef.Collection("members").Doc(*userID).Set(ctx, member); err != nil {
+		return err
+	}
+	log.Printf("ADMIN: granted %s membership of %s; it applies from the user's next login", *userID, *orgID)
+	return a.printJSON(member)
+}
+
+func memberRevoke(ctx context.Context, a *adminEnv, args []string, entry *services.AuditEntry) error {
+	fs := flag.NewFlagSet("member revoke", flag.ContinueOnError)
+	orgID := fs.String("org", "", "organization ID")
+	userID := fs.String("user", "", "user UID")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := require(fs, "org", "user"); err != nil {
+		return err
+	}
+	entry.ResourceType, entry.ResourceID, entry.OrganizationID = "member", *userID, *orgID
+
+	rdb, err := a.redis()
+	if err != nil {
+		return err
+	}
+	authClient, err := a.firebaseAuth(ctx)
+	if err != nil {
+		return err
+	}
+	if authClient != nil {
+		user, err := authClient.GetUser(ctx, *userID)
+		if err != nil {
+			return fmt.Errorf("failed to look up user %s: %w", *userID, err)
+		}
+		if current, _ := user.CustomClaims["organization_id"].(string); current == *orgID {
+			claims := map[string]interface{}{}
+			for k, v := range user.CustomClaims {
+				if k != "organization_id" {
+					claims[k] = v
+				}
+			}
+			if err := authClient.SetCustomUserClaims(ctx, *userID, claims); err != nil {
+				return fmt.Errorf("failed to clear organization claim: %w", err)
+			}
+		}
+		if err := authClient.RevokeRefreshTokens(ctx, *userID); err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+
+	if _, err := a.client.Collection("organizations").Doc(*orgID).Collection("members").Doc(*userID).Delete(ctx, firestore.Exists); err != nil {
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+		log.Printf("ADMIN: %s had no membership record in %s", *userID, *orgID)
+	}
+
+	// Sessions carry the organization they were created for; end them so the revocation
+	// takes effect now rather than when the session expires
+	revoked, err := services.RevokeSessions(ctx, rdb, *userID, "")
+	if err != nil {
+		return err
+	}
+	entry.Metadata = map[string]interface{}{"sessions_revoked": revoked}
+	log.Printf("ADMIN: revoked %s's membership of %s and %d session(s)", *userID, *orgID, revoked)
+	return a.printJSON(map[string]interface{}{"user_id": *userID, "organization_id": *orgID, "sessions_revoked": revoked})
+}
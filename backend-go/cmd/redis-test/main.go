@@ -37,7 +37,7 @@ func main() {
 		{
 			Name:        "DEFAULT-OLD",
 			Addr:        "10.35.139.228:6378", 
-			Password:    "8df0d1f3-e164-46df-b112-ff558446aa73",
+			Password:    os.Getenv("REDIS_OLD_PASSWORD"),
 			TLSEnabled:  true,
 			Description: "Old default network Redis instance",
 		},
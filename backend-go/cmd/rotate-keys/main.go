@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"backend-go/internal/config"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"google.golang.org/api/iterator"
+)
+
+// rotate-keys re-wraps organization data keys under the current key-encryption key and
+// optionally issues new data keys. Responses sealed with an older data key are re-encrypted
+// lazily the next time they are read; -reencrypt sweeps them immediately instead.
+func main() {
+	orgID := flag.String("org", "", "rotate a single organization (default: all key rings)")
+	rotateKEK := flag.Bool("rotate-kek", false, "add a new KEK to the local keyfile before re-wrapping (local provider only)")
+	newDataKey := flag.Bool("new-data-key", false, "issue a new data key version that new writes will use")
+	reencrypt := flag.Bool("reencrypt", false, "re-encrypt responses now instead of on next read")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	client, err := data.NewFirestoreClient(ctx, cfg.GCP.ProjectID)
+	if err != nil {
+		log.Fatalf("Failed to create Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	provider, err := services.NewKeyProvider(ctx, cfg.Keys)
+	if err != nil {
+		log.Fatalf("Failed to create key provider: %v", err)
+	}
+
+	if *rotateKEK {
+		local, ok := provider.(*services.LocalKeyProvider)
+		if !ok {
+			log.Fatal("-rotate-kek only applies to the local key provider; rotate KMS keys in Cloud KMS")
+		}
+		kekID, err := local.Rotate()
+		if err != nil {
+			log.Fatalf("Failed to rotate local KEK: %v", err)
+		}
+		log.Printf("ROTATE: new local KEK %s", kekID)
+	}
+
+	encryptor := services.NewFieldEncryptor(client, provider)
+
+	orgIDs := []string{*orgID}
+	if *orgID == "" {
+		refs, err := client.Collection("data_keys").DocumentRefs(ctx).GetAll()
+		if err != nil {
+			log.Fatalf("Failed to list key rings: %v", err)
+		}
+		orgIDs = orgIDs[:0]
+		for _, ref := range refs {
+			orgIDs = append(orgIDs, ref.ID)
+		}
+	}
+
+	failed := false
+	for _, id := range orgIDs {
+		rewrapped, err := encryptor.RotateKeyRing(ctx, id, *newDataKey)
+		if err != nil {
+			log.Printf("ROTATE: %s failed: %v", id, err)
+			failed = true
+			continue
+		}
+		log.Printf("ROTATE: %s re-wrapped %d data key version(s), new data key: %v", id, rewrapped, *newDataKey)
+	}
+
+	if *reencrypt {
+		query := client.Collection("form_responses").Query
+		if *orgID != "" {
+			query = query.Where("organizationId", "==", *orgID)
+		}
+
+		scanned, rewritten := 0, 0
+		iter := query.Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				log.Fatalf("Failed to list responses: %v", err)
+			}
+			scanned++
+			changed, err := encryptor.ReencryptResponse(ctx, doc.Ref)
+			if err != nil {
+				log.Printf("ROTATE: response %s failed: %v", doc.Ref.ID, err)
+				failed = true
+				continue
+			}
+			if changed {
+				rewritten++
+			}
+		}
+		iter.Stop()
+		log.Printf("ROTATE: re-encrypted %d of %d response(s)", rewritten, scanned)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"backend-go/internal/config"
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+)
+
+// seed loads the sample clinic, forms and responses used for local development. Under
+// ENVIRONMENT=dev it writes to the running dev server's in-memory Firestore; otherwise it
+// writes to the configured project, which should only ever be an emulator or sandbox.
+func main() {
+	orgID := flag.String("org", "", "organization to seed (default: dev.user_id)")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if *orgID == "" {
+		*orgID = cfg.Dev.UserID
+	}
+	if *orgID == "" {
+		log.Fatal("-org is required outside the dev profile")
+	}
+
+	var client *firestore.Client
+	if cfg.Offline() {
+		client, err = dev.DialFirestore(ctx, cfg.Dev.FirestoreAddr, cfg.GCP.ProjectID)
+	} else {
+		client, err = data.NewFirestoreClient(ctx, cfg.GCP.ProjectID)
+	}
+	if err != nil {
+		log.Fatalf("Failed to create Firestore client: %v", err)
+	}
+	defer client.Close()
+
+	provider, err := services.NewKeyProvider(ctx, cfg.Keys)
+	if err != nil {
+		log.Fatalf("Failed to create key provider: %v", err)
+	}
+	encryptor := services.NewFieldEncryptor(client, provider)
+
+	// The in-memory store only exists while the dev server runs; fail fast if it is down
+	seedCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	seeded, err := dev.Seed(seedCtx, client, encryptor, *orgID)
+	if err != nil {
+		log.Fatalf("Failed to seed: %v", err)
+	}
+	log.Printf("SEED: wrote %d sample forms with one response each for %s", seeded, *orgID)
+
+	if cfg.Offline() {
+		token, err := dev.NewAuth().SignIDToken(*orgID, *orgID+"@dev.local", 24*time.Hour)
+		if err != nil {
+			log.Fatalf("Failed to sign dev token: %v", err)
+		}
+		log.Printf("SEED: bearer token for %s (valid 24h): %s", *orgID, token)
+	}
+}
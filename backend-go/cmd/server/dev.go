@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"backend-go/internal/config"
+	"backend-go/internal/dev"
+
+	"cloud.google.com/go/firestore"
+)
+
+// devServices are the in-process fakes the dev profile uses in place of Firestore, Redis,
+// Firebase Auth, Vertex AI and Gotenberg
+type devServices struct {
+	firestore *dev.Firestore
+	redis     *dev.Redis
+	client    *firestore.Client
+	auth      *dev.Auth
+	model     *dev.Model
+	pdf       *dev.PDFConverter
+}
+
+// startDevServices starts the fakes and points cfg.Redis at the in-memory server, so it
+// must run before data.ConfigureRedis
+func startDevServices(ctx context.Context, cfg *config.Config) (*devServices, error) {
+	store, err := dev.StartFirestore(cfg.Dev.FirestoreAddr)
+	if err != nil {
+		return nil, fmt.Errorf("in-memory Firestore: %w", err)
+	}
+	client, err := dev.DialFirestore(ctx, store.Addr(), cfg.GCP.ProjectID)
+	if err != nil {
+		store.Stop()
+		return nil, fmt.Errorf("in-memory Firestore: %w", err)
+	}
+	redis, err := dev.StartRedis(cfg.Dev.RedisAddr)
+	if err != nil {
+		client.Close()
+		store.Stop()
+		return nil, fmt.Errorf("in-memory Redis: %w", err)
+	}
+	cfg.Redis.Addr = redis.Addr()
+	cfg.Redis.TLSEnabled = false
+
+	log.Printf("DEV: in-memory Firestore on %s, Redis on %s", store.Addr(), redis.Addr())
+	log.Printf("DEV: Firebase Auth, Vertex AI and Gotenberg are replaced by local fakes")
+
+	return &devServices{
+		firestore: store,
+		redis:     redis,
+		client:    client,
+		auth:      dev.NewAuth(),
+		model:     dev.NewModel(),
+		pdf:       dev.NewPDFConverter(),
+	}, nil
+}
+
+// logToken prints a bearer token for the dev user so the API can be called with curl
+func (d *devServices) logToken(userID string) {
+	token, err := d.auth.SignIDToken(userID, userID+"@dev.local", 24*time.Hour)
+	if err != nil {
+		log.Printf("DEV: failed to sign a token for %s: %v", userID, err)
+		return
+	}
+	log.Printf("DEV: bearer token for %s (valid 24h): %s", userID, token)
+}
+
+// stop shuts the in-memory servers down after their clients are closed
+func (d *devServices) stop(context.Context) error {
+	d.redis.Close()
+	d.firestore.Stop()
+	return nil
+}
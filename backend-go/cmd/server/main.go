@@ -3,68 +3,227 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
+	"time"
 
 	"backend-go/internal/api"
+	"backend-go/internal/config"
 	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/health"
+	"backend-go/internal/lifecycle"
+	"backend-go/internal/logging"
+	"backend-go/internal/migrations"
 	"backend-go/internal/services"
+	"backend-go/internal/telemetry"
 
+	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/vertexai/genai"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"time"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
 	ctx := context.Background()
+	logging.Setup()
 
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	if projectID == "" {
-		log.Fatal("GCP_PROJECT_ID environment variable not set")
-	}
-
-	// === CLIENT INITIALIZATION ===
+	// Background workers are started through app so shutdown can stop and wait for them
+	app := lifecycle.New(ctx)
 
-	firestoreClient, err := data.NewFirestoreClient(ctx, projectID)
+	shutdownTracing, err := telemetry.Setup(ctx)
 	if err != nil {
-		log.Fatalf("Failed to create Firestore client: %v", err)
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
-	defer firestoreClient.Close()
 
-	vertexClient, err := genai.NewClient(ctx, projectID, "us-central1")
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to create Vertex AI client: %v", err)
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	for _, warning := range cfg.Warnings() {
+		log.Printf("CONFIG: WARNING: %s", warning)
 	}
-	defer vertexClient.Close()
+	log.Printf("CONFIG: loaded %s profile", cfg.Environment)
+	projectID := cfg.GCP.ProjectID
 
-	authClient, firebaseApp, err := data.NewFirebaseAuthClient(ctx, projectID)
-	if err != nil {
-		log.Fatalf("Failed to create Firebase Auth client: %v", err)
+	// === CLIENT INITIALIZATION ===
+
+	var (
+		firestoreClient *firestore.Client
+		vertexClient    *genai.Client
+		authClient      api.TokenVerifier
+		devStack        *devServices
+	)
+	if cfg.Offline() {
+		// The dev profile runs against in-process fakes and needs no cloud credentials
+		devStack, err = startDevServices(ctx, cfg)
+		if err != nil {
+			log.Fatalf("Failed to start dev services: %v", err)
+		}
+		firestoreClient = devStack.client
+		authClient = devStack.auth
+	} else {
+		firestoreClient, err = data.NewFirestoreClient(ctx, projectID, telemetry.GRPCClientOptions()...)
+		if err != nil {
+			log.Fatalf("Failed to create Firestore client: %v", err)
+		}
+
+		vertexClient, err = genai.NewClient(ctx, projectID, cfg.GCP.Location, telemetry.GRPCClientOptions()...)
+		if err != nil {
+			log.Fatalf("Failed to create Vertex AI client: %v", err)
+		}
+
+		authClient, _, err = data.NewFirebaseAuthClient(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to create Firebase Auth client: %v", err)
+		}
 	}
 
 	// Initialize secure Redis Client with HIPAA compliance
+	data.ConfigureRedis(cfg.Redis)
 	rdb := data.GetRedisClient()
 
 	// === SERVICE INITIALIZATION ===
 
-	vertexService := services.NewVertexAIService(vertexClient, "gemini-2.5-pro")
-	gotenbergService := services.NewGotenbergService()
-	insuranceCardService := services.NewInsuranceCardService(vertexClient)
-	insuranceCardHandler := api.NewInsuranceCardHandler(insuranceCardService)
+	// PHI fields and Redis sessions/caches are encrypted with per-organization data keys
+	keyProvider, err := services.NewKeyProvider(ctx, cfg.Keys)
+	if err != nil {
+		log.Fatalf("Failed to create key provider: %v", err)
+	}
+	fieldEncryptor := services.NewFieldEncryptor(firestoreClient, keyProvider)
+	services.SetCacheEncryptor(fieldEncryptor)
+	phiAccessLog := services.NewPHIAccessLog(firestoreClient, fieldEncryptor)
+
+	if devStack != nil {
+		if cfg.Dev.Seed {
+			seeded, err := dev.Seed(ctx, firestoreClient, fieldEncryptor, cfg.Dev.UserID)
+			if err != nil {
+				log.Fatalf("Failed to seed dev data: %v", err)
+			}
+			log.Printf("DEV: seeded %d sample forms for %s", seeded, cfg.Dev.UserID)
+		}
+		devStack.logToken(cfg.Dev.UserID)
+	}
+
+	// Legacy document shapes are normalized before any handler reads them. Another
+	// instance holding the lock is applying the same migrations, so this one carries on.
+	if cfg.Migrations.RunOnStartup {
+		runner := migrations.NewRunner(firestoreClient, rdb, fieldEncryptor, cfg.Migrations.BatchSize)
+		if _, err := runner.Run(ctx, migrations.Options{}); errors.Is(err, migrations.ErrLocked) {
+			log.Printf("MIGRATIONS: %v; starting without waiting", err)
+		} else if err != nil {
+			log.Fatalf("Failed to apply migrations: %v", err)
+		}
+	}
+
+	var (
+		vertexService        *services.VertexAIService
+		insuranceCardService *services.InsuranceCardService
+		gotenbergService     services.PDFConverter
+	)
+	if devStack != nil {
+		vertexService = services.NewVertexAIServiceWithModel(devStack.model)
+		insuranceCardService = services.NewInsuranceCardServiceWithModel(devStack.model)
+		gotenbergService = devStack.pdf
+	} else {
+		vertexService = services.NewVertexAIService(vertexClient, cfg.AI.Model)
+		insuranceCardService = services.NewInsuranceCardService(vertexClient, cfg.AI.InsuranceCardModel)
+		gotenbergService = services.NewGotenbergService(cfg.Gotenberg.URL)
+	}
 	securityValidator := services.NewSecurityValidator()
 
-	auditLogger, err := services.NewCloudAuditLogger(projectID)
+	auditLogger, err := services.NewAuditTrailFromConfig(projectID, firestoreClient, cfg.Audit)
+	if err != nil {
+		log.Fatalf("Failed to create audit trail: %v", err)
+	}
+
+	uploadSanitizer := services.NewUploadSanitizer(auditLogger)
+	insuranceCardHandler := api.NewInsuranceCardHandler(insuranceCardService, uploadSanitizer)
+
+	blobStore, err := services.NewBlobStore(ctx, cfg.Attachments)
 	if err != nil {
-		log.Printf("WARNING: Audit logging disabled: %v", err)
+		log.Fatalf("Failed to create attachment store: %v", err)
 	}
-	if auditLogger != nil {
-		defer auditLogger.Close()
+	attachmentService := services.NewAttachmentService(firestoreClient, blobStore, uploadSanitizer, fieldEncryptor)
+
+	// === BACKGROUND WORKERS ===
+
+	notificationSender, err := services.NewNotificationSender(cfg.Notifications.Provider)
+	if err != nil {
+		log.Fatalf("Failed to create notification sender: %v", err)
 	}
+	reminderScheduler := services.NewReminderScheduler(firestoreClient, rdb, notificationSender, auditLogger, cfg.Server.AppBaseURL)
+	app.Go("reminders", reminderScheduler.Start)
+
+	retentionService := services.NewRetentionService(firestoreClient, rdb, blobStore, attachmentService, fieldEncryptor, auditLogger)
+	app.Go("retention", retentionService.Start)
+
+	patientExportService, err := services.NewPatientExportService(firestoreClient, rdb, blobStore, attachmentService, fieldEncryptor, gotenbergService, phiAccessLog, auditLogger)
+	if err != nil {
+		log.Fatalf("Failed to create patient export service: %v", err)
+	}
+	app.Go("patient-exports", patientExportService.Start)
+
+	orgArchiveService := services.NewOrgArchiveService(firestoreClient, rdb, blobStore, fieldEncryptor, uploadSanitizer, auditLogger)
+	app.Go("org-archives", orgArchiveService.Start)
+
+	webhookService := services.NewWebhookService(firestoreClient, rdb, fieldEncryptor, phiAccessLog, cfg.Webhooks.AllowLoopback)
+	app.Go("webhooks", webhookService.Start)
+
+	// Domain events are written to the outbox with each entity change; the dispatcher
+	// drives cache invalidation, audit entries and webhooks from there
+	eventBus := services.NewEventBus(firestoreClient, rdb)
+	services.RegisterCoreSubscribers(eventBus, firestoreClient, rdb, webhookService, auditLogger, fieldEncryptor)
+	app.Go("events", eventBus.Start)
+
+	// Deleted forms and responses stay restorable for the grace period, then are purged
+	trashService := services.NewTrashService(firestoreClient, rdb, eventBus, retentionService, auditLogger, cfg.Trash.GracePeriod)
+	app.Go("trash", trashService.Start)
+
+	// Amendments correct submitted answers and keep the replaced values as revisions
+	amendmentService := services.NewAmendmentService(firestoreClient, eventBus, fieldEncryptor, attachmentService)
+
+	// Submissions from the same patient with similar answers are flagged for review
+	duplicateService := services.NewDuplicateService(firestoreClient, eventBus, fieldEncryptor, cfg.Duplicates.Window, cfg.Duplicates.MinSimilarity)
+
+	// Form editing leases live in Redis; without it the lease routes answer 503
+	lockManager := services.NewLockManager(rdb)
+
+	// Retried creation requests carrying an Idempotency-Key replay the first response
+	idempotency := api.IdempotencyMiddleware(services.NewIdempotencyStore(firestoreClient, rdb, cfg.Idempotency.TTL))
+
+	// === SHUTDOWN ORDER ===
+	// Hooks run after requests and workers drain. Locks go first so other instances can
+	// pick up the work; the audit trail is flushed while Firestore is still open.
+	app.OnShutdown("release locks", func(ctx context.Context) error {
+		if released := services.ReleaseHeldLocks(ctx); released > 0 {
+			log.Printf("LIFECYCLE: released %d held locks", released)
+		}
+		return nil
+	})
+	app.OnShutdown("drain re-encryption", fieldEncryptor.Drain)
+	app.OnShutdown("flush audit trail", func(context.Context) error { return auditLogger.Close() })
+	app.OnShutdown("close firestore", func(context.Context) error { return firestoreClient.Close() })
+	app.OnShutdown("close redis", func(context.Context) error { return data.CloseRedis() })
+	if vertexClient != nil {
+		app.OnShutdown("close vertex", func(context.Context) error { return vertexClient.Close() })
+	}
+	if devStack != nil {
+		app.OnShutdown("stop dev services", devStack.stop)
+	}
+	app.OnShutdown("flush traces", shutdownTracing)
+
+	// === HEALTH CHECKS ===
+
+	healthChecks := health.NewRegistry()
+	healthChecks.Register(health.Firestore(firestoreClient))
+	healthChecks.Register(health.Gotenberg(gotenbergService.GetServiceHealth))
+	healthChecks.Register(health.AuditLogger(auditLogger.Health))
+	healthChecks.Register(health.Redis(data.GetRedisClient))
+	healthChecks.Register(health.Vertex(vertexService.Ping))
 
 	// === ROUTER AND MIDDLEWARE SETUP ===
 
@@ -73,25 +232,28 @@ func main() {
 	r.RedirectTrailingSlash = false
 
 	r.Use(gin.Recovery())
+	// Spans are named by route pattern; probes and scrapes are not traced
+	r.Use(otelgin.Middleware(telemetry.ServiceName(), otelgin.WithFilter(func(req *http.Request) bool {
+		switch req.URL.Path {
+		case "/health", "/livez", "/readyz", "/metrics":
+			return false
+		}
+		return true
+	})))
+	r.Use(api.RequestLoggerMiddleware())
 	
 	// CORS must come before SecurityHeaders to properly handle preflight requests
-	corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS")
-	if corsOrigins == "" {
-		// Default to both localhost and production URLs including custom domain
-		corsOrigins = "http://localhost:3000;https://healthcare-forms-v2.web.app;https://healthcare-forms-v2.firebaseapp.com;https://form.easydocforms.com"
-	}
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     strings.Split(corsOrigins, ";"),
+		AllowOrigins:     cfg.Server.CORSAllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-CSRF-Token"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-CSRF-Token", "X-Purpose-Of-Use", "X-Request-ID", "If-Match", "X-Lease-Token", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 	
 	r.Use(api.SecurityHeadersMiddleware())
 	r.Use(api.ErrorHandlerMiddleware())
-	r.Use(gin.Logger())
 
 	// === STATIC FILE SERVING (BEFORE OTHER ROUTES) ===
 	// Register static files early to avoid inheriting API middleware
@@ -108,199 +270,28 @@ func main() {
 
 	// === ROUTE DEFINITIONS ===
 
-	// Enhanced health check with Redis security validation and emergency store status
-	r.GET("/health", func(c *gin.Context) {
-		ctx := context.Background()
-		
-		// Basic service health
-		healthStatus := gin.H{
-			"status": "healthy", 
-			"timestamp": time.Now().Unix(),
-			"version": "1.5.0", // Updated with Redis improvements and emergency CSRF
-		}
-		
-		// Get Redis statistics from our enhanced client
-		redisStats := data.GetRedisStats()
-		
-		// Redis connectivity and comprehensive health check
-		redisClient := data.GetRedisClient()
-		if redisClient == nil {
-			healthStatus["status"] = "degraded"
-			healthStatus["redis"] = gin.H{
-				"status": "unavailable",
-				"message": "Redis client initialization failed",
-				"configuration": gin.H{
-					"address": redisStats.Address,
-					"tls_enabled": redisStats.TLSEnabled,
-					"initialization_time": redisStats.InitializationTime,
-				},
-				"last_error": func() string {
-					if redisStats.LastError != nil {
-						return redisStats.LastError.Error()
-					}
-					return "none"
-				}(),
-				"emergency_mode": gin.H{
-					"csrf_tokens": "active",
-					"note": "CSRF tokens stored in memory while Redis is unavailable",
-				},
-			}
-		} else {
-			// Test current connection
-			pingStart := time.Now()
-			if err := redisClient.Ping(ctx).Err(); err != nil {
-				healthStatus["status"] = "unhealthy"
-				healthStatus["redis"] = gin.H{
-					"status": "disconnected",
-					"error": err.Error(),
-					"ping_duration": time.Since(pingStart).String(),
-					"configuration": gin.H{
-						"address": redisStats.Address,
-						"tls_enabled": redisStats.TLSEnabled,
-						"initialization_time": redisStats.InitializationTime,
-					},
-					"emergency_mode": gin.H{
-						"csrf_tokens": "active",
-						"note": "CSRF tokens fallback to memory store",
-					},
-				}
-				c.JSON(500, healthStatus)
-				return
-			}
-			
-			pingDuration := time.Since(pingStart)
-			
-			// Redis connection pool health
-			stats := redisClient.PoolStats()
-			
-			// Test basic operations to ensure full functionality
-			testKey := fmt.Sprintf("health-test:%d", time.Now().Unix())
-			testStart := time.Now()
-			testSuccess := true
-			var testError error
-			
-			// Quick SET/GET/DEL test
-			if err := redisClient.Set(ctx, testKey, "health-check", 10*time.Second).Err(); err != nil {
-				testSuccess = false
-				testError = fmt.Errorf("SET failed: %w", err)
-			} else if val, err := redisClient.Get(ctx, testKey).Result(); err != nil {
-				testSuccess = false
-				testError = fmt.Errorf("GET failed: %w", err)
-			} else if val != "health-check" {
-				testSuccess = false
-				testError = fmt.Errorf("GET returned wrong value: %s", val)
-			} else if err := redisClient.Del(ctx, testKey).Err(); err != nil {
-				testSuccess = false
-				testError = fmt.Errorf("DEL failed: %w", err)
-			}
-			
-			testDuration := time.Since(testStart)
-			
-			// Get Redis server information
-			info, infoErr := redisClient.Info(ctx, "memory", "stats", "replication").Result()
-			
-			redisHealth := gin.H{
-				"status": "connected",
-				"ping_duration": pingDuration.String(),
-				"operations_test": gin.H{
-					"success": testSuccess,
-					"duration": testDuration.String(),
-				},
-				"pool": gin.H{
-					"total_connections": stats.TotalConns,
-					"idle_connections": stats.IdleConns,
-					"stale_connections": stats.StaleConns,
-					"hits": stats.Hits,
-					"misses": stats.Misses,
-					"timeouts": stats.Timeouts,
-				},
-				"configuration": gin.H{
-					"address": redisStats.Address,
-					"tls_enabled": redisStats.TLSEnabled,
-					"initialization_time": redisStats.InitializationTime,
-					"connected_since": redisStats.LastConnectionTime,
-				},
-			}
-			
-			if !testSuccess && testError != nil {
-				redisHealth["operations_test"].(gin.H)["error"] = testError.Error()
-			}
-			
-			// Parse Redis INFO for key metrics
-			if infoErr == nil && info != "" {
-				memoryInfo := parseRedisMemoryInfo(info)
-				if len(memoryInfo) > 0 {
-					redisHealth["memory"] = memoryInfo
-				}
-				
-				statsInfo := parseRedisStatsInfo(info)
-				if len(statsInfo) > 0 {
-					redisHealth["stats"] = statsInfo
-				}
-			}
-			
-			// Check for warning conditions
-			var warnings []string
-			if stats.TotalConns == 0 {
-				warnings = append(warnings, "no_connections_available")
-				healthStatus["status"] = "degraded"
-			}
-			
-			if stats.Timeouts > 0 {
-				warnings = append(warnings, fmt.Sprintf("connection_timeouts_detected: %d", stats.Timeouts))
-			}
-			
-			if !testSuccess {
-				warnings = append(warnings, "basic_operations_test_failed")
-				healthStatus["status"] = "degraded"
-			}
-			
-			if pingDuration > 100*time.Millisecond {
-				warnings = append(warnings, fmt.Sprintf("high_ping_latency: %v", pingDuration))
-			}
-			
-			// Check hit ratio for performance monitoring
-			if stats.Hits+stats.Misses > 0 {
-				hitRatio := float64(stats.Hits) / float64(stats.Hits+stats.Misses)
-				redisHealth["hit_ratio"] = fmt.Sprintf("%.2f", hitRatio)
-				
-				if hitRatio < 0.8 {
-					warnings = append(warnings, fmt.Sprintf("low_hit_ratio: %.2f", hitRatio))
-				}
-			}
-			
-			if len(warnings) > 0 {
-				redisHealth["warnings"] = warnings
-				if healthStatus["status"] == "healthy" {
-					healthStatus["status"] = "degraded"
-				}
-			}
-			
-			healthStatus["redis"] = redisHealth
-		}
-		
-		// Add general system information
-		healthStatus["features"] = gin.H{
-			"csrf_protection": "active",
-			"emergency_csrf_store": "available",
-			"pdf_generation": "available",
-			"rate_limiting": "active",
-			"vpc_connectivity": "enabled",
-		}
-		
-		// Set appropriate HTTP status code
-		if healthStatus["status"] == "healthy" {
-			c.JSON(200, healthStatus)
-		} else if healthStatus["status"] == "degraded" {
-			c.JSON(200, healthStatus) // Still return 200 for degraded but functional
-		} else {
-			c.JSON(503, healthStatus) // Service unavailable for unhealthy
-		}
-	})
+	// Liveness never touches dependencies; readiness fails when Firestore, Gotenberg or
+	// the audit trail is down. /health is kept for existing probes.
+	r.GET("/livez", api.Livez())
+	r.GET("/readyz", api.Readyz(healthChecks))
+	r.GET("/health", api.Readyz(healthChecks))
+
+	healthRoutes := r.Group("/health")
+	{
+		healthRoutes.Use(api.AuthMiddleware(authClient))
+		healthRoutes.GET("/details", api.HealthDetails(healthChecks))
+	}
+
+	// Prometheus scrape endpoint; set METRICS_TOKEN to require a bearer token
+	r.GET("/metrics", api.MetricsHandler(cfg.Metrics.Token))
+
+	authRateLimit := api.NewRateLimiterConfig("auth", cfg.RateLimits.Auth)
+	apiRateLimit := api.NewRateLimiterConfig("api", cfg.RateLimits.API)
+	pdfRateLimit := api.NewRateLimiterConfig("pdf", cfg.RateLimits.PDF)
 
 	// --- Public Routes ---
 	publicRoutes := r.Group("/public")
-	publicRoutes.Use(api.RateLimiterMiddleware(api.APIRateLimit)) // Apply rate limiting to public routes
+	publicRoutes.Use(api.RateLimiterMiddleware(apiRateLimit)) // Apply rate limiting to public routes
 	{
 		publicRoutes.GET("/forms/:id", func(c *gin.Context) {
 			formID := c.Param("id")
@@ -333,14 +324,15 @@ func main() {
 	publicAPI := r.Group("/api")
 	{
 		publicAPI.GET("/forms/:id/public/:share_token", api.GetFormByShareToken(firestoreClient))
-		publicAPI.POST("/responses/public", api.CreatePublicFormResponse(firestoreClient))
+		publicAPI.POST("/responses/public", idempotency, api.CreatePublicFormResponse(firestoreClient, eventBus, attachmentService, fieldEncryptor, duplicateService))
+		publicAPI.POST("/exports/:id/download", api.RateLimiterMiddleware(authRateLimit), api.DownloadPatientExport(patientExportService))
 	}
 
 	// --- Auth Routes (Stricter Rate Limiting) ---
 	apiAuthRoutes := r.Group("/api/auth")
-	apiAuthRoutes.Use(api.RateLimiterMiddleware(api.AuthRateLimit)) // Stricter limits for auth endpoints
+	apiAuthRoutes.Use(api.RateLimiterMiddleware(authRateLimit)) // Stricter limits for auth endpoints
 	{
-		apiAuthRoutes.POST("/session-login", api.SessionLogin(firebaseApp))
+		apiAuthRoutes.POST("/session-login", api.SessionLogin(authClient, cfg.Session))
 	}
 
 	// --- Diagnostic Routes (protected by auth only, no CSRF) ---
@@ -358,42 +350,101 @@ func main() {
 		authTokenRoute.GET("/csrf-token", api.GenerateCSRFToken)
 	}
 
+	// --- Admin Routes (deployment administrators only) ---
+	adminRoutes := r.Group("/api/admin")
+	{
+		adminRoutes.Use(api.AuthMiddleware(authClient))
+		adminRoutes.Use(api.AdminOnly(cfg.Admin.UserIDs))
+		adminRoutes.GET("/config", api.GetEffectiveConfig(cfg))
+	}
+
 	// --- Authenticated API Routes ---
 	authRequired := r.Group("/api")
 	{
 		authRequired.Use(api.AuthMiddleware(authClient))
 		authRequired.Use(api.CSRFMiddleware())
-		authRequired.Use(api.RateLimiterMiddleware(api.APIRateLimit)) // Standard API rate limiting
+		authRequired.Use(api.RateLimiterMiddleware(apiRateLimit)) // Standard API rate limiting
 		authRequired.Use(api.SecurityMiddleware(securityValidator))
-		if auditLogger != nil {
-			authRequired.Use(api.AuditMiddleware(auditLogger))
-		}
+		authRequired.Use(api.AuditMiddleware(auditLogger))
 
 		// Auth routes that require authentication
-		authRequired.POST("/auth/logout", api.LogoutHandler)
+		authRequired.POST("/auth/logout", api.LogoutHandler(cfg.Session))
 
 		// Form routes with caching
-		authRequired.POST("/forms", api.CreateForm(firestoreClient, rdb))
+		authRequired.POST("/forms", idempotency, api.CreateForm(firestoreClient, eventBus))
 		authRequired.GET("/forms", api.ListForms(firestoreClient, rdb)) // Caching list view
 		authRequired.GET("/forms/:id", api.GetForm(firestoreClient, rdb))   // Caching single view
-		authRequired.PUT("/forms/:id", api.UpdateForm(firestoreClient, rdb))  // Cache invalidation
-		authRequired.PATCH("/forms/:id", api.UpdateForm(firestoreClient, rdb)) // Cache invalidation
-		authRequired.DELETE("/forms/:id", api.DeleteForm(firestoreClient, rdb))// Cache invalidation
+		authRequired.PUT("/forms/:id", api.UpdateForm(firestoreClient, rdb, eventBus))   // If-Match, cache invalidation
+		authRequired.PATCH("/forms/:id", api.UpdateForm(firestoreClient, rdb, eventBus)) // If-Match, cache invalidation
+		authRequired.DELETE("/forms/:id", api.DeleteForm(trashService))// Cache invalidation
+		authRequired.POST("/forms/:id/publish", api.PublishForm(firestoreClient, eventBus))
+
+		// Form editing leases, so the builder can show who else has a form open
+		authRequired.GET("/forms/:id/lease", api.GetFormLease(firestoreClient, lockManager))
+		authRequired.POST("/forms/:id/lease", api.AcquireFormLease(firestoreClient, lockManager))
+		authRequired.POST("/forms/:id/lease/heartbeat", api.RenewFormLease(firestoreClient, lockManager))
+		authRequired.DELETE("/forms/:id/lease", api.ReleaseFormLease(firestoreClient, lockManager))
 		
 		// PDF to Form processing route
-		authRequired.POST("/forms/process-pdf-with-vertex", api.ProcessPDFWithVertex(firestoreClient, vertexService))
+		authRequired.POST("/forms/process-pdf-with-vertex", api.ProcessPDFWithVertex(firestoreClient, vertexService, uploadSanitizer))
 
 		// Share link routes
-		authRequired.POST("/forms/:id/share-links", api.CreateShareLink(firestoreClient))
+		authRequired.POST("/forms/:id/share-links", idempotency, api.CreateShareLink(firestoreClient))
 		authRequired.GET("/forms/:id/share-links", api.ListShareLinks(firestoreClient))
 		authRequired.DELETE("/forms/:id/share-links/:linkId", api.DeleteShareLink(firestoreClient))
+		authRequired.GET("/forms/:id/share-links/:linkId/reminders", api.ListShareLinkReminders(firestoreClient))
 
 		// Form response routes
-		authRequired.POST("/responses", api.CreateFormResponse(firestoreClient))
-		authRequired.GET("/responses/:id", api.GetFormResponse(firestoreClient))
-		authRequired.GET("/responses", api.ListFormResponses(firestoreClient))
-		authRequired.DELETE("/responses/:id", api.DeleteFormResponse(firestoreClient))
-		authRequired.GET("/responses/:id/clinical-summary", api.GetClinicalSummary(firestoreClient, vertexService))
+		authRequired.POST("/responses", idempotency, api.CreateFormResponse(firestoreClient, eventBus, attachmentService, fieldEncryptor, duplicateService))
+		authRequired.GET("/responses/:id", api.GetFormResponse(firestoreClient, fieldEncryptor, phiAccessLog))
+		authRequired.GET("/responses", api.ListFormResponses(firestoreClient, fieldEncryptor, phiAccessLog))
+		authRequired.DELETE("/responses/:id", api.DeleteFormResponse(firestoreClient, trashService, retentionService))
+		authRequired.POST("/responses/:id/review", api.ReviewFormResponse(firestoreClient, eventBus))
+		authRequired.POST("/responses/:id/amendments", api.AmendFormResponse(firestoreClient, amendmentService, attachmentService, phiAccessLog))
+		authRequired.GET("/responses/:id/revisions", api.ListResponseRevisions(firestoreClient, fieldEncryptor, phiAccessLog))
+		authRequired.GET("/responses/:id/clinical-summary", api.GetClinicalSummary(firestoreClient, vertexService, fieldEncryptor, phiAccessLog))
+		authRequired.GET("/responses/:id/access-log", api.GetResponseAccessLog(phiAccessLog))
+
+		// Duplicate review queue
+		authRequired.GET("/duplicates", api.ListDuplicates(duplicateService))
+		authRequired.POST("/duplicates/:id/merge", api.MergeDuplicate(duplicateService, phiAccessLog))
+		authRequired.POST("/duplicates/:id/dismiss", api.DismissDuplicate(duplicateService))
+
+		// Attachment downloads
+		authRequired.GET("/attachments/:id", api.DownloadAttachment(attachmentService))
+
+		// Trash: soft-deleted forms and responses
+		authRequired.GET("/trash", api.ListTrash(trashService))
+		authRequired.POST("/trash/:type/:id/restore", api.RestoreFromTrash(trashService))
+
+		// Audit log (deployment administrators only)
+		authRequired.GET("/audit", api.AdminOnly(cfg.Admin.UserIDs), api.QueryAuditLog(auditLogger))
+
+		// Retention and legal holds
+		authRequired.GET("/retention/report", api.GetRetentionReport(retentionService))
+		authRequired.GET("/retention/deletion-log", api.GetDeletionLog(retentionService))
+		authRequired.POST("/legal-holds", api.CreateLegalHold(firestoreClient))
+		authRequired.GET("/legal-holds", api.ListLegalHolds(firestoreClient))
+		authRequired.DELETE("/legal-holds/:id", api.ReleaseLegalHold(firestoreClient))
+
+		// Patient right-of-access exports and accounting of disclosures
+		authRequired.POST("/patients/export", api.CreatePatientExport(patientExportService))
+		authRequired.GET("/patients/export/:id", api.GetPatientExport(patientExportService))
+		authRequired.GET("/disclosures", api.ListDisclosures(patientExportService))
+		authRequired.POST("/patients/access-report", api.GetPatientAccessReport(phiAccessLog))
+
+		// Organization backup and restore
+		authRequired.POST("/org-archives/backup", api.CreateOrgBackup(orgArchiveService))
+		authRequired.POST("/org-archives/restore", api.CreateOrgRestore(orgArchiveService))
+		authRequired.GET("/org-archives/:id", api.GetOrgArchiveJob(orgArchiveService))
+		authRequired.GET("/org-archives/:id/download", api.DownloadOrgBackup(orgArchiveService))
+
+		// Webhook subscription routes
+		authRequired.POST("/webhooks", api.CreateWebhookSubscription(firestoreClient, fieldEncryptor, webhookService))
+		authRequired.GET("/webhooks", api.ListWebhookSubscriptions(firestoreClient))
+		authRequired.DELETE("/webhooks/:id", api.DeleteWebhookSubscription(firestoreClient))
+		authRequired.GET("/webhooks/dead-letters", api.ListWebhookDeadLetters(firestoreClient))
+		authRequired.POST("/webhooks/dead-letters/:id/replay", api.ReplayWebhookDeadLetter(webhookService))
 
 		// Organization routes
 		authRequired.POST("/organizations", api.CreateOrganization(firestoreClient))
@@ -401,11 +452,14 @@ func main() {
 		authRequired.GET("/organizations/current", api.GetOrCreateUserOrganization(firestoreClient))
 		authRequired.PUT("/organizations/:id/clinic-info", api.UpdateOrganizationClinicInfo(firestoreClient))
 		authRequired.GET("/organizations/:id/clinic-info", api.GetOrganizationClinicInfo(firestoreClient))
+		authRequired.PUT("/organizations/:id/reminder-schedule", api.UpdateOrganizationReminderSchedule(firestoreClient))
+		authRequired.GET("/organizations/:id/reminder-schedule", api.GetOrganizationReminderSchedule(firestoreClient))
+		authRequired.PUT("/organizations/:id/retention", api.UpdateOrganizationRetention(firestoreClient))
 
 		// PDF Generation Routes (with stricter rate limiting and distributed locks)
 		pdfRoutes := authRequired.Group("/responses")
-		pdfRoutes.Use(api.RateLimiterMiddleware(api.PDFRateLimit)) // Stricter PDF rate limiting
-		api.RegisterPDFRoutes(pdfRoutes, firestoreClient, gotenbergService)
+		pdfRoutes.Use(api.RateLimiterMiddleware(pdfRateLimit)) // Stricter PDF rate limiting
+		api.RegisterPDFRoutes(pdfRoutes, idempotency, firestoreClient, gotenbergService, eventBus, attachmentService, fieldEncryptor, phiAccessLog)
 
 		// Insurance Card Processing Routes
 		authRequired.POST("/insurance-card/extract", insuranceCardHandler.ProcessInsuranceCard)
@@ -428,102 +482,15 @@ func main() {
 
 	// === SERVER START ===
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := cfg.Server.Port
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
-
 	log.Printf("Starting server on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := app.Serve(srv, cfg.Server.ShutdownTimeout); err != nil {
+		log.Fatalf("Server shutdown incomplete: %v", err)
 	}
-}
-
-// parseRedisMemoryInfo parses Redis memory information from INFO output
-func parseRedisMemoryInfo(info string) gin.H {
-	memoryInfo := make(gin.H)
-	lines := strings.Split(info, "\n")
-	
-	for _, line := range lines {
-		if strings.Contains(line, "used_memory:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if bytes, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					memoryInfo["used_bytes"] = bytes
-					memoryInfo["used_mb"] = fmt.Sprintf("%.2f", float64(bytes)/1024/1024)
-				}
-			}
-		}
-		if strings.Contains(line, "used_memory_human:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				memoryInfo["used_human"] = strings.TrimSpace(parts[1])
-			}
-		}
-		if strings.Contains(line, "used_memory_peak_human:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				memoryInfo["peak_human"] = strings.TrimSpace(parts[1])
-			}
-		}
-		if strings.Contains(line, "mem_fragmentation_ratio:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				memoryInfo["fragmentation_ratio"] = strings.TrimSpace(parts[1])
-			}
-		}
-	}
-	
-	return memoryInfo
-}
-
-// parseRedisStatsInfo parses Redis statistics from INFO output
-func parseRedisStatsInfo(info string) gin.H {
-	statsInfo := make(gin.H)
-	lines := strings.Split(info, "\n")
-	
-	for _, line := range lines {
-		if strings.Contains(line, "total_connections_received:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					statsInfo["total_connections_received"] = count
-				}
-			}
-		}
-		if strings.Contains(line, "total_commands_processed:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					statsInfo["total_commands_processed"] = count
-				}
-			}
-		}
-		if strings.Contains(line, "keyspace_hits:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					statsInfo["keyspace_hits"] = count
-				}
-			}
-		}
-		if strings.Contains(line, "keyspace_misses:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					statsInfo["keyspace_misses"] = count
-				}
-			}
-		}
-		if strings.Contains(line, "connected_clients:") {
-			parts := strings.Split(line, ":")
-			if len(parts) == 2 {
-				if count, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64); err == nil {
-					statsInfo["connected_clients"] = count
-				}
-			}
-		}
-	}
-	
-	return statsInfo
+	log.Printf("Server stopped")
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"backend-go/internal/config"
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+)
+
+// verify-audit checks the hash chains of audit records appended in a time range. It reads
+// the Firestore audit log of the configured project, or a local audit file with -file. The
+// exit status is 1 when any chain fails verification.
+func main() {
+	since := flag.Duration("since", 24*time.Hour, "verify records appended within this long before -to")
+	fromFlag := flag.String("from", "", "start of the range (RFC 3339); overrides -since")
+	toFlag := flag.String("to", "", "end of the range (RFC 3339, default now)")
+	file := flag.String("file", "", "verify a local audit file instead of Firestore")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	to := time.Now().UTC()
+	if *toFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *toFlag)
+		if err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+		to = parsed
+	}
+	from := to.Add(-*since)
+	if *fromFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *fromFlag)
+		if err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+		from = parsed
+	}
+
+	var sink services.AuditQuerier
+	if *file != "" {
+		fileSink, err := services.NewFileAuditSink(*file)
+		if err != nil {
+			log.Fatalf("Failed to open audit file: %v", err)
+		}
+		defer fileSink.Close()
+		sink = fileSink
+	} else {
+		cfg, err := config.Load()
+		if err != nil {
+			log.Fatalf("Invalid configuration:\n%v", err)
+		}
+		var client *firestore.Client
+		if cfg.Offline() {
+			client, err = dev.DialFirestore(ctx, cfg.Dev.FirestoreAddr, cfg.GCP.ProjectID)
+		} else {
+			client, err = data.NewFirestoreClient(ctx, cfg.GCP.ProjectID)
+		}
+		if err != nil {
+			log.Fatalf("Failed to create Firestore client: %v", err)
+		}
+		defer client.Close()
+		sink = services.NewFirestoreAuditSink(client)
+	}
+
+	records, err := sink.Range(ctx, from, to)
+	if err != nil {
+		log.Fatalf("Failed to read audit records: %v", err)
+	}
+	var heads map[string]services.AuditRecord
+	if source, ok := sink.(services.AuditChainHeads); ok {
+		if heads, err = source.ChainHeads(ctx); err != nil {
+			log.Fatalf("Failed to read audit chain heads: %v", err)
+		}
+	}
+
+	result := services.VerifyAuditRecords(records, heads, from, to)
+	out, _ := json.MarshalIndent(result, "", "  ")
+	os.Stdout.Write(append(out, '\n'))
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
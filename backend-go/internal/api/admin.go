@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	"backend-go/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly restricts a route to the deployment administrators listed in config
+// admin.user_ids. With no administrators configured every request is refused.
+func AdminOnly(adminUserIDs []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		admins[id] = true
+	}
+	return func(c *gin.Context) {
+		if !admins[c.GetString("userID")] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Administrator access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetEffectiveConfig returns the configuration the server is running with. Secrets are
+// shown only as a placeholder.
+func GetEffectiveConfig(cfg *config.Config) gin.HandlerFunc {
+	view := cfg.Redacted()
+	warnings := cfg.Warnings()
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"config":   view,
+			"warnings": warnings,
+		})
+	}
+}
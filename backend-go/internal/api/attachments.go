@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadAttachment streams a stored attachment to an authenticated member of its organization
+func DownloadAttachment(attachments *services.AttachmentService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attachmentID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+
+		record, content, err := attachments.Open(c.Request.Context(), orgID.(string), attachmentID)
+		if err != nil {
+			if errors.Is(err, services.ErrAttachmentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+				return
+			}
+			log.Printf("ATTACHMENTS: failed to load attachment %s: %v", attachmentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load attachment"})
+			return
+		}
+
+		// Attachments are PHI: never let browsers or proxies cache them
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, record.ID))
+		c.Header("ETag", `"`+record.SHA256+`"`)
+		c.Data(http.StatusOK, record.ContentType, content)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryAuditLog searches the caller's organization audit log. Filters: user, resource
+// ("<type>" or "<type>:<id>"), request (an X-Request-ID), from and to (RFC 3339), limit.
+func QueryAuditLog(trail *services.AuditTrail) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		query := services.AuditQuery{
+			OrganizationID: orgID.(string),
+			UserID:         c.Query("user"),
+			RequestID:      c.Query("request"),
+		}
+		if resource := c.Query("resource"); resource != "" {
+			query.ResourceType, query.ResourceID, _ = strings.Cut(resource, ":")
+		}
+
+		var err error
+		if query.From, err = parseAuditTime(c.Query("from")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return
+		}
+		if query.To, err = parseAuditTime(c.Query("to")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return
+		}
+		query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || query.Limit <= 0 || query.Limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		records, err := trail.Query(c.Request.Context(), query)
+		if err != nil {
+			if errors.Is(err, services.ErrAuditNotQueryable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("AUDIT: query failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(records), "results": records})
+	}
+}
+
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
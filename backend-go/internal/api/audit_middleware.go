@@ -7,7 +7,7 @@ import (
 	"strings"
 )
 
-func AuditMiddleware(auditLogger *services.CloudAuditLogger) gin.HandlerFunc {
+func AuditMiddleware(auditLogger *services.AuditTrail) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip health checks
 		if c.Request.URL.Path == "/health" {
@@ -20,6 +20,7 @@ func AuditMiddleware(auditLogger *services.CloudAuditLogger) gin.HandlerFunc {
 		// Capture request details
 		userID, _ := c.Get("userID")
 		userEmail, _ := c.Get("email")
+		orgID, _ := c.Get("organizationID")
 		
 		// Process request
 		c.Next()
@@ -29,15 +30,17 @@ func AuditMiddleware(auditLogger *services.CloudAuditLogger) gin.HandlerFunc {
 		
 		// Create audit entry
 		entry := services.AuditEntry{
-			Timestamp:    startTime,
-			UserID:       toString(userID),
-			UserEmail:    toString(userEmail),
-			Action:       c.Request.Method + " " + c.Request.URL.Path,
-			ResourceType: resourceType,
-			ResourceID:   resourceID,
-			IPAddress:    c.ClientIP(),
-			UserAgent:    c.Request.UserAgent(),
-			Success:      c.Writer.Status() < 400,
+			Timestamp:      startTime,
+			OrganizationID: toString(orgID),
+			UserID:         toString(userID),
+			UserEmail:      toString(userEmail),
+			Action:         c.Request.Method + " " + c.Request.URL.Path,
+			ResourceType:   resourceType,
+			ResourceID:     resourceID,
+			IPAddress:      c.ClientIP(),
+			UserAgent:      c.Request.UserAgent(),
+			RequestID:      requestID(c),
+			Success:        c.Writer.Status() < 400,
 			Metadata: map[string]interface{}{
 				"status_code": c.Writer.Status(),
 				"duration_ms": time.Since(startTime).Milliseconds(),
@@ -45,8 +48,8 @@ func AuditMiddleware(auditLogger *services.CloudAuditLogger) gin.HandlerFunc {
 			},
 		}
 		
-		// Log asynchronously to not block response
-		go auditLogger.LogAccess(c.Request.Context(), entry)
+		// LogAccess only queues the entry, so the response is never held up by a sink
+		auditLogger.LogAccess(c.Request.Context(), entry)
 	}
 }
 
@@ -64,6 +67,11 @@ func parseResourceInfo(path string) (string, string) {
 				return "response", parts[2]
 			}
 			return "responses", "list"
+		case "attachments":
+			if len(parts) > 2 {
+				return "attachment", parts[2]
+			}
+			return "attachments", "list"
 		case "organizations":
 			if len(parts) > 2 {
 				return "organization", parts[2]
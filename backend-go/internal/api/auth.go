@@ -2,28 +2,29 @@ package api
 
 import (
 	"context"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
+	"backend-go/internal/config"
 	"backend-go/internal/data"
 	"backend-go/internal/services"
-	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 )
 
+// TokenVerifier is the part of the Firebase Auth client used to sign users in.
+// *auth.Client implements it; the dev profile accepts locally signed tokens instead.
+type TokenVerifier interface {
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+	SessionCookie(ctx context.Context, idToken string, expiresIn time.Duration) (string, error)
+	GetUser(ctx context.Context, uid string) (*auth.UserRecord, error)
+}
+
 // SessionLogin handles the session login process.
-func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
+func SessionLogin(authClient TokenVerifier, sessions config.SessionConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := context.Background()
-		authClient, err := firebaseApp.Auth(ctx)
-		if err != nil {
-			log.Printf("Error getting Auth client: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			return
-		}
 
 		var req struct {
 			IDToken string `json:"idToken"`
@@ -38,39 +39,35 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 			return
 		}
 
-		// Set session expiration to 5 days.
-		expiresIn := time.Hour * 24 * 5
+		expiresIn := sessions.TTL
 		sessionCookie, err := authClient.SessionCookie(ctx, req.IDToken, expiresIn)
 		if err != nil {
-			log.Printf("Error creating session cookie: %v", err)
+			requestLog(c).Warn("failed to create session cookie", "error", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to create session cookie"})
 			return
 		}
 
-		// Get cookie domain from environment variable, default to empty for current domain
-		cookieDomain := os.Getenv("COOKIE_DOMAIN")
+		// Empty cookie domain means the current domain
+		cookieDomain := sessions.CookieDomain
 		
 		origin := c.Request.Header.Get("Origin")
 		
 		// For Firebase hosting proxy and custom domain, we're actually same-origin
 		isFirebaseOrigin := strings.Contains(origin, "firebaseapp.com") || strings.Contains(origin, ".web.app")
-		isCustomDomain := strings.Contains(origin, "form.easydocforms.com")
+		isCustomDomain := isProxiedOrigin(origin, sessions.ProxiedOrigins)
 		isLocalhost := strings.HasPrefix(origin, "http://localhost")
 
 		// Set the session cookie in the response
 		// When behind Firebase Hosting proxy or custom domain, treat as same-origin
 		if isFirebaseOrigin || isCustomDomain {
 			c.SetSameSite(http.SameSiteLaxMode)
-			log.Printf("Setting session cookie with SameSite=Lax for same-origin (no Secure flag): %s", origin)
 			// Don't use Secure flag for Firebase proxy or custom domain - it's effectively same-origin
 			c.SetCookie("session", sessionCookie, int(expiresIn.Seconds()), "/", cookieDomain, false, true)
 		} else if isLocalhost {
 			c.SetSameSite(http.SameSiteLaxMode)
-			log.Printf("Setting session cookie with SameSite=Lax for localhost: %s", origin)
 			c.SetCookie("session", sessionCookie, int(expiresIn.Seconds()), "/", cookieDomain, false, true)
 		} else {
 			c.SetSameSite(http.SameSiteNoneMode)
-			log.Printf("Setting session cookie with SameSite=None for cross-origin: %s", origin)
 			// Use Secure flag for true cross-origin requests
 			isSecure := c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https"
 			c.SetCookie("session", sessionCookie, int(expiresIn.Seconds()), "/", cookieDomain, isSecure, true)
@@ -79,7 +76,7 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 		// Store session metadata in Redis for distributed access and generate CSRF token
 		token, err := authClient.VerifyIDToken(ctx, req.IDToken)
 		if err != nil {
-			log.Printf("Error verifying token for session storage: %v", err)
+			requestLog(c).Warn("failed to verify token for session storage", "error", err)
 			// Continue with login - Redis failure shouldn't block auth
 			c.JSON(http.StatusOK, gin.H{"status": "success", "sessionToken": sessionCookie})
 			return
@@ -88,7 +85,7 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 		redisClient := data.GetRedisClient()
 		userRecord, err := authClient.GetUser(ctx, token.UID)
 		if err != nil {
-			log.Printf("Error getting user record for session storage: %v", err)
+			requestLog(c).Warn("failed to get user record for session storage", "error", err)
 			// Continue with login - Redis failure shouldn't block auth
 			c.JSON(http.StatusOK, gin.H{"status": "success", "sessionToken": sessionCookie})
 			return
@@ -102,6 +99,8 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 			}
 		}
 		
+		setLogIdentity(c, orgID, token.UID)
+
 		// HIPAA audit data
 		clientIP := c.ClientIP()
 		userAgent := c.GetHeader("User-Agent")
@@ -116,17 +115,17 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 			SessionType:    "web",
 		}
 
-		if err := services.CreateSession(ctx, redisClient, sessionCookie, sessionData); err != nil {
-			log.Printf("Failed to store session in Redis: %v", err)
+		if err := services.CreateSession(ctx, redisClient, sessionCookie, sessionData, sessions.TTL); err != nil {
 			// Log but don't fail login - graceful degradation
+			requestLog(c).Error("failed to store session", "error", err)
 		} else {
-			log.Printf("Successfully stored session for user %s in Redis", token.UID)
+			requestLog(c).Info("session created")
 		}
 
 		// Generate CSRF token for this session
 		csrfToken := GenerateCSRFTokenInternal(c, token.UID)
 		if csrfToken == "" {
-			log.Printf("ERROR: Failed to generate CSRF token for user %s", token.UID)
+			requestLog(c).Error("failed to generate CSRF token")
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate security token"})
 			return
 		}
@@ -142,20 +141,25 @@ func SessionLogin(firebaseApp *firebase.App) gin.HandlerFunc {
 }
 
 // LogoutHandler handles user logout with session and CSRF cleanup
-func LogoutHandler(c *gin.Context) {
+func LogoutHandler(sessions config.SessionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logout(c, sessions)
+	}
+}
+
+func logout(c *gin.Context, sessions config.SessionConfig) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
 		return
 	}
 
-	// Get cookie domain from environment variable
-	cookieDomain := os.Getenv("COOKIE_DOMAIN")
+	cookieDomain := sessions.CookieDomain
 	
 	// Clear session cookie
 	origin := c.Request.Header.Get("Origin")
 	isFirebaseOrigin := strings.Contains(origin, "firebaseapp.com") || strings.Contains(origin, ".web.app")
-	isCustomDomain := strings.Contains(origin, "form.easydocforms.com")
+	isCustomDomain := isProxiedOrigin(origin, sessions.ProxiedOrigins)
 	isLocalhost := strings.HasPrefix(origin, "http://localhost")
 	
 	// Clear cookie with appropriate settings
@@ -175,9 +179,20 @@ func LogoutHandler(c *gin.Context) {
 
 	// Invalidate all CSRF tokens for user
 	if err := InvalidateUserCSRFTokens(c, userID.(string)); err != nil {
-		log.Printf("ERROR: Failed to invalidate CSRF tokens: %v", err)
+		requestLog(c).Error("failed to invalidate CSRF tokens", "error", err)
 	}
 
-	log.Printf("AUDIT: User %s logged out from IP %s", userID, c.ClientIP())
+	requestLog(c).Info("logged out")
 	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Logged out successfully"})
 }
+
+// isProxiedOrigin reports whether origin is one of the custom domains served through the
+// Firebase Hosting proxy
+func isProxiedOrigin(origin string, proxied []string) bool {
+	for _, domain := range proxied {
+		if domain != "" && strings.Contains(origin, domain) {
+			return true
+		}
+	}
+	return false
+}
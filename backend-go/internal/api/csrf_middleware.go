@@ -102,8 +102,8 @@ func CSRFMiddleware() gin.HandlerFunc {
 			// MIGRATION: Check if user is authenticated but missing CSRF token
 			// This handles existing sessions that were created before CSRF implementation
 			if userExists {
-				log.Printf("MIGRATION: Generating CSRF token for existing authenticated user %s from IP %s", 
-					userID, c.ClientIP())
+				log.Printf("MIGRATION: Generating CSRF token for existing authenticated user %s", 
+					userID)
 				
 				// Try to generate token (will use Redis if available, emergency store if not)
 				newToken := GenerateCSRFTokenInternal(c, userID.(string))
@@ -122,8 +122,8 @@ func CSRFMiddleware() gin.HandlerFunc {
 				}
 			}
 			
-			log.Printf("SECURITY: CSRF token missing for %s %s from IP %s", 
-				c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			log.Printf("SECURITY: CSRF token missing for %s %s", 
+				c.Request.Method, c.Request.URL.Path)
 			c.JSON(http.StatusForbidden, gin.H{"error": "CSRF token not provided in header"})
 			c.Abort()
 			return
@@ -145,8 +145,8 @@ func CSRFMiddleware() gin.HandlerFunc {
 			err := redisClient.Get(c.Request.Context(), key).Err()
 			
 			if err == redis.Nil {
-				log.Printf("SECURITY: CSRF validation failed for user %s from IP %s - token not found in Redis", 
-					userID, c.ClientIP())
+				log.Printf("SECURITY: CSRF validation failed for user %s - token not found in Redis", 
+					userID)
 				
 				// For PDF generation, fall back to emergency store
 				if isPDFEndpoint && emergencyStore.validateToken(headerToken) {
@@ -183,8 +183,8 @@ func CSRFMiddleware() gin.HandlerFunc {
 					userID, c.Request.Method, c.Request.URL.Path)
 				c.Next()
 			} else {
-				log.Printf("SECURITY: CSRF validation failed for user %s from IP %s - token not found in emergency store", 
-					userID, c.ClientIP())
+				log.Printf("SECURITY: CSRF validation failed for user %s - token not found in emergency store", 
+					userID)
 				
 				// For PDF generation, be more lenient and allow the request
 				if isPDFEndpoint {
@@ -254,12 +254,12 @@ func GenerateCSRFTokenInternal(c *gin.Context, userID string) string {
 			return token
 		}
 
-		log.Printf("AUDIT: Generated CSRF token in Redis for user %s from IP %s", userID, c.ClientIP())
+		log.Printf("AUDIT: Generated CSRF token in Redis for user %s", userID)
 		return token
 	} else {
 		// Redis unavailable - use emergency store
-		log.Printf("WARNING: Redis unavailable for CSRF token generation, using emergency store - user %s from IP %s", 
-			userID, c.ClientIP())
+		log.Printf("WARNING: Redis unavailable for CSRF token generation, using emergency store - user %s", 
+			userID)
 		emergencyStore.storeToken(token)
 		log.Printf("EMERGENCY: Generated CSRF token in emergency store for user %s", userID)
 		return token
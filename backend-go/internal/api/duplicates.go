@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDuplicates returns the duplicate review queue: responses flagged as likely
+// resubmissions that have not been merged or dismissed, most recent first
+func ListDuplicates(duplicates *services.DuplicateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		candidates, err := duplicates.Pending(c.Request.Context(), orgID.(string), limit)
+		if err != nil {
+			requestLog(c).Error("failed to list duplicate review queue", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list duplicates"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(candidates), "results": candidates})
+	}
+}
+
+// MergeDuplicate merges a flagged response with the response it duplicates. "fields" picks
+// the side each answer comes from ("original" or "duplicate") and "prefer" decides the rest,
+// defaulting to the duplicate. Both originals are kept and link to the merged response.
+func MergeDuplicate(duplicates *services.DuplicateService, accessLog *services.PHIAccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			Prefer string            `json:"prefer"`
+			Fields map[string]string `json:"fields"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		merged, err := duplicates.Merge(c.Request.Context(), orgID.(string), userID.(string), c.Param("id"), request.Prefer, request.Fields)
+		if !respondDuplicateError(c, err, "failed to merge responses") {
+			return
+		}
+
+		if err := accessLog.Record(c.Request.Context(), merged, phiAccess(c, services.PHIActionMerge, purpose)); err != nil {
+			requestLog(c).Error("failed to record PHI access", "response_id", merged.ID, "error", err)
+		}
+		c.JSON(http.StatusCreated, merged)
+	}
+}
+
+// DismissDuplicate clears a duplicate flag, keeping both responses as they are
+func DismissDuplicate(duplicates *services.DuplicateService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+
+		err := duplicates.Dismiss(c.Request.Context(), orgID.(string), userID.(string), c.Param("id"))
+		if !respondDuplicateError(c, err, "failed to dismiss duplicate") {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "duplicate dismissed"})
+	}
+}
+
+// respondDuplicateError responds to a failed merge or dismissal and reports whether err was nil
+func respondDuplicateError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, services.ErrResponseNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+	case errors.Is(err, services.ErrNotPendingDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidMerge):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		requestLog(c).Error(message, "response_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return false
+}
@@ -3,7 +3,6 @@ package api
 import (
 	"github.com/gin-gonic/gin"
 	"os"
-	"log"
 )
 
 func ErrorHandlerMiddleware() gin.HandlerFunc {
@@ -17,7 +16,7 @@ func ErrorHandlerMiddleware() gin.HandlerFunc {
 			err := c.Errors.Last()
 			
 			// Always log full error internally
-			log.Printf("ERROR [%s %s]: %v", c.Request.Method, c.Request.URL.Path, err)
+			requestLog(c).Error("request failed", "method", c.Request.Method, "route", c.FullPath(), "error", err.Err)
 			
 			// Determine status code if not set
 			status := c.Writer.Status()
@@ -44,12 +43,14 @@ func ErrorHandlerMiddleware() gin.HandlerFunc {
 				c.JSON(status, gin.H{
 					"error": message,
 					"code": "ERROR",
+					"request_id": requestID(c),
 				})
 			} else {
 				// In development, return actual error
 				c.JSON(status, gin.H{
 					"error": err.Error(),
 					"code": "ERROR",
+					"request_id": requestID(c),
 					"debug": true,
 				})
 			}
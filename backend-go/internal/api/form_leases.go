@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Editing leases let the form builder show who else has a form open. They are advisory:
+// writes are guarded by If-Match, not by the lease. The holder's token travels in the
+// X-Lease-Token header on heartbeat and release.
+
+// leaseForm checks the form exists and belongs to the caller's organization, and that
+// leases can be kept. It responds and returns false otherwise.
+func leaseForm(c *gin.Context, client *firestore.Client, locks *services.LockManager) bool {
+	if !locks.Available() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "editing leases are unavailable"})
+		return false
+	}
+	orgID, _ := c.Get("organizationID")
+
+	doc, err := client.Collection("forms").Doc(c.Param("id")).Get(c.Request.Context())
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve form"})
+		return false
+	}
+	var form data.Form
+	if err := doc.DataTo(&form); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
+		return false
+	}
+	if form.DeletedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+		return false
+	}
+	if form.OrganizationID != orgID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+		return false
+	}
+	return true
+}
+
+// leaseToken returns the caller's lease token. Tokens start with the holder's user ID, so
+// one user cannot renew or release another's lease.
+func leaseToken(c *gin.Context) (string, bool) {
+	userID, _ := c.Get("userID")
+	token := c.GetHeader("X-Lease-Token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "X-Lease-Token header is required"})
+		return "", false
+	}
+	return token, strings.HasPrefix(token, userID.(string)+":")
+}
+
+// GetFormLease reports who holds the editing lease on a form; lease is null when nobody does
+func GetFormLease(client *firestore.Client, locks *services.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !leaseForm(c, client, locks) {
+			return
+		}
+		holder, err := locks.FormLockHolder(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			requestLog(c).Error("failed to read editing lease", "form_id", c.Param("id"), "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read editing lease"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"lease": holder})
+	}
+}
+
+// AcquireFormLease takes the editing lease on a form. It returns 409 with the current holder
+// when another user has the form open.
+func AcquireFormLease(client *firestore.Client, locks *services.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !leaseForm(c, client, locks) {
+			return
+		}
+		userID, _ := c.Get("userID")
+
+		lease, err := locks.AcquireFormLock(c.Request.Context(), c.Param("id"), userID.(string))
+		if errors.Is(err, services.ErrFormLeaseHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "form is being edited by another user", "lease": lease})
+			return
+		}
+		if err != nil {
+			requestLog(c).Error("failed to acquire editing lease", "form_id", c.Param("id"), "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to acquire editing lease"})
+			return
+		}
+		c.JSON(http.StatusCreated, lease)
+	}
+}
+
+// RenewFormLease extends the caller's editing lease. It returns 409 when the lease expired
+// or was taken over, in which case the builder should acquire it again.
+func RenewFormLease(client *firestore.Client, locks *services.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !leaseForm(c, client, locks) {
+			return
+		}
+		token, own := leaseToken(c)
+		if token == "" {
+			return
+		}
+		if !own {
+			c.JSON(http.StatusConflict, gin.H{"error": services.ErrFormLeaseLost.Error()})
+			return
+		}
+
+		lease, err := locks.RenewFormLock(c.Request.Context(), c.Param("id"), token)
+		if errors.Is(err, services.ErrFormLeaseLost) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			requestLog(c).Error("failed to renew editing lease", "form_id", c.Param("id"), "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to renew editing lease"})
+			return
+		}
+		c.JSON(http.StatusOK, lease)
+	}
+}
+
+// ReleaseFormLease gives up the caller's editing lease
+func ReleaseFormLease(client *firestore.Client, locks *services.LockManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !leaseForm(c, client, locks) {
+			return
+		}
+		token, own := leaseToken(c)
+		if token == "" {
+			return
+		}
+		if own {
+			if err := locks.ReleaseFormLock(c.Request.Context(), c.Param("id"), token); err != nil {
+				requestLog(c).Error("failed to release editing lease", "form_id", c.Param("id"), "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to release editing lease"})
+				return
+			}
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
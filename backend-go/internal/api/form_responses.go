@@ -1,15 +1,15 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"backend-go/internal/data"
+	"backend-go/internal/logging"
 	"backend-go/internal/services"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/iterator"
@@ -26,35 +26,9 @@ func getMapKeys(m map[string]interface{}) []string {
 	return keys
 }
 
-// extractPatientName extracts the patient's full name from response data
-func extractPatientName(responseData map[string]interface{}) string {
-	firstName := ""
-	lastName := ""
-	
-	// Try to get first_name and last_name from response data
-	if val, ok := responseData["first_name"].(string); ok {
-		firstName = val
-	}
-	
-	if val, ok := responseData["last_name"].(string); ok {
-		lastName = val
-	}
-	
-	// Combine names
-	fullName := ""
-	if firstName != "" && lastName != "" {
-		fullName = firstName + " " + lastName
-	} else if firstName != "" {
-		fullName = firstName
-	} else if lastName != "" {
-		fullName = lastName
-	}
-	
-	return fullName
-}
-
-// CreateFormResponse creates a new form response.
-func CreateFormResponse(client *firestore.Client) gin.HandlerFunc {
+// CreateFormResponse creates a new form response. Likely resubmissions by the same patient
+// are flagged for the duplicate review queue.
+func CreateFormResponse(client *firestore.Client, events *services.EventBus, attachments *services.AttachmentService, encryptor *services.FieldEncryptor, duplicates *services.DuplicateService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var response data.FormResponse
 		if err := c.ShouldBindJSON(&response); err != nil {
@@ -75,28 +49,76 @@ func CreateFormResponse(client *firestore.Client) gin.HandlerFunc {
 		response.SubmittedAt = now
 		response.SubmittedBy = userID.(string)
 		response.OrganizationID = orgID.(string)
+		response.Duplicate = nil
+		response.MergedInto = ""
+		response.MergedFrom = nil
 		
 		// Extract patient name from response data
-		response.PatientName = extractPatientName(response.Data)
+		response.PatientName = services.ExtractPatientName(response.Data)
+
+		docRef := client.Collection("form_responses").NewDoc()
+		records, rejected, ok := extractAttachments(c, attachments, &response, docRef.ID)
+		if !ok {
+			return
+		}
+		detectDuplicate(c, duplicates, &response)
+		sealed, err := encryptor.SealResponse(c.Request.Context(), docRef.ID, response)
+		if err != nil {
+			attachments.Discard(c.Request.Context(), records)
+			requestLog(c).Error("failed to encrypt response", "response_id", docRef.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form response"})
+			return
+		}
 
-		// Add to Firestore
-		docRef, _, err := client.Collection("form_responses").Add(c.Request.Context(), response)
+		// Add to Firestore together with the attachment records and the ResponseSubmitted event
+		err = events.Transact(c.Request.Context(), func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			if err := attachments.SaveRecords(tx, records); err != nil {
+				return nil, err
+			}
+			if err := tx.Create(docRef, sealed); err != nil {
+				return nil, err
+			}
+			domainEvents := []data.DomainEvent{responseSubmittedEvent(docRef.ID, &response, response.SubmittedBy)}
+			if flagged := services.DuplicateFlaggedEvent(docRef.ID, &response); flagged != nil {
+				domainEvents = append(domainEvents, *flagged)
+			}
+			return domainEvents, nil
+		})
 		if err != nil {
+			attachments.Discard(c.Request.Context(), records)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form response"})
 			return
 		}
 
 		response.ID = docRef.ID
 
-		c.JSON(http.StatusCreated, response)
+		c.JSON(http.StatusCreated, struct {
+			data.FormResponse
+			Attachments         []data.Attachment              `json:"attachments,omitempty"`
+			RejectedAttachments []services.AttachmentRejection `json:"rejected_attachments,omitempty"`
+		}{response, records, rejected})
+	}
+}
+
+// detectDuplicate flags a response about to be submitted when it duplicates an earlier one.
+// Detection never blocks a submission; when it fails the response is stored unflagged.
+func detectDuplicate(c *gin.Context, duplicates *services.DuplicateService, response *data.FormResponse) {
+	if err := duplicates.Detect(c.Request.Context(), response); err != nil {
+		requestLog(c).Warn("duplicate detection failed", "form_id", response.FormID, "error", err)
+		response.IdentityKeys = nil
+		response.Duplicate = nil
 	}
 }
 
 // GetFormResponse retrieves a form response by its ID.
-func GetFormResponse(client *firestore.Client) gin.HandlerFunc {
+func GetFormResponse(client *firestore.Client, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		responseID := c.Param("id")
 		orgID, _ := c.Get("organizationID")
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
 
 		doc, err := client.Collection("form_responses").Doc(responseID).Get(c.Request.Context())
 		if err != nil {
@@ -108,33 +130,42 @@ func GetFormResponse(client *firestore.Client) gin.HandlerFunc {
 			return
 		}
 
-		var response data.FormResponse
-		if err := doc.DataTo(&response); err != nil {
+		response, err := encryptor.OpenResponse(c.Request.Context(), doc)
+		if err != nil {
+			requestLog(c).Error("failed to open response", "response_id", responseID, "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
 			return
 		}
+		if response.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
 
 		if response.OrganizationID != orgID.(string) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to access this response"})
 			return
 		}
-
-		response.ID = doc.Ref.ID
 		
 		// Extract patient name from data if not already set
 		if response.PatientName == "" && response.Data != nil {
-			response.PatientName = extractPatientName(response.Data)
+			response.PatientName = services.ExtractPatientName(response.Data)
+		}
+		response.Revisions = nil // Served by the revisions endpoint
+
+		if err := accessLog.Record(c.Request.Context(), response, phiAccess(c, services.PHIActionRead, purpose)); err != nil {
+			requestLog(c).Error("failed to record PHI access", "response_id", responseID, "error", err)
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
-// DeleteFormResponse deletes a form response by its ID.
-func DeleteFormResponse(client *firestore.Client) gin.HandlerFunc {
+// DeleteFormResponse moves a form response to the trash.
+func DeleteFormResponse(client *firestore.Client, trash *services.TrashService, retention *services.RetentionService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		responseID := c.Param("id")
 		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
 
 		// First, get the response to verify ownership
 		doc, err := client.Collection("form_responses").Doc(responseID).Get(c.Request.Context())
@@ -152,6 +183,10 @@ func DeleteFormResponse(client *firestore.Client) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
 			return
 		}
+		if response.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
 
 		// Check if the user has permission to delete this response
 		if response.OrganizationID != orgID.(string) {
@@ -159,24 +194,41 @@ func DeleteFormResponse(client *firestore.Client) gin.HandlerFunc {
 			return
 		}
 
-		// Delete the response
-		_, err = client.Collection("form_responses").Doc(responseID).Delete(c.Request.Context())
+		hold, err := retention.HoldFor(c.Request.Context(), response.OrganizationID, doc)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check legal holds"})
+			return
+		}
+		if hold != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": services.ErrLegalHold.Error(), "hold_id": hold.ID})
+			return
+		}
+
+		err = trash.DeleteResponse(c.Request.Context(), response.OrganizationID, userID.(string), responseID)
+		if errors.Is(err, services.ErrTrashItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete form response"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "form response deleted successfully"})
+		c.JSON(http.StatusOK, gin.H{"message": "form response moved to trash"})
 	}
 }
 
-// ListFormResponses lists all form responses for a given form.
-func ListFormResponses(client *firestore.Client) gin.HandlerFunc {
+// ListFormResponses lists all form responses for a given form. Responses merged into
+// another are left out unless include_merged=true.
+func ListFormResponses(client *firestore.Client, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		formID := c.Query("formId")
+		includeMerged := c.Query("include_merged") == "true"
 		orgID, _ := c.Get("organizationID")
-
-		log.Printf("ListFormResponses: Fetching responses for organizationID: %v", orgID)
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
 
 		var responses []data.FormResponse
 		q := client.Collection("form_responses").Where("organizationId", "==", orgID.(string))
@@ -195,22 +247,33 @@ func ListFormResponses(client *firestore.Client) gin.HandlerFunc {
 				return
 			}
 
-			var response data.FormResponse
-			if err := doc.DataTo(&response); err != nil {
+			if _, deleted := doc.Data()["deleted_at"]; deleted {
+				continue
+			}
+			if _, merged := doc.Data()["merged_into"]; merged && !includeMerged {
+				continue
+			}
+			response, err := encryptor.OpenResponse(c.Request.Context(), doc)
+			if err != nil {
+				requestLog(c).Error("failed to open response", "response_id", doc.Ref.ID, "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
 				return
 			}
-			response.ID = doc.Ref.ID
 			
 			// Extract patient name from data if not already set
 			if response.PatientName == "" && response.Data != nil {
-				response.PatientName = extractPatientName(response.Data)
+				response.PatientName = services.ExtractPatientName(response.Data)
 			}
+			response.Revisions = nil
 			
-			responses = append(responses, response)
+			responses = append(responses, *response)
 		}
 
-		log.Printf("ListFormResponses: Found %d responses for organizationID: %v", len(responses), orgID)
+		requestLog(c).Debug("listed form responses", "form_id", formID, "count", len(responses))
+
+		if err := accessLog.RecordList(c.Request.Context(), responses, phiAccess(c, services.PHIActionRead, purpose)); err != nil {
+			requestLog(c).Error("failed to record PHI access", "responses", len(responses), "error", err)
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"count":     len(responses),
@@ -219,8 +282,9 @@ func ListFormResponses(client *firestore.Client) gin.HandlerFunc {
 	}
 }
 
-// CreatePublicFormResponse creates a form response from a public share link
-func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
+// CreatePublicFormResponse creates a form response from a public share link. Likely
+// resubmissions by the same patient are flagged for the duplicate review queue.
+func CreatePublicFormResponse(client *firestore.Client, events *services.EventBus, attachments *services.AttachmentService, encryptor *services.FieldEncryptor, duplicates *services.DuplicateService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var requestBody struct {
 			FormID       string                 `json:"form_id" binding:"required"`
@@ -233,46 +297,9 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 			return
 		}
 
-		// --- DEBUG LOGGING ---
-		log.Printf("--- DEBUG: Received Form Submission ---")
-		log.Printf("Total fields in ResponseData: %d", len(requestBody.ResponseData))
-		
-		// Log all field names to see what we're receiving
-		log.Printf("Field names received:")
-		for key := range requestBody.ResponseData {
-			log.Printf("  - %s", key)
-		}
-		
-		// Check specifically for pain_areas
-		if painAreas, exists := requestBody.ResponseData["pain_areas"]; exists {
-			log.Printf("✅ pain_areas field FOUND in request")
-			if arr, ok := painAreas.([]interface{}); ok {
-				log.Printf("  pain_areas is array with %d items", len(arr))
-				// Log first item as sample
-				if len(arr) > 0 {
-					log.Printf("  Sample pain area: %+v", arr[0])
-				}
-			} else {
-				log.Printf("  pain_areas type: %T", painAreas)
-			}
-		} else {
-			log.Printf("❌ pain_areas field NOT FOUND in request")
-		}
-		
-		// Safely log signature data by checking for it and printing its length
-		for key, value := range requestBody.ResponseData {
-			if (strings.Contains(key, "signature")) {
-				if sigData, ok := value.(string); ok {
-					log.Printf("Signature field '%s' received with data length: %d", key, len(sigData))
-				} else {
-					log.Printf("Signature field '%s' received with non-string data type: %T", key, value)
-				}
-			} 
-		}
-		// --- END DEBUG LOGGING ---
-
-
-		log.Printf("Public form submission received for form %s with token %s", requestBody.FormID, requestBody.ShareToken)
+		logger := requestLog(c).With("form_id", requestBody.FormID)
+		logging.Dump(c.Request.Context(), "public form submission fields",
+			"form_id", requestBody.FormID, "fields", getMapKeys(requestBody.ResponseData))
 
 		// Validate share token
 		shareLinksRef := client.Collection("share_links")
@@ -288,7 +315,6 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 
 		shareLink := docs[0]
 		shareData := shareLink.Data()
-		log.Printf("Share link data: %v", shareData)
 
 		// Check if link has expired
 		if expiresAt, ok := shareData["expires_at"].(time.Time); ok {
@@ -298,35 +324,13 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 			}
 		}
 
-		// Check max responses if configured
-		if maxResponses, ok := shareData["max_responses"].(int64); ok && maxResponses > 0 {
-			currentResponses := int64(0)
-			if responseCount, ok := shareData["response_count"].(int64); ok {
-				currentResponses = responseCount
-			}
-			if currentResponses >= maxResponses {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Share link has reached maximum responses"})
-				return
-			}
-
-			// Increment response count
-			_, err = shareLink.Ref.Update(c.Request.Context(), []firestore.Update{
-				{Path: "response_count", Value: currentResponses + 1},
-			})
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share link"})
-				return
-			}
-		}
-
 		// Get organization ID with fallback logic
 		orgID := ""
 		if org, ok := shareData["organizationId"].(string); ok && org != "" {
 			// Use organization from share link if available
 			orgID = org
-			log.Printf("Organization ID found in share link: %s", orgID)
 		} else {
-			log.Printf("Organization ID not found in share link, falling back to form document.")
+			logger.Info("share link has no organization, falling back to form document", "share_link_id", shareLink.Ref.ID)
 			// Fallback: Get organization from the form document
 			formDoc, err := client.Collection("forms").Doc(requestBody.FormID).Get(c.Request.Context())
 			if err != nil {
@@ -336,9 +340,8 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 			formData := formDoc.Data()
 			if formOrgID, ok := formData["organizationId"].(string); ok {
 				orgID = formOrgID
-				log.Printf("Organization ID found in form document: %s", orgID)
 			} else {
-				log.Printf("Organization ID not found in form document.")
+				logger.Error("form document has no organization")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to determine organization"})
 				return
 			}
@@ -351,37 +354,74 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 			SubmittedAt:    time.Now().UTC(),
 			SubmittedBy:    "public",
 			OrganizationID: orgID,
-			PatientName:    extractPatientName(requestBody.ResponseData),
+			PatientName:    services.ExtractPatientName(requestBody.ResponseData),
 		}
 
-		// --- NEW DEBUG LOGGING ---
-		// Check if pain_areas exists in the data being saved
-		if painAreas, exists := response.Data["pain_areas"]; exists {
-			log.Printf("✅ pain_areas WILL BE SAVED to Firestore")
-			if arr, ok := painAreas.([]interface{}); ok {
-				log.Printf("  Saving %d pain areas", len(arr))
-			}
-		} else {
-			log.Printf("❌ pain_areas NOT in data being saved to Firestore")
-			log.Printf("  Fields being saved: %v", getMapKeys(response.Data))
+		// Count the submission, store the response, and record its events in one transaction.
+		// The share link is re-read inside it so concurrent submissions can't exceed max_responses.
+		docRef := client.Collection("form_responses").NewDoc()
+		records, rejected, ok := extractAttachments(c, attachments, &response, docRef.ID)
+		if !ok {
+			return
 		}
-		
-		jsonData, err := json.Marshal(response)
+		detectDuplicate(c, duplicates, &response)
+		sealed, err := encryptor.SealResponse(c.Request.Context(), docRef.ID, response)
 		if err != nil {
-			log.Printf("Error marshalling response for logging: %v", err)
-		} else {
-			log.Printf("--- DEBUG: Saving to Firestore ---")
-			// Truncate if too long
-			dataStr := string(jsonData)
-			if len(dataStr) > 1000 {
-				dataStr = dataStr[:1000] + "... (truncated)"
-			}
-			log.Printf("Data being saved: %s", dataStr)
+			attachments.Discard(c.Request.Context(), records)
+			requestLog(c).Error("failed to encrypt response", "response_id", docRef.ID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form response"})
+			return
 		}
-		// --- END NEW DEBUG LOGGING ---
 
-		// Add to Firestore
-		docRef, _, err := client.Collection("form_responses").Add(c.Request.Context(), response)
+		err = events.Transact(c.Request.Context(), func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			linkDoc, err := tx.Get(shareLink.Ref)
+			if err != nil {
+				return nil, err
+			}
+			linkData := linkDoc.Data()
+
+			currentResponses := int64(0)
+			if responseCount, ok := linkData["response_count"].(int64); ok {
+				currentResponses = responseCount
+			}
+			linkExhausted := false
+			if maxResponses, ok := linkData["max_responses"].(int64); ok && maxResponses > 0 {
+				if currentResponses >= maxResponses {
+					return nil, errShareLinkExhausted
+				}
+				linkExhausted = currentResponses+1 >= maxResponses
+			}
+
+			// Always count submissions - reminders stop once a link has a response
+			if err := tx.Update(shareLink.Ref, []firestore.Update{
+				{Path: "response_count", Value: firestore.Increment(1)},
+			}); err != nil {
+				return nil, err
+			}
+			if err := attachments.SaveRecords(tx, records); err != nil {
+				return nil, err
+			}
+			if err := tx.Create(docRef, sealed); err != nil {
+				return nil, err
+			}
+
+			domainEvents := []data.DomainEvent{responseSubmittedEvent(docRef.ID, &response, "")}
+			if flagged := services.DuplicateFlaggedEvent(docRef.ID, &response); flagged != nil {
+				domainEvents = append(domainEvents, *flagged)
+			}
+			if linkExhausted {
+				domainEvents = append(domainEvents, services.NewDomainEvent(services.DomainShareLinkExhausted, orgID, "share_link", shareLink.Ref.ID, "",
+					map[string]interface{}{"share_link_id": shareLink.Ref.ID, "form_id": requestBody.FormID}))
+			}
+			return domainEvents, nil
+		})
+		if err != nil {
+			attachments.Discard(c.Request.Context(), records)
+		}
+		if errors.Is(err, errShareLinkExhausted) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Share link has reached maximum responses"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form response"})
 			return
@@ -389,21 +429,286 @@ func CreatePublicFormResponse(client *firestore.Client) gin.HandlerFunc {
 
 		response.ID = docRef.ID
 
+		// Public submitters only see what happened to their files, not storage details
+		uploads := make([]gin.H, 0, len(records))
+		for _, record := range records {
+			uploads = append(uploads, gin.H{"field_name": record.FieldName, "sanitization": record.Sanitization})
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
-			"id":      response.ID,
-			"message": "Form submitted successfully",
+			"id":                   response.ID,
+			"message":              "Form submitted successfully",
+			"attachments":          uploads,
+			"rejected_attachments": rejected,
+		})
+	}
+}
+
+// ReviewFormResponse marks a form response as reviewed by the current user.
+func ReviewFormResponse(client *firestore.Client, events *services.EventBus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		responseID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+
+		var request struct {
+			Notes string `json:"notes"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ref := client.Collection("form_responses").Doc(responseID)
+		doc, err := ref.Get(c.Request.Context())
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve form response"})
+			return
+		}
+
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
+			return
+		}
+		if response.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
+		if response.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to review this response"})
+			return
+		}
+
+		now := time.Now().UTC()
+		err = events.Transact(c.Request.Context(), func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			err := tx.Update(ref, []firestore.Update{
+				{Path: "reviewed", Value: true},
+				{Path: "reviewed_by", Value: userID.(string)},
+				{Path: "reviewed_at", Value: now},
+				{Path: "review_notes", Value: request.Notes},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return []data.DomainEvent{
+				services.NewDomainEvent(services.DomainResponseReviewed, response.OrganizationID, "response", responseID, userID.(string),
+					map[string]interface{}{"response_id": responseID, "form_id": response.FormID}),
+			}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to review form response"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "form response reviewed", "reviewed_at": now})
+	}
+}
+
+// AmendFormResponse records a correction to a response's answers. The changed values are
+// applied to the response and the previous ones are kept in its revision history.
+func AmendFormResponse(client *firestore.Client, amendments *services.AmendmentService, attachments *services.AttachmentService, accessLog *services.PHIAccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		responseID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
+
+		var request struct {
+			Changes     map[string]interface{} `json:"changes" binding:"required"`
+			Reason      string                 `json:"reason" binding:"required"`
+			RequestedBy string                 `json:"requested_by"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		doc, err := client.Collection("form_responses").Doc(responseID).Get(c.Request.Context())
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve form response"})
+			return
+		}
+		var existing data.FormResponse
+		if err := doc.DataTo(&existing); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
+			return
+		}
+		if existing.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
+		if existing.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to amend this response"})
+			return
+		}
+
+		// New file answers go to attachment storage like on submission
+		owner := data.FormResponse{OrganizationID: existing.OrganizationID, FormID: existing.FormID, SubmittedBy: userID.(string), Data: request.Changes}
+		records, rejected, ok := extractAttachments(c, attachments, &owner, responseID)
+		if !ok {
+			return
+		}
+		// A correction is applied whole or not at all
+		if len(rejected) > 0 {
+			attachments.Discard(c.Request.Context(), records)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "attachments were rejected", "rejected_attachments": rejected})
+			return
+		}
+
+		response, err := amendments.Amend(c.Request.Context(), existing.OrganizationID, userID.(string), responseID, services.Amendment{
+			Changes:     request.Changes,
+			Reason:      request.Reason,
+			RequestedBy: request.RequestedBy,
+		}, records)
+		if err != nil {
+			attachments.Discard(c.Request.Context(), records)
+		}
+		switch {
+		case errors.Is(err, services.ErrResponseNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		case errors.Is(err, services.ErrInvalidAmendment):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			requestLog(c).Error("failed to amend response", "response_id", responseID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to amend form response"})
+			return
+		}
+
+		revision := response.Revisions[len(response.Revisions)-1]
+		access := phiAccess(c, services.PHIActionAmend, purpose)
+		access.Fields = services.ChangedFields([]data.ResponseRevision{revision})
+		if err := accessLog.Record(c.Request.Context(), response, access); err != nil {
+			requestLog(c).Error("failed to record PHI access", "response_id", responseID, "error", err)
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"message": "amendment recorded", "revision": revision})
+	}
+}
+
+// ListResponseRevisions returns a response's amendment history, oldest first. Each
+// revision lists the values it replaced, so the original answers remain available.
+func ListResponseRevisions(client *firestore.Client, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		responseID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
+
+		doc, err := client.Collection("form_responses").Doc(responseID).Get(c.Request.Context())
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve form response"})
+			return
+		}
+		response, err := encryptor.OpenResponse(c.Request.Context(), doc)
+		if err != nil {
+			requestLog(c).Error("failed to open response", "response_id", responseID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form response data"})
+			return
+		}
+		if response.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form response not found"})
+			return
+		}
+		if response.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to access this response"})
+			return
+		}
+
+		revisions := response.Revisions
+		if revisions == nil {
+			revisions = []data.ResponseRevision{}
+		}
+		if len(revisions) > 0 {
+			access := phiAccess(c, services.PHIActionRead, purpose)
+			access.Fields = services.ChangedFields(revisions)
+			if err := accessLog.Record(c.Request.Context(), response, access); err != nil {
+				requestLog(c).Error("failed to record PHI access", "response_id", responseID, "error", err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"response_id":      responseID,
+			"submitted_at":     response.SubmittedAt,
+			"submitted_by":     response.SubmittedBy,
+			"current_revision": response.Revision,
+			"count":            len(revisions),
+			"results":          revisions,
 		})
 	}
 }
 
+// errShareLinkExhausted aborts a public submission when the link has no responses left
+var errShareLinkExhausted = errors.New("share link has reached maximum responses")
+
+// extractAttachments moves data URIs out of the response into attachment storage. Files that
+// fail validation are left out of the answers and listed in the response metadata. It writes
+// the error response itself and returns false when the submission should stop.
+func extractAttachments(c *gin.Context, attachments *services.AttachmentService, response *data.FormResponse, responseID string) ([]data.Attachment, []services.AttachmentRejection, bool) {
+	owner := services.AttachmentOwner{
+		OrganizationID: response.OrganizationID,
+		FormID:         response.FormID,
+		ResponseID:     responseID,
+		UserID:         response.SubmittedBy,
+		IPAddress:      c.ClientIP(),
+	}
+	records, rejected, err := attachments.ExtractDataURIs(c.Request.Context(), owner, response.Data)
+	if err != nil {
+		requestLog(c).Error("failed to store attachments", "response_id", responseID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store attachments"})
+		return nil, nil, false
+	}
+	if len(rejected) > 0 {
+		fields := make([]string, 0, len(rejected))
+		for _, rejection := range rejected {
+			fields = append(fields, rejection.Field)
+		}
+		requestLog(c).Warn("attachments rejected", "response_id", responseID, "fields", fields)
+		if response.Metadata == nil {
+			response.Metadata = map[string]interface{}{}
+		}
+		response.Metadata["rejected_attachments"] = rejected
+	}
+	return records, rejected, true
+}
+
+// responseSubmittedEvent builds the outbox record for a newly stored response
+func responseSubmittedEvent(responseID string, response *data.FormResponse, actorID string) data.DomainEvent {
+	return services.NewDomainEvent(services.DomainResponseSubmitted, response.OrganizationID, "response", responseID, actorID,
+		map[string]interface{}{"response_id": responseID, "form_id": response.FormID})
+}
+
 // GetClinicalSummary generates an AI-powered clinical summary for a given form response.
-func GetClinicalSummary(client *firestore.Client, vs *services.VertexAIService) gin.HandlerFunc {
+func GetClinicalSummary(client *firestore.Client, vs *services.VertexAIService, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		responseId := c.Param("id")
 		if responseId == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Response ID is required"})
 			return
 		}
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
 
 		ctx := c.Request.Context()
 
@@ -413,8 +718,12 @@ func GetClinicalSummary(client *firestore.Client, vs *services.VertexAIService)
 			c.JSON(http.StatusNotFound, gin.H{"error": "Response not found"})
 			return
 		}
-		var responseData map[string]interface{}
-		if err := responseDoc.DataTo(&responseData); err != nil {
+		if _, deleted := responseDoc.Data()["deleted_at"]; deleted {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Response not found"})
+			return
+		}
+		responseData, err := encryptor.OpenResponseMap(ctx, responseDoc)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse response data"})
 			return
 		}
@@ -425,7 +734,7 @@ func GetClinicalSummary(client *firestore.Client, vs *services.VertexAIService)
 			return
 		}
 
-		answers, ok := responseData["data"].(map[string]interface{})
+		answers, ok := responseData["response_data"].(map[string]interface{})
 		if !ok {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Answer data not found in response document"})
 			return
@@ -463,6 +772,17 @@ func GetClinicalSummary(client *firestore.Client, vs *services.VertexAIService)
 			return
 		}
 
+		// The answers were disclosed to Vertex AI as well as shown to the caller
+		access := phiAccess(c, services.PHIActionClinicalSummary, purpose)
+		access.Recipient = "vertex-ai"
+		access.Fields = make([]string, 0, len(visibleQuestions))
+		for _, question := range visibleQuestions {
+			access.Fields = append(access.Fields, question.Name)
+		}
+		if err := accessLog.RecordByID(ctx, responseId, access); err != nil {
+			requestLog(c).Error("failed to record PHI access", "response_id", responseId, "error", err)
+		}
+
 		// 5. Return summary to client.
 		c.JSON(http.StatusOK, gin.H{"summary": summary})
 	}
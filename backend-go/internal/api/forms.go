@@ -5,8 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
 
@@ -23,25 +23,8 @@ import (
 
 const formCacheTTL = 10 * time.Minute
 
-// clearFormCache is a helper to invalidate form caches.
-func clearFormCache(ctx context.Context, rdb *redis.Client, orgID, formID string) {
-	if rdb == nil {
-		return
-	}
-	// Invalidate single form cache
-	if formID != "" {
-		formKey := fmt.Sprintf("form:%s", formID)
-		rdb.Del(ctx, formKey)
-	}
-	// Invalidate list of forms for the organization
-	if orgID != "" {
-		listKey := fmt.Sprintf("forms:list:%s", orgID)
-		rdb.Del(ctx, listKey)
-	}
-}
-
-// CreateForm creates a new form and invalidates the organization's form list cache.
-func CreateForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
+// CreateForm creates a new form. The FormCreated event invalidates the organization's form list cache.
+func CreateForm(client *firestore.Client, events *services.EventBus) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var form data.Form
 		if err := c.ShouldBindJSON(&form); err != nil {
@@ -58,22 +41,30 @@ func CreateForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 		form.CreatedBy = userID.(string)
 		form.UpdatedBy = userID.(string)
 		form.OrganizationID = orgID.(string)
+		form.Version = 1
 
-		docRef, _, err := client.Collection("forms").Add(c.Request.Context(), form)
+		docRef := client.Collection("forms").NewDoc()
+		err := events.Transact(c.Request.Context(), func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			if err := tx.Create(docRef, form); err != nil {
+				return nil, err
+			}
+			return []data.DomainEvent{
+				services.NewDomainEvent(services.DomainFormCreated, form.OrganizationID, "form", docRef.ID, form.CreatedBy, nil),
+			}, nil
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create form"})
 			return
 		}
 
-		// Invalidate cache
-		go clearFormCache(context.Background(), rdb, orgID.(string), "")
-
 		form.ID = docRef.ID
+		c.Header("ETag", services.FormETag(&form))
 		c.JSON(http.StatusCreated, form)
 	}
 }
 
-// GetForm retrieves a form by its ID, using a cache-aside pattern.
+// GetForm retrieves a form by its ID, using a cache-aside pattern. The ETag header carries
+// the form's version for If-Match on later writes.
 func GetForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		formID := c.Param("id")
@@ -83,13 +74,19 @@ func GetForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 		// 1. Check cache first
 		cacheKey := fmt.Sprintf("form:%s", formID)
 		if rdb != nil {
-			cachedFormJSON, err := rdb.Get(ctx, cacheKey).Result()
+			cachedFormJSON, err := rdb.Get(ctx, cacheKey).Bytes()
 			if err == nil {
-				// Cache Hit!
-				c.Data(http.StatusOK, "application/json", []byte(cachedFormJSON))
-				return
+				if formJSON, err := services.OpenCacheValue(ctx, cacheKey, cachedFormJSON); err == nil {
+					var cached data.Form
+					if json.Unmarshal(formJSON, &cached) == nil {
+						// Cache Hit!
+						c.Header("ETag", services.FormETag(&cached))
+						c.Data(http.StatusOK, "application/json", formJSON)
+						return
+					}
+				}
 			} else if err != redis.Nil {
-				log.Printf("Redis GET error: %v. Fetching from DB.", err)
+				requestLog(c).Warn("form cache read failed, fetching from Firestore", "error", err)
 			}
 		}
 
@@ -110,6 +107,10 @@ func GetForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 			return
 		}
 
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return
+		}
 		// Allow access to forms without organization ID (legacy forms)
 		if form.OrganizationID != "" && form.OrganizationID != orgID.(string) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
@@ -121,15 +122,19 @@ func GetForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 		// 3. Populate cache
 		if rdb != nil {
 			jsonData, err := json.Marshal(form)
+			if err == nil {
+				jsonData, err = services.SealCacheValue(ctx, cacheKey, jsonData)
+			}
 			if err == nil {
 				if err := rdb.Set(ctx, cacheKey, jsonData, formCacheTTL).Err(); err != nil {
-					log.Printf("Redis SET error: %v", err)
+					requestLog(c).Warn("form cache write failed", "error", err)
 				}
 			} else {
-				log.Printf("JSON Marshal error: %v", err)
+				requestLog(c).Warn("form cache encode failed", "error", err)
 			}
 		}
 
+		c.Header("ETag", services.FormETag(&form))
 		c.JSON(http.StatusOK, form)
 	}
 }
@@ -142,10 +147,13 @@ func ListForms(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 
 		cacheKey := fmt.Sprintf("forms:list:%s", orgID.(string))
 		if rdb != nil {
-			cachedListJSON, err := rdb.Get(ctx, cacheKey).Result()
+			cachedListJSON, err := rdb.Get(ctx, cacheKey).Bytes()
+			if err == nil {
+				cachedListJSON, err = services.OpenCacheValue(ctx, cacheKey, cachedListJSON)
+			}
 			if err == nil {
 				var forms []data.Form
-				if json.Unmarshal([]byte(cachedListJSON), &forms) == nil {
+				if json.Unmarshal(cachedListJSON, &forms) == nil {
 					c.JSON(http.StatusOK, gin.H{"results": forms})
 					return
 				}
@@ -166,7 +174,10 @@ func ListForms(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 
 			var form data.Form
 			if err := doc.DataTo(&form); err != nil {
-				log.Printf("Failed to parse form data: %v", err)
+				requestLog(c).Warn("failed to parse form", "form_id", doc.Ref.ID, "error", err)
+				continue
+			}
+			if form.DeletedAt != nil {
 				continue
 			}
 			form.ID = doc.Ref.ID
@@ -175,6 +186,9 @@ func ListForms(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 
 		if rdb != nil {
 			jsonData, err := json.Marshal(forms)
+			if err == nil {
+				jsonData, err = services.SealCacheValue(ctx, cacheKey, jsonData)
+			}
 			if err == nil {
 				rdb.Set(ctx, cacheKey, jsonData, formCacheTTL)
 			}
@@ -184,60 +198,252 @@ func ListForms(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
 	}
 }
 
-// UpdateForm updates a form and invalidates its cache.
-func UpdateForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
+var (
+	errFormNotFound  = errors.New("form not found")
+	errFormForbidden = errors.New("permission denied")
+
+	errInvalidFormUpdate = errors.New("invalid form update")
+)
+
+// readOnlyFormFields are set by the server and cannot be changed through UpdateForm
+var readOnlyFormFields = []string{"id", "version", "organizationId", "createdAt", "createdBy", "deleted_at", "deleted_by"}
+
+// requireIfMatch reads the If-Match header that form writes must carry. It responds with
+// 428 and returns false when the header is missing or is the "*" wildcard.
+func requireIfMatch(c *gin.Context) ([]string, bool) {
+	header := c.GetHeader("If-Match")
+	tags := services.ParseIfMatch(header)
+	if len(tags) == 0 || header == "*" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the form's ETag is required"})
+		return nil, false
+	}
+	return tags, true
+}
+
+// respondFormWriteError maps the errors of a form write to a response. A version conflict
+// returns 412 with the current copy of the form, so the builder can merge and retry.
+func respondFormWriteError(c *gin.Context, err error, message string) {
+	var conflict *services.FormVersionConflict
+	switch {
+	case errors.As(err, &conflict):
+		c.Header("ETag", services.FormETag(conflict.Current))
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"error":   "form has been modified since it was loaded",
+			"current": conflict.Current,
+		})
+	case errors.Is(err, errFormNotFound), errors.Is(err, services.ErrTrashItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+	case errors.Is(err, errFormForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	case errors.Is(err, errInvalidFormUpdate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// mergeFormUpdates returns the form as it reads after a MergeAll write of updates: nested
+// maps are merged key by key and any other value replaces the stored one.
+func mergeFormUpdates(form data.Form, updates map[string]interface{}) (data.Form, error) {
+	raw, err := json.Marshal(form)
+	if err != nil {
+		return data.Form{}, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return data.Form{}, err
+	}
+	if raw, err = json.Marshal(mergeFields(fields, updates)); err != nil {
+		return data.Form{}, err
+	}
+	var merged data.Form
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return data.Form{}, fmt.Errorf("%w: %v", errInvalidFormUpdate, err)
+	}
+	merged.ID = form.ID
+	return merged, nil
+}
+
+func mergeFields(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		if nested, ok := value.(map[string]interface{}); ok {
+			if current, ok := dst[key].(map[string]interface{}); ok {
+				dst[key] = mergeFields(current, nested)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// UpdateForm updates a form. The request must carry the form's ETag in If-Match; the
+// version is checked and bumped in the same transaction as the write, so concurrent
+// editors get a 412 instead of overwriting each other.
+func UpdateForm(client *firestore.Client, rdb *redis.Client, events *services.EventBus) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		formID := c.Param("id")
 		orgID, _ := c.Get("organizationID")
 		userID, _ := c.Get("userID")
 
-		// Ensure form belongs to the org (omitted for brevity, but should be here)
-
+		ifMatch, ok := requireIfMatch(c)
+		if !ok {
+			return
+		}
 		var updates map[string]interface{}
 		if err := c.ShouldBindJSON(&updates); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		for _, field := range readOnlyFormFields {
+			delete(updates, field)
+		}
 
-		updates["updatedAt"] = time.Now().UTC()
-		updates["updatedBy"] = userID.(string)
+		ref := client.Collection("forms").Doc(formID)
+		var updated data.Form
+		err := events.Transact(c.Request.Context(), func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			doc, err := tx.Get(ref)
+			if status.Code(err) == codes.NotFound {
+				return nil, errFormNotFound
+			}
+			if err != nil {
+				return nil, err
+			}
+			var form data.Form
+			if err := doc.DataTo(&form); err != nil {
+				return nil, err
+			}
+			form.ID = formID
+			if form.DeletedAt != nil {
+				return nil, errFormNotFound
+			}
+			if form.OrganizationID != orgID.(string) {
+				return nil, errFormForbidden
+			}
+			if err := services.CheckFormVersion(&form, ifMatch); err != nil {
+				return nil, err
+			}
 
-		_, err := client.Collection("forms").Doc(formID).Set(c.Request.Context(), updates, firestore.MergeAll)
+			updates["version"] = form.Version + 1
+			updates["updatedAt"] = time.Now().UTC().Truncate(time.Microsecond)
+			updates["updatedBy"] = userID.(string)
+			// The response is the state this transaction writes; reading the form back after
+			// the commit could return another editor's later save under our ETag
+			if updated, err = mergeFormUpdates(form, updates); err != nil {
+				return nil, err
+			}
+			if err := tx.Set(ref, updates, firestore.MergeAll); err != nil {
+				return nil, err
+			}
+			return []data.DomainEvent{
+				services.NewDomainEvent(services.DomainFormUpdated, orgID.(string), "form", formID, userID.(string), nil),
+			}, nil
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update form"})
+			respondFormWriteError(c, err, "failed to update form")
 			return
 		}
 
-		// Invalidate cache
-		go clearFormCache(context.Background(), rdb, orgID.(string), formID)
-
-		c.Status(http.StatusOK)
+		// The FormUpdated event clears the cache too, but the next GET has to see the new
+		// version or the caller's following write would fail with a stale ETag
+		if err := services.InvalidateFormCache(c.Request.Context(), rdb, orgID.(string), formID); err != nil {
+			requestLog(c).Warn("form cache invalidation failed", "error", err)
+		}
+		c.Header("ETag", services.FormETag(&updated))
+		c.JSON(http.StatusOK, updated)
 	}
 }
 
-// DeleteForm deletes a form and invalidates its cache.
-func DeleteForm(client *firestore.Client, rdb *redis.Client) gin.HandlerFunc {
+// DeleteForm moves a form to the trash and deactivates its share links. Like UpdateForm it
+// requires the form's ETag in If-Match. The trash service drops the form's cache entries
+// before the response is sent.
+func DeleteForm(trash *services.TrashService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		formID := c.Param("id")
 		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+
+		ifMatch, ok := requireIfMatch(c)
+		if !ok {
+			return
+		}
+		if _, err := trash.DeleteForm(c.Request.Context(), orgID.(string), userID.(string), formID, ifMatch); err != nil {
+			respondFormWriteError(c, err, "failed to delete form")
+			return
+		}
 
-		// Ensure form belongs to the org (omitted for brevity, but should be here)
+		c.Status(http.StatusNoContent)
+	}
+}
 
-		_, err := client.Collection("forms").Doc(formID).Delete(c.Request.Context())
+// PublishForm marks a form as active so it can be shared with patients.
+func PublishForm(client *firestore.Client, events *services.EventBus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		formID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+		ctx := c.Request.Context()
+
+		ref := client.Collection("forms").Doc(formID)
+		doc, err := ref.Get(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete form"})
+			if status.Code(err) == codes.NotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve form"})
+			return
+		}
+
+		var form data.Form
+		if err := doc.DataTo(&form); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
+			return
+		}
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return
+		}
+		if form.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "permission denied"})
 			return
 		}
 
-		// Invalidate cache
-		go clearFormCache(context.Background(), rdb, orgID.(string), formID)
+		now := time.Now().UTC()
+		err = events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+			err := tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: "active"},
+				{Path: "publishedAt", Value: now},
+				{Path: "version", Value: firestore.Increment(1)},
+				{Path: "updatedAt", Value: now},
+				{Path: "updatedBy", Value: userID.(string)},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return []data.DomainEvent{
+				services.NewDomainEvent(services.DomainFormPublished, orgID.(string), "form", formID, userID.(string),
+					map[string]interface{}{"form_id": formID}),
+			}, nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish form"})
+			return
+		}
 
-		c.Status(http.StatusNoContent)
+		form.ID = formID
+		form.Status = "active"
+		form.PublishedAt = &now
+		form.UpdatedAt = now
+		form.UpdatedBy = userID.(string)
+		form.Version++
+		c.Header("ETag", services.FormETag(&form))
+		c.JSON(http.StatusOK, form)
 	}
 }
 
 // ProcessPDFWithVertex processes a PDF file and generates a form structure using Vertex AI
-func ProcessPDFWithVertex(client *firestore.Client, vertexService *services.VertexAIService) gin.HandlerFunc {
+func ProcessPDFWithVertex(client *firestore.Client, vertexService *services.VertexAIService, sanitizer *services.UploadSanitizer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var request struct {
 			PDFData string `json:"pdf_data"`
@@ -253,30 +459,45 @@ func ProcessPDFWithVertex(client *firestore.Client, vertexService *services.Vert
 			return
 		}
 
-		// Debug: Log received data info
-		base64Length := len(request.PDFData)
-		log.Printf("DEBUG: Received base64 PDF data length: %d characters", base64Length)
-		log.Printf("DEBUG: First 50 chars of base64: %.50s", request.PDFData)
-		
 		// Decode base64 PDF data
 		pdfBytes, err := base64.StdEncoding.DecodeString(request.PDFData)
 		if err != nil {
-			log.Printf("ERROR: Base64 decoding failed: %v", err)
+			requestLog(c).Warn("PDF import is not valid base64", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid base64 PDF data"})
 			return
 		}
 		
-		log.Printf("DEBUG: Decoded PDF bytes length: %d (expected ~32KB = 32768 bytes)", len(pdfBytes))
+		requestLog(c).Debug("PDF import received", "size", len(pdfBytes))
 
-		// Use Vertex AI to generate form structure from PDF
+		// Reject scripted PDFs and disguised files before they reach Vertex
 		ctx := c.Request.Context()
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+		pdfBytes, report, err := sanitizer.Sanitize(ctx, services.Upload{
+			Data:           pdfBytes,
+			DeclaredType:   services.MimePDF,
+			Allowed:        services.PDFUploadTypes,
+			Source:         "pdf_import",
+			UserID:         toString(userID),
+			OrganizationID: toString(orgID),
+			IPAddress:      c.ClientIP(),
+		})
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "PDF rejected", "details": err.Error(), "upload": report})
+			return
+		}
+
+		// Use Vertex AI to generate form structure from PDF
 		formJSON, err := vertexService.GenerateFormFromPDF(ctx, pdfBytes)
 		if err != nil {
-			log.Printf("Failed to generate form from PDF: %v", err)
+			requestLog(c).Error("failed to generate form from PDF", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process PDF"})
 			return
 		}
 
+		if formMap, ok := formJSON.(map[string]interface{}); ok {
+			formMap["upload"] = report
+		}
 		c.JSON(http.StatusOK, formJSON)
 	}
 }
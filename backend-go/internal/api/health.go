@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"backend-go/internal/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Livez reports that the process is up and serving. It checks no dependencies, so an
+// outage elsewhere never gets healthy instances restarted.
+func Livez() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+	}
+}
+
+// Readyz runs the critical dependency checks and answers 503 when any fails, so Cloud Run
+// stops routing to the instance. It is unauthenticated, so only check names and statuses
+// are returned.
+func Readyz(checks *health.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checks.Run(c.Request.Context(), true)
+
+		statuses := make(gin.H, len(report.Checks))
+		for _, result := range report.Checks {
+			statuses[result.Name] = result.Status
+		}
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"status": report.Status, "checks": statuses})
+	}
+}
+
+// HealthDetails runs every check, critical or not, and returns latencies, errors and
+// dependency details. It must be mounted behind authentication.
+func HealthDetails(checks *health.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checks.Run(c.Request.Context(), false)
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status":    report.Status,
+			"timestamp": time.Now().Unix(),
+			"checks":    report.Checks,
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBody keeps a stored response within Firestore's document limit. Larger
+	// responses are not kept, so a retry runs the request again.
+	maxIdempotentBody = 768 << 10
+)
+
+// replayedHeaders are the response headers stored with the body and sent again on replay
+var replayedHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location"}
+
+// retryableStatus reports whether a response is transient and the request should run again
+// when retried, rather than replay it
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// idempotencyWriter keeps a copy of the response body so it can be stored for replay
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	if w.body.Len() <= maxIdempotentBody {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	if w.body.Len() <= maxIdempotentBody {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes a creation endpoint safe to retry. A request carrying an
+// Idempotency-Key runs once; retries with the same key and body get the first response
+// again, marked with Idempotent-Replayed, and reusing the key for a different request is
+// rejected with 422. Keys are scoped to the signed-in user, or shared by public callers.
+// Server errors and other transient failures are not kept, so the request can be retried.
+// Requests without the header, and all requests while the store is unreachable, run as
+// usual.
+func IdempotencyMiddleware(store *services.IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := "public"
+		if userID, ok := c.Get("userID"); ok {
+			scope = "user:" + userID.(string)
+		}
+		scopedKey := scope + ":" + key
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		ctx := c.Request.Context()
+		stored, err := store.Begin(ctx, scopedKey, requestHash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			requestLog(c).Warn("idempotency store unavailable, running without it", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+			c.Next()
+			return
+		case stored != nil:
+			for name, value := range stored.Headers {
+				c.Header(name, value)
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(stored.Status, stored.Headers["Content-Type"], stored.Body)
+			c.Abort()
+			return
+		}
+
+		// Retries usually follow a dropped connection, which cancels the request context, so
+		// the outcome is stored regardless
+		storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			if !completed {
+				if err := store.Release(storeCtx, scopedKey); err != nil {
+					requestLog(c).Warn("failed to release idempotency key", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+				}
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if retryableStatus(status) || writer.body.Len() > maxIdempotentBody {
+			return
+		}
+		record := &data.IdempotencyRecord{
+			RequestHash: requestHash,
+			Status:      status,
+			Headers:     map[string]string{},
+			Body:        writer.body.Bytes(),
+		}
+		for _, name := range replayedHeaders {
+			if value := writer.Header().Get(name); value != "" {
+				record.Headers[name] = value
+			}
+		}
+		if err := store.Complete(storeCtx, scopedKey, record); err != nil {
+			requestLog(c).Warn("failed to store idempotent response", "method", c.Request.Method, "path", c.Request.URL.Path, "error", err)
+			return
+		}
+		completed = true
+	}
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"encoding/base64"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 
+	"backend-go/internal/data"
 	"backend-go/internal/services"
 	"github.com/gin-gonic/gin"
 )
@@ -13,13 +15,54 @@ import (
 // InsuranceCardHandler handles insurance card processing requests
 type InsuranceCardHandler struct {
 	insuranceService *services.InsuranceCardService
+	sanitizer        *services.UploadSanitizer
+}
+
+// insuranceCardResponse is the extracted data plus the upload sanitization report
+type insuranceCardResponse struct {
+	*services.ExtractedInsuranceData
+	Upload *data.UploadReport `json:"upload"`
 }
 
 // NewInsuranceCardHandler creates a new insurance card handler
-func NewInsuranceCardHandler(insuranceService *services.InsuranceCardService) *InsuranceCardHandler {
+func NewInsuranceCardHandler(insuranceService *services.InsuranceCardService, sanitizer *services.UploadSanitizer) *InsuranceCardHandler {
 	return &InsuranceCardHandler{
 		insuranceService: insuranceService,
+		sanitizer:        sanitizer,
+	}
+}
+
+// sanitizeCardImage checks the card photo and strips its metadata. It writes the error
+// response itself and returns false when the request should stop.
+func (h *InsuranceCardHandler) sanitizeCardImage(c *gin.Context, imageData []byte, declaredType string) ([]byte, *data.UploadReport, bool) {
+	userID, _ := c.Get("userID")
+	orgID, _ := c.Get("organizationID")
+
+	clean, report, err := h.sanitizer.Sanitize(c.Request.Context(), services.Upload{
+		Data:           imageData,
+		DeclaredType:   declaredType,
+		Allowed:        services.ImageUploadTypes,
+		Source:         "insurance_card",
+		UserID:         toString(userID),
+		OrganizationID: toString(orgID),
+		IPAddress:      c.ClientIP(),
+	})
+	if errors.Is(err, services.ErrUploadRejected) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Image rejected",
+			"details": err.Error(),
+			"upload":  report,
+		})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to process image",
+			"details": err.Error(),
+		})
+		return nil, nil, false
 	}
+	return clean, report, true
 }
 
 // InsuranceCardRequest represents the request body for insurance card processing
@@ -75,11 +118,6 @@ func (h *InsuranceCardHandler) ProcessInsuranceCard(c *gin.Context) {
 		imageData = parts[1]
 	}
 
-	// Default mime type if not provided
-	if req.MimeType == "" {
-		req.MimeType = "image/jpeg"
-	}
-
 	// Decode base64 image
 	decodedImage, err := base64.StdEncoding.DecodeString(imageData)
 	if err != nil {
@@ -90,11 +128,17 @@ func (h *InsuranceCardHandler) ProcessInsuranceCard(c *gin.Context) {
 		return
 	}
 
+	// The declared type is only checked against the content; the sniffed type is what gets used
+	cleanImage, report, ok := h.sanitizeCardImage(c, decodedImage, req.MimeType)
+	if !ok {
+		return
+	}
+
 	// Process the insurance card with Vertex AI
 	extractedData, err := h.insuranceService.ProcessInsuranceCard(
 		c.Request.Context(),
-		decodedImage,
-		req.MimeType,
+		cleanImage,
+		report.DetectedType,
 		req.Side,
 	)
 	if err != nil {
@@ -106,7 +150,7 @@ func (h *InsuranceCardHandler) ProcessInsuranceCard(c *gin.Context) {
 	}
 
 	// Return the extracted data
-	c.JSON(http.StatusOK, extractedData)
+	c.JSON(http.StatusOK, insuranceCardResponse{extractedData, report})
 }
 
 // ProcessInsuranceCardMultipart handles multipart form data uploads
@@ -147,17 +191,17 @@ func (h *InsuranceCardHandler) ProcessInsuranceCardMultipart(c *gin.Context) {
 		return
 	}
 
-	// Determine MIME type from file header
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "image/jpeg" // Default
+	// The declared Content-Type is only checked against the content; the sniffed type is what gets used
+	cleanImage, report, ok := h.sanitizeCardImage(c, imageData, header.Header.Get("Content-Type"))
+	if !ok {
+		return
 	}
 
 	// Process the insurance card with Vertex AI
 	extractedData, err := h.insuranceService.ProcessInsuranceCard(
 		c.Request.Context(),
-		imageData,
-		mimeType,
+		cleanImage,
+		report.DetectedType,
 		side,
 	)
 	if err != nil {
@@ -169,5 +213,5 @@ func (h *InsuranceCardHandler) ProcessInsuranceCardMultipart(c *gin.Context) {
 	}
 
 	// Return the extracted data
-	c.JSON(http.StatusOK, extractedData)
+	c.JSON(http.StatusOK, insuranceCardResponse{extractedData, report})
 }
\ No newline at end of file
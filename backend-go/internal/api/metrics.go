@@ -0,0 +1,28 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"backend-go/internal/config"
+	"backend-go/internal/telemetry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler serves the Prometheus registry. When a token is configured the scraper
+// must send it as a bearer token.
+func MetricsHandler(token config.Secret) gin.HandlerFunc {
+	handler := telemetry.MetricsHandler()
+	return func(c *gin.Context) {
+		if token != "" {
+			supplied := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(supplied), []byte(token.Value())) != 1 {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -1,18 +1,16 @@
 package api
 
 import (
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"backend-go/internal/data"
 	"backend-go/internal/services"
-	"firebase.google.com/go/v4/auth"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
+func AuthMiddleware(authClient TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// First, try session cookie authentication (preferred for HIPAA)
 		sessionCookie, err := c.Cookie("session")
@@ -26,11 +24,12 @@ func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
 				c.Set("organizationID", sessionData.OrganizationID)
 				c.Set("organizationId", sessionData.OrganizationID)
 				c.Set("uid", sessionData.UserID)
-				log.Printf("AuthMiddleware: Authenticated via session cookie for user %s", sessionData.UserID)
+				setLogIdentity(c, sessionData.OrganizationID, sessionData.UserID)
+				requestLog(c).Debug("authenticated", "method", "session")
 				c.Next()
 				return
 			}
-			log.Printf("AuthMiddleware: Session cookie invalid or expired: %v", err)
+			requestLog(c).Info("session cookie invalid or expired", "error", err)
 		}
 
 		// Fallback to Bearer token authentication (for backward compatibility)
@@ -46,16 +45,12 @@ func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
 			return
 		}
 
-		log.Println("AuthMiddleware: Verifying ID token...")
 		startTime := time.Now()
-
 		token, err := authClient.VerifyIDToken(c.Request.Context(), idToken)
-
 		duration := time.Since(startTime)
-		log.Printf("AuthMiddleware: ID token verification took %s", duration)
 
 		if err != nil {
-			log.Printf("Error verifying ID token: %v\n", err)
+			requestLog(c).Warn("ID token verification failed", "error", err, "duration", duration)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
 			return
 		}
@@ -71,7 +66,8 @@ func AuthMiddleware(authClient *auth.Client) gin.HandlerFunc {
 			c.Set("email", email)
 		}
 
-		log.Printf("AuthMiddleware: Authenticated via Bearer token for user %s", token.UID)
+		setLogIdentity(c, token.UID, token.UID)
+		requestLog(c).Debug("authenticated", "method", "bearer", "duration", duration)
 		c.Next()
 	}
 }
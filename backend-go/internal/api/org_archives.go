@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxArchiveUpload caps the size of an uploaded organization archive
+const maxArchiveUpload = 256 << 20
+
+// CreateOrgBackup queues a backup of the caller's organization. The passphrase is required:
+// it encrypts the archive and is needed to restore it, and it cannot be recovered.
+func CreateOrgBackup(archives *services.OrgArchiveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+
+		var request struct {
+			Passphrase string `json:"passphrase"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		job, err := archives.RequestBackup(c.Request.Context(), orgID.(string), userID.(string), request.Passphrase)
+		if errors.Is(err, services.ErrArchivePassphraseRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("ARCHIVE: failed to queue backup: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue backup"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"job":     job,
+			"message": "backup queued; the archive can be downloaded for 7 days once it is ready",
+		})
+	}
+}
+
+// CreateOrgRestore queues the restore of an uploaded archive into the caller's
+// organization. The multipart form carries the archive as "archive", and optionally
+// "passphrase" and "dry_run".
+func CreateOrgRestore(archives *services.OrgArchiveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveUpload+1<<20)
+		file, _, err := c.Request.FormFile("archive")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "archive file is required (at most 256 MB)"})
+			return
+		}
+		defer file.Close()
+		archive, err := io.ReadAll(io.LimitReader(file, maxArchiveUpload+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read archive"})
+			return
+		}
+		if len(archive) > maxArchiveUpload {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "archive is larger than 256 MB"})
+			return
+		}
+
+		dryRun := false
+		if value := c.PostForm("dry_run"); value != "" {
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+				return
+			}
+		}
+
+		job, err := archives.RequestRestore(c.Request.Context(), orgID.(string), userID.(string), archive, c.PostForm("passphrase"), dryRun)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidArchive) || errors.Is(err, services.ErrArchivePassphrase) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("ARCHIVE: failed to queue restore: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue restore"})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+	}
+}
+
+// GetOrgArchiveJob returns the status and progress of a backup or restore
+func GetOrgArchiveJob(archives *services.OrgArchiveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		job, err := archives.Get(c.Request.Context(), orgID.(string), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrArchiveJobNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "archive job not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load archive job"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// DownloadOrgBackup serves a completed backup archive
+func DownloadOrgBackup(archives *services.OrgArchiveService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+		jobID := c.Param("id")
+
+		job, content, err := archives.Download(c.Request.Context(), orgID.(string), jobID)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrArchiveJobNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "backup not found"})
+			case errors.Is(err, services.ErrArchiveNotReady):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				log.Printf("ARCHIVE: download of backup %s failed: %v", jobID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download backup"})
+			}
+			return
+		}
+
+		contentType, extension := "application/zip", "zip"
+		if job.Encrypted {
+			contentType, extension = "application/octet-stream", "hfarc"
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="organization-backup-%s.%s"`, job.ID, extension))
+		c.Header("Digest", digestHeader(job.SHA256))
+		c.Data(http.StatusOK, contentType, content)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"backend-go/internal/data"
+	"backend-go/internal/services"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -150,6 +151,150 @@ func GetOrganizationClinicInfo(client *firestore.Client) gin.HandlerFunc {
 	}
 }
 
+// UpdateOrganizationReminderSchedule sets the default reminder schedule for an organization's share links
+func UpdateOrganizationReminderSchedule(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.Param("id")
+		userUID := c.GetString("uid")
+
+		// Build expected organization ID for this user
+		expectedOrgID := "org-" + userUID
+
+		// Ensure user can only update their own organization
+		if orgID != expectedOrgID && orgID != userUID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot update another organization's settings"})
+			return
+		}
+
+		var schedule data.ReminderSchedule
+		if err := c.ShouldBindJSON(&schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.ValidateReminderSchedule(&schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Handle both org-{uid} and {uid} formats, matching clinic info storage
+		docID := orgID
+		if orgID == expectedOrgID {
+			docID = userUID
+		}
+
+		_, err := client.Collection("organizations").Doc(docID).Set(c.Request.Context(), map[string]interface{}{
+			"settings": map[string]interface{}{
+				"reminder_schedule": schedule,
+			},
+			"updated_at": time.Now().UTC(),
+		}, firestore.MergeAll)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reminder schedule"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Reminder schedule updated successfully", "reminder_schedule": schedule})
+	}
+}
+
+// GetOrganizationReminderSchedule returns the organization's effective reminder schedule
+func GetOrganizationReminderSchedule(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.Param("id")
+		userUID := c.GetString("uid")
+
+		// Build expected organization ID for this user
+		expectedOrgID := "org-" + userUID
+
+		if orgID != expectedOrgID && orgID != userUID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot access another organization's settings"})
+			return
+		}
+
+		// Handle both org-{uid} and {uid} formats, matching clinic info storage
+		docID := orgID
+		if orgID == expectedOrgID {
+			docID = userUID
+		}
+
+		doc, err := client.Collection("organizations").Doc(docID).Get(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+
+		var org data.Organization
+		if err := doc.DataTo(&org); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse organization data"})
+			return
+		}
+
+		if org.Settings.ReminderSchedule == nil {
+			c.JSON(http.StatusOK, gin.H{"reminder_schedule": services.DefaultReminderSchedule, "is_default": true})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reminder_schedule": org.Settings.ReminderSchedule, "is_default": false})
+	}
+}
+
+// UpdateOrganizationRetention sets how long an organization keeps response data and what
+// happens to it afterwards. A retention of 0 days disables the sweeper for the organization.
+func UpdateOrganizationRetention(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.Param("id")
+		userUID := c.GetString("uid")
+
+		// Build expected organization ID for this user
+		expectedOrgID := "org-" + userUID
+
+		// Ensure user can only update their own organization
+		if orgID != expectedOrgID && orgID != userUID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cannot update another organization's settings"})
+			return
+		}
+
+		var request struct {
+			DataRetentionDays *int   `json:"data_retention_days" binding:"required"`
+			RetentionAction   string `json:"retention_action"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.ValidateRetentionSettings(*request.DataRetentionDays, request.RetentionAction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.RetentionAction == "" {
+			request.RetentionAction = services.RetentionPurge
+		}
+
+		// GetOrCreateUserOrganization stores settings under org-{uid}
+		docID := orgID
+		if orgID == userUID {
+			docID = expectedOrgID
+		}
+
+		_, err := client.Collection("organizations").Doc(docID).Set(c.Request.Context(), map[string]interface{}{
+			"settings": map[string]interface{}{
+				"data_retention_days": *request.DataRetentionDays,
+				"retention_action":    request.RetentionAction,
+			},
+			"updated_at": time.Now().UTC(),
+		}, firestore.MergeAll)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention settings"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Retention settings updated successfully",
+			"data_retention_days": *request.DataRetentionDays,
+			"retention_action":    request.RetentionAction,
+		})
+	}
+}
+
 // GetOrCreateUserOrganization gets the user's organization or creates one if it doesn't exist
 func GetOrCreateUserOrganization(client *firestore.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
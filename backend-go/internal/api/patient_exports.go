@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePatientExport queues a right-of-access export for a patient. The download link is
+// returned once and cannot be retrieved again.
+func CreatePatientExport(exports *services.PatientExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+
+		var request struct {
+			data.PatientMatch
+			Recipient string `json:"recipient" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, token, err := exports.Request(c.Request.Context(), orgID.(string), userID.(string), request.Recipient, request.PatientMatch)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPatientMatch) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("EXPORT: failed to queue export: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue export"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"export":         job,
+			"download_url":   fmt.Sprintf("/api/exports/%s/download", job.ID),
+			"download_token": token,
+			"message":        "export queued; POST the download token to the download URL. It works once and expires 24 hours after the archive is ready",
+		})
+	}
+}
+
+// GetPatientExport returns the status of an export job
+func GetPatientExport(exports *services.PatientExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		job, err := exports.Get(c.Request.Context(), orgID.(string), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, services.ErrExportNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load export"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// DownloadPatientExport serves an export archive to the holder of its single-use token.
+// The token is the only credential, so the route is public; it is taken from the request
+// body so it stays out of URLs, access logs and browser history.
+func DownloadPatientExport(exports *services.PatientExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportID := c.Param("id")
+		var request struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+			return
+		}
+
+		job, content, err := exports.Download(c.Request.Context(), exportID, request.Token)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrExportNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "export not found"})
+			case errors.Is(err, services.ErrExportNotReady):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, services.ErrExportUnavailable):
+				c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			default:
+				log.Printf("EXPORT: download of export %s failed: %v", exportID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to download export"})
+			}
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="patient-export-%s.zip"`, job.ID))
+		c.Header("Digest", digestHeader(job.SHA256))
+		c.Data(http.StatusOK, "application/zip", content)
+	}
+}
+
+// digestHeader formats a hex SHA-256 as an RFC 3230 Digest value, which is base64
+func digestHeader(hexSum string) string {
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return ""
+	}
+	return "sha-256=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// ListDisclosures returns the organization's accounting of disclosures
+func ListDisclosures(exports *services.PatientExportService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		records, err := exports.Disclosures(c.Request.Context(), orgID.(string), limit)
+		if err != nil {
+			log.Printf("EXPORT: failed to list disclosures: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list disclosures"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(records), "results": records})
+	}
+}
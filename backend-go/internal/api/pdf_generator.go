@@ -4,7 +4,6 @@ package api
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -13,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"backend-go/internal/data"
+	"backend-go/internal/logging"
 	"backend-go/internal/services"
 )
 
@@ -25,13 +25,17 @@ type PDFGenerationRequest struct {
 
 // GeneratePDFHandler uses the new PDFOrchestrator system for enhanced PDF generation.
 // Supports all 11 medical form types with security validation and performance optimization.
-func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService) gin.HandlerFunc {
+func GeneratePDFHandler(client *firestore.Client, gs services.PDFConverter, events *services.EventBus, attachments *services.AttachmentService, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		responseId := c.Param("responseId")
+		responseId := c.Param("id")
 		if responseId == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Response ID is required"})
 			return
 		}
+		purpose, ok := purposeOfUse(c)
+		if !ok {
+			return
+		}
 		
 		// Extract user ID from Firebase token for security validation
 		userID := "unknown-user"
@@ -43,7 +47,8 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 			}
 		}
 		
-		log.Printf("PDF_GENERATION_V2_START: user=%s, response=%s", userID, responseId)
+		logger := requestLog(c).With("response_id", responseId)
+		logger.Info("PDF generation started")
 		startTime := time.Now()
 		
 		// Distributed lock to prevent duplicate PDF generation
@@ -53,19 +58,21 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 			
 			acquired, err := lock.Acquire(c.Request.Context())
 			if err != nil {
-				log.Printf("PDF_GENERATION_V2_ERROR: user=%s, response=%s, error=failed to acquire lock: %v", userID, responseId, err)
+				logger.Error("failed to acquire PDF lock", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Could not acquire system lock for PDF generation",
 					"code": "LOCK_ERROR",
+					"request_id": requestID(c),
 				})
 				return
 			}
 			
 			if !acquired {
-				log.Printf("PDF_GENERATION_V2_CONFLICT: user=%s, response=%s, error=PDF generation already in progress", userID, responseId)
+				logger.Warn("PDF generation already in progress")
 				c.JSON(http.StatusConflict, gin.H{
 					"error": "PDF generation is already in progress for this response",
 					"code": "GENERATION_IN_PROGRESS",
+					"request_id": requestID(c),
 					"retry_after": 300, // 5 minutes
 				})
 				return
@@ -74,25 +81,28 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 			// Ensure lock is released even if panic occurs
 			defer func() {
 				if err := lock.Release(c.Request.Context()); err != nil {
-					log.Printf("PDF_GENERATION_V2_WARNING: user=%s, response=%s, error=failed to release lock: %v", userID, responseId, err)
+					logger.Warn("failed to release PDF lock", "error", err)
 				}
 			}()
 			
-			log.Printf("PDF_GENERATION_V2_LOCK_ACQUIRED: user=%s, response=%s", userID, responseId)
+			logger.Debug("PDF lock acquired")
 		} else {
-			log.Printf("PDF_GENERATION_V2_WARNING: user=%s, response=%s, Redis unavailable - proceeding without lock", userID, responseId)
+			logger.Warn("Redis unavailable, generating PDF without lock")
 		}
 		
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		// Detached from the request so a dropped connection doesn't abort rendering, but
+		// keeps the request ID so orchestrator, Gotenberg and audit lines can be correlated
+		ctx, cancel := context.WithTimeout(logging.Detach(c.Request.Context()), 30*time.Second)
 		defer cancel()
 
 		// Initialize the new PDF orchestrator with all components
-		orchestrator, err := services.NewPDFOrchestrator(client, gs)
+		orchestrator, err := services.NewPDFOrchestrator(client, gs, attachments, encryptor)
 		if err != nil {
-			log.Printf("PDF_GENERATION_V2_ERROR: user=%s, response=%s, error=failed to initialize orchestrator: %v", userID, responseId, err)
+			logger.Error("failed to initialize PDF orchestrator", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "PDF system initialization failed",
 				"code": "INIT_ERROR",
+				"request_id": requestID(c),
 			})
 			return
 		}
@@ -100,13 +110,14 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 		// Generate PDF using the new orchestrator system
 		pdfBytes, err := orchestrator.GeneratePDF(ctx, responseId, userID)
 		if err != nil {
-			log.Printf("PDF_GENERATION_V2_ERROR: user=%s, response=%s, error=%v", userID, responseId, err)
+			logger.Error("PDF generation failed", "error", err)
 			
 			// Enhanced error handling with specific error codes
 			errorResponse := gin.H{
 				"error": "PDF generation failed",
 				"details": err.Error(),
 				"code": "GENERATION_ERROR",
+				"request_id": requestID(c),
 			}
 			
 			// Check for specific error types
@@ -129,8 +140,19 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 		}
 		
 		totalDuration := time.Since(startTime)
-		log.Printf("PDF_GENERATION_V2_SUCCESS: user=%s, response=%s, size=%d bytes, duration=%v", 
-			userID, responseId, len(pdfBytes), totalDuration)
+		logger.Info("PDF generation succeeded", "size", len(pdfBytes), "duration", totalDuration)
+
+		if err := accessLog.RecordByID(ctx, responseId, phiAccess(c, services.PHIActionPDF, purpose)); err != nil {
+			logger.Error("failed to record PHI access", "error", err)
+		}
+
+		if orgID, exists := c.Get("organizationID"); exists {
+			event := services.NewDomainEvent(services.DomainPDFGenerated, orgID.(string), "response", responseId, userID,
+				map[string]interface{}{"response_id": responseId})
+			if err := events.Emit(c.Request.Context(), event); err != nil {
+				logger.Error("failed to record event", "event", services.DomainPDFGenerated, "error", err)
+			}
+		}
 		
 		// Return PDF with security headers
 		c.Header("Content-Type", "application/pdf")
@@ -142,6 +164,6 @@ func GeneratePDFHandler(client *firestore.Client, gs *services.GotenbergService)
 }
 
 // Helper function to register this route - will be called from main.go
-func RegisterPDFRoutes(router *gin.RouterGroup, client *firestore.Client, gs *services.GotenbergService) {
-	router.POST("/:responseId/generate-pdf", GeneratePDFHandler(client, gs))
+func RegisterPDFRoutes(router *gin.RouterGroup, idempotency gin.HandlerFunc, client *firestore.Client, gs services.PDFConverter, events *services.EventBus, attachments *services.AttachmentService, encryptor *services.FieldEncryptor, accessLog *services.PHIAccessLog) {
+	router.POST("/:id/generate-pdf", idempotency, GeneratePDFHandler(client, gs, events, attachments, encryptor, accessLog))
 }
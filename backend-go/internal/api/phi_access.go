@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// purposeOfUseHeader lets clients declare why they are accessing PHI. Requests that don't
+// send it are recorded as treatment.
+const purposeOfUseHeader = "X-Purpose-Of-Use"
+
+// purposeOfUse reads the declared purpose of use, writing a 400 response when it is not a
+// supported code
+func purposeOfUse(c *gin.Context) (string, bool) {
+	purpose := strings.ToUpper(strings.TrimSpace(c.GetHeader(purposeOfUseHeader)))
+	if purpose == "" {
+		return services.PurposeTreatment, true
+	}
+	if !services.IsPurposeOfUse(purpose) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    purposeOfUseHeader + " is not a supported purpose-of-use code",
+			"accepted": services.PurposesOfUse,
+		})
+		return "", false
+	}
+	return purpose, true
+}
+
+// phiAccess describes an access by the authenticated caller
+func phiAccess(c *gin.Context, action, purpose string) services.PHIAccess {
+	return services.PHIAccess{
+		Action:    action,
+		Purpose:   purpose,
+		ActorType: "user",
+		ActorID:   c.GetString("userID"),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// GetResponseAccessLog lists who accessed or received a response
+func GetResponseAccessLog(accessLog *services.PHIAccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		events, err := accessLog.ForResponse(c.Request.Context(), orgID.(string), c.Param("id"), limit)
+		if err != nil {
+			log.Printf("PHI_ACCESS: failed to list access log for response %s: %v", c.Param("id"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read access log"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(events), "results": events})
+	}
+}
+
+// GetPatientAccessReport reports every access to and disclosure of a patient's responses.
+// The patient is identified in the request body so their name and date of birth stay out
+// of URLs and request logs.
+func GetPatientAccessReport(accessLog *services.PHIAccessLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		var request struct {
+			PatientName string `json:"patient_name" binding:"required"`
+			DateOfBirth string `json:"date_of_birth"`
+			Limit       int    `json:"limit"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if request.Limit == 0 {
+			request.Limit = 500
+		}
+		if request.Limit < 0 || request.Limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		report, err := accessLog.PatientReport(c.Request.Context(), orgID.(string), request.PatientName, request.DateOfBirth, request.Limit)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidPatientMatch) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("PHI_ACCESS: failed to build patient access report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build access report"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
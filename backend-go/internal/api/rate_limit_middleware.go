@@ -6,24 +6,31 @@ import (
 	"net/http"
 	"time"
 
+	"backend-go/internal/config"
 	"backend-go/internal/data"
+	"backend-go/internal/telemetry"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
 
 // RateLimiterConfig defines rate limiting configuration
 type RateLimiterConfig struct {
+	Name              string // metric label for rejections
 	RequestsPerWindow int
 	WindowDuration    time.Duration
 	BurstAllowance    int // Allow brief bursts above limit
 }
 
-// Default configurations for different endpoint types
-var (
-	AuthRateLimit = RateLimiterConfig{RequestsPerWindow: 5, WindowDuration: 1 * time.Minute, BurstAllowance: 2}
-	APIRateLimit  = RateLimiterConfig{RequestsPerWindow: 100, WindowDuration: 1 * time.Minute, BurstAllowance: 10}
-	PDFRateLimit  = RateLimiterConfig{RequestsPerWindow: 10, WindowDuration: 1 * time.Minute, BurstAllowance: 2}
-)
+// NewRateLimiterConfig builds a limiter configuration from one configured limit. The
+// auth, api and pdf limits come from config.RateLimitsConfig.
+func NewRateLimiterConfig(name string, limit config.RateLimit) RateLimiterConfig {
+	return RateLimiterConfig{
+		Name:              name,
+		RequestsPerWindow: limit.Requests,
+		WindowDuration:    limit.Window,
+		BurstAllowance:    limit.Burst,
+	}
+}
 
 // RateLimiterMiddleware creates rate limiting middleware with HIPAA compliance
 func RateLimiterMiddleware(config RateLimiterConfig) gin.HandlerFunc {
@@ -68,6 +75,7 @@ func RateLimiterMiddleware(config RateLimiterConfig) gin.HandlerFunc {
 		if count >= limit {
 			log.Printf("SECURITY: Rate limit exceeded for %s. Count: %d, Limit: %d, Endpoint: %s %s", 
 				identifier, count, limit, c.Request.Method, c.Request.URL.Path)
+			telemetry.RateLimitRejections.WithLabelValues(config.Name).Inc()
 			
 			c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", config.RequestsPerWindow))
 			c.Header("X-RateLimit-Remaining", "0")
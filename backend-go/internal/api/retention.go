@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// GetRetentionReport returns a dry run of the retention sweep for the caller's organization
+func GetRetentionReport(retention *services.RetentionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		report, err := retention.Report(c.Request.Context(), orgID.(string))
+		if err != nil {
+			log.Printf("RETENTION: dry run for %s failed: %v", orgID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build retention report"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetDeletionLog returns recent deletion log entries and whether the hash chain verifies
+func GetDeletionLog(retention *services.RetentionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+		ctx := c.Request.Context()
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		entries, err := retention.DeletionLog(ctx, orgID.(string), limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read deletion log"})
+			return
+		}
+
+		verification := gin.H{"valid": true}
+		verified, err := retention.VerifyDeletionLog(ctx, orgID.(string))
+		if errors.Is(err, services.ErrDeletionLogTampered) {
+			verification = gin.H{"valid": false, "error": err.Error()}
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify deletion log"})
+			return
+		}
+		verification["verified_entries"] = verified
+
+		c.JSON(http.StatusOK, gin.H{"count": len(entries), "results": entries, "verification": verification})
+	}
+}
+
+// CreateLegalHold places a hold on a response or on every response for a patient
+func CreateLegalHold(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+
+		var request struct {
+			ResponseID  string `json:"response_id"`
+			PatientName string `json:"patient_name"`
+			Reason      string `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if (request.ResponseID == "") == (request.PatientName == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "specify exactly one of response_id or patient_name"})
+			return
+		}
+
+		hold := data.LegalHold{
+			OrganizationID: orgID.(string),
+			ResponseID:     request.ResponseID,
+			PatientName:    request.PatientName,
+			Reason:         request.Reason,
+			Active:         true,
+			CreatedBy:      userID.(string),
+			CreatedAt:      time.Now().UTC(),
+		}
+		docRef, _, err := client.Collection("legal_holds").Add(c.Request.Context(), hold)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create legal hold"})
+			return
+		}
+		hold.ID = docRef.ID
+
+		c.JSON(http.StatusCreated, hold)
+	}
+}
+
+// ListLegalHolds lists the organization's legal holds, including released ones
+func ListLegalHolds(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		holds := []data.LegalHold{}
+		iter := client.Collection("legal_holds").Where("organizationId", "==", orgID.(string)).Documents(c.Request.Context())
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list legal holds"})
+				return
+			}
+
+			var hold data.LegalHold
+			if err := doc.DataTo(&hold); err != nil {
+				log.Printf("Failed to parse legal hold %s: %v", doc.Ref.ID, err)
+				continue
+			}
+			hold.ID = doc.Ref.ID
+			holds = append(holds, hold)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"count": len(holds), "results": holds})
+	}
+}
+
+// ReleaseLegalHold releases a hold. The record is kept for the audit trail.
+func ReleaseLegalHold(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID := c.Param("id")
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+		ctx := c.Request.Context()
+
+		ref := client.Collection("legal_holds").Doc(holdID)
+		doc, err := ref.Get(ctx)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "legal hold not found"})
+			return
+		}
+		var hold data.LegalHold
+		if err := doc.DataTo(&hold); err != nil || hold.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "legal hold not found"})
+			return
+		}
+		if !hold.Active {
+			c.JSON(http.StatusConflict, gin.H{"error": "legal hold already released"})
+			return
+		}
+
+		_, err = ref.Update(ctx, []firestore.Update{
+			{Path: "active", Value: false},
+			{Path: "released_by", Value: userID.(string)},
+			{Path: "released_at", Value: time.Now().UTC()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to release legal hold"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "legal hold released", "id": holdID})
+	}
+}
@@ -3,12 +3,12 @@ package api
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"log"
 	"net/http"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"backend-go/internal/data"
+	"backend-go/internal/services"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/api/iterator"
@@ -33,23 +33,15 @@ func CreateShareLink(client *firestore.Client) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
 			return
 		}
-		
-		// Log organization IDs for debugging
-		log.Printf("DEBUG ShareLink: Form OrganizationID: %s, User OrganizationID: %v", form.OrganizationID, orgID)
-		
-		// Check if form has no organization ID (legacy form) and allow access
-		if form.OrganizationID == "" {
-			log.Printf("WARNING ShareLink: Form has no OrganizationID, assigning user's org: %s", orgID.(string))
-			// Update the form with the current user's organization ID
-			_, err := client.Collection("forms").Doc(formID).Update(c.Request.Context(), []firestore.Update{
-				{Path: "organizationId", Value: orgID.(string)},
-			})
-			if err != nil {
-				log.Printf("ERROR ShareLink: Failed to update form organization ID: %v", err)
-			}
-			form.OrganizationID = orgID.(string)
-		} else if form.OrganizationID != orgID.(string) {
-			log.Printf("ERROR ShareLink: Permission denied. Form org: %s, User org: %s", form.OrganizationID, orgID.(string))
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return
+		}
+
+		// Forms without an organization are assigned one by migration 0001
+		if form.OrganizationID != orgID.(string) {
+			requestLog(c).Warn("share link denied: form belongs to another organization",
+				"form_id", formID, "form_organization_id", form.OrganizationID, "organization_id", orgID)
 			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to create share links for this form"})
 			return
 		}
@@ -59,12 +51,20 @@ func CreateShareLink(client *firestore.Client) gin.HandlerFunc {
 			MaxResponses    int    `json:"max_responses,omitempty"`
 			RequirePassword bool   `json:"require_password"`
 			Password        string `json:"password,omitempty"`
+			RecipientEmail  string `json:"recipient_email,omitempty"`
+			RecipientPhone  string `json:"recipient_phone,omitempty"`
+			ReminderSchedule *data.ReminderSchedule `json:"reminder_schedule,omitempty"`
 		}
 		if err := c.ShouldBindJSON(&shareLinkRequest); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		if err := services.ValidateReminderSchedule(shareLinkRequest.ReminderSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Generate a secure random token
 		tokenBytes := make([]byte, 32)
 		if _, err := rand.Read(tokenBytes); err != nil {
@@ -97,6 +97,9 @@ func CreateShareLink(client *firestore.Client) gin.HandlerFunc {
 			CreatedAt:      time.Now().UTC(),
 			MaxResponses:   shareLinkRequest.MaxResponses,
 			PasswordHash:   hashedPassword, // Store the hashed password
+			RecipientEmail: shareLinkRequest.RecipientEmail,
+			RecipientPhone: shareLinkRequest.RecipientPhone,
+			ReminderSchedule: shareLinkRequest.ReminderSchedule,
 		}
 
 		// Set expiration if specified
@@ -127,6 +130,9 @@ func CreateShareLink(client *firestore.Client) gin.HandlerFunc {
 		if shareLink.MaxResponses > 0 {
 			response["max_responses"] = shareLink.MaxResponses
 		}
+		if shareLink.ReminderSchedule != nil {
+			response["reminder_schedule"] = shareLink.ReminderSchedule
+		}
 		c.JSON(http.StatusCreated, response)
 	}
 }
@@ -149,11 +155,12 @@ func ListShareLinks(client *firestore.Client) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
 			return
 		}
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return
+		}
 		
-		// Check if form has no organization ID (legacy form) and allow access
-		if form.OrganizationID == "" {
-			log.Printf("WARNING ListShareLinks: Form has no OrganizationID, allowing access for user org: %s", orgID.(string))
-		} else if form.OrganizationID != orgID.(string) {
+		if form.OrganizationID != orgID.(string) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to view share links for this form"})
 			return
 		}
@@ -194,6 +201,9 @@ func ListShareLinks(client *firestore.Client) gin.HandlerFunc {
 			if link.MaxResponses > 0 {
 				linkResponse["max_responses"] = link.MaxResponses
 			}
+			if link.ReminderSchedule != nil {
+				linkResponse["reminder_schedule"] = link.ReminderSchedule
+			}
 			links = append(links, linkResponse)
 		}
 
@@ -220,6 +230,10 @@ func DeleteShareLink(client *firestore.Client) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
 			return
 		}
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "form not found"})
+			return
+		}
 		
 		if form.OrganizationID != orgID.(string) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to delete share links for this form"})
@@ -253,6 +267,59 @@ func DeleteShareLink(client *firestore.Client) gin.HandlerFunc {
 	}
 }
 
+// ListShareLinkReminders lists the reminder audit trail for a share link.
+func ListShareLinkReminders(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		formID := c.Param("id")
+		linkID := c.Param("linkId")
+		orgID, _ := c.Get("organizationID")
+
+		linkDoc, err := client.Collection("share_links").Doc(linkID).Get(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+			return
+		}
+
+		var shareLink data.ShareLink
+		if err := linkDoc.DataTo(&shareLink); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse share link data"})
+			return
+		}
+
+		if shareLink.FormID != formID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "share link not found for this form"})
+			return
+		}
+		if shareLink.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "you do not have permission to view reminders for this share link"})
+			return
+		}
+
+		reminders := []data.ReminderLog{}
+		iter := client.Collection("reminder_logs").Where("share_link_id", "==", linkID).Documents(c.Request.Context())
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list reminders"})
+				return
+			}
+
+			var reminder data.ReminderLog
+			if err := doc.DataTo(&reminder); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse reminder data"})
+				return
+			}
+			reminder.ID = doc.Ref.ID
+			reminders = append(reminders, reminder)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"count": len(reminders), "results": reminders})
+	}
+}
+
 // GetFormByShareToken retrieves a form using a share token (public endpoint).
 func GetFormByShareToken(client *firestore.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -312,6 +379,10 @@ func GetFormByShareToken(client *firestore.Client) gin.HandlerFunc {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse form data"})
 			return
 		}
+		if form.DeletedAt != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Form not found"})
+			return
+		}
 		form.ID = formDoc.Ref.ID
 		c.JSON(http.StatusOK, form)
 	}
@@ -0,0 +1,222 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+type amendmentFixture struct {
+	client    *firestore.Client
+	encryptor *services.FieldEncryptor
+	pdf       *services.PDFOrchestrator
+	converter *capturingConverter
+	router    *gin.Engine
+}
+
+// capturingConverter keeps the HTML handed to it instead of rendering a PDF
+type capturingConverter struct{ html string }
+
+func (c *capturingConverter) ConvertHTMLToPDF(ctx context.Context, htmlContent string) ([]byte, error) {
+	c.html = htmlContent
+	return []byte("%PDF-1.4"), nil
+}
+
+func (c *capturingConverter) GetServiceHealth(ctx context.Context) error { return nil }
+
+// newAmendmentFixture serves the amendment routes for organization org-1 against the
+// in-memory Firestore, with one sealed response on a two-question form
+func newAmendmentFixture(t *testing.T) *amendmentFixture {
+	t.Helper()
+	ctx := context.Background()
+	env := newTestEnv(t)
+	client, encryptor := env.client, env.encryptor
+	attachments := services.NewAttachmentService(client, env.store, nil, env.encryptor)
+	accessLog := services.NewPHIAccessLog(client, encryptor)
+	amendments := services.NewAmendmentService(client, env.events, encryptor, attachments)
+	converter := &capturingConverter{}
+	pdf, err := services.NewPDFOrchestrator(client, converter, attachments, encryptor)
+	if err != nil {
+		t.Fatalf("pdf orchestrator: %v", err)
+	}
+
+	_, err = client.Collection("forms").Doc("form-1").Set(ctx, map[string]interface{}{
+		"title":          "Intake",
+		"organizationId": "org-1",
+		"surveyJson": map[string]interface{}{
+			"elements": []interface{}{
+				map[string]interface{}{"type": "text", "name": "first_name", "title": "First name"},
+				map[string]interface{}{"type": "text", "name": "last_name", "title": "Last name"},
+				map[string]interface{}{"type": "text", "name": "allergies", "title": "Allergies"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("seed form: %v", err)
+	}
+	sealed, err := encryptor.SealResponse(ctx, "response-1", data.FormResponse{
+		OrganizationID: "org-1",
+		FormID:         "form-1",
+		Data:           map[string]interface{}{"first_name": "Jon", "last_name": "Smyth"},
+		PatientName:    "Jon Smyth",
+		SubmittedBy:    "patient",
+		SubmittedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("seal response: %v", err)
+	}
+	if _, err := client.Collection("form_responses").Doc("response-1").Set(ctx, sealed); err != nil {
+		t.Fatalf("seed response: %v", err)
+	}
+
+	r, authed := newTestRouter()
+	authed.GET("/responses/:id", api.GetFormResponse(client, encryptor, accessLog))
+	authed.POST("/responses/:id/amendments", api.AmendFormResponse(client, amendments, attachments, accessLog))
+	authed.GET("/responses/:id/revisions", api.ListResponseRevisions(client, encryptor, accessLog))
+
+	return &amendmentFixture{client: client, encryptor: encryptor, pdf: pdf, converter: converter, router: r}
+}
+
+func (f *amendmentFixture) amend(t *testing.T, org string, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/responses/response-1/amendments", bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Org", org)
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (f *amendmentFixture) get(t *testing.T, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Org", "org-1")
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAmendmentKeepsOriginalValuesInRevisionHistory(t *testing.T) {
+	f := newAmendmentFixture(t)
+	ctx := context.Background()
+
+	rec := f.amend(t, "org-1", map[string]interface{}{
+		"changes":      map[string]interface{}{"first_name": "John", "last_name": "Smyth", "allergies": "Penicillin"},
+		"reason":       "Patient called to correct the spelling of their name",
+		"requested_by": "patient",
+		"approved_by":  "Dr. Alvarez",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("amend: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = f.amend(t, "org-1", map[string]interface{}{
+		"changes": map[string]interface{}{"allergies": nil},
+		"reason":  "Allergy was recorded against the wrong patient",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("second amend: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = f.get(t, "/api/responses/response-1")
+	var current data.FormResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if current.Data["first_name"] != "John" || current.Data["allergies"] != nil || current.PatientName != "John Smyth" {
+		t.Fatalf("answers not amended: %+v (patient %q)", current.Data, current.PatientName)
+	}
+	if current.Revision != 2 || current.AmendedAt == nil {
+		t.Fatalf("expected revision 2 with amended_at, got %d %v", current.Revision, current.AmendedAt)
+	}
+
+	rec = f.get(t, "/api/responses/response-1/revisions")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revisions: %d %s", rec.Code, rec.Body.String())
+	}
+	var history struct {
+		Results []data.ResponseRevision `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatalf("decode revisions: %v", err)
+	}
+	if len(history.Results) != 2 {
+		t.Fatalf("expected 2 revisions, got %+v", history.Results)
+	}
+	first := history.Results[0]
+	// The approver is the signed-in user, not the approved_by the client sent
+	if first.AuthorID != "clinician-1" || first.ApprovedBy != "clinician-1" || first.RequestedBy != "patient" {
+		t.Fatalf("unexpected revision attribution: %+v", first)
+	}
+	// last_name was sent unchanged and is left out
+	if len(first.Changes) != 2 || first.Changes[0].Field != "allergies" || first.Changes[0].OldValue != nil ||
+		first.Changes[1].Field != "first_name" || first.Changes[1].OldValue != "Jon" || first.Changes[1].NewValue != "John" {
+		t.Fatalf("unexpected changes: %+v", first.Changes)
+	}
+	if second := history.Results[1]; second.ApprovedBy != "clinician-1" || second.Changes[0].NewValue != nil {
+		t.Fatalf("unexpected second revision: %+v", second)
+	}
+
+	// The history is sealed with the rest of the response's PHI
+	doc, err := f.client.Collection("form_responses").Doc("response-1").Get(ctx)
+	if err != nil {
+		t.Fatalf("get response: %v", err)
+	}
+	raw, _ := json.Marshal(doc.Data())
+	if strings.Contains(string(raw), "Jon") || strings.Contains(string(raw), "Penicillin") {
+		t.Fatalf("plaintext PHI stored with the revision history: %s", raw)
+	}
+
+	if _, err := f.pdf.GeneratePDF(ctx, "response-1", "clinician-1"); err != nil {
+		t.Fatalf("generate pdf: %v", err)
+	}
+	html := f.converter.html
+	for _, want := range []string{"Amended", "Amendment 1", "Jon", "John", "clinician-1", "Patient called to correct", "Amendment 2", "Penicillin"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("PDF annex is missing %q", want)
+		}
+	}
+	if strings.Contains(html, "Dr. Alvarez") {
+		t.Error("PDF annex shows the client-supplied approver")
+	}
+}
+
+func TestAmendmentValidation(t *testing.T) {
+	f := newAmendmentFixture(t)
+
+	cases := []struct {
+		name string
+		org  string
+		body map[string]interface{}
+		code int
+	}{
+		{"missing reason", "org-1", map[string]interface{}{"changes": map[string]interface{}{"first_name": "John"}}, http.StatusBadRequest},
+		{"no effective change", "org-1", map[string]interface{}{"changes": map[string]interface{}{"first_name": "Jon"}, "reason": "typo"}, http.StatusUnprocessableEntity},
+		{"unknown question", "org-1", map[string]interface{}{"changes": map[string]interface{}{"favorite_color": "blue"}, "reason": "typo"}, http.StatusUnprocessableEntity},
+		{"other organization", "org-2", map[string]interface{}{"changes": map[string]interface{}{"first_name": "John"}, "reason": "typo"}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := f.amend(t, tc.org, tc.body); rec.Code != tc.code {
+				t.Fatalf("expected %d, got %d %s", tc.code, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := f.get(t, "/api/responses/response-1/revisions")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"count":0`) {
+		t.Fatalf("rejected amendments must not be recorded: %d %s", rec.Code, rec.Body.String())
+	}
+}
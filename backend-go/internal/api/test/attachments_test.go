@@ -0,0 +1,204 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// onePixelPNG is a valid 1x1 PNG
+const onePixelPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
+
+// newAttachmentRouter serves response submission, amendment and attachment download for
+// organization org-1, with form-1 asking for a signature
+func newAttachmentRouter(t *testing.T) (*gin.Engine, *testEnv) {
+	t.Helper()
+	env := newTestEnv(t)
+	attachments := services.NewAttachmentService(env.client, env.store, services.NewUploadSanitizer(nil), env.encryptor)
+	accessLog := services.NewPHIAccessLog(env.client, env.encryptor)
+	amendments := services.NewAmendmentService(env.client, env.events, env.encryptor, attachments)
+	duplicates := services.NewDuplicateService(env.client, env.events, env.encryptor, 72*time.Hour, 0.5)
+
+	_, err := env.client.Collection("forms").Doc("form-1").Set(context.Background(), map[string]interface{}{
+		"title":          "Consent",
+		"organizationId": "org-1",
+		"surveyJson": map[string]interface{}{
+			"elements": []interface{}{
+				map[string]interface{}{"type": "text", "name": "first_name", "title": "First name"},
+				map[string]interface{}{"type": "signaturepad", "name": "signature", "title": "Signature"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("seed form: %v", err)
+	}
+
+	r, authed := newTestRouter()
+	authed.POST("/responses", api.CreateFormResponse(env.client, env.events, attachments, env.encryptor, duplicates))
+	authed.POST("/responses/:id/amendments", api.AmendFormResponse(env.client, amendments, attachments, accessLog))
+	authed.GET("/attachments/:id", api.DownloadAttachment(attachments))
+	return r, env
+}
+
+// storedBlobs returns the contents of every blob in the local store
+func storedBlobs(t *testing.T, env *testEnv) map[string][]byte {
+	t.Helper()
+	blobs := map[string][]byte{}
+	err := filepath.Walk(filepath.Join(env.dir, "blobs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		blobs[path] = content
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walk blob store: %v", err)
+	}
+	return blobs
+}
+
+func TestAttachmentsAreEncryptedAtRest(t *testing.T) {
+	r, env := newAttachmentRouter(t)
+	png, _ := base64.StdEncoding.DecodeString(onePixelPNG)
+
+	responseID, _ := submit(t, r, map[string]interface{}{"first_name": "Ada", "signature": "data:image/png;base64," + onePixelPNG})
+	docs, err := env.client.Collection("attachments").Where("response_id", "==", responseID).Documents(context.Background()).GetAll()
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("expected one attachment record, got %d (%v)", len(docs), err)
+	}
+	var record data.Attachment
+	if err := docs[0].DataTo(&record); err != nil {
+		t.Fatalf("decode attachment: %v", err)
+	}
+	if !record.Encrypted || strings.Contains(record.StorageKey, record.SHA256) {
+		t.Fatalf("attachment record: encrypted %v, storage key %q", record.Encrypted, record.StorageKey)
+	}
+
+	blobs := storedBlobs(t, env)
+	if len(blobs) != 1 {
+		t.Fatalf("expected one blob, got %d", len(blobs))
+	}
+	for path, content := range blobs {
+		if bytes.Contains(content, []byte("PNG")) || bytes.Contains(content, png[16:]) {
+			t.Fatalf("blob %s is stored in plaintext", path)
+		}
+	}
+
+	rec := duplicatesRequest(t, r, http.MethodGet, "/api/attachments/"+docs[0].Ref.ID, nil)
+	if rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte("\x89PNG")) {
+		t.Fatalf("download: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFailedAmendmentReleasesUploadedBlobs(t *testing.T) {
+	r, env := newAttachmentRouter(t)
+	responseID, _ := submit(t, r, map[string]interface{}{"first_name": "Ada"})
+
+	// The upload succeeds but the amendment is rejected: "scan" is not a question on the form
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/responses/"+responseID+"/amendments", map[string]interface{}{
+		"changes": map[string]interface{}{"scan": "data:image/png;base64," + onePixelPNG},
+		"reason":  "Patient sent their signature by email",
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d %s", rec.Code, rec.Body.String())
+	}
+	if blobs := storedBlobs(t, env); len(blobs) != 0 {
+		t.Fatalf("rejected amendment left %d blobs behind", len(blobs))
+	}
+
+	// A blob that a saved attachment points at is kept
+	submit(t, r, map[string]interface{}{"first_name": "Ada", "signature": "data:image/png;base64," + onePixelPNG})
+	rec = duplicatesRequest(t, r, http.MethodPost, "/api/responses/"+responseID+"/amendments", map[string]interface{}{
+		"changes": map[string]interface{}{"scan": "data:image/png;base64," + onePixelPNG},
+		"reason":  "Patient sent their signature by email",
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d %s", rec.Code, rec.Body.String())
+	}
+	if blobs := storedBlobs(t, env); len(blobs) != 1 {
+		t.Fatalf("expected the shared blob to be kept, got %d blobs", len(blobs))
+	}
+}
+
+func TestUnsupportedPhotoIsRejectedPerAttachment(t *testing.T) {
+	r, env := newAttachmentRouter(t)
+	heic := base64.StdEncoding.EncodeToString(append([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), make([]byte, 64)...))
+
+	// A patient submission keeps its other answers and reports the rejected photo
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/responses", map[string]interface{}{
+		"form":          "form-1",
+		"response_data": map[string]interface{}{"first_name": "Ada", "signature": "data:image/heic;base64," + heic},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID                  string                         `json:"id"`
+		Data                map[string]interface{}         `json:"response_data"`
+		RejectedAttachments []services.AttachmentRejection `json:"rejected_attachments"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(created.RejectedAttachments) != 1 || created.RejectedAttachments[0].Field != "signature" ||
+		!strings.Contains(created.RejectedAttachments[0].Reason, "JPEG or PNG") {
+		t.Fatalf("rejected attachments: %+v", created.RejectedAttachments)
+	}
+	if created.Data["first_name"] != "Ada" || created.Data["signature"] != nil {
+		t.Fatalf("answers: %v", created.Data)
+	}
+	if blobs := storedBlobs(t, env); len(blobs) != 0 {
+		t.Fatalf("rejected photo was stored: %d blobs", len(blobs))
+	}
+
+	// An amendment is all or nothing
+	rec = duplicatesRequest(t, r, http.MethodPost, "/api/responses/"+created.ID+"/amendments", map[string]interface{}{
+		"changes": map[string]interface{}{"signature": "data:image/heic;base64," + heic},
+		"reason":  "Patient sent their signature by email",
+	})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"signature"`) {
+		t.Fatalf("amendment: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAttachmentOfTrashedResponseIsHidden(t *testing.T) {
+	ctx := context.Background()
+	r, env := newAttachmentRouter(t)
+	retention := services.NewRetentionService(env.client, nil, env.store, nil, nil, nil)
+	trash := services.NewTrashService(env.client, nil, env.events, retention, nil, 30*24*time.Hour)
+
+	responseID, _ := submit(t, r, map[string]interface{}{"first_name": "Ada", "signature": "data:image/png;base64," + onePixelPNG})
+	docs, err := env.client.Collection("attachments").Where("response_id", "==", responseID).Documents(ctx).GetAll()
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("expected one attachment record, got %d (%v)", len(docs), err)
+	}
+	download := "/api/attachments/" + docs[0].Ref.ID
+
+	if err := trash.DeleteResponse(ctx, "org-1", "clinician-1", responseID); err != nil {
+		t.Fatalf("delete response: %v", err)
+	}
+	if rec := duplicatesRequest(t, r, http.MethodGet, download, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("download of a trashed response's attachment: %d", rec.Code)
+	}
+
+	if err := trash.Restore(ctx, "org-1", "clinician-1", services.TrashResponse, responseID); err != nil {
+		t.Fatalf("restore response: %v", err)
+	}
+	if rec := duplicatesRequest(t, r, http.MethodGet, download, nil); rec.Code != http.StatusOK {
+		t.Fatalf("download after restore: %d", rec.Code)
+	}
+}
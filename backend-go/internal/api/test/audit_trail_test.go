@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/services"
+)
+
+// flakySink fails its writes while failing is set
+type flakySink struct {
+	mu      sync.Mutex
+	failing bool
+	records []services.AuditRecord
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Write(ctx context.Context, records []services.AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func (s *flakySink) setFailing(failing bool) {
+	s.mu.Lock()
+	s.failing = failing
+	s.mu.Unlock()
+}
+
+func TestAuditHealthRecoversAfterAFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	sink := &flakySink{failing: true}
+	trail := services.NewAuditTrail(sink)
+	defer trail.Close()
+
+	entry := services.AuditEntry{UserID: "clinician-1", Action: "VIEW", ResourceType: "form_response", ResourceID: "r1", Success: true}
+	if err := trail.LogAccessSync(ctx, entry); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	details, err := trail.Health(ctx)
+	if err == nil || details["last_failure"] == nil {
+		t.Fatalf("health after a failed write: %v %v", details, err)
+	}
+
+	sink.setFailing(false)
+	if err := trail.LogAccessSync(ctx, entry); err != nil {
+		t.Fatalf("write after recovery: %v", err)
+	}
+	if _, err := trail.Health(ctx); err != nil {
+		t.Fatalf("health still failing after a successful write: %v", err)
+	}
+}
+
+func TestVerifyAuditRecordsDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	sink := &flakySink{}
+	trail := services.NewAuditTrail(sink)
+	for _, action := range []string{"LOGIN", "VIEW", "AMEND", "EXPORT", "LOGOUT"} {
+		trail.LogAccess(ctx, services.AuditEntry{UserID: "clinician-1", Action: action, ResourceType: "form_response", ResourceID: "r1", Success: true})
+	}
+	if err := trail.Close(); err != nil || len(sink.records) != 5 {
+		t.Fatalf("close: %v, %d records written", err, len(sink.records))
+	}
+
+	from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	chainID := sink.records[0].ChainID
+	heads := map[string]services.AuditRecord{chainID: sink.records[len(sink.records)-1]}
+	verify := func(edit func(records []services.AuditRecord) []services.AuditRecord) *services.AuditVerification {
+		records := edit(append([]services.AuditRecord{}, sink.records...))
+		return services.VerifyAuditRecords(records, heads, from, to)
+	}
+
+	if result := verify(func(r []services.AuditRecord) []services.AuditRecord { return r }); !result.Valid || result.Records != 5 || result.Chains != 1 {
+		t.Fatalf("intact chain: %+v", result)
+	}
+	for name, tc := range map[string]struct {
+		edit func(records []services.AuditRecord) []services.AuditRecord
+		want string
+	}{
+		"tampered": {func(r []services.AuditRecord) []services.AuditRecord {
+			r[2].Action = "VIEW"
+			return r
+		}, "#3: contents do not match hash"},
+		"reordered": {func(r []services.AuditRecord) []services.AuditRecord {
+			r[1].Sequence, r[2].Sequence = r[2].Sequence, r[1].Sequence
+			return r
+		}, "does not link to"},
+		"deleted": {func(r []services.AuditRecord) []services.AuditRecord {
+			return append(r[:2], r[3:]...)
+		}, "record #3 is missing"},
+		"truncated": {func(r []services.AuditRecord) []services.AuditRecord {
+			return r[:4]
+		}, "chain ends at #4 but head is #5"},
+	} {
+		result := verify(tc.edit)
+		if result.Valid || !strings.Contains(strings.Join(result.Problems, "\n"), tc.want) {
+			t.Errorf("%s: %+v, want a problem containing %q", name, result, tc.want)
+		}
+	}
+}
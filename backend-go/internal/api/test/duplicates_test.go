@@ -0,0 +1,241 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// newDuplicatesRouter serves response submission and the duplicate review queue for
+// organization org-1 against the in-memory Firestore
+func newDuplicatesRouter(t *testing.T) (*gin.Engine, *firestore.Client) {
+	t.Helper()
+	env := newTestEnv(t)
+	attachments := services.NewAttachmentService(env.client, env.store, nil, env.encryptor)
+	accessLog := services.NewPHIAccessLog(env.client, env.encryptor)
+	duplicates := services.NewDuplicateService(env.client, env.events, env.encryptor, 72*time.Hour, 0.5)
+	amendments := services.NewAmendmentService(env.client, env.events, env.encryptor, attachments)
+
+	r, authed := newTestRouter()
+	authed.POST("/responses", api.CreateFormResponse(env.client, env.events, attachments, env.encryptor, duplicates))
+	authed.GET("/responses", api.ListFormResponses(env.client, env.encryptor, accessLog))
+	authed.POST("/responses/:id/amendments", api.AmendFormResponse(env.client, amendments, attachments, accessLog))
+	authed.GET("/duplicates", api.ListDuplicates(duplicates))
+	authed.POST("/duplicates/:id/merge", api.MergeDuplicate(duplicates, accessLog))
+	authed.POST("/duplicates/:id/dismiss", api.DismissDuplicate(duplicates))
+	return r, env.client
+}
+
+func duplicatesRequest(t *testing.T, r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// submit posts a response to form-1 and returns its ID and duplicate flag
+func submit(t *testing.T, r *gin.Engine, answers map[string]interface{}) (string, map[string]interface{}) {
+	t.Helper()
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/responses", map[string]interface{}{"form": "form-1", "response_data": answers})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		ID        string                 `json:"id"`
+		Duplicate map[string]interface{} `json:"duplicate"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return created.ID, created.Duplicate
+}
+
+func intake(name, dob, phone, allergies string) map[string]interface{} {
+	return map[string]interface{}{
+		"patient_name":  name,
+		"date_of_birth": dob,
+		"phone":         phone,
+		"allergies":     allergies,
+		"medication":    "Metformin 500mg",
+		"reason":        "Annual checkup",
+	}
+}
+
+func TestDuplicateSubmissionsAreFlaggedAndMerged(t *testing.T) {
+	r, _ := newDuplicatesRouter(t)
+
+	originalID, flag := submit(t, r, intake("Dana Whitfield", "1984-02-11", "(555) 201-3344", "None"))
+	if flag != nil {
+		t.Fatalf("first submission was flagged: %v", flag)
+	}
+	// Same patient with different spacing, case and phone formatting, one changed answer
+	duplicateID, flag := submit(t, r, intake("dana  whitfield", "1984-02-11", "555.201.3344", "Penicillin"))
+	if flag == nil || flag["of"] != originalID || flag["status"] != services.DuplicatePending {
+		t.Fatalf("resubmission was not flagged as a duplicate of %s: %v", originalID, flag)
+	}
+	// Another patient with the same answers, and the same patient with different answers
+	if _, flag := submit(t, r, intake("Sam Ortega", "1990-07-30", "555-777-1212", "None")); flag != nil {
+		t.Fatalf("another patient was flagged: %v", flag)
+	}
+	if _, flag := submit(t, r, map[string]interface{}{"patient_name": "Dana Whitfield", "date_of_birth": "1984-02-11", "visit": "follow-up", "pain": 4}); flag != nil {
+		t.Fatalf("a different form fill by the same patient was flagged: %v", flag)
+	}
+
+	rec := duplicatesRequest(t, r, http.MethodGet, "/api/duplicates", nil)
+	var queue struct {
+		Count   int                      `json:"count"`
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &queue); err != nil || queue.Count != 1 || queue.Results[0]["response_id"] != duplicateID {
+		t.Fatalf("expected the duplicate in the review queue, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+duplicateID+"/merge", map[string]interface{}{
+		"fields": map[string]string{"allergies": "sideways"},
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unknown side, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+duplicateID+"/merge", map[string]interface{}{
+		"fields": map[string]string{"allergies": "original"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("merge: %d %s", rec.Code, rec.Body.String())
+	}
+	var merged struct {
+		ID         string                 `json:"id"`
+		Data       map[string]interface{} `json:"response_data"`
+		MergedFrom []string               `json:"merged_from"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &merged); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if merged.Data["allergies"] != "None" || merged.Data["patient_name"] != "dana  whitfield" {
+		t.Fatalf("merged answers did not follow the choices: %v", merged.Data)
+	}
+	if len(merged.MergedFrom) != 2 || merged.MergedFrom[0] != originalID || merged.MergedFrom[1] != duplicateID {
+		t.Fatalf("merged_from = %v", merged.MergedFrom)
+	}
+
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+duplicateID+"/merge", map[string]interface{}{}); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 merging twice, got %d", rec.Code)
+	}
+	rec = duplicatesRequest(t, r, http.MethodGet, "/api/duplicates", nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &queue); err != nil || queue.Count != 0 {
+		t.Fatalf("expected an empty review queue after merging, got %s", rec.Body.String())
+	}
+
+	// The originals are kept but hidden from the response list by default
+	for query, want := range map[string]int{"": 3, "?include_merged=true": 5} {
+		rec = duplicatesRequest(t, r, http.MethodGet, "/api/responses"+query, nil)
+		var list struct {
+			Results []map[string]interface{} `json:"results"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Results) != want {
+			t.Fatalf("GET /api/responses%s: expected %d responses, got %s", query, want, rec.Body.String())
+		}
+		if query != "" {
+			continue
+		}
+		for _, response := range list.Results {
+			if response["id"] == originalID || response["id"] == duplicateID {
+				t.Fatalf("merged response %v is still listed", response["id"])
+			}
+		}
+	}
+}
+
+func TestDismissDuplicate(t *testing.T) {
+	r, client := newDuplicatesRouter(t)
+
+	originalID, _ := submit(t, r, intake("Lee Park", "1975-09-02", "", "None"))
+	duplicateID, flag := submit(t, r, intake("Lee Park", "1975-09-02", "", "None"))
+	if flag == nil {
+		t.Fatal("identical resubmission was not flagged")
+	}
+
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+originalID+"/dismiss", nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 dismissing an unflagged response, got %d", rec.Code)
+	}
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/missing/dismiss", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+duplicateID+"/dismiss", nil); rec.Code != http.StatusOK {
+		t.Fatalf("dismiss: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/duplicates/"+duplicateID+"/dismiss", nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 dismissing twice, got %d", rec.Code)
+	}
+
+	doc, err := client.Collection("form_responses").Doc(duplicateID).Get(context.Background())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if status, _ := doc.DataAt("duplicate.status"); status != services.DuplicateDismissed {
+		t.Fatalf("duplicate.status = %v", status)
+	}
+	if _, err := doc.DataAt("merged_into"); err == nil {
+		t.Fatal("a dismissed duplicate was merged")
+	}
+}
+
+func TestAmendmentUpdatesIdentityKeys(t *testing.T) {
+	r, client := newDuplicatesRouter(t)
+	identityKeys := func(id string) []interface{} {
+		t.Helper()
+		doc, err := client.Collection("form_responses").Doc(id).Get(context.Background())
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		keys, _ := doc.DataAt("identity_keys")
+		list, _ := keys.([]interface{})
+		return list
+	}
+
+	danaID, _ := submit(t, r, intake("Dana Whitfield", "1984-02-11", "(555) 201-3344", "None"))
+	// Entered under the wrong patient, then corrected
+	wrongID, _ := submit(t, r, intake("Sam Ortega", "1990-07-30", "555-777-1212", "None"))
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/responses/"+wrongID+"/amendments", map[string]interface{}{
+		"changes": map[string]interface{}{"patient_name": "Dana Whitfield", "date_of_birth": "1984-02-11", "phone": "555 201 3344"},
+		"reason":  "Entered under the wrong patient",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("amend: %d %s", rec.Code, rec.Body.String())
+	}
+	want, got := identityKeys(danaID), identityKeys(wrongID)
+	if len(want) != 3 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("identity keys after the amendment: %v, want %v", got, want)
+	}
+
+	// Removing the identifying answers clears the keys
+	rec = duplicatesRequest(t, r, http.MethodPost, "/api/responses/"+wrongID+"/amendments", map[string]interface{}{
+		"changes": map[string]interface{}{"date_of_birth": nil, "phone": nil},
+		"reason":  "Unverified details",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("amend: %d %s", rec.Code, rec.Body.String())
+	}
+	if keys := identityKeys(wrongID); len(keys) != 0 {
+		t.Fatalf("identity keys were kept: %v", keys)
+	}
+}
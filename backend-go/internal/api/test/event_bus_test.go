@@ -0,0 +1,213 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+)
+
+// countingSubscriber records every delivery. It fails the first failures deliveries, or
+// every one when failures is negative.
+type countingSubscriber struct {
+	mu       sync.Mutex
+	failures int
+	calls    map[string]int
+}
+
+func (s *countingSubscriber) handle(ctx context.Context, event *data.DomainEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == nil {
+		s.calls = map[string]int{}
+	}
+	s.calls[event.ID]++
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("subscriber unavailable")
+	}
+	return nil
+}
+
+func (s *countingSubscriber) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, calls := range s.calls {
+		n += calls
+	}
+	return n
+}
+
+// outboxEvent reads the single outbox event of a type
+func outboxEvent(t *testing.T, client *firestore.Client, eventType string) data.DomainEvent {
+	t.Helper()
+	docs, err := client.Collection("outbox").Where("type", "==", eventType).Documents(context.Background()).GetAll()
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("outbox %s: %d events, %v", eventType, len(docs), err)
+	}
+	var event data.DomainEvent
+	if err := docs[0].DataTo(&event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	event.ID = docs[0].Ref.ID
+	return event
+}
+
+func emitFormUpdated(t *testing.T, bus *services.EventBus, formID string) {
+	t.Helper()
+	event := services.NewDomainEvent(services.DomainFormUpdated, "org-1", "form", formID, "clinician-1", nil)
+	if err := bus.Emit(context.Background(), event); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+}
+
+func TestEventRetryOnlyRepeatsTheFailedSubscriber(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	bus := services.NewEventBus(env.client, newTestRedis(t))
+	cache := &countingSubscriber{}
+	webhooks := &countingSubscriber{failures: 1}
+	bus.Subscribe("cache", []string{services.DomainFormUpdated}, cache.handle)
+	bus.Subscribe("webhooks", []string{services.DomainFormUpdated}, webhooks.handle)
+	emitFormUpdated(t, bus, "form-1")
+
+	if err := bus.RunOnce(ctx); err != nil {
+		t.Fatalf("first sweep: %v", err)
+	}
+	event := outboxEvent(t, env.client, services.DomainFormUpdated)
+	if event.Status != "pending" || event.Attempts != 1 || event.LastError == "" || !event.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("after a failed delivery: %+v", event)
+	}
+
+	// The retry waits out its backoff
+	if err := bus.RunOnce(ctx); err != nil || webhooks.total() != 1 {
+		t.Fatalf("event redelivered before its backoff elapsed: %d calls, %v", webhooks.total(), err)
+	}
+	backdate(t, env.client, "outbox", "type", services.DomainFormUpdated, "next_attempt_at", time.Minute)
+	if err := bus.RunOnce(ctx); err != nil {
+		t.Fatalf("retry sweep: %v", err)
+	}
+	if cache.total() != 1 || webhooks.total() != 2 {
+		t.Fatalf("deliveries: cache %d, webhooks %d; want 1 and 2", cache.total(), webhooks.total())
+	}
+	if event = outboxEvent(t, env.client, services.DomainFormUpdated); event.Status != "dispatched" || event.Attempts != 2 || event.DispatchedAt == nil {
+		t.Fatalf("after the retry: %+v", event)
+	}
+
+	if err := bus.RunOnce(ctx); err != nil || cache.total() != 1 || webhooks.total() != 2 {
+		t.Fatalf("dispatched event was delivered again: %d %d %v", cache.total(), webhooks.total(), err)
+	}
+}
+
+func TestEventFailsAfterItsLastAttempt(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	bus := services.NewEventBus(env.client, newTestRedis(t))
+	broken := &countingSubscriber{failures: -1}
+	bus.Subscribe("broken", []string{services.DomainFormUpdated}, broken.handle)
+	emitFormUpdated(t, bus, "form-1")
+
+	const maxAttempts = 10
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if err := bus.RunOnce(ctx); err != nil {
+			t.Fatalf("sweep %d: %v", attempt, err)
+		}
+		event := outboxEvent(t, env.client, services.DomainFormUpdated)
+		if event.Attempts != attempt {
+			t.Fatalf("sweep %d recorded %d attempts", attempt, event.Attempts)
+		}
+		if want := attempt == maxAttempts; (event.Status == "failed") != want {
+			t.Fatalf("status %q after attempt %d", event.Status, attempt)
+		}
+		backdate(t, env.client, "outbox", "type", services.DomainFormUpdated, "next_attempt_at", time.Minute)
+	}
+
+	if err := bus.RunOnce(ctx); err != nil || broken.total() != maxAttempts {
+		t.Fatalf("failed event was retried: %d calls, %v", broken.total(), err)
+	}
+}
+
+func TestRacingDispatchersDeliverEachEventOnce(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	rdb := newTestRedis(t)
+
+	// Two instances share the outbox and Redis, each with its own copy of the subscriber
+	subscriber := &countingSubscriber{}
+	slow := func(ctx context.Context, event *data.DomainEvent) error {
+		time.Sleep(time.Millisecond)
+		return subscriber.handle(ctx, event)
+	}
+	instances := []*services.EventBus{services.NewEventBus(env.client, rdb), services.NewEventBus(env.client, rdb)}
+	for _, bus := range instances {
+		bus.Subscribe("audit", []string{services.DomainFormUpdated}, slow)
+	}
+	const events = 20
+	for i := 0; i < events; i++ {
+		emitFormUpdated(t, instances[0], "form-1")
+	}
+
+	var wg sync.WaitGroup
+	for _, bus := range instances {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(bus *services.EventBus) {
+				defer wg.Done()
+				if err := bus.RunOnce(ctx); err != nil {
+					t.Errorf("sweep: %v", err)
+				}
+			}(bus)
+		}
+	}
+	wg.Wait()
+
+	if len(subscriber.calls) != events {
+		t.Fatalf("%d of %d events delivered", len(subscriber.calls), events)
+	}
+	for id, calls := range subscriber.calls {
+		if calls != 1 {
+			t.Errorf("event %s delivered %d times", id, calls)
+		}
+	}
+	docs, err := env.client.Collection("outbox").Where("status", "==", "dispatched").Documents(ctx).GetAll()
+	if err != nil || len(docs) != events {
+		t.Fatalf("%d events marked dispatched, %v", len(docs), err)
+	}
+}
+
+func TestPurgeDispatchedKeepsUndeliveredEvents(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	bus := services.NewEventBus(env.client, newTestRedis(t))
+	broken := &countingSubscriber{failures: -1}
+	bus.Subscribe("cache", []string{services.DomainFormUpdated}, (&countingSubscriber{}).handle)
+	bus.Subscribe("broken", []string{services.DomainFormDeleted}, broken.handle)
+	emitFormUpdated(t, bus, "form-1")
+	if err := bus.Emit(ctx, services.NewDomainEvent(services.DomainFormDeleted, "org-1", "form", "form-2", "clinician-1", nil)); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	if err := bus.RunOnce(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+
+	if n, err := bus.PurgeDispatched(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("purged %d events dispatched after the cutoff: %v", n, err)
+	}
+	if n, err := bus.PurgeDispatched(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("purge: %d %v", n, err)
+	}
+	docs, err := env.client.Collection("outbox").Documents(ctx).GetAll()
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("%d events left, %v", len(docs), err)
+	}
+	if event := outboxEvent(t, env.client, services.DomainFormDeleted); event.Status != "pending" {
+		t.Fatalf("undelivered event: %+v", event)
+	}
+}
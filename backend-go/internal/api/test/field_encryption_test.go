@@ -0,0 +1,150 @@
+package api_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"backend-go/internal/services"
+)
+
+// reopen builds a fresh encryptor, with no cached key rings, on env's Firestore and keyfile
+func reopen(t *testing.T, env *testEnv) *services.FieldEncryptor {
+	t.Helper()
+	keys, err := services.NewLocalKeyProvider(filepath.Join(env.dir, "keys.json"), false)
+	if err != nil {
+		t.Fatalf("reopen keyfile: %v", err)
+	}
+	return services.NewFieldEncryptor(env.client, keys)
+}
+
+func TestEnvelopeEncryptionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	sealed, err := env.encryptor.Seal(ctx, "org-1", "form_responses/r1/allergies", []byte("penicillin"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "v1:") || strings.Contains(sealed, "penicillin") {
+		t.Fatalf("sealed value %q", sealed)
+	}
+	blob, err := env.encryptor.SealBlob(ctx, "org-1", "attachments/a1", []byte("%PDF-1.4 scan"))
+	if err != nil {
+		t.Fatalf("seal blob: %v", err)
+	}
+
+	// A new instance unwraps the data key through the KEK and opens both
+	encryptor := reopen(t, env)
+	if plain, err := encryptor.Open(ctx, "org-1", "form_responses/r1/allergies", sealed); err != nil || string(plain) != "penicillin" {
+		t.Fatalf("open: %q %v", plain, err)
+	}
+	if plain, err := encryptor.OpenBlob(ctx, "org-1", "attachments/a1", blob); err != nil || string(plain) != "%PDF-1.4 scan" {
+		t.Fatalf("open blob: %q %v", plain, err)
+	}
+
+	// The ciphertext is bound to its organization and field
+	if _, err := encryptor.Open(ctx, "org-1", "form_responses/r2/allergies", sealed); !errors.Is(err, services.ErrDecryptionFailed) {
+		t.Fatalf("open with another aad: %v", err)
+	}
+	if _, err := encryptor.Open(ctx, "org-2", "form_responses/r1/allergies", sealed); !errors.Is(err, services.ErrDecryptionFailed) {
+		t.Fatalf("open as another organization: %v", err)
+	}
+
+	// Values sealed before a data key rotation still open; new values use the new version
+	if _, err := encryptor.RotateKeyRing(ctx, "org-1", true); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	encryptor = reopen(t, env)
+	if plain, err := encryptor.Open(ctx, "org-1", "form_responses/r1/allergies", sealed); err != nil || string(plain) != "penicillin" {
+		t.Fatalf("open after rotation: %q %v", plain, err)
+	}
+	if resealed, err := encryptor.Seal(ctx, "org-1", "form_responses/r1/allergies", []byte("penicillin")); err != nil || !strings.HasPrefix(resealed, "v2:") {
+		t.Fatalf("seal after rotation: %q %v", resealed, err)
+	}
+}
+
+func TestKEKMismatchFailsToDecrypt(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	sealed, err := env.encryptor.Seal(ctx, "org-1", "form_responses/r1/allergies", []byte("penicillin"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	// Another keyfile names its KEK local-1 too, but the key differs
+	other, err := services.NewLocalKeyProvider(filepath.Join(t.TempDir(), "keys.json"), true)
+	if err != nil {
+		t.Fatalf("other keyfile: %v", err)
+	}
+	_, err = services.NewFieldEncryptor(env.client, other).Open(ctx, "org-1", "form_responses/r1/allergies", sealed)
+	if !errors.Is(err, services.ErrDecryptionFailed) || !strings.Contains(err.Error(), "unwrap") {
+		t.Fatalf("expected the data key unwrap to fail, got %v", err)
+	}
+
+	// A KEK rotation keeps the old KEK, so existing wraps still open
+	if _, err := env.keys.Rotate(); err != nil {
+		t.Fatalf("rotate KEK: %v", err)
+	}
+	if plain, err := reopen(t, env).Open(ctx, "org-1", "form_responses/r1/allergies", sealed); err != nil || string(plain) != "penicillin" {
+		t.Fatalf("open after KEK rotation: %q %v", plain, err)
+	}
+}
+
+func TestLocalKEKIsOnlyGeneratedWhenAllowed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "kek.json")
+	if _, err := services.NewLocalKeyProvider(path, false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected a missing keyfile to be an error, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("keyfile was created: %v", err)
+	}
+
+	if _, err := services.NewLocalKeyProvider(path, true); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := services.NewLocalKeyProvider(path, false); err != nil {
+		t.Fatalf("load generated keyfile: %v", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	index := func(encryptor *services.FieldEncryptor, orgID, value string) string {
+		t.Helper()
+		digest, err := encryptor.BlindIndex(ctx, orgID, value)
+		if err != nil {
+			t.Fatalf("blind index: %v", err)
+		}
+		return digest
+	}
+
+	first := index(env.encryptor, "org-1", "ada lovelace|1815-12-10")
+	if index(env.encryptor, "org-1", "ada lovelace|1815-12-10") != first {
+		t.Fatal("blind index is not deterministic")
+	}
+	if index(env.encryptor, "org-1", "ada lovelace|1815-12-11") == first {
+		t.Fatal("different values share a blind index")
+	}
+	if index(env.encryptor, "org-2", "ada lovelace|1815-12-10") == first {
+		t.Fatal("organizations share a blind index")
+	}
+	plain := sha256.Sum256([]byte("ada lovelace|1815-12-10"))
+	if first == hex.EncodeToString(plain[:]) {
+		t.Fatal("blind index is an unkeyed hash")
+	}
+
+	// Stored indexes stay queryable after a new data key version is issued
+	if _, err := env.encryptor.RotateKeyRing(ctx, "org-1", true); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if index(reopen(t, env), "org-1", "ada lovelace|1815-12-10") != first {
+		t.Fatal("blind index changed after data key rotation")
+	}
+}
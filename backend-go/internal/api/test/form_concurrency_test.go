@@ -0,0 +1,286 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// newFormConcurrencyRouter serves the form and lease routes for organization org-1 against
+// the in-memory Firestore and Redis, with one seeded form. The caller is taken from X-User.
+func newFormConcurrencyRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	r, _, _ := newFormConcurrencyEnv(t)
+	return r
+}
+
+func newFormConcurrencyEnv(t *testing.T) (*gin.Engine, *testEnv, *redis.Client) {
+	t.Helper()
+	env := newTestEnv(t)
+	rdb := newTestRedis(t)
+	retention := services.NewRetentionService(env.client, nil, nil, services.NewAttachmentService(env.client, nil, nil, env.encryptor), nil, nil)
+	trash := services.NewTrashService(env.client, nil, env.events, retention, nil, 30*24*time.Hour)
+	locks := services.NewLockManager(rdb)
+
+	now := time.Now().UTC()
+	_, err := env.client.Collection("forms").Doc("form-1").Set(context.Background(), data.Form{
+		Title:          "Intake",
+		OrganizationID: "org-1",
+		Version:        1,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		t.Fatalf("seed form: %v", err)
+	}
+
+	r, authed := newTestRouter()
+	authed.GET("/forms/:id", api.GetForm(env.client, rdb))
+	authed.PATCH("/forms/:id", api.UpdateForm(env.client, rdb, env.events))
+	authed.DELETE("/forms/:id", api.DeleteForm(trash))
+	authed.GET("/forms/:id/lease", api.GetFormLease(env.client, locks))
+	authed.POST("/forms/:id/lease", api.AcquireFormLease(env.client, locks))
+	authed.POST("/forms/:id/lease/heartbeat", api.RenewFormLease(env.client, locks))
+	authed.DELETE("/forms/:id/lease", api.ReleaseFormLease(env.client, locks))
+	return r, env, rdb
+}
+
+func serveForm(r *gin.Engine, method, path, user string, headers map[string]string, body interface{}) *httptest.ResponseRecorder {
+	var raw []byte
+	if body != nil {
+		raw, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConcurrentFormEditsConflict(t *testing.T) {
+	r := newFormConcurrencyRouter(t)
+
+	rec := serveForm(r, http.MethodGet, "/api/forms/form-1", "alice", nil, nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("get form: %d etag %q", rec.Code, etag)
+	}
+
+	rec = serveForm(r, http.MethodPatch, "/api/forms/form-1", "alice", nil, map[string]interface{}{"title": "No precondition"})
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without If-Match, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Alice saves first; the server-managed fields in her body are ignored
+	rec = serveForm(r, http.MethodPatch, "/api/forms/form-1", "alice", map[string]string{"If-Match": etag},
+		map[string]interface{}{"title": "Intake v2", "version": 40, "organizationId": "org-2"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first update: %d %s", rec.Code, rec.Body.String())
+	}
+	var saved data.Form
+	json.Unmarshal(rec.Body.Bytes(), &saved)
+	newETag := rec.Header().Get("ETag")
+	if saved.Version != 2 || saved.OrganizationID != "org-1" || saved.Title != "Intake v2" || newETag == etag {
+		t.Fatalf("unexpected saved form %+v (etag %q)", saved, newETag)
+	}
+
+	// Bob still has the old copy open
+	rec = serveForm(r, http.MethodPatch, "/api/forms/form-1", "bob", map[string]string{"If-Match": etag},
+		map[string]interface{}{"title": "Bob's intake"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d %s", rec.Code, rec.Body.String())
+	}
+	var conflict struct {
+		Current data.Form `json:"current"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &conflict)
+	if conflict.Current.Title != "Intake v2" || rec.Header().Get("ETag") != newETag {
+		t.Fatalf("412 should carry the current copy, got %+v etag %q", conflict.Current, rec.Header().Get("ETag"))
+	}
+	rec = serveForm(r, http.MethodDelete, "/api/forms/form-1", "bob", map[string]string{"If-Match": etag}, nil)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 deleting with a stale ETag, got %d", rec.Code)
+	}
+
+	// The cached copy was dropped, so a reload hands out the new ETag
+	rec = serveForm(r, http.MethodGet, "/api/forms/form-1", "bob", nil, nil)
+	if rec.Header().Get("ETag") != newETag {
+		t.Fatalf("reload returned ETag %q, want %q", rec.Header().Get("ETag"), newETag)
+	}
+	rec = serveForm(r, http.MethodDelete, "/api/forms/form-1", "bob", map[string]string{"If-Match": newETag}, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestFormEditingLease(t *testing.T) {
+	r := newFormConcurrencyRouter(t)
+
+	rec := serveForm(r, http.MethodPost, "/api/forms/form-1/lease", "alice", nil, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("acquire: %d %s", rec.Code, rec.Body.String())
+	}
+	var lease data.FormLease
+	json.Unmarshal(rec.Body.Bytes(), &lease)
+	if lease.UserID != "alice" || lease.Token == "" {
+		t.Fatalf("unexpected lease %+v", lease)
+	}
+
+	rec = serveForm(r, http.MethodPost, "/api/forms/form-1/lease", "bob", nil, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while alice edits, got %d %s", rec.Code, rec.Body.String())
+	}
+	var held struct {
+		Lease data.FormLease `json:"lease"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &held)
+	if held.Lease.UserID != "alice" || held.Lease.Token != "" {
+		t.Fatalf("409 should name the holder without their token, got %+v", held.Lease)
+	}
+
+	// Bob cannot renew or release alice's lease with her token
+	token := map[string]string{"X-Lease-Token": lease.Token}
+	if rec := serveForm(r, http.MethodPost, "/api/forms/form-1/lease/heartbeat", "bob", token, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 renewing another user's lease, got %d", rec.Code)
+	}
+	serveForm(r, http.MethodDelete, "/api/forms/form-1/lease", "bob", token, nil)
+	if rec := serveForm(r, http.MethodPost, "/api/forms/form-1/lease/heartbeat", "alice", token, nil); rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serveForm(r, http.MethodDelete, "/api/forms/form-1/lease", "alice", token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("release: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = serveForm(r, http.MethodGet, "/api/forms/form-1/lease", "bob", nil, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"lease":null}` {
+		t.Fatalf("expected no holder after release, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveForm(r, http.MethodPost, "/api/forms/form-1/lease/heartbeat", "alice", token, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 renewing a released lease, got %d", rec.Code)
+	}
+	if rec := serveForm(r, http.MethodPost, "/api/forms/form-1/lease", "bob", nil, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("bob acquire after release: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// interleaveHook runs a callback the first time a command with the given name reaches Redis
+type interleaveHook struct {
+	name string
+	once sync.Once
+	fn   func()
+}
+
+func (h *interleaveHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *interleaveHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == h.name {
+			h.once.Do(h.fn)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *interleaveHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestUpdateRespondsWithItsOwnWrite(t *testing.T) {
+	r, env, rdb := newFormConcurrencyEnv(t)
+
+	rec := serveForm(r, http.MethodGet, "/api/forms/form-1", "alice", nil, nil)
+	etag := rec.Header().Get("ETag")
+
+	// Bob saves after alice's transaction commits but before her response is written
+	var bobETag string
+	rdb.AddHook(&interleaveHook{name: "del", fn: func() {
+		ref := env.client.Collection("forms").Doc("form-1")
+		now := time.Now().UTC().Add(time.Second)
+		if _, err := ref.Set(context.Background(), map[string]interface{}{
+			"title": "Bob's intake", "version": 3, "updatedAt": now, "updatedBy": "bob",
+		}, firestore.MergeAll); err != nil {
+			t.Errorf("bob's write: %v", err)
+		}
+		bobETag = services.FormETag(&data.Form{Version: 3, UpdatedAt: now})
+	}})
+
+	rec = serveForm(r, http.MethodPatch, "/api/forms/form-1", "alice", map[string]string{"If-Match": etag},
+		map[string]interface{}{"title": "Alice's intake", "surveyJson": map[string]interface{}{"pages": []string{"p1"}}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("alice's update: %d %s", rec.Code, rec.Body.String())
+	}
+	var saved data.Form
+	json.Unmarshal(rec.Body.Bytes(), &saved)
+	aliceETag := rec.Header().Get("ETag")
+	if saved.Title != "Alice's intake" || saved.Version != 2 || saved.UpdatedBy != "alice" || saved.SurveyJSON["pages"] == nil {
+		t.Fatalf("alice got back %+v", saved)
+	}
+	if aliceETag != services.FormETag(&saved) || aliceETag == bobETag {
+		t.Fatalf("alice's ETag %q names bob's save %q", aliceETag, bobETag)
+	}
+
+	// Her ETag is stale now, so her next save conflicts instead of overwriting bob's
+	rec = serveForm(r, http.MethodPatch, "/api/forms/form-1", "alice", map[string]string{"If-Match": aliceETag},
+		map[string]interface{}{"title": "Alice's intake v2"})
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("ETag") != bobETag {
+		t.Fatalf("save over bob's write: %d etag %q, want 412 with %q", rec.Code, rec.Header().Get("ETag"), bobETag)
+	}
+}
+
+func TestConcurrentEditorsEachGetTheirOwnVersion(t *testing.T) {
+	r := newFormConcurrencyRouter(t)
+	editors := []string{"alice", "bob", "carol", "dave"}
+
+	var mu sync.Mutex
+	versions := map[int]string{}
+	var wg sync.WaitGroup
+	for _, editor := range editors {
+		wg.Add(1)
+		go func(editor string) {
+			defer wg.Done()
+			for attempt := 0; attempt < 50; attempt++ {
+				etag := serveForm(r, http.MethodGet, "/api/forms/form-1", editor, nil, nil).Header().Get("ETag")
+				rec := serveForm(r, http.MethodPatch, "/api/forms/form-1", editor, map[string]string{"If-Match": etag},
+					map[string]interface{}{"title": editor})
+				if rec.Code == http.StatusPreconditionFailed {
+					continue
+				}
+				var saved data.Form
+				json.Unmarshal(rec.Body.Bytes(), &saved)
+				if rec.Code != http.StatusOK || saved.Title != editor || rec.Header().Get("ETag") != services.FormETag(&saved) {
+					t.Errorf("%s: %d %s", editor, rec.Code, rec.Body.String())
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if other, taken := versions[saved.Version]; taken {
+					t.Errorf("%s and %s both saved version %d", other, editor, saved.Version)
+				}
+				versions[saved.Version] = editor
+				return
+			}
+			t.Errorf("%s never saved", editor)
+		}(editor)
+	}
+	wg.Wait()
+	if len(versions) != len(editors) {
+		t.Fatalf("saved versions %v", versions)
+	}
+}
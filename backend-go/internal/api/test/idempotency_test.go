@@ -0,0 +1,112 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// newIdempotencyRouter serves form creation behind the idempotency middleware, plus a route
+// that fails until it has been called failures times. Without Redis the store falls back to
+// Firestore.
+func newIdempotencyRouter(t *testing.T, withRedis bool, failures int) (*gin.Engine, *firestore.Client, *int) {
+	t.Helper()
+	env := newTestEnv(t)
+	var rdb *redis.Client
+	if withRedis {
+		rdb = newTestRedis(t)
+	}
+	idempotency := api.IdempotencyMiddleware(services.NewIdempotencyStore(env.client, rdb, time.Hour))
+
+	r, authed := newTestRouter()
+	authed.POST("/forms", idempotency, api.CreateForm(env.client, env.events))
+	calls := 0
+	authed.POST("/flaky", idempotency, func(c *gin.Context) {
+		calls++
+		if calls <= failures {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "temporarily unavailable"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+	return r, env.client, &calls
+}
+
+func postWithKey(r *gin.Engine, path, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotentFormCreation(t *testing.T) {
+	for _, backend := range []struct {
+		name      string
+		withRedis bool
+	}{{"redis", true}, {"firestore fallback", false}} {
+		t.Run(backend.name, func(t *testing.T) {
+			r, client, _ := newIdempotencyRouter(t, backend.withRedis, 0)
+			body := `{"title":"Intake"}`
+
+			first := postWithKey(r, "/api/forms", "clinician-1", "key-1", body)
+			if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatalf("first request: %d %s", first.Code, first.Body.String())
+			}
+			retry := postWithKey(r, "/api/forms", "clinician-1", "key-1", body)
+			if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+				t.Fatalf("retry was not replayed: %d %v", retry.Code, retry.Header())
+			}
+			if retry.Body.String() != first.Body.String() || retry.Header().Get("ETag") != first.Header().Get("ETag") {
+				t.Fatalf("replay differs from the first response:\n%s\n%s", first.Body.String(), retry.Body.String())
+			}
+
+			if rec := postWithKey(r, "/api/forms", "clinician-1", "key-1", `{"title":"Other"}`); rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected 422 reusing the key for another payload, got %d %s", rec.Code, rec.Body.String())
+			}
+			// Keys belong to the user who sent them
+			if rec := postWithKey(r, "/api/forms", "clinician-2", "key-1", body); rec.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatalf("another user's key was replayed: %d", rec.Code)
+			}
+			postWithKey(r, "/api/forms", "clinician-1", "", body)
+
+			docs, err := client.Collection("forms").Documents(context.Background()).GetAll()
+			if err != nil {
+				t.Fatalf("list forms: %v", err)
+			}
+			if len(docs) != 3 {
+				t.Fatalf("expected 3 forms (one per key and user, one without a key), got %d", len(docs))
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyIsReleasedAfterServerError(t *testing.T) {
+	r, _, calls := newIdempotencyRouter(t, true, 1)
+
+	if rec := postWithKey(r, "/api/flaky", "clinician-1", "key-1", `{}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the first call to fail, got %d", rec.Code)
+	}
+	rec := postWithKey(r, "/api/flaky", "clinician-1", "key-1", `{}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("retry after a server error should run again, got %d %v", rec.Code, rec.Header())
+	}
+	rec = postWithKey(r, "/api/flaky", "clinician-1", "key-1", `{}`)
+	if rec.Header().Get("Idempotent-Replayed") != "true" || *calls != 2 {
+		t.Fatalf("expected the success to be replayed after 2 calls, got %d calls", *calls)
+	}
+}
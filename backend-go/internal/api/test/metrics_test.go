@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend-go/internal/api"
+	"backend-go/internal/config"
+	"backend-go/internal/telemetry"
+
+	"github.com/gin-gonic/gin"
+)
+
+func scrape(t *testing.T, token config.Secret, authorization string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", api.MetricsHandler(token))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMetricsEndpointExposesPipelineMetrics(t *testing.T) {
+	telemetry.RenderErrors.WithLabelValues("RNDR-TIMEOUT").Inc()
+	telemetry.PDFSectionDuration.WithLabelValues("patient_vitals").Observe(0.02)
+	telemetry.RateLimitRejections.WithLabelValues("auth").Inc()
+
+	w := scrape(t, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	for _, series := range []string{
+		`forms_pdf_render_errors_total{code="RNDR-TIMEOUT"}`,
+		`forms_pdf_section_render_seconds_bucket{section="patient_vitals"`,
+		`forms_http_rate_limit_rejections_total{limiter="auth"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(w.Body.String(), series) {
+			t.Errorf("expected %s in scrape output", series)
+		}
+	}
+}
+
+func TestMetricsEndpointRequiresTokenWhenConfigured(t *testing.T) {
+	const token = config.Secret("scrape-secret")
+
+	if w := scrape(t, token, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", w.Code)
+	}
+	if w := scrape(t, token, "Bearer wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with wrong token, got %d", w.Code)
+	}
+	if w := scrape(t, token, "Bearer scrape-secret"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with token, got %d", w.Code)
+	}
+}
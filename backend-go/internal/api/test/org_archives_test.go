@@ -0,0 +1,364 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/scrypt"
+)
+
+type archiveFixture struct {
+	client    *firestore.Client
+	store     services.BlobStore
+	encryptor *services.FieldEncryptor
+	archives  *services.OrgArchiveService
+	router    *gin.Engine
+}
+
+// newArchiveFixture serves the archive routes against the in-memory Firestore. The
+// X-Org header picks the caller's organization.
+func newArchiveFixture(t *testing.T) *archiveFixture {
+	t.Helper()
+	env := newTestEnv(t)
+	archives := services.NewOrgArchiveService(env.client, nil, env.store, env.encryptor, services.NewUploadSanitizer(nil), nil)
+
+	r, authed := newTestRouter()
+	authed.POST("/org-archives/backup", api.CreateOrgBackup(archives))
+	authed.POST("/org-archives/restore", api.CreateOrgRestore(archives))
+	authed.GET("/org-archives/:id", api.GetOrgArchiveJob(archives))
+	authed.GET("/org-archives/:id/download", api.DownloadOrgBackup(archives))
+
+	return &archiveFixture{client: env.client, store: env.store, encryptor: env.encryptor, archives: archives, router: r}
+}
+
+func (f *archiveFixture) do(t *testing.T, org string, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	req.Header.Set("X-Org", org)
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// seed creates an organization with a form, a password-protected share link and a sealed
+// response whose signature is an attachment
+func (f *archiveFixture) seed(t *testing.T, orgID string) {
+	t.Helper()
+	png, _ := base64.StdEncoding.DecodeString(onePixelPNG)
+	f.seedWithSignature(t, orgID, png)
+}
+
+// seedWithSignature is seed with the signature's stored bytes, which skip the sanitizer
+func (f *archiveFixture) seedWithSignature(t *testing.T, orgID string, signature []byte) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	set := func(collection, id string, value interface{}) {
+		if _, err := f.client.Collection(collection).Doc(id).Set(ctx, value); err != nil {
+			t.Fatalf("seed %s/%s: %v", collection, id, err)
+		}
+	}
+
+	set("organizations", orgID, data.Organization{UID: orgID, Name: "Juniper Clinic", CreatedAt: now, UpdatedAt: now})
+	set("forms", "form-1", data.Form{Title: "Intake", OrganizationID: orgID, Version: 3, CreatedAt: now})
+	set("share_links", "link-1", data.ShareLink{FormID: "form-1", ShareToken: "token-1", IsActive: true, OrganizationID: orgID, PasswordHash: "$2a$10$hash", CreatedAt: now})
+
+	sum := sha256.Sum256(signature)
+	record := data.Attachment{
+		OrganizationID: orgID, FormID: "form-1", ResponseID: "resp-1", FieldName: "signature",
+		ContentType: "image/png", Size: int64(len(signature)), SHA256: hex.EncodeToString(sum[:]),
+		StorageKey: orgID + "/" + hex.EncodeToString(sum[:]), CreatedAt: now,
+	}
+	if err := f.store.Put(ctx, record.StorageKey, record.ContentType, signature); err != nil {
+		t.Fatalf("put blob: %v", err)
+	}
+	set("attachments", "att-1", record)
+
+	response, err := f.encryptor.SealResponse(ctx, "resp-1", data.FormResponse{
+		OrganizationID: orgID,
+		FormID:         "form-1",
+		Data:           map[string]interface{}{"first_name": "Ada", "signature": services.AttachmentRefPrefix + "att-1"},
+		PatientName:    "Ada Lovelace",
+		SubmittedAt:    now,
+	})
+	if err != nil {
+		t.Fatalf("seal response: %v", err)
+	}
+	set("form_responses", "resp-1", response)
+}
+
+func (f *archiveFixture) backup(t *testing.T, orgID, passphrase string) []byte {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"passphrase": passphrase})
+	w := f.do(t, orgID, httptest.NewRequest(http.MethodPost, "/api/org-archives/backup", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("backup: %d %s", w.Code, w.Body)
+	}
+	var queued struct{ Job data.OrgArchiveJob }
+	json.Unmarshal(w.Body.Bytes(), &queued)
+
+	if w := f.do(t, orgID, httptest.NewRequest(http.MethodGet, "/api/org-archives/"+queued.Job.ID+"/download", nil)); w.Code != http.StatusConflict {
+		t.Fatalf("download before the backup ran: %d", w.Code)
+	}
+	if err := f.archives.Process(context.Background(), queued.Job.ID); err != nil {
+		t.Fatalf("process backup: %v", err)
+	}
+	w = f.do(t, orgID, httptest.NewRequest(http.MethodGet, "/api/org-archives/"+queued.Job.ID+"/download", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: %d %s", w.Code, w.Body)
+	}
+	return w.Body.Bytes()
+}
+
+func (f *archiveFixture) restore(t *testing.T, orgID string, archive []byte, fields map[string]string) (*httptest.ResponseRecorder, *data.OrgArchiveJob) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("archive", "backup.zip")
+	part.Write(archive)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/org-archives/restore", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := f.do(t, orgID, req)
+	if w.Code != http.StatusAccepted {
+		return w, nil
+	}
+
+	var queued struct{ Job data.OrgArchiveJob }
+	json.Unmarshal(w.Body.Bytes(), &queued)
+	if err := f.archives.Process(context.Background(), queued.Job.ID); err != nil {
+		t.Fatalf("process restore: %v", err)
+	}
+	job, err := f.archives.Get(context.Background(), orgID, queued.Job.ID)
+	if err != nil {
+		t.Fatalf("get restore job: %v", err)
+	}
+	return w, job
+}
+
+func (f *archiveFixture) orgDocs(t *testing.T, collection, orgID string) []*firestore.DocumentSnapshot {
+	t.Helper()
+	docs, err := f.client.Collection(collection).Where("organizationId", "==", orgID).Documents(context.Background()).GetAll()
+	if err != nil {
+		t.Fatalf("list %s: %v", collection, err)
+	}
+	return docs
+}
+
+func TestOrgBackupRestoresIntoAnotherOrganization(t *testing.T) {
+	ctx := context.Background()
+	f := newArchiveFixture(t)
+	f.seed(t, "org-1")
+	archive := f.backup(t, "org-1", "correct horse battery staple")
+	if !services.IsEncryptedOrgArchive(archive) {
+		t.Fatalf("backup with a passphrase is not encrypted")
+	}
+
+	if w, _ := f.restore(t, "org-2", archive, map[string]string{"passphrase": "wrong"}); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("restore with a wrong passphrase: %d %s", w.Code, w.Body)
+	}
+
+	_, job := f.restore(t, "org-2", archive, map[string]string{"passphrase": "correct horse battery staple", "dry_run": "true"})
+	if job.Status != services.ArchiveCompleted || job.Counts["responses"] != 1 || job.Counts["attachments"] != 1 {
+		t.Fatalf("dry run: %+v", job)
+	}
+	if docs := f.orgDocs(t, "forms", "org-2"); len(docs) != 0 {
+		t.Fatalf("dry run created %d forms", len(docs))
+	}
+
+	_, job = f.restore(t, "org-2", archive, map[string]string{"passphrase": "correct horse battery staple"})
+	if job.Status != services.ArchiveCompleted || job.SourceOrganizationID != "org-1" {
+		t.Fatalf("restore: %+v", job)
+	}
+	if len(job.Warnings) != 1 {
+		t.Errorf("restore warnings %v, want one for the share token in use", job.Warnings)
+	}
+
+	forms := f.orgDocs(t, "forms", "org-2")
+	if len(forms) != 1 || forms[0].Ref.ID == "form-1" || forms[0].Data()["version"] != int64(3) {
+		t.Fatalf("restored forms: %d", len(forms))
+	}
+	newFormID := forms[0].Ref.ID
+
+	links := f.orgDocs(t, "share_links", "org-2")
+	if len(links) != 1 || links[0].Data()["form_id"] != newFormID || links[0].Data()["share_token"] == "token-1" || links[0].Data()["password_hash"] != "$2a$10$hash" {
+		t.Fatalf("restored share link: %v", links)
+	}
+
+	responses := f.orgDocs(t, "form_responses", "org-2")
+	if len(responses) != 1 {
+		t.Fatalf("restored %d responses", len(responses))
+	}
+	if _, ok := responses[0].Data()["response_data"]; ok {
+		t.Errorf("restored response stores answers in plaintext")
+	}
+	response, err := f.encryptor.OpenResponse(ctx, responses[0])
+	if err != nil {
+		t.Fatalf("open restored response: %v", err)
+	}
+	if response.FormID != newFormID || response.Data["first_name"] != "Ada" || response.PatientName != "Ada Lovelace" {
+		t.Fatalf("restored response: %+v", response)
+	}
+
+	ref, _ := response.Data["signature"].(string)
+	attachments := services.NewAttachmentService(f.client, f.store, services.NewUploadSanitizer(nil), f.encryptor)
+	record, content, err := attachments.Open(ctx, "org-2", services.AttachmentRefID(ref))
+	if err != nil {
+		t.Fatalf("open restored attachment %q: %v", ref, err)
+	}
+	if record.ResponseID != responses[0].Ref.ID || !bytes.HasPrefix(content, []byte("\x89PNG")) || record.Sanitization == nil {
+		t.Fatalf("restored attachment: %+v", record)
+	}
+
+	// The source organization is untouched
+	if docs := f.orgDocs(t, "form_responses", "org-1"); len(docs) != 1 || docs[0].Ref.ID != "resp-1" {
+		t.Fatalf("source responses changed")
+	}
+}
+
+func TestOrgRestoreRejectsDamagedArchive(t *testing.T) {
+	f := newArchiveFixture(t)
+	f.seed(t, "org-1")
+	archive := unsealOrgArchive(t, f.backup(t, "org-1", "correct horse battery staple"), "correct horse battery staple")
+
+	// Alter a form and keep the manifest, as a hand-edited archive would
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range zr.File {
+		rc, _ := file.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if file.Name == "forms.json" {
+			content = bytes.Replace(content, []byte("Intake"), []byte("Intakf"), 1)
+		}
+		w, _ := zw.Create(file.Name)
+		w.Write(content)
+	}
+	zw.Close()
+	damaged := buf.Bytes()
+
+	if w, _ := f.restore(t, "org-2", damaged, nil); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("restore of a damaged archive: %d %s", w.Code, w.Body)
+	}
+	if docs := f.orgDocs(t, "forms", "org-2"); len(docs) != 0 {
+		t.Fatalf("damaged archive created %d forms", len(docs))
+	}
+}
+
+func TestOrgArchiveJobsAreScopedToTheirOrganization(t *testing.T) {
+	f := newArchiveFixture(t)
+	f.seed(t, "org-1")
+	body := bytes.NewReader([]byte(`{"passphrase":"correct horse battery staple"}`))
+	w := f.do(t, "org-1", httptest.NewRequest(http.MethodPost, "/api/org-archives/backup", body))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("backup: %d %s", w.Code, w.Body)
+	}
+	var queued struct{ Job data.OrgArchiveJob }
+	json.Unmarshal(w.Body.Bytes(), &queued)
+
+	for _, path := range []string{"/api/org-archives/" + queued.Job.ID, "/api/org-archives/" + queued.Job.ID + "/download"} {
+		if w := f.do(t, "org-2", httptest.NewRequest(http.MethodGet, path, nil)); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s from another organization: %d", path, w.Code)
+		}
+	}
+}
+
+// unsealOrgArchive opens a passphrase-sealed archive: "HFORGARC" || 16-byte salt || nonce ||
+// AES-GCM(zip) under a scrypt key (N=2^15, r=8, p=1), with the header as additional data.
+// Decoding it here pins the format, which backups already handed out depend on.
+func unsealOrgArchive(t *testing.T, sealed []byte, passphrase string) []byte {
+	t.Helper()
+	const magic, saltSize = "HFORGARC", 16
+	if !bytes.HasPrefix(sealed, []byte(magic)) {
+		t.Fatalf("archive is not sealed")
+	}
+	key, err := scrypt.Key([]byte(passphrase), sealed[len(magic):len(magic)+saltSize], 1<<15, 8, 1, 32)
+	if err != nil {
+		t.Fatalf("derive key: %v", err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	headerEnd := len(magic) + saltSize + gcm.NonceSize()
+	plaintext, err := gcm.Open(nil, sealed[len(magic)+saltSize:headerEnd], sealed[headerEnd:], sealed[:headerEnd])
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	return plaintext
+}
+
+func TestOrgBackupRequiresPassphrase(t *testing.T) {
+	f := newArchiveFixture(t)
+	f.seed(t, "org-1")
+	for _, body := range []string{"", `{"passphrase":""}`, `{"passphrase":"short"}`} {
+		w := f.do(t, "org-1", httptest.NewRequest(http.MethodPost, "/api/org-archives/backup", bytes.NewReader([]byte(body))))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("backup with body %q: %d %s", body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestOrgRestoreSealsTheUploadAndSanitizesFiles(t *testing.T) {
+	ctx := context.Background()
+	f := newArchiveFixture(t)
+	png, _ := base64.StdEncoding.DecodeString(onePixelPNG)
+	// The signature was stored before uploads were sanitized and carries a script after the image
+	f.seedWithSignature(t, "org-1", append(png, []byte("<?php system($_GET['c']); ?>")...))
+	archive := unsealOrgArchive(t, f.backup(t, "org-1", "correct horse battery staple"), "correct horse battery staple")
+
+	// A plaintext archive is sealed with the organization's key while it waits for the worker
+	job, err := f.archives.RequestRestore(ctx, "org-2", "clinician-1", archive, "", false)
+	if err != nil {
+		t.Fatalf("request restore: %v", err)
+	}
+	doc, err := f.client.Collection("org_archive_jobs").Doc(job.ID).Get(ctx)
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	key, _ := doc.Data()["storage_key"].(string)
+	stored, err := f.store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get upload: %v", err)
+	}
+	if bytes.Contains(stored, []byte("PK\x03\x04")) || bytes.Contains(stored, []byte("Ada")) {
+		t.Fatal("uploaded archive is stored in plaintext")
+	}
+
+	if err := f.archives.Process(ctx, job.ID); !errors.Is(err, services.ErrInvalidArchive) {
+		t.Fatalf("expected the restore to reject the attachment, got %v", err)
+	}
+	if job, _ = f.archives.Get(ctx, "org-2", job.ID); job.Status != services.ArchiveFailed || !strings.Contains(job.Error, "att-1") {
+		t.Fatalf("restore job: %+v", job)
+	}
+	for _, collection := range []string{"forms", "form_responses", "attachments"} {
+		if docs := f.orgDocs(t, collection, "org-2"); len(docs) != 0 {
+			t.Fatalf("rejected restore created %d %s", len(docs), collection)
+		}
+	}
+}
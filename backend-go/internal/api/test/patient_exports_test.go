@@ -0,0 +1,100 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newExportRouter adds the export routes to the attachment router, with a response from
+// Ada that has a signature
+func newExportRouter(t *testing.T) (*gin.Engine, *testEnv, *services.PatientExportService, string) {
+	t.Helper()
+	r, env := newAttachmentRouter(t)
+	attachments := services.NewAttachmentService(env.client, env.store, services.NewUploadSanitizer(nil), env.encryptor)
+	accessLog := services.NewPHIAccessLog(env.client, env.encryptor)
+	exports, err := services.NewPatientExportService(env.client, nil, env.store, attachments, env.encryptor, &capturingConverter{}, accessLog, nil)
+	if err != nil {
+		t.Fatalf("export service: %v", err)
+	}
+	r.POST("/api/exports", func(c *gin.Context) {
+		c.Set("userID", "clinician-1")
+		c.Set("organizationID", "org-1")
+		api.CreatePatientExport(exports)(c)
+	})
+	r.POST("/api/exports/:id/download", api.DownloadPatientExport(exports))
+
+	responseID, _ := submit(t, r, map[string]interface{}{"first_name": "Ada", "signature": "data:image/png;base64," + onePixelPNG})
+	return r, env, exports, responseID
+}
+
+func TestPatientExportArchiveIsEncryptedAndDownloadedOnce(t *testing.T) {
+	ctx := context.Background()
+	r, env, exports, responseID := newExportRouter(t)
+
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/exports", map[string]interface{}{
+		"response_ids": []string{responseID},
+		"recipient":    "Ada Lovelace (patient)",
+	})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("request export: %d %s", rec.Code, rec.Body.String())
+	}
+	var queued struct {
+		Export        data.PatientExport `json:"export"`
+		DownloadURL   string             `json:"download_url"`
+		DownloadToken string             `json:"download_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &queued); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if queued.DownloadToken == "" || bytes.Contains([]byte(queued.DownloadURL), []byte(queued.DownloadToken)) {
+		t.Fatalf("the token must be returned separately from the URL: %+v", queued)
+	}
+
+	exports.RunOnce(ctx)
+	job, err := exports.Get(ctx, "org-1", queued.Export.ID)
+	if err != nil || job.Status != services.ExportReady || !job.Encrypted {
+		t.Fatalf("export job: %+v %v", job, err)
+	}
+	stored, err := env.store.Get(ctx, job.StorageKey)
+	if err != nil {
+		t.Fatalf("get archive: %v", err)
+	}
+	if bytes.Contains(stored, []byte("PK\x03\x04")) || bytes.Contains(stored, []byte("response.json")) {
+		t.Fatal("export archive is stored in plaintext")
+	}
+
+	// The token is only accepted in the body
+	if rec := duplicatesRequest(t, r, http.MethodPost, queued.DownloadURL+"?token="+queued.DownloadToken, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("token in the query string: %d", rec.Code)
+	}
+	if rec := duplicatesRequest(t, r, http.MethodPost, queued.DownloadURL, map[string]string{"token": "guess"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("wrong token: %d", rec.Code)
+	}
+
+	rec = duplicatesRequest(t, r, http.MethodPost, queued.DownloadURL, map[string]string{"token": queued.DownloadToken})
+	if rec.Code != http.StatusOK || !bytes.HasPrefix(rec.Body.Bytes(), []byte("PK\x03\x04")) {
+		t.Fatalf("download: %d", rec.Code)
+	}
+	sum := sha256.Sum256(rec.Body.Bytes())
+	if digest := rec.Header().Get("Digest"); digest != "sha-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("Digest header %q", digest)
+	}
+
+	if rec := duplicatesRequest(t, r, http.MethodPost, queued.DownloadURL, map[string]string{"token": queued.DownloadToken}); rec.Code != http.StatusGone {
+		t.Fatalf("second download: %d", rec.Code)
+	}
+	if _, err := env.store.Get(ctx, job.StorageKey); err == nil {
+		t.Fatal("archive was kept after its download")
+	}
+}
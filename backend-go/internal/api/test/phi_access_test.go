@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAccessLogRouter(t *testing.T) (*gin.Engine, *testEnv) {
+	t.Helper()
+	env := newTestEnv(t)
+	attachments := services.NewAttachmentService(env.client, env.store, nil, env.encryptor)
+	accessLog := services.NewPHIAccessLog(env.client, env.encryptor)
+	duplicates := services.NewDuplicateService(env.client, env.events, env.encryptor, time.Hour, 0.5)
+
+	r, authed := newTestRouter()
+	authed.POST("/responses", api.CreateFormResponse(env.client, env.events, attachments, env.encryptor, duplicates))
+	authed.GET("/responses", api.ListFormResponses(env.client, env.encryptor, accessLog))
+	authed.GET("/responses/:id/access-log", api.GetResponseAccessLog(accessLog))
+	authed.POST("/patients/access-report", api.GetPatientAccessReport(accessLog))
+	return r, env
+}
+
+func TestListingRecordsOneAccessEventPerPatient(t *testing.T) {
+	r, env := newAccessLogRouter(t)
+	patient := func(first, last, dob, allergies string) map[string]interface{} {
+		return map[string]interface{}{"first_name": first, "last_name": last, "date_of_birth": dob, "allergies": allergies}
+	}
+	first, _ := submit(t, r, patient("Dana", "Whitfield", "1984-02-11", "None"))
+	second, _ := submit(t, r, patient("Dana", "Whitfield", "1984-02-11", "Penicillin"))
+	other, _ := submit(t, r, patient("Sam", "Ortega", "1990-07-30", "None"))
+
+	if rec := duplicatesRequest(t, r, http.MethodGet, "/api/responses", nil); rec.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+	docs, err := env.client.Collection("phi_access_log").Documents(context.Background()).GetAll()
+	if err != nil {
+		t.Fatalf("read access log: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("listing three responses of two patients wrote %d events", len(docs))
+	}
+
+	// Each response still finds the list event that showed it
+	for _, id := range []string{first, second, other} {
+		rec := duplicatesRequest(t, r, http.MethodGet, "/api/responses/"+id+"/access-log", nil)
+		var log struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &log); err != nil || log.Count != 1 {
+			t.Fatalf("access log of %s: %d %s", id, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/patients/access-report", map[string]string{
+		"patient_name": "dana whitfield", "date_of_birth": "1984-02-11",
+	})
+	var report services.PatientAccessReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("access report: %d %s", rec.Code, rec.Body.String())
+	}
+	want := []string{first, second}
+	sort.Strings(want)
+	if len(report.ResponseIDs) != 2 || report.ResponseIDs[0] != want[0] || report.ResponseIDs[1] != want[1] {
+		t.Fatalf("report response IDs %v, want %v", report.ResponseIDs, want)
+	}
+
+	if rec := duplicatesRequest(t, r, http.MethodPost, "/api/patients/access-report", map[string]string{}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("report without a patient: %d", rec.Code)
+	}
+}
@@ -0,0 +1,259 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/config"
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/logging"
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Known PHI submitted in every request below. None of it may appear in log output.
+var knownPHI = map[string]string{
+	"name":       "Margarita Quintanilla-Hoyt",
+	"ssn":        "123-45-6789",
+	"dob":        "1961-04-23",
+	"phone":      "(415) 555-0134",
+	"email":      "mquintanilla@example.org",
+	"address":    "1487 Juniper Hollow Rd",
+	"medication": "Lisinopril 20mg",
+	"signature":  "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg",
+}
+
+func responseData() map[string]interface{} {
+	return map[string]interface{}{
+		"first_name":         "Margarita",
+		"last_name":          "Quintanilla-Hoyt",
+		"patient_name":       knownPHI["name"],
+		"ssn":                knownPHI["ssn"],
+		"date_of_birth":      knownPHI["dob"],
+		"phone":              knownPHI["phone"],
+		"email":              knownPHI["email"],
+		"street_address":     knownPHI["address"],
+		"current_medication": knownPHI["medication"],
+		"notes":              "Call " + knownPHI["phone"] + " re: SSN " + knownPHI["ssn"],
+		"patient_signature":  "data:image/png;base64," + knownPHI["signature"] + "==",
+		"pain_areas": []interface{}{
+			map[string]interface{}{"x": 10.0, "y": 20.0, "intensity": 7.0, "label": knownPHI["name"]},
+		},
+	}
+}
+
+// syncBuffer collects log output written from handler and background goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs routes slog and the standard log package through a redacting debug-level
+// logger with field dumps enabled, so the test sees the most verbose output possible
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Setenv("LOG_DEBUG_DUMPS", "true")
+	t.Setenv("ENVIRONMENT", "development")
+
+	out := &syncBuffer{}
+	previous := slog.Default()
+	previousFlags := log.Flags()
+	slog.SetDefault(logging.New(out, slog.LevelDebug, true))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetFlags(previousFlags)
+	})
+	return out
+}
+
+var (
+	sharedRedisOnce sync.Once
+	sharedRedisAddr string
+)
+
+// useSharedRedis points the process-wide Redis client, which session login and PDF
+// generation take from data.GetRedisClient, at an in-memory Redis that lives as long as
+// the test binary
+func useSharedRedis(t *testing.T) {
+	sharedRedisOnce.Do(func() {
+		fake, err := dev.StartRedis("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("start redis: %v", err)
+		}
+		sharedRedisAddr = fake.Addr()
+		data.ConfigureRedis(config.RedisConfig{Addr: sharedRedisAddr})
+	})
+	if data.GetRedisClient() == nil {
+		t.Fatal("shared redis unavailable")
+	}
+}
+
+// newRouter wires the main response handlers, session login and PDF generation against
+// the in-memory Firestore and Redis. Organization org-1 holds the dev seed data, which
+// has a form for every PDF pattern type, and a share link to the intake form.
+func newRouter(t *testing.T) (*gin.Engine, *capturingConverter) {
+	ctx := context.Background()
+	useSharedRedis(t)
+	env := newTestEnv(t)
+	if _, err := dev.Seed(ctx, env.client, env.encryptor, "org-1"); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := env.client.Collection("share_links").Doc("link-1").Set(ctx, data.ShareLink{
+		FormID: "dev-patient-intake", ShareToken: "share-token-1", OrganizationID: "org-1", IsActive: true, CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatalf("share link: %v", err)
+	}
+
+	attachments := services.NewAttachmentService(env.client, env.store, services.NewUploadSanitizer(nil), env.encryptor)
+	accessLog := services.NewPHIAccessLog(env.client, env.encryptor)
+	duplicates := services.NewDuplicateService(env.client, env.events, env.encryptor, 72*time.Hour, 0.5)
+	converter := &capturingConverter{}
+
+	r, authed := newTestRouter(api.RequestLoggerMiddleware())
+	r.POST("/api/auth/session-login", api.SessionLogin(dev.NewAuth(), config.SessionConfig{TTL: time.Hour}))
+	r.POST("/api/responses/public", api.CreatePublicFormResponse(env.client, env.events, attachments, env.encryptor, duplicates))
+	authed.POST("/responses", api.CreateFormResponse(env.client, env.events, attachments, env.encryptor, duplicates))
+	authed.GET("/responses/:id", api.GetFormResponse(env.client, env.encryptor, accessLog))
+	authed.GET("/responses", api.ListFormResponses(env.client, env.encryptor, accessLog))
+	authed.POST("/responses/:id/generate-pdf", api.GeneratePDFHandler(env.client, converter, env.events, attachments, env.encryptor, accessLog))
+	return r, converter
+}
+
+func serve(t *testing.T, r *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(method, path, reader).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-phi-test")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func assertNoPHI(t *testing.T, output string) {
+	t.Helper()
+	for kind, value := range knownPHI {
+		if strings.Contains(output, value) {
+			t.Errorf("%s PHI %q reached log output:\n%s", kind, value, output)
+		}
+	}
+}
+
+// seededPHI is patient data in the dev seed responses that the PDF test renders
+var seededPHI = []string{"Jordan Avery", "jordan.avery@example.com", "42 Elm Street", "5550104477",
+	"Morgan Lee", "Riley Chen", "Casey Morgan", "Taylor Brooks"}
+
+func TestMainHandlersDoNotLogPHI(t *testing.T) {
+	out := captureLogs(t)
+	r, converter := newRouter(t)
+	expect := func(rec *httptest.ResponseRecorder, want int, what string) *httptest.ResponseRecorder {
+		t.Helper()
+		if rec.Code != want {
+			t.Fatalf("%s: %d %s", what, rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	token, err := dev.NewAuth().SignIDToken("clinician-1", knownPHI["email"], time.Hour)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	expect(serve(t, r, http.MethodPost, "/api/auth/session-login", map[string]string{"idToken": token}), http.StatusOK, "session login")
+
+	expect(serve(t, r, http.MethodPost, "/api/responses/public", map[string]interface{}{
+		"form_id":       "dev-patient-intake",
+		"share_token":   "share-token-1",
+		"response_data": responseData(),
+	}), http.StatusCreated, "public submission")
+	rec := expect(serve(t, r, http.MethodPost, "/api/responses", map[string]interface{}{
+		"form":          "dev-patient-intake",
+		"response_data": responseData(),
+	}), http.StatusCreated, "submission")
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("submission response: %s", rec.Body.String())
+	}
+	expect(serve(t, r, http.MethodGet, "/api/responses/"+created.ID, nil), http.StatusOK, "get response")
+	expect(serve(t, r, http.MethodGet, "/api/responses?formId=dev-patient-intake", nil), http.StatusOK, "list responses")
+
+	// The submitted response, then every seeded form so each pattern renderer runs
+	expect(serve(t, r, http.MethodPost, "/api/responses/"+created.ID+"/generate-pdf", nil), http.StatusOK, "generate PDF")
+	if !strings.Contains(converter.html, knownPHI["email"]) {
+		t.Fatal("the PDF was rendered without the submitted answers")
+	}
+	for _, form := range []string{"patient-intake", "pain-assessment", "neck-disability-index", "oswestry-disability-index", "patient-history"} {
+		expect(serve(t, r, http.MethodPost, "/api/responses/dev-"+form+"-response/generate-pdf", nil), http.StatusOK, "generate PDF of "+form)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "req-phi-test") || !strings.Contains(output, "PDF generation succeeded") {
+		t.Fatalf("expected request-scoped log lines, got:\n%s", output)
+	}
+	assertNoPHI(t, output)
+	for _, value := range seededPHI {
+		if strings.Contains(output, value) {
+			t.Errorf("seeded PHI %q reached log output", value)
+		}
+	}
+}
+
+func TestLegacyLogOutputIsRedacted(t *testing.T) {
+	out := captureLogs(t)
+
+	log.Printf("patient %s born %s, phone %s, ssn %s, signature data:image/png;base64,%s==",
+		knownPHI["email"], knownPHI["dob"], knownPHI["phone"], knownPHI["ssn"], knownPHI["signature"])
+	slog.Info("submission", "patient_name", knownPHI["name"], "answers", responseData())
+
+	output := out.String()
+	if !strings.Contains(output, logging.Redacted) {
+		t.Fatalf("expected redaction placeholders, got:\n%s", output)
+	}
+	assertNoPHI(t, output)
+}
+
+func TestDebugDumpsDisabledInProduction(t *testing.T) {
+	out := captureLogs(t)
+	t.Setenv("ENVIRONMENT", "production")
+
+	logging.Dump(context.Background(), "form fields", "fields", []string{"ssn", "date_of_birth"})
+	if strings.Contains(out.String(), "form fields") {
+		t.Fatalf("debug dump written in production:\n%s", out.String())
+	}
+}
@@ -0,0 +1,179 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// flakySender fails its first failures sends and records every attempt
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	sent     []services.Notification
+}
+
+func (s *flakySender) Send(ctx context.Context, n services.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, n)
+	if len(s.sent) <= s.failures {
+		return errors.New("provider unavailable")
+	}
+	return nil
+}
+
+func (s *flakySender) attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+// newReminderScheduler seeds organization org-1 with schedule, when given, and an unanswered
+// share link due in three hours
+func newReminderScheduler(t *testing.T, schedule *data.ReminderSchedule, sender services.NotificationSender) (*services.ReminderScheduler, *testEnv) {
+	t.Helper()
+	ctx := context.Background()
+	env := newTestEnv(t)
+	now := time.Now().UTC()
+
+	org := data.Organization{UID: "org-1", Name: "Juniper Clinic", CreatedAt: now}
+	org.Settings.ReminderSchedule = schedule
+	if _, err := env.client.Collection("organizations").Doc("org-1").Set(ctx, org); err != nil {
+		t.Fatalf("seed organization: %v", err)
+	}
+	_, err := env.client.Collection("share_links").Doc("link-1").Set(ctx, data.ShareLink{
+		FormID:         "form-1",
+		ShareToken:     "token-1",
+		IsActive:       true,
+		OrganizationID: "org-1",
+		ExpiresAt:      now.Add(3 * time.Hour),
+		RecipientEmail: "patient@example.org",
+		CreatedAt:      now,
+	})
+	if err != nil {
+		t.Fatalf("seed share link: %v", err)
+	}
+	return services.NewReminderScheduler(env.client, newTestRedis(t), sender, nil, "https://forms.example.org"), env
+}
+
+func reminderLog(t *testing.T, env *testEnv) data.ReminderLog {
+	t.Helper()
+	doc, err := env.client.Collection("reminder_logs").Doc("link-1_4h_email").Get(context.Background())
+	if err != nil {
+		t.Fatalf("get reminder log: %v", err)
+	}
+	var entry data.ReminderLog
+	if err := doc.DataTo(&entry); err != nil {
+		t.Fatalf("decode reminder log: %v", err)
+	}
+	return entry
+}
+
+func TestRemindersAreOptIn(t *testing.T) {
+	sender := &flakySender{}
+	scheduler, _ := newReminderScheduler(t, nil, sender)
+
+	sent, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if sent != 0 || sender.attempts() != 0 {
+		t.Fatalf("an organization without a schedule was sent %d reminders", sender.attempts())
+	}
+}
+
+func TestFailedReminderIsRetried(t *testing.T) {
+	ctx := context.Background()
+	sender := &flakySender{failures: 1}
+	schedule := &data.ReminderSchedule{Enabled: true, OffsetsHours: []int{48, 4}, Channels: []string{services.ChannelEmail}}
+	scheduler, env := newReminderScheduler(t, schedule, sender)
+
+	if sent, err := scheduler.RunOnce(ctx); err != nil || sent != 0 {
+		t.Fatalf("first sweep: sent %d, %v", sent, err)
+	}
+	if entry := reminderLog(t, env); entry.Status != "failed" || entry.Attempts != 1 || entry.Error == "" {
+		t.Fatalf("expected a failed first attempt, got %+v", entry)
+	}
+
+	if sent, err := scheduler.RunOnce(ctx); err != nil || sent != 1 {
+		t.Fatalf("retry sweep: sent %d, %v", sent, err)
+	}
+	entry := reminderLog(t, env)
+	if entry.Status != "sent" || entry.Attempts != 2 || entry.Error != "" || entry.SentAt == nil {
+		t.Fatalf("expected the retry to be recorded as sent, got %+v", entry)
+	}
+
+	// A sent reminder is never sent again, and only the 4h offset was due
+	if sent, _ := scheduler.RunOnce(ctx); sent != 0 || sender.attempts() != 2 {
+		t.Fatalf("reminder sent again: %d attempts", sender.attempts())
+	}
+}
+
+func TestReminderRetriesAreBounded(t *testing.T) {
+	ctx := context.Background()
+	sender := &flakySender{failures: 100}
+	schedule := &data.ReminderSchedule{Enabled: true, OffsetsHours: []int{4}, Channels: []string{services.ChannelEmail}}
+	scheduler, env := newReminderScheduler(t, schedule, sender)
+
+	for i := 0; i < 5; i++ {
+		if _, err := scheduler.RunOnce(ctx); err != nil {
+			t.Fatalf("sweep %d: %v", i, err)
+		}
+	}
+	if sender.attempts() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", sender.attempts())
+	}
+	if entry := reminderLog(t, env); entry.Status != "failed" || entry.Attempts != 3 {
+		t.Fatalf("expected the reminder to stay failed after 3 attempts, got %+v", entry)
+	}
+}
+
+// takeoverSender hands the sweep lock to another instance while the first reminder is sent,
+// as happens when a sweep outlives the lock TTL
+type takeoverSender struct {
+	flakySender
+	rdb *redis.Client
+}
+
+func (s *takeoverSender) Send(ctx context.Context, n services.Notification) error {
+	if err := s.rdb.Set(ctx, "lock:reminder-scheduler", "other-instance", time.Minute).Err(); err != nil {
+		return err
+	}
+	return s.flakySender.Send(ctx, n)
+}
+
+func TestReminderSweepStopsWhenItLosesItsLock(t *testing.T) {
+	ctx := context.Background()
+	schedule := &data.ReminderSchedule{Enabled: true, OffsetsHours: []int{4}, Channels: []string{services.ChannelEmail}}
+	_, env := newReminderScheduler(t, schedule, nil)
+	second := data.ShareLink{
+		FormID:         "form-1",
+		ShareToken:     "token-2",
+		IsActive:       true,
+		OrganizationID: "org-1",
+		ExpiresAt:      time.Now().UTC().Add(3 * time.Hour),
+		RecipientEmail: "other@example.org",
+	}
+	if _, err := env.client.Collection("share_links").Doc("link-2").Set(ctx, second); err != nil {
+		t.Fatalf("seed share link: %v", err)
+	}
+	rdb := newTestRedis(t)
+	sender := &takeoverSender{rdb: rdb}
+	scheduler := services.NewReminderScheduler(env.client, rdb, sender, nil, "https://forms.example.org")
+
+	sent, err := scheduler.RunOnce(ctx)
+	if err == nil || sent != 1 || sender.attempts() != 1 {
+		t.Fatalf("sweep went on after losing its lock: %d sent, %d attempts, %v", sent, sender.attempts(), err)
+	}
+	if owner, _ := rdb.Get(ctx, "lock:reminder-scheduler").Result(); owner != "other-instance" {
+		t.Fatalf("the other instance's lock was released: %q", owner)
+	}
+}
@@ -0,0 +1,166 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"backend-go/internal/api"
+	"backend-go/internal/dev"
+	"backend-go/internal/logging"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/vertexai/genai"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// recordingModel is the dev model, remembering the request ID each call carried as gRPC metadata
+type recordingModel struct {
+	*dev.Model
+	mu  sync.Mutex
+	ids []string
+}
+
+func (m *recordingModel) GenerateContent(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	m.mu.Lock()
+	m.ids = append(m.ids, strings.Join(md.Get("x-request-id"), ","))
+	m.mu.Unlock()
+	return m.Model.GenerateContent(ctx, parts...)
+}
+
+// serveWithRequestID sends a GET to path, with an X-Request-ID header unless incoming is empty
+func serveWithRequestID(r http.Handler, path, incoming string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if incoming != "" {
+		req.Header.Set(logging.RequestIDHeader, incoming)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequestLoggerAdoptsOnlyWellFormedRequestIDs(t *testing.T) {
+	r, _ := newTestRouter(api.RequestLoggerMiddleware())
+	var seen string
+	r.GET("/ping", func(c *gin.Context) {
+		seen = logging.RequestID(c.Request.Context())
+		c.Status(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{"valid", "req-42_a.b:c", true},
+		{"longest allowed", strings.Repeat("a", 128), true},
+		{"absent", "", false},
+		{"oversized", strings.Repeat("a", 129), false},
+		{"spaces", "req 42", false},
+		{"markup", "<script>alert(1)</script>", false},
+		{"non-ascii", "req-é", false},
+	}
+	generated := map[string]bool{}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serveWithRequestID(r, "/ping", tc.incoming)
+			echoed := rec.Header().Get(logging.RequestIDHeader)
+			if echoed == "" || echoed != seen {
+				t.Fatalf("response carries %q, the request context %q", echoed, seen)
+			}
+			if tc.kept {
+				if echoed != tc.incoming {
+					t.Fatalf("valid ID %q replaced with %q", tc.incoming, echoed)
+				}
+				return
+			}
+			if echoed == tc.incoming || !logging.ValidRequestID(echoed) || generated[echoed] {
+				t.Fatalf("ID %q was not replaced with a fresh one: %q", tc.incoming, echoed)
+			}
+			generated[echoed] = true
+		})
+	}
+}
+
+func TestRequestIDIsIncludedInErrorBodies(t *testing.T) {
+	r, _ := newTestRouter(api.RequestLoggerMiddleware(), api.ErrorHandlerMiddleware())
+	r.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("boom"))
+	})
+
+	for _, incoming := range []string{"req-42", ""} {
+		rec := serveWithRequestID(r, "/fail", incoming)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("status %d", rec.Code)
+		}
+		var body struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode %s: %v", rec.Body, err)
+		}
+		if echoed := rec.Header().Get(logging.RequestIDHeader); body.RequestID == "" || body.RequestID != echoed {
+			t.Fatalf("error body carries %q, the response header %q", body.RequestID, echoed)
+		}
+		if incoming != "" && body.RequestID != incoming {
+			t.Fatalf("error body carries %q, want %q", body.RequestID, incoming)
+		}
+	}
+}
+
+func TestRequestIDIsPassedToGotenbergAndVertex(t *testing.T) {
+	var mu sync.Mutex
+	gotenbergHeaders := map[string][]string{}
+	gotenberg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		gotenbergHeaders[req.URL.Path] = []string{req.Header.Get(logging.RequestIDHeader), req.Header.Get("Gotenberg-Trace")}
+		mu.Unlock()
+		if req.URL.Path == "/health" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer gotenberg.Close()
+	converter := services.NewGotenbergService(gotenberg.URL)
+	model := &recordingModel{Model: dev.NewModel()}
+	vertex := services.NewVertexAIServiceWithModel(model)
+
+	r, _ := newTestRouter(api.RequestLoggerMiddleware())
+	r.GET("/outbound", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if _, err := converter.ConvertHTMLToPDF(ctx, "<p>hi</p>"); err != nil {
+			t.Errorf("convert: %v", err)
+		}
+		if err := converter.GetServiceHealth(ctx); err != nil {
+			t.Errorf("health: %v", err)
+		}
+		if _, err := vertex.GenerateClinicalSummary(ctx, nil); err != nil {
+			t.Errorf("summary: %v", err)
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, incoming := range []string{"req-42", ""} {
+		rec := serveWithRequestID(r, "/outbound", incoming)
+		id := rec.Header().Get(logging.RequestIDHeader)
+		if incoming != "" && id != incoming {
+			t.Fatalf("request ID %q replaced with %q", incoming, id)
+		}
+		for _, path := range []string{"/forms/chromium/convert/html", "/health"} {
+			if got := gotenbergHeaders[path]; len(got) != 2 || got[0] != id || got[1] != id {
+				t.Errorf("Gotenberg %s got X-Request-ID and trace %q, want %q", path, got, id)
+			}
+		}
+		if got := model.ids[len(model.ids)-1]; got != id {
+			t.Errorf("Vertex call carried request ID %q, want %q", got, id)
+		}
+	}
+}
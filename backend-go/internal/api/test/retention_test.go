@@ -0,0 +1,164 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+)
+
+// backdate moves a timestamp field of every document in a collection that matches field == value
+func backdate(t *testing.T, client *firestore.Client, collection, field, value, timeField string, age time.Duration) {
+	t.Helper()
+	ctx := context.Background()
+	docs, err := client.Collection(collection).Where(field, "==", value).Documents(ctx).GetAll()
+	if err != nil || len(docs) == 0 {
+		t.Fatalf("backdate %s: %d documents, %v", collection, len(docs), err)
+	}
+	for _, doc := range docs {
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: timeField, Value: time.Now().UTC().Add(-age)}}); err != nil {
+			t.Fatalf("backdate %s/%s: %v", collection, doc.Ref.ID, err)
+		}
+	}
+}
+
+func TestRetentionSweepPurgesArchivesAndHonorsHolds(t *testing.T) {
+	ctx := context.Background()
+	r, env, exports, responseID := newExportRouter(t)
+	heldID, _ := submit(t, r, map[string]interface{}{"first_name": "Grace"})
+	const old = 60 * 24 * time.Hour
+
+	if _, err := env.client.Collection("organizations").Doc("org-org-1").Set(ctx, data.Organization{
+		UID: "org-1", Settings: data.OrganizationSettings{DataRetentionDays: 30},
+	}); err != nil {
+		t.Fatalf("organization: %v", err)
+	}
+	if _, _, err := env.client.Collection("legal_holds").Add(ctx, data.LegalHold{
+		OrganizationID: "org-1", ResponseID: heldID, Reason: "litigation", Active: true, CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatalf("legal hold: %v", err)
+	}
+
+	// A patient export of the first response: its archive holds the response's PDF
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/exports", map[string]interface{}{"response_ids": []string{responseID}, "recipient": "Ada (patient)"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("request export: %d %s", rec.Code, rec.Body.String())
+	}
+	exports.RunOnce(ctx)
+	exportDocs, err := env.client.Collection("patient_exports").Documents(ctx).GetAll()
+	if err != nil || len(exportDocs) != 1 {
+		t.Fatalf("exports: %d %v", len(exportDocs), err)
+	}
+	exportKey, _ := exportDocs[0].DataAt("storage_key")
+
+	// A completed backup of the organization
+	backupKey := "org-archives/org-1/backup-1"
+	if err := env.store.Put(ctx, backupKey, "application/octet-stream", []byte("sealed backup")); err != nil {
+		t.Fatalf("put backup: %v", err)
+	}
+	if _, err := env.client.Collection("org_archive_jobs").Doc("backup-1").Set(ctx, data.OrgArchiveJob{
+		OrganizationID: "org-1", Kind: services.ArchiveBackup, Status: services.ArchiveCompleted, StorageKey: backupKey, Encrypted: true,
+	}); err != nil {
+		t.Fatalf("backup job: %v", err)
+	}
+
+	backdate(t, env.client, "form_responses", "organizationId", "org-1", "submitted_at", old)
+	backdate(t, env.client, "attachments", "organizationId", "org-1", "created_at", old)
+	backdate(t, env.client, "patient_exports", "organizationId", "org-1", "created_at", old)
+	backdate(t, env.client, "org_archive_jobs", "organizationId", "org-1", "created_at", old)
+
+	retention := services.NewRetentionService(env.client, nil, env.store, services.NewAttachmentService(env.client, env.store, nil, env.encryptor), env.encryptor, nil)
+	report, err := retention.Report(ctx, "org-1")
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if report.Counts["export_archive"] != 1 || report.Counts["backup_archive"] != 1 || report.Counts["held"] != 1 || report.Counts["response"] != 1 {
+		t.Fatalf("dry run counts: %v", report.Counts)
+	}
+
+	if _, err := retention.RunOnce(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	for _, key := range []string{exportKey.(string), backupKey} {
+		if _, err := env.store.Get(ctx, key); !errors.Is(err, services.ErrBlobNotFound) {
+			t.Fatalf("archive %s survived the sweep: %v", key, err)
+		}
+	}
+	job, err := exports.Get(ctx, "org-1", exportDocs[0].Ref.ID)
+	if err != nil || job.Status != services.ExportExpired || job.StorageKey != "" {
+		t.Fatalf("export after the sweep: %+v %v", job, err)
+	}
+	if _, err := env.client.Collection("form_responses").Doc(responseID).Get(ctx); err == nil {
+		t.Fatal("response past the window was kept")
+	}
+	if _, err := env.client.Collection("form_responses").Doc(heldID).Get(ctx); err != nil {
+		t.Fatalf("held response was purged: %v", err)
+	}
+
+	// The response (with its signature), the export archive and the backup
+	if n, err := retention.VerifyDeletionLog(ctx, "org-1"); err != nil || n != 3 {
+		t.Fatalf("deletion log: %d entries, %v", n, err)
+	}
+	if again, err := retention.RunOnce(ctx); err != nil || again != 0 {
+		t.Fatalf("second sweep retired %d: %v", again, err)
+	}
+}
+
+func TestVerifyDeletionLogDetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	retention := services.NewRetentionService(env.client, nil, env.store, services.NewAttachmentService(env.client, env.store, nil, env.encryptor), env.encryptor, nil)
+
+	if n, err := retention.VerifyDeletionLog(ctx, "org-1"); err != nil || n != 0 {
+		t.Fatalf("empty log: %d %v", n, err)
+	}
+
+	if _, err := env.client.Collection("organizations").Doc("org-org-1").Set(ctx, data.Organization{
+		UID: "org-1", Settings: data.OrganizationSettings{DataRetentionDays: 30},
+	}); err != nil {
+		t.Fatalf("organization: %v", err)
+	}
+	for _, id := range []string{"link-1", "link-2", "link-3"} {
+		created := time.Now().UTC().Add(-60 * 24 * time.Hour)
+		if _, err := env.client.Collection("share_links").Doc(id).Set(ctx, data.ShareLink{
+			OrganizationID: "org-1", CreatedAt: created, ExpiresAt: created.Add(24 * time.Hour),
+		}); err != nil {
+			t.Fatalf("share link: %v", err)
+		}
+	}
+	if retired, err := retention.RunOnce(ctx); err != nil || retired != 3 {
+		t.Fatalf("sweep: %d %v", retired, err)
+	}
+	if n, err := retention.VerifyDeletionLog(ctx, "org-1"); err != nil || n != 3 {
+		t.Fatalf("intact log: %d %v", n, err)
+	}
+
+	entry := env.client.Collection("deletion_log").Doc("org-1_000000000002")
+	if _, err := entry.Update(ctx, []firestore.Update{{Path: "reason", Value: "requested by patient"}}); err != nil {
+		t.Fatalf("edit entry: %v", err)
+	}
+	if _, err := retention.VerifyDeletionLog(ctx, "org-1"); !errors.Is(err, services.ErrDeletionLogTampered) {
+		t.Fatalf("edited entry: %v", err)
+	}
+
+	if _, err := entry.Delete(ctx); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+	if _, err := retention.VerifyDeletionLog(ctx, "org-1"); !errors.Is(err, services.ErrDeletionLogTampered) {
+		t.Fatalf("deleted entry: %v", err)
+	}
+
+	// Removing the tail is caught by the chain head
+	if _, err := env.client.Collection("deletion_log").Doc("org-1_000000000003").Delete(ctx); err != nil {
+		t.Fatalf("delete tail: %v", err)
+	}
+	if n, err := retention.VerifyDeletionLog(ctx, "org-1"); !errors.Is(err, services.ErrDeletionLogTampered) || n != 1 {
+		t.Fatalf("truncated log: %d %v", n, err)
+	}
+}
@@ -0,0 +1,313 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+type trashFixture struct {
+	client *firestore.Client
+	trash  *services.TrashService
+	router *gin.Engine
+}
+
+// newTrashFixture serves the form, response and trash routes against the in-memory
+// Firestore and Redis for organization org-1. The outbox is not dispatched, so the form
+// cache is only cleared by the writes themselves.
+func newTrashFixture(t *testing.T) *trashFixture {
+	t.Helper()
+	env := newTestEnv(t)
+	rdb := newTestRedis(t)
+	attachments := services.NewAttachmentService(env.client, nil, nil, env.encryptor)
+	retention := services.NewRetentionService(env.client, nil, env.store, attachments, nil, nil)
+	trash := services.NewTrashService(env.client, rdb, env.events, retention, nil, 30*24*time.Hour)
+
+	r, authed := newTestRouter()
+	authed.GET("/forms", api.ListForms(env.client, rdb))
+	authed.GET("/forms/:id", api.GetForm(env.client, rdb))
+	authed.DELETE("/forms/:id", api.DeleteForm(trash))
+	authed.DELETE("/responses/:id", api.DeleteFormResponse(env.client, trash, retention))
+	authed.GET("/trash", api.ListTrash(trash))
+	authed.POST("/trash/:type/:id/restore", api.RestoreFromTrash(trash))
+
+	return &trashFixture{client: env.client, trash: trash, router: r}
+}
+
+func (f *trashFixture) do(t *testing.T, method, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+// deleteForm deletes a form through the API with the ETag of its stored copy
+func (f *trashFixture) deleteForm(t *testing.T, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	doc, err := f.client.Collection("forms").Doc(id).Get(context.Background())
+	if err != nil {
+		t.Fatalf("get form %s: %v", id, err)
+	}
+	var form data.Form
+	if err := doc.DataTo(&form); err != nil {
+		t.Fatalf("decode form %s: %v", id, err)
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/api/forms/"+id, nil)
+	req.Header.Set("If-Match", services.FormETag(&form))
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (f *trashFixture) seed(t *testing.T, collection, id string, doc map[string]interface{}) {
+	t.Helper()
+	if _, err := f.client.Collection(collection).Doc(id).Set(context.Background(), doc); err != nil {
+		t.Fatalf("seed %s/%s: %v", collection, id, err)
+	}
+}
+
+func (f *trashFixture) listTrash(t *testing.T) []data.TrashItem {
+	t.Helper()
+	rec := f.do(t, http.MethodGet, "/api/trash")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list trash: %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Results []data.TrashItem `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode trash: %v", err)
+	}
+	return body.Results
+}
+
+func (f *trashFixture) linkActive(t *testing.T, id string) bool {
+	t.Helper()
+	doc, err := f.client.Collection("share_links").Doc(id).Get(context.Background())
+	if err != nil {
+		t.Fatalf("get link %s: %v", id, err)
+	}
+	active, _ := doc.Data()["is_active"].(bool)
+	return active
+}
+
+func TestDeletedFormIsHiddenAndRestoredWithItsShareLinks(t *testing.T) {
+	f := newTrashFixture(t)
+	now := time.Now().UTC()
+	f.seed(t, "forms", "form-1", map[string]interface{}{"title": "Intake", "organizationId": "org-1", "created_at": now})
+	f.seed(t, "share_links", "link-on", map[string]interface{}{"form_id": "form-1", "organizationId": "org-1", "is_active": true, "created_at": now})
+	f.seed(t, "share_links", "link-off", map[string]interface{}{"form_id": "form-1", "organizationId": "org-1", "is_active": false, "created_at": now})
+
+	if rec := f.deleteForm(t, "form-1"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete form: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, http.MethodGet, "/api/forms/form-1"); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted form should be hidden, got %d", rec.Code)
+	}
+	if rec := f.deleteForm(t, "form-1"); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleting twice should 404, got %d", rec.Code)
+	}
+	if f.linkActive(t, "link-on") {
+		t.Fatal("share link should be deactivated with the form")
+	}
+
+	items := f.listTrash(t)
+	if len(items) != 1 || items[0].ResourceID != "form-1" || items[0].ResourceType != services.TrashForm {
+		t.Fatalf("unexpected trash listing: %+v", items)
+	}
+	if got := items[0].PurgeAfter.Sub(items[0].DeletedAt); got != 30*24*time.Hour {
+		t.Fatalf("purge_after should be the grace period after deletion, got %v", got)
+	}
+
+	if rec := f.do(t, http.MethodPost, "/api/trash/forms/form-1/restore"); rec.Code != http.StatusOK {
+		t.Fatalf("restore form: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, http.MethodGet, "/api/forms/form-1"); rec.Code != http.StatusOK {
+		t.Fatalf("restored form should be visible, got %d", rec.Code)
+	}
+	if !f.linkActive(t, "link-on") {
+		t.Fatal("share link deactivated with the form should be reactivated")
+	}
+	if f.linkActive(t, "link-off") {
+		t.Fatal("share link that was already inactive must stay inactive")
+	}
+	if items := f.listTrash(t); len(items) != 0 {
+		t.Fatalf("trash should be empty after restore: %+v", items)
+	}
+}
+
+func TestTrashIsScopedToTheOrganization(t *testing.T) {
+	f := newTrashFixture(t)
+	f.seed(t, "forms", "other-form", map[string]interface{}{"title": "Theirs", "organizationId": "org-2", "created_at": time.Now().UTC()})
+
+	if rec := f.deleteForm(t, "other-form"); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleting another organization's form should 404, got %d", rec.Code)
+	}
+	if _, err := f.trash.DeleteForm(context.Background(), "org-2", "someone", "other-form", nil); err != nil {
+		t.Fatalf("delete in own org: %v", err)
+	}
+	if items := f.listTrash(t); len(items) != 0 {
+		t.Fatalf("another organization's trash leaked: %+v", items)
+	}
+	if rec := f.do(t, http.MethodPost, "/api/trash/forms/other-form/restore"); rec.Code != http.StatusNotFound {
+		t.Fatalf("restoring another organization's form should 404, got %d", rec.Code)
+	}
+}
+
+func TestTrashPurgesAfterGracePeriod(t *testing.T) {
+	f := newTrashFixture(t)
+	ctx := context.Background()
+	created := time.Now().UTC().Add(-90 * 24 * time.Hour)
+	f.seed(t, "forms", "old-form", map[string]interface{}{"title": "Old", "organizationId": "org-1", "created_at": created})
+	f.seed(t, "share_links", "old-link", map[string]interface{}{"form_id": "old-form", "organizationId": "org-1", "is_active": true, "created_at": created})
+	f.seed(t, "form_responses", "old-response", map[string]interface{}{"form": "old-form", "organizationId": "org-1", "submitted_at": created})
+	f.seed(t, "form_responses", "recent-response", map[string]interface{}{"form": "old-form", "organizationId": "org-1", "submitted_at": created})
+
+	if rec := f.do(t, http.MethodDelete, "/api/responses/old-response"); rec.Code != http.StatusOK {
+		t.Fatalf("delete response: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, http.MethodDelete, "/api/responses/recent-response"); rec.Code != http.StatusOK {
+		t.Fatalf("delete response: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.deleteForm(t, "old-form"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete form: %d %s", rec.Code, rec.Body.String())
+	}
+	// Backdate two of the deletions past the grace period
+	expired := time.Now().UTC().Add(-31 * 24 * time.Hour)
+	for _, ref := range []*firestore.DocumentRef{
+		f.client.Collection("forms").Doc("old-form"),
+		f.client.Collection("form_responses").Doc("old-response"),
+	} {
+		if _, err := ref.Update(ctx, []firestore.Update{{Path: "deleted_at", Value: expired}}); err != nil {
+			t.Fatalf("backdate %s: %v", ref.ID, err)
+		}
+	}
+
+	purged, err := f.trash.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected one response purged, got %d", purged)
+	}
+	if _, err := f.client.Collection("form_responses").Doc("old-response").Get(ctx); err == nil {
+		t.Fatal("old-response should have been purged")
+	}
+	// recent-response still references the form, so the form and its link stay in the trash
+	if items := f.listTrash(t); len(items) != 2 {
+		t.Fatalf("expected the form and recent-response in the trash: %+v", items)
+	}
+
+	if _, err := f.client.Collection("form_responses").Doc("recent-response").Update(ctx, []firestore.Update{{Path: "deleted_at", Value: expired}}); err != nil {
+		t.Fatalf("backdate recent-response: %v", err)
+	}
+	if purged, err = f.trash.RunOnce(ctx); err != nil || purged != 2 {
+		t.Fatalf("expected the last response and then the form purged, got %d (%v)", purged, err)
+	}
+	for _, ref := range []*firestore.DocumentRef{
+		f.client.Collection("forms").Doc("old-form"),
+		f.client.Collection("share_links").Doc("old-link"),
+		f.client.Collection("form_responses").Doc("recent-response"),
+	} {
+		if _, err := ref.Get(ctx); err == nil {
+			t.Fatalf("%s should have been purged", ref.Path)
+		}
+	}
+	if items := f.listTrash(t); len(items) != 0 {
+		t.Fatalf("trash should be empty: %+v", items)
+	}
+
+	entries, err := f.client.Collection("deletion_log").Where("organizationId", "==", "org-1").Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatalf("deletion log: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected the form, share link and both responses in the deletion log, got %d", len(entries))
+	}
+}
+
+func TestFormWithLiveResponsesIsNotPurged(t *testing.T) {
+	f := newTrashFixture(t)
+	ctx := context.Background()
+	created := time.Now().UTC().Add(-90 * 24 * time.Hour)
+	f.seed(t, "forms", "intake", map[string]interface{}{"title": "Intake", "organizationId": "org-1", "created_at": created})
+	f.seed(t, "form_responses", "live-response", map[string]interface{}{"form": "intake", "organizationId": "org-1", "submitted_at": created})
+
+	if rec := f.deleteForm(t, "intake"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete form: %d %s", rec.Code, rec.Body.String())
+	}
+	expired := time.Now().UTC().Add(-31 * 24 * time.Hour)
+	if _, err := f.client.Collection("forms").Doc("intake").Update(ctx, []firestore.Update{{Path: "deleted_at", Value: expired}}); err != nil {
+		t.Fatalf("backdate form: %v", err)
+	}
+
+	if purged, err := f.trash.RunOnce(ctx); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged, got %d (%v)", purged, err)
+	}
+	if _, err := f.client.Collection("forms").Doc("intake").Get(ctx); err != nil {
+		t.Fatalf("form referenced by a live response was purged: %v", err)
+	}
+	if rec := f.do(t, http.MethodPost, "/api/trash/forms/intake/restore"); rec.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestDeletedFormIsNotServedFromCache(t *testing.T) {
+	f := newTrashFixture(t)
+	f.seed(t, "forms", "intake", map[string]interface{}{"title": "Intake", "organizationId": "org-1", "version": 1})
+
+	listed := func() int {
+		rec := f.do(t, http.MethodGet, "/api/forms")
+		var list struct {
+			Results []data.Form `json:"results"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("list forms: %d %s", rec.Code, rec.Body.String())
+		}
+		return len(list.Results)
+	}
+
+	// Warm the form and list caches
+	for i := 0; i < 2; i++ {
+		if rec := f.do(t, http.MethodGet, "/api/forms/intake"); rec.Code != http.StatusOK {
+			t.Fatalf("get form: %d", rec.Code)
+		}
+		if n := listed(); n != 1 {
+			t.Fatalf("listed %d forms, want 1", n)
+		}
+	}
+
+	if rec := f.deleteForm(t, "intake"); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := f.do(t, http.MethodGet, "/api/forms/intake"); rec.Code != http.StatusNotFound {
+		t.Fatalf("deleted form served from the cache: %d %s", rec.Code, rec.Body.String())
+	}
+	if n := listed(); n != 0 {
+		t.Fatalf("deleted form still listed from the cache (%d forms)", n)
+	}
+
+	// Restoring drops the cached empty list, and the form comes back as a new version
+	if rec := f.do(t, http.MethodPost, "/api/trash/forms/intake/restore"); rec.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body.String())
+	}
+	rec := f.do(t, http.MethodGet, "/api/forms/intake")
+	var restored data.Form
+	json.Unmarshal(rec.Body.Bytes(), &restored)
+	if rec.Code != http.StatusOK || restored.Version != 3 {
+		t.Fatalf("restored form: %d %+v", rec.Code, restored)
+	}
+	if n := listed(); n != 1 {
+		t.Fatalf("restored form not listed (%d forms)", n)
+	}
+}
@@ -0,0 +1,191 @@
+package api_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"backend-go/internal/services"
+)
+
+// testImage is a 3x2 image with a distinct top-left pixel, so orientation changes show
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	img.Set(0, 0, color.NRGBA{R: 0xFF, A: 0xFF})
+	return img
+}
+
+func encodePNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage()); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGChunk inserts a chunk right after IHDR
+func withPNGChunk(b []byte, chunkType string, body []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(append([]byte(chunkType), body...)))
+	const afterIHDR = 8 + 25
+	return append(append(append([]byte{}, b[:afterIHDR]...), chunk...), b[afterIHDR:]...)
+}
+
+// withJPEGSegment inserts a marker segment right after SOI
+func withJPEGSegment(b []byte, marker byte, body []byte) []byte {
+	segment := append([]byte{0xFF, marker}, binary.BigEndian.AppendUint16(nil, uint16(len(body)+2))...)
+	segment = append(segment, body...)
+	return append(append(append([]byte{}, b[:2]...), segment...), b[2:]...)
+}
+
+// exifSegment is an APP1 body with an orientation tag and a GPS IFD pointer
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 2)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112) // Orientation, SHORT
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x8825) // GPS IFD, LONG
+	tiff = binary.LittleEndian.AppendUint16(tiff, 4)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	tiff = append(tiff, 0, 0, 0, 0)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+func sanitize(data []byte, declared string) ([]byte, error) {
+	out, _, err := services.NewUploadSanitizer(nil).Sanitize(context.Background(), services.Upload{
+		Data:         data,
+		DeclaredType: declared,
+		Allowed:      services.AttachmentUploadTypes,
+		Source:       "test",
+	})
+	return out, err
+}
+
+func TestSanitizerChecksMagicBytes(t *testing.T) {
+	pngBytes := encodePNG(t)
+	for name, tc := range map[string]struct {
+		data     []byte
+		declared string
+		want     string
+	}{
+		"png declared as jpeg":  {pngBytes, "image/jpeg", "does not match content"},
+		"text declared as png":  {[]byte("patient notes"), "image/png", "unrecognized file type"},
+		"html declared as pdf":  {[]byte("<html><body>%PDF-1.4</body></html>"), "application/pdf", "unrecognized file type"},
+		"pdf without a type":    {[]byte("%PDF-1.4\n%%EOF"), "", ""},
+		"png with charset type": {pngBytes, "image/png; charset=binary", ""},
+	} {
+		_, err := sanitize(tc.data, tc.declared)
+		if tc.want == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s: got %v, want an error about %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestSanitizerRejectsPolyglots(t *testing.T) {
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	zw.Write([]byte("<< /S /JavaScript /JS (app.alert(1)) >>"))
+	zw.Close()
+
+	for name, data := range map[string][]byte{
+		"script in a png text chunk": withPNGChunk(encodePNG(t), "tEXt", []byte("Comment\x00<script>alert(1)</script>")),
+		"php after the png end":      append(encodePNG(t), []byte("<?php system($_GET['c']); ?>")...),
+		"html in a jpeg comment":     withJPEGSegment(encodeJPEG(t), 0xFE, []byte("<html><body>hi</body></html>")),
+		"zip after the jpeg end":     append(encodeJPEG(t), []byte("PK\x03\x04payload")...),
+		"pdf inside a png":           withPNGChunk(encodePNG(t), "tEXt", []byte("Comment\x00%PDF-1.4 1 0 obj")),
+		"pdf with javascript":        []byte("%PDF-1.4\n1 0 obj << /OpenAction << /S /JavaScript /JS (x) >> >> endobj\n%%EOF"),
+		"pdf with an escaped name":   []byte("%PDF-1.4\n1 0 obj << /S /Java#53cript >> endobj\n%%EOF"),
+		"pdf with a hidden script":   append(append([]byte("%PDF-1.4\n1 0 obj << /Filter /FlateDecode >>\nstream\n"), deflated.Bytes()...), []byte("\nendstream endobj\n%%EOF")...),
+		"html at the top of a pdf":   []byte("%PDF-1.4 <html><script>alert(1)</script>\n%%EOF"),
+	} {
+		if _, err := sanitize(data, ""); err == nil {
+			t.Errorf("%s was accepted", name)
+		}
+	}
+}
+
+func TestSanitizerStripsEXIF(t *testing.T) {
+	tagged := withJPEGSegment(encodeJPEG(t), 0xE1, exifSegment(6))
+	out, report, err := services.NewUploadSanitizer(nil).Sanitize(context.Background(), services.Upload{
+		Data: tagged, DeclaredType: "image/jpeg", Allowed: services.AttachmentUploadTypes,
+	})
+	if err != nil {
+		t.Fatalf("sanitize: %v", err)
+	}
+	if !report.MetadataStripped || !report.LocationRemoved || !report.OrientationCorrected {
+		t.Fatalf("report: %+v", report)
+	}
+	if bytes.Contains(out, []byte("Exif")) {
+		t.Fatal("EXIF segment survived sanitizing")
+	}
+	// Orientation 6 is applied to the pixels: the 3x2 image is now 2x3
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 2 || bounds.Dy() != 3 {
+		t.Fatalf("output is %dx%d, want 2x3", bounds.Dx(), bounds.Dy())
+	}
+
+	out, report, err = services.NewUploadSanitizer(nil).Sanitize(context.Background(), services.Upload{
+		Data: withPNGChunk(encodePNG(t), "tEXt", []byte("Author\x00Dr. Alvarez")), Allowed: services.AttachmentUploadTypes,
+	})
+	if err != nil || !report.MetadataStripped || bytes.Contains(out, []byte("Alvarez")) {
+		t.Fatalf("png text chunk: %v %+v", err, report)
+	}
+}
+
+func TestSanitizerConvertsGIFAndRejectsUnsupportedPhotos(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, testImage(), nil); err != nil {
+		t.Fatalf("encode gif: %v", err)
+	}
+	out, report, err := services.NewUploadSanitizer(nil).Sanitize(context.Background(), services.Upload{
+		Data: buf.Bytes(), DeclaredType: "image/gif", Allowed: services.AttachmentUploadTypes,
+	})
+	if err != nil {
+		t.Fatalf("sanitize gif: %v", err)
+	}
+	if report.DetectedType != services.MimeGIF || report.ConvertedTo != services.MimePNG || !bytes.HasPrefix(out, []byte("\x89PNG")) {
+		t.Fatalf("gif was not converted to png: %+v", report)
+	}
+
+	heic := append([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), make([]byte, 64)...)
+	webp := append([]byte("RIFF\x40\x00\x00\x00WEBPVP8 "), make([]byte, 64)...)
+	for declared, data := range map[string][]byte{"image/heic": heic, "image/webp": webp} {
+		if _, err := sanitize(data, declared); err == nil || !strings.Contains(err.Error(), "upload a JPEG or PNG instead") {
+			t.Errorf("%s: got %v", declared, err)
+		}
+	}
+}
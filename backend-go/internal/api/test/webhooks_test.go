@@ -0,0 +1,308 @@
+package api_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/api"
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+)
+
+// webhookReceiver records the deliveries it receives and answers each with the next
+// status in statuses, then 200
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+	status := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rcv *webhookReceiver) received() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return len(rcv.requests)
+}
+
+// newWebhookFixture serves webhook subscription creation for org-1 and starts a receiver
+// on the loopback address, which the service is allowed to reach as in development
+func newWebhookFixture(t *testing.T, statuses ...int) (*gin.Engine, *testEnv, *services.WebhookService, *webhookReceiver, *httptest.Server) {
+	t.Helper()
+	env := newTestEnv(t)
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	webhooks := services.NewWebhookService(env.client, nil, env.encryptor, nil, true)
+	r, authed := newTestRouter()
+	authed.POST("/webhooks", api.CreateWebhookSubscription(env.client, env.encryptor, webhooks))
+	return r, env, webhooks, receiver, server
+}
+
+// subscribe creates a subscription to response.submitted and returns its ID and secret
+func subscribe(t *testing.T, r *gin.Engine, url string) (string, string) {
+	t.Helper()
+	rec := duplicatesRequest(t, r, http.MethodPost, "/api/webhooks", map[string]interface{}{
+		"url":    url,
+		"events": []string{services.EventResponseSubmitted},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create subscription: %d %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Subscription data.WebhookSubscription `json:"subscription"`
+		Secret       string                   `json:"secret"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return created.Subscription.ID, created.Secret
+}
+
+func publishSubmitted(t *testing.T, webhooks *services.WebhookService) {
+	t.Helper()
+	err := webhooks.Publish(context.Background(), services.WebhookEvent{
+		Type:           services.EventResponseSubmitted,
+		OrganizationID: "org-1",
+		IDs:            map[string]string{"response_id": "response-1"},
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+// onlyDelivery returns the single queued delivery, or nil when the queue is empty
+func onlyDelivery(t *testing.T, env *testEnv) *data.WebhookDelivery {
+	t.Helper()
+	docs, err := env.client.Collection("webhook_deliveries").Documents(context.Background()).GetAll()
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	if len(docs) > 1 {
+		t.Fatalf("expected one delivery, got %d", len(docs))
+	}
+	var delivery data.WebhookDelivery
+	if err := docs[0].DataTo(&delivery); err != nil {
+		t.Fatalf("decode delivery: %v", err)
+	}
+	delivery.ID = docs[0].Ref.ID
+	return &delivery
+}
+
+// makeDue moves a delivery's next attempt into the past, as if its backoff had elapsed
+func makeDue(t *testing.T, env *testEnv, deliveryID string) {
+	t.Helper()
+	_, err := env.client.Collection("webhook_deliveries").Doc(deliveryID).Update(context.Background(), []firestore.Update{
+		{Path: "next_attempt_at", Value: time.Now().UTC().Add(-time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("make delivery due: %v", err)
+	}
+}
+
+func TestWebhookSubscriptionURLs(t *testing.T) {
+	development := services.NewWebhookService(nil, nil, nil, nil, true)
+	for url, want := range map[string]string{
+		"https://hooks.example.org/forms": "",
+		"http://hooks.example.org/forms":  "https",
+		"http://localhost:8080/hook":      "",
+		"http://127.0.0.1:8080/hook":      "",
+		"https://10.0.0.5/hook":           "public",
+		"https://192.168.1.20/hook":       "public",
+		"https://169.254.169.254/latest":  "public",
+		"https://[fe80::1]/hook":          "public",
+		"https://100.64.0.1/hook":         "public",
+		"https://0.0.0.0/hook":            "public",
+	} {
+		err := development.ValidateSubscription(&data.WebhookSubscription{URL: url, Events: []string{services.EventResponseSubmitted}})
+		if want == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", url, err)
+		}
+		if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("%s: got %v, want an error about %q", url, err, want)
+		}
+	}
+
+	// Without the development setting only public addresses are accepted
+	deployed := services.NewWebhookService(nil, nil, nil, nil, false)
+	for _, url := range []string{"http://localhost:8080/hook", "https://localhost/hook", "https://127.0.0.1/hook", "https://[::1]/hook"} {
+		if err := deployed.ValidateSubscription(&data.WebhookSubscription{URL: url, Events: []string{services.EventResponseSubmitted}}); err == nil {
+			t.Errorf("%s was accepted without loopback webhooks enabled", url)
+		}
+	}
+}
+
+func TestWebhookDeliveryIsSignedWithSealedSecret(t *testing.T) {
+	ctx := context.Background()
+	r, env, webhooks, receiver, server := newWebhookFixture(t)
+	subID, secret := subscribe(t, r, server.URL+"/hook")
+
+	doc, err := env.client.Collection("webhook_subscriptions").Doc(subID).Get(ctx)
+	if err != nil {
+		t.Fatalf("get subscription: %v", err)
+	}
+	if stored, _ := doc.DataAt("secret"); stored != nil {
+		t.Fatal("the signing secret was stored in plaintext")
+	}
+	if sealed, _ := doc.DataAt("sealed_secret"); sealed == nil || strings.Contains(sealed.(string), secret) {
+		t.Fatalf("sealed_secret = %v", sealed)
+	}
+
+	publishSubmitted(t, webhooks)
+	if err := webhooks.RunOnce(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if receiver.received() != 1 {
+		t.Fatalf("expected one delivery, got %d", receiver.received())
+	}
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(req.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+	if got, want := req.Header.Get("X-Webhook-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signature %q, want %q", got, want)
+	}
+	if req.Header.Get("X-Webhook-Event") != services.EventResponseSubmitted || !strings.Contains(string(body), "response-1") {
+		t.Fatalf("unexpected delivery: %v %s", req.Header, body)
+	}
+	if delivery := onlyDelivery(t, env); delivery.Status != "delivered" || delivery.Attempts != 1 {
+		t.Fatalf("delivery not recorded as delivered: %+v", delivery)
+	}
+}
+
+func TestFailedWebhookDeliveryBacksOff(t *testing.T) {
+	ctx := context.Background()
+	r, env, webhooks, receiver, server := newWebhookFixture(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	subscribe(t, r, server.URL)
+	publishSubmitted(t, webhooks)
+
+	// Each failure doubles the delay before the next attempt, starting at 30s
+	for attempt, backoff := range []time.Duration{30 * time.Second, time.Minute} {
+		before := time.Now()
+		if err := webhooks.RunOnce(ctx); err != nil {
+			t.Fatalf("sweep: %v", err)
+		}
+		delivery := onlyDelivery(t, env)
+		if delivery.Status != "pending" || delivery.Attempts != attempt+1 || delivery.LastStatusCode == 0 {
+			t.Fatalf("attempt %d: %+v", attempt+1, delivery)
+		}
+		if wait := delivery.NextAttemptAt.Sub(before); wait < backoff || wait > backoff+5*time.Second {
+			t.Fatalf("attempt %d: next attempt in %v, want %v", attempt+1, wait, backoff)
+		}
+
+		// Nothing is sent again before the backoff elapses
+		if err := webhooks.RunOnce(ctx); err != nil || receiver.received() != attempt+1 {
+			t.Fatalf("delivery retried early: %d requests, %v", receiver.received(), err)
+		}
+		makeDue(t, env, delivery.ID)
+	}
+
+	if err := webhooks.RunOnce(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if delivery := onlyDelivery(t, env); delivery.Status != "delivered" || delivery.Attempts != 3 {
+		t.Fatalf("retry not delivered: %+v", delivery)
+	}
+}
+
+func TestWebhookDeliveryIsDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	statuses := make([]int, 20)
+	for i := range statuses {
+		statuses[i] = http.StatusInternalServerError
+	}
+	r, env, webhooks, receiver, server := newWebhookFixture(t, statuses...)
+	subscribe(t, r, server.URL)
+	publishSubmitted(t, webhooks)
+
+	for delivery := onlyDelivery(t, env); delivery != nil; delivery = onlyDelivery(t, env) {
+		if receiver.received() > 8 {
+			t.Fatalf("still retrying after %d attempts", receiver.received())
+		}
+		makeDue(t, env, delivery.ID)
+		if err := webhooks.RunOnce(ctx); err != nil {
+			t.Fatalf("sweep: %v", err)
+		}
+	}
+	if receiver.received() != 8 {
+		t.Fatalf("expected 8 attempts, got %d", receiver.received())
+	}
+
+	dead, err := env.client.Collection("webhook_dead_letters").Documents(ctx).GetAll()
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(dead), err)
+	}
+	var delivery data.WebhookDelivery
+	if err := dead[0].DataTo(&delivery); err != nil || delivery.Attempts != 8 || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("dead letter: %+v (%v)", delivery, err)
+	}
+}
+
+func TestWebhookDeliveryToPrivateAddressIsBlocked(t *testing.T) {
+	ctx := context.Background()
+	for name, url := range map[string]string{
+		"metadata server": "https://169.254.169.254/computeMetadata/v1/",
+		"loopback":        "", // the receiver, which deployed profiles must not reach
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, env, _, receiver, server := newWebhookFixture(t)
+			if url == "" {
+				url = server.URL
+			}
+			// Stored directly, as a subscription created before validation or whose
+			// hostname later resolves to a private address would be
+			_, err := env.client.Collection("webhook_subscriptions").Doc("sub-1").Set(ctx, data.WebhookSubscription{
+				OrganizationID: "org-1",
+				URL:            url,
+				Events:         []string{services.EventResponseSubmitted},
+				PayloadMode:    data.WebhookPayloadIDs,
+				Secret:         "whsec_test",
+				IsActive:       true,
+			})
+			if err != nil {
+				t.Fatalf("seed subscription: %v", err)
+			}
+
+			webhooks := services.NewWebhookService(env.client, nil, env.encryptor, nil, false)
+			publishSubmitted(t, webhooks)
+			if err := webhooks.RunOnce(ctx); err != nil {
+				t.Fatalf("sweep: %v", err)
+			}
+			if receiver.received() != 0 {
+				t.Fatal("the webhook reached a non-public address")
+			}
+			if delivery := onlyDelivery(t, env); delivery.Attempts != 1 || !strings.Contains(delivery.LastError, "not public") {
+				t.Fatalf("delivery was not blocked: %+v", delivery)
+			}
+		})
+	}
+}
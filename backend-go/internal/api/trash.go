@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backend-go/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashTypes maps the resource segment of trash routes to trash resource types
+var trashTypes = map[string]string{
+	"forms":     services.TrashForm,
+	"responses": services.TrashResponse,
+}
+
+// ListTrash returns the organization's deleted forms and responses with the time each
+// will be purged. ?type=forms or ?type=responses narrows the listing.
+func ListTrash(trash *services.TrashService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		resourceType := ""
+		if value := c.Query("type"); value != "" {
+			var ok bool
+			if resourceType, ok = trashTypes[value]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be forms or responses"})
+				return
+			}
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+
+		items, err := trash.List(c.Request.Context(), orgID.(string), resourceType, limit)
+		if err != nil {
+			log.Printf("TRASH: failed to list trash: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list trash"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"count": len(items), "results": items})
+	}
+}
+
+// RestoreFromTrash restores a deleted form or response. Restoring a form also reactivates
+// the share links its deletion switched off.
+func RestoreFromTrash(trash *services.TrashService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+		userID, _ := c.Get("userID")
+
+		resourceType, ok := trashTypes[c.Param("type")]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown trash resource type"})
+			return
+		}
+
+		err := trash.Restore(c.Request.Context(), orgID.(string), userID.(string), resourceType, c.Param("id"))
+		if errors.Is(err, services.ErrTrashItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "item not found in trash"})
+			return
+		}
+		if err != nil {
+			log.Printf("TRASH: failed to restore %s %s: %v", resourceType, c.Param("id"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore item"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": resourceType + " restored", "id": c.Param("id")})
+	}
+}
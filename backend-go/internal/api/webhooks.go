@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// CreateWebhookSubscription registers a webhook endpoint for the caller's organization.
+// The signing secret is only returned in this response; it is stored encrypted.
+func CreateWebhookSubscription(client *firestore.Client, encryptor *services.FieldEncryptor, webhooks *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		orgID, _ := c.Get("organizationID")
+
+		var request struct {
+			URL         string   `json:"url" binding:"required"`
+			Events      []string `json:"events" binding:"required"`
+			PayloadMode string   `json:"payload_mode"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret, err := services.GenerateWebhookSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate webhook secret"})
+			return
+		}
+
+		now := time.Now().UTC()
+		sub := data.WebhookSubscription{
+			OrganizationID: orgID.(string),
+			URL:            request.URL,
+			Events:         request.Events,
+			PayloadMode:    request.PayloadMode,
+			IsActive:       true,
+			CreatedBy:      userID.(string),
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if err := webhooks.ValidateSubscription(&sub); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		docRef := client.Collection("webhook_subscriptions").NewDoc()
+		sub.SealedSecret, err = encryptor.SealWebhookSecret(c.Request.Context(), sub.OrganizationID, docRef.ID, secret)
+		if err != nil {
+			log.Printf("WEBHOOK: failed to encrypt signing secret: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create webhook subscription"})
+			return
+		}
+		if _, err := docRef.Create(c.Request.Context(), sub); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create webhook subscription"})
+			return
+		}
+		sub.ID = docRef.ID
+
+		c.JSON(http.StatusCreated, gin.H{
+			"subscription": sub,
+			"secret":       secret,
+		})
+	}
+}
+
+// ListWebhookSubscriptions lists the organization's webhook subscriptions
+func ListWebhookSubscriptions(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		subs := []data.WebhookSubscription{}
+		iter := client.Collection("webhook_subscriptions").Where("organizationId", "==", orgID.(string)).Documents(c.Request.Context())
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhook subscriptions"})
+				return
+			}
+
+			var sub data.WebhookSubscription
+			if err := doc.DataTo(&sub); err != nil {
+				log.Printf("Failed to parse webhook subscription %s: %v", doc.Ref.ID, err)
+				continue
+			}
+			sub.ID = doc.Ref.ID
+			subs = append(subs, sub)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"count": len(subs), "results": subs})
+	}
+}
+
+// DeleteWebhookSubscription deactivates a webhook subscription. Queued deliveries
+// for it are dead-lettered by the worker.
+func DeleteWebhookSubscription(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+
+		ref := client.Collection("webhook_subscriptions").Doc(subID)
+		doc, err := ref.Get(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook subscription not found"})
+			return
+		}
+
+		var sub data.WebhookSubscription
+		if err := doc.DataTo(&sub); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to parse webhook subscription"})
+			return
+		}
+		if sub.OrganizationID != orgID.(string) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook subscription not found"})
+			return
+		}
+
+		_, err = ref.Update(c.Request.Context(), []firestore.Update{
+			{Path: "is_active", Value: false},
+			{Path: "updated_at", Value: time.Now().UTC()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete webhook subscription"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeadLetters lists deliveries that exhausted their retries
+func ListWebhookDeadLetters(client *firestore.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _ := c.Get("organizationID")
+
+		deliveries := []data.WebhookDelivery{}
+		iter := client.Collection("webhook_dead_letters").Where("organizationId", "==", orgID.(string)).Documents(c.Request.Context())
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list dead letters"})
+				return
+			}
+
+			var delivery data.WebhookDelivery
+			if err := doc.DataTo(&delivery); err != nil {
+				log.Printf("Failed to parse dead letter %s: %v", doc.Ref.ID, err)
+				continue
+			}
+			delivery.ID = doc.Ref.ID
+			// Payloads can carry FHIR resources; the list only needs delivery metadata
+			delivery.Payload = nil
+			deliveries = append(deliveries, delivery)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"count": len(deliveries), "results": deliveries})
+	}
+}
+
+// ReplayWebhookDeadLetter re-queues a dead-lettered delivery
+func ReplayWebhookDeadLetter(webhooks *services.WebhookService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID := c.Param("id")
+		orgID, _ := c.Get("organizationID")
+
+		if err := webhooks.Replay(c.Request.Context(), orgID.(string), deliveryID); err != nil {
+			if errors.Is(err, services.ErrDeadLetterNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to replay delivery"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "delivery re-queued", "id": deliveryID})
+	}
+}
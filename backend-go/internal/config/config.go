@@ -0,0 +1,346 @@
+// Package config loads the server configuration into a typed struct. Values are layered:
+// built-in defaults for the ENVIRONMENT profile, then an optional YAML file (CONFIG_FILE),
+// then environment variables. Load validates the result so a bad deployment fails at
+// startup with every problem listed, not on the first request that needs a setting.
+//
+// Logging (LOG_*) and tracing (OTEL_*) are configured before the config is loaded and read
+// their variables directly.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles with built-in defaults. ENVIRONMENT selects one; unknown values are rejected.
+const (
+	ProfileDevelopment = "development"
+	ProfileStaging     = "staging"
+	ProfileProduction  = "production"
+	// ProfileDev runs offline: Firestore, Redis, Firebase Auth, Vertex AI and Gotenberg
+	// are replaced by in-process fakes, so no Google Cloud credentials are needed
+	ProfileDev = "dev"
+)
+
+// Config is the effective server configuration
+type Config struct {
+	// Environment is the active profile. It comes only from ENVIRONMENT, because other
+	// packages read that variable directly to decide production behaviour.
+	Environment string `yaml:"environment"`
+
+	Server        ServerConfig        `yaml:"server"`
+	GCP           GCPConfig           `yaml:"gcp"`
+	AI            AIConfig            `yaml:"ai"`
+	Redis         RedisConfig         `yaml:"redis"`
+	Gotenberg     GotenbergConfig     `yaml:"gotenberg"`
+	Session       SessionConfig       `yaml:"session"`
+	RateLimits    RateLimitsConfig    `yaml:"rate_limits"`
+	Attachments   AttachmentsConfig   `yaml:"attachments"`
+	Keys          KeysConfig          `yaml:"keys"`
+	Audit         AuditConfig         `yaml:"audit"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Admin         AdminConfig         `yaml:"admin"`
+	Migrations    MigrationsConfig    `yaml:"migrations"`
+	Trash         TrashConfig         `yaml:"trash"`
+	Idempotency   IdempotencyConfig   `yaml:"idempotency"`
+	Duplicates    DuplicatesConfig    `yaml:"duplicates"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+	Dev           DevConfig           `yaml:"dev"`
+}
+
+// ServerConfig covers the HTTP listener and browser-facing settings
+type ServerConfig struct {
+	Port               string   `yaml:"port"`
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+	// AppBaseURL is the frontend origin used in links sent to patients
+	AppBaseURL string `yaml:"app_base_url"`
+	// ShutdownTimeout bounds the drain after SIGTERM. Cloud Run kills the container
+	// 10 seconds after the signal, so the default stays just under that.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// GCPConfig identifies the Google Cloud project and region
+type GCPConfig struct {
+	ProjectID string `yaml:"project_id"`
+	Location  string `yaml:"location"`
+}
+
+// AIConfig names the Vertex AI models
+type AIConfig struct {
+	// Model serves clinical summaries and PDF-to-form extraction
+	Model string `yaml:"model"`
+	// InsuranceCardModel serves insurance card OCR
+	InsuranceCardModel string `yaml:"insurance_card_model"`
+}
+
+// RedisConfig configures the shared Redis client
+type RedisConfig struct {
+	Addr       string `yaml:"addr"`
+	Password   Secret `yaml:"password"`
+	TLSEnabled bool   `yaml:"tls_enabled"`
+}
+
+// GotenbergConfig locates the PDF converter
+type GotenbergConfig struct {
+	URL string `yaml:"url"`
+}
+
+// SessionConfig controls login sessions and their cookie
+type SessionConfig struct {
+	TTL          time.Duration `yaml:"ttl"`
+	CookieDomain string        `yaml:"cookie_domain"`
+	// ProxiedOrigins are custom domains served through the Firebase Hosting proxy; they
+	// are same-origin for cookie purposes, like *.web.app and *.firebaseapp.com
+	ProxiedOrigins []string `yaml:"proxied_origins"`
+}
+
+// RateLimit is one sliding-window limit
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Window   time.Duration `yaml:"window"`
+	Burst    int           `yaml:"burst"`
+}
+
+// RateLimitsConfig holds the limit applied to each class of endpoint
+type RateLimitsConfig struct {
+	Auth RateLimit `yaml:"auth"`
+	API  RateLimit `yaml:"api"`
+	PDF  RateLimit `yaml:"pdf"`
+}
+
+// AttachmentsConfig selects the attachment blob store
+type AttachmentsConfig struct {
+	Store  string `yaml:"store"` // local or gcs
+	Bucket string `yaml:"bucket"`
+	Dir    string `yaml:"dir"`
+}
+
+// KeysConfig selects the key-encryption-key provider
+type KeysConfig struct {
+	Provider     string `yaml:"provider"` // local or kms
+	KMSKeyName   string `yaml:"kms_key_name"`
+	LocalKeyFile string `yaml:"local_key_file"`
+	// GenerateLocalKEK creates the keyfile with a fresh KEK when it is missing; dev only
+	GenerateLocalKEK bool `yaml:"generate_local_kek"`
+}
+
+// AuditConfig selects the audit trail sinks
+type AuditConfig struct {
+	Sinks   []string `yaml:"sinks"` // cloud, firestore, file
+	LogFile string   `yaml:"log_file"`
+}
+
+// NotificationsConfig selects the reminder delivery provider
+type NotificationsConfig struct {
+	Provider string `yaml:"provider"`
+}
+
+// MetricsConfig protects the Prometheus endpoint
+type MetricsConfig struct {
+	// Token, when set, must be sent as a bearer token to scrape /metrics
+	Token Secret `yaml:"token"`
+}
+
+// AdminConfig lists the users allowed on deployment-wide admin endpoints
+type AdminConfig struct {
+	UserIDs []string `yaml:"user_ids"`
+}
+
+// MigrationsConfig controls the Firestore schema migrations
+type MigrationsConfig struct {
+	// RunOnStartup applies pending migrations before the server accepts requests. When it
+	// is off they are applied with `admin migrate run`.
+	RunOnStartup bool `yaml:"run_on_startup"`
+	// BatchSize is the number of documents processed between checkpoints
+	BatchSize int `yaml:"batch_size"`
+}
+
+// TrashConfig controls soft-deleted forms and responses
+type TrashConfig struct {
+	// GracePeriod is how long deleted items stay restorable before they are purged
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+// IdempotencyConfig controls replay of requests retried with the same Idempotency-Key
+type IdempotencyConfig struct {
+	// TTL is how long the first response to a key is kept and replayed
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// DuplicatesConfig controls duplicate detection for submitted responses
+type DuplicatesConfig struct {
+	// Window is how far back earlier responses from the same patient are compared
+	Window time.Duration `yaml:"window"`
+	// MinSimilarity is the share of answers that must match for a response to be flagged
+	MinSimilarity float64 `yaml:"min_similarity"`
+}
+
+// WebhooksConfig controls outgoing webhook deliveries
+type WebhooksConfig struct {
+	// AllowLoopback lets subscriptions target this machine, for receivers run during local
+	// development. Every other profile delivers to public addresses only.
+	AllowLoopback bool `yaml:"allow_loopback"`
+}
+
+// DevConfig applies to the dev profile only
+type DevConfig struct {
+	// FirestoreAddr and RedisAddr are the loopback addresses the in-memory Firestore and
+	// Redis listen on, so cmd/seed and cmd/admin can reach them from another process
+	FirestoreAddr string `yaml:"firestore_addr"`
+	RedisAddr     string `yaml:"redis_addr"`
+	// UserID is the account the seed data belongs to and the default for dev tokens
+	UserID string `yaml:"user_id"`
+	// Seed loads the sample forms and responses at startup
+	Seed bool `yaml:"seed"`
+}
+
+// Offline reports whether the dev profile's in-process fakes replace external services
+func (c *Config) Offline() bool {
+	return c.Environment == ProfileDev
+}
+
+// Secret is a configuration value that is never printed. String, JSON and YAML output
+// all show a placeholder; call Value for the real value.
+type Secret string
+
+const redactedSecret = "[REDACTED]"
+
+// Value returns the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns a placeholder, or "" when the secret is unset
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// MarshalYAML prints the placeholder
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+// MarshalJSON prints the placeholder
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// Load builds the configuration for the ENVIRONMENT profile from defaults, CONFIG_FILE and
+// the environment, and validates it. ENVIRONMENT defaults to development, except on Cloud
+// Run (K_SERVICE is set) where it must be explicit.
+func Load() (*Config, error) {
+	profile := os.Getenv("ENVIRONMENT")
+	if profile == "" {
+		if service := os.Getenv("K_SERVICE"); service != "" {
+			return nil, fmt.Errorf("ENVIRONMENT is not set on Cloud Run service %s; refusing to start with the development profile", service)
+		}
+		profile = ProfileDevelopment
+	}
+	cfg, err := defaults(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile layers a YAML file over cfg: the base document first, then the section under
+// profiles.<environment>. Unknown keys are rejected so typos do not pass silently.
+func (c *Config) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// The base document and the profile section share the Config layout
+	var file struct {
+		Config   `yaml:",inline"`
+		Profiles map[string]yaml.Node `yaml:"profiles"`
+	}
+	file.Config = *c
+	if err := decodeStrict(raw, &file); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if file.Config.Environment != c.Environment {
+		return fmt.Errorf("config file %s: environment is selected by the ENVIRONMENT variable, not the file", path)
+	}
+	*c = file.Config
+
+	if node, ok := file.Profiles[c.Environment]; ok {
+		section, err := yaml.Marshal(&node)
+		if err == nil {
+			err = decodeStrict(section, c)
+		}
+		if err != nil {
+			return fmt.Errorf("config file %s: profiles.%s: %w", path, c.Environment, err)
+		}
+		if c.Environment != file.Config.Environment {
+			return fmt.Errorf("config file %s: profiles.%s may not set environment", path, file.Config.Environment)
+		}
+	}
+	return nil
+}
+
+// decodeStrict decodes YAML into out, rejecting unknown keys. An empty document is valid.
+func decodeStrict(raw []byte, out interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// String renders the configuration as YAML with secrets redacted
+func (c *Config) String() string {
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(out)
+}
+
+// Redacted returns the configuration as a generic map with secrets replaced by a
+// placeholder, for the admin endpoint and startup logs
+func (c *Config) Redacted() map[string]interface{} {
+	var view map[string]interface{}
+	if err := yaml.Unmarshal([]byte(c.String()), &view); err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	return view
+}
+
+// splitList parses a list variable separated by commas or semicolons
+func splitList(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' })
+	list := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			list = append(list, field)
+		}
+	}
+	return list
+}
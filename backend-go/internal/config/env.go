@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// envBinding maps one environment variable onto the config
+type envBinding struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+func stringVar(target func(c *Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*target(c) = value
+		return nil
+	}
+}
+
+func secretVar(target func(c *Config) *Secret) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*target(c) = Secret(value)
+		return nil
+	}
+}
+
+func listVar(target func(c *Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*target(c) = splitList(value)
+		return nil
+	}
+}
+
+func boolVar(target func(c *Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("not a boolean: %q", value)
+		}
+		*target(c) = parsed
+		return nil
+	}
+}
+
+func intVar(target func(c *Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("not an integer: %q", value)
+		}
+		*target(c) = parsed
+		return nil
+	}
+}
+
+func floatVar(target func(c *Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("not a number: %q", value)
+		}
+		*target(c) = parsed
+		return nil
+	}
+}
+
+func durationVar(target func(c *Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("not a duration: %q", value)
+		}
+		*target(c) = parsed
+		return nil
+	}
+}
+
+func rateLimitVars(prefix string, limit func(c *Config) *RateLimit) []envBinding {
+	return []envBinding{
+		{prefix + "_REQUESTS", intVar(func(c *Config) *int { return &limit(c).Requests })},
+		{prefix + "_WINDOW", durationVar(func(c *Config) *time.Duration { return &limit(c).Window })},
+		{prefix + "_BURST", intVar(func(c *Config) *int { return &limit(c).Burst })},
+	}
+}
+
+// envBindings lists every variable the config reads, in the order they are applied
+var envBindings = append([]envBinding{
+	{"PORT", stringVar(func(c *Config) *string { return &c.Server.Port })},
+	{"CORS_ALLOWED_ORIGINS", listVar(func(c *Config) *[]string { return &c.Server.CORSAllowedOrigins })},
+	{"APP_BASE_URL", stringVar(func(c *Config) *string { return &c.Server.AppBaseURL })},
+	{"SHUTDOWN_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"GCP_PROJECT_ID", stringVar(func(c *Config) *string { return &c.GCP.ProjectID })},
+	{"GCP_LOCATION", stringVar(func(c *Config) *string { return &c.GCP.Location })},
+	{"VERTEX_MODEL", stringVar(func(c *Config) *string { return &c.AI.Model })},
+	{"VERTEX_INSURANCE_CARD_MODEL", stringVar(func(c *Config) *string { return &c.AI.InsuranceCardModel })},
+	{"REDIS_ADDR", stringVar(func(c *Config) *string { return &c.Redis.Addr })},
+	{"REDIS_PASSWORD", secretVar(func(c *Config) *Secret { return &c.Redis.Password })},
+	{"REDIS_TLS_ENABLED", boolVar(func(c *Config) *bool { return &c.Redis.TLSEnabled })},
+	{"GOTENBERG_URL", stringVar(func(c *Config) *string { return &c.Gotenberg.URL })},
+	{"SESSION_TTL", durationVar(func(c *Config) *time.Duration { return &c.Session.TTL })},
+	{"COOKIE_DOMAIN", stringVar(func(c *Config) *string { return &c.Session.CookieDomain })},
+	{"SESSION_PROXIED_ORIGINS", listVar(func(c *Config) *[]string { return &c.Session.ProxiedOrigins })},
+	{"ATTACHMENT_STORE", stringVar(func(c *Config) *string { return &c.Attachments.Store })},
+	{"ATTACHMENT_BUCKET", stringVar(func(c *Config) *string { return &c.Attachments.Bucket })},
+	{"ATTACHMENT_DIR", stringVar(func(c *Config) *string { return &c.Attachments.Dir })},
+	{"KEY_PROVIDER", stringVar(func(c *Config) *string { return &c.Keys.Provider })},
+	{"KMS_KEY_NAME", stringVar(func(c *Config) *string { return &c.Keys.KMSKeyName })},
+	{"LOCAL_KEY_FILE", stringVar(func(c *Config) *string { return &c.Keys.LocalKeyFile })},
+	{"GENERATE_LOCAL_KEK", boolVar(func(c *Config) *bool { return &c.Keys.GenerateLocalKEK })},
+	{"AUDIT_SINKS", listVar(func(c *Config) *[]string { return &c.Audit.Sinks })},
+	{"AUDIT_LOG_FILE", stringVar(func(c *Config) *string { return &c.Audit.LogFile })},
+	{"NOTIFICATION_PROVIDER", stringVar(func(c *Config) *string { return &c.Notifications.Provider })},
+	{"METRICS_TOKEN", secretVar(func(c *Config) *Secret { return &c.Metrics.Token })},
+	{"ADMIN_USER_IDS", listVar(func(c *Config) *[]string { return &c.Admin.UserIDs })},
+	{"MIGRATIONS_RUN_ON_STARTUP", boolVar(func(c *Config) *bool { return &c.Migrations.RunOnStartup })},
+	{"MIGRATIONS_BATCH_SIZE", intVar(func(c *Config) *int { return &c.Migrations.BatchSize })},
+	{"TRASH_GRACE_PERIOD", durationVar(func(c *Config) *time.Duration { return &c.Trash.GracePeriod })},
+	{"IDEMPOTENCY_TTL", durationVar(func(c *Config) *time.Duration { return &c.Idempotency.TTL })},
+	{"DUPLICATES_WINDOW", durationVar(func(c *Config) *time.Duration { return &c.Duplicates.Window })},
+	{"DUPLICATES_MIN_SIMILARITY", floatVar(func(c *Config) *float64 { return &c.Duplicates.MinSimilarity })},
+	{"WEBHOOKS_ALLOW_LOOPBACK", boolVar(func(c *Config) *bool { return &c.Webhooks.AllowLoopback })},
+	{"DEV_FIRESTORE_ADDR", stringVar(func(c *Config) *string { return &c.Dev.FirestoreAddr })},
+	{"DEV_REDIS_ADDR", stringVar(func(c *Config) *string { return &c.Dev.RedisAddr })},
+	{"DEV_USER_ID", stringVar(func(c *Config) *string { return &c.Dev.UserID })},
+	{"DEV_SEED", boolVar(func(c *Config) *bool { return &c.Dev.Seed })},
+}, append(append(
+	rateLimitVars("RATE_LIMIT_AUTH", func(c *Config) *RateLimit { return &c.RateLimits.Auth }),
+	rateLimitVars("RATE_LIMIT_API", func(c *Config) *RateLimit { return &c.RateLimits.API })...),
+	rateLimitVars("RATE_LIMIT_PDF", func(c *Config) *RateLimit { return &c.RateLimits.PDF })...)...)
+
+// applyEnv overrides cfg with every bound variable that is set and non-empty
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, binding := range envBindings {
+		value, ok := lookup(binding.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := binding.apply(c, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", binding.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
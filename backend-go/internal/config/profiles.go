@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// productionOrigins are the deployed frontends
+var productionOrigins = []string{
+	"https://healthcare-forms-v2.web.app",
+	"https://healthcare-forms-v2.firebaseapp.com",
+	"https://form.easydocforms.com",
+}
+
+// defaults returns the built-in configuration for a profile
+func defaults(profile string) (*Config, error) {
+	cfg := &Config{
+		Environment: profile,
+		Server: ServerConfig{
+			Port:               "8080",
+			CORSAllowedOrigins: []string{"http://localhost:3000"},
+			AppBaseURL:         "http://localhost:3000",
+			ShutdownTimeout:    9 * time.Second,
+		},
+		GCP: GCPConfig{
+			Location: "us-central1",
+		},
+		AI: AIConfig{
+			Model:              "gemini-2.5-pro",
+			InsuranceCardModel: "gemini-2.5-flash",
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Gotenberg: GotenbergConfig{
+			URL: "http://localhost:3000",
+		},
+		Session: SessionConfig{
+			TTL:            5 * 24 * time.Hour,
+			ProxiedOrigins: []string{"form.easydocforms.com"},
+		},
+		RateLimits: RateLimitsConfig{
+			Auth: RateLimit{Requests: 5, Window: time.Minute, Burst: 2},
+			API:  RateLimit{Requests: 100, Window: time.Minute, Burst: 10},
+			PDF:  RateLimit{Requests: 10, Window: time.Minute, Burst: 2},
+		},
+		Attachments: AttachmentsConfig{
+			Store: "local",
+			Dir:   "data/attachments",
+		},
+		Keys: KeysConfig{
+			Provider:     "local",
+			LocalKeyFile: "data/keys/local-kek.json",
+		},
+		Audit: AuditConfig{
+			Sinks:   []string{"cloud", "firestore"},
+			LogFile: "data/audit/audit.log",
+		},
+		Notifications: NotificationsConfig{
+			Provider: "log",
+		},
+		Migrations: MigrationsConfig{
+			RunOnStartup: true,
+			BatchSize:    200,
+		},
+		Trash: TrashConfig{
+			GracePeriod: 30 * 24 * time.Hour,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+		Duplicates: DuplicatesConfig{
+			Window:        72 * time.Hour,
+			MinSimilarity: 0.5,
+		},
+	}
+
+	switch profile {
+	case ProfileDevelopment:
+		cfg.Keys.GenerateLocalKEK = true
+		cfg.Webhooks.AllowLoopback = true
+	case ProfileDev:
+		cfg.Keys.GenerateLocalKEK = true
+		cfg.GCP.ProjectID = "demo-healthcare-forms"
+		cfg.Audit.Sinks = []string{"firestore", "file"}
+		cfg.Dev = DevConfig{
+			FirestoreAddr: "127.0.0.1:8686",
+			RedisAddr:     "127.0.0.1:8687",
+			UserID:        "dev-user",
+			Seed:          true,
+		}
+		cfg.Admin.UserIDs = []string{cfg.Dev.UserID}
+	case ProfileStaging:
+		cfg.Server.CORSAllowedOrigins = append([]string{"http://localhost:3000"}, productionOrigins...)
+	case ProfileProduction:
+		cfg.Server.CORSAllowedOrigins = append([]string(nil), productionOrigins...)
+		cfg.Server.AppBaseURL = "https://form.easydocforms.com"
+		// Cloud Run instances have no persistent disk
+		cfg.Attachments.Store = "gcs"
+		cfg.Keys.Provider = "kms"
+		// Production migrations are applied by the deploy pipeline with cmd/admin
+		cfg.Migrations.RunOnStartup = false
+	default:
+		return nil, fmt.Errorf("unknown ENVIRONMENT %q (want %s, %s, %s or %s)", profile, ProfileDev, ProfileDevelopment, ProfileStaging, ProfileProduction)
+	}
+	return cfg, nil
+}
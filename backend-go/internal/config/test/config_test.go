@@ -0,0 +1,210 @@
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"backend-go/internal/config"
+)
+
+// setEnv clears every variable Load reads, then applies vars
+func setEnv(t *testing.T, vars map[string]string) {
+	for _, name := range []string{"ENVIRONMENT", "CONFIG_FILE", "GCP_PROJECT_ID", "CORS_ALLOWED_ORIGINS",
+		"REDIS_PASSWORD", "SESSION_TTL", "RATE_LIMIT_PDF_REQUESTS", "KEY_PROVIDER", "KMS_KEY_NAME",
+		"ATTACHMENT_STORE", "ATTACHMENT_BUCKET", "PORT", "METRICS_TOKEN", "GOTENBERG_URL", "APP_BASE_URL",
+		"GENERATE_LOCAL_KEK", "K_SERVICE", "WEBHOOKS_ALLOW_LOOPBACK"} {
+		t.Setenv(name, "")
+	}
+	for name, value := range vars {
+		t.Setenv(name, value)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadLayersProfileFileAndEnv(t *testing.T) {
+	path := writeFile(t, `
+gotenberg:
+  url: http://gotenberg:3000
+rate_limits:
+  pdf:
+    requests: 20
+profiles:
+  production:
+    session:
+      ttl: 8h
+`)
+	setEnv(t, map[string]string{
+		"ENVIRONMENT":             "production",
+		"CONFIG_FILE":             path,
+		"GCP_PROJECT_ID":          "forms-prod",
+		"ATTACHMENT_BUCKET":       "forms-prod-attachments",
+		"KMS_KEY_NAME":            "projects/forms-prod/locations/us-central1/keyRings/forms/cryptoKeys/kek",
+		"CORS_ALLOWED_ORIGINS":    "https://a.example.com;https://b.example.com",
+		"RATE_LIMIT_PDF_REQUESTS": "30",
+	})
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Gotenberg.URL != "http://gotenberg:3000" {
+		t.Errorf("file value not applied: %q", cfg.Gotenberg.URL)
+	}
+	if cfg.Session.TTL != 8*time.Hour {
+		t.Errorf("profile section not applied: %v", cfg.Session.TTL)
+	}
+	if cfg.RateLimits.PDF.Requests != 30 || cfg.RateLimits.PDF.Window != time.Minute {
+		t.Errorf("env should override the file and keep defaults: %+v", cfg.RateLimits.PDF)
+	}
+	if len(cfg.Server.CORSAllowedOrigins) != 2 {
+		t.Errorf("expected two origins, got %v", cfg.Server.CORSAllowedOrigins)
+	}
+	if cfg.Server.AppBaseURL != "https://form.easydocforms.com" {
+		t.Errorf("production profile default not applied: %q", cfg.Server.AppBaseURL)
+	}
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	setEnv(t, map[string]string{
+		"PORT":         "eighty",
+		"SESSION_TTL":  "720h",
+		"KEY_PROVIDER": "kms",
+	})
+
+	_, err := config.Load()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"GCP_PROJECT_ID (gcp.project_id)", "PORT (server.port)", "SESSION_TTL (session.ttl)", "KMS_KEY_NAME (keys.kms_key_name)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestProductionRequiresCloudStorage(t *testing.T) {
+	setEnv(t, map[string]string{
+		"ENVIRONMENT":      "production",
+		"GCP_PROJECT_ID":   "forms-prod",
+		"ATTACHMENT_STORE": "local",
+	})
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "ATTACHMENT_STORE (attachments.store): must be gcs in production") {
+		t.Fatalf("expected the local attachment store to be rejected in production, got %v", err)
+	}
+
+	setEnv(t, map[string]string{"ENVIRONMENT": "production", "GCP_PROJECT_ID": "forms-prod"})
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "ATTACHMENT_BUCKET (attachments.bucket)") {
+		t.Fatalf("expected production to default to gcs and require a bucket, got %v", err)
+	}
+}
+
+func TestProductionRequiresKMS(t *testing.T) {
+	prod := map[string]string{
+		"ENVIRONMENT":       "production",
+		"GCP_PROJECT_ID":    "forms-prod",
+		"ATTACHMENT_BUCKET": "forms-prod-attachments",
+	}
+	setEnv(t, prod)
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "KMS_KEY_NAME (keys.kms_key_name)") {
+		t.Fatalf("expected production to default to kms and require a key name, got %v", err)
+	}
+
+	prod["KEY_PROVIDER"] = "local"
+	prod["GENERATE_LOCAL_KEK"] = "true"
+	setEnv(t, prod)
+	_, err := config.Load()
+	for _, want := range []string{"KEY_PROVIDER (keys.provider): must be kms in production", "GENERATE_LOCAL_KEK (keys.generate_local_kek)"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q, got %v", want, err)
+		}
+	}
+
+	setEnv(t, map[string]string{"GCP_PROJECT_ID": "forms-dev"})
+	cfg, err := config.Load()
+	if err != nil || cfg.Keys.Provider != "local" || !cfg.Keys.GenerateLocalKEK {
+		t.Fatalf("development should generate a local KEK: %+v %v", cfg.Keys, err)
+	}
+}
+
+func TestLoopbackWebhooksOnlyInDevelopment(t *testing.T) {
+	setEnv(t, map[string]string{"GCP_PROJECT_ID": "forms-dev"})
+	cfg, err := config.Load()
+	if err != nil || !cfg.Webhooks.AllowLoopback {
+		t.Fatalf("development should allow loopback webhooks: %+v %v", cfg.Webhooks, err)
+	}
+
+	staging := map[string]string{"ENVIRONMENT": "staging", "GCP_PROJECT_ID": "forms-staging"}
+	setEnv(t, staging)
+	cfg, err = config.Load()
+	if err != nil || cfg.Webhooks.AllowLoopback {
+		t.Fatalf("staging should only deliver to public addresses: %+v %v", cfg.Webhooks, err)
+	}
+
+	staging["WEBHOOKS_ALLOW_LOOPBACK"] = "true"
+	setEnv(t, staging)
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "WEBHOOKS_ALLOW_LOOPBACK (webhooks.allow_loopback)") {
+		t.Fatalf("expected loopback webhooks to be rejected in staging, got %v", err)
+	}
+}
+
+func TestCloudRunRequiresExplicitProfile(t *testing.T) {
+	setEnv(t, map[string]string{"GCP_PROJECT_ID": "forms-prod", "K_SERVICE": "healthcare-forms-backend-go"})
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "ENVIRONMENT is not set") {
+		t.Fatalf("expected an implicit profile to be rejected on Cloud Run, got %v", err)
+	}
+
+	setEnv(t, map[string]string{"GCP_PROJECT_ID": "forms-staging", "K_SERVICE": "healthcare-forms-backend-go", "ENVIRONMENT": "staging"})
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("explicit profile on Cloud Run: %v", err)
+	}
+}
+
+func TestUnknownFileKeysAreRejected(t *testing.T) {
+	setEnv(t, map[string]string{
+		"GCP_PROJECT_ID": "forms-dev",
+		"CONFIG_FILE":    writeFile(t, "gotenburg:\n  url: http://localhost:3000\n"),
+	})
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "gotenburg") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestSecretsAreRedactedWhenPrinted(t *testing.T) {
+	setEnv(t, map[string]string{
+		"GCP_PROJECT_ID": "forms-dev",
+		"REDIS_PASSWORD": "hunter2-redis",
+		"METRICS_TOKEN":  "scrape-token",
+	})
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Redis.Password.Value() != "hunter2-redis" {
+		t.Fatalf("secret value not loaded")
+	}
+
+	view, err := json.Marshal(cfg.Redacted())
+	if err != nil {
+		t.Fatalf("marshal redacted view: %v", err)
+	}
+	for _, printed := range []string{cfg.String(), fmt.Sprintf("%v", *cfg), fmt.Sprintf("%+v", cfg.Redis), string(view)} {
+		if strings.Contains(printed, "hunter2-redis") || strings.Contains(printed, "scrape-token") {
+			t.Errorf("secret leaked in output:\n%s", printed)
+		}
+	}
+	if !strings.Contains(string(view), "forms-dev") {
+		t.Errorf("non-secret values missing from redacted view: %s", view)
+	}
+}
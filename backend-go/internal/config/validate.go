@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Firebase session cookies must last between five minutes and two weeks
+const (
+	minSessionTTL = 5 * time.Minute
+	maxSessionTTL = 14 * 24 * time.Hour
+)
+
+// Validate reports every invalid setting at once. Messages name the environment
+// variable and the YAML key so either source can be fixed.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(env, key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s (%s): %s", env, key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.GCP.ProjectID == "" {
+		fail("GCP_PROJECT_ID", "gcp.project_id", "is required")
+	}
+	if c.GCP.Location == "" {
+		fail("GCP_LOCATION", "gcp.location", "is required")
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT", "server.port", "must be a port number, got %q", c.Server.Port)
+	}
+	if len(c.Server.CORSAllowedOrigins) == 0 {
+		fail("CORS_ALLOWED_ORIGINS", "server.cors_allowed_origins", "needs at least one origin")
+	}
+	for _, origin := range c.Server.CORSAllowedOrigins {
+		if err := checkURL(origin); err != nil {
+			fail("CORS_ALLOWED_ORIGINS", "server.cors_allowed_origins", "%q: %v", origin, err)
+		}
+	}
+	if err := checkURL(c.Server.AppBaseURL); err != nil {
+		fail("APP_BASE_URL", "server.app_base_url", "%v", err)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("SHUTDOWN_TIMEOUT", "server.shutdown_timeout", "must be positive, got %v", c.Server.ShutdownTimeout)
+	}
+
+	if c.AI.Model == "" {
+		fail("VERTEX_MODEL", "ai.model", "is required")
+	}
+	if c.AI.InsuranceCardModel == "" {
+		fail("VERTEX_INSURANCE_CARD_MODEL", "ai.insurance_card_model", "is required")
+	}
+	if c.Redis.Addr == "" {
+		fail("REDIS_ADDR", "redis.addr", "is required")
+	}
+	if err := checkURL(c.Gotenberg.URL); err != nil {
+		fail("GOTENBERG_URL", "gotenberg.url", "%v", err)
+	}
+
+	if c.Session.TTL < minSessionTTL || c.Session.TTL > maxSessionTTL {
+		fail("SESSION_TTL", "session.ttl", "must be between %v and %v, got %v", minSessionTTL, maxSessionTTL, c.Session.TTL)
+	}
+
+	limits := []struct {
+		name  string
+		limit RateLimit
+	}{{"AUTH", c.RateLimits.Auth}, {"API", c.RateLimits.API}, {"PDF", c.RateLimits.PDF}}
+	for _, entry := range limits {
+		name, limit := entry.name, entry.limit
+		key := "rate_limits." + strings.ToLower(name)
+		if limit.Requests < 1 {
+			fail("RATE_LIMIT_"+name+"_REQUESTS", key+".requests", "must be at least 1")
+		}
+		if limit.Window < time.Second {
+			fail("RATE_LIMIT_"+name+"_WINDOW", key+".window", "must be at least 1s")
+		}
+		if limit.Burst < 0 {
+			fail("RATE_LIMIT_"+name+"_BURST", key+".burst", "must not be negative")
+		}
+	}
+
+	switch c.Attachments.Store {
+	case "local":
+		if c.Environment == ProfileProduction {
+			fail("ATTACHMENT_STORE", "attachments.store", "must be gcs in production; local blobs are lost when an instance is replaced")
+		}
+		if c.Attachments.Dir == "" {
+			fail("ATTACHMENT_DIR", "attachments.dir", "is required when the store is local")
+		}
+	case "gcs":
+		if c.Attachments.Bucket == "" {
+			fail("ATTACHMENT_BUCKET", "attachments.bucket", "is required when the store is gcs")
+		}
+	default:
+		fail("ATTACHMENT_STORE", "attachments.store", "must be local or gcs, got %q", c.Attachments.Store)
+	}
+
+	switch c.Keys.Provider {
+	case "local":
+		if c.Environment == ProfileProduction {
+			fail("KEY_PROVIDER", "keys.provider", "must be kms in production; a keyfile on disk does not protect PHI")
+		}
+		if c.Keys.LocalKeyFile == "" {
+			fail("LOCAL_KEY_FILE", "keys.local_key_file", "is required when the provider is local")
+		}
+	case "kms":
+		if c.Keys.KMSKeyName == "" {
+			fail("KMS_KEY_NAME", "keys.kms_key_name", "is required when the provider is kms")
+		}
+	default:
+		fail("KEY_PROVIDER", "keys.provider", "must be local or kms, got %q", c.Keys.Provider)
+	}
+	if c.Keys.GenerateLocalKEK && (c.Environment == ProfileStaging || c.Environment == ProfileProduction) {
+		fail("GENERATE_LOCAL_KEK", "keys.generate_local_kek", "is only allowed in the dev and development profiles")
+	}
+	if c.Webhooks.AllowLoopback && (c.Environment == ProfileStaging || c.Environment == ProfileProduction) {
+		fail("WEBHOOKS_ALLOW_LOOPBACK", "webhooks.allow_loopback", "is only allowed in the dev and development profiles")
+	}
+
+	for _, sink := range c.Audit.Sinks {
+		switch sink {
+		case "cloud", "firestore", "file":
+		default:
+			fail("AUDIT_SINKS", "audit.sinks", "unknown sink %q (want cloud, firestore or file)", sink)
+		}
+	}
+	if c.Audit.LogFile == "" {
+		fail("AUDIT_LOG_FILE", "audit.log_file", "is required; it is the fallback when no sink is available")
+	}
+
+	if c.Notifications.Provider != "log" {
+		fail("NOTIFICATION_PROVIDER", "notifications.provider", "unknown provider %q", c.Notifications.Provider)
+	}
+
+	// Firestore caps a transaction at 500 writes
+	if c.Migrations.BatchSize < 1 || c.Migrations.BatchSize > 500 {
+		fail("MIGRATIONS_BATCH_SIZE", "migrations.batch_size", "must be between 1 and 500, got %d", c.Migrations.BatchSize)
+	}
+
+	if c.Trash.GracePeriod < time.Hour {
+		fail("TRASH_GRACE_PERIOD", "trash.grace_period", "must be at least 1h, got %v", c.Trash.GracePeriod)
+	}
+	if c.Idempotency.TTL < time.Minute || c.Idempotency.TTL > 7*24*time.Hour {
+		fail("IDEMPOTENCY_TTL", "idempotency.ttl", "must be between 1m and 168h, got %v", c.Idempotency.TTL)
+	}
+	if c.Duplicates.Window < time.Hour {
+		fail("DUPLICATES_WINDOW", "duplicates.window", "must be at least 1h, got %v", c.Duplicates.Window)
+	}
+	if c.Duplicates.MinSimilarity < 0 || c.Duplicates.MinSimilarity > 1 {
+		fail("DUPLICATES_MIN_SIMILARITY", "duplicates.min_similarity", "must be between 0 and 1, got %v", c.Duplicates.MinSimilarity)
+	}
+
+	if c.Offline() {
+		if _, _, err := net.SplitHostPort(c.Dev.FirestoreAddr); err != nil {
+			fail("DEV_FIRESTORE_ADDR", "dev.firestore_addr", "must be host:port, got %q", c.Dev.FirestoreAddr)
+		}
+		if _, _, err := net.SplitHostPort(c.Dev.RedisAddr); err != nil {
+			fail("DEV_REDIS_ADDR", "dev.redis_addr", "must be host:port, got %q", c.Dev.RedisAddr)
+		}
+		if c.Dev.UserID == "" {
+			fail("DEV_USER_ID", "dev.user_id", "is required in the dev profile")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Warnings lists settings that are valid but unsafe for the active profile
+func (c *Config) Warnings() []string {
+	if c.Environment != ProfileProduction {
+		return nil
+	}
+	var warnings []string
+	if c.Redis.Password == "" {
+		warnings = append(warnings, "redis.password is not set in production")
+	}
+	for _, origin := range c.Server.CORSAllowedOrigins {
+		if strings.HasPrefix(origin, "http://") {
+			warnings = append(warnings, fmt.Sprintf("server.cors_allowed_origins allows non-HTTPS origin %s in production", origin))
+		}
+	}
+	if c.Metrics.Token == "" {
+		warnings = append(warnings, "metrics.token is not set; /metrics is unauthenticated")
+	}
+	return warnings
+}
+
+// checkURL requires an absolute http(s) URL
+func checkURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("must be an absolute http(s) URL, got %q", raw)
+	}
+	return nil
+}
@@ -4,7 +4,7 @@ import "time"
 
 // Form represents the main SurveyJS JSON structure
 type Form struct {
-	ID             string                 `json:"id" firestore:"_id"`
+	ID             string                 `json:"id" firestore:"-"`
 	Title          string                 `json:"title" firestore:"title"`
 	Description    string                 `json:"description,omitempty" firestore:"description,omitempty"`
 	SurveyJSON     map[string]interface{} `json:"surveyJson" firestore:"surveyJson"`
@@ -17,6 +17,11 @@ type Form struct {
 	Tags           []string               `json:"tags,omitempty" firestore:"tags,omitempty"`
 	IsTemplate     bool                   `json:"isTemplate" firestore:"isTemplate"`
 	Version        int                    `json:"version" firestore:"version"`
+	Status         string                 `json:"status,omitempty" firestore:"status,omitempty"` // draft, active, paused, archived
+	PublishedAt    *time.Time             `json:"publishedAt,omitempty" firestore:"publishedAt,omitempty"`
+	// DeletedAt marks a form in the trash; it is purged once the grace period has passed
+	DeletedAt *time.Time `json:"deleted_at,omitempty" firestore:"deleted_at,omitempty"`
+	DeletedBy string     `json:"deleted_by,omitempty" firestore:"deleted_by,omitempty"`
 }
 
 // FormResponse represents a single submission of a form
@@ -24,7 +29,7 @@ type FormResponse struct {
 	ID                      string                 `json:"id,omitempty" firestore:"id,omitempty"`
 	OrganizationID          string                 `json:"organizationId" firestore:"organizationId"`
 	FormID                  string                 `json:"form" firestore:"form"`
-	Data                    map[string]interface{} `json:"response_data" firestore:"response_data"`
+	Data                    map[string]interface{} `json:"response_data" firestore:"response_data,omitempty"`
 	Metadata                map[string]interface{} `json:"metadata,omitempty" firestore:"metadata,omitempty"`
 	SubmittedBy             string                 `json:"submitted_by" firestore:"submitted_by"`
 	SubmittedAt             time.Time              `json:"submitted_at" firestore:"submitted_at"`
@@ -40,6 +45,73 @@ type FormResponse struct {
 	UserAgent               string                 `json:"user_agent,omitempty" firestore:"user_agent,omitempty"`
 	IPAddress               string                 `json:"ip_address,omitempty" firestore:"ip_address,omitempty"`
 	SessionID               string                 `json:"session_id,omitempty" firestore:"session_id,omitempty"`
+	Encrypted               *EncryptedPHI          `json:"-" firestore:"encrypted_phi,omitempty"`
+	AnonymizedAt            *time.Time             `json:"anonymized_at,omitempty" firestore:"anonymized_at,omitempty"`
+	DeletedAt               *time.Time             `json:"deleted_at,omitempty" firestore:"deleted_at,omitempty"`
+	DeletedBy               string                 `json:"deleted_by,omitempty" firestore:"deleted_by,omitempty"`
+	// Revision counts the amendments applied to the answers; 0 is the original submission
+	Revision  int                `json:"revision,omitempty" firestore:"revision,omitempty"`
+	AmendedAt *time.Time         `json:"amended_at,omitempty" firestore:"amended_at,omitempty"`
+	Revisions []ResponseRevision `json:"revisions,omitempty" firestore:"revisions,omitempty"`
+	// IdentityKeys are blind indexes of the patient's identity, used to find duplicates
+	IdentityKeys []string       `json:"-" firestore:"identity_keys,omitempty"`
+	Duplicate    *DuplicateFlag `json:"duplicate,omitempty" firestore:"duplicate,omitempty"`
+	// A merge keeps both originals and links them to the response holding the merged answers
+	MergedInto string   `json:"merged_into,omitempty" firestore:"merged_into,omitempty"`
+	MergedFrom []string `json:"merged_from,omitempty" firestore:"merged_from,omitempty"`
+}
+
+// DuplicateFlag marks a response as a likely resubmission of an earlier one by the same
+// patient. Flags stay pending in the review queue until merged or dismissed.
+type DuplicateFlag struct {
+	Of         string     `json:"of" firestore:"of"`
+	Score      float64    `json:"score" firestore:"score"`           // share of matching answers
+	MatchedOn  []string   `json:"matched_on" firestore:"matched_on"` // identity parts both responses share
+	Status     string     `json:"status" firestore:"status"`         // pending, merged, dismissed
+	FlaggedAt  time.Time  `json:"flagged_at" firestore:"flagged_at"`
+	ResolvedBy string     `json:"resolved_by,omitempty" firestore:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty" firestore:"resolved_at,omitempty"`
+}
+
+// DuplicateCandidate is an entry in the duplicate review queue. Answers and patient names
+// are left out; reviewers open both responses to compare them.
+type DuplicateCandidate struct {
+	ResponseID  string    `json:"response_id"`
+	DuplicateOf string    `json:"duplicate_of"`
+	FormID      string    `json:"form_id"`
+	Score       float64   `json:"score"`
+	MatchedOn   []string  `json:"matched_on"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	FlaggedAt   time.Time `json:"flagged_at"`
+}
+
+// ResponseRevision records one amendment of a response's answers. Each change keeps the
+// value it replaced, so the original submission can be rebuilt from the history.
+type ResponseRevision struct {
+	Revision    int           `json:"revision" firestore:"revision"`
+	Changes     []FieldChange `json:"changes" firestore:"changes"`
+	Reason      string        `json:"reason" firestore:"reason"`
+	RequestedBy string        `json:"requested_by,omitempty" firestore:"requested_by,omitempty"` // e.g. "patient"
+	AuthorID    string        `json:"author_id" firestore:"author_id"`
+	ApprovedBy  string        `json:"approved_by" firestore:"approved_by"`
+	CreatedAt   time.Time     `json:"created_at" firestore:"created_at"`
+}
+
+// FieldChange is a single answer changed by an amendment. OldValue is nil for an answer
+// that was added and NewValue is nil for one that was removed.
+type FieldChange struct {
+	Field    string      `json:"field" firestore:"field"`
+	OldValue interface{} `json:"old_value" firestore:"old_value"`
+	NewValue interface{} `json:"new_value" firestore:"new_value"`
+}
+
+// EncryptedPHI holds the sealed form of a response's sensitive fields. The plaintext
+// response_data, patient_name, ip_address and revisions fields are left empty while this is set.
+type EncryptedPHI struct {
+	Data        string `firestore:"response_data,omitempty"`
+	PatientName string `firestore:"patient_name,omitempty"`
+	IPAddress   string `firestore:"ip_address,omitempty"`
+	Revisions   string `firestore:"revisions,omitempty"`
 }
 
 // OrganizationSettings represents the settings for an organization
@@ -47,6 +119,16 @@ type OrganizationSettings struct {
 	HIPAACompliant      bool `json:"hipaa_compliant" firestore:"hipaa_compliant"`
 	DataRetentionDays int  `json:"data_retention_days" firestore:"data_retention_days"`
 	Timezone          string `json:"timezone" firestore:"timezone"`
+	ReminderSchedule  *ReminderSchedule `json:"reminder_schedule,omitempty" firestore:"reminder_schedule,omitempty"`
+	RetentionAction   string `json:"retention_action,omitempty" firestore:"retention_action,omitempty"` // "purge" (default) or "anonymize"
+}
+
+// ReminderSchedule controls automated reminders for unanswered share links.
+// Offsets are hours before the link's ExpiresAt deadline.
+type ReminderSchedule struct {
+	Enabled      bool     `json:"enabled" firestore:"enabled"`
+	OffsetsHours []int    `json:"offsets_hours" firestore:"offsets_hours"`
+	Channels     []string `json:"channels" firestore:"channels"` // "email" and/or "sms"
 }
 
 // ClinicInfo represents the clinic header information for PDFs and branding
@@ -82,6 +164,15 @@ type Organization struct {
 	UpdatedAt  time.Time            `json:"updated_at" firestore:"updated_at"`
 }
 
+// OrganizationMember records a user granted access to an organization. The grant itself
+// is the user's organization_id custom claim; these documents let administrators list it.
+type OrganizationMember struct {
+	UserID    string    `json:"user_id" firestore:"user_id"`
+	Email     string    `json:"email,omitempty" firestore:"email,omitempty"`
+	GrantedBy string    `json:"granted_by" firestore:"granted_by"`
+	GrantedAt time.Time `json:"granted_at" firestore:"granted_at"`
+}
+
 // ShareLink represents a shareable link for a form
 type ShareLink struct {
 	ID             string    `json:"_id,omitempty" firestore:"_id,omitempty"`
@@ -95,6 +186,32 @@ type ShareLink struct {
 	CreatedBy      string    `json:"created_by" firestore:"created_by"`
 	CreatedAt      time.Time `json:"created_at" firestore:"created_at"`
 	PasswordHash   string    `json:"-" firestore:"password_hash,omitempty"`
+	RecipientEmail string    `json:"recipient_email,omitempty" firestore:"recipient_email,omitempty"`
+	RecipientPhone string    `json:"recipient_phone,omitempty" firestore:"recipient_phone,omitempty"`
+	// ReminderSchedule overrides the organization's schedule when set
+	ReminderSchedule *ReminderSchedule `json:"reminder_schedule,omitempty" firestore:"reminder_schedule,omitempty"`
+	AnonymizedAt     *time.Time        `json:"anonymized_at,omitempty" firestore:"anonymized_at,omitempty"`
+	// DeactivatedWithForm marks links switched off because their form was deleted, so
+	// restoring the form switches back on exactly those
+	DeactivatedWithForm bool `json:"deactivated_with_form,omitempty" firestore:"deactivated_with_form,omitempty"`
+}
+
+// ReminderLog records the delivery of a single reminder for auditing.
+// Its document ID is deterministic so that only one instance can send a given reminder.
+type ReminderLog struct {
+	ID             string    `json:"_id,omitempty" firestore:"-"`
+	ShareLinkID    string    `json:"share_link_id" firestore:"share_link_id"`
+	FormID         string    `json:"form_id" firestore:"form_id"`
+	OrganizationID string    `json:"organizationId" firestore:"organizationId"`
+	Channel        string    `json:"channel" firestore:"channel"`
+	Recipient      string    `json:"recipient" firestore:"recipient"` // masked
+	OffsetHours    int       `json:"offset_hours" firestore:"offset_hours"`
+	ScheduledFor   time.Time `json:"scheduled_for" firestore:"scheduled_for"`
+	Status         string    `json:"status" firestore:"status"` // "pending", "sent", "failed"
+	Attempts       int       `json:"attempts" firestore:"attempts"`
+	Error          string    `json:"error,omitempty" firestore:"error,omitempty"`
+	CreatedAt      time.Time `json:"created_at" firestore:"created_at"`
+	SentAt         *time.Time `json:"sent_at,omitempty" firestore:"sent_at,omitempty"`
 }
 
 // UserSession represents session metadata stored in Redis for HIPAA compliance
@@ -109,3 +226,316 @@ type UserSession struct {
 	SessionType    string    `json:"session_type"`    // "api" or "web"
 }
 
+
+// Webhook payload modes
+const (
+	WebhookPayloadIDs  = "ids"  // minimum necessary: identifiers only
+	WebhookPayloadFHIR = "fhir" // full FHIR resource for response events
+)
+
+// WebhookSubscription registers an organization endpoint for lifecycle events
+type WebhookSubscription struct {
+	ID             string    `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string    `json:"organizationId" firestore:"organizationId"`
+	URL            string    `json:"url" firestore:"url"`
+	Events         []string  `json:"events" firestore:"events"`
+	PayloadMode    string    `json:"payload_mode" firestore:"payload_mode"`
+	Secret         string    `json:"-" firestore:"secret,omitempty"`        // legacy plaintext signing key, sealed by migration 4
+	SealedSecret   string    `json:"-" firestore:"sealed_secret,omitempty"` // HMAC-SHA256 signing key, encrypted with the org data key and shown once on creation
+	IsActive       bool      `json:"is_active" firestore:"is_active"`
+	CreatedBy      string    `json:"created_by" firestore:"created_by"`
+	CreatedAt      time.Time `json:"created_at" firestore:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" firestore:"updated_at"`
+}
+
+// WebhookDelivery is a queued webhook attempt. Deliveries that exhaust their retries
+// are moved to the webhook_dead_letters collection with the same shape.
+type WebhookDelivery struct {
+	ID             string                 `json:"_id,omitempty" firestore:"-"`
+	SubscriptionID string                 `json:"subscription_id" firestore:"subscription_id"`
+	OrganizationID string                 `json:"organizationId" firestore:"organizationId"`
+	Event          string                 `json:"event" firestore:"event"`
+	ResponseID     string                 `json:"response_id,omitempty" firestore:"response_id,omitempty"`
+	RequestID      string                 `json:"request_id,omitempty" firestore:"request_id,omitempty"`
+	Payload        map[string]interface{} `json:"payload" firestore:"payload,omitempty"`
+	SealedPayload  string                 `json:"-" firestore:"sealed_payload,omitempty"` // FHIR payloads carry PHI and are stored encrypted
+	Status         string                 `json:"status" firestore:"status"` // pending, delivered, dead_letter
+	Attempts       int                    `json:"attempts" firestore:"attempts"`
+	NextAttemptAt  time.Time              `json:"next_attempt_at" firestore:"next_attempt_at"`
+	LastError      string                 `json:"last_error,omitempty" firestore:"last_error,omitempty"`
+	LastStatusCode int                    `json:"last_status_code,omitempty" firestore:"last_status_code,omitempty"`
+	CreatedAt      time.Time              `json:"created_at" firestore:"created_at"`
+	DeliveredAt    *time.Time             `json:"delivered_at,omitempty" firestore:"delivered_at,omitempty"`
+}
+
+// DomainEvent is an outbox record written in the same Firestore transaction as the
+// entity change it describes. The dispatcher delivers it to in-process subscribers.
+type DomainEvent struct {
+	ID             string                 `json:"_id,omitempty" firestore:"-"`
+	Type           string                 `json:"type" firestore:"type"`
+	OrganizationID string                 `json:"organizationId" firestore:"organizationId"`
+	AggregateType  string                 `json:"aggregate_type" firestore:"aggregate_type"` // form, response, share_link
+	AggregateID    string                 `json:"aggregate_id" firestore:"aggregate_id"`
+	ActorID        string                 `json:"actor_id,omitempty" firestore:"actor_id,omitempty"`
+	RequestID      string                 `json:"request_id,omitempty" firestore:"request_id,omitempty"` // request that caused the change
+	Payload        map[string]interface{} `json:"payload,omitempty" firestore:"payload,omitempty"`
+	Status         string                 `json:"status" firestore:"status"` // pending, dispatched, failed
+	Attempts       int                    `json:"attempts" firestore:"attempts"`
+	NextAttemptAt  time.Time              `json:"next_attempt_at" firestore:"next_attempt_at"`
+	LastError      string                 `json:"last_error,omitempty" firestore:"last_error,omitempty"`
+	OccurredAt     time.Time              `json:"occurred_at" firestore:"occurred_at"`
+	DispatchedAt   *time.Time             `json:"dispatched_at,omitempty" firestore:"dispatched_at,omitempty"`
+}
+
+// Attachment is a binary answer (signature, card photo, file upload) extracted from
+// response_data into the blob store. The answer itself holds an "attachment:<id>" reference.
+type Attachment struct {
+	ID             string        `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string        `json:"organizationId" firestore:"organizationId"`
+	FormID         string        `json:"form_id" firestore:"form_id"`
+	ResponseID     string        `json:"response_id" firestore:"response_id"`
+	FieldName      string        `json:"field_name" firestore:"field_name"`
+	ContentType    string        `json:"content_type" firestore:"content_type"`
+	Size           int64         `json:"size" firestore:"size"`
+	SHA256         string        `json:"sha256" firestore:"sha256"`
+	StorageKey     string        `json:"-" firestore:"storage_key"`
+	Encrypted      bool          `json:"-" firestore:"encrypted,omitempty"` // blob sealed with the org data key; older blobs are plaintext
+	Sanitization   *UploadReport `json:"sanitization,omitempty" firestore:"sanitization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at" firestore:"created_at"`
+}
+
+// UploadReport describes what the upload sanitizer detected and changed in a file
+type UploadReport struct {
+	DetectedType         string `json:"detected_type" firestore:"detected_type"`
+	DeclaredType         string `json:"declared_type,omitempty" firestore:"declared_type,omitempty"`
+	OriginalSize         int    `json:"original_size" firestore:"original_size"`
+	SanitizedSize        int    `json:"sanitized_size" firestore:"sanitized_size"`
+	Width                int    `json:"width,omitempty" firestore:"width,omitempty"`
+	Height               int    `json:"height,omitempty" firestore:"height,omitempty"`
+	MetadataStripped     bool   `json:"metadata_stripped" firestore:"metadata_stripped"`
+	LocationRemoved      bool   `json:"location_removed" firestore:"location_removed"`
+	OrientationCorrected bool   `json:"orientation_corrected" firestore:"orientation_corrected"`
+	Resized              bool   `json:"resized" firestore:"resized"`
+	ConvertedTo          string `json:"converted_to,omitempty" firestore:"converted_to,omitempty"` // type the file was re-encoded as, when not DetectedType
+}
+
+// DataKeyRing holds an organization's wrapped data encryption keys, stored in data_keys
+// under the organization ID. Old versions are kept after rotation so existing ciphertext
+// stays readable until it is re-encrypted.
+type DataKeyRing struct {
+	CurrentVersion int                       `firestore:"current_version"`
+	Keys           map[string]WrappedDataKey `firestore:"keys"` // version -> key
+	UpdatedAt      time.Time                 `firestore:"updated_at"`
+}
+
+// WrappedDataKey is a data key encrypted under a key-encryption key from the KeyProvider
+type WrappedDataKey struct {
+	Wrapped   []byte    `firestore:"wrapped"`
+	KEKID     string    `firestore:"kek_id"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
+
+// LegalHold blocks retention and manual deletion of a single response or of every
+// response belonging to a patient, until it is released
+type LegalHold struct {
+	ID             string     `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string     `json:"organizationId" firestore:"organizationId"`
+	ResponseID     string     `json:"response_id,omitempty" firestore:"response_id,omitempty"`
+	PatientName    string     `json:"patient_name,omitempty" firestore:"patient_name,omitempty"`
+	Reason         string     `json:"reason" firestore:"reason"`
+	Active         bool       `json:"active" firestore:"active"`
+	CreatedBy      string     `json:"created_by" firestore:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" firestore:"created_at"`
+	ReleasedBy     string     `json:"released_by,omitempty" firestore:"released_by,omitempty"`
+	ReleasedAt     *time.Time `json:"released_at,omitempty" firestore:"released_at,omitempty"`
+}
+
+// DeletionLogEntry records one retention action. Entries form a per-organization hash
+// chain: Hash covers the entry's fields and PrevHash, so edits or gaps are detectable.
+type DeletionLogEntry struct {
+	ID                string    `json:"_id,omitempty" firestore:"-"`
+	OrganizationID    string    `json:"organizationId" firestore:"organizationId"`
+	Sequence          int64     `json:"sequence" firestore:"sequence"`
+	ResourceType      string    `json:"resource_type" firestore:"resource_type"` // response, attachment, share_link, export_archive, backup_archive
+	ResourceID        string    `json:"resource_id" firestore:"resource_id"`
+	Action            string    `json:"action" firestore:"action"` // purged, anonymized
+	Reason            string    `json:"reason" firestore:"reason"`
+	ResourceCreatedAt time.Time `json:"resource_created_at" firestore:"resource_created_at"`
+	PerformedAt       time.Time `json:"performed_at" firestore:"performed_at"`
+	PrevHash          string    `json:"prev_hash" firestore:"prev_hash"`
+	Hash              string    `json:"hash" firestore:"hash"`
+}
+
+// RetentionReport lists what a retention sweep removed, or would remove on a dry run
+type RetentionReport struct {
+	OrganizationID string          `json:"organization_id"`
+	RetentionDays  int             `json:"retention_days"`
+	Action         string          `json:"action"`
+	Cutoff         time.Time       `json:"cutoff"`
+	DryRun         bool            `json:"dry_run"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+	Counts         map[string]int  `json:"counts"` // "<resource_type>" and "held"
+	Items          []RetentionItem `json:"items"`
+	Truncated      bool            `json:"truncated,omitempty"`
+}
+
+// RetentionItem is one resource in a RetentionReport
+type RetentionItem struct {
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Action       string    `json:"action"` // purge, anonymize, held
+	HoldID       string    `json:"hold_id,omitempty"`
+}
+
+// TrashItem is a deleted form or response awaiting purge. Responses are listed without
+// their answers or patient name.
+type TrashItem struct {
+	ResourceType string    `json:"resource_type"` // form or response
+	ResourceID   string    `json:"resource_id"`
+	Title        string    `json:"title,omitempty"`
+	FormID       string    `json:"form_id,omitempty"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	DeletedBy    string    `json:"deleted_by"`
+	PurgeAfter   time.Time `json:"purge_after"`
+}
+
+// FormLease is an editing lease on a form, held by one user while the builder has the form
+// open. Token is only returned to the holder, who renews the lease with it.
+type FormLease struct {
+	FormID    string    `json:"form_id"`
+	UserID    string    `json:"user_id"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// IdempotencyRecord is the outcome of the first request made with an Idempotency-Key. It
+// is kept for a TTL so retries get the same response instead of repeating the request.
+// Completed is false while the first request is still running.
+type IdempotencyRecord struct {
+	RequestHash string            `json:"request_hash" firestore:"request_hash"`
+	Completed   bool              `json:"completed" firestore:"completed"`
+	Status      int               `json:"status,omitempty" firestore:"status,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty" firestore:"headers,omitempty"`
+	Body        []byte            `json:"body,omitempty" firestore:"body,omitempty"`
+	CreatedAt   time.Time         `json:"created_at" firestore:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at" firestore:"expires_at"`
+}
+
+// PatientExport is an asynchronous right-of-access export job. The patient match is
+// stored sealed because it identifies the patient; the download token is stored hashed.
+type PatientExport struct {
+	ID             string     `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string     `json:"organizationId" firestore:"organizationId"`
+	RequestedBy    string     `json:"requested_by" firestore:"requested_by"`
+	Recipient      string     `json:"recipient" firestore:"recipient"`
+	RequestID      string     `json:"request_id,omitempty" firestore:"request_id,omitempty"`
+	SealedMatch    string     `json:"-" firestore:"sealed_match"`
+	Status         string     `json:"status" firestore:"status"` // queued, running, ready, downloaded, expired, failed
+	ResponseIDs    []string   `json:"response_ids,omitempty" firestore:"response_ids,omitempty"`
+	FileCount      int        `json:"file_count,omitempty" firestore:"file_count,omitempty"`
+	Size           int64      `json:"size,omitempty" firestore:"size,omitempty"`
+	SHA256         string     `json:"sha256,omitempty" firestore:"sha256,omitempty"`
+	StorageKey     string     `json:"-" firestore:"storage_key,omitempty"`
+	Encrypted      bool       `json:"-" firestore:"encrypted,omitempty"` // archive sealed with the org data key
+	TokenHash      string     `json:"-" firestore:"token_hash"`
+	Error          string     `json:"error,omitempty" firestore:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" firestore:"created_at"`
+	StartedAt      *time.Time `json:"started_at,omitempty" firestore:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty" firestore:"completed_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at" firestore:"expires_at"`
+	DownloadedAt   *time.Time `json:"downloaded_at,omitempty" firestore:"downloaded_at,omitempty"`
+}
+
+// PatientMatch selects the responses included in a patient export
+type PatientMatch struct {
+	PatientName string   `json:"patient_name,omitempty"`
+	DateOfBirth string   `json:"date_of_birth,omitempty"` // YYYY-MM-DD
+	ResponseIDs []string `json:"response_ids,omitempty"`
+}
+
+// Disclosure is an accounting-of-disclosures record (45 CFR 164.528). The patient
+// identity is sealed with the organization's data key.
+type Disclosure struct {
+	ID             string    `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string    `json:"organizationId" firestore:"organizationId"`
+	SealedPatient  string    `json:"-" firestore:"sealed_patient"`
+	Recipient      string    `json:"recipient" firestore:"recipient"`
+	Purpose        string    `json:"purpose" firestore:"purpose"`
+	Description    string    `json:"description" firestore:"description"`
+	ResponseIDs    []string  `json:"response_ids" firestore:"response_ids"`
+	ExportID       string    `json:"export_id,omitempty" firestore:"export_id,omitempty"`
+	RequestedBy    string    `json:"requested_by" firestore:"requested_by"`
+	DisclosedAt    time.Time `json:"disclosed_at" firestore:"disclosed_at"`
+}
+
+// PHIAccessEvent records one access to or disclosure of a patient's response. The patient
+// is linked through a keyed hash so the log can be queried per patient without storing
+// the name in the clear.
+type PHIAccessEvent struct {
+	ID             string    `json:"_id,omitempty" firestore:"-"`
+	OrganizationID string    `json:"organizationId" firestore:"organizationId"`
+	ResponseID     string    `json:"response_id" firestore:"response_id"`
+	ResponseIDs    []string  `json:"response_ids,omitempty" firestore:"response_ids,omitempty"` // set instead of ResponseID when a list shows several of the patient's responses
+	FormID         string    `json:"form_id,omitempty" firestore:"form_id,omitempty"`
+	PatientKey     string    `json:"-" firestore:"patient_key,omitempty"`
+	Action         string    `json:"action" firestore:"action"`         // response_read, pdf_generated, clinical_summary_generated, export_downloaded, webhook_delivered
+	Purpose        string    `json:"purpose" firestore:"purpose"`       // HL7 PurposeOfUse code
+	ActorType      string    `json:"actor_type" firestore:"actor_type"` // user, system
+	ActorID        string    `json:"actor_id" firestore:"actor_id"`
+	Recipient      string    `json:"recipient,omitempty" firestore:"recipient,omitempty"`
+	Fields         []string  `json:"fields" firestore:"fields"`
+	IPAddress      string    `json:"ip_address,omitempty" firestore:"ip_address,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at" firestore:"occurred_at"`
+}
+
+// MigrationRecord tracks one schema migration in the _migrations collection. Checkpoint is
+// the last document ID processed, so an interrupted run resumes after it.
+type MigrationRecord struct {
+	ID          int        `json:"id" firestore:"id"`
+	Name        string     `json:"name" firestore:"name"`
+	Status      string     `json:"status" firestore:"status"` // pending, running, failed, completed
+	Checkpoint  string     `json:"checkpoint,omitempty" firestore:"checkpoint,omitempty"`
+	Scanned     int        `json:"scanned" firestore:"scanned"`
+	Changed     int        `json:"changed" firestore:"changed"`
+	LastError   string     `json:"last_error,omitempty" firestore:"last_error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty" firestore:"started_at,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at" firestore:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" firestore:"completed_at,omitempty"`
+	DryRun      bool       `json:"dry_run,omitempty" firestore:"-"`
+}
+
+// OrgArchiveJob is a background backup or restore of a whole organization. The
+// passphrase protecting the archive is sealed with the organization's data key and
+// removed when the job finishes.
+type OrgArchiveJob struct {
+	ID                   string             `json:"_id,omitempty" firestore:"-"`
+	OrganizationID       string             `json:"organizationId" firestore:"organizationId"`
+	Kind                 string             `json:"kind" firestore:"kind"` // backup, restore
+	RequestedBy          string             `json:"requested_by" firestore:"requested_by"`
+	RequestID            string             `json:"request_id,omitempty" firestore:"request_id,omitempty"`
+	Status               string             `json:"status" firestore:"status"` // queued, running, completed, failed, expired
+	DryRun               bool               `json:"dry_run,omitempty" firestore:"dry_run,omitempty"`
+	Encrypted            bool               `json:"encrypted" firestore:"encrypted"`
+	SealedPassphrase     string             `json:"-" firestore:"sealed_passphrase,omitempty"`
+	Progress             OrgArchiveProgress `json:"progress" firestore:"progress"`
+	Counts               map[string]int     `json:"counts,omitempty" firestore:"counts,omitempty"`
+	Warnings             []string           `json:"warnings,omitempty" firestore:"warnings,omitempty"`
+	SourceOrganizationID string             `json:"source_organization_id,omitempty" firestore:"source_organization_id,omitempty"`
+	Size                 int64              `json:"size,omitempty" firestore:"size,omitempty"`
+	SHA256               string             `json:"sha256,omitempty" firestore:"sha256,omitempty"`
+	StorageKey           string             `json:"-" firestore:"storage_key,omitempty"`
+	UploadSealed         bool               `json:"-" firestore:"upload_sealed,omitempty"` // uploaded archive sealed with the org data key
+	Error                string             `json:"error,omitempty" firestore:"error,omitempty"`
+	CreatedAt            time.Time          `json:"created_at" firestore:"created_at"`
+	StartedAt            *time.Time         `json:"started_at,omitempty" firestore:"started_at,omitempty"`
+	CompletedAt          *time.Time         `json:"completed_at,omitempty" firestore:"completed_at,omitempty"`
+	ExpiresAt            *time.Time         `json:"expires_at,omitempty" firestore:"expires_at,omitempty"`
+}
+
+// OrgArchiveProgress reports how far a job has got through its current phase
+type OrgArchiveProgress struct {
+	Phase string `json:"phase" firestore:"phase"`
+	Done  int    `json:"done" firestore:"done"`
+	Total int    `json:"total" firestore:"total"`
+}
@@ -5,21 +5,29 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
-	"os"
-	"strconv"
 	"sync"
 	"time"
 
+	"backend-go/internal/config"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9" // Updated to secure v9 client
 )
 
 var (
 	redisClient *redis.Client
+	redisConfig config.RedisConfig
 	once        sync.Once
 	initTime    time.Time
 	lastError   error
 )
 
+// ConfigureRedis sets the connection settings used by GetRedisClient. It must be called
+// before the first GetRedisClient call; until then the client connects to localhost.
+func ConfigureRedis(cfg config.RedisConfig) {
+	redisConfig = cfg
+}
+
 // RedisStats holds Redis connection statistics for monitoring
 type RedisStats struct {
 	Connected         bool
@@ -37,8 +45,8 @@ func GetRedisStats() RedisStats {
 		LastConnectionTime: initTime,
 		InitializationTime: initTime,
 		LastError:         lastError,
-		Address:           os.Getenv("REDIS_ADDR"),
-		TLSEnabled:        getEnvBool("REDIS_TLS_ENABLED", false),
+		Address:           redisConfig.Addr,
+		TLSEnabled:        redisConfig.TLSEnabled,
 	}
 }
 
@@ -51,11 +59,19 @@ func GetRedisClient() *redis.Client {
 	return redisClient
 }
 
+// CloseRedis closes the shared client if one was created. Later GetRedisClient calls
+// keep returning the closed client, so it is only called during shutdown.
+func CloseRedis() error {
+	if redisClient == nil {
+		return nil
+	}
+	return redisClient.Close()
+}
+
 // initializeRedisWithRetry attempts to connect to Redis with exponential backoff
 func initializeRedisWithRetry() *redis.Client {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	redisPassword := os.Getenv("REDIS_PASSWORD")
-	tlsEnabled := os.Getenv("REDIS_TLS_ENABLED")
+	redisAddr := redisConfig.Addr
+	redisPassword := redisConfig.Password.Value()
 	
 	// Configuration validation
 	if redisAddr == "" {
@@ -72,8 +88,8 @@ func initializeRedisWithRetry() *redis.Client {
 	}
 
 	// Determine if TLS should be enabled
-	useTLS := getEnvBool("REDIS_TLS_ENABLED", false)
-	log.Printf("REDIS_INIT: TLS enabled: %v (REDIS_TLS_ENABLED=%s)", useTLS, tlsEnabled)
+	useTLS := redisConfig.TLSEnabled
+	log.Printf("REDIS_INIT: TLS enabled: %v", useTLS)
 
 	// Create Redis options with optimized settings for GCP Memorystore
 	options := &redis.Options{
@@ -107,6 +123,11 @@ func initializeRedisWithRetry() *redis.Client {
 
 	client := redis.NewClient(options)
 
+	// Commands are traced without their arguments, which can hold session and cache data
+	if err := redisotel.InstrumentTracing(client, redisotel.WithDBStatement(false)); err != nil {
+		log.Printf("REDIS_INIT: Tracing instrumentation failed: %v", err)
+	}
+
 	// Test connection with retry logic
 	maxAttempts := 3
 	backoffDelay := 1 * time.Second
@@ -209,18 +230,6 @@ func testBasicOperations(client *redis.Client) bool {
 }
 
 // Helper functions
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		result, err := strconv.ParseBool(value)
-		if err != nil {
-			log.Printf("WARNING: Invalid boolean value for %s: %s, using default %v", key, value, defaultValue)
-			return defaultValue
-		}
-		return result
-	}
-	return defaultValue
-}
-
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) > 0 && indexOf(s, substr) >= 0)
 }
@@ -0,0 +1,101 @@
+package dev
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const tokenIssuer = "healthcare-forms-dev"
+
+// signingKey signs dev tokens. It is public on purpose: the verifier is only wired in
+// by the dev profile, so these tokens are worthless against any real deployment.
+var signingKey = []byte("healthcare-forms-dev-only-signing-key")
+
+// devClaims mirror the Firebase ID token fields the server reads
+type devClaims struct {
+	Email          string `json:"email,omitempty"`
+	OrganizationID string `json:"organization_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Auth stands in for the Firebase Auth client. It accepts HS256 tokens signed with the
+// dev key and treats every user as the owner of the organization with their UID.
+type Auth struct{}
+
+// NewAuth creates the verifier
+func NewAuth() *Auth {
+	return &Auth{}
+}
+
+// SignIDToken issues a token for uid that VerifyIDToken accepts until ttl passes
+func (a *Auth) SignIDToken(uid, email string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := devClaims{
+		Email:          email,
+		OrganizationID: uid,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   uid,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+}
+
+// VerifyIDToken checks the signature and expiry of a dev token
+func (a *Auth) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	claims := &devClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return signingKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid dev token: %w", err)
+	}
+	if claims.Issuer != tokenIssuer || claims.Subject == "" {
+		return nil, fmt.Errorf("invalid dev token: wrong issuer or missing subject")
+	}
+
+	token := &auth.Token{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		UID:     claims.Subject,
+		Claims: map[string]interface{}{
+			"email":           claims.Email,
+			"organization_id": claims.OrganizationID,
+		},
+	}
+	if claims.IssuedAt != nil {
+		token.IssuedAt = claims.IssuedAt.Unix()
+		token.AuthTime = token.IssuedAt
+	}
+	if claims.ExpiresAt != nil {
+		token.Expires = claims.ExpiresAt.Unix()
+	}
+	return token, nil
+}
+
+// SessionCookie exchanges a valid ID token for a longer-lived one
+func (a *Auth) SessionCookie(ctx context.Context, idToken string, expiresIn time.Duration) (string, error) {
+	token, err := a.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return "", err
+	}
+	email, _ := token.Claims["email"].(string)
+	return a.SignIDToken(token.UID, email, expiresIn)
+}
+
+// GetUser returns a record whose organization claim is the user's own UID
+func (a *Auth) GetUser(ctx context.Context, uid string) (*auth.UserRecord, error) {
+	return &auth.UserRecord{
+		UserInfo:     &auth.UserInfo{UID: uid, ProviderID: "dev"},
+		CustomClaims: map[string]interface{}{"organization_id": uid},
+	}, nil
+}
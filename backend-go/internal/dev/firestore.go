@@ -0,0 +1,695 @@
+// Package dev provides in-process substitutes for the server's external dependencies so
+// the API runs offline under ENVIRONMENT=dev: a Firestore gRPC server on a loopback port
+// (used through the real client), an in-memory Redis, a token verifier for locally signed
+// ID tokens, a deterministic Gemini model and a text-only PDF converter. Seed loads sample
+// forms that exercise every PDF pattern type.
+package dev
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Firestore is an in-memory Firestore served over gRPC on a loopback address. It covers
+// what the server uses: document reads and writes with preconditions, field transforms,
+// transactions, batches and structured queries. Transactions are optimistic: a commit
+// aborts when a document the transaction read has changed since, and the client retries.
+type Firestore struct {
+	server   *grpc.Server
+	listener net.Listener
+	store    *memStore
+}
+
+// StartFirestore listens on addr and serves an empty database
+func StartFirestore(addr string) (*Firestore, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("in-memory firestore: %w", err)
+	}
+	f := &Firestore{
+		server:   grpc.NewServer(),
+		listener: listener,
+		store:    &memStore{docs: make(map[string]*pb.Document), reads: make(map[string]map[string]*timestamppb.Timestamp)},
+	}
+	pb.RegisterFirestoreServer(f.server, f.store)
+	go f.server.Serve(listener)
+	return f, nil
+}
+
+// Addr is the address the server listens on
+func (f *Firestore) Addr() string {
+	return f.listener.Addr().String()
+}
+
+// Stop closes the listener and drops every open stream
+func (f *Firestore) Stop() {
+	f.server.Stop()
+}
+
+// DialFirestore connects a Firestore client to an in-memory server, possibly one started
+// by another process
+func DialFirestore(ctx context.Context, addr, projectID string) (*firestore.Client, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return firestore.NewClient(ctx, projectID, option.WithGRPCConn(conn), option.WithoutAuthentication())
+}
+
+// memStore holds documents by full resource name
+type memStore struct {
+	pb.UnimplementedFirestoreServer
+
+	mu       sync.Mutex
+	docs     map[string]*pb.Document
+	lastTime time.Time
+	// reads holds, per open transaction, the update time of every document it has read
+	// (nil for a missing one)
+	reads map[string]map[string]*timestamppb.Timestamp
+}
+
+// beginTransaction opens a transaction and returns its ID. The caller holds s.mu.
+func (s *memStore) beginTransaction() []byte {
+	id := newTransactionID()
+	s.reads[string(id)] = make(map[string]*timestamppb.Timestamp)
+	return id
+}
+
+// recordRead notes that a transaction saw a document. The caller holds s.mu.
+func (s *memStore) recordRead(transaction []byte, name string) {
+	reads, ok := s.reads[string(transaction)]
+	if !ok {
+		return
+	}
+	if _, seen := reads[name]; seen {
+		return
+	}
+	if doc, ok := s.docs[name]; ok {
+		reads[name] = doc.UpdateTime
+	} else {
+		reads[name] = nil
+	}
+}
+
+// checkReads aborts a transaction whose reads are no longer current. The caller holds s.mu.
+func (s *memStore) checkReads(transaction []byte) error {
+	for name, seen := range s.reads[string(transaction)] {
+		doc, ok := s.docs[name]
+		if (seen == nil) != !ok || (ok && !proto.Equal(doc.UpdateTime, seen)) {
+			return status.Errorf(codes.Aborted, "transaction aborted: %s changed since it was read", name)
+		}
+	}
+	return nil
+}
+
+// tick returns a commit timestamp later than every previous one, so update-time
+// preconditions always distinguish two writes
+func (s *memStore) tick() *timestamppb.Timestamp {
+	now := time.Now().UTC()
+	if !now.After(s.lastTime) {
+		now = s.lastTime.Add(time.Microsecond)
+	}
+	s.lastTime = now
+	return timestamppb.New(now)
+}
+
+func (s *memStore) BatchGetDocuments(req *pb.BatchGetDocumentsRequest, stream pb.Firestore_BatchGetDocumentsServer) error {
+	s.mu.Lock()
+	var transaction []byte
+	switch selector := req.ConsistencySelector.(type) {
+	case *pb.BatchGetDocumentsRequest_NewTransaction:
+		transaction = s.beginTransaction()
+	case *pb.BatchGetDocumentsRequest_Transaction:
+		transaction = selector.Transaction
+	}
+	readTime := timestamppb.New(time.Now().UTC())
+	responses := make([]*pb.BatchGetDocumentsResponse, 0, len(req.Documents))
+	for _, name := range req.Documents {
+		s.recordRead(transaction, name)
+		if doc, ok := s.docs[name]; ok {
+			responses = append(responses, &pb.BatchGetDocumentsResponse{
+				Result:   &pb.BatchGetDocumentsResponse_Found{Found: project(doc, req.Mask)},
+				ReadTime: readTime,
+			})
+		} else {
+			responses = append(responses, &pb.BatchGetDocumentsResponse{
+				Result:   &pb.BatchGetDocumentsResponse_Missing{Missing: name},
+				ReadTime: readTime,
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	if _, ok := req.ConsistencySelector.(*pb.BatchGetDocumentsRequest_NewTransaction); ok && len(responses) > 0 {
+		responses[0].Transaction = transaction
+	}
+	for _, resp := range responses {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) BeginTransaction(ctx context.Context, req *pb.BeginTransactionRequest) (*pb.BeginTransactionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.GetOptions().GetReadOnly() != nil {
+		return &pb.BeginTransactionResponse{Transaction: newTransactionID()}, nil
+	}
+	return &pb.BeginTransactionResponse{Transaction: s.beginTransaction()}, nil
+}
+
+func (s *memStore) Rollback(ctx context.Context, req *pb.RollbackRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	delete(s.reads, string(req.Transaction))
+	s.mu.Unlock()
+	return &emptypb.Empty{}, nil
+}
+
+// Commit applies every write or none of them. A transaction's commit aborts if any
+// document it read has been written since.
+func (s *memStore) Commit(ctx context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(req.Transaction) > 0 {
+		err := s.checkReads(req.Transaction)
+		delete(s.reads, string(req.Transaction))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	commitTime := s.tick()
+	staged := make(map[string]*pb.Document)
+	lookup := func(name string) (*pb.Document, bool) {
+		if doc, ok := staged[name]; ok {
+			return doc, doc != nil
+		}
+		doc, ok := s.docs[name]
+		return doc, ok
+	}
+
+	results := make([]*pb.WriteResult, 0, len(req.Writes))
+	for _, write := range req.Writes {
+		name := writeTarget(write)
+		existing, exists := lookup(name)
+		if err := checkPrecondition(write.CurrentDocument, name, existing, exists); err != nil {
+			return nil, err
+		}
+
+		result := &pb.WriteResult{UpdateTime: commitTime}
+		switch op := write.Operation.(type) {
+		case *pb.Write_Delete:
+			staged[name] = nil
+		case *pb.Write_Update:
+			doc := applyUpdate(existing, op.Update, write.UpdateMask)
+			transformResults, err := applyTransforms(doc, write.UpdateTransforms, commitTime)
+			if err != nil {
+				return nil, err
+			}
+			result.TransformResults = transformResults
+			if exists {
+				doc.CreateTime = existing.CreateTime
+			} else {
+				doc.CreateTime = commitTime
+			}
+			doc.UpdateTime = commitTime
+			staged[name] = doc
+		case *pb.Write_Transform:
+			if !exists {
+				return nil, status.Errorf(codes.NotFound, "no document to transform: %s", name)
+			}
+			doc := proto.Clone(existing).(*pb.Document)
+			transformResults, err := applyTransforms(doc, op.Transform.FieldTransforms, commitTime)
+			if err != nil {
+				return nil, err
+			}
+			result.TransformResults = transformResults
+			doc.UpdateTime = commitTime
+			staged[name] = doc
+		default:
+			return nil, status.Errorf(codes.Unimplemented, "unsupported write %T", op)
+		}
+		results = append(results, result)
+	}
+
+	for name, doc := range staged {
+		if doc == nil {
+			delete(s.docs, name)
+		} else {
+			s.docs[name] = doc
+		}
+	}
+	return &pb.CommitResponse{WriteResults: results, CommitTime: commitTime}, nil
+}
+
+// RunQuery evaluates a structured query against the current documents
+func (s *memStore) RunQuery(req *pb.RunQueryRequest, stream pb.Firestore_RunQueryServer) error {
+	query := req.GetStructuredQuery()
+	if query == nil {
+		return status.Error(codes.InvalidArgument, "only structured queries are supported")
+	}
+
+	s.mu.Lock()
+	// began is sent back to a caller that opened a transaction with this query
+	var transaction, began []byte
+	switch selector := req.ConsistencySelector.(type) {
+	case *pb.RunQueryRequest_NewTransaction:
+		transaction = s.beginTransaction()
+		began = transaction
+	case *pb.RunQueryRequest_Transaction:
+		transaction = selector.Transaction
+	}
+	docs, err := runStructuredQuery(s.docs, req.Parent, query)
+	if err == nil {
+		for _, doc := range docs {
+			s.recordRead(transaction, doc.Name)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	readTime := timestamppb.New(time.Now().UTC())
+	if len(docs) == 0 {
+		return stream.Send(&pb.RunQueryResponse{ReadTime: readTime, Transaction: began})
+	}
+	for i, doc := range docs {
+		resp := &pb.RunQueryResponse{Document: doc, ReadTime: readTime}
+		if i == 0 {
+			resp.Transaction = began
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTransactionID() []byte {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return id
+}
+
+func writeTarget(write *pb.Write) string {
+	switch op := write.Operation.(type) {
+	case *pb.Write_Delete:
+		return op.Delete
+	case *pb.Write_Update:
+		return op.Update.Name
+	case *pb.Write_Transform:
+		return op.Transform.Document
+	}
+	return ""
+}
+
+func checkPrecondition(pre *pb.Precondition, name string, existing *pb.Document, exists bool) error {
+	if pre == nil {
+		return nil
+	}
+	switch cond := pre.ConditionType.(type) {
+	case *pb.Precondition_Exists:
+		if cond.Exists && !exists {
+			return status.Errorf(codes.NotFound, "no entity to update: %s", name)
+		}
+		if !cond.Exists && exists {
+			return status.Errorf(codes.AlreadyExists, "document already exists: %s", name)
+		}
+	case *pb.Precondition_UpdateTime:
+		if !exists || !proto.Equal(existing.UpdateTime, cond.UpdateTime) {
+			return status.Errorf(codes.FailedPrecondition, "update time precondition failed: %s", name)
+		}
+	}
+	return nil
+}
+
+// applyUpdate merges an update into a copy of the existing document. Without a mask the
+// update replaces the document; with one, only the masked paths change and masked paths
+// absent from the update are deleted.
+func applyUpdate(existing, update *pb.Document, mask *pb.DocumentMask) *pb.Document {
+	doc := &pb.Document{Name: update.Name, Fields: map[string]*pb.Value{}}
+	if mask == nil {
+		for key, value := range update.Fields {
+			doc.Fields[key] = proto.Clone(value).(*pb.Value)
+		}
+		return doc
+	}
+	if existing != nil {
+		for key, value := range existing.Fields {
+			doc.Fields[key] = proto.Clone(value).(*pb.Value)
+		}
+	}
+	for _, path := range mask.FieldPaths {
+		segments := parseFieldPath(path)
+		if value, ok := lookupPath(update.Fields, segments); ok {
+			setPath(doc.Fields, segments, proto.Clone(value).(*pb.Value))
+		} else {
+			deletePath(doc.Fields, segments)
+		}
+	}
+	return doc
+}
+
+func applyTransforms(doc *pb.Document, transforms []*pb.DocumentTransform_FieldTransform, commitTime *timestamppb.Timestamp) ([]*pb.Value, error) {
+	results := make([]*pb.Value, 0, len(transforms))
+	for _, transform := range transforms {
+		segments := parseFieldPath(transform.FieldPath)
+		current, _ := lookupPath(doc.Fields, segments)
+
+		var next *pb.Value
+		switch op := transform.TransformType.(type) {
+		case *pb.DocumentTransform_FieldTransform_SetToServerValue:
+			next = &pb.Value{ValueType: &pb.Value_TimestampValue{TimestampValue: commitTime}}
+		case *pb.DocumentTransform_FieldTransform_Increment:
+			next = addNumbers(current, op.Increment)
+		case *pb.DocumentTransform_FieldTransform_Maximum:
+			next = op.Maximum
+			if isNumber(current) && compareValues(current, op.Maximum) >= 0 {
+				next = current
+			}
+		case *pb.DocumentTransform_FieldTransform_Minimum:
+			next = op.Minimum
+			if isNumber(current) && compareValues(current, op.Minimum) <= 0 {
+				next = current
+			}
+		case *pb.DocumentTransform_FieldTransform_AppendMissingElements:
+			values := arrayValues(current)
+			for _, add := range op.AppendMissingElements.Values {
+				if !containsValue(values, add) {
+					values = append(values, add)
+				}
+			}
+			next = &pb.Value{ValueType: &pb.Value_ArrayValue{ArrayValue: &pb.ArrayValue{Values: values}}}
+		case *pb.DocumentTransform_FieldTransform_RemoveAllFromArray:
+			var kept []*pb.Value
+			for _, value := range arrayValues(current) {
+				if !containsValue(op.RemoveAllFromArray.Values, value) {
+					kept = append(kept, value)
+				}
+			}
+			next = &pb.Value{ValueType: &pb.Value_ArrayValue{ArrayValue: &pb.ArrayValue{Values: kept}}}
+		default:
+			return nil, status.Errorf(codes.Unimplemented, "unsupported transform %T", op)
+		}
+		setPath(doc.Fields, segments, next)
+		results = append(results, next)
+	}
+	return results, nil
+}
+
+func addNumbers(current, delta *pb.Value) *pb.Value {
+	if current.GetValueType() == nil || !isNumber(current) {
+		return delta
+	}
+	currentInt, currentIsInt := current.ValueType.(*pb.Value_IntegerValue)
+	deltaInt, deltaIsInt := delta.ValueType.(*pb.Value_IntegerValue)
+	if currentIsInt && deltaIsInt {
+		return &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: currentInt.IntegerValue + deltaInt.IntegerValue}}
+	}
+	return &pb.Value{ValueType: &pb.Value_DoubleValue{DoubleValue: toFloat(current) + toFloat(delta)}}
+}
+
+func arrayValues(value *pb.Value) []*pb.Value {
+	if array, ok := value.GetValueType().(*pb.Value_ArrayValue); ok {
+		return append([]*pb.Value(nil), array.ArrayValue.Values...)
+	}
+	return nil
+}
+
+// runStructuredQuery returns the matching documents in query order
+func runStructuredQuery(all map[string]*pb.Document, parent string, query *pb.StructuredQuery) ([]*pb.Document, error) {
+	if len(query.From) != 1 {
+		return nil, status.Error(codes.InvalidArgument, "queries must select exactly one collection")
+	}
+	from := query.From[0]
+
+	var matched []*pb.Document
+	for name, doc := range all {
+		if !inCollection(name, parent, from) {
+			continue
+		}
+		ok, err := matchesFilter(doc, query.Where)
+		if err != nil {
+			return nil, err
+		}
+		if ok && hasOrderFields(doc, query.OrderBy) {
+			matched = append(matched, doc)
+		}
+	}
+
+	orders := effectiveOrders(query)
+	sort.SliceStable(matched, func(i, j int) bool {
+		return compareDocs(matched[i], matched[j], orders) < 0
+	})
+
+	if query.StartAt != nil {
+		matched = dropBefore(matched, orders, query.StartAt)
+	}
+	if query.EndAt != nil {
+		matched = dropAfter(matched, orders, query.EndAt)
+	}
+	if offset := int(query.Offset); offset > 0 {
+		if offset >= len(matched) {
+			matched = nil
+		} else {
+			matched = matched[offset:]
+		}
+	}
+	if query.Limit != nil && int(query.Limit.Value) < len(matched) {
+		matched = matched[:query.Limit.Value]
+	}
+
+	results := make([]*pb.Document, len(matched))
+	for i, doc := range matched {
+		results[i] = project(doc, selectMask(query.Select))
+	}
+	return results, nil
+}
+
+// inCollection reports whether a document belongs to the queried collection, or to any
+// collection with that ID below parent for collection group queries
+func inCollection(name, parent string, from *pb.StructuredQuery_CollectionSelector) bool {
+	if !strings.HasPrefix(name, parent+"/") {
+		return false
+	}
+	rest := strings.Split(strings.TrimPrefix(name, parent+"/"), "/")
+	if len(rest)%2 != 0 {
+		return false
+	}
+	if from.AllDescendants {
+		return rest[len(rest)-2] == from.CollectionId
+	}
+	return len(rest) == 2 && rest[0] == from.CollectionId
+}
+
+func selectMask(projection *pb.StructuredQuery_Projection) *pb.DocumentMask {
+	if projection == nil {
+		return nil
+	}
+	mask := &pb.DocumentMask{FieldPaths: []string{}}
+	for _, field := range projection.Fields {
+		if field.FieldPath != "__name__" {
+			mask.FieldPaths = append(mask.FieldPaths, field.FieldPath)
+		}
+	}
+	return mask
+}
+
+// project copies a document, keeping only the masked fields when a mask is given
+func project(doc *pb.Document, mask *pb.DocumentMask) *pb.Document {
+	if mask == nil {
+		return proto.Clone(doc).(*pb.Document)
+	}
+	out := &pb.Document{Name: doc.Name, CreateTime: doc.CreateTime, UpdateTime: doc.UpdateTime, Fields: map[string]*pb.Value{}}
+	for _, path := range mask.FieldPaths {
+		segments := parseFieldPath(path)
+		if value, ok := lookupPath(doc.Fields, segments); ok {
+			setPath(out.Fields, segments, proto.Clone(value).(*pb.Value))
+		}
+	}
+	return out
+}
+
+func matchesFilter(doc *pb.Document, filter *pb.StructuredQuery_Filter) (bool, error) {
+	if filter == nil {
+		return true, nil
+	}
+	switch f := filter.FilterType.(type) {
+	case *pb.StructuredQuery_Filter_CompositeFilter:
+		isOr := f.CompositeFilter.Op == pb.StructuredQuery_CompositeFilter_OR
+		for _, sub := range f.CompositeFilter.Filters {
+			ok, err := matchesFilter(doc, sub)
+			if err != nil {
+				return false, err
+			}
+			if isOr && ok {
+				return true, nil
+			}
+			if !isOr && !ok {
+				return false, nil
+			}
+		}
+		return !isOr, nil
+	case *pb.StructuredQuery_Filter_FieldFilter:
+		return matchesFieldFilter(doc, f.FieldFilter)
+	case *pb.StructuredQuery_Filter_UnaryFilter:
+		value, ok := fieldValue(doc, f.UnaryFilter.GetField().GetFieldPath())
+		if !ok {
+			return false, nil
+		}
+		_, isNull := value.ValueType.(*pb.Value_NullValue)
+		isNaN := isNumber(value) && toFloat(value) != toFloat(value)
+		switch f.UnaryFilter.Op {
+		case pb.StructuredQuery_UnaryFilter_IS_NULL:
+			return isNull, nil
+		case pb.StructuredQuery_UnaryFilter_IS_NOT_NULL:
+			return !isNull, nil
+		case pb.StructuredQuery_UnaryFilter_IS_NAN:
+			return isNaN, nil
+		case pb.StructuredQuery_UnaryFilter_IS_NOT_NAN:
+			return !isNaN, nil
+		}
+	}
+	return false, status.Errorf(codes.Unimplemented, "unsupported filter %v", filter)
+}
+
+func matchesFieldFilter(doc *pb.Document, filter *pb.StructuredQuery_FieldFilter) (bool, error) {
+	value, ok := fieldValue(doc, filter.Field.FieldPath)
+	if !ok {
+		return false, nil
+	}
+	operand := filter.Value
+	switch filter.Op {
+	case pb.StructuredQuery_FieldFilter_EQUAL:
+		return compareValues(value, operand) == 0, nil
+	case pb.StructuredQuery_FieldFilter_NOT_EQUAL:
+		return compareValues(value, operand) != 0, nil
+	case pb.StructuredQuery_FieldFilter_LESS_THAN:
+		return sameKind(value, operand) && compareValues(value, operand) < 0, nil
+	case pb.StructuredQuery_FieldFilter_LESS_THAN_OR_EQUAL:
+		return sameKind(value, operand) && compareValues(value, operand) <= 0, nil
+	case pb.StructuredQuery_FieldFilter_GREATER_THAN:
+		return sameKind(value, operand) && compareValues(value, operand) > 0, nil
+	case pb.StructuredQuery_FieldFilter_GREATER_THAN_OR_EQUAL:
+		return sameKind(value, operand) && compareValues(value, operand) >= 0, nil
+	case pb.StructuredQuery_FieldFilter_IN:
+		return containsValue(arrayValues(operand), value), nil
+	case pb.StructuredQuery_FieldFilter_NOT_IN:
+		return !containsValue(arrayValues(operand), value), nil
+	case pb.StructuredQuery_FieldFilter_ARRAY_CONTAINS:
+		return containsValue(arrayValues(value), operand), nil
+	case pb.StructuredQuery_FieldFilter_ARRAY_CONTAINS_ANY:
+		for _, candidate := range arrayValues(operand) {
+			if containsValue(arrayValues(value), candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, status.Errorf(codes.Unimplemented, "unsupported operator %v", filter.Op)
+}
+
+// fieldValue resolves a field path on a document; __name__ is the document reference
+func fieldValue(doc *pb.Document, path string) (*pb.Value, bool) {
+	if path == "__name__" {
+		return &pb.Value{ValueType: &pb.Value_ReferenceValue{ReferenceValue: doc.Name}}, true
+	}
+	return lookupPath(doc.Fields, parseFieldPath(path))
+}
+
+func hasOrderFields(doc *pb.Document, orders []*pb.StructuredQuery_Order) bool {
+	for _, order := range orders {
+		if _, ok := fieldValue(doc, order.Field.FieldPath); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// effectiveOrders appends the implicit document name ordering Firestore uses to break ties
+func effectiveOrders(query *pb.StructuredQuery) []*pb.StructuredQuery_Order {
+	orders := append([]*pb.StructuredQuery_Order(nil), query.OrderBy...)
+	direction := pb.StructuredQuery_ASCENDING
+	for _, order := range orders {
+		if order.Field.FieldPath == "__name__" {
+			return orders
+		}
+		direction = order.Direction
+	}
+	return append(orders, &pb.StructuredQuery_Order{
+		Field:     &pb.StructuredQuery_FieldReference{FieldPath: "__name__"},
+		Direction: direction,
+	})
+}
+
+func compareDocs(a, b *pb.Document, orders []*pb.StructuredQuery_Order) int {
+	for _, order := range orders {
+		left, _ := fieldValue(a, order.Field.FieldPath)
+		right, _ := fieldValue(b, order.Field.FieldPath)
+		if c := compareValues(left, right); c != 0 {
+			if order.Direction == pb.StructuredQuery_DESCENDING {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// compareToCursor compares a document with a cursor position over the leading orders
+func compareToCursor(doc *pb.Document, orders []*pb.StructuredQuery_Order, cursor *pb.Cursor) int {
+	for i, position := range cursor.Values {
+		if i >= len(orders) {
+			break
+		}
+		value, _ := fieldValue(doc, orders[i].Field.FieldPath)
+		if c := compareValues(value, position); c != 0 {
+			if orders[i].Direction == pb.StructuredQuery_DESCENDING {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+func dropBefore(docs []*pb.Document, orders []*pb.StructuredQuery_Order, cursor *pb.Cursor) []*pb.Document {
+	for i, doc := range docs {
+		c := compareToCursor(doc, orders, cursor)
+		if c > 0 || (c == 0 && cursor.Before) {
+			return docs[i:]
+		}
+	}
+	return nil
+}
+
+func dropAfter(docs []*pb.Document, orders []*pb.StructuredQuery_Order, cursor *pb.Cursor) []*pb.Document {
+	for i, doc := range docs {
+		c := compareToCursor(doc, orders, cursor)
+		if c > 0 || (c == 0 && cursor.Before) {
+			return docs[:i]
+		}
+	}
+	return docs
+}
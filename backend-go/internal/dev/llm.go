@@ -0,0 +1,153 @@
+package dev
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/vertexai/genai"
+)
+
+// Model is a deterministic stand-in for a Gemini model. It answers from the shape of the
+// request rather than its meaning: a PDF attachment yields a small SurveyJS form, an
+// image yields insurance card fields, and text yields a summary of the questions sent.
+// The same input always gives the same output.
+type Model struct{}
+
+// NewModel creates the fake model
+func NewModel() *Model {
+	return &Model{}
+}
+
+// SetTemperature is accepted and ignored
+func (m *Model) SetTemperature(t float32) {}
+
+// CountTokens estimates four characters per token
+func (m *Model) CountTokens(ctx context.Context, parts ...genai.Part) (*genai.CountTokensResponse, error) {
+	return &genai.CountTokensResponse{TotalTokens: estimateTokens(parts)}, nil
+}
+
+// GenerateContent returns a canned answer for the kind of request
+func (m *Model) GenerateContent(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
+	var prompt strings.Builder
+	var answer string
+	for _, part := range parts {
+		switch p := part.(type) {
+		case genai.Text:
+			prompt.WriteString(string(p))
+		case genai.Blob:
+			switch {
+			case p.MIMEType == "application/pdf":
+				answer = fakeForm(p.Data)
+			case strings.HasPrefix(p.MIMEType, "image/"):
+				answer = fakeInsuranceCard(p.Data)
+			}
+		}
+	}
+	if answer == "" {
+		answer = fakeSummary(prompt.String())
+	}
+
+	promptTokens := estimateTokens(parts)
+	answerTokens := int32(len(answer)/4 + 1)
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{
+			Index:        0,
+			FinishReason: genai.FinishReasonStop,
+			Content:      &genai.Content{Role: "model", Parts: []genai.Part{genai.Text(answer)}},
+		}},
+		UsageMetadata: &genai.UsageMetadata{
+			PromptTokenCount:     promptTokens,
+			CandidatesTokenCount: answerTokens,
+			TotalTokenCount:      promptTokens + answerTokens,
+		},
+	}, nil
+}
+
+func estimateTokens(parts []genai.Part) int32 {
+	size := 0
+	for _, part := range parts {
+		switch p := part.(type) {
+		case genai.Text:
+			size += len(p)
+		case genai.Blob:
+			size += len(p.Data)
+		}
+	}
+	return int32(size/4 + 1)
+}
+
+// fingerprint identifies an input in generated values
+func fingerprint(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4])
+}
+
+// fakeSummary describes the answered questions embedded in a clinical summary prompt
+func fakeSummary(prompt string) string {
+	var questions []struct {
+		Title  string      `json:"title"`
+		Answer interface{} `json:"answer"`
+	}
+	if start := strings.Index(prompt, "["); start >= 0 {
+		if end := strings.LastIndex(prompt, "]"); end > start {
+			json.Unmarshal([]byte(prompt[start:end+1]), &questions)
+		}
+	}
+
+	var titles []string
+	for _, q := range questions {
+		if q.Title != "" && len(titles) < 3 {
+			titles = append(titles, q.Title)
+		}
+	}
+	summary := fmt.Sprintf("Offline summary (dev profile): the patient answered %d questions.", len(questions))
+	if len(titles) > 0 {
+		summary += " Sections include " + strings.Join(titles, "; ") + "."
+	}
+	return summary + " No model was called; this text is generated locally for development."
+}
+
+// fakeForm returns a small SurveyJS form named after the uploaded PDF
+func fakeForm(pdf []byte) string {
+	form := map[string]interface{}{
+		"title":               fmt.Sprintf("Imported Form %s", fingerprint(pdf)),
+		"description":         fmt.Sprintf("Generated offline from a %d byte PDF.", len(pdf)),
+		"widthMode":           "responsive",
+		"showQuestionNumbers": "off",
+		"pages": []interface{}{map[string]interface{}{
+			"name": "page1",
+			"elements": []interface{}{
+				map[string]interface{}{"type": "text", "name": "first_name", "title": "First Name", "isRequired": true},
+				map[string]interface{}{"type": "text", "name": "last_name", "title": "Last Name", "isRequired": true},
+				map[string]interface{}{"type": "text", "name": "date_of_birth", "title": "Date of Birth", "inputType": "date"},
+				map[string]interface{}{"type": "radiogroup", "name": "has_allergies", "title": "Do you have any known allergies?", "choices": []string{"Yes", "No"}},
+				map[string]interface{}{"type": "comment", "name": "allergies_list", "title": "Please list them", "visibleIf": "{has_allergies} = 'Yes'"},
+			},
+		}},
+	}
+	out, _ := json.Marshal(form)
+	return string(out)
+}
+
+// fakeInsuranceCard returns card fields keyed to the image, so two uploads of the same
+// card extract the same member ID
+func fakeInsuranceCard(image []byte) string {
+	id := strings.ToUpper(fingerprint(image))
+	card := map[string]string{
+		"memberId":             "DEV" + id,
+		"memberName":           "Dev Patient",
+		"groupNumber":          "GRP-" + id[:4],
+		"issuerName":           "Offline Health Plan",
+		"planType":             "PPO",
+		"rxBin":                "610014",
+		"copayPcp":             "$25",
+		"copaySpecialist":      "$50",
+		"customerServicePhone": "1-800-555-0100",
+	}
+	out, _ := json.Marshal(card)
+	return string(out)
+}
@@ -0,0 +1,144 @@
+package dev
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+const (
+	pdfLineWidth    = 95 // characters of 10pt Helvetica across a Letter page
+	pdfLinesPerPage = 60
+)
+
+var (
+	hiddenBlocks = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	blockBreaks  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6]|table|section)>`)
+	cellBreaks   = regexp.MustCompile(`(?i)</t[dh]>`)
+	anyTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRuns    = regexp.MustCompile(`[ \t\r\f]+`)
+)
+
+// PDFConverter renders the text of the assembled HTML into a plain PDF without Gotenberg.
+// Layout, images and styling are dropped; the output is for checking which sections and
+// answers a PDF contains, not how it looks.
+type PDFConverter struct{}
+
+// NewPDFConverter creates the converter
+func NewPDFConverter() *PDFConverter {
+	return &PDFConverter{}
+}
+
+// GetServiceHealth always succeeds; there is no service behind the converter
+func (c *PDFConverter) GetServiceHealth(ctx context.Context) error {
+	return nil
+}
+
+// ConvertHTMLToPDF lays out the text of htmlContent on Letter pages
+func (c *PDFConverter) ConvertHTMLToPDF(ctx context.Context, htmlContent string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lines := htmlToLines(htmlContent)
+	if len(lines) == 0 {
+		lines = []string{"(empty document)"}
+	}
+	var pages [][]string
+	for len(lines) > 0 {
+		n := pdfLinesPerPage
+		if n > len(lines) {
+			n = len(lines)
+		}
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+	return writePDF(pages), nil
+}
+
+// htmlToLines extracts the visible text of an HTML document as wrapped lines
+func htmlToLines(doc string) []string {
+	text := hiddenBlocks.ReplaceAllString(doc, "")
+	text = blockBreaks.ReplaceAllString(text, "\n")
+	text = cellBreaks.ReplaceAllString(text, "  ")
+	text = anyTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(spaceRuns.ReplaceAllString(line, " "))
+		if line == "" {
+			continue
+		}
+		for len(line) > pdfLineWidth {
+			cut := strings.LastIndex(line[:pdfLineWidth], " ")
+			if cut <= 0 {
+				cut = pdfLineWidth
+			}
+			lines = append(lines, line[:cut])
+			line = strings.TrimSpace(line[cut:])
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfString escapes text for a PDF literal string; characters outside ASCII are replaced
+// because the standard Helvetica encoding cannot show them
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// writePDF produces a minimal PDF 1.4 file with one Helvetica text block per page
+func writePDF(pages [][]string) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	// Objects 1-3 are the catalog, page tree and font; each page then adds a page object
+	// and its content stream
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	for i, lines := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 10 Tf 12 TL 40 752 Td\n")
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfString(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
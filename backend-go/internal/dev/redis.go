@@ -0,0 +1,53 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Redis is an in-memory Redis substitute. It understands the commands and Lua scripts the
+// server uses for sessions, caches, locks and rate limits.
+type Redis struct {
+	server *miniredis.Miniredis
+	done   chan struct{}
+}
+
+// StartRedis starts the substitute on addr; port 0 picks a free port
+func StartRedis(addr string) (*Redis, error) {
+	server := miniredis.NewMiniRedis()
+	if err := server.StartAddr(addr); err != nil {
+		return nil, err
+	}
+	r := &Redis{server: server, done: make(chan struct{})}
+	go r.expireKeys()
+	return r, nil
+}
+
+// Addr is the host:port clients connect to
+func (r *Redis) Addr() string {
+	return r.server.Addr()
+}
+
+// Close stops the server
+func (r *Redis) Close() {
+	close(r.done)
+	r.server.Close()
+}
+
+// expireKeys advances miniredis's clock with the wall clock. miniredis only counts down
+// TTLs when told to, and without this rate-limit windows and lock TTLs would never end.
+func (r *Redis) expireKeys() {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			r.server.FastForward(now.Sub(last))
+			last = now
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package dev
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+)
+
+// signaturePNG is a 1x1 transparent PNG, enough for the signature renderer to show an image
+const signaturePNG = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+type element = map[string]interface{}
+
+// sample is a seeded form together with one completed response to it
+type sample struct {
+	id          string
+	title       string
+	description string
+	category    string
+	pages       []interface{}
+	patient     string
+	answers     map[string]interface{}
+}
+
+// Seed writes a clinic for orgID, a form for every PDF pattern type and one submitted
+// response to each. Documents have fixed IDs, so seeding again restores the samples
+// instead of duplicating them. It returns the number of forms written.
+func Seed(ctx context.Context, client *firestore.Client, encryptor *services.FieldEncryptor, orgID string) (int, error) {
+	now := time.Now().UTC()
+
+	org := data.Organization{
+		UID:   orgID,
+		Name:  "Riverside Spine & Wellness (dev)",
+		Email: "frontdesk@riverside.example",
+		Phone: "(555) 010-2000",
+		Settings: data.OrganizationSettings{
+			HIPAACompliant:    true,
+			DataRetentionDays: 2555,
+			Timezone:          "America/New_York",
+		},
+		ClinicInfo: data.ClinicInfo{
+			ClinicName:   "Riverside Spine & Wellness",
+			AddressLine1: "100 River Road",
+			AddressLine2: "Suite 200",
+			City:         "Springfield",
+			State:        "IL",
+			ZipCode:      "62701",
+			Phone:        "(555) 010-2000",
+			Fax:          "(555) 010-2001",
+			Email:        "frontdesk@riverside.example",
+			Website:      "https://riverside.example",
+			NPI:          "1234567893",
+			PrimaryColor: "#1f4e79",
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := client.Collection("organizations").Doc(orgID).Set(ctx, org); err != nil {
+		return 0, fmt.Errorf("failed to seed organization: %w", err)
+	}
+
+	samples := samples()
+	for i, s := range samples {
+		formID := "dev-" + s.id
+		created := now.Add(-time.Duration(len(samples)-i) * 24 * time.Hour)
+		form := data.Form{
+			ID:             formID,
+			Title:          s.title,
+			Description:    s.description,
+			SurveyJSON:     map[string]interface{}{"title": s.title, "pages": s.pages},
+			CreatedAt:      created,
+			UpdatedAt:      created,
+			CreatedBy:      orgID,
+			UpdatedBy:      orgID,
+			OrganizationID: orgID,
+			Category:       s.category,
+			Tags:           []string{"sample"},
+			Version:        1,
+			Status:         "active",
+			PublishedAt:    &created,
+		}
+		if _, err := client.Collection("forms").Doc(formID).Set(ctx, form); err != nil {
+			return i, fmt.Errorf("failed to seed form %s: %w", formID, err)
+		}
+
+		responseID := formID + "-response"
+		started := created.Add(2 * time.Hour)
+		seconds := float64(8 * 60)
+		response := data.FormResponse{
+			OrganizationID:        orgID,
+			FormID:                formID,
+			Data:                  s.answers,
+			SubmittedBy:           orgID,
+			SubmittedAt:           started.Add(time.Duration(seconds) * time.Second),
+			FormTitle:             s.title,
+			PatientName:           s.patient,
+			Status:                "submitted",
+			StartedAt:             &started,
+			CompletionTimeSeconds: &seconds,
+			IPAddress:             "127.0.0.1",
+		}
+		sealed, err := encryptor.SealResponse(ctx, responseID, response)
+		if err != nil {
+			return i, fmt.Errorf("failed to encrypt response %s: %w", responseID, err)
+		}
+		if _, err := client.Collection("form_responses").Doc(responseID).Set(ctx, sealed); err != nil {
+			return i, fmt.Errorf("failed to seed response %s: %w", responseID, err)
+		}
+	}
+	return len(samples), nil
+}
+
+func page(name string, elements ...interface{}) element {
+	return element{"name": name, "elements": elements}
+}
+
+func panel(name, title string, elements ...interface{}) element {
+	return element{"type": "panel", "name": name, "title": title, "elements": elements}
+}
+
+func question(kind, name, title string) element {
+	return element{"type": kind, "name": name, "title": title}
+}
+
+func choices(kind, name, title string, options ...interface{}) element {
+	return element{"type": kind, "name": name, "title": title, "choices": options}
+}
+
+// tagged marks an element with the metadata the pattern detector looks for
+func tagged(e element, patternType string) element {
+	e["metadata"] = map[string]interface{}{"patternType": patternType}
+	return e
+}
+
+// scored builds one of the ten 0-5 questions of the NDI and Oswestry questionnaires
+func scored(n int, title string, levels ...string) element {
+	options := make([]interface{}, len(levels))
+	for i, text := range levels {
+		options[i] = map[string]interface{}{"value": i, "text": text}
+	}
+	return choices("radiogroup", fmt.Sprintf("question%d", n), title, options...)
+}
+
+func samples() []sample {
+	intake := sample{
+		id:          "patient-intake",
+		title:       "New Patient Intake",
+		description: "Demographics, vitals, insurance and office policies.",
+		category:    "intake",
+		patient:     "Jordan Avery",
+		pages: []interface{}{
+			page("demographics",
+				tagged(panel("patient_demographics", "Patient Information",
+					question("text", "first_name", "First Name"),
+					question("text", "last_name", "Last Name"),
+					question("text", "date_of_birth", "Date of Birth"),
+					choices("radiogroup", "sex_at_birth", "Sex at Birth", "Female", "Male"),
+					question("text", "phone", "Phone"),
+					question("text", "email", "Email"),
+					question("text", "street_address", "Street Address"),
+					question("text", "city", "City"),
+					question("text", "state", "State"),
+					question("text", "zip", "ZIP Code"),
+					question("text", "emergency_contact", "Emergency Contact"),
+					question("text", "emergency_phone", "Emergency Contact Phone"),
+				), "patient_demographics"),
+				tagged(panel("additional_demographics", "Additional Information",
+					choices("dropdown", "demographics_additional_marital_status", "Marital Status", "Single", "Married", "Divorced", "Widowed"),
+					choices("radiogroup", "demographics_additional_communication", "Preferred Contact Method", "Phone", "Text", "Email"),
+					question("text", "demographics_additional_employer", "Employer"),
+				), "additional_demographics"),
+			),
+			page("vitals",
+				tagged(panel("patient_vitals", "Height and Weight",
+					question("html", "vitals_header", ""),
+					question("text", "patient_height", "Height (inches)"),
+					question("text", "patient_weight", "Weight (lbs)"),
+				), "patient_vitals"),
+				tagged(panel("insurance_card", "Insurance",
+					question("file", "insurance_card_front", "Card Front"),
+					question("file", "insurance_card_back", "Card Back"),
+					question("text", "insurance_issuer_name", "Insurance Company"),
+					question("text", "insurance_member_id", "Member ID"),
+					question("text", "insurance_group_number", "Group Number"),
+				), "insurance_card"),
+			),
+			page("policies",
+				tagged(panel("terms_and_conditions", "Office Policies",
+					question("html", "terms_content", ""),
+					question("boolean", "terms_accepted", "I have read and accept the office policies"),
+				), "terms_and_conditions"),
+				choices("checkbox", "consent_to_treatment", "Consent to Treatment", "I consent to examination and treatment"),
+				question("signaturepad", "patient_signature", "Patient Signature"),
+				question("text", "signature_date", "Date"),
+			),
+		},
+		answers: map[string]interface{}{
+			"first_name":                             "Jordan",
+			"last_name":                              "Avery",
+			"date_of_birth":                          "1984-06-12",
+			"sex_at_birth":                           "Female",
+			"phone":                                  "5550104477",
+			"email":                                  "jordan.avery@example.com",
+			"street_address":                         "42 Elm Street",
+			"city":                                   "Springfield",
+			"state":                                  "IL",
+			"zip":                                    "62704",
+			"emergency_contact":                      "Sam Avery",
+			"emergency_phone":                        "5550104478",
+			"demographics_additional_marital_status": "Married",
+			"demographics_additional_communication":  "Text",
+			"demographics_additional_employer":       "Springfield Public Library",
+			"patient_height":                         "66",
+			"patient_weight":                         "150",
+			"insurance_issuer_name":                  "Offline Health Plan",
+			"insurance_member_id":                    "DEV00042",
+			"insurance_group_number":                 "GRP-7781",
+			"terms_accepted":                         true,
+			"consent_to_treatment":                   []interface{}{"I consent to examination and treatment"},
+			"patient_signature":                      signaturePNG,
+			"signature_date":                         "2026-01-15",
+		},
+	}
+
+	pain := sample{
+		id:          "pain-assessment",
+		title:       "Pain Assessment",
+		description: "Pain areas, intensity, frequency and body diagrams.",
+		category:    "assessment",
+		patient:     "Morgan Lee",
+		pages: []interface{}{
+			page("pain",
+				question("text", "patient_name", "Patient Name"),
+				tagged(panel("pain_assessment_panel", "Where do you have pain?",
+					panel("neck_panel", "Neck",
+						choices("radiogroup", "has_neck_pain", "Neck", "Yes", "No"),
+						question("rating", "neck_pain_intensity", "Intensity (0-10)"),
+						question("rating", "neck_pain_frequency", "Frequency (% of the day)"),
+					),
+					panel("low_back_panel", "Low Back",
+						choices("radiogroup", "has_low_back_pain", "Low Back", "Yes", "No"),
+						question("rating", "low_back_intensity", "Intensity (0-10)"),
+						question("rating", "low_back_frequency", "Frequency (% of the day)"),
+					),
+					panel("shoulder_panel", "Shoulder",
+						choices("radiogroup", "has_shoulder_pain", "Shoulder", "Yes", "No"),
+						choices("checkbox", "shoulder_side", "Side", "Left", "Right"),
+						question("rating", "shoulder_intensity", "Intensity (0-10)"),
+						question("rating", "shoulder_frequency", "Frequency (% of the day)"),
+					),
+				), "pain_assessment"),
+			),
+			page("diagrams",
+				tagged(question("bodypaindiagram", "pain_location_diagram", "Mark where you feel pain"), "body_pain_diagram"),
+				tagged(question("bodydiagram2", "sensation_areas", "Mark where you feel numbness or tingling"), "body_diagram_2"),
+			),
+		},
+		answers: map[string]interface{}{
+			"patient_name":        "Morgan Lee",
+			"has_neck_pain":       "Yes",
+			"neck_pain_intensity": 6,
+			"neck_pain_frequency": 75,
+			"has_low_back_pain":   "Yes",
+			"low_back_intensity":  4,
+			"low_back_frequency":  40,
+			"has_shoulder_pain":   "No",
+			"pain_location_diagram": []interface{}{
+				map[string]interface{}{"id": "p1", "x": 48.5, "y": 18.0, "intensity": 6, "area": "neck", "side": "back"},
+				map[string]interface{}{"id": "p2", "x": 50.0, "y": 46.0, "intensity": 4, "area": "lower back", "side": "back"},
+			},
+			"sensation_areas": []interface{}{
+				map[string]interface{}{"id": "s1", "x": 30.0, "y": 40.0, "sensation": "numbness", "area": "left forearm", "side": "front"},
+				map[string]interface{}{"id": "s2", "x": 45.0, "y": 85.0, "sensation": "pins_and_needles", "area": "left foot", "side": "front"},
+			},
+		},
+	}
+
+	ndi := sample{
+		id:          "neck-disability-index",
+		title:       "Neck Disability Index",
+		description: "Standard NDI questionnaire.",
+		category:    "outcome",
+		patient:     "Riley Chen",
+		pages: []interface{}{
+			page("ndi",
+				panel("ndi_panel", "Neck Disability Index Questionnaire",
+					question("text", "question1", "Name"),
+					question("text", "question2", "Date"),
+					scored(3, "Pain Intensity", "No pain", "Very mild", "Moderate", "Fairly severe", "Very severe", "Worst imaginable"),
+					scored(4, "Personal Care", "Normal", "Normal but painful", "Slow and careful", "Need some help", "Need help daily", "Stay in bed"),
+					scored(5, "Lifting", "Heavy without pain", "Heavy with pain", "Only if positioned", "Light to medium", "Very light only", "Cannot lift"),
+					scored(6, "Reading", "As much as I want", "Slight pain", "Moderate pain", "Cannot read as much", "Hardly at all", "Not at all"),
+					scored(7, "Headaches", "None", "Slight, infrequent", "Moderate, infrequent", "Moderate, frequent", "Severe, frequent", "Almost always"),
+					scored(8, "Concentration", "Full", "Slight difficulty", "Fair difficulty", "A lot of difficulty", "Great difficulty", "Cannot concentrate"),
+					scored(9, "Work", "As much as I want", "Usual work only", "Most of usual work", "Cannot do usual work", "Hardly any work", "No work"),
+					scored(10, "Driving", "Without pain", "Slight pain", "Moderate pain", "Cannot drive as long", "Hardly at all", "Not at all"),
+					scored(11, "Sleeping", "No trouble", "Under 1 hour lost", "1-2 hours lost", "2-3 hours lost", "3-5 hours lost", "5-7 hours lost"),
+					scored(12, "Recreation", "All activities", "All with some pain", "Most activities", "A few activities", "Hardly any", "None"),
+				),
+			),
+		},
+		answers: map[string]interface{}{
+			"question1": "Riley Chen", "question2": "2026-01-20",
+			"question3": 2, "question4": 1, "question5": 2, "question6": 1, "question7": 3,
+			"question8": 1, "question9": 2, "question10": 2, "question11": 1, "question12": 2,
+		},
+	}
+
+	oswestry := sample{
+		id:          "oswestry-disability-index",
+		title:       "Oswestry Disability Index",
+		description: "Standard ODI questionnaire for low back pain.",
+		category:    "outcome",
+		patient:     "Casey Morgan",
+		pages: []interface{}{
+			page("odi",
+				panel("odi_panel", "Oswestry Low Back Pain Disability Index",
+					question("text", "question1", "Name"),
+					question("text", "question2", "Date"),
+					scored(3, "Pain Intensity", "No pain", "Very mild", "Moderate", "Fairly severe", "Very severe", "Worst imaginable"),
+					scored(4, "Personal Care", "Normal", "Normal but painful", "Slow and careful", "Need some help", "Need help daily", "Stay in bed"),
+					scored(5, "Lifting", "Heavy without pain", "Heavy with pain", "Only if positioned", "Light to medium", "Very light only", "Cannot lift"),
+					scored(6, "Walking", "Any distance", "Under 1 mile", "Under 1/2 mile", "Under 100 yards", "Only with a cane", "In bed most of the time"),
+					scored(7, "Sitting", "Any chair, any time", "Favorite chair only", "Under 1 hour", "Under 30 minutes", "Under 10 minutes", "Cannot sit"),
+					scored(8, "Standing", "As long as I want", "With extra pain", "Under 1 hour", "Under 30 minutes", "Under 10 minutes", "Cannot stand"),
+					scored(9, "Sleeping", "Never disturbed", "Occasionally disturbed", "Under 6 hours", "Under 4 hours", "Under 2 hours", "Cannot sleep"),
+					scored(10, "Social Life", "Normal", "Normal, more pain", "Limits energetic interests", "Do not go out as often", "Restricted to home", "None"),
+					scored(11, "Traveling", "Anywhere", "Anywhere with pain", "Over 2 hours", "Under 1 hour", "Under 30 minutes", "Only for treatment"),
+					scored(12, "Employment/Homemaking", "Normal", "Normal with pain", "Most duties", "Light duties only", "Cannot do light duties", "Cannot do any"),
+				),
+			),
+		},
+		answers: map[string]interface{}{
+			"question1": "Casey Morgan", "question2": "2026-01-22",
+			"question3": 3, "question4": 1, "question5": 3, "question6": 2, "question7": 2,
+			"question8": 2, "question9": 1, "question10": 2, "question11": 1, "question12": 2,
+		},
+	}
+
+	history := sample{
+		id:          "patient-history",
+		title:       "Health History and Review of Systems",
+		description: "Chief complaint, medical history and review of systems.",
+		category:    "history",
+		patient:     "Taylor Brooks",
+		pages: []interface{}{
+			page("history",
+				question("text", "first_name", "First Name"),
+				question("text", "last_name", "Last Name"),
+				tagged(panel("patient_history", "Health History",
+					question("comment", "reason_for_visit", "Reason for today's visit"),
+					question("text", "complaint_start_date", "When did it start?"),
+					choices("radiogroup", "condition_status", "Is it getting", "Better", "Worse", "About the same"),
+					question("comment", "condition_helpers_worseners", "What makes it better or worse?"),
+					question("comment", "difficult_activities", "Activities that are difficult"),
+					question("comment", "goals_of_care", "Goals for care"),
+					choices("radiogroup", "had_chiropractic_care", "Have you had chiropractic care before?", "Yes", "No"),
+					choices("radiogroup", "history_surgeries", "Any surgeries?", "Yes", "No"),
+					question("comment", "surgeries_details", "Surgery details"),
+					choices("radiogroup", "history_accidents", "Any accidents?", "Yes", "No"),
+					question("text", "patient_occupation", "Occupation"),
+				), "patient_history_form"),
+			),
+			page("ros",
+				tagged(panel("review_of_systems", "Review of Systems",
+					choices("checkbox", "ros_constitutional", "Constitutional", "Fatigue", "Fever", "Weight loss"),
+					choices("checkbox", "ros_gastrointestinal", "Gastrointestinal", "Heartburn", "Nausea", "Constipation"),
+					choices("checkbox", "ros_musculoskeletal", "Musculoskeletal", "Joint pain", "Stiffness", "Muscle weakness"),
+					choices("checkbox", "ros_neurological", "Neurological", "Headaches", "Dizziness", "Numbness"),
+					choices("checkbox", "ros_endocrine", "Endocrine", "Thyroid disease", "Diabetes"),
+				), "review_of_systems"),
+			),
+		},
+		answers: map[string]interface{}{
+			"first_name":                  "Taylor",
+			"last_name":                   "Brooks",
+			"reason_for_visit":            "Low back pain after moving furniture",
+			"complaint_start_date":        "2026-01-02",
+			"condition_status":            "Better",
+			"condition_helpers_worseners": "Better with heat and walking, worse after sitting",
+			"difficult_activities":        "Sitting through meetings, lifting groceries",
+			"goals_of_care":               "Return to running three times a week",
+			"had_chiropractic_care":       "No",
+			"history_surgeries":           "Yes",
+			"surgeries_details":           "Appendectomy, 2010",
+			"history_accidents":           "No",
+			"patient_occupation":          "Accountant",
+			"ros_constitutional":          []interface{}{"Fatigue"},
+			"ros_gastrointestinal":        []interface{}{"Heartburn"},
+			"ros_musculoskeletal":         []interface{}{"Joint pain", "Stiffness"},
+			"ros_neurological":            []interface{}{"Headaches"},
+		},
+	}
+
+	return []sample{intake, pain, ndi, oswestry, history}
+}
@@ -0,0 +1,202 @@
+package dev_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"backend-go/internal/dev"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newClient(t *testing.T) *firestore.Client {
+	t.Helper()
+	server, err := dev.StartFirestore("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(server.Stop)
+	client, err := dev.DialFirestore(context.Background(), server.Addr(), "test-project")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestDocumentWritesAndPreconditions(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	ref := client.Collection("forms").Doc("f1")
+
+	if _, err := ref.Get(ctx); status.Code(err) != codes.NotFound {
+		t.Fatalf("missing document: got %v, want NotFound", err)
+	}
+	if _, err := ref.Create(ctx, map[string]interface{}{"title": "Intake", "meta": map[string]interface{}{"version": 1}}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := ref.Create(ctx, map[string]interface{}{"title": "Again"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("second create: got %v, want AlreadyExists", err)
+	}
+
+	_, err := ref.Update(ctx, []firestore.Update{
+		{Path: "meta.version", Value: firestore.Increment(2)},
+		{Path: "title", Value: firestore.Delete},
+		{Path: "status", Value: "active"},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	snap, err := ref.Get(ctx)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if version, _ := snap.DataAt("meta.version"); version != int64(3) {
+		t.Errorf("meta.version = %v, want 3", version)
+	}
+	if _, err := snap.DataAt("title"); err == nil {
+		t.Error("title survived a delete")
+	}
+
+	if _, err := ref.Set(ctx, map[string]interface{}{"tags": []string{"a"}}, firestore.MergeAll); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	snap, _ = ref.Get(ctx)
+	if snap.Data()["status"] != "active" {
+		t.Error("merge set dropped existing fields")
+	}
+
+	if _, err := client.Collection("forms").Doc("nope").Update(ctx, []firestore.Update{{Path: "x", Value: 1}}); status.Code(err) != codes.NotFound {
+		t.Fatalf("update of missing document: got %v, want NotFound", err)
+	}
+	if _, err := ref.Delete(ctx, firestore.LastUpdateTime(snap.UpdateTime.Add(-time.Second))); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("stale delete: got %v, want FailedPrecondition", err)
+	}
+	if _, err := ref.Delete(ctx, firestore.LastUpdateTime(snap.UpdateTime)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, org := range []string{"a", "b", "a", "a", "b"} {
+		_, err := client.Collection("events").Doc(string(rune('1'+i))).Set(ctx, map[string]interface{}{
+			"org":    org,
+			"seq":    i,
+			"at":     base.Add(time.Duration(i) * time.Hour),
+			"labels": []string{org, "all"},
+		})
+		if err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	// A subcollection with the same ID must not leak into a plain collection query
+	client.Collection("orgs").Doc("a").Collection("events").Doc("x").Set(ctx, map[string]interface{}{"org": "a", "seq": 99})
+
+	ids := func(q firestore.Query) []string {
+		t.Helper()
+		docs, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		out := make([]string, len(docs))
+		for i, doc := range docs {
+			out[i] = doc.Ref.ID
+		}
+		return out
+	}
+	events := client.Collection("events")
+
+	cases := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"equality", ids(events.Where("org", "==", "a")), []string{"1", "3", "4"}},
+		{"range and order", ids(events.Where("at", ">=", base.Add(2*time.Hour)).OrderBy("at", firestore.Desc)), []string{"5", "4", "3"}},
+		{"limit", ids(events.OrderBy("seq", firestore.Asc).Limit(2)), []string{"1", "2"}},
+		{"in", ids(events.Where("seq", "in", []int{1, 4})), []string{"2", "5"}},
+		{"array-contains", ids(events.Where("labels", "array-contains", "b")), []string{"2", "5"}},
+		{"compound", ids(events.Where("org", "==", "b").Where("seq", "<", 3)), []string{"2"}},
+		{"cursor", ids(events.OrderBy("seq", firestore.Asc).StartAfter(2)), []string{"4", "5"}},
+		{"collection group", ids(client.CollectionGroup("events").Where("seq", "==", 99)), []string{"x"}},
+	}
+	for _, tc := range cases {
+		if len(tc.got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+			continue
+		}
+		for i := range tc.got {
+			if tc.got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, tc.got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestTransactionsAndBatches(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	counter := client.Collection("counters").Doc("c")
+
+	for i := 0; i < 3; i++ {
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			snap, err := tx.Get(counter)
+			n := int64(0)
+			if err == nil {
+				n = snap.Data()["n"].(int64)
+			} else if status.Code(err) != codes.NotFound {
+				return err
+			}
+			return tx.Set(counter, map[string]interface{}{"n": n + 1})
+		})
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+	snap, _ := counter.Get(ctx)
+	if n := snap.Data()["n"]; n != int64(3) {
+		t.Fatalf("n = %v, want 3", n)
+	}
+
+	// A write that lands between a transaction's read and its commit aborts the commit;
+	// the client retries the function against the new value
+	attempts := 0
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		attempts++
+		snap, err := tx.Get(counter)
+		if err != nil {
+			return err
+		}
+		if attempts == 1 {
+			if _, err := counter.Set(ctx, map[string]interface{}{"n": int64(10)}); err != nil {
+				return err
+			}
+		}
+		return tx.Set(counter, map[string]interface{}{"n": snap.Data()["n"].(int64) + 1})
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("conflicting transaction: %v after %d attempts", err, attempts)
+	}
+	snap, _ = counter.Get(ctx)
+	if n := snap.Data()["n"]; n != int64(11) {
+		t.Fatalf("n = %v after a conflicting write, want 11", n)
+	}
+
+	// A failed write must leave the rest of the batch unapplied
+	batch := client.Batch()
+	batch.Set(client.Collection("counters").Doc("d"), map[string]interface{}{"n": 1})
+	batch.Create(counter, map[string]interface{}{"n": 0})
+	if _, err := batch.Commit(ctx); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("batch: got %v, want AlreadyExists", err)
+	}
+	if _, err := client.Collection("counters").Doc("d").Get(ctx); status.Code(err) != codes.NotFound {
+		t.Fatal("partial batch was applied")
+	}
+}
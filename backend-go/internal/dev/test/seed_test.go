@@ -0,0 +1,69 @@
+package dev_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/services"
+)
+
+func TestSeedCoversEveryPattern(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	provider, err := services.NewLocalKeyProvider(filepath.Join(t.TempDir(), "kek.json"), true)
+	if err != nil {
+		t.Fatalf("key provider: %v", err)
+	}
+	encryptor := services.NewFieldEncryptor(client, provider)
+
+	seeded, err := dev.Seed(ctx, client, encryptor, "org-1")
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	// Seeding is repeatable and restores the same documents
+	if again, err := dev.Seed(ctx, client, encryptor, "org-1"); err != nil || again != seeded {
+		t.Fatalf("second seed: %d, %v", again, err)
+	}
+	responses, err := client.Collection("form_responses").Where("organizationId", "==", "org-1").Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatalf("list responses: %v", err)
+	}
+	if len(responses) != seeded {
+		t.Fatalf("got %d responses for %d forms", len(responses), seeded)
+	}
+
+	detector := services.NewPatternDetector()
+	found := map[string]bool{}
+	for _, doc := range responses {
+		response, err := encryptor.OpenResponse(ctx, doc)
+		if err != nil {
+			t.Fatalf("open %s: %v", doc.Ref.ID, err)
+		}
+		formDoc, err := client.Collection("forms").Doc(response.FormID).Get(ctx)
+		if err != nil {
+			t.Fatalf("form %s: %v", response.FormID, err)
+		}
+		var form data.Form
+		if err := formDoc.DataTo(&form); err != nil {
+			t.Fatalf("decode form %s: %v", response.FormID, err)
+		}
+		patterns, _ := detector.DetectPatterns(form.SurveyJSON, response.Data)
+		for _, p := range patterns {
+			found[p.PatternType] = true
+		}
+	}
+
+	for _, want := range []string{
+		"terms_checkbox", "terms_conditions", "patient_demographics", "additional_demographics",
+		"review_of_systems", "neck_disability_index", "oswestry_disability", "sensation_areas_diagram",
+		"body_pain_diagram_2", "pain_assessment", "patient_vitals", "insurance_card", "signature",
+		"patient_history_form",
+	} {
+		if !found[want] {
+			t.Errorf("no seeded form triggers %s", want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package dev
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+)
+
+// typeOrder ranks value types the way Firestore orders mixed-type fields
+func typeOrder(value *pb.Value) int {
+	switch value.GetValueType().(type) {
+	case nil, *pb.Value_NullValue:
+		return 0
+	case *pb.Value_BooleanValue:
+		return 1
+	case *pb.Value_IntegerValue, *pb.Value_DoubleValue:
+		return 2
+	case *pb.Value_TimestampValue:
+		return 3
+	case *pb.Value_StringValue:
+		return 4
+	case *pb.Value_BytesValue:
+		return 5
+	case *pb.Value_ReferenceValue:
+		return 6
+	case *pb.Value_GeoPointValue:
+		return 7
+	case *pb.Value_ArrayValue:
+		return 8
+	default:
+		return 9
+	}
+}
+
+// sameKind reports whether two values are comparable by a range filter
+func sameKind(a, b *pb.Value) bool {
+	return typeOrder(a) == typeOrder(b)
+}
+
+func isNumber(value *pb.Value) bool {
+	return typeOrder(value) == 2
+}
+
+func toFloat(value *pb.Value) float64 {
+	switch v := value.GetValueType().(type) {
+	case *pb.Value_IntegerValue:
+		return float64(v.IntegerValue)
+	case *pb.Value_DoubleValue:
+		return v.DoubleValue
+	}
+	return 0
+}
+
+// compareValues orders two values; values of different types order by type
+func compareValues(a, b *pb.Value) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return compareInts(ta, tb)
+	}
+	switch av := a.GetValueType().(type) {
+	case *pb.Value_BooleanValue:
+		bv := b.GetBooleanValue()
+		switch {
+		case av.BooleanValue == bv:
+			return 0
+		case !av.BooleanValue:
+			return -1
+		}
+		return 1
+	case *pb.Value_IntegerValue:
+		if bv, ok := b.ValueType.(*pb.Value_IntegerValue); ok {
+			return compareInts64(av.IntegerValue, bv.IntegerValue)
+		}
+		return compareFloats(toFloat(a), toFloat(b))
+	case *pb.Value_DoubleValue:
+		return compareFloats(av.DoubleValue, toFloat(b))
+	case *pb.Value_TimestampValue:
+		bt := b.GetTimestampValue()
+		if c := compareInts64(av.TimestampValue.GetSeconds(), bt.GetSeconds()); c != 0 {
+			return c
+		}
+		return compareInts64(int64(av.TimestampValue.GetNanos()), int64(bt.GetNanos()))
+	case *pb.Value_StringValue:
+		return strings.Compare(av.StringValue, b.GetStringValue())
+	case *pb.Value_BytesValue:
+		return bytes.Compare(av.BytesValue, b.GetBytesValue())
+	case *pb.Value_ReferenceValue:
+		left := strings.Split(av.ReferenceValue, "/")
+		right := strings.Split(b.GetReferenceValue(), "/")
+		for i := 0; i < len(left) && i < len(right); i++ {
+			if c := strings.Compare(left[i], right[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(left), len(right))
+	case *pb.Value_GeoPointValue:
+		bg := b.GetGeoPointValue()
+		if c := compareFloats(av.GeoPointValue.GetLatitude(), bg.GetLatitude()); c != 0 {
+			return c
+		}
+		return compareFloats(av.GeoPointValue.GetLongitude(), bg.GetLongitude())
+	case *pb.Value_ArrayValue:
+		left, right := av.ArrayValue.GetValues(), b.GetArrayValue().GetValues()
+		for i := 0; i < len(left) && i < len(right); i++ {
+			if c := compareValues(left[i], right[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(len(left), len(right))
+	case *pb.Value_MapValue:
+		return compareMaps(av.MapValue.GetFields(), b.GetMapValue().GetFields())
+	}
+	return 0
+}
+
+func compareMaps(a, b map[string]*pb.Value) int {
+	keys := func(m map[string]*pb.Value) []string {
+		out := make([]string, 0, len(m))
+		for key := range m {
+			out = append(out, key)
+		}
+		sort.Strings(out)
+		return out
+	}
+	left, right := keys(a), keys(b)
+	for i := 0; i < len(left) && i < len(right); i++ {
+		if c := strings.Compare(left[i], right[i]); c != 0 {
+			return c
+		}
+		if c := compareValues(a[left[i]], b[right[i]]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(left), len(right))
+}
+
+// compareFloats orders NaN before every other number, as Firestore does
+func compareFloats(a, b float64) int {
+	switch {
+	case math.IsNaN(a) && math.IsNaN(b):
+		return 0
+	case math.IsNaN(a):
+		return -1
+	case math.IsNaN(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int) int {
+	return compareInts64(int64(a), int64(b))
+}
+
+func compareInts64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func containsValue(values []*pb.Value, target *pb.Value) bool {
+	for _, value := range values {
+		if compareValues(value, target) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFieldPath splits a dotted field path, honouring backtick-quoted segments
+func parseFieldPath(path string) []string {
+	var segments []string
+	var current strings.Builder
+	quoted := false
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		switch {
+		case ch == '`':
+			quoted = !quoted
+		case ch == '\\' && quoted && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case ch == '.' && !quoted:
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	return append(segments, current.String())
+}
+
+func lookupPath(fields map[string]*pb.Value, segments []string) (*pb.Value, bool) {
+	value, ok := fields[segments[0]]
+	if !ok {
+		return nil, false
+	}
+	if len(segments) == 1 {
+		return value, true
+	}
+	nested, isMap := value.ValueType.(*pb.Value_MapValue)
+	if !isMap {
+		return nil, false
+	}
+	return lookupPath(nested.MapValue.Fields, segments[1:])
+}
+
+func setPath(fields map[string]*pb.Value, segments []string, value *pb.Value) {
+	if len(segments) == 1 {
+		fields[segments[0]] = value
+		return
+	}
+	nested, isMap := fields[segments[0]].GetValueType().(*pb.Value_MapValue)
+	if !isMap {
+		nested = &pb.Value_MapValue{MapValue: &pb.MapValue{}}
+		fields[segments[0]] = &pb.Value{ValueType: nested}
+	}
+	if nested.MapValue.Fields == nil {
+		nested.MapValue.Fields = map[string]*pb.Value{}
+	}
+	setPath(nested.MapValue.Fields, segments[1:], value)
+}
+
+func deletePath(fields map[string]*pb.Value, segments []string) {
+	if len(segments) == 1 {
+		delete(fields, segments[0])
+		return
+	}
+	if nested, isMap := fields[segments[0]].GetValueType().(*pb.Value_MapValue); isMap {
+		deletePath(nested.MapValue.Fields, segments[1:])
+	}
+}
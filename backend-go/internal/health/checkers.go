@@ -0,0 +1,92 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Redis checks the shared Redis client with a PING. It is not critical: CSRF tokens,
+// rate limiting and locks fall back or fail open while Redis is down.
+func Redis(client func() *redis.Client) Checker {
+	return Checker{
+		Name: "redis",
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			rdb := client()
+			if rdb == nil {
+				return nil, fmt.Errorf("redis client unavailable")
+			}
+			if err := rdb.Ping(ctx).Err(); err != nil {
+				return nil, err
+			}
+			stats := rdb.PoolStats()
+			return map[string]interface{}{
+				"total_connections": stats.TotalConns,
+				"idle_connections":  stats.IdleConns,
+				"stale_connections": stats.StaleConns,
+				"hits":              stats.Hits,
+				"misses":            stats.Misses,
+				"timeouts":          stats.Timeouts,
+			}, nil
+		},
+	}
+}
+
+// Firestore checks the database with a single document read. A missing probe document
+// is a successful round trip.
+func Firestore(client *firestore.Client) Checker {
+	return Checker{
+		Name:     "firestore",
+		Critical: true,
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			_, err := client.Collection("_health").Doc("probe").Get(ctx)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return nil, err
+			}
+			return nil, nil
+		},
+	}
+}
+
+// Gotenberg checks the PDF converter through its /health endpoint. It is critical so
+// Cloud Run stops routing to an instance that cannot generate PDFs.
+func Gotenberg(check func(ctx context.Context) error) Checker {
+	return Checker{
+		Name:     "gotenberg",
+		Critical: true,
+		Timeout:  3 * time.Second,
+		CacheTTL: 15 * time.Second,
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, check(ctx)
+		},
+	}
+}
+
+// Vertex checks that the Vertex AI model is reachable. AI features are optional, so a
+// failure only degrades the report; results are cached longer to keep probes cheap.
+func Vertex(check func(ctx context.Context) error) Checker {
+	return Checker{
+		Name:     "vertex_ai",
+		Timeout:  5 * time.Second,
+		CacheTTL: time.Minute,
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, check(ctx)
+		},
+	}
+}
+
+// AuditLogger checks the audit trail's writer state. PHI must not be served while audit
+// entries cannot be recorded, so it is critical.
+func AuditLogger(check CheckFunc) Checker {
+	return Checker{
+		Name:     "audit_logger",
+		Critical: true,
+		CacheTTL: 5 * time.Second,
+		Check:    check,
+	}
+}
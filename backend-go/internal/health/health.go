@@ -0,0 +1,192 @@
+// Package health runs dependency checks for the liveness, readiness and detailed health
+// endpoints. Each checker has its own timeout and caches its last result, so frequent
+// probes from Cloud Run do not turn into a stream of calls against Firestore or Gotenberg.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultCacheTTL = 10 * time.Second
+)
+
+// Status values reported for a check and for the service as a whole
+const (
+	StatusUp          = "up"
+	StatusDown        = "down"
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+)
+
+// CheckFunc probes one dependency. Details are only shown on the authenticated endpoint,
+// so they may include configuration but never PHI.
+type CheckFunc func(ctx context.Context) (details map[string]interface{}, err error)
+
+// Checker describes a dependency check
+type Checker struct {
+	Name string
+	// Critical checks decide readiness; non-critical failures only degrade the report
+	Critical bool
+	Timeout  time.Duration // default 2s
+	CacheTTL time.Duration // how long a result is reused; default 10s
+	Check    CheckFunc
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	Critical  bool                   `json:"critical"`
+	Error     string                 `json:"error,omitempty"`
+	Latency   string                 `json:"latency"`
+	CheckedAt time.Time              `json:"checked_at"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the combined outcome of a set of checks
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every critical check passed
+func (r Report) Ready() bool {
+	return r.Status != StatusUnavailable
+}
+
+type entry struct {
+	checker Checker
+
+	mu      sync.Mutex
+	result  Result
+	expires time.Time
+}
+
+// Registry holds the registered checkers
+type Registry struct {
+	mu      sync.RWMutex
+	entries []*entry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a checker. Reports list checks in registration order.
+func (r *Registry) Register(checker Checker) {
+	if checker.Timeout <= 0 {
+		checker.Timeout = defaultTimeout
+	}
+	if checker.CacheTTL <= 0 {
+		checker.CacheTTL = defaultCacheTTL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, &entry{checker: checker})
+}
+
+// Run executes the registered checks concurrently, reusing cached results. With
+// criticalOnly set only the checks that decide readiness run.
+func (r *Registry) Run(ctx context.Context, criticalOnly bool) Report {
+	r.mu.RLock()
+	entries := make([]*entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		if !criticalOnly || e.checker.Critical {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = StatusUnavailable
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run returns the cached result or runs the check. Concurrent probes for the same
+// checker wait for one run instead of each calling the dependency.
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(e.expires) {
+		return e.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, e.checker.Timeout)
+	defer cancel()
+
+	details, err := e.check(checkCtx)
+	result := Result{
+		Name:      e.checker.Name,
+		Status:    StatusUp,
+		Critical:  e.checker.Critical,
+		Latency:   time.Since(now).Round(time.Millisecond).String(),
+		CheckedAt: now.UTC(),
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	// A probe cancelled by its caller says nothing about the dependency
+	if ctx.Err() == nil {
+		e.result = result
+		e.expires = now.Add(e.checker.CacheTTL)
+	}
+	return result
+}
+
+// check runs the check function, giving up when the timeout expires even if the function
+// ignores its context
+func (e *entry) check(ctx context.Context) (map[string]interface{}, error) {
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("check panicked: %v", p)}
+			}
+		}()
+		details, err := e.checker.Check(ctx)
+		done <- outcome{details, err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.details, out.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timed out after %v", e.checker.Timeout)
+	}
+}
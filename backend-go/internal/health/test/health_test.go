@@ -0,0 +1,86 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend-go/internal/health"
+)
+
+func TestResultsAreCachedUntilTTL(t *testing.T) {
+	var calls atomic.Int32
+	registry := health.NewRegistry()
+	registry.Register(health.Checker{
+		Name:     "counter",
+		Critical: true,
+		CacheTTL: 50 * time.Millisecond,
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			calls.Add(1)
+			return nil, nil
+		},
+	})
+
+	for i := 0; i < 5; i++ {
+		registry.Run(context.Background(), true)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected 1 call within TTL, got %d", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	registry.Run(context.Background(), true)
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("expected a fresh call after TTL, got %d calls", got)
+	}
+}
+
+func TestSlowCheckTimesOut(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.Register(health.Checker{
+		Name:     "gotenberg",
+		Critical: true,
+		Timeout:  20 * time.Millisecond,
+		Check: func(ctx context.Context) (map[string]interface{}, error) {
+			time.Sleep(time.Second) // ignores ctx, like a hung client
+			return nil, nil
+		},
+	})
+
+	start := time.Now()
+	report := registry.Run(context.Background(), true)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("check was not cut off by its timeout (took %v)", elapsed)
+	}
+	if report.Ready() || report.Checks[0].Status != health.StatusDown {
+		t.Fatalf("expected timed-out critical check to fail readiness, got %+v", report)
+	}
+}
+
+func TestOnlyCriticalFailuresFailReadiness(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.Register(health.Checker{
+		Name:     "firestore",
+		Critical: true,
+		Check:    func(ctx context.Context) (map[string]interface{}, error) { return nil, nil },
+	})
+	registry.Register(health.Checker{
+		Name:  "vertex_ai",
+		Check: func(ctx context.Context) (map[string]interface{}, error) { return nil, errors.New("unreachable") },
+	})
+
+	readiness := registry.Run(context.Background(), true)
+	if readiness.Status != health.StatusOK || len(readiness.Checks) != 1 {
+		t.Fatalf("readiness should run only critical checks, got %+v", readiness)
+	}
+
+	details := registry.Run(context.Background(), false)
+	if details.Status != health.StatusDegraded || !details.Ready() {
+		t.Fatalf("non-critical failure should degrade but stay ready, got %+v", details)
+	}
+	if details.Checks[1].Error != "unreachable" {
+		t.Fatalf("expected error detail, got %+v", details.Checks[1])
+	}
+}
@@ -0,0 +1,178 @@
+// Package lifecycle runs the server and its background workers and shuts them down in
+// order. On SIGTERM the listener stops accepting connections, in-flight requests and
+// workers get until the drain deadline to finish, and the shutdown hooks (lock release,
+// audit flush, client teardown) run in the order they were registered.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Hook is a cleanup step run during shutdown. It should return promptly once ctx expires;
+// hooks that ignore their context are abandoned at the deadline.
+type Hook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// Manager owns the background workers and shutdown hooks of one process
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	workers sync.WaitGroup
+
+	mu    sync.Mutex
+	hooks []namedHook
+}
+
+// New creates a manager. Workers started with Go are cancelled when shutdown begins or
+// when parent is cancelled.
+func New(parent context.Context) *Manager {
+	ctx, cancel := context.WithCancel(parent)
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Context is cancelled when shutdown begins
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go starts a background worker. The worker must return once its context is cancelled;
+// shutdown waits for it until the drain deadline.
+func (m *Manager) Go(name string, worker func(ctx context.Context)) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		worker(m.ctx)
+		if m.ctx.Err() == nil {
+			log.Printf("LIFECYCLE: worker %s exited before shutdown", name)
+		}
+	}()
+}
+
+// OnShutdown registers a hook. Hooks run one at a time in registration order after
+// requests and workers have drained, so register dependents before what they depend on
+// (flush the audit trail before closing Firestore).
+func (m *Manager) OnShutdown(name string, hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, namedHook{name: name, fn: hook})
+}
+
+// Serve runs srv until SIGTERM or SIGINT arrives, then shuts down within timeout. It
+// returns an error if the listener fails or shutdown does not complete cleanly.
+func (m *Manager) Serve(srv *http.Server, timeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var listenErr error
+	select {
+	case sig := <-signals:
+		log.Printf("LIFECYCLE: received %v, shutting down (deadline %v)", sig, timeout)
+	case err := <-serveErr:
+		listenErr = fmt.Errorf("server stopped: %w", err)
+		log.Printf("LIFECYCLE: %v, shutting down", listenErr)
+	case <-m.ctx.Done():
+		log.Printf("LIFECYCLE: context cancelled, shutting down")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return errors.Join(listenErr, m.Shutdown(ctx, srv))
+}
+
+// Shutdown stops srv and the workers and runs the hooks. Three quarters of the time left
+// on ctx goes to draining requests and workers; the rest is kept for the hooks so locks
+// are released and the audit trail flushed even when a request overruns. srv may be nil.
+func (m *Manager) Shutdown(ctx context.Context, srv *http.Server) error {
+	start := time.Now()
+	drainCtx, cancel := context.WithCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		drainCtx, cancel = context.WithDeadline(ctx, start.Add(time.Until(deadline)*3/4))
+	}
+	defer cancel()
+
+	var errs []error
+
+	// Stop accepting connections and wait for in-flight handlers
+	if srv != nil {
+		if err := srv.Shutdown(drainCtx); err != nil {
+			log.Printf("LIFECYCLE: requests still running at drain deadline, closing connections")
+			errs = append(errs, fmt.Errorf("drain requests: %w", err))
+			srv.Close()
+		}
+	}
+
+	// Then stop the workers, which may still be finishing a sweep
+	m.cancel()
+	if err := wait(drainCtx, &m.workers); err != nil {
+		log.Printf("LIFECYCLE: workers still running at drain deadline")
+		errs = append(errs, fmt.Errorf("drain workers: %w", err))
+	}
+
+	m.mu.Lock()
+	hooks := append([]namedHook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		if err := runHook(ctx, hook.fn); err != nil {
+			log.Printf("LIFECYCLE: %s: %v", hook.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+		}
+	}
+
+	log.Printf("LIFECYCLE: shutdown finished in %v", time.Since(start).Round(time.Millisecond))
+	return errors.Join(errs...)
+}
+
+// runHook runs a hook, abandoning it if ctx expires first
+func runHook(ctx context.Context, hook Hook) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panicked: %v", p)
+			}
+		}()
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait blocks until wg is done or ctx expires
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+package lifecycle_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend-go/internal/lifecycle"
+)
+
+// startServer serves handler on a loopback port and returns its base URL
+func startServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: handler}
+	go srv.Serve(listener)
+	return srv, "http://" + listener.Addr().String()
+}
+
+func TestShutdownDrainsRequestsAndWorkersBeforeHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	started := make(chan struct{})
+	srv, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		record("request done")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	app := lifecycle.New(context.Background())
+	app.Go("sweeper", func(ctx context.Context) {
+		<-ctx.Done()
+		record("worker done")
+	})
+	app.OnShutdown("release locks", func(context.Context) error {
+		record("release locks")
+		return nil
+	})
+	app.OnShutdown("close clients", func(context.Context) error {
+		record("close clients")
+		return nil
+	})
+
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			responses <- 0
+			return
+		}
+		resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := app.Shutdown(ctx, srv); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	if status := <-responses; status != http.StatusOK {
+		t.Fatalf("in-flight request was not completed, status %d", status)
+	}
+	want := "request done,worker done,release locks,close clients"
+	if got := strings.Join(events, ","); got != want {
+		t.Fatalf("shutdown order = %s, want %s", got, want)
+	}
+	if app.Context().Err() == nil {
+		t.Fatal("worker context not cancelled")
+	}
+}
+
+func TestHooksRunWhenDrainOverruns(t *testing.T) {
+	app := lifecycle.New(context.Background())
+	app.Go("stuck", func(ctx context.Context) {
+		time.Sleep(time.Second) // ignores cancellation
+	})
+
+	hookRan := make(chan struct{})
+	app.OnShutdown("release locks", func(context.Context) error {
+		close(hookRan)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := app.Shutdown(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "drain workers") {
+		t.Fatalf("expected a drain error, got %v", err)
+	}
+	select {
+	case <-hookRan:
+	default:
+		t.Fatal("hook skipped after the drain deadline")
+	}
+}
+
+func TestHungHookIsAbandonedAtDeadline(t *testing.T) {
+	app := lifecycle.New(context.Background())
+	app.OnShutdown("hung close", func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := app.Shutdown(ctx, nil)
+	if err == nil || !strings.Contains(err.Error(), "hung close") {
+		t.Fatalf("expected the hung hook to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("shutdown waited %v for a hung hook", elapsed)
+	}
+}
@@ -0,0 +1,97 @@
+// Package logging provides the structured logger used across the backend. Every handler
+// it builds redacts PHI before a record is written, including records produced by the
+// standard library log package once Setup has run.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Setup builds the process logger from the environment and installs it as the slog and
+// log package default. LOG_LEVEL is debug, info, warn or error (default info); LOG_FORMAT
+// is json or text (default json in production, text elsewhere).
+func Setup() *slog.Logger {
+	format := os.Getenv("LOG_FORMAT")
+	if format == "" {
+		format = "text"
+		if isProduction() {
+			format = "json"
+		}
+	}
+
+	logger := New(os.Stderr, ParseLevel(os.Getenv("LOG_LEVEL")), format == "json")
+	// This also routes legacy log.Printf calls through the redacting handler
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New builds a redacting logger that writes to w
+func New(w io.Writer, level slog.Level, json bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if json {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(NewRedactingHandler(handler))
+}
+
+// ParseLevel maps a LOG_LEVEL value to a slog level, defaulting to info
+func ParseLevel(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger attached to ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// With returns a context whose logger carries the extra attributes
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// DebugDumpsEnabled reports whether field-level debug dumps may be logged. They are off
+// unless LOG_DEBUG_DUMPS=true, and always off in production.
+func DebugDumpsEnabled() bool {
+	return !isProduction() && os.Getenv("LOG_DEBUG_DUMPS") == "true"
+}
+
+// Dump logs field names, metadata and other detail useful while debugging a form. It is a
+// no-op unless DebugDumpsEnabled; when enabled the output is still redacted.
+func Dump(ctx context.Context, msg string, args ...any) {
+	if !DebugDumpsEnabled() {
+		return
+	}
+	FromContext(ctx).DebugContext(ctx, msg, args...)
+}
+
+func isProduction() bool {
+	return os.Getenv("ENVIRONMENT") == "production"
+}
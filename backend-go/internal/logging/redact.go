@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must not reach log output
+const Redacted = "[REDACTED]"
+
+// phiKeyFragments match attribute and map keys whose values are PHI. Keys are compared
+// lowercased with separators removed, so "Patient-Name" and "patient_name" both match.
+var phiKeyFragments = []string{
+	"patientname", "firstname", "lastname", "middlename", "fullname", "preferredname",
+	"dateofbirth", "birthdate", "ssn", "socialsecurity",
+	"phone", "mobile", "email", "address", "street", "zipcode", "postalcode",
+	"insurance", "memberid", "policynumber", "groupnumber", "medicalrecord",
+	"signature", "responsedata", "answers", "diagnosis", "medication", "allerg",
+}
+
+// phiKeys match only when the whole key is one of these; they are too short to match as fragments
+var phiKeys = map[string]bool{"dob": true, "mrn": true, "ip": true}
+
+type valuePattern struct {
+	re          *regexp.Regexp
+	replacement string
+	// skip reports whether the match at [start, end) of s is not PHI after all
+	skip func(s string, start, end int) bool
+}
+
+var valuePatterns = []valuePattern{
+	{re: regexp.MustCompile(`data:[\w.+-]+/[\w.+-]+;base64,[A-Za-z0-9+/=]+`), replacement: "data:[REDACTED]"},
+	{re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), replacement: "[REDACTED-SSN]"},
+	{re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), replacement: "[REDACTED-EMAIL]"},
+	{re: regexp.MustCompile(`(?:\+?1[-.\s]?)?(?:\(\d{3}\)\s?|\b\d{3}[-.\s])\d{3}[-.\s]\d{4}\b`), replacement: "[REDACTED-PHONE]"},
+	{re: regexp.MustCompile(`\b\d{1,2}/\d{1,2}/\d{4}\b`), replacement: "[REDACTED-DATE]"},
+	{
+		re:          regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`),
+		replacement: "[REDACTED-DATE]",
+		// Timestamps ("2024-01-02T15:04:05Z", "2024-01-02 15:04:05") are operational, not birth dates
+		skip: func(s string, _, end int) bool {
+			return end < len(s) && (s[end] == 'T' || (s[end] == ' ' && end+3 < len(s) && s[end+3] == ':'))
+		},
+	},
+}
+
+// IsPHIKey reports whether values logged under key should be treated as PHI
+func IsPHIKey(key string) bool {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == ' ' || r == '.' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+	if phiKeys[normalized] {
+		return true
+	}
+	for _, fragment := range phiKeyFragments {
+		if strings.Contains(normalized, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactString replaces SSNs, dates, phone numbers, email addresses and data URIs in s
+func RedactString(s string) string {
+	for _, pattern := range valuePatterns {
+		if pattern.skip == nil {
+			s = pattern.re.ReplaceAllString(s, pattern.replacement)
+			continue
+		}
+		matches := pattern.re.FindAllStringIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			if pattern.skip(s, m[0], m[1]) {
+				continue
+			}
+			b.WriteString(s[last:m[0]])
+			b.WriteString(pattern.replacement)
+			last = m[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// RedactValue redacts a decoded JSON-like value: PHI keys are replaced wholesale and
+// strings are scanned for PHI patterns
+func RedactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return RedactString(val)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for key, nested := range val {
+			if IsPHIKey(key) {
+				out[key] = Redacted
+			} else {
+				out[key] = RedactValue(nested)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, nested := range val {
+			out[i] = RedactValue(nested)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// RedactingHandler wraps a slog.Handler and redacts every record before it is written.
+// Messages and string attributes are scanned for PHI patterns; attributes with PHI keys
+// are dropped to a placeholder; structured values are redacted field by field.
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps next with redaction
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if IsPHIKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, RedactString(a.Value.String()))
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]any, len(group))
+		for i, nested := range group {
+			redacted[i] = redactAttr(nested)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		return slog.Any(a.Key, redactAny(a.Value.Any()))
+	default:
+		return a
+	}
+}
+
+// redactAny handles arbitrary values by way of their JSON form, so PHI nested in structs
+// and maps is caught no matter how the value is typed
+func redactAny(v any) any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return RedactString(val.Error())
+	case fmt.Stringer:
+		return RedactString(val.String())
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return RedactString(fmt.Sprintf("%v", v))
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return Redacted
+	}
+	return RedactValue(decoded)
+}
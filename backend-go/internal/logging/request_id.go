@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID on inbound requests, responses and outbound calls
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// NewRequestID returns a fresh correlation ID
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ValidRequestID reports whether a caller-supplied ID is safe to adopt. IDs end up in
+// headers, log lines and PDF footers, so only short printable tokens are accepted.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r))
+	}) == -1
+}
+
+// WithRequestID returns a context carrying id, with a logger that tags every line with it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return With(ctx, "request_id", id)
+}
+
+// RequestID returns the correlation ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Detach returns a background context that keeps ctx's request ID and logger but not its
+// deadline or cancellation, for work that must outlive the request
+func Detach(ctx context.Context) context.Context {
+	detached := WithLogger(context.Background(), FromContext(ctx))
+	if id := RequestID(ctx); id != "" {
+		detached = context.WithValue(detached, requestIDKey{}, id)
+	}
+	return detached
+}
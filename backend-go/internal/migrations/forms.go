@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// formOrganizationID gives forms created before organizations existed an organizationId.
+// Such forms are invisible to ListForms, and CreateShareLink used to patch them with
+// whichever organization first shared them.
+var formOrganizationID = Migration{
+	ID:         1,
+	Name:       "form-organization-id",
+	Collection: "forms",
+	Apply: func(ctx context.Context, env *Env, doc *firestore.DocumentSnapshot, dryRun bool) (bool, error) {
+		if orgID, _ := doc.Data()["organizationId"].(string); orgID != "" {
+			return false, nil
+		}
+		orgID, err := formOwner(ctx, env.Client, doc)
+		if err != nil {
+			return false, err
+		}
+		if orgID == "" {
+			log.Printf("MIGRATIONS: form %s has no organization and nothing to infer one from; left unchanged", doc.Ref.ID)
+			return false, nil
+		}
+		if dryRun {
+			return true, nil
+		}
+
+		changed := false
+		err = env.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			if existing, _ := current.Data()["organizationId"].(string); existing != "" {
+				return nil
+			}
+			changed = true
+			return tx.Update(doc.Ref, []firestore.Update{{Path: "organizationId", Value: orgID}})
+		})
+		if status.Code(err) == codes.NotFound {
+			return false, nil // Deleted since the batch was read
+		}
+		if err != nil || !changed {
+			return false, err
+		}
+		log.Printf("MIGRATIONS: form %s assigned to organization %s", doc.Ref.ID, orgID)
+		return true, services.InvalidateFormCache(ctx, env.Redis, orgID, doc.Ref.ID)
+	},
+}
+
+// formOwner infers the organization of a form without one. Responses and share links
+// record the organization the form was actually used under; otherwise the creator's UID
+// is their organization ID.
+func formOwner(ctx context.Context, client *firestore.Client, doc *firestore.DocumentSnapshot) (string, error) {
+	lookups := []struct {
+		collection, field string
+	}{{"form_responses", "form"}, {"share_links", "form_id"}}
+	for _, lookup := range lookups {
+		refs, err := client.Collection(lookup.collection).Where(lookup.field, "==", doc.Ref.ID).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return "", err
+		}
+		if len(refs) > 0 {
+			if orgID, _ := refs[0].Data()["organizationId"].(string); orgID != "" {
+				return orgID, nil
+			}
+		}
+	}
+	createdBy, _ := doc.Data()["createdBy"].(string)
+	return createdBy, nil
+}
+
+// formIDField removes the "_id" field that data.Form used to write. It was empty or a
+// stale copy of the document ID; readers always take the ID from the document reference.
+var formIDField = Migration{
+	ID:         2,
+	Name:       "form-id-field",
+	Collection: "forms",
+	Apply: func(ctx context.Context, env *Env, doc *firestore.DocumentSnapshot, dryRun bool) (bool, error) {
+		if _, ok := doc.Data()["_id"]; !ok {
+			return false, nil
+		}
+		if dryRun {
+			return true, nil
+		}
+		_, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "_id", Value: firestore.Delete}})
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return err == nil, err
+	},
+}
@@ -0,0 +1,267 @@
+// Package migrations applies numbered changes to the shape of Firestore documents.
+//
+// Each migration walks one collection in document ID order, in batches. After every batch
+// its progress is written to the _migrations collection, so an interrupted run resumes
+// where it stopped and a completed migration is never applied twice. Migrations must be
+// idempotent: the batch in flight when a run is interrupted is processed again.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	recordsCollection = "_migrations"
+	lockResource      = "migrations"
+	lockTTL           = 10 * time.Minute
+)
+
+// Migration states stored in data.MigrationRecord.Status
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusFailed    = "failed"
+	StatusCompleted = "completed"
+)
+
+// ErrLocked is returned by Run when another instance is applying migrations
+var ErrLocked = errors.New("migrations are being applied by another instance")
+
+// Env holds the clients a migration may use
+type Env struct {
+	Client    *firestore.Client
+	Redis     *redis.Client // nil when Redis is unavailable
+	Encryptor *services.FieldEncryptor
+}
+
+// Migration is one numbered change. Apply is called for every document of Collection and
+// reports whether the document needed the change; with dryRun set it must not write.
+type Migration struct {
+	ID         int
+	Name       string
+	Collection string
+	Apply      func(ctx context.Context, env *Env, doc *firestore.DocumentSnapshot, dryRun bool) (bool, error)
+}
+
+// All lists every migration in the order they apply. IDs are permanent: never renumber
+// or remove a migration once it has shipped.
+var All = []Migration{
+	formOrganizationID,
+	formIDField,
+	responseAnswersField,
+	webhookSecretSealed,
+}
+
+// Options controls a run
+type Options struct {
+	// DryRun reports what would change without writing documents or records
+	DryRun bool
+	// To stops after the migration with this ID; zero applies every pending migration
+	To int
+	// Progress, when set, is called after every batch
+	Progress func(data.MigrationRecord)
+}
+
+// Runner applies migrations and reports their state
+type Runner struct {
+	env        Env
+	migrations []Migration
+	batchSize  int
+}
+
+// NewRunner creates a runner for All. rdb may be nil, in which case runs are not guarded
+// by the distributed lock.
+func NewRunner(client *firestore.Client, rdb *redis.Client, encryptor *services.FieldEncryptor, batchSize int) *Runner {
+	if batchSize < 1 {
+		batchSize = 200
+	}
+	return &Runner{
+		env:        Env{Client: client, Redis: rdb, Encryptor: encryptor},
+		migrations: All,
+		batchSize:  batchSize,
+	}
+}
+
+// Status returns the recorded state of every migration, including pending ones
+func (r *Runner) Status(ctx context.Context) ([]data.MigrationRecord, error) {
+	records := make([]data.MigrationRecord, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		record, err := r.load(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Run applies pending migrations in order and returns the state of each one it visited.
+// It stops at the first failure; running again resumes from the failed migration's last
+// checkpoint.
+func (r *Runner) Run(ctx context.Context, opts Options) ([]data.MigrationRecord, error) {
+	var lock *services.DistributedLock
+	if !opts.DryRun {
+		if r.env.Redis != nil {
+			lock = services.NewDistributedLock(r.env.Redis, lockResource, lockTTL)
+			acquired, err := lock.Acquire(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !acquired {
+				return nil, ErrLocked
+			}
+			defer lock.Release(context.Background())
+		} else {
+			log.Printf("MIGRATIONS: Redis unavailable; applying without the distributed lock")
+		}
+	}
+
+	var records []data.MigrationRecord
+	for _, m := range r.migrations {
+		if opts.To > 0 && m.ID > opts.To {
+			break
+		}
+		record, err := r.apply(ctx, m, opts, lock)
+		records = append(records, record)
+		if err != nil {
+			return records, fmt.Errorf("migration %04d %s: %w", m.ID, m.Name, err)
+		}
+	}
+	return records, nil
+}
+
+// apply runs one migration from its checkpoint to the end of its collection
+func (r *Runner) apply(ctx context.Context, m Migration, opts Options, lock *services.DistributedLock) (data.MigrationRecord, error) {
+	record, err := r.load(ctx, m)
+	if err != nil || record.Status == StatusCompleted {
+		return record, err
+	}
+	record.DryRun = opts.DryRun
+
+	if !opts.DryRun {
+		now := time.Now().UTC()
+		if record.StartedAt == nil {
+			record.StartedAt = &now
+		}
+		record.Status = StatusRunning
+		record.LastError = ""
+		if err := r.save(ctx, m, &record); err != nil {
+			return record, err
+		}
+		log.Printf("MIGRATIONS: applying %04d %s", m.ID, m.Name)
+	}
+
+	extended := time.Now()
+	for {
+		query := r.env.Client.Collection(m.Collection).OrderBy(firestore.DocumentID, firestore.Asc).Limit(r.batchSize)
+		if record.Checkpoint != "" {
+			query = query.StartAfter(record.Checkpoint)
+		}
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			return r.fail(ctx, m, record, err)
+		}
+
+		// Counts are added once the whole batch succeeds, since a failed batch is redone
+		changed := 0
+		for _, doc := range docs {
+			ok, err := m.Apply(ctx, &r.env, doc, opts.DryRun)
+			if err != nil {
+				return r.fail(ctx, m, record, fmt.Errorf("document %s: %w", doc.Ref.ID, err))
+			}
+			if ok {
+				changed++
+			}
+		}
+		record.Scanned += len(docs)
+		record.Changed += changed
+		if len(docs) > 0 {
+			record.Checkpoint = docs[len(docs)-1].Ref.ID
+		}
+
+		done := len(docs) < r.batchSize
+		if done && !opts.DryRun {
+			now := time.Now().UTC()
+			record.Status = StatusCompleted
+			record.CompletedAt = &now
+		}
+		if !opts.DryRun {
+			if err := r.save(ctx, m, &record); err != nil {
+				return record, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(record)
+		}
+		if done {
+			if !opts.DryRun {
+				log.Printf("MIGRATIONS: %04d %s completed: %d scanned, %d changed", m.ID, m.Name, record.Scanned, record.Changed)
+			}
+			return record, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return r.fail(ctx, m, record, err)
+		}
+		if lock != nil && time.Since(extended) > lockTTL/2 {
+			if err := lock.Extend(ctx, lockTTL); err != nil {
+				return r.fail(ctx, m, record, err)
+			}
+			extended = time.Now()
+		}
+	}
+}
+
+// fail records the error so the next run resumes from the last checkpoint
+func (r *Runner) fail(ctx context.Context, m Migration, record data.MigrationRecord, cause error) (data.MigrationRecord, error) {
+	if record.DryRun {
+		return record, cause
+	}
+	record.Status = StatusFailed
+	record.LastError = cause.Error()
+	if err := r.save(context.WithoutCancel(ctx), m, &record); err != nil {
+		log.Printf("MIGRATIONS: failed to record failure of %04d %s: %v", m.ID, m.Name, err)
+	}
+	log.Printf("MIGRATIONS: %04d %s stopped at checkpoint %q: %v", m.ID, m.Name, record.Checkpoint, cause)
+	return record, cause
+}
+
+func (r *Runner) load(ctx context.Context, m Migration) (data.MigrationRecord, error) {
+	record := data.MigrationRecord{ID: m.ID, Name: m.Name, Status: StatusPending}
+	doc, err := r.env.Client.Collection(recordsCollection).Doc(recordID(m)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return record, nil
+	}
+	if err != nil {
+		return record, fmt.Errorf("failed to read migration record: %w", err)
+	}
+	if err := doc.DataTo(&record); err != nil {
+		return record, fmt.Errorf("failed to parse migration record: %w", err)
+	}
+	return record, nil
+}
+
+func (r *Runner) save(ctx context.Context, m Migration, record *data.MigrationRecord) error {
+	record.UpdatedAt = time.Now().UTC()
+	if _, err := r.env.Client.Collection(recordsCollection).Doc(recordID(m)).Set(ctx, record); err != nil {
+		return fmt.Errorf("failed to write migration record: %w", err)
+	}
+	return nil
+}
+
+// recordID names a migration's document in _migrations, e.g. "0001-form-organization-id"
+func recordID(m Migration) string {
+	return fmt.Sprintf("%04d-%s", m.ID, m.Name)
+}
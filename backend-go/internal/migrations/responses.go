@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// responseAnswersField moves answers stored under the legacy "data" field to
+// response_data and seals them. Readers only know response_data, so these responses
+// showed no answers and failed clinical summaries. Where the answers already exist under
+// response_data or encrypted_phi, the plaintext copy is dropped.
+var responseAnswersField = Migration{
+	ID:         3,
+	Name:       "response-answers-field",
+	Collection: "form_responses",
+	Apply: func(ctx context.Context, env *Env, doc *firestore.DocumentSnapshot, dryRun bool) (bool, error) {
+		legacy, ok := doc.Data()["data"]
+		if !ok {
+			return false, nil
+		}
+		if _, isMap := legacy.(map[string]interface{}); !isMap {
+			log.Printf("MIGRATIONS: response %s has a data field that is not a set of answers; left unchanged", doc.Ref.ID)
+			return false, nil
+		}
+		if dryRun {
+			return true, nil
+		}
+
+		changed := false
+		err := env.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			fields := current.Data()
+			legacy, ok := fields["data"].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			updates := []firestore.Update{{Path: "data", Value: firestore.Delete}}
+			_, sealed := fields["encrypted_phi"]
+			_, plain := fields["response_data"]
+			if !sealed && !plain {
+				updates = append(updates, firestore.Update{Path: "response_data", Value: legacy})
+			}
+			changed = true
+			return tx.Update(doc.Ref, updates)
+		})
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		if err != nil || !changed {
+			return false, err
+		}
+
+		// Seal the moved answers and derive patient_name from them
+		if _, err := env.Encryptor.ReindexResponse(ctx, doc.Ref); err != nil {
+			return true, err
+		}
+		return true, nil
+	},
+}
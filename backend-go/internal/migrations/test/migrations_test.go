@@ -0,0 +1,233 @@
+package migrations_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/dev"
+	"backend-go/internal/migrations"
+	"backend-go/internal/services"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+)
+
+type fixture struct {
+	client    *firestore.Client
+	rdb       *redis.Client
+	encryptor *services.FieldEncryptor
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	store, err := dev.StartFirestore("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start firestore: %v", err)
+	}
+	t.Cleanup(store.Stop)
+	client, err := dev.DialFirestore(ctx, store.Addr(), "test-project")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	server, err := dev.StartRedis("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start redis: %v", err)
+	}
+	t.Cleanup(server.Close)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	provider, err := services.NewLocalKeyProvider(filepath.Join(t.TempDir(), "kek.json"), true)
+	if err != nil {
+		t.Fatalf("key provider: %v", err)
+	}
+	return &fixture{client: client, rdb: rdb, encryptor: services.NewFieldEncryptor(client, provider)}
+}
+
+func (f *fixture) put(t *testing.T, collection, id string, fields map[string]interface{}) {
+	t.Helper()
+	if _, err := f.client.Collection(collection).Doc(id).Set(context.Background(), fields); err != nil {
+		t.Fatalf("put %s/%s: %v", collection, id, err)
+	}
+}
+
+func (f *fixture) get(t *testing.T, collection, id string) map[string]interface{} {
+	t.Helper()
+	doc, err := f.client.Collection(collection).Doc(id).Get(context.Background())
+	if err != nil {
+		t.Fatalf("get %s/%s: %v", collection, id, err)
+	}
+	return doc.Data()
+}
+
+func (f *fixture) seedLegacy(t *testing.T) {
+	f.put(t, "forms", "f-created", map[string]interface{}{"title": "Intake", "createdBy": "user-1", "_id": ""})
+	f.put(t, "forms", "f-shared", map[string]interface{}{"title": "History", "createdBy": "user-1"})
+	f.put(t, "share_links", "l-1", map[string]interface{}{"form_id": "f-shared", "organizationId": "org-2"})
+	f.put(t, "forms", "f-current", map[string]interface{}{"title": "Consent", "organizationId": "org-1"})
+	f.put(t, "forms", "f-orphan", map[string]interface{}{"title": "Unknown"})
+	f.put(t, "form_responses", "r-legacy", map[string]interface{}{
+		"organizationId": "org-1",
+		"form":           "f-current",
+		"data":           map[string]interface{}{"first_name": "Ada", "last_name": "Lovelace"},
+	})
+	f.put(t, "webhook_subscriptions", "w-legacy", map[string]interface{}{
+		"organizationId": "org-1",
+		"url":            "https://hooks.example.org/forms",
+		"secret":         "whsec_legacy",
+		"is_active":      true,
+	})
+}
+
+func TestLegacyShapesAreNormalized(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.seedLegacy(t)
+
+	runner := migrations.NewRunner(f.client, f.rdb, f.encryptor, 2)
+	records, err := runner.Run(ctx, migrations.Options{})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	changed := map[string]int{}
+	for _, record := range records {
+		if record.Status != migrations.StatusCompleted {
+			t.Fatalf("%s: status %s", record.Name, record.Status)
+		}
+		changed[record.Name] = record.Changed
+	}
+	want := map[string]int{"form-organization-id": 2, "form-id-field": 1, "response-answers-field": 1, "webhook-secret-sealed": 1}
+	for name, n := range want {
+		if changed[name] != n {
+			t.Errorf("%s changed %d documents, want %d", name, changed[name], n)
+		}
+	}
+
+	for id, org := range map[string]string{"f-created": "user-1", "f-shared": "org-2", "f-current": "org-1", "f-orphan": ""} {
+		fields := f.get(t, "forms", id)
+		if got, _ := fields["organizationId"].(string); got != org {
+			t.Errorf("form %s: organizationId %q, want %q", id, got, org)
+		}
+		if _, ok := fields["_id"]; ok {
+			t.Errorf("form %s still has an _id field", id)
+		}
+	}
+
+	fields := f.get(t, "form_responses", "r-legacy")
+	for _, field := range []string{"data", "response_data", "patient_name"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("response still has plaintext field %s", field)
+		}
+	}
+	doc, err := f.client.Collection("form_responses").Doc("r-legacy").Get(ctx)
+	if err != nil {
+		t.Fatalf("get response: %v", err)
+	}
+	response, err := f.encryptor.OpenResponse(ctx, doc)
+	if err != nil {
+		t.Fatalf("open response: %v", err)
+	}
+	if response.Data["first_name"] != "Ada" || response.PatientName != "Ada Lovelace" {
+		t.Errorf("opened response: answers %v, patient %q", response.Data, response.PatientName)
+	}
+
+	fields = f.get(t, "webhook_subscriptions", "w-legacy")
+	if _, ok := fields["secret"]; ok {
+		t.Errorf("webhook subscription still has a plaintext secret")
+	}
+	sealedSecret, _ := fields["sealed_secret"].(string)
+	secret, err := f.encryptor.Open(ctx, "org-1", "webhook_subscriptions/w-legacy/secret", sealedSecret)
+	if err != nil || string(secret) != "whsec_legacy" {
+		t.Errorf("sealed webhook secret: %q, %v", secret, err)
+	}
+
+	// Completed migrations are not applied again
+	f.put(t, "forms", "f-late", map[string]interface{}{"title": "Late", "createdBy": "user-3"})
+	if _, err := runner.Run(ctx, migrations.Options{}); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if _, ok := f.get(t, "forms", "f-late")["organizationId"]; ok {
+		t.Errorf("completed migration ran again")
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	f.seedLegacy(t)
+
+	records, err := migrations.NewRunner(f.client, nil, f.encryptor, 10).Run(ctx, migrations.Options{DryRun: true, To: 2})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(records) != 2 || records[0].Changed != 2 || records[1].Changed != 1 {
+		t.Fatalf("dry run records: %+v", records)
+	}
+	if _, ok := f.get(t, "forms", "f-created")["organizationId"]; ok {
+		t.Errorf("dry run assigned an organization")
+	}
+	stored, err := f.client.Collection("_migrations").Documents(ctx).GetAll()
+	if err != nil || len(stored) != 0 {
+		t.Errorf("dry run wrote %d migration records (%v)", len(stored), err)
+	}
+}
+
+func TestInterruptedRunResumesFromCheckpoint(t *testing.T) {
+	f := newFixture(t)
+	for i := 1; i <= 5; i++ {
+		f.put(t, "forms", fmt.Sprintf("f%d", i), map[string]interface{}{"title": "Legacy", "createdBy": "user-1"})
+	}
+	runner := migrations.NewRunner(f.client, f.rdb, f.encryptor, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := runner.Run(ctx, migrations.Options{Progress: func(data.MigrationRecord) { cancel() }})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run: got %v, want context.Canceled", err)
+	}
+	status, err := runner.Status(context.Background())
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	first := status[0]
+	if first.Status != migrations.StatusFailed || first.Checkpoint != "f2" || first.Changed != 2 {
+		t.Fatalf("after interruption: %+v", first)
+	}
+	if _, ok := f.get(t, "forms", "f3")["organizationId"]; ok {
+		t.Fatalf("form past the checkpoint was migrated")
+	}
+
+	records, err := runner.Run(context.Background(), migrations.Options{To: 1})
+	if err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if records[0].Status != migrations.StatusCompleted || records[0].Scanned != 5 || records[0].Changed != 5 {
+		t.Fatalf("after resume: %+v", records[0])
+	}
+}
+
+func TestRunHoldsTheLock(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+
+	other := services.NewDistributedLock(f.rdb, "migrations", time.Minute)
+	if acquired, err := other.Acquire(ctx); err != nil || !acquired {
+		t.Fatalf("acquire: %v, %v", acquired, err)
+	}
+	if _, err := migrations.NewRunner(f.client, f.rdb, f.encryptor, 10).Run(ctx, migrations.Options{}); !errors.Is(err, migrations.ErrLocked) {
+		t.Fatalf("got %v, want ErrLocked", err)
+	}
+
+	other.Release(ctx)
+	if _, err := migrations.NewRunner(f.client, f.rdb, f.encryptor, 10).Run(ctx, migrations.Options{}); err != nil {
+		t.Fatalf("run after release: %v", err)
+	}
+}
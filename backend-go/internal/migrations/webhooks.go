@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// webhookSecretSealed encrypts webhook signing secrets that were stored in plaintext,
+// so anyone who could read the subscription could forge deliveries
+var webhookSecretSealed = Migration{
+	ID:         4,
+	Name:       "webhook-secret-sealed",
+	Collection: "webhook_subscriptions",
+	Apply: func(ctx context.Context, env *Env, doc *firestore.DocumentSnapshot, dryRun bool) (bool, error) {
+		if secret, _ := doc.Data()["secret"].(string); secret == "" {
+			return false, nil
+		}
+		orgID, _ := doc.Data()["organizationId"].(string)
+		if orgID == "" {
+			log.Printf("MIGRATIONS: webhook subscription %s has no organization to encrypt its secret for; left unchanged", doc.Ref.ID)
+			return false, nil
+		}
+		if dryRun {
+			return true, nil
+		}
+
+		changed := false
+		err := env.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			changed = false
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			secret, _ := current.Data()["secret"].(string)
+			if secret == "" {
+				return nil
+			}
+			updates := []firestore.Update{{Path: "secret", Value: firestore.Delete}}
+			// A subscription re-created since the batch was read may already be sealed
+			if _, sealed := current.Data()["sealed_secret"]; !sealed {
+				sealedSecret, err := env.Encryptor.SealWebhookSecret(ctx, orgID, doc.Ref.ID, secret)
+				if err != nil {
+					return err
+				}
+				updates = append(updates, firestore.Update{Path: "sealed_secret", Value: sealedSecret})
+			}
+			changed = true
+			return tx.Update(doc.Ref, updates)
+		})
+		if status.Code(err) == codes.NotFound {
+			return false, nil
+		}
+		return changed, err
+	},
+}
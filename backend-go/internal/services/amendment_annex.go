@@ -0,0 +1,69 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// renderAmendmentAnnex lists every amendment of a response after the form content: the
+// original and new value of each changed answer, why it changed, and who approved it.
+// The form sections above it already show the current values.
+func renderAmendmentAnnex(context *PDFContext, surveyJson map[string]interface{}) string {
+	if len(context.Amendments) == 0 {
+		return ""
+	}
+
+	titles := map[string]map[string]interface{}{}
+	for _, element := range extractElements(surveyJson) {
+		if name, _ := element["name"].(string); name != "" {
+			titles[name] = element
+		}
+	}
+	renderer := &GenericFieldRenderer{}
+	formatValue := func(element map[string]interface{}, value interface{}) string {
+		if value == nil {
+			return `<span class="empty-answer" style="color: #999; font-style: italic;">No answer</span>`
+		}
+		if s, ok := value.(string); ok && (IsAttachmentRef(s) || strings.HasPrefix(s, "data:")) {
+			return `<span class="generic-answer">Uploaded file</span>`
+		}
+		return renderer.formatAnswer(value, renderer.detectQuestionType(element), element)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<div class="form-section page-break amendment-annex">`)
+	b.WriteString(`<div class="section-title">Amended</div>`)
+	b.WriteString(`<p style="margin-bottom: 10px;">This response was amended after it was submitted. The answers above show the current values; the original values are listed below.</p>`)
+	for _, revision := range context.Amendments {
+		b.WriteString(`<div style="margin-bottom: 14px; page-break-inside: avoid;">`)
+		fmt.Fprintf(&b, `<div style="font-weight: bold; margin-bottom: 4px;">Amendment %d &mdash; %s</div>`,
+			revision.Revision, html.EscapeString(FormatDateTimeUSA(revision.CreatedAt)))
+		fmt.Fprintf(&b, `<div>Reason: %s</div>`, html.EscapeString(revision.Reason))
+		if revision.RequestedBy != "" {
+			fmt.Fprintf(&b, `<div>Requested by: %s</div>`, html.EscapeString(revision.RequestedBy))
+		}
+		fmt.Fprintf(&b, `<div>Entered by: %s &nbsp;|&nbsp; Approved by: %s</div>`,
+			html.EscapeString(revision.AuthorID), html.EscapeString(revision.ApprovedBy))
+
+		// Later amendments replace values that an earlier amendment already changed
+		previous := "Original value"
+		if revision.Revision > 1 {
+			previous = "Previous value"
+		}
+		fmt.Fprintf(&b, `<table class="data-table"><thead><tr><th style="width: 30%%;">Question</th><th>%s</th><th>New value</th></tr></thead><tbody>`, previous)
+		for _, change := range revision.Changes {
+			element := titles[change.Field]
+			if element == nil {
+				element = map[string]interface{}{"name": change.Field}
+			}
+			fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td></tr>`,
+				renderer.getElementTitle(element, change.Field),
+				formatValue(element, change.OldValue),
+				formatValue(element, change.NewValue))
+		}
+		b.WriteString(`</tbody></table></div>`)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AttachmentRefPrefix marks an answer value that points to a stored attachment
+const AttachmentRefPrefix = "attachment:"
+
+const maxAttachmentBytes = 10 << 20
+
+// ErrInvalidAttachment is returned when a submitted data URI cannot be stored
+var ErrInvalidAttachment = errors.New("invalid attachment")
+
+// ErrAttachmentNotFound is returned for unknown attachments or ones owned by another organization
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentService moves base64 data URIs out of response_data into the blob store.
+// Blobs are sealed with the organization's data key.
+type AttachmentService struct {
+	client    *firestore.Client
+	store     BlobStore
+	sanitizer *UploadSanitizer
+	encryptor *FieldEncryptor
+}
+
+// AttachmentRejection is a file answer that was left out because it failed validation
+type AttachmentRejection struct {
+	Field  string `json:"field" firestore:"field"`
+	Reason string `json:"reason" firestore:"reason"`
+}
+
+// extraction collects what ExtractDataURIs stored and rejected
+type extraction struct {
+	records  []data.Attachment
+	rejected []AttachmentRejection
+}
+
+// AttachmentOwner identifies the response and submitter that attachments belong to
+type AttachmentOwner struct {
+	OrganizationID string
+	FormID         string
+	ResponseID     string
+	UserID         string
+	IPAddress      string
+}
+
+// NewAttachmentService creates a new attachment service
+func NewAttachmentService(client *firestore.Client, store BlobStore, sanitizer *UploadSanitizer, encryptor *FieldEncryptor) *AttachmentService {
+	return &AttachmentService{client: client, store: store, sanitizer: sanitizer, encryptor: encryptor}
+}
+
+// IsAttachmentRef reports whether an answer value is an attachment reference
+func IsAttachmentRef(value string) bool {
+	return strings.HasPrefix(value, AttachmentRefPrefix)
+}
+
+// AttachmentRefID returns the attachment ID from a reference
+func AttachmentRefID(ref string) string {
+	return strings.TrimPrefix(ref, AttachmentRefPrefix)
+}
+
+// ExtractDataURIs uploads every base64 data URI in answers to the blob store and replaces it
+// in place with an attachment reference. The returned records are not yet saved; callers
+// write them with SaveRecords in the same transaction as the response, and call Discard
+// when that transaction fails.
+//
+// A file that fails validation, such as an unsupported photo format, is replaced with null
+// and reported in rejected rather than failing the call, so one unreadable photo doesn't
+// lose the rest of a patient's answers.
+func (s *AttachmentService) ExtractDataURIs(ctx context.Context, owner AttachmentOwner, answers map[string]interface{}) ([]data.Attachment, []AttachmentRejection, error) {
+	result := &extraction{}
+	for key, value := range answers {
+		replaced, err := s.extractValue(ctx, owner, key, value, result)
+		if err != nil {
+			s.Discard(ctx, result.records)
+			return nil, nil, fmt.Errorf("field %s: %w", key, err)
+		}
+		answers[key] = replaced
+	}
+	return result.records, result.rejected, nil
+}
+
+func (s *AttachmentService) extractValue(ctx context.Context, owner AttachmentOwner, field string, value interface{}, result *extraction) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, "data:") || !strings.Contains(v, ";base64,") {
+			return v, nil
+		}
+		record, err := s.storeDataURI(ctx, owner, field, v)
+		if errors.Is(err, ErrInvalidAttachment) {
+			result.rejected = append(result.rejected, AttachmentRejection{Field: field, Reason: err.Error()})
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.records = append(result.records, record)
+		return AttachmentRefPrefix + record.ID, nil
+	case map[string]interface{}:
+		for key, nested := range v {
+			replaced, err := s.extractValue(ctx, owner, field, nested, result)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = replaced
+		}
+		return v, nil
+	case []interface{}:
+		for i, nested := range v {
+			replaced, err := s.extractValue(ctx, owner, field, nested, result)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = replaced
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// storeDataURI decodes and sanitizes one data URI, then writes it to the blob store
+func (s *AttachmentService) storeDataURI(ctx context.Context, owner AttachmentOwner, field, uri string) (data.Attachment, error) {
+	header, payload, _ := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	declaredType, _, _ := strings.Cut(header, ";")
+
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return data.Attachment{}, fmt.Errorf("%w: invalid base64 data", ErrInvalidAttachment)
+	}
+	if len(decoded) > maxAttachmentBytes {
+		return data.Attachment{}, fmt.Errorf("%w: exceeds %d bytes", ErrInvalidAttachment, maxAttachmentBytes)
+	}
+
+	clean, report, err := s.sanitizer.Sanitize(ctx, Upload{
+		Data:           decoded,
+		DeclaredType:   declaredType,
+		Allowed:        AttachmentUploadTypes,
+		Source:         "response_attachment",
+		UserID:         owner.UserID,
+		OrganizationID: owner.OrganizationID,
+		IPAddress:      owner.IPAddress,
+	})
+	if err != nil {
+		return data.Attachment{}, fmt.Errorf("%w: %v", ErrInvalidAttachment, err)
+	}
+
+	contentType := report.DetectedType
+	if report.ConvertedTo != "" {
+		contentType = report.ConvertedTo
+	}
+	record := data.Attachment{
+		ID:             s.client.Collection("attachments").NewDoc().ID,
+		OrganizationID: owner.OrganizationID,
+		FormID:         owner.FormID,
+		ResponseID:     owner.ResponseID,
+		FieldName:      field,
+		ContentType:    contentType,
+		Sanitization:   report,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := writeAttachmentBlob(ctx, s.store, s.encryptor, &record, clean); err != nil {
+		return data.Attachment{}, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return record, nil
+}
+
+// writeAttachmentBlob seals content with the organization's data key and stores it, filling
+// in the record's size, hash and storage key. Identical files within an organization share
+// one blob; its key is a blind index of the file's hash, so the hash of a known document
+// can't be matched against bucket listings.
+func writeAttachmentBlob(ctx context.Context, store BlobStore, encryptor *FieldEncryptor, record *data.Attachment, content []byte) error {
+	sum := sha256.Sum256(content)
+	record.SHA256 = hex.EncodeToString(sum[:])
+	record.Size = int64(len(content))
+
+	index, err := encryptor.BlindIndex(ctx, record.OrganizationID, "attachment:"+record.SHA256)
+	if err != nil {
+		return err
+	}
+	record.StorageKey = fmt.Sprintf("%s/%s", record.OrganizationID, index)
+	sealed, err := encryptor.SealBlob(ctx, record.OrganizationID, attachmentBlobAAD(record.StorageKey), content)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, record.StorageKey, "application/octet-stream", sealed); err != nil {
+		return err
+	}
+	record.Encrypted = true
+	return nil
+}
+
+// readAttachmentBlob returns an attachment's bytes, decrypting sealed blobs
+func readAttachmentBlob(ctx context.Context, store BlobStore, encryptor *FieldEncryptor, record *data.Attachment) ([]byte, error) {
+	content, err := store.Get(ctx, record.StorageKey)
+	if err != nil || !record.Encrypted {
+		return content, err
+	}
+	return encryptor.OpenBlob(ctx, record.OrganizationID, attachmentBlobAAD(record.StorageKey), content)
+}
+
+// attachmentBlobAAD binds a sealed blob to its storage key
+func attachmentBlobAAD(storageKey string) string {
+	return "attachments/" + storageKey
+}
+
+// Discard releases the blobs of records whose transaction failed. Blobs that a saved
+// attachment also points at are kept.
+func (s *AttachmentService) Discard(ctx context.Context, records []data.Attachment) {
+	ctx = context.WithoutCancel(ctx)
+	for _, record := range records {
+		if err := s.ReleaseBlob(ctx, record.StorageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			log.Printf("ATTACHMENTS: failed to release blob of discarded attachment %s: %v", record.ID, err)
+		}
+	}
+}
+
+// SaveRecords writes attachment records inside a transaction
+func (s *AttachmentService) SaveRecords(tx *firestore.Transaction, records []data.Attachment) error {
+	for _, record := range records {
+		if err := tx.Create(s.client.Collection("attachments").Doc(record.ID), record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open loads an attachment record and its bytes, enforcing organization ownership
+func (s *AttachmentService) Open(ctx context.Context, orgID, attachmentID string) (*data.Attachment, []byte, error) {
+	doc, err := s.client.Collection("attachments").Doc(attachmentID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		return nil, nil, err
+	}
+
+	var record data.Attachment
+	if err := doc.DataTo(&record); err != nil {
+		return nil, nil, err
+	}
+	if record.OrganizationID != orgID {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	record.ID = doc.Ref.ID
+
+	// An attachment is hidden along with its response while the response is in the trash
+	owner, err := s.client.Collection("form_responses").Doc(record.ResponseID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, deleted := owner.Data()["deleted_at"]; deleted {
+		return nil, nil, ErrAttachmentNotFound
+	}
+
+	content, err := readAttachmentBlob(ctx, s.store, s.encryptor, &record)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &record, content, nil
+}
+
+// ForResponse lists the attachment records stored for a response
+func (s *AttachmentService) ForResponse(ctx context.Context, responseID string) ([]data.Attachment, error) {
+	docs, err := s.client.Collection("attachments").Where("response_id", "==", responseID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]data.Attachment, 0, len(docs))
+	for _, doc := range docs {
+		var record data.Attachment
+		if err := doc.DataTo(&record); err != nil {
+			return nil, err
+		}
+		record.ID = doc.Ref.ID
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// DeleteRecords removes attachment records inside a transaction. The blobs are left for
+// ReleaseBlob, which runs after the transaction commits.
+func (s *AttachmentService) DeleteRecords(tx *firestore.Transaction, records []data.Attachment) error {
+	for _, record := range records {
+		if err := tx.Delete(s.client.Collection("attachments").Doc(record.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseBlob deletes a blob once no attachment record points at it. Blobs are content
+// addressed, so identical uploads within an organization share one.
+func (s *AttachmentService) ReleaseBlob(ctx context.Context, storageKey string) error {
+	docs, err := s.client.Collection("attachments").Where("storage_key", "==", storageKey).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	if len(docs) > 0 {
+		return nil
+	}
+	return s.store.Delete(ctx, storageKey)
+}
+
+// Resolver returns an AttachmentResolver bound to one organization, for use while rendering
+func (s *AttachmentService) Resolver(ctx context.Context, orgID string) AttachmentResolver {
+	if s == nil {
+		return nil
+	}
+	return func(ref string) (string, error) {
+		record, content, err := s.Open(ctx, orgID, AttachmentRefID(ref))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("data:%s;base64,%s", record.ContentType, base64.StdEncoding.EncodeToString(content)), nil
+	}
+}
+
+// AttachmentResolver turns an attachment reference into a data URI
+type AttachmentResolver func(ref string) (string, error)
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	auditLogCollection    = "audit_log"
+	auditChainsCollection = "audit_chains"
+)
+
+// FirestoreAuditSink stores audit records in the audit_log collection and keeps the last
+// record of each chain in audit_chains
+type FirestoreAuditSink struct {
+	client *firestore.Client
+}
+
+// NewFirestoreAuditSink creates a new Firestore audit sink
+func NewFirestoreAuditSink(client *firestore.Client) *FirestoreAuditSink {
+	return &FirestoreAuditSink{client: client}
+}
+
+func (s *FirestoreAuditSink) Name() string {
+	return "firestore"
+}
+
+// Write stores a batch of records together with the chain head. Records use
+// "<chain>_<sequence>" document IDs so a retried batch cannot duplicate them.
+func (s *FirestoreAuditSink) Write(ctx context.Context, records []AuditRecord) error {
+	for start := 0; start < len(records); start += 400 {
+		end := start + 400
+		if end > len(records) {
+			end = len(records)
+		}
+
+		batch := s.client.Batch()
+		for _, record := range records[start:end] {
+			batch.Set(s.client.Collection(auditLogCollection).Doc(auditRecordID(record)), record)
+		}
+		tail := records[end-1]
+		batch.Set(s.client.Collection(auditChainsCollection).Doc(tail.ChainID), tail)
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreAuditSink) Close() error {
+	return nil
+}
+
+func auditRecordID(record AuditRecord) string {
+	return fmt.Sprintf("%s_%012d", record.ChainID, record.Sequence)
+}
+
+// Query returns matching records, newest first
+func (s *FirestoreAuditSink) Query(ctx context.Context, query AuditQuery) ([]AuditRecord, error) {
+	q := s.client.Collection(auditLogCollection).Query
+	if query.OrganizationID != "" {
+		q = q.Where("organization_id", "==", query.OrganizationID)
+	}
+	if query.UserID != "" {
+		q = q.Where("user_id", "==", query.UserID)
+	}
+	if query.ResourceType != "" {
+		q = q.Where("resource_type", "==", query.ResourceType)
+	}
+	if query.ResourceID != "" {
+		q = q.Where("resource_id", "==", query.ResourceID)
+	}
+	if query.RequestID != "" {
+		q = q.Where("request_id", "==", query.RequestID)
+	}
+	if !query.From.IsZero() {
+		q = q.Where("timestamp", ">=", query.From)
+	}
+	if !query.To.IsZero() {
+		q = q.Where("timestamp", "<=", query.To)
+	}
+	q = q.OrderBy("timestamp", firestore.Desc)
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+	return s.collect(q.Documents(ctx))
+}
+
+// Range returns the records appended between from and to
+func (s *FirestoreAuditSink) Range(ctx context.Context, from, to time.Time) ([]AuditRecord, error) {
+	q := s.client.Collection(auditLogCollection).
+		Where("recorded_at", ">=", from).
+		Where("recorded_at", "<=", to).
+		OrderBy("recorded_at", firestore.Asc)
+	return s.collect(q.Documents(ctx))
+}
+
+// ChainHeads returns the last record written to each chain
+func (s *FirestoreAuditSink) ChainHeads(ctx context.Context) (map[string]AuditRecord, error) {
+	records, err := s.collect(s.client.Collection(auditChainsCollection).Documents(ctx))
+	if err != nil {
+		return nil, err
+	}
+	heads := make(map[string]AuditRecord, len(records))
+	for _, record := range records {
+		heads[record.ChainID] = record
+	}
+	return heads, nil
+}
+
+func (s *FirestoreAuditSink) collect(iter *firestore.DocumentIterator) ([]AuditRecord, error) {
+	defer iter.Stop()
+	records := []AuditRecord{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record AuditRecord
+		if err := doc.DataTo(&record); err != nil {
+			return nil, fmt.Errorf("audit record %s: %w", doc.Ref.ID, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// FileAuditSink appends records as JSON lines to a local file. It is meant for development
+// and as the fallback when no other sink is available.
+type FileAuditSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditSink opens (or creates) an append-only audit file
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &FileAuditSink{path: path, file: file}, nil
+}
+
+func (s *FileAuditSink) Name() string {
+	return "file"
+}
+
+// Write appends the records and syncs the file
+func (s *FileAuditSink) Write(ctx context.Context, records []AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Query scans the file for matching records, newest first
+func (s *FileAuditSink) Query(ctx context.Context, query AuditQuery) ([]AuditRecord, error) {
+	records, err := s.scan(func(record *AuditRecord) bool {
+		return (query.OrganizationID == "" || record.OrganizationID == query.OrganizationID) &&
+			(query.UserID == "" || record.UserID == query.UserID) &&
+			(query.ResourceType == "" || record.ResourceType == query.ResourceType) &&
+			(query.ResourceID == "" || record.ResourceID == query.ResourceID) &&
+			(query.RequestID == "" || record.RequestID == query.RequestID) &&
+			(query.From.IsZero() || !record.Timestamp.Before(query.From)) &&
+			(query.To.IsZero() || !record.Timestamp.After(query.To))
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.After(records[j].Timestamp)
+	})
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[:query.Limit]
+	}
+	return records, nil
+}
+
+// Range returns the records appended between from and to
+func (s *FileAuditSink) Range(ctx context.Context, from, to time.Time) ([]AuditRecord, error) {
+	return s.scan(func(record *AuditRecord) bool {
+		return !record.RecordedAt.Before(from) && !record.RecordedAt.After(to)
+	})
+}
+
+func (s *FileAuditSink) scan(match func(*AuditRecord) bool) ([]AuditRecord, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%w: %s line %d is not a valid record", ErrAuditChainBroken, s.path, line)
+		}
+		if match(&record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,513 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend-go/internal/config"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	auditQueueSize     = 10000
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+	// A failed write stops being reported once this long has passed without another
+	// failure, so an idle instance recovers without needing new entries to prove it
+	auditFailureWindow = time.Minute
+)
+
+// ErrAuditChainBroken is returned when audit records fail hash-chain verification
+var ErrAuditChainBroken = errors.New("audit chain verification failed")
+
+// ErrAuditNotQueryable is returned when no configured sink can be read back
+var ErrAuditNotQueryable = errors.New("no queryable audit sink configured")
+
+// AuditRecord is an AuditEntry as stored: numbered within its chain and linked to the
+// previous record by hash, so an edited or deleted record breaks the chain.
+type AuditRecord struct {
+	AuditEntry
+	ChainID    string    `json:"chain_id" firestore:"chain_id"`
+	Sequence   int64     `json:"sequence" firestore:"sequence"`
+	RecordedAt time.Time `json:"recorded_at" firestore:"recorded_at"`
+	PrevHash   string    `json:"prev_hash" firestore:"prev_hash"`
+	Hash       string    `json:"hash" firestore:"hash"`
+}
+
+// AuditSink stores audit records. Write receives records in chain order.
+type AuditSink interface {
+	Name() string
+	Write(ctx context.Context, records []AuditRecord) error
+	Close() error
+}
+
+// AuditQuerier is implemented by sinks that can read records back
+type AuditQuerier interface {
+	Query(ctx context.Context, query AuditQuery) ([]AuditRecord, error)
+	// Range returns every record appended between from and to, ordered by chain and sequence
+	Range(ctx context.Context, from, to time.Time) ([]AuditRecord, error)
+}
+
+// AuditChainHeads is implemented by sinks that track the last record of each chain, which
+// lets verification detect records truncated from the end of a chain
+type AuditChainHeads interface {
+	ChainHeads(ctx context.Context) (map[string]AuditRecord, error)
+}
+
+// AuditQuery filters audit records. Zero values match everything.
+type AuditQuery struct {
+	OrganizationID string
+	UserID         string
+	ResourceType   string
+	ResourceID     string
+	RequestID      string
+	From           time.Time
+	To             time.Time
+	Limit          int
+}
+
+// AuditVerification is the outcome of checking the chain over a time range
+type AuditVerification struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Records  int       `json:"records"`
+	Chains   int       `json:"chains"`
+	Valid    bool      `json:"valid"`
+	Problems []string  `json:"problems,omitempty"`
+}
+
+type auditItem struct {
+	entry AuditEntry
+	ack   chan error
+}
+
+// AuditTrail is the application's audit log. Entries are queued in memory so the request
+// path never waits on a sink; a single writer goroutine numbers and hash-chains them and
+// fans each batch out to every sink. Each process writes its own chain, so instances never
+// coordinate to append.
+type AuditTrail struct {
+	sinks   []AuditSink
+	querier AuditQuerier
+	queue   chan auditItem
+
+	chainID  string
+	sequence int64
+	prevHash string
+	dropped  atomic.Int64
+
+	// Outcome of the most recent flush, for health checks
+	statusMu     sync.Mutex
+	lastWrite    time.Time
+	lastWriteErr error
+	lastFailure  time.Time
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewAuditTrail starts an audit trail writing to the given sinks. The first sink that
+// implements AuditQuerier serves queries and verification.
+func NewAuditTrail(sinks ...AuditSink) *AuditTrail {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	host, _ := os.Hostname()
+
+	t := &AuditTrail{
+		sinks:   sinks,
+		queue:   make(chan auditItem, auditQueueSize),
+		chainID: fmt.Sprintf("%s-%d-%s", host, time.Now().Unix(), hex.EncodeToString(suffix)),
+		done:    make(chan struct{}),
+	}
+	for _, sink := range sinks {
+		if querier, ok := sink.(AuditQuerier); ok {
+			t.querier = querier
+			break
+		}
+	}
+	go t.run()
+	return t
+}
+
+// NewAuditTrailFromConfig builds the configured sinks (cloud, firestore, file). A sink that
+// cannot be created is skipped with a warning; if none can be, entries go to the local file
+// so auditing is never disabled.
+func NewAuditTrailFromConfig(projectID string, client *firestore.Client, cfg config.AuditConfig) (*AuditTrail, error) {
+	var sinks []AuditSink
+	for _, name := range cfg.Sinks {
+		switch strings.TrimSpace(name) {
+		case "cloud":
+			sink, err := NewCloudAuditLogger(projectID)
+			if err != nil {
+				log.Printf("WARNING: Cloud Logging audit sink disabled: %v", err)
+				continue
+			}
+			sinks = append(sinks, sink)
+		case "firestore":
+			if client == nil {
+				log.Printf("WARNING: Firestore audit sink disabled: no Firestore client")
+				continue
+			}
+			sinks = append(sinks, NewFirestoreAuditSink(client))
+		case "file":
+			sink, err := NewFileAuditSink(cfg.LogFile)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+
+	if len(sinks) == 0 {
+		sink, err := NewFileAuditSink(cfg.LogFile)
+		if err != nil {
+			return nil, fmt.Errorf("no audit sink available: %w", err)
+		}
+		log.Printf("WARNING: no configured audit sink available, writing audit log to %s", sink.path)
+		sinks = append(sinks, sink)
+	}
+	return NewAuditTrail(sinks...), nil
+}
+
+// LogAccess queues an entry without blocking. When the queue is full the entry is counted
+// as dropped and the gap is itself recorded once the queue drains.
+func (t *AuditTrail) LogAccess(ctx context.Context, entry AuditEntry) {
+	if entry.RequestID == "" {
+		entry.RequestID = logging.RequestID(ctx)
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		log.Printf("AUDIT: entry logged after close: %s", entry.Action)
+		return
+	}
+	select {
+	case t.queue <- auditItem{entry: entry}:
+	default:
+		if t.dropped.Add(1) == 1 {
+			log.Printf("AUDIT: queue full, dropping entries")
+		}
+	}
+}
+
+// LogAccessSync queues an entry and waits until every sink has written it, so callers that
+// retry on failure (such as outbox subscribers) never lose an entry
+func (t *AuditTrail) LogAccessSync(ctx context.Context, entry AuditEntry) error {
+	if entry.RequestID == "" {
+		entry.RequestID = logging.RequestID(ctx)
+	}
+	item := auditItem{entry: entry, ack: make(chan error, 1)}
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return fmt.Errorf("audit trail is closed")
+	}
+	select {
+	case t.queue <- item:
+	case <-ctx.Done():
+		t.mu.RUnlock()
+		return ctx.Err()
+	}
+	t.mu.RUnlock()
+
+	select {
+	case err := <-item.ack:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes queued entries and closes every sink
+func (t *AuditTrail) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	<-t.done
+	var firstErr error
+	for _, sink := range t.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *AuditTrail) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]auditItem, 0, auditBatchSize)
+	for {
+		select {
+		case item, ok := <-t.queue:
+			if !ok {
+				t.flush(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) < auditBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		t.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush chains a batch and writes it to every sink
+func (t *AuditTrail) flush(batch []auditItem) {
+	if dropped := t.dropped.Swap(0); dropped > 0 {
+		batch = append([]auditItem{{entry: AuditEntry{
+			Timestamp:    time.Now().UTC(),
+			UserID:       "system",
+			Action:       "AUDIT_ENTRIES_DROPPED",
+			ResourceType: "audit",
+			ResourceID:   t.chainID,
+			Success:      false,
+			Metadata:     map[string]interface{}{"dropped": dropped},
+		}}}, batch...)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	records := make([]AuditRecord, len(batch))
+	for i, item := range batch {
+		records[i] = t.chain(item.entry)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var writeErr error
+	for _, sink := range t.sinks {
+		if err := sink.Write(ctx, records); err != nil {
+			log.Printf("AUDIT: %s sink failed to write %d records: %v", sink.Name(), len(records), err)
+			if writeErr == nil {
+				writeErr = fmt.Errorf("%s sink: %w", sink.Name(), err)
+			}
+		}
+	}
+	t.statusMu.Lock()
+	t.lastWrite = time.Now()
+	t.lastWriteErr = writeErr
+	if writeErr != nil {
+		t.lastFailure = t.lastWrite
+	}
+	t.statusMu.Unlock()
+
+	for _, item := range batch {
+		if item.ack != nil {
+			item.ack <- writeErr
+		}
+	}
+}
+
+// Health reports whether entries are being recorded: the trail must be open, its last
+// batch must have reached every sink (unless that failure is older than
+// auditFailureWindow) and its queue must not be close to dropping entries
+func (t *AuditTrail) Health(ctx context.Context) (map[string]interface{}, error) {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+
+	t.statusMu.Lock()
+	lastWrite, lastWriteErr, lastFailure := t.lastWrite, t.lastWriteErr, t.lastFailure
+	t.statusMu.Unlock()
+	if lastWriteErr != nil && time.Since(lastFailure) > auditFailureWindow {
+		lastWriteErr = nil
+	}
+
+	depth := len(t.queue)
+	details := map[string]interface{}{
+		"queue_depth":    depth,
+		"queue_capacity": auditQueueSize,
+		"sinks":          len(t.sinks),
+	}
+	if !lastWrite.IsZero() {
+		details["last_write"] = lastWrite.UTC()
+	}
+	if !lastFailure.IsZero() {
+		details["last_failure"] = lastFailure.UTC()
+	}
+
+	switch {
+	case closed:
+		return details, fmt.Errorf("audit trail is closed")
+	case lastWriteErr != nil:
+		return details, fmt.Errorf("last audit write failed: %w", lastWriteErr)
+	case depth >= auditQueueSize*9/10:
+		return details, fmt.Errorf("audit queue nearly full (%d/%d)", depth, auditQueueSize)
+	}
+	return details, nil
+}
+
+// chain assigns the next sequence number and hash to an entry
+func (t *AuditTrail) chain(entry AuditEntry) AuditRecord {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.OrganizationID == "" {
+		entry.OrganizationID, _ = entry.Metadata["organization_id"].(string)
+	}
+	entry.Metadata = normalizeAuditMetadata(entry.Metadata)
+
+	t.sequence++
+	record := AuditRecord{
+		AuditEntry: entry,
+		ChainID:    t.chainID,
+		Sequence:   t.sequence,
+		RecordedAt: time.Now(),
+		PrevHash:   t.prevHash,
+	}
+	normalizeAuditTimes(&record)
+	record.Hash = auditRecordHash(record)
+	t.prevHash = record.Hash
+	return record
+}
+
+// normalizeAuditMetadata round-trips metadata through JSON so the values hash the same
+// after being read back from any sink
+func normalizeAuditMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if len(metadata) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return map[string]interface{}{"unserializable": err.Error()}
+	}
+	var normalized map[string]interface{}
+	json.Unmarshal(raw, &normalized)
+	return normalized
+}
+
+// normalizeAuditTimes truncates to the microsecond precision Firestore keeps
+func normalizeAuditTimes(record *AuditRecord) {
+	record.Timestamp = record.Timestamp.UTC().Truncate(time.Microsecond)
+	record.RecordedAt = record.RecordedAt.UTC().Truncate(time.Microsecond)
+}
+
+func auditRecordHash(record AuditRecord) string {
+	record.Hash = ""
+	normalizeAuditTimes(&record)
+	if len(record.Metadata) == 0 {
+		record.Metadata = nil
+	}
+	raw, _ := json.Marshal(record)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Query returns records matching the filter, newest first
+func (t *AuditTrail) Query(ctx context.Context, query AuditQuery) ([]AuditRecord, error) {
+	if t.querier == nil {
+		return nil, ErrAuditNotQueryable
+	}
+	return t.querier.Query(ctx, query)
+}
+
+// Verify checks every chain with records appended between from and to: each record's hash
+// must match its contents, sequence numbers must be contiguous, and each record must link
+// to the previous one. The first record of each chain in the range is the anchor.
+func (t *AuditTrail) Verify(ctx context.Context, from, to time.Time) (*AuditVerification, error) {
+	if t.querier == nil {
+		return nil, ErrAuditNotQueryable
+	}
+	records, err := t.querier.Range(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var heads map[string]AuditRecord
+	if source, ok := t.querier.(AuditChainHeads); ok {
+		if heads, err = source.ChainHeads(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return VerifyAuditRecords(records, heads, from, to), nil
+}
+
+// VerifyAuditRecords checks records ordered by chain and sequence. heads, when known, is
+// used to detect records removed from the end of a chain.
+func VerifyAuditRecords(records []AuditRecord, heads map[string]AuditRecord, from, to time.Time) *AuditVerification {
+	result := &AuditVerification{From: from, To: to, Records: len(records), Valid: true}
+	problem := func(format string, args ...interface{}) {
+		result.Valid = false
+		if len(result.Problems) < 100 {
+			result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].ChainID != records[j].ChainID {
+			return records[i].ChainID < records[j].ChainID
+		}
+		return records[i].Sequence < records[j].Sequence
+	})
+
+	last := map[string]AuditRecord{}
+	for i, record := range records {
+		if auditRecordHash(record) != record.Hash {
+			problem("%s #%d: contents do not match hash", record.ChainID, record.Sequence)
+		}
+		if i > 0 && records[i-1].ChainID == record.ChainID {
+			prev := records[i-1]
+			if gap := record.Sequence - prev.Sequence - 1; gap == 1 {
+				problem("%s: record #%d is missing", record.ChainID, prev.Sequence+1)
+			} else if gap > 1 {
+				problem("%s: records #%d to #%d are missing", record.ChainID, prev.Sequence+1, record.Sequence-1)
+			} else if gap < 0 {
+				problem("%s #%d: sequence number repeats", record.ChainID, record.Sequence)
+			} else if record.PrevHash != prev.Hash {
+				problem("%s #%d: does not link to #%d", record.ChainID, record.Sequence, prev.Sequence)
+			}
+		} else {
+			result.Chains++
+			if record.Sequence == 1 && record.PrevHash != "" {
+				problem("%s #1: first record has a previous hash", record.ChainID)
+			}
+		}
+		last[record.ChainID] = record
+	}
+
+	// A head inside the range must be the last record we saw for its chain
+	for chainID, head := range heads {
+		if head.RecordedAt.Before(from) || head.RecordedAt.After(to) {
+			continue
+		}
+		tail, ok := last[chainID]
+		if !ok {
+			problem("%s: all records up to #%d are missing", chainID, head.Sequence)
+			continue
+		}
+		if tail.Sequence != head.Sequence || tail.Hash != head.Hash {
+			problem("%s: chain ends at #%d but head is #%d", chainID, tail.Sequence, head.Sequence)
+		}
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"backend-go/internal/config"
+
+	"cloud.google.com/go/storage"
+)
+
+// ErrBlobNotFound is returned when a blob key does not exist in the store
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores attachment bytes by key
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore selects the blob store from the config: store gcs uses the bucket, local
+// uses the directory on local disk.
+func NewBlobStore(ctx context.Context, cfg config.AttachmentsConfig) (BlobStore, error) {
+	switch cfg.Store {
+	case "gcs":
+		if cfg.Bucket == "" {
+			return nil, fmt.Errorf("ATTACHMENT_BUCKET is required when ATTACHMENT_STORE=gcs")
+		}
+		return NewGCSBlobStore(ctx, cfg.Bucket)
+	case "local":
+		return NewLocalBlobStore(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("unsupported ATTACHMENT_STORE: %s", cfg.Store)
+	}
+}
+
+// LocalBlobStore keeps blobs on the local filesystem, for development and single-node installs
+type LocalBlobStore struct {
+	root string
+}
+
+// NewLocalBlobStore creates a blob store rooted at dir
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+// path maps a key to a file under root, rejecting keys that escape it
+func (s *LocalBlobStore) path(key string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, s.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid blob key: %s", key)
+	}
+	return p, nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	// Write to a temp file first so readers never see a partial blob
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return data, err
+}
+
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// GCSBlobStore keeps blobs in a Cloud Storage bucket
+type GCSBlobStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// NewGCSBlobStore creates a blob store backed by the given bucket
+func NewGCSBlobStore(ctx context.Context, bucket string) (*GCSBlobStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &GCSBlobStore{client: client, bucket: bucket}, nil
+}
+
+func (s *GCSBlobStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	w := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *GCSBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.client.Bucket(s.bucket).Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (s *GCSBlobStore) Delete(ctx context.Context, key string) error {
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Close releases the storage client
+func (s *GCSBlobStore) Close() error {
+	return s.client.Close()
+}
@@ -2,27 +2,32 @@ package services
 
 import (
 	"context"
-	"cloud.google.com/go/logging"
 	"time"
+
+	"cloud.google.com/go/logging"
 )
 
+// CloudAuditLogger is the audit sink that writes to Google Cloud Logging
 type CloudAuditLogger struct {
 	client *logging.Client
 	logger *logging.Logger
 }
 
+// AuditEntry is one audited action. Callers fill it in; the AuditTrail adds the chain fields.
 type AuditEntry struct {
-	Timestamp    time.Time              `json:"timestamp"`
-	UserID       string                 `json:"user_id"`
-	UserEmail    string                 `json:"user_email,omitempty"`
-	Action       string                 `json:"action"`
-	ResourceType string                 `json:"resource_type"`
-	ResourceID   string                 `json:"resource_id"`
-	IPAddress    string                 `json:"ip_address"`
-	UserAgent    string                 `json:"user_agent"`
-	Success      bool                   `json:"success"`
-	ErrorMsg     string                 `json:"error,omitempty"`
-	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp      time.Time              `json:"timestamp" firestore:"timestamp"`
+	OrganizationID string                 `json:"organization_id,omitempty" firestore:"organization_id,omitempty"`
+	UserID         string                 `json:"user_id" firestore:"user_id"`
+	UserEmail      string                 `json:"user_email,omitempty" firestore:"user_email,omitempty"`
+	Action         string                 `json:"action" firestore:"action"`
+	ResourceType   string                 `json:"resource_type" firestore:"resource_type"`
+	ResourceID     string                 `json:"resource_id" firestore:"resource_id"`
+	IPAddress      string                 `json:"ip_address" firestore:"ip_address"`
+	UserAgent      string                 `json:"user_agent" firestore:"user_agent"`
+	RequestID      string                 `json:"request_id,omitempty" firestore:"request_id,omitempty"`
+	Success        bool                   `json:"success" firestore:"success"`
+	ErrorMsg       string                 `json:"error,omitempty" firestore:"error,omitempty"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty" firestore:"metadata,omitempty"`
 }
 
 func NewCloudAuditLogger(projectID string) (*CloudAuditLogger, error) {
@@ -31,34 +36,44 @@ func NewCloudAuditLogger(projectID string) (*CloudAuditLogger, error) {
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Create dedicated HIPAA audit logger
 	logger := client.Logger("hipaa-audit-log")
-	
+
 	return &CloudAuditLogger{
 		client: client,
 		logger: logger,
 	}, nil
 }
 
-func (cal *CloudAuditLogger) LogAccess(ctx context.Context, entry AuditEntry) {
-	severity := logging.Info
-	if !entry.Success {
-		severity = logging.Warning
+func (cal *CloudAuditLogger) Name() string {
+	return "cloud"
+}
+
+// Write sends the records and waits for Cloud Logging to accept them
+func (cal *CloudAuditLogger) Write(ctx context.Context, records []AuditRecord) error {
+	for _, record := range records {
+		severity := logging.Info
+		if !record.Success {
+			severity = logging.Warning
+		}
+
+		cal.logger.Log(logging.Entry{
+			Severity:  severity,
+			Timestamp: record.Timestamp,
+			Payload:   record,
+			Labels: map[string]string{
+				"user_id":    record.UserID,
+				"action":     record.Action,
+				"resource":   record.ResourceType,
+				"chain_id":   record.ChainID,
+				"request_id": record.RequestID,
+			},
+		})
 	}
-	
-	cal.logger.Log(logging.Entry{
-		Severity:  severity,
-		Timestamp: entry.Timestamp,
-		Payload:   entry,
-		Labels: map[string]string{
-			"user_id": entry.UserID,
-			"action":  entry.Action,
-			"resource": entry.ResourceType,
-		},
-	})
+	return cal.logger.Flush()
 }
 
 func (cal *CloudAuditLogger) Close() error {
 	return cal.client.Close()
-}
\ No newline at end of file
+}
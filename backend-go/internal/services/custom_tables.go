@@ -34,9 +34,6 @@ func RenderCustomTable(element Element, answers map[string]interface{}) (templat
 
 // RenderBodyDiagram renders a body diagram with pain points marked
 func RenderBodyDiagram(painPoints interface{}) template.HTML {
-	// Log the incoming data for debugging
-	log.Printf("RenderBodyDiagram received data type: %T, value: %+v", painPoints, painPoints)
-	
 	// Default empty diagram
 	if painPoints == nil {
 		return template.HTML(`<div style="text-align: center; padding: 20px; border: 1px solid #ddd; background: #f9f9f9;">
@@ -70,8 +67,6 @@ func RenderBodyDiagram(painPoints interface{}) template.HTML {
 	
 	for i, point := range points {
 		if pointMap, ok := point.(map[string]interface{}); ok {
-			log.Printf("Processing point %d: %+v", i, pointMap)
-			
 			x, _ := pointMap["x"].(float64)
 			y, _ := pointMap["y"].(float64)
 			
@@ -8,10 +8,12 @@ import (
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
+	"backend-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/api/idtoken"
 )
 
@@ -99,12 +101,7 @@ type EnhancedGotenbergService struct {
 	circuitBreaker *CircuitBreaker
 }
 
-func NewEnhancedGotenbergService() *EnhancedGotenbergService {
-	gotenbergURL := os.Getenv("GOTENBERG_URL")
-	if gotenbergURL == "" {
-		gotenbergURL = "http://localhost:3000"
-	}
-
+func NewEnhancedGotenbergService(gotenbergURL string) *EnhancedGotenbergService {
 	return &EnhancedGotenbergService{
 		baseURL: gotenbergURL,
 		httpClient: &http.Client{
@@ -116,9 +113,16 @@ func NewEnhancedGotenbergService() *EnhancedGotenbergService {
 	}
 }
 
-func (s *EnhancedGotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte, error) {
+func (s *EnhancedGotenbergService) ConvertHTMLToPDF(ctx context.Context, htmlContent string) (pdfBytes []byte, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "gotenberg.convert", attribute.Int("html.bytes", len(htmlContent)))
+	start := time.Now()
+	defer func() {
+		telemetry.GotenbergDuration.WithLabelValues(telemetry.Outcome(err)).Observe(time.Since(start).Seconds())
+		telemetry.EndSpan(span, err)
+	}()
+
 	result, err := s.circuitBreaker.Execute(func() (interface{}, error) {
-		return s.convertWithRetry(htmlContent)
+		return s.convertWithRetry(ctx, htmlContent)
 	})
 
 	if err != nil {
@@ -128,7 +132,7 @@ func (s *EnhancedGotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte,
 	return result.([]byte), nil
 }
 
-func (s *EnhancedGotenbergService) convertWithRetry(htmlContent string) ([]byte, error) {
+func (s *EnhancedGotenbergService) convertWithRetry(ctx context.Context, htmlContent string) ([]byte, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= s.maxRetries; attempt++ {
@@ -139,7 +143,7 @@ func (s *EnhancedGotenbergService) convertWithRetry(htmlContent string) ([]byte,
 			time.Sleep(backoffDuration)
 		}
 
-		pdfBytes, err := s.performConversion(htmlContent)
+		pdfBytes, err := s.performConversion(ctx, htmlContent)
 		if err == nil {
 			if attempt > 0 {
 				log.Printf("Gotenberg conversion succeeded on attempt %d", attempt+1)
@@ -172,7 +176,7 @@ func (e *HTTPError) Error() string {
 	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Body)
 }
 
-func (s *EnhancedGotenbergService) performConversion(htmlContent string) ([]byte, error) {
+func (s *EnhancedGotenbergService) performConversion(ctx context.Context, htmlContent string) ([]byte, error) {
 	conversionURL := s.baseURL + "/forms/chromium/convert/html"
 
 	body := &bytes.Buffer{}
@@ -200,14 +204,14 @@ func (s *EnhancedGotenbergService) performConversion(htmlContent string) ([]byte
 	}
 
 	// Create the request
-	req, err := http.NewRequest("POST", conversionURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", conversionURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gotenberg request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	setTraceHeaders(ctx, req)
 
 	// Create authenticated client for Cloud Run service-to-service communication
-	ctx := context.Background()
 	client, err := idtoken.NewClient(ctx, s.baseURL)
 	if err != nil {
 		log.Printf("Failed to create authenticated client, falling back to regular HTTP: %v", err)
@@ -267,10 +271,10 @@ func (s *EnhancedGotenbergService) addPDFOptions(writer *multipart.Writer) error
 }
 
 // GetServiceHealth checks if Gotenberg service is healthy
-func (s *EnhancedGotenbergService) GetServiceHealth() error {
+func (s *EnhancedGotenbergService) GetServiceHealth(ctx context.Context) error {
 	healthURL := s.baseURL + "/health"
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	
 	req, err := http.NewRequestWithContext(ctx, "GET", healthURL, nil)
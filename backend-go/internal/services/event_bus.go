@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/iterator"
+)
+
+// Domain event types written to the outbox
+const (
+	DomainFormCreated        = "FormCreated"
+	DomainFormUpdated        = "FormUpdated"
+	DomainFormDeleted        = "FormDeleted"
+	DomainFormPublished      = "FormPublished"
+	DomainFormRestored       = "FormRestored"
+	DomainResponseSubmitted  = "ResponseSubmitted"
+	DomainResponseReviewed   = "ResponseReviewed"
+	DomainResponseAmended    = "ResponseAmended"
+	DomainResponseDeleted    = "ResponseDeleted"
+	DomainResponseRestored   = "ResponseRestored"
+	DomainDuplicateFlagged   = "DuplicateFlagged"
+	DomainDuplicateDismissed = "DuplicateDismissed"
+	DomainResponsesMerged    = "ResponsesMerged"
+	DomainShareLinkExhausted = "ShareLinkExhausted"
+	DomainPDFGenerated       = "PDFGenerated"
+)
+
+const (
+	outboxCollection = "outbox"
+	outboxDedupeTTL  = 7 * 24 * time.Hour
+	// Dispatched events are kept as long as their dedupe markers, then purged hourly.
+	// Failed events stay until an operator has looked at them.
+	outboxRetention     = outboxDedupeTTL
+	outboxPurgeInterval = time.Hour
+	outboxPurgeBatch    = 200
+)
+
+// EventHandler handles one domain event. Handlers must be idempotent: delivery is
+// at-least-once, and the Redis dedupe marker only narrows the window for repeats.
+type EventHandler func(ctx context.Context, event *data.DomainEvent) error
+
+type eventSubscriber struct {
+	name    string
+	types   map[string]bool
+	handler EventHandler
+}
+
+// EventBus stages domain events in the Firestore outbox alongside entity writes and
+// dispatches them to in-process subscribers.
+type EventBus struct {
+	client      *firestore.Client
+	rdb         *redis.Client
+	mu          sync.RWMutex
+	subscribers []eventSubscriber
+	wake        chan struct{}
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	interval    time.Duration
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus(client *firestore.Client, rdb *redis.Client) *EventBus {
+	return &EventBus{
+		client:      client,
+		rdb:         rdb,
+		wake:        make(chan struct{}, 1),
+		maxAttempts: 10,
+		baseBackoff: 5 * time.Second,
+		maxBackoff:  30 * time.Minute,
+		interval:    5 * time.Second,
+	}
+}
+
+// NewDomainEvent builds a pending outbox record
+func NewDomainEvent(eventType, orgID, aggregateType, aggregateID, actorID string, payload map[string]interface{}) data.DomainEvent {
+	now := time.Now().UTC()
+	return data.DomainEvent{
+		Type:           eventType,
+		OrganizationID: orgID,
+		AggregateType:  aggregateType,
+		AggregateID:    aggregateID,
+		ActorID:        actorID,
+		Payload:        payload,
+		Status:         "pending",
+		NextAttemptAt:  now,
+		OccurredAt:     now,
+	}
+}
+
+// Subscribe registers a handler for the given event types. The name identifies the
+// subscriber in the dedupe keys, so it must stay stable across deploys.
+func (b *EventBus) Subscribe(name string, eventTypes []string, handler EventHandler) {
+	types := make(map[string]bool, len(eventTypes))
+	for _, t := range eventTypes {
+		types[t] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, eventSubscriber{name: name, types: types, handler: handler})
+}
+
+// Transact runs fn in a Firestore transaction and writes the events it returns to the
+// outbox in the same commit, so the change and its events persist or fail together.
+// Events are stamped with the request ID in ctx so subscribers can be correlated with it.
+func (b *EventBus) Transact(ctx context.Context, fn func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error)) error {
+	err := b.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		events, err := fn(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.RequestID == "" {
+				event.RequestID = logging.RequestID(ctx)
+			}
+			if err := tx.Create(b.client.Collection(outboxCollection).NewDoc(), event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	b.notify()
+	return nil
+}
+
+// Emit writes events that have no accompanying entity change
+func (b *EventBus) Emit(ctx context.Context, events ...data.DomainEvent) error {
+	return b.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		return events, nil
+	})
+}
+
+// notify wakes the dispatcher so freshly committed events don't wait for the next tick
+func (b *EventBus) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the dispatcher until ctx is cancelled
+func (b *EventBus) Start(ctx context.Context) {
+	log.Printf("EVENTS: dispatcher started (interval %v)", b.interval)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		if err := b.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("EVENTS: dispatch sweep failed: %v", err)
+		}
+		if time.Since(lastPurge) >= outboxPurgeInterval {
+			lastPurge = time.Now()
+			if n, err := b.PurgeDispatched(ctx, time.Now().UTC().Add(-outboxRetention)); err != nil && ctx.Err() == nil {
+				log.Printf("EVENTS: outbox purge failed: %v", err)
+			} else if n > 0 {
+				log.Printf("EVENTS: purged %d dispatched events", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("EVENTS: dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// RunOnce delivers every pending event whose backoff has elapsed
+func (b *EventBus) RunOnce(ctx context.Context) error {
+	iter := b.client.Collection(outboxCollection).
+		Where("status", "==", "pending").
+		Where("next_attempt_at", "<=", time.Now().UTC()).
+		OrderBy("next_attempt_at", firestore.Asc).
+		Limit(100).
+		Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Claim the event so concurrent instances don't dispatch it in parallel
+		if b.rdb != nil {
+			lock := NewDistributedLock(b.rdb, "outbox-event:"+doc.Ref.ID, time.Minute)
+			acquired, err := lock.Acquire(ctx)
+			if err != nil || !acquired {
+				continue
+			}
+			b.dispatch(ctx, doc.Ref)
+			lock.Release(context.Background())
+		} else {
+			b.dispatch(ctx, doc.Ref)
+		}
+	}
+}
+
+// dispatch hands one event to each matching subscriber and records the outcome
+func (b *EventBus) dispatch(ctx context.Context, ref *firestore.DocumentRef) {
+	// Re-read under the claim; another instance may have just finished it
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return
+	}
+	var event data.DomainEvent
+	if err := doc.DataTo(&event); err != nil || event.Status != "pending" {
+		return
+	}
+	event.ID = ref.ID
+	if event.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, event.RequestID)
+	}
+	logger := logging.FromContext(ctx).With("event_id", event.ID, "event_type", event.Type)
+
+	b.mu.RLock()
+	subscribers := append([]eventSubscriber(nil), b.subscribers...)
+	b.mu.RUnlock()
+
+	var failures []string
+	for _, sub := range subscribers {
+		if !sub.types[event.Type] {
+			continue
+		}
+
+		dedupeKey := fmt.Sprintf("outbox:done:%s:%s", event.ID, sub.name)
+		if b.rdb != nil {
+			if done, err := b.rdb.Exists(ctx, dedupeKey).Result(); err == nil && done > 0 {
+				continue
+			}
+		}
+
+		if err := sub.handler(ctx, &event); err != nil {
+			logger.Error("EVENTS: subscriber failed", "subscriber", sub.name, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", sub.name, err))
+			continue
+		}
+
+		if b.rdb != nil {
+			if err := b.rdb.Set(ctx, dedupeKey, 1, outboxDedupeTTL).Err(); err != nil {
+				logger.Warn("EVENTS: failed to record dedupe marker", "subscriber", sub.name, "error", err)
+			}
+		}
+	}
+
+	event.Attempts++
+	if len(failures) == 0 {
+		now := time.Now().UTC()
+		_, err := ref.Update(ctx, []firestore.Update{
+			{Path: "status", Value: "dispatched"},
+			{Path: "attempts", Value: event.Attempts},
+			{Path: "dispatched_at", Value: now},
+		})
+		if err != nil {
+			logger.Error("EVENTS: failed to mark event dispatched", "error", err)
+		}
+		return
+	}
+
+	// Subscribers that already succeeded are skipped on retry via their dedupe markers
+	updates := []firestore.Update{
+		{Path: "attempts", Value: event.Attempts},
+		{Path: "last_error", Value: fmt.Sprintf("%v", failures)},
+		{Path: "next_attempt_at", Value: time.Now().UTC().Add(b.backoff(event.Attempts))},
+	}
+	if event.Attempts >= b.maxAttempts {
+		updates = append(updates, firestore.Update{Path: "status", Value: "failed"})
+		logger.Error("EVENTS: event failed", "attempts", event.Attempts)
+	}
+	if _, err := ref.Update(ctx, updates); err != nil {
+		logger.Error("EVENTS: failed to reschedule event", "error", err)
+	}
+}
+
+// PurgeDispatched deletes events that were dispatched before the cutoff and returns how
+// many it removed. Pending and failed events are kept.
+func (b *EventBus) PurgeDispatched(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	for {
+		docs, err := b.client.Collection(outboxCollection).
+			Where("status", "==", "dispatched").
+			Where("dispatched_at", "<", before).
+			Limit(outboxPurgeBatch).
+			Documents(ctx).GetAll()
+		if err != nil {
+			return purged, err
+		}
+		if len(docs) == 0 {
+			return purged, nil
+		}
+		batch := b.client.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return purged, err
+		}
+		purged += len(docs)
+		if len(docs) < outboxPurgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// backoff returns the exponential delay before the next attempt
+func (b *EventBus) backoff(attempts int) time.Duration {
+	delay := time.Duration(float64(b.baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if delay > b.maxBackoff {
+		delay = b.maxBackoff
+	}
+	return delay
+}
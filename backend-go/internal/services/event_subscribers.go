@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// domainToWebhookEvent maps outbox event types onto the public webhook event names
+var domainToWebhookEvent = map[string]string{
+	DomainResponseSubmitted:  EventResponseSubmitted,
+	DomainResponseReviewed:   EventResponseReviewed,
+	DomainResponseAmended:    EventResponseAmended,
+	DomainPDFGenerated:       EventPDFGenerated,
+	DomainFormPublished:      EventFormPublished,
+	DomainShareLinkExhausted: EventShareLinkExhausted,
+}
+
+// InvalidateFormCache removes the cached form and the organization's form list
+func InvalidateFormCache(ctx context.Context, rdb *redis.Client, orgID, formID string) error {
+	if rdb == nil {
+		return nil
+	}
+	keys := []string{}
+	if formID != "" {
+		keys = append(keys, fmt.Sprintf("form:%s", formID))
+	}
+	if orgID != "" {
+		keys = append(keys, fmt.Sprintf("forms:list:%s", orgID))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return rdb.Del(ctx, keys...).Err()
+}
+
+// FlushOrganizationCache removes every cached form of the organization and its form list.
+// It returns the number of cache entries that were present.
+func FlushOrganizationCache(ctx context.Context, client *firestore.Client, rdb *redis.Client, orgID string) (int, error) {
+	refs, err := client.Collection("forms").Where("organizationId", "==", orgID).Select().Documents(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list forms: %w", err)
+	}
+	keys := []string{fmt.Sprintf("forms:list:%s", orgID)}
+	for _, doc := range refs {
+		keys = append(keys, fmt.Sprintf("form:%s", doc.Ref.ID))
+	}
+	removed, err := rdb.Del(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete cache entries: %w", err)
+	}
+	return int(removed), nil
+}
+
+// RegisterCoreSubscribers wires the built-in side effects onto the event bus:
+// form cache invalidation, audit entries for entity changes, and webhook fan-out.
+func RegisterCoreSubscribers(bus *EventBus, client *firestore.Client, rdb *redis.Client, webhooks *WebhookService, auditLogger *AuditTrail, encryptor *FieldEncryptor) {
+	bus.Subscribe("form-cache", []string{DomainFormCreated, DomainFormUpdated, DomainFormDeleted, DomainFormPublished, DomainFormRestored},
+		func(ctx context.Context, event *data.DomainEvent) error {
+			formID := event.AggregateID
+			if event.Type == DomainFormCreated {
+				formID = "" // Nothing cached for a brand new form yet
+			}
+			return InvalidateFormCache(ctx, rdb, event.OrganizationID, formID)
+		})
+
+	if auditLogger != nil {
+		bus.Subscribe("audit", []string{
+			DomainFormCreated, DomainFormUpdated, DomainFormDeleted, DomainFormPublished, DomainFormRestored,
+			DomainResponseSubmitted, DomainResponseReviewed, DomainResponseAmended, DomainResponseDeleted, DomainResponseRestored,
+			DomainDuplicateFlagged, DomainDuplicateDismissed, DomainResponsesMerged,
+			DomainShareLinkExhausted, DomainPDFGenerated,
+		}, func(ctx context.Context, event *data.DomainEvent) error {
+			actor := event.ActorID
+			if actor == "" {
+				actor = "system"
+			}
+			metadata := map[string]interface{}{
+				"organization_id": event.OrganizationID,
+				"event_id":        event.ID,
+			}
+			// A merge is audited with both originals so it can be traced back
+			if event.Type == DomainResponsesMerged {
+				metadata["merged_from"] = event.Payload["merged_from"]
+			}
+			return auditLogger.LogAccessSync(ctx, AuditEntry{
+				Timestamp:    event.OccurredAt,
+				UserID:       actor,
+				Action:       event.Type,
+				ResourceType: event.AggregateType,
+				ResourceID:   event.AggregateID,
+				Success:      true,
+				Metadata:     metadata,
+			})
+		})
+	}
+
+	if webhooks != nil {
+		bus.Subscribe("webhooks", []string{
+			DomainResponseSubmitted, DomainResponseReviewed, DomainResponseAmended, DomainPDFGenerated,
+			DomainFormPublished, DomainShareLinkExhausted,
+		}, func(ctx context.Context, event *data.DomainEvent) error {
+			webhookEvent := WebhookEvent{
+				ID:             event.ID,
+				Type:           domainToWebhookEvent[event.Type],
+				OrganizationID: event.OrganizationID,
+				IDs:            map[string]string{},
+			}
+			for key, value := range event.Payload {
+				if s, ok := value.(string); ok {
+					webhookEvent.IDs[key] = s
+				}
+			}
+
+			// Response events carry the full response for FHIR-mode subscriptions
+			if event.AggregateType == "response" {
+				doc, err := client.Collection("form_responses").Doc(event.AggregateID).Get(ctx)
+				if err != nil && status.Code(err) != codes.NotFound {
+					return err
+				}
+				if err == nil {
+					response, err := encryptor.OpenResponse(ctx, doc)
+					if err != nil {
+						return err
+					}
+					webhookEvent.Response = response
+				}
+			}
+
+			return webhooks.Publish(ctx, webhookEvent)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+)
+
+// BuildQuestionnaireResponse converts a stored form response into a FHIR R4
+// QuestionnaireResponse resource. Answer keys become item linkIds; nested objects
+// become nested items so panel structure survives the conversion.
+func BuildQuestionnaireResponse(response *data.FormResponse) map[string]interface{} {
+	resource := map[string]interface{}{
+		"resourceType":  "QuestionnaireResponse",
+		"id":            response.ID,
+		"questionnaire": "Questionnaire/" + response.FormID,
+		"status":        "completed",
+		"authored":      response.SubmittedAt.UTC().Format(time.RFC3339),
+		"item":          buildFHIRItems(response.Data),
+	}
+
+	if response.PatientName != "" {
+		resource["subject"] = map[string]interface{}{
+			"display": response.PatientName,
+		}
+	}
+	if response.Status != "" && response.Status != "completed" {
+		resource["status"] = "in-progress"
+	}
+
+	return resource
+}
+
+// BuildFHIRBundle wraps resources in a FHIR collection Bundle
+func BuildFHIRBundle(resources []map[string]interface{}) map[string]interface{} {
+	entries := make([]map[string]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		entry := map[string]interface{}{"resource": resource}
+		if resourceType, ok := resource["resourceType"].(string); ok {
+			if id, ok := resource["id"].(string); ok && id != "" {
+				entry["fullUrl"] = fmt.Sprintf("%s/%s", resourceType, id)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return map[string]interface{}{
+		"resourceType": "Bundle",
+		"type":         "collection",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+		"entry":        entries,
+	}
+}
+
+func buildFHIRItems(answers map[string]interface{}) []map[string]interface{} {
+	// Sort keys so the output is stable across runs
+	keys := make([]string, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		value := answers[key]
+		if value == nil {
+			continue
+		}
+
+		item := map[string]interface{}{"linkId": key}
+		if nested, ok := value.(map[string]interface{}); ok {
+			item["item"] = buildFHIRItems(nested)
+		} else if fhirAnswers := buildFHIRAnswers(value); len(fhirAnswers) > 0 {
+			item["answer"] = fhirAnswers
+		} else {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func buildFHIRAnswers(value interface{}) []map[string]interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		var answers []map[string]interface{}
+		for _, elem := range v {
+			if nested, ok := elem.(map[string]interface{}); ok {
+				answers = append(answers, map[string]interface{}{"item": buildFHIRItems(nested)})
+				continue
+			}
+			answers = append(answers, buildFHIRAnswers(elem)...)
+		}
+		return answers
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			return []map[string]interface{}{{"valueAttachment": dataURIAttachment(v)}}
+		}
+		if IsAttachmentRef(v) {
+			return []map[string]interface{}{{"valueAttachment": map[string]interface{}{
+				"url": "/api/attachments/" + AttachmentRefID(v),
+			}}}
+		}
+		return []map[string]interface{}{{"valueString": v}}
+	case bool:
+		return []map[string]interface{}{{"valueBoolean": v}}
+	case int, int32, int64:
+		return []map[string]interface{}{{"valueInteger": v}}
+	case float32, float64:
+		return []map[string]interface{}{{"valueDecimal": v}}
+	case time.Time:
+		return []map[string]interface{}{{"valueDateTime": v.UTC().Format(time.RFC3339)}}
+	default:
+		return []map[string]interface{}{{"valueString": fmt.Sprintf("%v", v)}}
+	}
+}
+
+// dataURIAttachment converts a data:<mime>;base64,<data> string into a FHIR Attachment
+func dataURIAttachment(uri string) map[string]interface{} {
+	attachment := map[string]interface{}{}
+	header, payload, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found {
+		return attachment
+	}
+	contentType, _, _ := strings.Cut(header, ";")
+	attachment["contentType"] = contentType
+	attachment["data"] = payload
+	return attachment
+}
@@ -0,0 +1,640 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	dataKeysCollection = "data_keys"
+	// systemKeyRing encrypts values that belong to no single organization, such as Redis sessions
+	systemKeyRing   = "_system"
+	keyRingCacheTTL = 10 * time.Minute
+	// maxLazyRewrites bounds the background re-encryptions triggered by reads
+	maxLazyRewrites = 4
+)
+
+// ErrDecryptionFailed is returned when ciphertext cannot be opened with any known data key
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// FieldEncryptor performs envelope encryption of sensitive fields. Each organization has its
+// own AES-256 data key, stored in data_keys wrapped by the KeyProvider; ciphertexts are
+// "v<version>:<base64 nonce+ciphertext>" and bound to their location through the AAD.
+type FieldEncryptor struct {
+	client   *firestore.Client
+	provider KeyProvider
+
+	mu    sync.Mutex
+	rings map[string]*cachedKeyRing
+
+	rewrites chan struct{}
+	inflight sync.Map
+	pending  sync.WaitGroup
+	draining atomic.Bool
+}
+
+type cachedKeyRing struct {
+	current  int
+	keys     map[int]cipher.AEAD
+	indexKey []byte
+	loadedAt time.Time
+}
+
+// NewFieldEncryptor creates a new field encryptor
+func NewFieldEncryptor(client *firestore.Client, provider KeyProvider) *FieldEncryptor {
+	return &FieldEncryptor{
+		client:   client,
+		provider: provider,
+		rings:    map[string]*cachedKeyRing{},
+		rewrites: make(chan struct{}, maxLazyRewrites),
+	}
+}
+
+// Seal encrypts plaintext with the organization's current data key
+func (e *FieldEncryptor) Seal(ctx context.Context, orgID, aad string, plaintext []byte) (string, error) {
+	ring, err := e.keyRing(ctx, orgID, 0)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := gcmSeal(ring.keys[ring.current], plaintext, []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d:%s", ring.current, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// Open decrypts a value produced by Seal with the same orgID and aad
+func (e *FieldEncryptor) Open(ctx context.Context, orgID, aad, sealed string) ([]byte, error) {
+	version, payload, err := parseSealed(sealed)
+	if err != nil {
+		return nil, err
+	}
+	ring, err := e.keyRing(ctx, orgID, version)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := ring.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown data key version %d", ErrDecryptionFailed, version)
+	}
+	return gcmOpen(aead, payload, []byte(aad))
+}
+
+// SealBlob encrypts a file for the blob store with the organization's current data key.
+// It is Seal without the base64 encoding, which would grow large files by a third.
+func (e *FieldEncryptor) SealBlob(ctx context.Context, orgID, aad string, plaintext []byte) ([]byte, error) {
+	ring, err := e.keyRing(ctx, orgID, 0)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := gcmSeal(ring.keys[ring.current], plaintext, []byte(aad))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf("v%d:", ring.current)), sealed...), nil
+}
+
+// OpenBlob decrypts a file produced by SealBlob with the same orgID and aad
+func (e *FieldEncryptor) OpenBlob(ctx context.Context, orgID, aad string, sealed []byte) ([]byte, error) {
+	prefix, payload, ok := bytes.Cut(sealed, []byte(":"))
+	if !ok || len(prefix) < 2 || prefix[0] != 'v' {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryptionFailed)
+	}
+	version, err := strconv.Atoi(string(prefix[1:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryptionFailed)
+	}
+	ring, err := e.keyRing(ctx, orgID, version)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := ring.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown data key version %d", ErrDecryptionFailed, version)
+	}
+	return gcmOpen(aead, payload, []byte(aad))
+}
+
+// BlindIndex returns a keyed hash of value that can be stored and queried in place of the
+// value itself. It is derived from the organization's first data key so that it stays stable
+// when new data key versions are issued.
+func (e *FieldEncryptor) BlindIndex(ctx context.Context, orgID, value string) (string, error) {
+	ring, err := e.keyRing(ctx, orgID, 0)
+	if err != nil {
+		return "", err
+	}
+	if ring.indexKey == nil {
+		return "", fmt.Errorf("key ring for %s has no first data key version", orgID)
+	}
+	mac := hmac.New(sha256.New, ring.indexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// isStale reports whether sealed was written with an older data key version
+func (e *FieldEncryptor) isStale(ctx context.Context, orgID, sealed string) bool {
+	if sealed == "" {
+		return false
+	}
+	version, _, err := parseSealed(sealed)
+	if err != nil {
+		return false
+	}
+	ring, err := e.keyRing(ctx, orgID, 0)
+	return err == nil && version != ring.current
+}
+
+func parseSealed(sealed string) (int, []byte, error) {
+	prefix, encoded, ok := strings.Cut(sealed, ":")
+	if !ok || !strings.HasPrefix(prefix, "v") {
+		return 0, nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryptionFailed)
+	}
+	version, err := strconv.Atoi(prefix[1:])
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryptionFailed)
+	}
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: malformed ciphertext", ErrDecryptionFailed)
+	}
+	return version, payload, nil
+}
+
+// keyRing returns the organization's unwrapped data keys, creating the key ring on first
+// use. A non-zero needVersion forces a reload when that version isn't cached yet, which
+// happens right after another instance rotated the key ring.
+func (e *FieldEncryptor) keyRing(ctx context.Context, orgID string, needVersion int) (*cachedKeyRing, error) {
+	if orgID == "" {
+		return nil, fmt.Errorf("organization is required for field encryption")
+	}
+
+	e.mu.Lock()
+	ring, ok := e.rings[orgID]
+	e.mu.Unlock()
+	if ok && time.Since(ring.loadedAt) < keyRingCacheTTL {
+		if _, has := ring.keys[needVersion]; needVersion == 0 || has {
+			return ring, nil
+		}
+	}
+
+	stored, err := e.loadOrCreateKeyRing(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	ring = &cachedKeyRing{current: stored.CurrentVersion, keys: map[int]cipher.AEAD{}, loadedAt: time.Now()}
+	for versionKey, wrapped := range stored.Keys {
+		version, err := strconv.Atoi(versionKey)
+		if err != nil {
+			continue
+		}
+		dataKey, err := e.provider.Unwrap(ctx, wrapped.Wrapped, wrapped.KEKID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key v%d for %s: %w", version, orgID, err)
+		}
+		aead, err := newGCM(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[version] = aead
+		if version == 1 {
+			mac := hmac.New(sha256.New, dataKey)
+			mac.Write([]byte("blind-index"))
+			ring.indexKey = mac.Sum(nil)
+		}
+	}
+	if _, ok := ring.keys[ring.current]; !ok {
+		return nil, fmt.Errorf("key ring for %s is missing current version %d", orgID, ring.current)
+	}
+
+	e.mu.Lock()
+	e.rings[orgID] = ring
+	e.mu.Unlock()
+	return ring, nil
+}
+
+func (e *FieldEncryptor) loadOrCreateKeyRing(ctx context.Context, orgID string) (*data.DataKeyRing, error) {
+	ref := e.client.Collection(dataKeysCollection).Doc(orgID)
+	var ring data.DataKeyRing
+
+	// Plain read first: this also runs inside callers' transactions, where a nested
+	// transaction isn't allowed
+	doc, err := ref.Get(ctx)
+	if err == nil {
+		if err := doc.DataTo(&ring); err != nil {
+			return nil, err
+		}
+		return &ring, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("failed to load data key for %s: %w", orgID, err)
+	}
+
+	err = e.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err == nil {
+			return doc.DataTo(&ring)
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		wrapped, err := e.newWrappedKey(ctx)
+		if err != nil {
+			return err
+		}
+		ring = data.DataKeyRing{
+			CurrentVersion: 1,
+			Keys:           map[string]data.WrappedDataKey{"1": wrapped},
+			UpdatedAt:      time.Now().UTC(),
+		}
+		return tx.Create(ref, ring)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key for %s: %w", orgID, err)
+	}
+	return &ring, nil
+}
+
+func (e *FieldEncryptor) newWrappedKey(ctx context.Context) (data.WrappedDataKey, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return data.WrappedDataKey{}, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, kekID, err := e.provider.Wrap(ctx, dataKey)
+	if err != nil {
+		return data.WrappedDataKey{}, err
+	}
+	return data.WrappedDataKey{Wrapped: wrapped, KEKID: kekID, CreatedAt: time.Now().UTC()}, nil
+}
+
+// RotateKeyRing re-wraps every data key version of an organization under the provider's
+// current KEK and, when newVersion is set, adds a fresh data key that new writes will use.
+// It returns the number of versions that were re-wrapped.
+func (e *FieldEncryptor) RotateKeyRing(ctx context.Context, orgID string, newVersion bool) (int, error) {
+	currentKEK, err := e.provider.CurrentKEK(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ref := e.client.Collection(dataKeysCollection).Doc(orgID)
+	rewrapped := 0
+	err = e.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		rewrapped = 0
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var ring data.DataKeyRing
+		if err := doc.DataTo(&ring); err != nil {
+			return err
+		}
+
+		for version, wrapped := range ring.Keys {
+			if wrapped.KEKID == currentKEK {
+				continue
+			}
+			dataKey, err := e.provider.Unwrap(ctx, wrapped.Wrapped, wrapped.KEKID)
+			if err != nil {
+				return fmt.Errorf("failed to unwrap data key v%s: %w", version, err)
+			}
+			rewrappedKey, kekID, err := e.provider.Wrap(ctx, dataKey)
+			if err != nil {
+				return err
+			}
+			wrapped.Wrapped, wrapped.KEKID = rewrappedKey, kekID
+			ring.Keys[version] = wrapped
+			rewrapped++
+		}
+
+		if newVersion {
+			wrapped, err := e.newWrappedKey(ctx)
+			if err != nil {
+				return err
+			}
+			ring.CurrentVersion++
+			ring.Keys[strconv.Itoa(ring.CurrentVersion)] = wrapped
+		}
+
+		ring.UpdatedAt = time.Now().UTC()
+		return tx.Set(ref, ring)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	delete(e.rings, orgID)
+	e.mu.Unlock()
+	return rewrapped, nil
+}
+
+// responseAAD binds a response field's ciphertext to its document and field name
+func responseAAD(responseID, field string) string {
+	return fmt.Sprintf("form_responses/%s/%s", responseID, field)
+}
+
+// SealResponse returns a copy of response with its PHI fields encrypted, ready to write
+// to Firestore. The caller's value keeps its plaintext for the API reply.
+func (e *FieldEncryptor) SealResponse(ctx context.Context, responseID string, response data.FormResponse) (data.FormResponse, error) {
+	sealed := &data.EncryptedPHI{}
+	if len(response.Data) > 0 {
+		raw, err := json.Marshal(response.Data)
+		if err != nil {
+			return response, fmt.Errorf("failed to marshal response data: %w", err)
+		}
+		if sealed.Data, err = e.Seal(ctx, response.OrganizationID, responseAAD(responseID, "response_data"), raw); err != nil {
+			return response, err
+		}
+	}
+	for _, field := range []struct {
+		name   string
+		value  string
+		target *string
+	}{
+		{"patient_name", response.PatientName, &sealed.PatientName},
+		{"ip_address", response.IPAddress, &sealed.IPAddress},
+	} {
+		if field.value == "" {
+			continue
+		}
+		value, err := e.Seal(ctx, response.OrganizationID, responseAAD(responseID, field.name), []byte(field.value))
+		if err != nil {
+			return response, err
+		}
+		*field.target = value
+	}
+	if len(response.Revisions) > 0 {
+		raw, err := json.Marshal(response.Revisions)
+		if err != nil {
+			return response, fmt.Errorf("failed to marshal revisions: %w", err)
+		}
+		if sealed.Revisions, err = e.Seal(ctx, response.OrganizationID, responseAAD(responseID, "revisions"), raw); err != nil {
+			return response, err
+		}
+	}
+
+	response.Data = nil
+	response.PatientName = ""
+	response.IPAddress = ""
+	response.Revisions = nil
+	response.Encrypted = sealed
+	return response, nil
+}
+
+// openResponseFields decrypts a response's sealed PHI back into its plaintext fields. The
+// sealed copy is left in place.
+func (e *FieldEncryptor) openResponseFields(ctx context.Context, responseID string, response *data.FormResponse) error {
+	orgID, sealed := response.OrganizationID, response.Encrypted
+	var answers map[string]interface{}
+	if sealed.Data != "" {
+		raw, err := e.Open(ctx, orgID, responseAAD(responseID, "response_data"), sealed.Data)
+		if err != nil {
+			return fmt.Errorf("response_data: %w", err)
+		}
+		if err := json.Unmarshal(raw, &answers); err != nil {
+			return fmt.Errorf("response_data: %w", err)
+		}
+	}
+	var patientName, ipAddress string
+	if sealed.PatientName != "" {
+		raw, err := e.Open(ctx, orgID, responseAAD(responseID, "patient_name"), sealed.PatientName)
+		if err != nil {
+			return fmt.Errorf("patient_name: %w", err)
+		}
+		patientName = string(raw)
+	}
+	if sealed.IPAddress != "" {
+		raw, err := e.Open(ctx, orgID, responseAAD(responseID, "ip_address"), sealed.IPAddress)
+		if err != nil {
+			return fmt.Errorf("ip_address: %w", err)
+		}
+		ipAddress = string(raw)
+	}
+	var revisions []data.ResponseRevision
+	if sealed.Revisions != "" {
+		raw, err := e.Open(ctx, orgID, responseAAD(responseID, "revisions"), sealed.Revisions)
+		if err != nil {
+			return fmt.Errorf("revisions: %w", err)
+		}
+		if err := json.Unmarshal(raw, &revisions); err != nil {
+			return fmt.Errorf("revisions: %w", err)
+		}
+	}
+	response.Data, response.PatientName, response.IPAddress, response.Revisions = answers, patientName, ipAddress, revisions
+	return nil
+}
+
+// needsRewrite reports whether a stored response is plaintext or sealed with an old data key
+func (e *FieldEncryptor) needsRewrite(ctx context.Context, orgID string, sealed *data.EncryptedPHI) bool {
+	if sealed == nil {
+		return true
+	}
+	return e.isStale(ctx, orgID, sealed.Data) || e.isStale(ctx, orgID, sealed.PatientName) ||
+		e.isStale(ctx, orgID, sealed.IPAddress) || e.isStale(ctx, orgID, sealed.Revisions)
+}
+
+// OpenResponse parses a form_responses document and decrypts its PHI. Documents that are
+// still plaintext or sealed with an older data key are re-encrypted in the background.
+func (e *FieldEncryptor) OpenResponse(ctx context.Context, doc *firestore.DocumentSnapshot) (*data.FormResponse, error) {
+	var response data.FormResponse
+	if err := doc.DataTo(&response); err != nil {
+		return nil, err
+	}
+	response.ID = doc.Ref.ID
+
+	if e.needsRewrite(ctx, response.OrganizationID, response.Encrypted) {
+		e.rewriteLater(ctx, doc.Ref)
+	}
+	if response.Encrypted == nil {
+		return &response, nil
+	}
+
+	if err := e.openResponseFields(ctx, response.ID, &response); err != nil {
+		return nil, fmt.Errorf("failed to decrypt response %s: %w", response.ID, err)
+	}
+	response.Encrypted = nil
+	return &response, nil
+}
+
+// OpenResponseMap is OpenResponse for callers that work with the raw document map
+func (e *FieldEncryptor) OpenResponseMap(ctx context.Context, doc *firestore.DocumentSnapshot) (map[string]interface{}, error) {
+	response, err := e.OpenResponse(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := doc.Data()
+	delete(fields, "encrypted_phi")
+	if response.Data != nil {
+		fields["response_data"] = response.Data
+	}
+	if response.PatientName != "" {
+		fields["patient_name"] = response.PatientName
+	}
+	if response.IPAddress != "" {
+		fields["ip_address"] = response.IPAddress
+	}
+	if len(response.Revisions) > 0 {
+		fields["revisions"] = response.Revisions
+	}
+	return fields, nil
+}
+
+// rewriteLater re-encrypts a response off the request path. Rewrites are bounded and
+// de-duplicated; a skipped document is picked up on its next read or by the rotation sweep.
+func (e *FieldEncryptor) rewriteLater(ctx context.Context, ref *firestore.DocumentRef) {
+	if e.draining.Load() {
+		return
+	}
+	if _, busy := e.inflight.LoadOrStore(ref.ID, true); busy {
+		return
+	}
+	select {
+	case e.rewrites <- struct{}{}:
+	default:
+		e.inflight.Delete(ref.ID)
+		return
+	}
+
+	e.pending.Add(1)
+	go func() {
+		defer func() {
+			<-e.rewrites
+			e.inflight.Delete(ref.ID)
+			e.pending.Done()
+		}()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if _, err := e.ReencryptResponse(ctx, ref); err != nil {
+			log.Printf("ENCRYPTION: lazy re-encryption of response %s failed: %v", ref.ID, err)
+		}
+	}()
+}
+
+// Drain stops scheduling lazy rewrites and waits for the running ones, giving up when ctx
+// expires. Unfinished documents are rewritten on their next read.
+func (e *FieldEncryptor) Drain(ctx context.Context) error {
+	e.draining.Store(true)
+	done := make(chan struct{})
+	go func() {
+		e.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("lazy re-encryption still running: %w", ctx.Err())
+	}
+}
+
+// ReencryptResponse seals a response with its organization's current data key, encrypting
+// legacy plaintext documents along the way. It reports whether the document was rewritten.
+func (e *FieldEncryptor) ReencryptResponse(ctx context.Context, ref *firestore.DocumentRef) (bool, error) {
+	// Load the key ring up front so a missing one is created outside the transaction
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	orgID, _ := doc.Data()["organizationId"].(string)
+	if _, err := e.keyRing(ctx, orgID, 0); err != nil {
+		return false, err
+	}
+
+	rewritten := false
+	err = e.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		rewritten = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			return err
+		}
+		if !e.needsRewrite(ctx, response.OrganizationID, response.Encrypted) {
+			return nil
+		}
+
+		if response.Encrypted != nil {
+			if err := e.openResponseFields(ctx, ref.ID, &response); err != nil {
+				return err
+			}
+		}
+		sealed, err := e.SealResponse(ctx, ref.ID, response)
+		if err != nil {
+			return err
+		}
+
+		rewritten = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "encrypted_phi", Value: sealed.Encrypted},
+			{Path: "response_data", Value: firestore.Delete},
+			{Path: "patient_name", Value: firestore.Delete},
+			{Path: "ip_address", Value: firestore.Delete},
+		})
+	})
+	return rewritten, err
+}
+
+// cacheEncryptor is set once at startup; Redis helpers fall back to plaintext without it
+var cacheEncryptor atomic.Pointer[FieldEncryptor]
+
+const sealedCachePrefix = "enc:"
+
+// SetCacheEncryptor enables encryption of sessions and cached forms in Redis
+func SetCacheEncryptor(e *FieldEncryptor) {
+	cacheEncryptor.Store(e)
+}
+
+// SealCacheValue encrypts a Redis value under the system data key, bound to its key
+func SealCacheValue(ctx context.Context, key string, value []byte) ([]byte, error) {
+	e := cacheEncryptor.Load()
+	if e == nil {
+		return value, nil
+	}
+	sealed, err := e.Seal(ctx, systemKeyRing, key, value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealedCachePrefix + sealed), nil
+}
+
+// OpenCacheValue decrypts a value written by SealCacheValue. Once encryption is enabled,
+// plaintext entries are rejected so that callers treat them as cache misses.
+func OpenCacheValue(ctx context.Context, key string, stored []byte) ([]byte, error) {
+	e := cacheEncryptor.Load()
+	sealed, isSealed := strings.CutPrefix(string(stored), sealedCachePrefix)
+	if e == nil {
+		if isSealed {
+			return nil, fmt.Errorf("%w: cache encryption is not configured", ErrDecryptionFailed)
+		}
+		return stored, nil
+	}
+	if !isSealed {
+		return nil, fmt.Errorf("%w: unencrypted cache entry", ErrDecryptionFailed)
+	}
+	return e.Open(ctx, systemKeyRing, key, sealed)
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"fmt"
 	"html/template"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -114,10 +113,8 @@ func processElements(elements interface{}, responseData map[string]interface{})
 			if sigData, ok := answer.(string); ok && strings.HasPrefix(sigData, "data:image/") {
 				signatureData = template.URL(sigData)
 				answer = "[Signature Captured]"
-				log.Printf("--- DEBUG: Successfully processed signature for question: %s ---", name)
 			} else {
 				answer = "[No Signature]"
-				log.Printf("--- DEBUG: Failed to process signature for question: %s. Data type: %T, Value: %v ---", name, answer, answer)
 			}
 		} else if qType == "dateofbirth" {
 			// Handle date of birth with age calculation
@@ -132,7 +129,6 @@ func processElements(elements interface{}, responseData map[string]interface{})
 			// Handle body diagram pain points
 			// The answer should be an array of pain points
 			// We'll keep the raw data for PDF rendering
-			log.Printf("--- DEBUG: Processing body diagram for question: %s, type: %s, data type: %T ---", name, qType, answer)
 			// Keep the raw answer data for special rendering in PDF
 		}
 
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"backend-go/internal/data"
+)
+
+// FormVersionConflict is returned when a form changed after the caller read it. Current is
+// the form as stored now, so the caller can merge and retry.
+type FormVersionConflict struct {
+	Current *data.Form
+}
+
+func (e *FormVersionConflict) Error() string {
+	return fmt.Sprintf("form %s has been modified (now version %d)", e.Current.ID, e.Current.Version)
+}
+
+// FormETag identifies one stored version of a form. Every write through the API bumps
+// Version; UpdatedAt also catches writes made outside it.
+func FormETag(form *data.Form) string {
+	return fmt.Sprintf(`"%d-%d"`, form.Version, form.UpdatedAt.UnixMicro())
+}
+
+// ParseIfMatch splits an If-Match header into its entity tags. Weak tags are dropped, since
+// If-Match only compares strong ones.
+func ParseIfMatch(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// CheckFormVersion returns a FormVersionConflict unless the form's ETag is among ifMatch
+func CheckFormVersion(form *data.Form, ifMatch []string) error {
+	etag := FormETag(form)
+	for _, tag := range ifMatch {
+		if tag == etag {
+			return nil
+		}
+	}
+	return &FormVersionConflict{Current: form}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -11,8 +12,25 @@ import (
 	"net/http"
 	"os"
 	"time"
+
+	"backend-go/internal/logging"
+	"backend-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
+// gotenbergTraceHeader is the header Gotenberg tags its own log lines with
+const gotenbergTraceHeader = "Gotenberg-Trace"
+
+// PDFConverter turns assembled HTML into a PDF. GotenbergService is the production
+// implementation; the dev profile swaps in one that needs no Chromium.
+type PDFConverter interface {
+	ConvertHTMLToPDF(ctx context.Context, htmlContent string) ([]byte, error)
+	GetServiceHealth(ctx context.Context) error
+}
+
 // GotenbergService provides methods for interacting with a Gotenberg instance.
 type GotenbergService struct {
 	url    string
@@ -58,12 +76,7 @@ func newSecureGotenbergClient() (*http.Client, error) {
 }
 
 // NewGotenbergService creates a new instance of GotenbergService.
-func NewGotenbergService() *GotenbergService {
-	gotenbergURL := os.Getenv("GOTENBERG_URL")
-	if gotenbergURL == "" {
-		gotenbergURL = "http://localhost:3000" // Default for local
-	}
-
+func NewGotenbergService(gotenbergURL string) *GotenbergService {
 	// Try to create the secure client for production environments.
 	secureClient, err := newSecureGotenbergClient()
 	if err != nil {
@@ -84,7 +97,14 @@ func NewGotenbergService() *GotenbergService {
 }
 
 // ConvertHTMLToPDF sends an HTML string to Gotenberg and returns the resulting PDF bytes.
-func (s *GotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte, error) {
+func (s *GotenbergService) ConvertHTMLToPDF(ctx context.Context, htmlContent string) (pdfBytes []byte, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "gotenberg.convert", attribute.Int("html.bytes", len(htmlContent)))
+	start := time.Now()
+	defer func() {
+		telemetry.GotenbergDuration.WithLabelValues(telemetry.Outcome(err)).Observe(time.Since(start).Seconds())
+		telemetry.EndSpan(span, err)
+	}()
+
 	conversionURL := s.url + "/forms/chromium/convert/html"
 
 	body := &bytes.Buffer{}
@@ -107,11 +127,12 @@ func (s *GotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte, error)
 		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", conversionURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", conversionURL, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gotenberg request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	setTraceHeaders(ctx, req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -124,10 +145,41 @@ func (s *GotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte, error)
 		return nil, fmt.Errorf("gotenberg returned non-OK status %d: %s", resp.StatusCode, string(errorBody))
 	}
 
-	pdfBytes, err := io.ReadAll(resp.Body)
+	pdfBytes, err = io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read pdf from gotenberg response: %w", err)
 	}
 
 	return pdfBytes, nil
 }
+
+// GetServiceHealth checks Gotenberg's /health endpoint
+func (s *GotenbergService) GetServiceHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create health check request: %w", err)
+	}
+	setTraceHeaders(ctx, req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// setTraceHeaders tags an outbound request with the caller's request ID, both as
+// X-Request-ID and as the trace header Gotenberg writes into its own logs, and with the
+// W3C trace context of the current span
+func setTraceHeaders(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+		req.Header.Set(gotenbergTraceHeader, id)
+	}
+}
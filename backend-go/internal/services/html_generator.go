@@ -2,11 +2,12 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"html/template"
-	"log"
 
 	"backend-go/internal/data"
+	"backend-go/internal/logging"
 )
 
 // Form represents the entire structure of the JSON form.
@@ -44,19 +45,13 @@ func GenerateDynamicHTML(formJSON string, answers map[string]interface{}, clinic
 		return "", err
 	}
 
-	// Log all question names in the form
-	log.Printf("=== Form Structure Debug ===")
-	for pageIdx, page := range form.Pages {
-		log.Printf("Page %d: %s", pageIdx, page.Title)
-		for elemIdx, element := range page.Elements {
-			log.Printf("  Element %d: type=%s, name=%s, title=%s", elemIdx, element.Type, element.Name, element.Title)
-			// Check nested elements
-			for subIdx, subElem := range element.Elements {
-				log.Printf("    SubElement %d: type=%s, name=%s, title=%s", subIdx, subElem.Type, subElem.Name, subElem.Title)
+	if logging.DebugDumpsEnabled() {
+		for pageIdx, page := range form.Pages {
+			for _, element := range page.Elements {
+				logging.Dump(context.Background(), "form structure", "page", pageIdx, "type", element.Type, "name", element.Name)
 			}
 		}
 	}
-	log.Printf("=== End Form Structure ===")
 
 	// Pre-process the form to render custom elements
 	for i, page := range form.Pages {
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrIdempotencyKeyReused is returned when a key comes back with a different request
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// ErrIdempotencyInProgress is returned while the first request made with a key is running
+var ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+// IdempotencyStore remembers the first response to each Idempotency-Key. Records live in
+// Redis and fall back to the idempotency_keys collection when Redis is unavailable. The
+// stored responses can contain PHI, so they are sealed like cached forms. Expired
+// Firestore records are overwritten when their key is reused and otherwise left to the
+// collection's TTL policy on expires_at.
+type IdempotencyStore struct {
+	client *firestore.Client
+	rdb    *redis.Client
+	ttl    time.Duration
+}
+
+// NewIdempotencyStore creates a new idempotency store. rdb may be nil.
+func NewIdempotencyStore(client *firestore.Client, rdb *redis.Client, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{client: client, rdb: rdb, ttl: ttl}
+}
+
+// idempotencyID hashes a scoped key so callers cannot choose Redis keys or document IDs
+func idempotencyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin reserves key for a request with the given hash. It returns nil when the caller
+// holds the reservation and must run the request, and the stored record when an earlier
+// request with the same key and hash has completed. A key in use by a different request
+// returns ErrIdempotencyKeyReused, and one whose request is still running returns
+// ErrIdempotencyInProgress.
+func (s *IdempotencyStore) Begin(ctx context.Context, key, requestHash string) (*data.IdempotencyRecord, error) {
+	now := time.Now().UTC()
+	pending := &data.IdempotencyRecord{RequestHash: requestHash, CreatedAt: now, ExpiresAt: now.Add(s.ttl)}
+
+	var existing *data.IdempotencyRecord
+	var err error
+	if s.rdb != nil {
+		existing, err = s.beginRedis(ctx, idempotencyID(key), pending)
+		if err != nil {
+			log.Printf("WARNING: Redis unavailable for idempotency keys, using Firestore: %v", err)
+		}
+	}
+	if s.rdb == nil || err != nil {
+		existing, err = s.beginFirestore(ctx, idempotencyID(key), pending)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case existing == nil:
+		return nil, nil
+	case existing.RequestHash != requestHash:
+		return nil, ErrIdempotencyKeyReused
+	case !existing.Completed:
+		return nil, ErrIdempotencyInProgress
+	}
+	return existing, nil
+}
+
+// Complete stores the response to a reserved key so retries replay it for the TTL
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, record *data.IdempotencyRecord) error {
+	now := time.Now().UTC()
+	record.Completed = true
+	record.CreatedAt = now
+	record.ExpiresAt = now.Add(s.ttl)
+	id := idempotencyID(key)
+	if s.rdb != nil {
+		err := s.setRedis(ctx, id, record)
+		if err == nil {
+			return nil
+		}
+		log.Printf("WARNING: Redis unavailable for idempotency keys, using Firestore: %v", err)
+	}
+	return s.setFirestore(ctx, nil, id, record)
+}
+
+// Release drops a reservation, so the request can be retried with the same key. It is
+// used when the request failed on the server side.
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	id := idempotencyID(key)
+	if s.rdb != nil {
+		err := s.rdb.Del(ctx, "idempotency:"+id).Err()
+		if err == nil {
+			return nil
+		}
+		log.Printf("WARNING: Redis unavailable for idempotency keys, using Firestore: %v", err)
+	}
+	_, err := s.client.Collection("idempotency_keys").Doc(id).Delete(ctx)
+	return err
+}
+
+func (s *IdempotencyStore) beginRedis(ctx context.Context, id string, pending *data.IdempotencyRecord) (*data.IdempotencyRecord, error) {
+	redisKey := "idempotency:" + id
+	value, err := s.sealRecord(ctx, redisKey, pending)
+	if err != nil {
+		return nil, err
+	}
+	// The stored record can expire between SETNX and GET, so try once more
+	for attempt := 0; attempt < 2; attempt++ {
+		reserved, err := s.rdb.SetNX(ctx, redisKey, value, s.ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+		stored, err := s.rdb.Get(ctx, redisKey).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		opened, err := OpenCacheValue(ctx, redisKey, stored)
+		if err != nil {
+			return nil, err
+		}
+		var existing data.IdempotencyRecord
+		if err := json.Unmarshal(opened, &existing); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	return nil, fmt.Errorf("idempotency key %s kept expiring", id)
+}
+
+func (s *IdempotencyStore) setRedis(ctx context.Context, id string, record *data.IdempotencyRecord) error {
+	redisKey := "idempotency:" + id
+	value, err := s.sealRecord(ctx, redisKey, record)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(record.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.rdb.Set(ctx, redisKey, value, ttl).Err()
+}
+
+func (s *IdempotencyStore) sealRecord(ctx context.Context, redisKey string, record *data.IdempotencyRecord) ([]byte, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return SealCacheValue(ctx, redisKey, raw)
+}
+
+func (s *IdempotencyStore) beginFirestore(ctx context.Context, id string, pending *data.IdempotencyRecord) (*data.IdempotencyRecord, error) {
+	ref := s.client.Collection("idempotency_keys").Doc(id)
+	var existing *data.IdempotencyRecord
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var record data.IdempotencyRecord
+			if err := doc.DataTo(&record); err != nil {
+				return err
+			}
+			if time.Now().Before(record.ExpiresAt) {
+				if len(record.Body) > 0 {
+					if record.Body, err = OpenCacheValue(ctx, "idempotency:"+id, record.Body); err != nil {
+						return err
+					}
+				}
+				existing = &record
+				return nil
+			}
+		}
+		return s.setFirestore(ctx, tx, id, pending)
+	})
+	return existing, err
+}
+
+// setFirestore writes a record with its body sealed, in tx when one is given
+func (s *IdempotencyStore) setFirestore(ctx context.Context, tx *firestore.Transaction, id string, record *data.IdempotencyRecord) error {
+	stored := *record
+	if len(record.Body) > 0 {
+		body, err := SealCacheValue(ctx, "idempotency:"+id, record.Body)
+		if err != nil {
+			return err
+		}
+		stored.Body = body
+	}
+	ref := s.client.Collection("idempotency_keys").Doc(id)
+	if tx != nil {
+		return tx.Set(ref, stored)
+	}
+	_, err := ref.Set(ctx, stored)
+	return err
+}
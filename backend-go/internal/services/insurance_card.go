@@ -24,7 +24,7 @@ func InsuranceCardRenderer(metadata PatternMetadata, context *PDFContext) (strin
 	result.WriteString(`<div class="section-title">Insurance Information</div>`)
 	
 	// Extract insurance card data
-	cardData := extractInsuranceData(metadata.ElementNames, context.Answers)
+	cardData := extractInsuranceData(metadata.ElementNames, context)
 	
 	hasContent := cardData.FrontImage != "" || cardData.BackImage != "" || len(cardData.ExtractedInfo) > 0
 	
@@ -49,7 +49,8 @@ func InsuranceCardRenderer(metadata PatternMetadata, context *PDFContext) (strin
 	return result.String(), nil
 }
 
-func extractInsuranceData(elementNames []string, answers map[string]interface{}) InsuranceCardData {
+func extractInsuranceData(elementNames []string, context *PDFContext) InsuranceCardData {
+	answers := context.Answers
 	cardData := InsuranceCardData{
 		ExtractedInfo:    make(map[string]string),
 		CaptureTimestamp: fmt.Sprintf("%d-%d-%d at %d:%02d %s",
@@ -63,7 +64,7 @@ func extractInsuranceData(elementNames []string, answers map[string]interface{})
 			lowerName := strings.ToLower(elementName)
 			
 			// Check for image data
-			if strValue, ok := value.(string); ok {
+			if strValue, ok := context.imageAnswer(value); ok {
 				if isImageData(strValue) {
 					if strings.Contains(lowerName, "front") || elementName == "insurance_card_front" {
 						cardData.FrontImage = strValue
@@ -98,7 +99,7 @@ func extractInsuranceData(elementNames []string, answers map[string]interface{})
 			   strings.Contains(lowerName, "oop") {
 				
 				valueStr := fmt.Sprintf("%v", value)
-				if valueStr != "" && valueStr != "null" {
+				if valueStr != "" && valueStr != "null" && !IsAttachmentRef(valueStr) {
 					cardData.ExtractedInfo[elementName] = valueStr
 				}
 			}
@@ -111,7 +112,7 @@ func extractInsuranceData(elementNames []string, answers map[string]interface{})
 		if strings.Contains(lowerKey, "insurance") && value != nil {
 			if _, exists := cardData.ExtractedInfo[key]; !exists { // Don't duplicate
 				valueStr := fmt.Sprintf("%v", value)
-				if valueStr != "" && valueStr != "null" {
+				if valueStr != "" && valueStr != "null" && !IsAttachmentRef(valueStr) {
 					cardData.ExtractedInfo[key] = valueStr
 				}
 			}
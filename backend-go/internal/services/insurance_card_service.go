@@ -30,18 +30,24 @@ type ExtractedInsuranceData struct {
 
 // InsuranceCardService provides methods for processing insurance cards with Vertex AI
 type InsuranceCardService struct {
-	client *genai.GenerativeModel
+	client GenerativeModel
 }
 
 // NewInsuranceCardService creates a new instance of InsuranceCardService
-func NewInsuranceCardService(client *genai.Client) *InsuranceCardService {
-	// Use Gemini 2.5 Flash for fast, accurate OCR and data extraction
-	model := client.GenerativeModel("gemini-2.5-flash")
+func NewInsuranceCardService(client *genai.Client, modelName string) *InsuranceCardService {
+	// A fast Flash model is accurate enough for OCR and data extraction
+	model := client.GenerativeModel(modelName)
 	
 	// Configure model for structured output
 	model.SetTemperature(0.1) // Low temperature for consistent extraction
 	model.ResponseMIMEType = "application/json"
 	
+	return NewInsuranceCardServiceWithModel(model)
+}
+
+// NewInsuranceCardServiceWithModel creates an InsuranceCardService on an already
+// configured model
+func NewInsuranceCardServiceWithModel(model GenerativeModel) *InsuranceCardService {
 	return &InsuranceCardService{
 		client: model,
 	}
@@ -96,7 +102,7 @@ IMPORTANT: Return ONLY the JSON object, no other text.`, side)
 	imagePart := genai.ImageData(mimeType, imageData)
 
 	// Generate content with the model
-	resp, err := s.client.GenerateContent(ctx, genai.Text(prompt), imagePart)
+	resp, err := generateContent(ctx, s.client, "insurance_card", genai.Text(prompt), imagePart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate content from Vertex AI: %w", err)
 	}
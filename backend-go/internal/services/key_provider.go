@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"backend-go/internal/config"
+
+	cloudkms "google.golang.org/api/cloudkms/v1"
+)
+
+// KeyProvider wraps and unwraps organization data keys with a key-encryption key (KEK)
+// that never leaves the provider
+type KeyProvider interface {
+	// Wrap encrypts a data key under the current KEK and returns the KEK identifier used
+	Wrap(ctx context.Context, dataKey []byte) (wrapped []byte, kekID string, err error)
+	// Unwrap decrypts a data key previously wrapped under kekID
+	Unwrap(ctx context.Context, wrapped []byte, kekID string) ([]byte, error)
+	// CurrentKEK identifies the KEK new wraps use, so stale wraps can be detected
+	CurrentKEK(ctx context.Context) (string, error)
+}
+
+// NewKeyProvider selects the key provider from the config: provider kms uses the KMS key
+// name, local uses the keyfile.
+func NewKeyProvider(ctx context.Context, cfg config.KeysConfig) (KeyProvider, error) {
+	switch cfg.Provider {
+	case "kms":
+		if cfg.KMSKeyName == "" {
+			return nil, fmt.Errorf("KMS_KEY_NAME is required when KEY_PROVIDER=kms")
+		}
+		return NewKMSKeyProvider(ctx, cfg.KMSKeyName)
+	case "local":
+		return NewLocalKeyProvider(cfg.LocalKeyFile, cfg.GenerateLocalKEK)
+	default:
+		return nil, fmt.Errorf("unsupported KEY_PROVIDER: %s", cfg.Provider)
+	}
+}
+
+// localKeyFile is the on-disk format of the development keyfile
+type localKeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"` // KEK ID -> base64 AES-256 key
+}
+
+// LocalKeyProvider keeps KEKs in a JSON keyfile, for development and tests. Old KEKs stay
+// in the file after rotation so existing wraps can still be opened.
+type LocalKeyProvider struct {
+	path string
+	mu   sync.RWMutex
+	file localKeyFile
+}
+
+// NewLocalKeyProvider loads the keyfile at path. A missing keyfile is created with a fresh
+// KEK only when generate is set; otherwise it is an error, since data wrapped by a lost KEK
+// cannot be recovered.
+func NewLocalKeyProvider(path string, generate bool) (*LocalKeyProvider, error) {
+	p := &LocalKeyProvider{path: path}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !generate {
+			return nil, fmt.Errorf("keyfile %s not found; set GENERATE_LOCAL_KEK=true to create one in development", path)
+		}
+		log.Printf("KEYS: keyfile %s not found, generating a development KEK", path)
+		if _, err := p.Rotate(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if err := json.Unmarshal(raw, &p.file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyfile: %w", err)
+	}
+	if _, ok := p.file.Keys[p.file.Current]; !ok {
+		return nil, fmt.Errorf("keyfile %s has no key for current id %q", path, p.file.Current)
+	}
+	return p, nil
+}
+
+// Rotate adds a new KEK to the keyfile and makes it current
+func (p *LocalKeyProvider) Rotate() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file.Keys == nil {
+		p.file.Keys = map[string]string{}
+	}
+	id := fmt.Sprintf("local-%d", len(p.file.Keys)+1)
+	p.file.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	p.file.Current = id
+
+	raw, err := json.MarshalIndent(p.file, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create keyfile directory: %w", err)
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write keyfile: %w", err)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return "", fmt.Errorf("failed to write keyfile: %w", err)
+	}
+	return id, nil
+}
+
+func (p *LocalKeyProvider) kek(id string) (cipher.AEAD, error) {
+	p.mu.RLock()
+	encoded, ok := p.file.Keys[id]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown local KEK %q", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local KEK %q: %w", id, err)
+	}
+	return newGCM(key)
+}
+
+func (p *LocalKeyProvider) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	p.mu.RLock()
+	id := p.file.Current
+	p.mu.RUnlock()
+
+	aead, err := p.kek(id)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err := gcmSeal(aead, dataKey, []byte(id))
+	if err != nil {
+		return nil, "", err
+	}
+	return wrapped, id, nil
+}
+
+func (p *LocalKeyProvider) Unwrap(ctx context.Context, wrapped []byte, kekID string) ([]byte, error) {
+	aead, err := p.kek(kekID)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(aead, wrapped, []byte(kekID))
+}
+
+func (p *LocalKeyProvider) CurrentKEK(ctx context.Context) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.file.Current, nil
+}
+
+// KMSKeyProvider wraps data keys with a Cloud KMS symmetric key. KEK rotation is
+// configured on the key in KMS; KMS picks the key version from the ciphertext on decrypt.
+type KMSKeyProvider struct {
+	service *cloudkms.Service
+	keyName string // projects/*/locations/*/keyRings/*/cryptoKeys/*
+}
+
+// NewKMSKeyProvider creates a provider for the given crypto key resource name
+func NewKMSKeyProvider(ctx context.Context, keyName string) (*KMSKeyProvider, error) {
+	service, err := cloudkms.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KMS client: %w", err)
+	}
+	return &KMSKeyProvider{service: service, keyName: keyName}, nil
+}
+
+func (p *KMSKeyProvider) Wrap(ctx context.Context, dataKey []byte) ([]byte, string, error) {
+	resp, err := p.service.Projects.Locations.KeyRings.CryptoKeys.
+		Encrypt(p.keyName, &cloudkms.EncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(dataKey)}).
+		Context(ctx).Do()
+	if err != nil {
+		return nil, "", fmt.Errorf("KMS encrypt failed: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid KMS ciphertext: %w", err)
+	}
+	// resp.Name is the key version that performed the wrap
+	return wrapped, resp.Name, nil
+}
+
+func (p *KMSKeyProvider) Unwrap(ctx context.Context, wrapped []byte, kekID string) ([]byte, error) {
+	keyName := p.keyName
+	if i := strings.Index(kekID, "/cryptoKeyVersions/"); i > 0 {
+		keyName = kekID[:i]
+	}
+	resp, err := p.service.Projects.Locations.KeyRings.CryptoKeys.
+		Decrypt(keyName, &cloudkms.DecryptRequest{Ciphertext: base64.StdEncoding.EncodeToString(wrapped)}).
+		Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("KMS decrypt failed: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+func (p *KMSKeyProvider) CurrentKEK(ctx context.Context) (string, error) {
+	key, err := p.service.Projects.Locations.KeyRings.CryptoKeys.Get(p.keyName).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to read KMS key: %w", err)
+	}
+	if key.Primary == nil {
+		return "", fmt.Errorf("KMS key %s has no primary version", p.keyName)
+	}
+	return key.Primary.Name, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmSeal encrypts plaintext and prefixes the random nonce
+func gcmSeal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecryptionFailed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
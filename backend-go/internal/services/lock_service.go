@@ -2,10 +2,16 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
+	"backend-go/internal/data"
+	"backend-go/internal/telemetry"
+
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
@@ -16,9 +22,34 @@ type DistributedLock struct {
 	key        string
 	value      string
 	ttl        time.Duration
-	acquired   bool
+
+	mu       sync.Mutex
+	acquired bool
 }
 
+// Lua scripts that only act when the caller's token still holds the lock. This prevents
+// accidentally releasing or extending someone else's lock.
+const (
+	releaseScript = `
+		if redis.call("get", KEYS[1]) == ARGV[1] then
+			return redis.call("del", KEYS[1])
+		else
+			return 0
+		end
+	`
+	extendScript = `
+		if redis.call("get", KEYS[1]) == ARGV[1] then
+			return redis.call("expire", KEYS[1], ARGV[2])
+		else
+			return 0
+		end
+	`
+)
+
+// heldLocks tracks the locks this process holds so shutdown can release them rather than
+// leave other instances waiting out the TTL
+var heldLocks sync.Map // *DistributedLock -> struct{}
+
 // LockManager provides centralized lock management
 type LockManager struct {
 	client *redis.Client
@@ -31,6 +62,11 @@ func NewLockManager(client *redis.Client) *LockManager {
 	}
 }
 
+// Available reports whether the manager has a Redis client to keep locks in
+func (lm *LockManager) Available() bool {
+	return lm != nil && lm.client != nil
+}
+
 // NewDistributedLock creates a new distributed lock
 func NewDistributedLock(client *redis.Client, resourceID string, ttl time.Duration) *DistributedLock {
 	return &DistributedLock{
@@ -53,17 +89,63 @@ func (lock *DistributedLock) Acquire(ctx context.Context) (bool, error) {
 		return false, fmt.Errorf("failed to acquire lock: %w", err)
 	}
 	
-	lock.acquired = success
+	lock.setAcquired(success)
 	if success {
 		log.Printf("AUDIT: Distributed lock acquired for resource %s, token %s, TTL %v", 
 			lock.key, lock.value[:8], lock.ttl)
 	} else {
 		log.Printf("INFO: Lock acquisition failed for resource %s - already held", lock.key)
+		telemetry.LockContention.WithLabelValues(lockResourceKind(lock.key)).Inc()
 	}
 	
 	return success, nil
 }
 
+// setAcquired records whether the lock is held and keeps heldLocks in step
+func (lock *DistributedLock) setAcquired(held bool) {
+	lock.mu.Lock()
+	lock.acquired = held
+	lock.mu.Unlock()
+	if held {
+		heldLocks.Store(lock, struct{}{})
+	} else {
+		heldLocks.Delete(lock)
+	}
+}
+
+func (lock *DistributedLock) isAcquired() bool {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	return lock.acquired
+}
+
+// ReleaseHeldLocks releases every lock this process still holds. It is called during
+// shutdown once in-flight requests have drained or the drain deadline has passed, and
+// returns the number of locks released.
+func ReleaseHeldLocks(ctx context.Context) int {
+	released := 0
+	heldLocks.Range(func(key, _ interface{}) bool {
+		lock := key.(*DistributedLock)
+		if err := lock.Release(ctx); err != nil {
+			log.Printf("WARNING: Failed to release lock %s during shutdown: %v", lock.key, err)
+			return ctx.Err() == nil
+		}
+		released++
+		return true
+	})
+	return released
+}
+
+// lockResourceKind returns the resource prefix of a lock key ("lock:pdf-gen:<id>" is
+// "pdf-gen") so the contention metric is not labelled per resource
+func lockResourceKind(key string) string {
+	kind := strings.TrimPrefix(key, "lock:")
+	if i := strings.Index(kind, ":"); i >= 0 {
+		kind = kind[:i]
+	}
+	return kind
+}
+
 // AcquireWithTimeout attempts to acquire lock with retry logic
 func (lock *DistributedLock) AcquireWithTimeout(ctx context.Context, timeout time.Duration) (bool, error) {
 	deadline := time.Now().Add(timeout)
@@ -101,20 +183,10 @@ func (lock *DistributedLock) Release(ctx context.Context) error {
 		return fmt.Errorf("redis client not available")
 	}
 	
-	if !lock.acquired {
+	if !lock.isAcquired() {
 		return nil // Already released or never acquired
 	}
 	
-	// Lua script ensures only the lock owner can release
-	// This prevents accidentally releasing someone else's lock
-	releaseScript := `
-		if redis.call("get", KEYS[1]) == ARGV[1] then
-			return redis.call("del", KEYS[1])
-		else
-			return 0
-		end
-	`
-	
 	result, err := lock.client.Eval(ctx, releaseScript, []string{lock.key}, lock.value).Result()
 	if err != nil {
 		return fmt.Errorf("failed to release lock: %w", err)
@@ -123,7 +195,7 @@ func (lock *DistributedLock) Release(ctx context.Context) error {
 	if result.(int64) == 1 {
 		log.Printf("AUDIT: Distributed lock released for resource %s, token %s", 
 			lock.key, lock.value[:8])
-		lock.acquired = false
+		lock.setAcquired(false)
 	} else {
 		log.Printf("WARNING: Lock release failed - lock not owned by this token: %s (token %s)", 
 			lock.key, lock.value[:8])
@@ -138,19 +210,10 @@ func (lock *DistributedLock) Extend(ctx context.Context, additionalTTL time.Dura
 		return fmt.Errorf("redis client not available")
 	}
 	
-	if !lock.acquired {
+	if !lock.isAcquired() {
 		return fmt.Errorf("cannot extend unacquired lock")
 	}
 	
-	// Lua script ensures only the lock owner can extend TTL
-	extendScript := `
-		if redis.call("get", KEYS[1]) == ARGV[1] then
-			return redis.call("expire", KEYS[1], ARGV[2])
-		else
-			return 0
-		end
-	`
-	
 	result, err := lock.client.Eval(ctx, extendScript, []string{lock.key}, 
 		lock.value, int(additionalTTL.Seconds())).Result()
 	if err != nil {
@@ -158,7 +221,7 @@ func (lock *DistributedLock) Extend(ctx context.Context, additionalTTL time.Dura
 	}
 	
 	if result.(int64) == 0 {
-		lock.acquired = false // Lock was lost
+		lock.setAcquired(false) // Lock was lost
 		return fmt.Errorf("lock no longer owned by this token")
 	}
 	
@@ -168,13 +231,13 @@ func (lock *DistributedLock) Extend(ctx context.Context, additionalTTL time.Dura
 
 // IsHeld checks if the lock is currently held by this instance
 func (lock *DistributedLock) IsHeld(ctx context.Context) (bool, error) {
-	if lock.client == nil || !lock.acquired {
+	if lock.client == nil || !lock.isAcquired() {
 		return false, nil
 	}
 	
 	currentValue, err := lock.client.Get(ctx, lock.key).Result()
 	if err == redis.Nil {
-		lock.acquired = false
+		lock.setAcquired(false)
 		return false, nil
 	} else if err != nil {
 		return false, fmt.Errorf("failed to check lock status: %w", err)
@@ -182,7 +245,7 @@ func (lock *DistributedLock) IsHeld(ctx context.Context) (bool, error) {
 	
 	isHeld := currentValue == lock.value
 	if !isHeld {
-		lock.acquired = false
+		lock.setAcquired(false)
 	}
 	
 	return isHeld, nil
@@ -220,20 +283,123 @@ func (lm *LockManager) AcquirePDFLock(ctx context.Context, responseID string) (*
 	return lock, nil
 }
 
-// AcquireFormLock acquires a lock for form editing
-func (lm *LockManager) AcquireFormLock(ctx context.Context, formID string) (*DistributedLock, error) {
-	lock := NewDistributedLock(lm.client, fmt.Sprintf("form-edit:%s", formID), 2*time.Minute)
-	
-	acquired, err := lock.AcquireWithTimeout(ctx, 5*time.Second) // Wait up to 5 seconds
+// Form editing leases outlive the request that takes them, so unlike DistributedLock they
+// are not released at shutdown. The lease is stored under the form's lock key, which keeps
+// the lock status and force-release admin commands working for it. Its value is
+// "<user>:<random>": the user part tells others who is editing, and the whole value is the
+// holder's token.
+const formLeaseTTL = 2 * time.Minute
+
+// ErrFormLeaseHeld is returned when another user holds the editing lease on a form
+var ErrFormLeaseHeld = errors.New("form is being edited by another user")
+
+// ErrFormLeaseLost is returned when a lease expired or was taken over before it was renewed
+var ErrFormLeaseLost = errors.New("editing lease is no longer held")
+
+// acquireLeaseScript takes the lease when it is free or already held by the same user, and
+// otherwise returns the current holder's value
+const acquireLeaseScript = `
+	local current = redis.call("get", KEYS[1])
+	if not current or string.sub(current, 1, string.len(ARGV[2])) == ARGV[2] then
+		redis.call("set", KEYS[1], ARGV[1], "EX", ARGV[3])
+		return 1
+	end
+	return current
+`
+
+func formLeaseKey(formID string) string {
+	return fmt.Sprintf("lock:form-edit:%s", formID)
+}
+
+// AcquireFormLock takes the editing lease on a form for userID. A user who already holds
+// it, from another tab say, gets a fresh token and the old one stops working. When someone
+// else holds it, the returned lease describes them and the error is ErrFormLeaseHeld.
+func (lm *LockManager) AcquireFormLock(ctx context.Context, formID, userID string) (*data.FormLease, error) {
+	if lm.client == nil {
+		return nil, fmt.Errorf("redis client not available")
+	}
+
+	token := fmt.Sprintf("%s:%s", userID, uuid.New().String())
+	result, err := lm.client.Eval(ctx, acquireLeaseScript, []string{formLeaseKey(formID)},
+		token, userID+":", int(formLeaseTTL.Seconds())).Result()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to acquire form lease: %w", err)
 	}
-	
-	if !acquired {
-		return nil, fmt.Errorf("form editing lock timeout for form %s", formID)
+	if _, held := result.(string); held {
+		telemetry.LockContention.WithLabelValues("form-edit").Inc()
+		holder, err := lm.FormLockHolder(ctx, formID)
+		if err != nil {
+			return nil, err
+		}
+		return holder, ErrFormLeaseHeld
 	}
-	
-	return lock, nil
+
+	log.Printf("AUDIT: Form editing lease acquired for form %s by %s", formID, userID)
+	return &data.FormLease{FormID: formID, UserID: userID, Token: token, ExpiresAt: time.Now().UTC().Add(formLeaseTTL)}, nil
+}
+
+// RenewFormLock extends the holder's editing lease by the lease TTL. The builder calls it
+// as a heartbeat while the form stays open.
+func (lm *LockManager) RenewFormLock(ctx context.Context, formID, token string) (*data.FormLease, error) {
+	if lm.client == nil {
+		return nil, fmt.Errorf("redis client not available")
+	}
+
+	result, err := lm.client.Eval(ctx, extendScript, []string{formLeaseKey(formID)}, token, int(formLeaseTTL.Seconds())).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew form lease: %w", err)
+	}
+	if result.(int64) == 0 {
+		return nil, ErrFormLeaseLost
+	}
+	return &data.FormLease{FormID: formID, UserID: leaseUser(token), Token: token, ExpiresAt: time.Now().UTC().Add(formLeaseTTL)}, nil
+}
+
+// ReleaseFormLock gives up an editing lease. Releasing a lease that already expired or
+// was taken over is a no-op.
+func (lm *LockManager) ReleaseFormLock(ctx context.Context, formID, token string) error {
+	if lm.client == nil {
+		return fmt.Errorf("redis client not available")
+	}
+
+	result, err := lm.client.Eval(ctx, releaseScript, []string{formLeaseKey(formID)}, token).Result()
+	if err != nil {
+		return fmt.Errorf("failed to release form lease: %w", err)
+	}
+	if result.(int64) == 1 {
+		log.Printf("AUDIT: Form editing lease released for form %s by %s", formID, leaseUser(token))
+	}
+	return nil
+}
+
+// FormLockHolder describes who holds the editing lease on a form, without their token. It
+// returns nil when nobody does.
+func (lm *LockManager) FormLockHolder(ctx context.Context, formID string) (*data.FormLease, error) {
+	if lm.client == nil {
+		return nil, fmt.Errorf("redis client not available")
+	}
+
+	key := formLeaseKey(formID)
+	value, err := lm.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read form lease: %w", err)
+	}
+	ttl, err := lm.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read form lease: %w", err)
+	}
+	return &data.FormLease{FormID: formID, UserID: leaseUser(value), ExpiresAt: time.Now().UTC().Add(ttl)}, nil
+}
+
+// leaseUser returns the user part of a lease value
+func leaseUser(value string) string {
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		return value[:i]
+	}
+	return ""
 }
 
 // CleanupExpiredLocks removes expired lock entries (maintenance function)
@@ -301,4 +467,25 @@ func (lm *LockManager) GetLockStatus(ctx context.Context) (map[string]interface{
 	lockInfo["total_active"] = len(activeLocks)
 	
 	return lockInfo, nil
-}
\ No newline at end of file
+}
+// ForceRelease deletes a lock whoever holds it, for locks left behind by a crashed
+// instance. resource may be given with or without the "lock:" prefix. It reports whether
+// a lock was removed.
+func (lm *LockManager) ForceRelease(ctx context.Context, resource string) (bool, error) {
+	if lm.client == nil {
+		return false, fmt.Errorf("redis client not available")
+	}
+
+	key := resource
+	if !strings.HasPrefix(key, "lock:") {
+		key = "lock:" + key
+	}
+	removed, err := lm.client.Del(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to release lock: %w", err)
+	}
+	if removed > 0 {
+		log.Printf("AUDIT: Distributed lock %s force-released", key)
+	}
+	return removed > 0, nil
+}
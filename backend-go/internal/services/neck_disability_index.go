@@ -159,7 +159,7 @@ func NeckDisabilityRenderer(metadata PatternMetadata, context *PDFContext) (stri
 	var signatureData string
 	for _, fieldName := range possibleSignatureFields {
 		if value, exists := context.Answers[fieldName]; exists {
-			if sigStr, ok := value.(string); ok && strings.HasPrefix(sigStr, "data:image/") {
+			if sigStr, ok := context.imageAnswer(value); ok {
 				signatureData = sigStr
 				break
 			}
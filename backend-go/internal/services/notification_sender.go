@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Notification channels supported by reminder delivery
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Notification is a single outbound message to a patient.
+// Bodies must never contain PHI beyond what the patient already knows (e.g. their own link).
+type Notification struct {
+	Channel  string
+	To       string
+	Subject  string
+	Body     string
+	Metadata map[string]string
+}
+
+// NotificationSender delivers email/SMS notifications.
+// Implementations must be safe for concurrent use.
+type NotificationSender interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// LogNotificationSender is a local stand-in that writes notifications to the log
+// instead of delivering them. Recipients are masked.
+type LogNotificationSender struct{}
+
+// NewNotificationSender returns the sender for the configured provider.
+// Only the "log" provider ships in-tree; real providers plug in behind the same interface.
+func NewNotificationSender(provider string) (NotificationSender, error) {
+	switch provider {
+	case "", "log":
+		return &LogNotificationSender{}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification provider: %s", provider)
+	}
+}
+
+// Send logs the notification without delivering it
+func (s *LogNotificationSender) Send(ctx context.Context, n Notification) error {
+	if n.Channel != ChannelEmail && n.Channel != ChannelSMS {
+		return fmt.Errorf("unsupported notification channel: %s", n.Channel)
+	}
+	if n.To == "" {
+		return fmt.Errorf("notification recipient is empty")
+	}
+	log.Printf("NOTIFICATION [%s] to=%s subject=%q body_length=%d", n.Channel, MaskRecipient(n.To), n.Subject, len(n.Body))
+	return nil
+}
+
+// MaskRecipient hides most of an email address or phone number for logs and audit records
+func MaskRecipient(recipient string) string {
+	if at := strings.Index(recipient, "@"); at > 0 {
+		return recipient[:1] + "***" + recipient[at:]
+	}
+	if len(recipient) > 4 {
+		return strings.Repeat("*", len(recipient)-4) + recipient[len(recipient)-4:]
+	}
+	return "****"
+}
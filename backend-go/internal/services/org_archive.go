@@ -0,0 +1,446 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// An organization archive is a zip of JSON documents and attachment blobs. manifest.json
+// names the format and version and lists every other file with its SHA-256, so a
+// damaged or altered archive is rejected before anything is restored. With a passphrase
+// the zip is sealed with AES-256-GCM under a scrypt-derived key, behind a short header.
+const (
+	OrgArchiveFormat  = "healthcare-forms/organization-archive"
+	OrgArchiveVersion = 1
+
+	orgArchiveMagic    = "HFORGARC"
+	orgArchiveSaltSize = 16
+	maxOrgArchiveBytes = 1 << 30 // uncompressed, across all files
+)
+
+// minArchivePassphrase is the shortest passphrase a backup is sealed with
+const minArchivePassphrase = 12
+
+// scrypt cost parameters for archive passphrases (N=2^15, r=8, p=1)
+const (
+	archiveScryptN = 1 << 15
+	archiveScryptR = 8
+	archiveScryptP = 1
+)
+
+// ErrInvalidArchive is returned for archives that are malformed, damaged or inconsistent
+var ErrInvalidArchive = errors.New("invalid organization archive")
+
+// ErrArchivePassphrase is returned when an encrypted archive is opened without the right passphrase
+var ErrArchivePassphrase = errors.New("archive passphrase is missing or wrong")
+
+// ErrArchivePassphraseRequired is returned when a backup is requested without a usable
+// passphrase. Backups hold every response in plaintext once opened, so they are always sealed.
+var ErrArchivePassphraseRequired = fmt.Errorf("a passphrase of at least %d characters is required to encrypt the backup", minArchivePassphrase)
+
+// OrgArchiveManifest is the manifest.json of an organization archive
+type OrgArchiveManifest struct {
+	Format         string                `json:"format"`
+	Version        int                   `json:"version"`
+	OrganizationID string                `json:"organization_id"`
+	CreatedAt      time.Time             `json:"created_at"`
+	CreatedBy      string                `json:"created_by"`
+	Counts         map[string]int        `json:"counts"`
+	Files          []ExportManifestEntry `json:"files"`
+}
+
+// archivedShareLink keeps the password hash the API never serializes
+type archivedShareLink struct {
+	data.ShareLink
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// orgArchiveContents is an archive held in memory. Responses carry their PHI in plaintext;
+// it is sealed again with the target organization's key on restore.
+type orgArchiveContents struct {
+	Manifest     OrgArchiveManifest
+	Organization *data.Organization
+	Forms        []data.Form
+	ShareLinks   []archivedShareLink
+	Responses    []data.FormResponse
+	Attachments  []data.Attachment
+	Blobs        map[string][]byte // attachment ID -> content
+}
+
+// documents maps each JSON file of the archive to the field it fills
+func (c *orgArchiveContents) documents() []struct {
+	path  string
+	value interface{}
+} {
+	return []struct {
+		path  string
+		value interface{}
+	}{
+		{"organization.json", &c.Organization},
+		{"forms.json", &c.Forms},
+		{"share_links.json", &c.ShareLinks},
+		{"responses.json", &c.Responses},
+		{"attachments.json", &c.Attachments},
+	}
+}
+
+// counts returns the number of records of each kind
+func (c *orgArchiveContents) counts() map[string]int {
+	counts := map[string]int{
+		"forms":       len(c.Forms),
+		"share_links": len(c.ShareLinks),
+		"responses":   len(c.Responses),
+		"attachments": len(c.Attachments),
+	}
+	if c.Organization != nil {
+		counts["organization"] = 1
+	}
+	return counts
+}
+
+// encode writes the archive, sealing it when passphrase is set
+func (c *orgArchiveContents) encode(passphrase string) ([]byte, error) {
+	archive := &exportArchive{}
+	archive.zw = zip.NewWriter(&archive.buf)
+
+	for _, doc := range c.documents() {
+		content, err := json.MarshalIndent(doc.value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := archive.add(doc.path, "application/json", content); err != nil {
+			return nil, err
+		}
+	}
+	for _, record := range c.Attachments {
+		if err := archive.add("attachments/"+record.ID, record.ContentType, c.Blobs[record.ID]); err != nil {
+			return nil, err
+		}
+	}
+
+	c.Manifest.Format = OrgArchiveFormat
+	c.Manifest.Version = OrgArchiveVersion
+	c.Manifest.Counts = c.counts()
+	c.Manifest.Files = archive.entries
+	manifest, err := json.MarshalIndent(c.Manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	w, err := archive.zw.Create("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if passphrase == "" {
+		return archive.buf.Bytes(), nil
+	}
+	return sealOrgArchive(archive.buf.Bytes(), passphrase)
+}
+
+// decodeOrgArchive opens an archive and checks every file against the manifest
+func decodeOrgArchive(raw []byte, passphrase string) (*orgArchiveContents, error) {
+	if IsEncryptedOrgArchive(raw) {
+		var err error
+		if raw, err = openOrgArchive(raw, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip file", ErrInvalidArchive)
+	}
+	files := map[string][]byte{}
+	var total int64
+	for _, f := range zr.File {
+		if f.Name != path.Clean(f.Name) || strings.HasPrefix(f.Name, "/") || strings.HasPrefix(f.Name, "..") {
+			return nil, fmt.Errorf("%w: unsafe path %q", ErrInvalidArchive, f.Name)
+		}
+		if _, dup := files[f.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate file %q", ErrInvalidArchive, f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxOrgArchiveBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+		}
+		if total += int64(len(content)); total > maxOrgArchiveBytes {
+			return nil, fmt.Errorf("%w: larger than %d bytes uncompressed", ErrInvalidArchive, maxOrgArchiveBytes)
+		}
+		files[f.Name] = content
+	}
+
+	c := &orgArchiveContents{Blobs: map[string][]byte{}}
+	manifest, ok := files["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("%w: manifest.json is missing", ErrInvalidArchive)
+	}
+	if err := json.Unmarshal(manifest, &c.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: manifest.json: %v", ErrInvalidArchive, err)
+	}
+	if c.Manifest.Format != OrgArchiveFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidArchive, c.Manifest.Format)
+	}
+	if c.Manifest.Version < 1 || c.Manifest.Version > OrgArchiveVersion {
+		return nil, fmt.Errorf("%w: version %d is not supported (up to %d)", ErrInvalidArchive, c.Manifest.Version, OrgArchiveVersion)
+	}
+
+	listed := map[string]bool{"manifest.json": true}
+	for _, entry := range c.Manifest.Files {
+		content, ok := files[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is listed but missing", ErrInvalidArchive, entry.Path)
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != entry.SHA256 || len(content) != entry.Size {
+			return nil, fmt.Errorf("%w: %s does not match its checksum", ErrInvalidArchive, entry.Path)
+		}
+		listed[entry.Path] = true
+	}
+	for name := range files {
+		if !listed[name] {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrInvalidArchive, name)
+		}
+	}
+
+	for _, doc := range c.documents() {
+		content, ok := files[doc.path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, doc.path)
+		}
+		if err := json.Unmarshal(content, doc.value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, doc.path, err)
+		}
+	}
+	for name, content := range files {
+		if id, ok := strings.CutPrefix(name, "attachments/"); ok {
+			c.Blobs[id] = content
+		}
+	}
+	return c, nil
+}
+
+// validate checks the references between records. Problems that make the archive unsafe
+// to restore are returned as an error; references to forms that were deleted before the
+// backup are legitimate and come back as warnings.
+func (c *orgArchiveContents) validate() ([]string, error) {
+	var problems []string
+	var warnings []string
+	orgID := c.Manifest.OrganizationID
+
+	ids := func(kind string, list []string) map[string]bool {
+		seen := map[string]bool{}
+		for _, id := range list {
+			if id == "" {
+				problems = append(problems, fmt.Sprintf("a record in %s has no ID", kind))
+			} else if seen[id] {
+				problems = append(problems, fmt.Sprintf("%s %s appears twice", kind, id))
+			}
+			seen[id] = true
+		}
+		return seen
+	}
+	owned := func(kind, id, owner string) {
+		if owner != orgID {
+			problems = append(problems, fmt.Sprintf("%s %s belongs to organization %q, not %q", kind, id, owner, orgID))
+		}
+	}
+
+	formIDs := make([]string, 0, len(c.Forms))
+	for _, form := range c.Forms {
+		formIDs = append(formIDs, form.ID)
+		owned("form", form.ID, form.OrganizationID)
+	}
+	forms := ids("forms", formIDs)
+
+	linkIDs := make([]string, 0, len(c.ShareLinks))
+	for _, link := range c.ShareLinks {
+		linkIDs = append(linkIDs, link.ID)
+		owned("share link", link.ID, link.OrganizationID)
+		if !forms[link.FormID] {
+			warnings = append(warnings, fmt.Sprintf("share link %s points to form %s, which is not in the archive; it will be skipped", link.ID, link.FormID))
+		}
+	}
+	ids("share_links", linkIDs)
+
+	attachmentIDs := make([]string, 0, len(c.Attachments))
+	for _, record := range c.Attachments {
+		attachmentIDs = append(attachmentIDs, record.ID)
+	}
+	attachments := ids("attachments", attachmentIDs)
+
+	responseIDs := make([]string, 0, len(c.Responses))
+	for _, response := range c.Responses {
+		responseIDs = append(responseIDs, response.ID)
+		owned("response", response.ID, response.OrganizationID)
+		if !forms[response.FormID] {
+			warnings = append(warnings, fmt.Sprintf("response %s was submitted to form %s, which is not in the archive; it will be restored without a form", response.ID, response.FormID))
+		}
+		for _, ref := range attachmentRefs(response.Data) {
+			if !attachments[AttachmentRefID(ref)] {
+				warnings = append(warnings, fmt.Sprintf("response %s refers to attachment %s, which is not in the archive", response.ID, AttachmentRefID(ref)))
+			}
+		}
+	}
+	responses := ids("responses", responseIDs)
+
+	for _, record := range c.Attachments {
+		owned("attachment", record.ID, record.OrganizationID)
+		if !responses[record.ResponseID] {
+			problems = append(problems, fmt.Sprintf("attachment %s belongs to response %s, which is not in the archive", record.ID, record.ResponseID))
+		}
+		content, ok := c.Blobs[record.ID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("attachment %s has no content", record.ID))
+			continue
+		}
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != record.SHA256 {
+			problems = append(problems, fmt.Sprintf("attachment %s content does not match its record", record.ID))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return warnings, fmt.Errorf("%w: %s", ErrInvalidArchive, strings.Join(problems, "; "))
+	}
+	return warnings, nil
+}
+
+// attachmentRefs lists the attachment references in a response's answers
+func attachmentRefs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if IsAttachmentRef(v) {
+			return []string{v}
+		}
+	case map[string]interface{}:
+		var refs []string
+		for _, key := range sortedKeys(v) {
+			refs = append(refs, attachmentRefs(v[key])...)
+		}
+		return refs
+	case []interface{}:
+		var refs []string
+		for _, nested := range v {
+			refs = append(refs, attachmentRefs(nested)...)
+		}
+		return refs
+	}
+	return nil
+}
+
+// remapAttachmentRefs rewrites attachment references in answers to their new IDs
+func remapAttachmentRefs(value interface{}, ids map[string]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		if IsAttachmentRef(v) {
+			if id, ok := ids[AttachmentRefID(v)]; ok {
+				return AttachmentRefPrefix + id
+			}
+		}
+		return v
+	case map[string]interface{}:
+		remapped := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			remapped[key] = remapAttachmentRefs(nested, ids)
+		}
+		return remapped
+	case []interface{}:
+		remapped := make([]interface{}, len(v))
+		for i, nested := range v {
+			remapped[i] = remapAttachmentRefs(nested, ids)
+		}
+		return remapped
+	default:
+		return value
+	}
+}
+
+// IsEncryptedOrgArchive reports whether raw is a passphrase-sealed archive
+func IsEncryptedOrgArchive(raw []byte) bool {
+	return bytes.HasPrefix(raw, []byte(orgArchiveMagic))
+}
+
+// sealOrgArchive encrypts an archive as magic || salt || nonce || AES-GCM(zip). The
+// header is authenticated along with the ciphertext.
+func sealOrgArchive(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, orgArchiveSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := archiveCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte(orgArchiveMagic), salt...), nonce...)
+	return gcm.Seal(append([]byte(nil), header...), nonce, plaintext, header), nil
+}
+
+func openOrgArchive(sealed []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrArchivePassphrase
+	}
+	saltEnd := len(orgArchiveMagic) + orgArchiveSaltSize
+	if len(sealed) < saltEnd {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidArchive)
+	}
+	gcm, err := archiveCipher(passphrase, sealed[len(orgArchiveMagic):saltEnd])
+	if err != nil {
+		return nil, err
+	}
+	headerEnd := saltEnd + gcm.NonceSize()
+	if len(sealed) < headerEnd+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidArchive)
+	}
+	plaintext, err := gcm.Open(nil, sealed[saltEnd:headerEnd], sealed[headerEnd:], sealed[:headerEnd])
+	if err != nil {
+		// A wrong passphrase and a damaged file look the same to GCM
+		return nil, ErrArchivePassphrase
+	}
+	return plaintext, nil
+}
+
+func archiveCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, archiveScryptN, archiveScryptR, archiveScryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
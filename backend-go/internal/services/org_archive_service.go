@@ -0,0 +1,827 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Organization archive job kinds and states
+const (
+	ArchiveBackup  = "backup"
+	ArchiveRestore = "restore"
+
+	ArchiveQueued    = "queued"
+	ArchiveRunning   = "running"
+	ArchiveCompleted = "completed"
+	ArchiveFailed    = "failed"
+	ArchiveExpired   = "expired"
+)
+
+const (
+	orgArchiveCollection   = "org_archive_jobs"
+	orgArchiveLockTTL      = 30 * time.Minute
+	orgArchiveStaleAfter   = 30 * time.Minute
+	orgArchiveRetention    = 7 * 24 * time.Hour
+	orgArchivePollInterval = time.Minute
+	// restoreChunkSize keeps each restore transaction under Firestore's 500-write limit
+	restoreChunkSize = 400
+)
+
+// ErrArchiveJobNotFound is returned for unknown jobs and jobs of another organization
+var ErrArchiveJobNotFound = errors.New("archive job not found")
+
+// ErrArchiveNotReady is returned when a backup is downloaded before it has been built
+var ErrArchiveNotReady = errors.New("backup is not ready")
+
+// errArchiveJobSkipped aborts a claim when another worker already moved the job on
+var errArchiveJobSkipped = errors.New("archive job state changed")
+
+// OrgArchiveService backs up a whole organization to a portable archive and restores
+// archives into an organization, as background jobs. Backups stay in the blob store for
+// seven days. Restores create every record under a new ID, so an archive can be restored
+// into the organization it came from, into another one, or into another project.
+type OrgArchiveService struct {
+	client      *firestore.Client
+	rdb         *redis.Client
+	store       BlobStore
+	encryptor   *FieldEncryptor
+	sanitizer   *UploadSanitizer
+	auditLogger *AuditTrail
+	interval    time.Duration
+	wake        chan struct{}
+}
+
+// NewOrgArchiveService creates a new organization archive service
+func NewOrgArchiveService(client *firestore.Client, rdb *redis.Client, store BlobStore, encryptor *FieldEncryptor, sanitizer *UploadSanitizer, auditLogger *AuditTrail) *OrgArchiveService {
+	return &OrgArchiveService{
+		client:      client,
+		rdb:         rdb,
+		store:       store,
+		encryptor:   encryptor,
+		sanitizer:   sanitizer,
+		auditLogger: auditLogger,
+		interval:    orgArchivePollInterval,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// RequestBackup queues a backup of the organization. The archive is encrypted with the
+// passphrase, which is needed again to restore it.
+func (s *OrgArchiveService) RequestBackup(ctx context.Context, orgID, userID, passphrase string) (*data.OrgArchiveJob, error) {
+	if len(passphrase) < minArchivePassphrase {
+		return nil, ErrArchivePassphraseRequired
+	}
+	return s.queue(ctx, data.OrgArchiveJob{
+		OrganizationID: orgID,
+		Kind:           ArchiveBackup,
+		RequestedBy:    userID,
+		Encrypted:      true,
+	}, passphrase, nil)
+}
+
+// RequestRestore stores an uploaded archive and queues its restore into the organization.
+// The archive is checked before the job is queued, so a damaged file or a wrong passphrase
+// is reported to the caller straight away.
+func (s *OrgArchiveService) RequestRestore(ctx context.Context, orgID, userID string, archive []byte, passphrase string, dryRun bool) (*data.OrgArchiveJob, error) {
+	contents, err := decodeOrgArchive(archive, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return s.queue(ctx, data.OrgArchiveJob{
+		OrganizationID:       orgID,
+		Kind:                 ArchiveRestore,
+		RequestedBy:          userID,
+		DryRun:               dryRun,
+		Encrypted:            IsEncryptedOrgArchive(archive),
+		SourceOrganizationID: contents.Manifest.OrganizationID,
+		Counts:               contents.counts(),
+	}, passphrase, archive)
+}
+
+func (s *OrgArchiveService) queue(ctx context.Context, job data.OrgArchiveJob, passphrase string, upload []byte) (*data.OrgArchiveJob, error) {
+	ref := s.client.Collection(orgArchiveCollection).NewDoc()
+	if passphrase != "" {
+		sealed, err := s.encryptor.Seal(ctx, job.OrganizationID, orgArchiveCollection+"/"+ref.ID, []byte(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		job.SealedPassphrase = sealed
+	}
+	if upload != nil {
+		// An upload may be a plaintext archive; it waits for the worker sealed with the
+		// organization's data key
+		job.StorageKey = fmt.Sprintf("org-archives/%s/%s-upload", job.OrganizationID, ref.ID)
+		sealed, err := s.encryptor.SealBlob(ctx, job.OrganizationID, job.StorageKey, upload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt archive: %w", err)
+		}
+		if err := s.store.Put(ctx, job.StorageKey, "application/octet-stream", sealed); err != nil {
+			return nil, fmt.Errorf("failed to store archive: %w", err)
+		}
+		job.UploadSealed = true
+		sum := sha256.Sum256(upload)
+		job.Size = int64(len(upload))
+		job.SHA256 = hex.EncodeToString(sum[:])
+	}
+
+	job.RequestID = logging.RequestID(ctx)
+	job.Status = ArchiveQueued
+	job.Progress = data.OrgArchiveProgress{Phase: ArchiveQueued}
+	job.CreatedAt = time.Now().UTC()
+	if _, err := ref.Create(ctx, job); err != nil {
+		if upload != nil {
+			s.store.Delete(context.Background(), job.StorageKey)
+		}
+		return nil, err
+	}
+	job.ID = ref.ID
+	s.auditJob(ctx, &job, "REQUESTED", "")
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return &job, nil
+}
+
+// Get returns a job owned by the organization
+func (s *OrgArchiveService) Get(ctx context.Context, orgID, jobID string) (*data.OrgArchiveJob, error) {
+	doc, err := s.client.Collection(orgArchiveCollection).Doc(jobID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrArchiveJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	job, err := archiveJobFromDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	if job.OrganizationID != orgID {
+		return nil, ErrArchiveJobNotFound
+	}
+	return job, nil
+}
+
+// Download returns a completed backup's archive after checking it against the stored checksum
+func (s *OrgArchiveService) Download(ctx context.Context, orgID, jobID string) (*data.OrgArchiveJob, []byte, error) {
+	job, err := s.Get(ctx, orgID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Kind != ArchiveBackup {
+		return nil, nil, ErrArchiveJobNotFound
+	}
+	if job.Status != ArchiveCompleted {
+		return nil, nil, ErrArchiveNotReady
+	}
+	content, err := s.store.Get(ctx, job.StorageKey)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, nil, ErrArchiveJobNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != job.SHA256 {
+		return nil, nil, fmt.Errorf("backup %s archive checksum mismatch", job.ID)
+	}
+	s.auditJob(ctx, job, "DOWNLOADED", "")
+	return job, content, nil
+}
+
+// Start runs the archive worker until ctx is cancelled
+func (s *OrgArchiveService) Start(ctx context.Context) {
+	logging.FromContext(ctx).Info("ARCHIVE: worker started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			logging.FromContext(ctx).Info("ARCHIVE: worker stopped")
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// RunOnce processes queued and stalled jobs and deletes expired backups
+func (s *OrgArchiveService) RunOnce(ctx context.Context) {
+	staleBefore := time.Now().Add(-orgArchiveStaleAfter)
+	queries := []firestore.Query{
+		s.client.Collection(orgArchiveCollection).Where("status", "==", ArchiveQueued).Limit(10),
+		s.client.Collection(orgArchiveCollection).Where("status", "==", ArchiveRunning).Where("started_at", "<", staleBefore).Limit(10),
+	}
+	for _, query := range queries {
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			logging.FromContext(ctx).Error("ARCHIVE: failed to list pending jobs", "error", err)
+			continue
+		}
+		for _, doc := range docs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.Process(ctx, doc.Ref.ID); err != nil && !errors.Is(err, errArchiveJobSkipped) {
+				logging.FromContext(ctx).Error("ARCHIVE: job failed", "job_id", doc.Ref.ID, "error", err)
+			}
+		}
+	}
+
+	if err := s.expireBackups(ctx); err != nil {
+		logging.FromContext(ctx).Error("ARCHIVE: failed to expire backups", "error", err)
+	}
+}
+
+// Process claims one queued job and runs it to completion. The worker calls it for every
+// queued job; cmd/admin calls it directly so a job runs in the foreground.
+func (s *OrgArchiveService) Process(ctx context.Context, jobID string) error {
+	if s.rdb != nil {
+		lock := NewDistributedLock(s.rdb, "org-archive:"+jobID, orgArchiveLockTTL)
+		acquired, err := lock.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return errArchiveJobSkipped
+		}
+		defer lock.Release(context.Background())
+	}
+
+	ref := s.client.Collection(orgArchiveCollection).Doc(jobID)
+	var job *data.OrgArchiveJob
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		job, err = archiveJobFromDoc(doc)
+		if err != nil {
+			return err
+		}
+		stale := job.Status == ArchiveRunning && job.StartedAt != nil && time.Since(*job.StartedAt) > orgArchiveStaleAfter
+		if job.Status != ArchiveQueued && !stale {
+			return errArchiveJobSkipped
+		}
+		now := time.Now().UTC()
+		job.StartedAt = &now
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: ArchiveRunning},
+			{Path: "started_at", Value: now},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+	logger := logging.FromContext(ctx).With("archive_job_id", job.ID, "kind", job.Kind)
+
+	passphrase := ""
+	if job.SealedPassphrase != "" {
+		plaintext, err := s.encryptor.Open(ctx, job.OrganizationID, orgArchiveCollection+"/"+job.ID, job.SealedPassphrase)
+		if err != nil {
+			return s.finish(ctx, job, nil, err)
+		}
+		passphrase = string(plaintext)
+	}
+
+	var updates []firestore.Update
+	if job.Kind == ArchiveBackup {
+		updates, err = s.backup(ctx, job, passphrase)
+	} else {
+		updates, err = s.restore(ctx, job, passphrase)
+	}
+	if err != nil {
+		logger.Error("ARCHIVE: job failed", "error", err)
+	} else {
+		logger.Info("ARCHIVE: job completed", "counts", job.Counts)
+	}
+	return s.finish(ctx, job, updates, err)
+}
+
+// finish records the outcome and drops the sealed passphrase, which is not needed again
+func (s *OrgArchiveService) finish(ctx context.Context, job *data.OrgArchiveJob, updates []firestore.Update, cause error) error {
+	now := time.Now().UTC()
+	job.CompletedAt = &now
+	job.Status = ArchiveCompleted
+	updates = append(updates,
+		firestore.Update{Path: "sealed_passphrase", Value: firestore.Delete},
+		firestore.Update{Path: "completed_at", Value: now},
+	)
+	if cause != nil {
+		job.Status = ArchiveFailed
+		job.Error = archiveFailureMessage(cause)
+		updates = append(updates, firestore.Update{Path: "error", Value: job.Error})
+	}
+	updates = append(updates, firestore.Update{Path: "status", Value: job.Status})
+
+	_, err := s.client.Collection(orgArchiveCollection).Doc(job.ID).Update(context.WithoutCancel(ctx), updates)
+	if err != nil {
+		logging.FromContext(ctx).Error("ARCHIVE: failed to record the job outcome", "job_id", job.ID, "error", err)
+	}
+	if job.Kind == ArchiveRestore && job.StorageKey != "" {
+		if err := s.store.Delete(context.WithoutCancel(ctx), job.StorageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			logging.FromContext(ctx).Warn("ARCHIVE: failed to delete the uploaded archive", "job_id", job.ID, "error", err)
+		}
+	}
+
+	if cause != nil {
+		s.auditJob(ctx, job, "FAILED", job.Error)
+		return cause
+	}
+	s.auditJob(ctx, job, "COMPLETED", "")
+	return err
+}
+
+// archiveFailureMessage keeps the stored error free of PHI and internal detail
+func archiveFailureMessage(err error) string {
+	if errors.Is(err, ErrInvalidArchive) || errors.Is(err, ErrArchivePassphrase) {
+		return err.Error()
+	}
+	return "archive job could not be completed"
+}
+
+func (s *OrgArchiveService) progress(ctx context.Context, job *data.OrgArchiveJob, phase string, done, total int) {
+	job.Progress = data.OrgArchiveProgress{Phase: phase, Done: done, Total: total}
+	if _, err := s.client.Collection(orgArchiveCollection).Doc(job.ID).Update(ctx, []firestore.Update{
+		{Path: "progress", Value: job.Progress},
+	}); err != nil {
+		logging.FromContext(ctx).Warn("ARCHIVE: failed to record job progress", "job_id", job.ID, "error", err)
+	}
+}
+
+// backup collects the organization's records, writes the archive and stores it
+func (s *OrgArchiveService) backup(ctx context.Context, job *data.OrgArchiveJob, passphrase string) ([]firestore.Update, error) {
+	orgID := job.OrganizationID
+	contents := &orgArchiveContents{
+		Manifest: OrgArchiveManifest{OrganizationID: orgID, CreatedAt: time.Now().UTC(), CreatedBy: job.RequestedBy},
+		Blobs:    map[string][]byte{},
+	}
+
+	s.progress(ctx, job, "organization", 0, 1)
+	org, err := s.loadOrganization(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	contents.Organization = org
+
+	docs, err := s.orgDocuments(ctx, "forms", orgID)
+	if err != nil {
+		return nil, err
+	}
+	s.progress(ctx, job, "forms", 0, len(docs))
+	for _, doc := range docs {
+		var form data.Form
+		if err := doc.DataTo(&form); err != nil {
+			return nil, fmt.Errorf("form %s: %w", doc.Ref.ID, err)
+		}
+		form.ID = doc.Ref.ID
+		contents.Forms = append(contents.Forms, form)
+	}
+
+	if docs, err = s.orgDocuments(ctx, "share_links", orgID); err != nil {
+		return nil, err
+	}
+	s.progress(ctx, job, "share_links", 0, len(docs))
+	for _, doc := range docs {
+		var link data.ShareLink
+		if err := doc.DataTo(&link); err != nil {
+			return nil, fmt.Errorf("share link %s: %w", doc.Ref.ID, err)
+		}
+		link.ID = doc.Ref.ID
+		contents.ShareLinks = append(contents.ShareLinks, archivedShareLink{ShareLink: link, PasswordHash: link.PasswordHash})
+	}
+
+	if docs, err = s.orgDocuments(ctx, "form_responses", orgID); err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if i%100 == 0 {
+			s.progress(ctx, job, "responses", i, len(docs))
+		}
+		response, err := s.encryptor.OpenResponse(ctx, doc)
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %w", doc.Ref.ID, err)
+		}
+		response.Encrypted = nil
+		contents.Responses = append(contents.Responses, *response)
+	}
+
+	if docs, err = s.orgDocuments(ctx, "attachments", orgID); err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if i%50 == 0 {
+			s.progress(ctx, job, "attachments", i, len(docs))
+		}
+		var record data.Attachment
+		if err := doc.DataTo(&record); err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", doc.Ref.ID, err)
+		}
+		record.ID = doc.Ref.ID
+		content, err := readAttachmentBlob(ctx, s.store, s.encryptor, &record)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %s: %w", record.ID, err)
+		}
+		contents.Attachments = append(contents.Attachments, record)
+		contents.Blobs[record.ID] = content
+	}
+
+	s.progress(ctx, job, "writing", 0, 1)
+	archive, err := contents.encode(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("org-archives/%s/%s", orgID, job.ID)
+	if err := s.store.Put(ctx, key, "application/octet-stream", archive); err != nil {
+		return nil, fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	sum := sha256.Sum256(archive)
+	expiresAt := time.Now().UTC().Add(orgArchiveRetention)
+	job.Counts = contents.counts()
+	job.StorageKey = key
+	job.Size = int64(len(archive))
+	job.SHA256 = hex.EncodeToString(sum[:])
+	job.ExpiresAt = &expiresAt
+	s.progress(ctx, job, "done", 1, 1)
+	return []firestore.Update{
+		{Path: "counts", Value: job.Counts},
+		{Path: "storage_key", Value: key},
+		{Path: "size", Value: job.Size},
+		{Path: "sha256", Value: job.SHA256},
+		{Path: "expires_at", Value: expiresAt},
+	}, nil
+}
+
+// loadOrganization merges the organization's documents: clinic info lives on <uid> and
+// settings on org-<uid> where that exists. It returns nil when there is neither.
+func (s *OrgArchiveService) loadOrganization(ctx context.Context, orgID string) (*data.Organization, error) {
+	var org *data.Organization
+	for _, docID := range []string{orgID, "org-" + orgID} {
+		doc, err := s.client.Collection("organizations").Doc(docID).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var loaded data.Organization
+		if err := doc.DataTo(&loaded); err != nil {
+			return nil, fmt.Errorf("organization %s: %w", docID, err)
+		}
+		if org == nil {
+			loaded.ID = orgID
+			org = &loaded
+		} else {
+			org.Settings = loaded.Settings
+		}
+	}
+	return org, nil
+}
+
+func (s *OrgArchiveService) orgDocuments(ctx context.Context, collection, orgID string) ([]*firestore.DocumentSnapshot, error) {
+	docs, err := s.client.Collection(collection).Where("organizationId", "==", orgID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", collection, err)
+	}
+	return docs, nil
+}
+
+// restoreWrite is one document created by a restore
+type restoreWrite struct {
+	ref   *firestore.DocumentRef
+	value interface{}
+}
+
+// restore validates the uploaded archive and, unless the job is a dry run, recreates its
+// records in the job's organization under new IDs. Nothing is written until the whole
+// archive has been validated; if a write fails part-way, the documents already created
+// are deleted again.
+func (s *OrgArchiveService) restore(ctx context.Context, job *data.OrgArchiveJob, passphrase string) ([]firestore.Update, error) {
+	targetOrg := job.OrganizationID
+	s.progress(ctx, job, "validating", 0, 1)
+	raw, err := s.store.Get(ctx, job.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploaded archive: %w", err)
+	}
+	if job.UploadSealed {
+		if raw, err = s.encryptor.OpenBlob(ctx, targetOrg, job.StorageKey, raw); err != nil {
+			return nil, fmt.Errorf("failed to decrypt uploaded archive: %w", err)
+		}
+	}
+	contents, err := decodeOrgArchive(raw, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := contents.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Files in an uploaded archive are as untrusted as any upload: each one goes through the
+	// sanitizer before anything is stored
+	s.progress(ctx, job, "sanitizing", 0, len(contents.Attachments))
+	for i := range contents.Attachments {
+		record := &contents.Attachments[i]
+		clean, report, err := s.sanitizer.Sanitize(ctx, Upload{
+			Data:           contents.Blobs[record.ID],
+			DeclaredType:   record.ContentType,
+			Allowed:        AttachmentUploadTypes,
+			Source:         "org_restore",
+			UserID:         job.RequestedBy,
+			OrganizationID: targetOrg,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: attachment %s: %v", ErrInvalidArchive, record.ID, err)
+		}
+		record.ContentType = report.DetectedType
+		if report.ConvertedTo != "" {
+			record.ContentType = report.ConvertedTo
+		}
+		record.Sanitization = report
+		contents.Blobs[record.ID] = clean
+	}
+
+	// New IDs for every record, and the references between them
+	formIDs := map[string]string{}
+	for _, form := range contents.Forms {
+		formIDs[form.ID] = s.client.Collection("forms").NewDoc().ID
+	}
+	responseIDs := map[string]string{}
+	for _, response := range contents.Responses {
+		responseIDs[response.ID] = s.client.Collection("form_responses").NewDoc().ID
+	}
+	attachmentIDs := map[string]string{}
+	for _, record := range contents.Attachments {
+		attachmentIDs[record.ID] = s.client.Collection("attachments").NewDoc().ID
+	}
+
+	var writes []restoreWrite
+	counts := map[string]int{}
+	now := time.Now().UTC()
+
+	orgRef := s.client.Collection("organizations").Doc(targetOrg)
+	if contents.Organization != nil {
+		if _, err := orgRef.Get(ctx); status.Code(err) == codes.NotFound {
+			org := *contents.Organization
+			org.ID = ""
+			org.UID = targetOrg
+			org.UpdatedAt = now
+			writes = append(writes, restoreWrite{orgRef, org})
+			counts["organization"] = 1
+		} else if err != nil {
+			return nil, err
+		} else {
+			warnings = append(warnings, "the organization already exists; its clinic info and settings were kept")
+		}
+	}
+
+	for _, form := range contents.Forms {
+		newID := formIDs[form.ID]
+		form.ID = ""
+		form.OrganizationID = targetOrg
+		writes = append(writes, restoreWrite{s.client.Collection("forms").Doc(newID), form})
+		counts["forms"]++
+	}
+
+	for _, archived := range contents.ShareLinks {
+		link := archived.ShareLink
+		formID, ok := formIDs[link.FormID]
+		if !ok {
+			continue
+		}
+		// Tokens are the links patients hold, so they are kept unless already in use here
+		existing, err := s.client.Collection("share_links").Where("share_token", "==", link.ShareToken).Limit(1).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(existing) > 0 {
+			token := make([]byte, 32)
+			if _, err := rand.Read(token); err != nil {
+				return nil, err
+			}
+			link.ShareToken = hex.EncodeToString(token)
+			warnings = append(warnings, fmt.Sprintf("share link %s was given a new token because its token is already in use", archived.ID))
+		}
+		link.ID = ""
+		link.FormID = formID
+		link.OrganizationID = targetOrg
+		link.PasswordHash = archived.PasswordHash
+		writes = append(writes, restoreWrite{s.client.Collection("share_links").NewDoc(), link})
+		counts["share_links"]++
+	}
+
+	for _, response := range contents.Responses {
+		newID := responseIDs[response.ID]
+		if formID, ok := formIDs[response.FormID]; ok {
+			response.FormID = formID
+		} else {
+			if response.Metadata == nil {
+				response.Metadata = map[string]interface{}{}
+			}
+			response.Metadata["restored_from_form"] = response.FormID
+			response.FormID = ""
+		}
+		if response.Data != nil {
+			response.Data, _ = remapAttachmentRefs(response.Data, attachmentIDs).(map[string]interface{})
+		}
+		for i := range response.Revisions {
+			for j := range response.Revisions[i].Changes {
+				change := &response.Revisions[i].Changes[j]
+				change.OldValue = remapAttachmentRefs(change.OldValue, attachmentIDs)
+				change.NewValue = remapAttachmentRefs(change.NewValue, attachmentIDs)
+			}
+		}
+		// Duplicate flags and merges link responses by ID, and identity keys are blind
+		// indexes under the source organization's key
+		if response.Duplicate != nil {
+			if of, ok := responseIDs[response.Duplicate.Of]; ok {
+				flag := *response.Duplicate
+				flag.Of = of
+				response.Duplicate = &flag
+			} else {
+				response.Duplicate = nil
+			}
+		}
+		response.MergedInto = responseIDs[response.MergedInto]
+		var mergedFrom []string
+		for _, id := range response.MergedFrom {
+			if newID, ok := responseIDs[id]; ok {
+				mergedFrom = append(mergedFrom, newID)
+			}
+		}
+		response.MergedFrom = mergedFrom
+		response.ID = ""
+		response.OrganizationID = targetOrg
+		if !job.DryRun {
+			if response.IdentityKeys, err = s.encryptor.PatientIdentityKeys(ctx, targetOrg, response.Data); err != nil {
+				return nil, err
+			}
+			if response, err = s.encryptor.SealResponse(ctx, newID, response); err != nil {
+				return nil, err
+			}
+		}
+		writes = append(writes, restoreWrite{s.client.Collection("form_responses").Doc(newID), response})
+		counts["responses"]++
+	}
+
+	var blobKeys []string
+	for _, record := range contents.Attachments {
+		content := contents.Blobs[record.ID]
+		record.OrganizationID = targetOrg
+		if !job.DryRun {
+			if err := writeAttachmentBlob(ctx, s.store, s.encryptor, &record, content); err != nil {
+				return nil, fmt.Errorf("failed to store attachment: %w", err)
+			}
+			blobKeys = append(blobKeys, record.StorageKey)
+		}
+		newID := attachmentIDs[record.ID]
+		record.ID = ""
+		record.FormID = formIDs[record.FormID]
+		record.ResponseID = responseIDs[record.ResponseID]
+		writes = append(writes, restoreWrite{s.client.Collection("attachments").Doc(newID), record})
+		counts["attachments"]++
+	}
+
+	job.Counts = counts
+	job.Warnings = warnings
+	updates := []firestore.Update{
+		{Path: "counts", Value: counts},
+		{Path: "warnings", Value: warnings},
+	}
+	if job.DryRun {
+		s.progress(ctx, job, "done", 1, 1)
+		return updates, nil
+	}
+
+	for start := 0; start < len(writes); start += restoreChunkSize {
+		end := min(start+restoreChunkSize, len(writes))
+		s.progress(ctx, job, "writing", start, len(writes))
+		err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			for _, write := range writes[start:end] {
+				if err := tx.Create(write.ref, write.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			s.rollback(context.WithoutCancel(ctx), writes[:start], blobKeys)
+			return nil, err
+		}
+	}
+
+	if err := InvalidateFormCache(ctx, s.rdb, targetOrg, ""); err != nil {
+		logging.FromContext(ctx).Warn("ARCHIVE: failed to invalidate the form cache", "organization_id", targetOrg, "error", err)
+	}
+	s.progress(ctx, job, "done", len(writes), len(writes))
+	return updates, nil
+}
+
+// rollback deletes the documents a failed restore created and releases its blobs
+func (s *OrgArchiveService) rollback(ctx context.Context, created []restoreWrite, blobKeys []string) {
+	for start := 0; start < len(created); start += restoreChunkSize {
+		end := min(start+restoreChunkSize, len(created))
+		err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			for _, write := range created[start:end] {
+				if err := tx.Delete(write.ref); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("ARCHIVE: rollback of a failed restore is incomplete", "error", err)
+		}
+	}
+	for _, key := range blobKeys {
+		docs, err := s.client.Collection("attachments").Where("storage_key", "==", key).Limit(1).Documents(ctx).GetAll()
+		if err == nil && len(docs) == 0 {
+			s.store.Delete(ctx, key)
+		}
+	}
+}
+
+// expireBackups deletes backup archives past their retention
+func (s *OrgArchiveService) expireBackups(ctx context.Context) error {
+	docs, err := s.client.Collection(orgArchiveCollection).
+		Where("status", "==", ArchiveCompleted).
+		Where("expires_at", "<", time.Now().UTC()).
+		Limit(100).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		job, err := archiveJobFromDoc(doc)
+		if err != nil || job.Kind != ArchiveBackup {
+			continue
+		}
+		if err := s.store.Delete(ctx, job.StorageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			logging.FromContext(ctx).Warn("ARCHIVE: failed to delete backup", "job_id", job.ID, "error", err)
+			continue
+		}
+		if _, err := doc.Ref.Update(ctx, []firestore.Update{{Path: "status", Value: ArchiveExpired}}); err != nil {
+			logging.FromContext(ctx).Warn("ARCHIVE: failed to expire backup", "job_id", job.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *OrgArchiveService) auditJob(ctx context.Context, job *data.OrgArchiveJob, outcome, errorMsg string) {
+	if s.auditLogger == nil {
+		return
+	}
+	metadata := map[string]interface{}{
+		"organization_id": job.OrganizationID,
+		"status":          job.Status,
+		"encrypted":       job.Encrypted,
+	}
+	if job.DryRun {
+		metadata["dry_run"] = true
+	}
+	if job.SourceOrganizationID != "" {
+		metadata["source_organization_id"] = job.SourceOrganizationID
+	}
+	for kind, n := range job.Counts {
+		metadata[kind] = n
+	}
+	s.auditLogger.LogAccess(ctx, AuditEntry{
+		UserID:       job.RequestedBy,
+		Action:       fmt.Sprintf("ORG_%s_%s", map[string]string{ArchiveBackup: "BACKUP", ArchiveRestore: "RESTORE"}[job.Kind], outcome),
+		ResourceType: "org_archive_job",
+		ResourceID:   job.ID,
+		Metadata:     metadata,
+		Success:      errorMsg == "",
+		ErrorMsg:     errorMsg,
+	})
+}
+
+func archiveJobFromDoc(doc *firestore.DocumentSnapshot) (*data.OrgArchiveJob, error) {
+	var job data.OrgArchiveJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, err
+	}
+	job.ID = doc.Ref.ID
+	return &job, nil
+}
@@ -197,7 +197,7 @@ func OswestryDisabilityRenderer(metadata PatternMetadata, context *PDFContext) (
 	var signatureData string
 	for _, fieldName := range possibleSignatureFields {
 		if value, exists := context.Answers[fieldName]; exists {
-			if sigStr, ok := value.(string); ok && strings.HasPrefix(sigStr, "data:image/") {
+			if sigStr, ok := context.imageAnswer(value); ok {
 				signatureData = sigStr
 				break
 			}
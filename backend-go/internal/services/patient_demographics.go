@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"html"
-	"log"
 	"strings"
+
+	"backend-go/internal/logging"
 )
 
 // PatientDemographicsRenderer renders patient demographic information
@@ -18,9 +19,8 @@ func PatientDemographicsRenderer(metadata PatternMetadata, context *PDFContext)
 	// Professional form layout with multiple fields per line
 	result.WriteString(`<table style="width: 100%; border-collapse: collapse; font-size: 12px;">`)
 	
-	// Log for debugging
-	log.Printf("DEBUG: PatientDemographicsRenderer - ElementNames: %v", metadata.ElementNames)
-	log.Printf("DEBUG: PatientDemographicsRenderer - Available answers keys: %v", getMapKeys(context.Answers))
+	logging.Dump(context.Ctx, "rendering patient demographics",
+		"fields", metadata.ElementNames, "answer_keys", getMapKeys(context.Answers))
 	
 	// Process fields directly from metadata.ElementNames - these match the actual form field names
 	for _, elementName := range metadata.ElementNames {
@@ -47,10 +47,8 @@ func PatientDemographicsRenderer(metadata PatternMetadata, context *PDFContext)
 			result.WriteString(`<td style="padding: 4px 8px; font-weight: bold;">` + html.EscapeString(label) + `:</td>`)
 			result.WriteString(`<td style="padding: 4px 8px;">` + html.EscapeString(displayValue) + `</td>`)
 			result.WriteString(`</tr>`)
-			
-			log.Printf("DEBUG: Rendered field %s with label %s and value %s", elementName, label, displayValue)
 		} else {
-			log.Printf("DEBUG: Field %s not found in response data", elementName)
+			logging.Dump(context.Ctx, "demographics field not found in response data", "field", elementName)
 		}
 	}
 	
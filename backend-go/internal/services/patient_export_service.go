@@ -0,0 +1,891 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Patient export job states
+const (
+	ExportQueued     = "queued"
+	ExportRunning    = "running"
+	ExportReady      = "ready"
+	ExportDownloaded = "downloaded"
+	ExportExpired    = "expired"
+	ExportFailed     = "failed"
+)
+
+const (
+	patientExportCollection = "patient_exports"
+	disclosureCollection    = "disclosures"
+	exportLockTTL           = 30 * time.Minute
+	exportStaleAfter        = 30 * time.Minute
+	exportLinkTTL           = 24 * time.Hour
+	exportPollInterval      = time.Minute
+	rightOfAccessPurpose    = "HIPAA right of access (45 CFR 164.524)"
+)
+
+// ErrInvalidPatientMatch is returned when an export request does not identify a patient
+var ErrInvalidPatientMatch = errors.New("specify response_ids or both patient_name and date_of_birth")
+
+// ErrExportNotFound is returned for unknown exports and for download tokens that do not match
+var ErrExportNotFound = errors.New("export not found")
+
+// ErrExportNotReady is returned when an export is still being built
+var ErrExportNotReady = errors.New("export is not ready yet")
+
+// ErrExportUnavailable is returned when an export link has expired, failed or was already used
+var ErrExportUnavailable = errors.New("export link is no longer available")
+
+// errNoMatchingResponses fails an export whose patient match selects nothing
+var errNoMatchingResponses = errors.New("no responses matched the patient")
+
+// errExportSkipped aborts a transaction when another worker already moved the export on
+var errExportSkipped = errors.New("export state changed")
+
+// dobAnswerKeys are the answer keys forms use for the patient's date of birth
+var dobAnswerKeys = []string{"date_of_birth", "dob", "birth_date", "dateOfBirth", "birthdate"}
+
+var dobLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006/01/02", time.RFC3339}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// PatientExportService builds right-of-access export archives in the background. Each
+// archive is stored in the blob store and offered through a single-use link whose token is
+// only ever stored hashed; the download records an accounting-of-disclosures entry in the
+// same transaction that consumes the link.
+type PatientExportService struct {
+	client       *firestore.Client
+	rdb          *redis.Client
+	store        BlobStore
+	attachments  *AttachmentService
+	encryptor    *FieldEncryptor
+	orchestrator *PDFOrchestrator
+	accessLog    *PHIAccessLog
+	auditLogger  *AuditTrail
+	interval     time.Duration
+	wake         chan struct{}
+}
+
+// ExportManifestEntry describes one file in an export archive
+type ExportManifestEntry struct {
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// exportArchive accumulates files and their manifest entries while a zip is written
+type exportArchive struct {
+	buf     bytes.Buffer
+	zw      *zip.Writer
+	entries []ExportManifestEntry
+}
+
+// NewPatientExportService creates a new patient export service
+func NewPatientExportService(client *firestore.Client, rdb *redis.Client, store BlobStore, attachments *AttachmentService, encryptor *FieldEncryptor, gotenberg PDFConverter, accessLog *PHIAccessLog, auditLogger *AuditTrail) (*PatientExportService, error) {
+	orchestrator, err := NewPDFOrchestrator(client, gotenberg, attachments, encryptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PDF orchestrator: %w", err)
+	}
+	return &PatientExportService{
+		client:       client,
+		rdb:          rdb,
+		store:        store,
+		attachments:  attachments,
+		encryptor:    encryptor,
+		orchestrator: orchestrator,
+		accessLog:    accessLog,
+		auditLogger:  auditLogger,
+		interval:     exportPollInterval,
+		wake:         make(chan struct{}, 1),
+	}, nil
+}
+
+// Request queues an export and returns the job with its download token. The token is not
+// stored and cannot be recovered later.
+func (s *PatientExportService) Request(ctx context.Context, orgID, userID, recipient string, match data.PatientMatch) (*data.PatientExport, string, error) {
+	match.PatientName = strings.TrimSpace(match.PatientName)
+	if len(match.ResponseIDs) == 0 {
+		if match.PatientName == "" || match.DateOfBirth == "" {
+			return nil, "", ErrInvalidPatientMatch
+		}
+		dob, ok := normalizeDOB(match.DateOfBirth)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: date_of_birth must be YYYY-MM-DD", ErrInvalidPatientMatch)
+		}
+		match.DateOfBirth = dob
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	ref := s.client.Collection(patientExportCollection).NewDoc()
+	sealedMatch, err := s.sealMatch(ctx, orgID, patientExportCollection+"/"+ref.ID, match)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	job := data.PatientExport{
+		OrganizationID: orgID,
+		RequestedBy:    userID,
+		Recipient:      recipient,
+		RequestID:      logging.RequestID(ctx),
+		SealedMatch:    sealedMatch,
+		Status:         ExportQueued,
+		TokenHash:      hashExportToken(token),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(exportLinkTTL),
+	}
+	if _, err := ref.Create(ctx, job); err != nil {
+		return nil, "", err
+	}
+	job.ID = ref.ID
+
+	s.auditExport(ctx, "PATIENT_EXPORT_REQUESTED", &job, userID, "")
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return &job, token, nil
+}
+
+// Get returns an export job owned by the organization
+func (s *PatientExportService) Get(ctx context.Context, orgID, exportID string) (*data.PatientExport, error) {
+	doc, err := s.client.Collection(patientExportCollection).Doc(exportID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	job, err := exportFromDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	if job.OrganizationID != orgID {
+		return nil, ErrExportNotFound
+	}
+	return job, nil
+}
+
+// Start runs the export worker until ctx is cancelled
+func (s *PatientExportService) Start(ctx context.Context) {
+	logging.FromContext(ctx).Info("EXPORT: worker started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			logging.FromContext(ctx).Info("EXPORT: worker stopped")
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// RunOnce builds queued and stalled exports and expires unused download links
+func (s *PatientExportService) RunOnce(ctx context.Context) {
+	staleBefore := time.Now().Add(-exportStaleAfter)
+	queries := []firestore.Query{
+		s.client.Collection(patientExportCollection).Where("status", "==", ExportQueued).Limit(20),
+		s.client.Collection(patientExportCollection).Where("status", "==", ExportRunning).Where("started_at", "<", staleBefore).Limit(20),
+	}
+	for _, query := range queries {
+		docs, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			logging.FromContext(ctx).Error("EXPORT: failed to list pending exports", "error", err)
+			continue
+		}
+		for _, doc := range docs {
+			if ctx.Err() != nil {
+				return
+			}
+			s.process(ctx, doc.Ref)
+		}
+	}
+
+	if err := s.expireLinks(ctx); err != nil {
+		logging.FromContext(ctx).Error("EXPORT: failed to expire download links", "error", err)
+	}
+}
+
+// process claims one export and builds its archive. The Redis lock keeps instances from
+// building the same export; the claim transaction is what makes the state change safe.
+func (s *PatientExportService) process(ctx context.Context, ref *firestore.DocumentRef) {
+	if s.rdb != nil {
+		lock := NewDistributedLock(s.rdb, "patient-export:"+ref.ID, exportLockTTL)
+		acquired, err := lock.Acquire(ctx)
+		if err != nil || !acquired {
+			return
+		}
+		defer lock.Release(context.Background())
+	}
+
+	var job *data.PatientExport
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		job, err = exportFromDoc(doc)
+		if err != nil {
+			return err
+		}
+		stale := job.Status == ExportRunning && job.StartedAt != nil && time.Since(*job.StartedAt) > exportStaleAfter
+		if job.Status != ExportQueued && !stale {
+			return errExportSkipped
+		}
+		now := time.Now().UTC()
+		job.StartedAt = &now
+		return tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: ExportRunning},
+			{Path: "started_at", Value: now},
+		})
+	})
+	if errors.Is(err, errExportSkipped) {
+		return
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("EXPORT: failed to claim export", "export_id", ref.ID, "error", err)
+		return
+	}
+
+	// The build runs under the ID of the request that queued it, so its PDF renders,
+	// Gotenberg calls and audit entries correlate with that request
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+	logger := logging.FromContext(ctx).With("export_id", job.ID)
+
+	if err := s.build(ctx, job); err != nil {
+		logger.Error("EXPORT: export failed", "error", err)
+		_, updateErr := ref.Update(context.Background(), []firestore.Update{
+			{Path: "status", Value: ExportFailed},
+			{Path: "error", Value: exportFailureMessage(err)},
+			{Path: "completed_at", Value: time.Now().UTC()},
+		})
+		if updateErr != nil {
+			logger.Error("EXPORT: failed to mark export failed", "error", updateErr)
+		}
+		s.auditExport(ctx, "PATIENT_EXPORT_FAILED", job, job.RequestedBy, "")
+		return
+	}
+	logger.Info("EXPORT: export ready")
+}
+
+// build assembles the archive for a claimed export and marks it ready
+func (s *PatientExportService) build(ctx context.Context, job *data.PatientExport) error {
+	match, err := s.openMatch(ctx, job.OrganizationID, patientExportCollection+"/"+job.ID, job.SealedMatch)
+	if err != nil {
+		return err
+	}
+
+	responses, err := s.findResponses(ctx, job.OrganizationID, match)
+	if err != nil {
+		return err
+	}
+	if len(responses) == 0 {
+		return errNoMatchingResponses
+	}
+
+	content, responseIDs, fileCount, err := s.writeArchive(ctx, job, responses)
+	if err != nil {
+		return err
+	}
+
+	// The archive is PHI: it is sealed with the organization's data key while it waits for
+	// its download
+	key := fmt.Sprintf("exports/%s/%s.zip", job.OrganizationID, job.ID)
+	sealed, err := s.encryptor.SealBlob(ctx, job.OrganizationID, key, content)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt archive: %w", err)
+	}
+	if err := s.store.Put(ctx, key, "application/octet-stream", sealed); err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	now := time.Now().UTC()
+	_, err = s.client.Collection(patientExportCollection).Doc(job.ID).Update(ctx, []firestore.Update{
+		{Path: "status", Value: ExportReady},
+		{Path: "response_ids", Value: responseIDs},
+		{Path: "file_count", Value: fileCount},
+		{Path: "size", Value: int64(len(content))},
+		{Path: "sha256", Value: hex.EncodeToString(sum[:])},
+		{Path: "storage_key", Value: key},
+		{Path: "encrypted", Value: true},
+		{Path: "completed_at", Value: now},
+		{Path: "expires_at", Value: now.Add(exportLinkTTL)},
+	})
+	if err != nil {
+		s.store.Delete(context.Background(), key)
+		return err
+	}
+	return nil
+}
+
+// exportFailureMessage keeps the stored error free of PHI and internal detail
+func exportFailureMessage(err error) string {
+	if errors.Is(err, errNoMatchingResponses) || errors.Is(err, ErrExportNotFound) {
+		return err.Error()
+	}
+	return "export could not be built"
+}
+
+// findResponses resolves the patient match to decrypted responses, oldest first
+func (s *PatientExportService) findResponses(ctx context.Context, orgID string, match data.PatientMatch) ([]*data.FormResponse, error) {
+	var responses []*data.FormResponse
+
+	if len(match.ResponseIDs) > 0 {
+		for _, id := range match.ResponseIDs {
+			doc, err := s.client.Collection("form_responses").Doc(id).Get(ctx)
+			if status.Code(err) == codes.NotFound {
+				return nil, fmt.Errorf("%w: response %s", ErrExportNotFound, id)
+			}
+			if err != nil {
+				return nil, err
+			}
+			response, err := s.encryptor.OpenResponse(ctx, doc)
+			if err != nil {
+				return nil, err
+			}
+			if response.OrganizationID != orgID || response.DeletedAt != nil {
+				return nil, fmt.Errorf("%w: response %s", ErrExportNotFound, id)
+			}
+			responses = append(responses, response)
+		}
+	} else {
+		name := normalizePatientName(match.PatientName)
+		iter := s.client.Collection("form_responses").Where("organizationId", "==", orgID).Documents(ctx)
+		defer iter.Stop()
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if _, deleted := doc.Data()["deleted_at"]; deleted {
+				continue
+			}
+			response, err := s.encryptor.OpenResponse(ctx, doc)
+			if err != nil {
+				logging.FromContext(ctx).Warn("EXPORT: skipping unreadable response", "response_id", doc.Ref.ID, "error", err)
+				continue
+			}
+			if responsePatientName(response) == name && responseDOB(response) == match.DateOfBirth {
+				responses = append(responses, response)
+			}
+		}
+	}
+
+	sort.Slice(responses, func(i, j int) bool {
+		return responses[i].SubmittedAt.Before(responses[j].SubmittedAt)
+	})
+	return responses, nil
+}
+
+// writeArchive zips each response's PDF, JSON and attachments together with a FHIR bundle
+// and a manifest of checksums
+func (s *PatientExportService) writeArchive(ctx context.Context, job *data.PatientExport, responses []*data.FormResponse) ([]byte, []string, int, error) {
+	archive := &exportArchive{}
+	archive.zw = zip.NewWriter(&archive.buf)
+
+	responseIDs := make([]string, 0, len(responses))
+	attachmentPaths := map[string]string{}
+	resources := make([]map[string]interface{}, 0, len(responses))
+
+	for _, response := range responses {
+		dir := "responses/" + response.ID
+		responseIDs = append(responseIDs, response.ID)
+
+		pdf, err := s.orchestrator.GeneratePDF(ctx, response.ID, job.RequestedBy)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("response %s: %w", response.ID, err)
+		}
+		if err := archive.add(dir+"/response.pdf", "application/pdf", pdf); err != nil {
+			return nil, nil, 0, err
+		}
+
+		responseJSON, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if err := archive.add(dir+"/response.json", "application/json", responseJSON); err != nil {
+			return nil, nil, 0, err
+		}
+
+		records, err := s.attachments.ForResponse(ctx, response.ID)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("response %s attachments: %w", response.ID, err)
+		}
+		for _, record := range records {
+			_, content, err := s.attachments.Open(ctx, job.OrganizationID, record.ID)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("attachment %s: %w", record.ID, err)
+			}
+			name := fmt.Sprintf("%s/attachments/%s-%s%s", dir, safePathSegment(record.FieldName), record.ID, extensionFor(record.ContentType))
+			if err := archive.add(name, record.ContentType, content); err != nil {
+				return nil, nil, 0, err
+			}
+			attachmentPaths[record.ID] = name
+		}
+
+		// Responses written before attachments moved to the blob store still carry
+		// signatures and images inline
+		inline := 0
+		for _, field := range sortedKeys(response.Data) {
+			for _, uri := range inlineDataURIs(response.Data[field]) {
+				contentType, content, ok := decodeDataURI(uri)
+				if !ok {
+					continue
+				}
+				inline++
+				name := fmt.Sprintf("%s/attachments/%s-inline-%d%s", dir, safePathSegment(field), inline, extensionFor(contentType))
+				if err := archive.add(name, contentType, content); err != nil {
+					return nil, nil, 0, err
+				}
+			}
+		}
+
+		resources = append(resources, BuildQuestionnaireResponse(response))
+	}
+
+	bundle, err := json.MarshalIndent(BuildFHIRBundle(resources), "", "  ")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if err := archive.add("fhir/bundle.json", "application/fhir+json", bundle); err != nil {
+		return nil, nil, 0, err
+	}
+
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"export_id":       job.ID,
+		"organization_id": job.OrganizationID,
+		"generated_at":    time.Now().UTC().Format(time.RFC3339),
+		"response_ids":    responseIDs,
+		"attachments":     attachmentPaths,
+		"files":           archive.entries,
+	}, "", "  ")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	fileCount := len(archive.entries) + 1
+	if err := archive.add("manifest.json", "application/json", manifest); err != nil {
+		return nil, nil, 0, err
+	}
+
+	if err := archive.zw.Close(); err != nil {
+		return nil, nil, 0, err
+	}
+	return archive.buf.Bytes(), responseIDs, fileCount, nil
+}
+
+func (a *exportArchive) add(name, contentType string, content []byte) error {
+	w, err := a.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	a.entries = append(a.entries, ExportManifestEntry{
+		Path:        name,
+		ContentType: contentType,
+		Size:        len(content),
+		SHA256:      hex.EncodeToString(sum[:]),
+	})
+	return nil
+}
+
+// Download consumes a single-use export link. The link is marked used and the disclosure
+// is recorded in one transaction, so a link can only ever produce one disclosure.
+func (s *PatientExportService) Download(ctx context.Context, exportID, token string) (*data.PatientExport, []byte, error) {
+	ref := s.client.Collection(patientExportCollection).Doc(exportID)
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+	job, err := exportFromDoc(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(job.TokenHash), []byte(hashExportToken(token))) != 1 {
+		return nil, nil, ErrExportNotFound
+	}
+	if err := downloadable(job); err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.store.Get(ctx, job.StorageKey)
+	if errors.Is(err, ErrBlobNotFound) {
+		return nil, nil, ErrExportUnavailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Encrypted {
+		if content, err = s.encryptor.OpenBlob(ctx, job.OrganizationID, job.StorageKey, content); err != nil {
+			return nil, nil, fmt.Errorf("failed to decrypt archive for export %s: %w", exportID, err)
+		}
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != job.SHA256 {
+		return nil, nil, fmt.Errorf("export %s archive checksum mismatch", exportID)
+	}
+
+	match, err := s.openMatch(ctx, job.OrganizationID, patientExportCollection+"/"+job.ID, job.SealedMatch)
+	if err != nil {
+		return nil, nil, err
+	}
+	disclosureRef := s.client.Collection(disclosureCollection).NewDoc()
+	match.ResponseIDs = job.ResponseIDs
+	sealedPatient, err := s.sealMatch(ctx, job.OrganizationID, disclosureCollection+"/"+disclosureRef.ID, match)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Every response in the archive gets its own access log entry, written with the disclosure
+	responses, err := s.findResponses(ctx, job.OrganizationID, data.PatientMatch{ResponseIDs: job.ResponseIDs})
+	if err != nil {
+		return nil, nil, err
+	}
+	accessEvents := make([]data.PHIAccessEvent, 0, len(responses))
+	for _, response := range responses {
+		event, err := s.accessLog.Event(ctx, response, PHIAccess{
+			Action:    PHIActionExport,
+			Purpose:   PurposePatientRequest,
+			ActorID:   job.RequestedBy,
+			Recipient: job.Recipient,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		accessEvents = append(accessEvents, event)
+	}
+
+	now := time.Now().UTC()
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		current, err := exportFromDoc(doc)
+		if err != nil {
+			return err
+		}
+		if err := downloadable(current); err != nil {
+			return err
+		}
+
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "status", Value: ExportDownloaded},
+			{Path: "downloaded_at", Value: now},
+		}); err != nil {
+			return err
+		}
+		for _, event := range accessEvents {
+			if err := s.accessLog.RecordTx(tx, event); err != nil {
+				return err
+			}
+		}
+		return tx.Create(disclosureRef, data.Disclosure{
+			OrganizationID: job.OrganizationID,
+			SealedPatient:  sealedPatient,
+			Recipient:      job.Recipient,
+			Purpose:        rightOfAccessPurpose,
+			Description:    fmt.Sprintf("Export of %d form response(s) with PDFs, FHIR bundle and attachments", len(job.ResponseIDs)),
+			ResponseIDs:    job.ResponseIDs,
+			ExportID:       job.ID,
+			RequestedBy:    job.RequestedBy,
+			DisclosedAt:    now,
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.store.Delete(context.Background(), job.StorageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		logging.FromContext(ctx).Warn("EXPORT: failed to delete archive", "export_id", job.ID, "error", err)
+	}
+	job.Status = ExportDownloaded
+	job.DownloadedAt = &now
+	s.auditExport(ctx, "PATIENT_EXPORT_DOWNLOADED", job, job.RequestedBy, disclosureRef.ID)
+	return job, content, nil
+}
+
+func downloadable(job *data.PatientExport) error {
+	switch job.Status {
+	case ExportQueued, ExportRunning:
+		return ErrExportNotReady
+	case ExportReady:
+		if time.Now().After(job.ExpiresAt) {
+			return ErrExportUnavailable
+		}
+		return nil
+	default:
+		return ErrExportUnavailable
+	}
+}
+
+// expireLinks deletes archives whose download link lapsed unused
+func (s *PatientExportService) expireLinks(ctx context.Context) error {
+	docs, err := s.client.Collection(patientExportCollection).
+		Where("status", "==", ExportReady).
+		Where("expires_at", "<", time.Now().UTC()).
+		Limit(100).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		job, err := exportFromDoc(doc)
+		if err != nil {
+			continue
+		}
+		err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			current, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			if status, _ := current.DataAt("status"); status != ExportReady {
+				return errExportSkipped
+			}
+			return tx.Update(doc.Ref, []firestore.Update{{Path: "status", Value: ExportExpired}})
+		})
+		if errors.Is(err, errExportSkipped) {
+			continue
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn("EXPORT: failed to expire export", "export_id", doc.Ref.ID, "error", err)
+			continue
+		}
+		if err := s.store.Delete(ctx, job.StorageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+			logging.FromContext(ctx).Warn("EXPORT: failed to delete archive", "export_id", doc.Ref.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// DisclosureRecord is a disclosure with its patient identity decrypted
+type DisclosureRecord struct {
+	data.Disclosure
+	Patient data.PatientMatch `json:"patient"`
+}
+
+// Disclosures lists the organization's accounting of disclosures, newest first
+func (s *PatientExportService) Disclosures(ctx context.Context, orgID string, limit int) ([]DisclosureRecord, error) {
+	docs, err := s.client.Collection(disclosureCollection).
+		Where("organizationId", "==", orgID).
+		OrderBy("disclosed_at", firestore.Desc).
+		Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]DisclosureRecord, 0, len(docs))
+	for _, doc := range docs {
+		var disclosure data.Disclosure
+		if err := doc.DataTo(&disclosure); err != nil {
+			return nil, err
+		}
+		disclosure.ID = doc.Ref.ID
+		patient, err := s.openMatch(ctx, orgID, disclosureCollection+"/"+doc.Ref.ID, disclosure.SealedPatient)
+		if err != nil {
+			return nil, fmt.Errorf("disclosure %s: %w", doc.Ref.ID, err)
+		}
+		records = append(records, DisclosureRecord{Disclosure: disclosure, Patient: patient})
+	}
+	return records, nil
+}
+
+func (s *PatientExportService) sealMatch(ctx context.Context, orgID, aad string, match data.PatientMatch) (string, error) {
+	plaintext, err := json.Marshal(match)
+	if err != nil {
+		return "", err
+	}
+	return s.encryptor.Seal(ctx, orgID, aad, plaintext)
+}
+
+func (s *PatientExportService) openMatch(ctx context.Context, orgID, aad, sealed string) (data.PatientMatch, error) {
+	var match data.PatientMatch
+	plaintext, err := s.encryptor.Open(ctx, orgID, aad, sealed)
+	if err != nil {
+		return match, err
+	}
+	err = json.Unmarshal(plaintext, &match)
+	return match, err
+}
+
+func (s *PatientExportService) auditExport(ctx context.Context, action string, job *data.PatientExport, userID, disclosureID string) {
+	if s.auditLogger == nil {
+		return
+	}
+	metadata := map[string]interface{}{
+		"organization_id": job.OrganizationID,
+		"status":          job.Status,
+		"responses":       len(job.ResponseIDs),
+	}
+	if disclosureID != "" {
+		metadata["disclosure_id"] = disclosureID
+	}
+	s.auditLogger.LogAccess(ctx, AuditEntry{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "patient_export",
+		ResourceID:   job.ID,
+		Metadata:     metadata,
+		Success:      true,
+	})
+}
+
+func exportFromDoc(doc *firestore.DocumentSnapshot) (*data.PatientExport, error) {
+	var job data.PatientExport
+	if err := doc.DataTo(&job); err != nil {
+		return nil, err
+	}
+	job.ID = doc.Ref.ID
+	return &job, nil
+}
+
+func hashExportToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// responsePatientName returns the normalized patient name recorded on a response
+func responsePatientName(response *data.FormResponse) string {
+	name := response.PatientName
+	if name == "" && response.Data != nil {
+		first, _ := response.Data["first_name"].(string)
+		last, _ := response.Data["last_name"].(string)
+		name = first + " " + last
+	}
+	return normalizePatientName(name)
+}
+
+// responseDOB returns the response's date of birth as YYYY-MM-DD, or "" if absent
+func responseDOB(response *data.FormResponse) string {
+	for _, key := range dobAnswerKeys {
+		if value, ok := response.Data[key].(string); ok {
+			if dob, ok := normalizeDOB(value); ok {
+				return dob
+			}
+		}
+	}
+	return ""
+}
+
+func normalizeDOB(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dobLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+func inlineDataURIs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "data:") && strings.Contains(v, ";base64,") {
+			return []string{v}
+		}
+	case map[string]interface{}:
+		var uris []string
+		for _, key := range sortedKeys(v) {
+			uris = append(uris, inlineDataURIs(v[key])...)
+		}
+		return uris
+	case []interface{}:
+		var uris []string
+		for _, nested := range v {
+			uris = append(uris, inlineDataURIs(nested)...)
+		}
+		return uris
+	}
+	return nil
+}
+
+func decodeDataURI(uri string) (string, []byte, bool) {
+	header, payload, _ := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	contentType, _, _ := strings.Cut(header, ";")
+	decoded, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	return normalizeMimeType(contentType), decoded, true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func safePathSegment(name string) string {
+	name = unsafePathChars.ReplaceAllString(path.Base(name), "_")
+	if name == "" || name == "." || name == ".." {
+		return "field"
+	}
+	return name
+}
+
+func extensionFor(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "application/pdf":
+		return ".pdf"
+	default:
+		return ".bin"
+	}
+}
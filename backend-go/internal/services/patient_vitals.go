@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"html"
-	"log"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"backend-go/internal/logging"
 )
 
 // VitalSign represents a vital sign measurement definition
@@ -34,8 +35,7 @@ func PatientVitalsRenderer(metadata PatternMetadata, context *PDFContext) (strin
 	result.WriteString(`<div class="form-section">`)
 	result.WriteString(`<div class="section-title">Patient Vitals</div>`)
 	
-	// Log what fields we're trying to process
-	log.Printf("DEBUG: PatientVitalsRenderer processing %d detected fields: %v", len(metadata.ElementNames), metadata.ElementNames)
+	logging.Dump(context.Ctx, "rendering patient vitals", "fields", metadata.ElementNames)
 	
 	// Get vital sign definitions for comprehensive processing
 	definitions := getVitalSignDefinitions()
@@ -44,7 +44,6 @@ func PatientVitalsRenderer(metadata PatternMetadata, context *PDFContext) (strin
 	readings := extractVitalReadings(metadata.ElementNames, context.Answers, definitions)
 	
 	if len(readings) == 0 {
-		log.Printf("DEBUG: No vital readings found from detected fields")
 		result.WriteString(`<div style="text-align: center; padding: 30px; background-color: #f8f9fa; border: 1px dashed #dee2e6;">`)
 		result.WriteString(`<p style="color: #6c757d; font-style: italic;">No vital signs data available</p>`)
 		
@@ -56,8 +55,6 @@ func PatientVitalsRenderer(metadata PatternMetadata, context *PDFContext) (strin
 		}
 		result.WriteString(`</div>`)
 	} else {
-		log.Printf("DEBUG: Found %d vital readings", len(readings))
-		
 		// Check if we have height and weight for special BMI handling
 		height := context.Answers["patient_height"]
 		weight := context.Answers["patient_weight"]
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 )
 
@@ -359,8 +360,7 @@ func (m *PainAssessmentMatcher) Match(formDef, responseData map[string]interface
 					// Start collecting from the panel
 					collectFieldNames(element)
 					
-					// Log for debugging
-					fmt.Printf("DEBUG: Found pain assessment panel via metadata, name: %s, fields: %v\n", panelName, allFieldNames)
+					slog.Debug("found pain assessment panel via metadata", "panel", panelName, "fields", allFieldNames)
 					
 					return true, PatternMetadata{
 						PatternType:  "pain_assessment",
@@ -407,8 +407,7 @@ func (m *NeckDisabilityMatcher) Match(formDef, responseData map[string]interface
 					}
 				}
 				
-				// Log for debugging
-				fmt.Printf("DEBUG: Found NDI form with title: %s, detected %d questions\n", title, len(ndiQuestions))
+				slog.Debug("found neck disability index form", "title", title, "questions", len(ndiQuestions))
 				
 				if len(ndiQuestions) > 0 {
 					return true, PatternMetadata{
@@ -457,8 +456,7 @@ func (m *OswestryDisabilityMatcher) Match(formDef, responseData map[string]inter
 					}
 				}
 				
-				// Log for debugging
-				fmt.Printf("DEBUG: Found Oswestry form with title: %s, detected %d questions\n", title, len(oswestryQuestions))
+				slog.Debug("found Oswestry disability form", "title", title, "questions", len(oswestryQuestions))
 				
 				if len(oswestryQuestions) > 0 {
 					return true, PatternMetadata{
@@ -740,8 +738,8 @@ func (m *SignatureMatcher) Match(formDef, responseData map[string]interface{}) (
 					// Check if this field has data in responseData
 					if value, exists := responseData[name]; exists {
 						if strValue, ok := value.(string); ok {
-							// Verify it's base64 image data
-							if strings.HasPrefix(strValue, "data:image/") {
+							// Verify it's base64 image data or a stored attachment
+							if strings.HasPrefix(strValue, "data:image/") || IsAttachmentRef(strValue) {
 								signatureFields = append(signatureFields, name)
 							}
 						}
@@ -751,9 +749,8 @@ func (m *SignatureMatcher) Match(formDef, responseData map[string]interface{}) (
 		}
 	}
 	
-	// Log for debugging
 	if len(signatureFields) > 0 {
-		fmt.Printf("DEBUG: Found %d standalone signature fields (excluding consent panel signatures)\n", len(signatureFields))
+		slog.Debug("found standalone signature fields outside consent panels", "count", len(signatureFields))
 	}
 	
 	if len(signatureFields) > 0 {
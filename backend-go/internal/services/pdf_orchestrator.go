@@ -5,21 +5,24 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"html/template"
-	"log"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"backend-go/internal/data"
+	"backend-go/internal/logging"
 	"backend-go/internal/services/renderers/templates"
+	"backend-go/internal/telemetry"
 )
 
 type PDFOrchestrator struct {
 	client        *firestore.Client
-	gotenberg     *GotenbergService
+	gotenberg     PDFConverter
 	registry      *RendererRegistry
 	detector      *PatternDetector
 	templateStore *templates.TemplateStore
+	attachments   *AttachmentService
+	encryptor     *FieldEncryptor
 }
 
 type PDFContext struct {
@@ -28,10 +31,37 @@ type PDFContext struct {
 	OrganizationInfo *data.Organization
 	Answers          map[string]interface{}
 	RequestID        string
+	Ctx              context.Context // carries the request logger and trace span into renderers
 	TemplateStore    *templates.TemplateStore
+	Attachments      AttachmentResolver // nil when attachment storage is not configured
+	Amendments       []data.ResponseRevision
 }
 
-func NewPDFOrchestrator(client *firestore.Client, gotenberg *GotenbergService) (*PDFOrchestrator, error) {
+// imageAnswer returns an answer as an image data URI. Inline data URIs from older
+// responses are returned as-is; attachment references are loaded from the blob store.
+func (c *PDFContext) imageAnswer(value interface{}) (string, bool) {
+	str, ok := value.(string)
+	if !ok {
+		return "", false
+	}
+	if strings.HasPrefix(str, "data:image/") {
+		return str, true
+	}
+	if !IsAttachmentRef(str) || c.Attachments == nil {
+		return "", false
+	}
+	uri, err := c.Attachments(str)
+	if err != nil {
+		logging.FromContext(c.Ctx).Error("failed to load PDF attachment", "attachment_id", AttachmentRefID(str), "error", err)
+		return "", false
+	}
+	if !strings.HasPrefix(uri, "data:image/") {
+		return "", false
+	}
+	return uri, true
+}
+
+func NewPDFOrchestrator(client *firestore.Client, gotenberg PDFConverter, attachments *AttachmentService, encryptor *FieldEncryptor) (*PDFOrchestrator, error) {
 	templateStore, err := templates.NewTemplateStore()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize template store: %w", err)
@@ -46,68 +76,58 @@ func NewPDFOrchestrator(client *firestore.Client, gotenberg *GotenbergService) (
 		registry:      registry,
 		detector:      detector,
 		templateStore: templateStore,
+		attachments:   attachments,
+		encryptor:     encryptor,
 	}, nil
 }
 
-func (o *PDFOrchestrator) GeneratePDF(ctx context.Context, responseID string, userID string) ([]byte, error) {
-	// Generate request ID for audit trail
-	requestID := fmt.Sprintf("pdf_%d_%s", time.Now().Unix(), responseID[:8])
-	
+func (o *PDFOrchestrator) GeneratePDF(ctx context.Context, responseID string, userID string) (pdfBytes []byte, err error) {
+	// Render errors, the PDF footer and Gotenberg share the caller's request ID so a
+	// failed PDF can be traced end to end; calls without one (background jobs) get their own
+	requestID := logging.RequestID(ctx)
+	if requestID == "" {
+		requestID = "pdf_" + logging.NewRequestID()
+		ctx = logging.WithRequestID(ctx, requestID)
+	}
+	ctx = logging.With(ctx, "response_id", responseID)
+	logger := logging.FromContext(ctx)
+
+	ctx, span := telemetry.StartSpan(ctx, "pdf.generate")
+	start := time.Now()
+	defer func() {
+		telemetry.PDFGenerationDuration.WithLabelValues(telemetry.Outcome(err)).Observe(time.Since(start).Seconds())
+		telemetry.EndSpan(span, err)
+	}()
+
 	// Audit log start
-	log.Printf("PDF_GENERATION_START: user=%s, response=%s, request=%s", userID, responseID, requestID)
+	logger.Info("PDF_GENERATION_START", "user_id", userID)
 	
 	// 1. Fetch all required data in parallel
 	pdfContext, err := o.fetchPDFContext(ctx, responseID, requestID)
 	if err != nil {
-		log.Printf("PDF_GENERATION_ERROR: user=%s, response=%s, request=%s, error=%v", userID, responseID, requestID, err)
+		logger.Error("PDF_GENERATION_ERROR", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("failed to fetch PDF context: %w", err)
 	}
 	
 	// 2. Detect patterns and determine render order
-	// NOTE: Avoid logging full form definition or answers to maintain HIPAA compliance
-	log.Printf("DEBUG: Form definition contains %d keys", len(pdfContext.FormDefinition))
-	log.Printf("DEBUG: Response answers contains %d fields", len(pdfContext.Answers))
+	// Only sizes are logged; field names and metadata go through debug dumps
+	logger.Debug("PDF context loaded", "definition_keys", len(pdfContext.FormDefinition), "answers", len(pdfContext.Answers))
 	
 	// Extract surveyJson for pattern detection
 	surveyJson, ok := pdfContext.FormDefinition["surveyJson"].(map[string]interface{})
 	if !ok {
 		surveyJson = pdfContext.FormDefinition // Fallback for backward compatibility
-		log.Printf("DEBUG: Using full form definition as surveyJson fallback")
-	} else {
-		log.Printf("DEBUG: Successfully extracted surveyJson from form definition")
-		// Debug: Check if pages exist
-		if pages, ok := surveyJson["pages"].([]interface{}); ok {
-			log.Printf("DEBUG: Found %d pages in surveyJson", len(pages))
-			// Check first page for elements
-			if len(pages) > 0 {
-				if page, ok := pages[0].(map[string]interface{}); ok {
-					if elements, ok := page["elements"].([]interface{}); ok {
-						log.Printf("DEBUG: First page has %d elements", len(elements))
-						// Check first element for metadata
-						if len(elements) > 0 {
-							if elem, ok := elements[0].(map[string]interface{}); ok {
-								log.Printf("DEBUG: First element type=%v, name=%v", elem["type"], elem["name"])
-								if metadata, ok := elem["metadata"].(map[string]interface{}); ok {
-									log.Printf("DEBUG: First element has metadata: %+v", metadata)
-								} else {
-									log.Printf("DEBUG: First element has NO metadata")
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+		logger.Debug("using full form definition as surveyJson fallback")
 	}
 	patterns, err := o.detector.DetectPatterns(surveyJson, pdfContext.Answers)
 	if err != nil {
-		log.Printf("PDF_GENERATION_ERROR: user=%s, response=%s, request=%s, error=%v", userID, responseID, requestID, err)
+		logger.Error("PDF_GENERATION_ERROR", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("pattern detection failed: %w", err)
 	}
 	
-	log.Printf("DEBUG: Detected patterns: %d", len(patterns))
+	logger.Debug("patterns detected", "count", len(patterns))
 	for _, p := range patterns {
-		log.Printf("DEBUG: Pattern type=%s, fields=%v", p.PatternType, p.ElementNames)
+		logging.Dump(ctx, "detected pattern", "pattern", p.PatternType, "fields", p.ElementNames)
 	}
 	
 	// 3. Get custom render order from organization or use default
@@ -116,21 +136,20 @@ func (o *PDFOrchestrator) GeneratePDF(ctx context.Context, responseID string, us
 	// 4. Generate HTML sections with streaming
 	htmlSections, err := o.renderSections(pdfContext, renderOrder)
 	if err != nil {
-		log.Printf("PDF_GENERATION_ERROR: user=%s, response=%s, request=%s, error=%v", userID, responseID, requestID, err)
+		logger.Error("PDF_GENERATION_ERROR", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("section rendering failed: %w", err)
 	}
 	
 	// 5. Assemble HTML and generate PDF
-	pdfBytes, err := o.assembleAndGeneratePDF(htmlSections, pdfContext)
+	pdfBytes, err = o.assembleAndGeneratePDF(ctx, htmlSections, pdfContext)
 	if err != nil {
-		log.Printf("PDF_GENERATION_ERROR: user=%s, response=%s, request=%s, error=%v", userID, responseID, requestID, err)
+		logger.Error("PDF_GENERATION_ERROR", "user_id", userID, "error", err)
 		return nil, fmt.Errorf("PDF generation failed: %w", err)
 	}
 	
 	// 6. Audit log completion
 	checksum := o.calculateChecksum(pdfBytes)
-	log.Printf("PDF_GENERATION_SUCCESS: user=%s, response=%s, request=%s, checksum=%s, size=%d", 
-	           userID, responseID, requestID, checksum, len(pdfBytes))
+	logger.Info("PDF_GENERATION_SUCCESS", "user_id", userID, "checksum", checksum, "size", len(pdfBytes))
 	
 	return pdfBytes, nil
 }
@@ -152,8 +171,7 @@ func (o *PDFOrchestrator) fetchPDFContext(ctx context.Context, responseID, reque
 			resultChan <- fetchResult{nil, err, "form_response"}
 			return
 		}
-		var data map[string]interface{}
-		err = doc.DataTo(&data)
+		data, err := o.encryptor.OpenResponseMap(ctx, doc)
 		resultChan <- fetchResult{data, err, "form_response"}
 	}()
 	
@@ -167,6 +185,9 @@ func (o *PDFOrchestrator) fetchPDFContext(ctx context.Context, responseID, reque
 		return nil, fmt.Errorf("failed to fetch form response: %w", result.err)
 	}
 	formResponse = result.data.(map[string]interface{})
+	if _, deleted := formResponse["deleted_at"]; deleted {
+		return nil, fmt.Errorf("failed to fetch form response: form response %s not found", responseID)
+	}
 	
 	// Extract IDs for subsequent fetches
 	formID, _ := formResponse["form"].(string)
@@ -224,6 +245,7 @@ func (o *PDFOrchestrator) fetchPDFContext(ctx context.Context, responseID, reque
 	if !ok {
 		return nil, fmt.Errorf("response_data field not found or invalid type")
 	}
+	amendments, _ := formResponse["revisions"].([]data.ResponseRevision)
 	
 	return &PDFContext{
 		FormResponse:     formResponse,
@@ -231,7 +253,10 @@ func (o *PDFOrchestrator) fetchPDFContext(ctx context.Context, responseID, reque
 		OrganizationInfo: orgInfo,
 		Answers:          answers,
 		RequestID:        requestID,
+		Ctx:              ctx,
 		TemplateStore:    o.templateStore,
+		Attachments:      o.attachments.Resolver(ctx, orgID),
+		Amendments:       amendments,
 	}, nil
 }
 
@@ -337,7 +362,7 @@ func (o *PDFOrchestrator) renderSections(context *PDFContext, _ []string) (map[s
 
 			// If we found a matching pattern, render it
 			if matchedPattern != nil && !processedPatterns[matchedPattern.PatternType] {
-				log.Printf("DEBUG: Rendering pattern type=%s with fields=%v", matchedPattern.PatternType, matchedPattern.ElementNames)
+				logging.Dump(context.Ctx, "rendering pattern", "pattern", matchedPattern.PatternType, "fields", matchedPattern.ElementNames)
 				html, err := o.registry.Render(matchedPattern.PatternType, *matchedPattern, context)
 				if err != nil {
 					errorBlock := o.registry.generateErrorBlock(RenderError{
@@ -354,11 +379,10 @@ func (o *PDFOrchestrator) renderSections(context *PDFContext, _ []string) (map[s
 				// CRITICAL: Mark all fields in this pattern as rendered
 				for _, fieldName := range matchedPattern.ElementNames {
 					renderedFields[fieldName] = true
-					log.Printf("DEBUG: Marked field '%s' as rendered by pattern '%s'", fieldName, matchedPattern.PatternType)
 				}
 			} else if elemType != "panel" && elemName != "" && context.Answers[elemName] != nil && !renderedFields[elemName] {
 				// Use intelligent generic field renderer for any question type
-				log.Printf("DEBUG: Rendering standalone field '%s' with GenericFieldRenderer", elemName)
+				logging.Dump(context.Ctx, "rendering standalone field", "field", elemName)
 				renderer := &GenericFieldRenderer{}
 				genericHTML := renderer.RenderField(elemMap, context.Answers[elemName], elemName, 0)
 				htmlSections[elemName] = genericHTML
@@ -397,13 +421,12 @@ func (o *PDFOrchestrator) renderSections(context *PDFContext, _ []string) (map[s
 		}
 
 		// This is an orphaned field - exists in answers but wasn't encountered during traversal
-		log.Printf("WARNING: Orphaned field '%s' found in answers but not traversed in form definition", elemName)
+		logging.Dump(context.Ctx, "orphaned field found in answers", "field", elemName)
 		
 		// Try to find the element definition
 		element := o.findElementByName(surveyJson, elemName)
 		if element != nil {
 			// Found definition, render it
-			log.Printf("DEBUG: Found definition for orphaned field '%s', rendering with GenericFieldRenderer", elemName)
 			renderer := &GenericFieldRenderer{}
 			genericHTML := renderer.RenderField(element, answer, elemName, 0)
 			htmlSections[elemName] = genericHTML
@@ -411,7 +434,7 @@ func (o *PDFOrchestrator) renderSections(context *PDFContext, _ []string) (map[s
 			orphanedCount++
 		} else {
 			// No definition found, render as raw value with warning
-			log.Printf("WARNING: No definition found for orphaned field '%s', rendering as raw value", elemName)
+			logging.Dump(context.Ctx, "no definition for orphaned field, rendering raw value", "field", elemName)
 			renderer := &GenericFieldRenderer{}
 			// Create minimal element definition for rendering
 			minimalElement := map[string]interface{}{
@@ -427,17 +450,17 @@ func (o *PDFOrchestrator) renderSections(context *PDFContext, _ []string) (map[s
 	}
 	
 	if orphanedCount > 0 {
-		log.Printf("INFO: Rendered %d orphaned fields using fallback logic", orphanedCount)
+		logging.FromContext(context.Ctx).Warn("rendered orphaned fields using fallback logic", "count", orphanedCount)
 	}
 
 	// Log summary for debugging
-	log.Printf("DEBUG: PDF rendering complete - Patterns: %d, Total fields: %d, Rendered sections: %d",
-		len(processedPatterns), len(renderedFields), len(htmlSections))
+	logging.FromContext(context.Ctx).Debug("PDF rendering complete",
+		"patterns", len(processedPatterns), "fields", len(renderedFields), "sections", len(htmlSections))
 
 	return htmlSections, nil
 }
 
-func (o *PDFOrchestrator) assembleAndGeneratePDF(htmlSections map[string]string, context *PDFContext) ([]byte, error) {
+func (o *PDFOrchestrator) assembleAndGeneratePDF(ctx context.Context, htmlSections map[string]string, context *PDFContext) ([]byte, error) {
 	// Get the render order to maintain section ordering
 	// Extract surveyJson for pattern detection (fix for missing form fields bug)
 	surveyJson, ok := context.FormDefinition["surveyJson"].(map[string]interface{})
@@ -449,18 +472,8 @@ func (o *PDFOrchestrator) assembleAndGeneratePDF(htmlSections map[string]string,
 	
 	// Combine all sections IN ORDER
 	var combinedHTML string
-	log.Printf("DEBUG: Combining HTML sections. Available sections: %d", len(htmlSections))
-
-	// Log all available sections first
-	for sectionName, html := range htmlSections {
-		if html != "" {
-			log.Printf("DEBUG: Available section: %s (%d chars)", sectionName, len(html))
-		}
-	}
-
 	for _, patternType := range renderOrder {
 		if html, exists := htmlSections[patternType]; exists && html != "" {
-			log.Printf("DEBUG: Adding ordered section %s to PDF (%d chars)", patternType, len(html))
 			combinedHTML += html + "\n"
 		}
 	}
@@ -475,12 +488,12 @@ func (o *PDFOrchestrator) assembleAndGeneratePDF(htmlSections map[string]string,
 			}
 		}
 		if !found && html != "" {
-			log.Printf("DEBUG: Adding unordered section %s to PDF (%d chars)", sectionName, len(html))
 			combinedHTML += html + "\n"
 		}
 	}
+	combinedHTML += renderAmendmentAnnex(context, surveyJson)
 
-	log.Printf("DEBUG: Final combined HTML size: %d characters", len(combinedHTML))
+	logging.FromContext(context.Ctx).Debug("combined PDF HTML", "sections", len(htmlSections), "size", len(combinedHTML))
 	
 	// Use master layout template
 	layoutTmpl, err := o.templateStore.Get("pdf_layout.html")
@@ -504,7 +517,7 @@ func (o *PDFOrchestrator) assembleAndGeneratePDF(htmlSections map[string]string,
 	}
 	
 	// Generate PDF using Gotenberg
-	return o.gotenberg.ConvertHTMLToPDF(htmlBuffer.String())
+	return o.gotenberg.ConvertHTMLToPDF(ctx, htmlBuffer.String())
 }
 
 func (o *PDFOrchestrator) calculateChecksum(data []byte) string {
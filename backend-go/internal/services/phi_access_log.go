@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// PHI access actions
+const (
+	PHIActionRead            = "response_read"
+	PHIActionAmend           = "response_amended"
+	PHIActionMerge           = "responses_merged"
+	PHIActionPDF             = "pdf_generated"
+	PHIActionClinicalSummary = "clinical_summary_generated"
+	PHIActionExport          = "export_downloaded"
+	PHIActionWebhook         = "webhook_delivered"
+)
+
+// Purpose-of-use codes from the HL7 v3 PurposeOfUse value set
+const (
+	PurposeTreatment      = "TREAT"
+	PurposePayment        = "HPAYMT"
+	PurposeOperations     = "HOPERAT"
+	PurposePatientRequest = "PATRQT"
+	PurposeLegal          = "HLEGAL"
+	PurposePublicHealth   = "PUBHLTH"
+)
+
+// PurposesOfUse lists the purpose-of-use codes clients may declare
+var PurposesOfUse = []string{
+	PurposeTreatment,
+	PurposePayment,
+	PurposeOperations,
+	PurposePatientRequest,
+	PurposeLegal,
+	PurposePublicHealth,
+}
+
+const phiAccessCollection = "phi_access_log"
+
+// PHIAccess describes who accessed a response, why, and what they saw. Fields defaults to
+// every answer key in the response.
+type PHIAccess struct {
+	Action    string
+	Purpose   string
+	ActorType string
+	ActorID   string
+	Recipient string
+	Fields    []string
+	IPAddress string
+}
+
+// PHIAccessLog records reads and disclosures of patient responses in Firestore so that an
+// organization can tell a patient who viewed or received their information. Unlike the
+// request audit log, every entry is linked to the patient the response belongs to.
+type PHIAccessLog struct {
+	client    *firestore.Client
+	encryptor *FieldEncryptor
+}
+
+// NewPHIAccessLog creates a new PHI access log
+func NewPHIAccessLog(client *firestore.Client, encryptor *FieldEncryptor) *PHIAccessLog {
+	return &PHIAccessLog{client: client, encryptor: encryptor}
+}
+
+// IsPurposeOfUse reports whether code is a supported purpose-of-use code
+func IsPurposeOfUse(code string) bool {
+	return containsString(PurposesOfUse, code)
+}
+
+// PatientKey returns the blind index that links access events to a patient
+func (l *PHIAccessLog) PatientKey(ctx context.Context, orgID, patientName, dateOfBirth string) (string, error) {
+	name := normalizePatientName(patientName)
+	if name == "" {
+		return "", nil
+	}
+	return l.encryptor.BlindIndex(ctx, orgID, "patient:"+name+"|"+dateOfBirth)
+}
+
+// Event builds the access event for a decrypted response without writing it
+func (l *PHIAccessLog) Event(ctx context.Context, response *data.FormResponse, access PHIAccess) (data.PHIAccessEvent, error) {
+	patientKey, err := l.PatientKey(ctx, response.OrganizationID, responsePatientName(response), responseDOB(response))
+	if err != nil {
+		return data.PHIAccessEvent{}, err
+	}
+
+	fields := access.Fields
+	if fields == nil {
+		fields = sortedKeys(response.Data)
+	}
+	purpose := access.Purpose
+	if purpose == "" {
+		purpose = PurposeTreatment
+	}
+	actorType := access.ActorType
+	if actorType == "" {
+		actorType = "user"
+	}
+
+	return data.PHIAccessEvent{
+		OrganizationID: response.OrganizationID,
+		ResponseID:     response.ID,
+		FormID:         response.FormID,
+		PatientKey:     patientKey,
+		Action:         access.Action,
+		Purpose:        purpose,
+		ActorType:      actorType,
+		ActorID:        access.ActorID,
+		Recipient:      access.Recipient,
+		Fields:         fields,
+		IPAddress:      access.IPAddress,
+		OccurredAt:     time.Now().UTC(),
+	}, nil
+}
+
+// Record writes one access event for a decrypted response
+func (l *PHIAccessLog) Record(ctx context.Context, response *data.FormResponse, access PHIAccess) error {
+	event, err := l.Event(ctx, response, access)
+	if err != nil {
+		return err
+	}
+	_, _, err = l.client.Collection(phiAccessCollection).Add(ctx, event)
+	return err
+}
+
+// RecordList records a list of decrypted responses with one event per patient: the
+// event names every response of that patient the list showed, so a long list stays a
+// handful of writes while the per-patient accounting still sees each disclosure
+func (l *PHIAccessLog) RecordList(ctx context.Context, responses []data.FormResponse, access PHIAccess) error {
+	var events []data.PHIAccessEvent
+	byPatient := map[string]int{}
+	for i := range responses {
+		event, err := l.Event(ctx, &responses[i], access)
+		if err != nil {
+			return err
+		}
+		n, seen := byPatient[event.PatientKey]
+		if !seen || event.PatientKey == "" {
+			byPatient[event.PatientKey] = len(events)
+			events = append(events, event)
+			continue
+		}
+		listed := &events[n]
+		if listed.ResponseID != "" {
+			listed.ResponseIDs = []string{listed.ResponseID}
+			listed.ResponseID = ""
+		}
+		listed.ResponseIDs = append(listed.ResponseIDs, event.ResponseID)
+		if listed.FormID != event.FormID {
+			listed.FormID = ""
+		}
+		listed.Fields = mergeFields(listed.Fields, event.Fields)
+	}
+
+	for start := 0; start < len(events); start += 500 {
+		end := start + 500
+		if end > len(events) {
+			end = len(events)
+		}
+		batch := l.client.Batch()
+		for _, event := range events[start:end] {
+			batch.Create(l.client.Collection(phiAccessCollection).NewDoc(), event)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFields returns the sorted union of two field lists
+func mergeFields(a, b []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, field := range append(append([]string{}, a...), b...) {
+		if !seen[field] {
+			seen[field] = true
+			merged = append(merged, field)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// RecordTx writes a prepared event inside the caller's transaction, so the disclosure and
+// its log entry commit together
+func (l *PHIAccessLog) RecordTx(tx *firestore.Transaction, event data.PHIAccessEvent) error {
+	return tx.Create(l.client.Collection(phiAccessCollection).NewDoc(), event)
+}
+
+// RecordByID loads and decrypts a response, then records an access to it
+func (l *PHIAccessLog) RecordByID(ctx context.Context, responseID string, access PHIAccess) error {
+	doc, err := l.client.Collection("form_responses").Doc(responseID).Get(ctx)
+	if err != nil {
+		return err
+	}
+	response, err := l.encryptor.OpenResponse(ctx, doc)
+	if err != nil {
+		return err
+	}
+	return l.Record(ctx, response, access)
+}
+
+// ForResponse returns the access events for a response, newest first, including list
+// events that name it among several responses
+func (l *PHIAccessLog) ForResponse(ctx context.Context, orgID, responseID string, limit int) ([]data.PHIAccessEvent, error) {
+	collection := l.client.Collection(phiAccessCollection).Where("organizationId", "==", orgID)
+	single, err := l.list(ctx, collection.Where("response_id", "==", responseID), limit)
+	if err != nil {
+		return nil, err
+	}
+	listed, err := l.list(ctx, collection.Where("response_ids", "array-contains", responseID), limit)
+	if err != nil {
+		return nil, err
+	}
+	events := append(single, listed...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].OccurredAt.After(events[j].OccurredAt) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// ForPatient returns the access events for every response linked to a patient, newest first.
+// Responses that recorded no date of birth are included for a matching name, since leaving a
+// disclosure out of the accounting is worse than listing one too many.
+func (l *PHIAccessLog) ForPatient(ctx context.Context, orgID, patientName, dateOfBirth string, limit int) ([]data.PHIAccessEvent, error) {
+	if normalizePatientName(patientName) == "" {
+		return nil, fmt.Errorf("%w: patient_name is required", ErrInvalidPatientMatch)
+	}
+
+	keys := []string{}
+	dobs := []string{""}
+	if dateOfBirth != "" {
+		dob, ok := normalizeDOB(dateOfBirth)
+		if !ok {
+			return nil, fmt.Errorf("%w: date_of_birth must be YYYY-MM-DD", ErrInvalidPatientMatch)
+		}
+		dobs = append(dobs, dob)
+	}
+	for _, dob := range dobs {
+		key, err := l.PatientKey(ctx, orgID, patientName, dob)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	query := l.client.Collection(phiAccessCollection).
+		Where("organizationId", "==", orgID).
+		Where("patient_key", "in", keys)
+	return l.list(ctx, query, limit)
+}
+
+func (l *PHIAccessLog) list(ctx context.Context, query firestore.Query, limit int) ([]data.PHIAccessEvent, error) {
+	iter := query.OrderBy("occurred_at", firestore.Desc).Limit(limit).Documents(ctx)
+	defer iter.Stop()
+
+	events := []data.PHIAccessEvent{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event data.PHIAccessEvent
+		if err := doc.DataTo(&event); err != nil {
+			return nil, err
+		}
+		event.ID = doc.Ref.ID
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// PatientAccessReport summarizes a patient's access events by action and by actor
+type PatientAccessReport struct {
+	PatientName string                `json:"patient_name"`
+	DateOfBirth string                `json:"date_of_birth,omitempty"`
+	ResponseIDs []string              `json:"response_ids"`
+	ByAction    map[string]int        `json:"by_action"`
+	ByActor     map[string]int        `json:"by_actor"`
+	Events      []data.PHIAccessEvent `json:"events"`
+}
+
+// PatientReport builds the per-patient access report
+func (l *PHIAccessLog) PatientReport(ctx context.Context, orgID, patientName, dateOfBirth string, limit int) (*PatientAccessReport, error) {
+	events, err := l.ForPatient(ctx, orgID, patientName, dateOfBirth, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PatientAccessReport{
+		PatientName: patientName,
+		DateOfBirth: dateOfBirth,
+		ResponseIDs: []string{},
+		ByAction:    map[string]int{},
+		ByActor:     map[string]int{},
+		Events:      events,
+	}
+	seen := map[string]bool{}
+	for _, event := range events {
+		report.ByAction[event.Action]++
+		report.ByActor[event.ActorType+":"+event.ActorID]++
+		for _, id := range append([]string{event.ResponseID}, event.ResponseIDs...) {
+			if id != "" && !seen[id] {
+				seen[id] = true
+				report.ResponseIDs = append(report.ResponseIDs, id)
+			}
+		}
+	}
+	sort.Strings(report.ResponseIDs)
+	return report, nil
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	reminderLockResource = "reminder-scheduler"
+	reminderLockTTL      = 5 * time.Minute
+	maxReminderOffset    = 30 * 24 // hours
+	// maxReminderAttempts bounds how often a failed reminder is sent again, one attempt per sweep
+	maxReminderAttempts = 3
+)
+
+// DefaultReminderSchedule applies when neither the share link nor the organization configures one.
+// Reminders are opt-in, so it is disabled; the offsets and channels are what an organization
+// gets when it enables reminders without choosing its own (48h and 4h before the deadline).
+var DefaultReminderSchedule = data.ReminderSchedule{
+	Enabled:      false,
+	OffsetsHours: []int{48, 4},
+	Channels:     []string{ChannelEmail, ChannelSMS},
+}
+
+// ReminderScheduler sends reminders for share links that have not received a response
+// before their deadline. Only one instance sweeps at a time (Redis DistributedLock), and
+// every reminder gets a deterministic reminder_logs document so it is sent once, or retried
+// up to maxReminderAttempts times when sending fails.
+type ReminderScheduler struct {
+	client      *firestore.Client
+	rdb         *redis.Client
+	sender      NotificationSender
+	auditLogger *AuditTrail
+	interval    time.Duration
+	baseURL     string
+}
+
+// NewReminderScheduler creates a new reminder scheduler. baseURL is the frontend origin
+// used to build the share links in reminders.
+func NewReminderScheduler(client *firestore.Client, rdb *redis.Client, sender NotificationSender, auditLogger *AuditTrail, baseURL string) *ReminderScheduler {
+	return &ReminderScheduler{
+		client:      client,
+		rdb:         rdb,
+		sender:      sender,
+		auditLogger: auditLogger,
+		interval:    5 * time.Minute,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// ValidateReminderSchedule checks a schedule supplied by an API client
+func ValidateReminderSchedule(schedule *data.ReminderSchedule) error {
+	if schedule == nil {
+		return nil
+	}
+	for _, offset := range schedule.OffsetsHours {
+		if offset <= 0 || offset > maxReminderOffset {
+			return fmt.Errorf("reminder offsets must be between 1 and %d hours", maxReminderOffset)
+		}
+	}
+	for _, channel := range schedule.Channels {
+		if channel != ChannelEmail && channel != ChannelSMS {
+			return fmt.Errorf("unsupported reminder channel: %s", channel)
+		}
+	}
+	if schedule.Enabled && (len(schedule.OffsetsHours) == 0 || len(schedule.Channels) == 0) {
+		return fmt.Errorf("an enabled reminder schedule needs at least one offset and one channel")
+	}
+	return nil
+}
+
+// Start runs the scheduler until ctx is cancelled
+func (s *ReminderScheduler) Start(ctx context.Context) {
+	log.Printf("REMINDERS: scheduler started (interval %v)", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := s.RunOnce(ctx); err != nil {
+			log.Printf("REMINDERS: sweep failed: %v", err)
+		} else if sent > 0 {
+			log.Printf("REMINDERS: sweep sent %d reminders", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("REMINDERS: scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce performs a single sweep and returns the number of reminders sent
+func (s *ReminderScheduler) RunOnce(ctx context.Context) (int, error) {
+	if s.rdb == nil {
+		// Without the lock multiple instances would race; skip rather than double-send
+		return 0, fmt.Errorf("redis unavailable, reminder sweep skipped")
+	}
+
+	lock := NewDistributedLock(s.rdb, reminderLockResource, reminderLockTTL)
+	acquired, err := lock.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, nil // Another instance is sweeping
+	}
+	defer lock.Release(context.Background())
+	extended := time.Now()
+
+	now := time.Now().UTC()
+	orgSchedules := make(map[string]*data.ReminderSchedule)
+	sent := 0
+
+	iter := s.client.Collection("share_links").Where("is_active", "==", true).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return sent, fmt.Errorf("failed to list share links: %w", err)
+		}
+
+		var link data.ShareLink
+		if err := doc.DataTo(&link); err != nil {
+			log.Printf("REMINDERS: skipping unparsable share link %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		link.ID = doc.Ref.ID
+
+		// Stop as soon as the patient has submitted, and never remind without a deadline
+		if link.ResponseCount > 0 || link.ExpiresAt.IsZero() || !now.Before(link.ExpiresAt) {
+			continue
+		}
+		if link.RecipientEmail == "" && link.RecipientPhone == "" {
+			continue
+		}
+
+		schedule := s.resolveSchedule(ctx, &link, orgSchedules)
+		if schedule == nil || !schedule.Enabled {
+			continue
+		}
+
+		// A long sweep can outlast the lock TTL: renew the lock as it goes, and stop before
+		// sending anything more once another instance has taken it over
+		if time.Since(extended) > reminderLockTTL/2 {
+			if err := lock.Extend(ctx, reminderLockTTL); err != nil {
+				return sent, fmt.Errorf("reminder sweep lost its lock: %w", err)
+			}
+			extended = time.Now()
+		} else if held, err := lock.IsHeld(ctx); err != nil {
+			return sent, err
+		} else if !held {
+			return sent, fmt.Errorf("reminder sweep lost its lock")
+		}
+
+		sent += s.processLink(ctx, &link, schedule, now)
+	}
+
+	return sent, nil
+}
+
+// resolveSchedule picks the link schedule, then the organization schedule, then the default
+func (s *ReminderScheduler) resolveSchedule(ctx context.Context, link *data.ShareLink, cache map[string]*data.ReminderSchedule) *data.ReminderSchedule {
+	if link.ReminderSchedule != nil {
+		return link.ReminderSchedule
+	}
+
+	if schedule, ok := cache[link.OrganizationID]; ok {
+		return schedule
+	}
+
+	schedule := &DefaultReminderSchedule
+	if link.OrganizationID != "" {
+		doc, err := s.client.Collection("organizations").Doc(link.OrganizationID).Get(ctx)
+		if err == nil {
+			var org data.Organization
+			if err := doc.DataTo(&org); err == nil && org.Settings.ReminderSchedule != nil {
+				schedule = org.Settings.ReminderSchedule
+			}
+		}
+	}
+	cache[link.OrganizationID] = schedule
+	return schedule
+}
+
+// processLink sends every due reminder for a link. Only the most recent due offset is sent,
+// so a link created inside the 48h window gets one reminder rather than a burst.
+func (s *ReminderScheduler) processLink(ctx context.Context, link *data.ShareLink, schedule *data.ReminderSchedule, now time.Time) int {
+	offsets := append([]int(nil), schedule.OffsetsHours...)
+	sort.Ints(offsets)
+
+	dueOffset := 0
+	for _, offset := range offsets {
+		if !now.Before(link.ExpiresAt.Add(-time.Duration(offset) * time.Hour)) {
+			dueOffset = offset
+			break
+		}
+	}
+	if dueOffset == 0 {
+		return 0
+	}
+
+	sent := 0
+	for _, channel := range schedule.Channels {
+		recipient := link.RecipientEmail
+		if channel == ChannelSMS {
+			recipient = link.RecipientPhone
+		}
+		if recipient == "" {
+			continue
+		}
+		if s.sendReminder(ctx, link, channel, recipient, dueOffset) {
+			sent++
+		}
+	}
+	return sent
+}
+
+// sendReminder claims the reminder via a deterministic log document, sends it, and audits the outcome
+func (s *ReminderScheduler) sendReminder(ctx context.Context, link *data.ShareLink, channel, recipient string, offset int) bool {
+	logID := fmt.Sprintf("%s_%dh_%s", link.ID, offset, channel)
+	logRef := s.client.Collection("reminder_logs").Doc(logID)
+
+	entry := data.ReminderLog{
+		ShareLinkID:    link.ID,
+		FormID:         link.FormID,
+		OrganizationID: link.OrganizationID,
+		Channel:        channel,
+		Recipient:      MaskRecipient(recipient),
+		OffsetHours:    offset,
+		ScheduledFor:   link.ExpiresAt.Add(-time.Duration(offset) * time.Hour),
+		Status:         "pending",
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	attempt, err := s.claimReminder(ctx, logRef, entry)
+	if err != nil {
+		log.Printf("REMINDERS: failed to record reminder %s: %v", logID, err)
+		return false
+	}
+	if attempt == 0 {
+		return false
+	}
+
+	sendErr := s.sender.Send(ctx, Notification{
+		Channel: channel,
+		To:      recipient,
+		Subject: "Reminder: please complete your intake forms",
+		Body:    s.reminderBody(link),
+		Metadata: map[string]string{
+			"share_link_id": link.ID,
+			"offset_hours":  fmt.Sprintf("%d", offset),
+		},
+	})
+
+	updates := []firestore.Update{}
+	if sendErr != nil {
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: "failed"},
+			firestore.Update{Path: "error", Value: sendErr.Error()},
+		)
+	} else {
+		updates = append(updates,
+			firestore.Update{Path: "status", Value: "sent"},
+			firestore.Update{Path: "sent_at", Value: time.Now().UTC()},
+			firestore.Update{Path: "error", Value: firestore.Delete},
+		)
+	}
+	if _, err := logRef.Update(ctx, updates); err != nil {
+		log.Printf("REMINDERS: failed to update reminder log %s: %v", logID, err)
+	}
+
+	if s.auditLogger != nil {
+		entry := AuditEntry{
+			Timestamp:    time.Now().UTC(),
+			UserID:       "system:reminder-scheduler",
+			Action:       "REMINDER_SENT",
+			ResourceType: "share_link",
+			ResourceID:   link.ID,
+			Success:      sendErr == nil,
+			Metadata: map[string]interface{}{
+				"organization_id": link.OrganizationID,
+				"channel":         channel,
+				"offset_hours":    offset,
+				"reminder_log_id": logID,
+				"attempt":         attempt,
+			},
+		}
+		if sendErr != nil {
+			entry.ErrorMsg = sendErr.Error()
+		}
+		s.auditLogger.LogAccess(ctx, entry)
+	}
+
+	if sendErr != nil {
+		if attempt < maxReminderAttempts {
+			log.Printf("REMINDERS: %s reminder for link %s failed (attempt %d of %d), retrying next sweep: %v", channel, link.ID, attempt, maxReminderAttempts, sendErr)
+		} else {
+			log.Printf("REMINDERS: %s reminder for link %s failed after %d attempts, giving up: %v", channel, link.ID, attempt, sendErr)
+		}
+		return false
+	}
+	return true
+}
+
+// claimReminder reserves a reminder for this sweep and returns the attempt number, or 0
+// when the reminder was sent, is being sent by another sweep, or has used up its attempts.
+// The log document is created on the first attempt; a failed send leaves it claimable again.
+func (s *ReminderScheduler) claimReminder(ctx context.Context, logRef *firestore.DocumentRef, entry data.ReminderLog) (int, error) {
+	attempt := 0
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		attempt = 0
+		doc, err := tx.Get(logRef)
+		if status.Code(err) == codes.NotFound {
+			attempt = 1
+			entry.Attempts = attempt
+			return tx.Create(logRef, entry)
+		}
+		if err != nil {
+			return err
+		}
+		var existing data.ReminderLog
+		if err := doc.DataTo(&existing); err != nil {
+			return err
+		}
+		if existing.Status != "failed" || existing.Attempts >= maxReminderAttempts {
+			return nil
+		}
+		attempt = existing.Attempts + 1
+		return tx.Update(logRef, []firestore.Update{
+			{Path: "status", Value: "pending"},
+			{Path: "attempts", Value: attempt},
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return attempt, nil
+}
+
+func (s *ReminderScheduler) reminderBody(link *data.ShareLink) string {
+	fillURL := fmt.Sprintf("%s/forms/%s/fill/%s", s.baseURL, link.FormID, link.ShareToken)
+	return fmt.Sprintf("You have intake forms to complete before your appointment. "+
+		"Please fill them out here before %s: %s",
+		link.ExpiresAt.Format("Jan 2, 2006 3:04 PM MST"), fillURL)
+}
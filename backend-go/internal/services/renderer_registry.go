@@ -7,6 +7,9 @@ import (
 	"time"
 
 	"backend-go/internal/services/renderers/templates"
+	"backend-go/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type RendererFunc func(PatternMetadata, *PDFContext) (string, error)
@@ -93,6 +96,9 @@ func (rr *RendererRegistry) wrapRenderer(renderer RendererFunc) RendererFunc {
 			OrganizationInfo: context.OrganizationInfo,
 			Answers:          validationResult.SanitizedData,
 			RequestID:        context.RequestID,
+			Ctx:              context.Ctx,
+			TemplateStore:    context.TemplateStore,
+			Attachments:      context.Attachments,
 		}
 		
 		// Call the actual renderer with sanitized data
@@ -100,8 +106,26 @@ func (rr *RendererRegistry) wrapRenderer(renderer RendererFunc) RendererFunc {
 	}
 }
 
-func (rr *RendererRegistry) Render(patternType string, metadata PatternMetadata, context *PDFContext) (string, error) {
+// Render renders one section. Each call gets its own span and is recorded in the
+// section latency histogram; failures are counted by RenderError code.
+func (rr *RendererRegistry) Render(patternType string, metadata PatternMetadata, context *PDFContext) (html string, err error) {
 	renderer, exists := rr.renderers[patternType]
+
+	// Pattern types can come from form metadata, so unknown ones share a label
+	section := patternType
+	if !exists {
+		section = "unregistered"
+	}
+	spanCtx, span := telemetry.StartSpan(context.Ctx, "pdf.render_section", attribute.String("pdf.section", section))
+	start := time.Now()
+	defer func() {
+		telemetry.PDFSectionDuration.WithLabelValues(section).Observe(time.Since(start).Seconds())
+		if renderErr, ok := err.(RenderError); ok {
+			telemetry.RenderErrors.WithLabelValues(renderErr.Code).Inc()
+		}
+		telemetry.EndSpan(span, err)
+	}()
+
 	if !exists {
 		return "", RenderError{
 			Code:      "RNDR-001",
@@ -118,8 +142,11 @@ func (rr *RendererRegistry) Render(patternType string, metadata PatternMetadata,
 	done := make(chan string, 1)
 	errChan := make(chan error, 1)
 
+	sectionContext := *context
+	sectionContext.Ctx = spanCtx
+
 	go func() {
-		html, err := renderer(metadata, context)
+		html, err := renderer(metadata, &sectionContext)
 		if err != nil {
 			errChan <- err
 		} else {
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrResponseNotFound is returned for responses that do not exist, are in the trash or
+// belong to another organization
+var ErrResponseNotFound = errors.New("form response not found")
+
+// ErrInvalidAmendment is returned for amendments that cannot be applied as requested
+var ErrInvalidAmendment = errors.New("invalid amendment")
+
+// Amendment is a correction to a response's answers. A nil value in Changes removes the
+// answer. The signed-in user who applies it is recorded as its author and approver.
+type Amendment struct {
+	Changes     map[string]interface{}
+	Reason      string
+	RequestedBy string
+}
+
+// AmendmentService applies amendments to submitted responses. The answers are updated in
+// place and every amendment is appended to the response's revision history, which is sealed
+// with the rest of its PHI, so purges, anonymization and archives cover it too.
+type AmendmentService struct {
+	client      *firestore.Client
+	events      *EventBus
+	encryptor   *FieldEncryptor
+	attachments *AttachmentService
+}
+
+// NewAmendmentService creates a new amendment service
+func NewAmendmentService(client *firestore.Client, events *EventBus, encryptor *FieldEncryptor, attachments *AttachmentService) *AmendmentService {
+	return &AmendmentService{client: client, events: events, encryptor: encryptor, attachments: attachments}
+}
+
+// Amend applies an amendment as the response's next revision and returns the amended
+// response. records are attachments extracted from the new values; they are saved in the
+// same transaction. Answers already holding the requested value are left out of the
+// revision, and an amendment that changes nothing is rejected.
+func (s *AmendmentService) Amend(ctx context.Context, orgID, authorID, responseID string, amendment Amendment, records []data.Attachment) (*data.FormResponse, error) {
+	amendment.Reason = strings.TrimSpace(amendment.Reason)
+	if amendment.Reason == "" {
+		return nil, fmt.Errorf("%w: a reason is required", ErrInvalidAmendment)
+	}
+	if len(amendment.Changes) == 0 {
+		return nil, fmt.Errorf("%w: no changes given", ErrInvalidAmendment)
+	}
+
+	ref := s.client.Collection("form_responses").Doc(responseID)
+	doc, err := ref.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrResponseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	formID, _ := doc.Data()["form"].(string)
+	questions, err := s.formQuestions(ctx, formID)
+	if err != nil {
+		return nil, err
+	}
+	// Load the key ring up front so a missing one is created outside the transaction
+	if _, err := s.encryptor.keyRing(ctx, orgID, 0); err != nil {
+		return nil, err
+	}
+
+	var amended data.FormResponse
+	err = s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrResponseNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			return nil, err
+		}
+		if response.OrganizationID != orgID || response.DeletedAt != nil {
+			return nil, ErrResponseNotFound
+		}
+		if response.AnonymizedAt != nil {
+			return nil, fmt.Errorf("%w: the response has been anonymized", ErrInvalidAmendment)
+		}
+		if response.Encrypted != nil {
+			if err := s.encryptor.openResponseFields(ctx, ref.ID, &response); err != nil {
+				return nil, err
+			}
+		}
+
+		changes, err := diffAnswers(response.Data, amendment.Changes, questions)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		revision := data.ResponseRevision{
+			Revision:    response.Revision + 1,
+			Changes:     changes,
+			Reason:      amendment.Reason,
+			RequestedBy: amendment.RequestedBy,
+			AuthorID:    authorID,
+			ApprovedBy:  authorID,
+			CreatedAt:   now,
+		}
+		if response.Data == nil {
+			response.Data = map[string]interface{}{}
+		}
+		for _, change := range changes {
+			if change.NewValue == nil {
+				delete(response.Data, change.Field)
+			} else {
+				response.Data[change.Field] = change.NewValue
+			}
+		}
+		if name := ExtractPatientName(response.Data); name != "" {
+			response.PatientName = name
+		}
+		response.Revision = revision.Revision
+		response.AmendedAt = &now
+		response.Revisions = append(response.Revisions, revision)
+		// A corrected name, date of birth or phone changes which patient the response matches
+		if response.IdentityKeys, err = s.encryptor.PatientIdentityKeys(ctx, orgID, response.Data); err != nil {
+			return nil, err
+		}
+		var identityKeys interface{} = response.IdentityKeys
+		if len(response.IdentityKeys) == 0 {
+			identityKeys = firestore.Delete
+		}
+
+		sealed, err := s.encryptor.SealResponse(ctx, ref.ID, response)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.attachments.SaveRecords(tx, records); err != nil {
+			return nil, err
+		}
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "encrypted_phi", Value: sealed.Encrypted},
+			{Path: "response_data", Value: firestore.Delete},
+			{Path: "patient_name", Value: firestore.Delete},
+			{Path: "ip_address", Value: firestore.Delete},
+			{Path: "identity_keys", Value: identityKeys},
+			{Path: "revision", Value: revision.Revision},
+			{Path: "amended_at", Value: now},
+		}); err != nil {
+			return nil, err
+		}
+
+		response.ID = ref.ID
+		response.Encrypted = nil
+		amended = response
+		return []data.DomainEvent{
+			NewDomainEvent(DomainResponseAmended, orgID, "response", ref.ID, authorID, map[string]interface{}{
+				"response_id": ref.ID,
+				"form_id":     response.FormID,
+				"revision":    revision.Revision,
+				"fields":      ChangedFields([]data.ResponseRevision{revision}),
+			}),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &amended, nil
+}
+
+// formQuestions returns the names of the questions on a form. It returns nil when the
+// form no longer exists, in which case only answered questions can be amended.
+func (s *AmendmentService) formQuestions(ctx context.Context, formID string) (map[string]bool, error) {
+	if formID == "" {
+		return nil, nil
+	}
+	doc, err := s.client.Collection("forms").Doc(formID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var form data.Form
+	if err := doc.DataTo(&form); err != nil {
+		return nil, err
+	}
+	questions := map[string]bool{}
+	for _, element := range extractElements(form.SurveyJSON) {
+		if name, _ := element["name"].(string); name != "" {
+			questions[name] = true
+		}
+	}
+	return questions, nil
+}
+
+// diffAnswers turns requested values into field changes against the current answers,
+// sorted by field. Fields must already be answered or be questions on the form.
+func diffAnswers(current, requested map[string]interface{}, questions map[string]bool) ([]data.FieldChange, error) {
+	changes := []data.FieldChange{}
+	for field, value := range requested {
+		old, answered := current[field]
+		if !answered && !questions[field] {
+			return nil, fmt.Errorf("%w: %q is not a question on this form", ErrInvalidAmendment, field)
+		}
+		if reflect.DeepEqual(old, value) {
+			continue
+		}
+		changes = append(changes, data.FieldChange{Field: field, OldValue: old, NewValue: value})
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("%w: the answers already have the requested values", ErrInvalidAmendment)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// ChangedFields lists the fields touched by a set of revisions, in order of first change
+func ChangedFields(revisions []data.ResponseRevision) []string {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, revision := range revisions {
+		for _, change := range revision.Changes {
+			if !seen[change.Field] {
+				seen[change.Field] = true
+				fields = append(fields, change.Field)
+			}
+		}
+	}
+	return fields
+}
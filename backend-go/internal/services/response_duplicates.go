@@ -0,0 +1,486 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Duplicate flag states
+const (
+	DuplicatePending   = "pending"
+	DuplicateMerged    = "merged"
+	DuplicateDismissed = "dismissed"
+)
+
+// Sides of a duplicate pair a merge can take an answer from
+const (
+	MergeOriginal  = "original"
+	MergeDuplicate = "duplicate"
+)
+
+// ErrNotPendingDuplicate is returned when merging or dismissing a response that is not
+// flagged, or whose flag was already resolved
+var ErrNotPendingDuplicate = errors.New("response is not a pending duplicate")
+
+// ErrInvalidMerge is returned for merge choices that cannot be applied
+var ErrInvalidMerge = errors.New("invalid merge")
+
+// phoneAnswerKeys are the answer keys forms use for the patient's phone number
+var phoneAnswerKeys = []string{"phone", "phone_number", "primary_phone", "cell_phone", "mobile_phone", "home_phone"}
+
+// maxDuplicateCandidates bounds how many earlier responses are opened per submission
+const maxDuplicateCandidates = 20
+
+// DuplicateService flags responses that are likely resubmissions of an earlier response
+// by the same patient, and resolves the flags from the review queue. Patients are matched
+// on any two of name, date of birth and phone through blind indexes, so identities are
+// never stored or queried in plaintext.
+type DuplicateService struct {
+	client        *firestore.Client
+	events        *EventBus
+	encryptor     *FieldEncryptor
+	window        time.Duration
+	minSimilarity float64
+}
+
+// NewDuplicateService creates a new duplicate service. Responses submitted within window
+// of each other whose answers match at least minSimilarity are flagged.
+func NewDuplicateService(client *firestore.Client, events *EventBus, encryptor *FieldEncryptor, window time.Duration, minSimilarity float64) *DuplicateService {
+	return &DuplicateService{client: client, events: events, encryptor: encryptor, window: window, minSimilarity: minSimilarity}
+}
+
+// PatientIdentityKeys returns the blind indexes identifying the patient who gave answers:
+// one for each pair of normalized name, date of birth and phone that is present
+func (e *FieldEncryptor) PatientIdentityKeys(ctx context.Context, orgID string, answers map[string]interface{}) ([]string, error) {
+	parts := patientIdentity(answers)
+	var keys []string
+	for i, a := range identityParts {
+		for _, b := range identityParts[i+1:] {
+			if parts[a] == "" || parts[b] == "" {
+				continue
+			}
+			key, err := e.BlindIndex(ctx, orgID, fmt.Sprintf("identity:%s=%s|%s=%s", a, parts[a], b, parts[b]))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+var identityParts = []string{"name", "date_of_birth", "phone"}
+
+// patientIdentity normalizes the name, date of birth and phone answers of a response
+func patientIdentity(answers map[string]interface{}) map[string]string {
+	name := ExtractPatientName(answers)
+	if name == "" {
+		name, _ = answers["patient_name"].(string)
+	}
+	parts := map[string]string{
+		"name":          normalizePatientName(name),
+		"date_of_birth": responseDOB(&data.FormResponse{Data: answers}),
+	}
+	for _, key := range phoneAnswerKeys {
+		if value, ok := answers[key].(string); ok {
+			if phone := normalizePhone(value); phone != "" {
+				parts["phone"] = phone
+				break
+			}
+		}
+	}
+	return parts
+}
+
+// normalizePhone keeps the digits of a phone number, without a leading US country code. It
+// returns "" for values too short to be a phone number.
+func normalizePhone(value string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	if len(digits) < 7 {
+		return ""
+	}
+	return digits
+}
+
+// Detect sets the patient identity keys on a response about to be submitted and, when an
+// earlier response to the same form from the same patient has similar answers, flags it as
+// that response's duplicate. response holds plaintext answers and has no ID yet.
+func (s *DuplicateService) Detect(ctx context.Context, response *data.FormResponse) error {
+	keys, err := s.encryptor.PatientIdentityKeys(ctx, response.OrganizationID, response.Data)
+	if err != nil {
+		return err
+	}
+	response.IdentityKeys = keys
+	if len(keys) == 0 || response.FormID == "" {
+		return nil
+	}
+
+	since := time.Now().Add(-s.window)
+	iter := s.client.Collection("form_responses").
+		Where("form", "==", response.FormID).
+		Where("identity_keys", "array-contains-any", keys).
+		Where("submitted_at", ">=", since).
+		Limit(maxDuplicateCandidates).
+		Documents(ctx)
+	defer iter.Stop()
+
+	identity := patientIdentity(response.Data)
+	var best *data.DuplicateFlag
+	var bestAt time.Time
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		candidate, err := s.encryptor.OpenResponse(ctx, doc)
+		if err != nil {
+			logging.FromContext(ctx).Warn("DUPLICATES: skipping unreadable response", "response_id", doc.Ref.ID, "error", err)
+			continue
+		}
+		if candidate.OrganizationID != response.OrganizationID || candidate.DeletedAt != nil || candidate.MergedInto != "" {
+			continue
+		}
+
+		score := answerSimilarity(candidate.Data, response.Data)
+		if score < s.minSimilarity || (best != nil && score <= best.Score) {
+			continue
+		}
+		var matched []string
+		other := patientIdentity(candidate.Data)
+		for _, part := range identityParts {
+			if identity[part] != "" && identity[part] == other[part] {
+				matched = append(matched, part)
+			}
+		}
+		best = &data.DuplicateFlag{Of: doc.Ref.ID, Score: score, MatchedOn: matched, Status: DuplicatePending}
+		bestAt = candidate.SubmittedAt
+	}
+	if best != nil {
+		best.FlaggedAt = time.Now().UTC()
+		response.Duplicate = best
+		logging.FromContext(ctx).Info("DUPLICATES: response flagged as a duplicate",
+			"form_id", response.FormID, "duplicate_of", best.Of, "duplicate_submitted_at", bestAt, "score", best.Score)
+	}
+	return nil
+}
+
+// DuplicateFlaggedEvent returns the event recording a duplicate flag, or nil when the
+// response was not flagged
+func DuplicateFlaggedEvent(responseID string, response *data.FormResponse) *data.DomainEvent {
+	if response.Duplicate == nil {
+		return nil
+	}
+	event := NewDomainEvent(DomainDuplicateFlagged, response.OrganizationID, "response", responseID, "", map[string]interface{}{
+		"response_id":  responseID,
+		"form_id":      response.FormID,
+		"duplicate_of": response.Duplicate.Of,
+	})
+	return &event
+}
+
+// answerSimilarity is the share of answered questions, across both responses, that have the
+// same answer in each. Uploaded files are not compared.
+func answerSimilarity(a, b map[string]interface{}) float64 {
+	questions := map[string]bool{}
+	for _, answers := range []map[string]interface{}{a, b} {
+		for key, value := range answers {
+			if comparableAnswer(value) {
+				questions[key] = true
+			}
+		}
+	}
+	if len(questions) == 0 {
+		return 0
+	}
+	same := 0
+	for key := range questions {
+		if normalizeAnswer(a[key]) == normalizeAnswer(b[key]) {
+			same++
+		}
+	}
+	return float64(same) / float64(len(questions))
+}
+
+func comparableAnswer(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return strings.TrimSpace(v) != "" && !IsAttachmentRef(v) && !strings.HasPrefix(v, "data:")
+	}
+	return true
+}
+
+// normalizeAnswer ignores case and spacing in text answers
+func normalizeAnswer(value interface{}) string {
+	if !comparableAnswer(value) {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+// Pending lists the organization's unresolved duplicate flags, most recent first
+func (s *DuplicateService) Pending(ctx context.Context, orgID string, limit int) ([]data.DuplicateCandidate, error) {
+	docs, err := s.client.Collection("form_responses").
+		Where("organizationId", "==", orgID).
+		Where("duplicate.status", "==", DuplicatePending).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	candidates := []data.DuplicateCandidate{}
+	for _, doc := range docs {
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			logging.FromContext(ctx).Warn("DUPLICATES: skipping unreadable response", "response_id", doc.Ref.ID, "error", err)
+			continue
+		}
+		if response.DeletedAt != nil || response.Duplicate == nil {
+			continue
+		}
+		candidates = append(candidates, data.DuplicateCandidate{
+			ResponseID:  doc.Ref.ID,
+			DuplicateOf: response.Duplicate.Of,
+			FormID:      response.FormID,
+			Score:       response.Duplicate.Score,
+			MatchedOn:   response.Duplicate.MatchedOn,
+			SubmittedAt: response.SubmittedAt,
+			FlaggedAt:   response.Duplicate.FlaggedAt,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].FlaggedAt.After(candidates[j].FlaggedAt) })
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// Dismiss resolves a duplicate flag without merging, leaving both responses as they are
+func (s *DuplicateService) Dismiss(ctx context.Context, orgID, userID, responseID string) error {
+	ref := s.client.Collection("form_responses").Doc(responseID)
+	return s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		response, err := s.pendingDuplicate(tx, ref, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Update(ref, resolveDuplicate(DuplicateDismissed, userID)); err != nil {
+			return nil, err
+		}
+		return []data.DomainEvent{
+			NewDomainEvent(DomainDuplicateDismissed, orgID, "response", responseID, userID, map[string]interface{}{
+				"response_id":  responseID,
+				"duplicate_of": response.Duplicate.Of,
+			}),
+		}, nil
+	})
+}
+
+// Merge combines a flagged response with the response it duplicates into a new response.
+// Each answer comes from the side named in fields, falling back to prefer and then to
+// whichever side answered the question. prefer defaults to the duplicate, the more recent
+// submission. Both originals are kept unchanged apart from a link to the merged response;
+// uploaded files stay with the original they were submitted on.
+func (s *DuplicateService) Merge(ctx context.Context, orgID, userID, responseID, prefer string, fields map[string]string) (*data.FormResponse, error) {
+	if prefer == "" {
+		prefer = MergeDuplicate
+	}
+	if prefer != MergeOriginal && prefer != MergeDuplicate {
+		return nil, fmt.Errorf("%w: prefer must be %q or %q", ErrInvalidMerge, MergeOriginal, MergeDuplicate)
+	}
+	for field, side := range fields {
+		if side != MergeOriginal && side != MergeDuplicate {
+			return nil, fmt.Errorf("%w: %q must be %q or %q", ErrInvalidMerge, field, MergeOriginal, MergeDuplicate)
+		}
+	}
+	// Load the key ring up front so a missing one is created outside the transaction
+	if _, err := s.encryptor.keyRing(ctx, orgID, 0); err != nil {
+		return nil, err
+	}
+
+	duplicateRef := s.client.Collection("form_responses").Doc(responseID)
+	mergedRef := s.client.Collection("form_responses").NewDoc()
+	var merged data.FormResponse
+	err := s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		duplicate, err := s.pendingDuplicate(tx, duplicateRef, orgID)
+		if err != nil {
+			return nil, err
+		}
+		originalRef := s.client.Collection("form_responses").Doc(duplicate.Duplicate.Of)
+		doc, err := tx.Get(originalRef)
+		if status.Code(err) == codes.NotFound {
+			return nil, fmt.Errorf("%w: the original response no longer exists", ErrInvalidMerge)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var original data.FormResponse
+		if err := doc.DataTo(&original); err != nil {
+			return nil, err
+		}
+		if original.OrganizationID != orgID || original.DeletedAt != nil || original.MergedInto != "" {
+			return nil, fmt.Errorf("%w: the original response is deleted or already merged", ErrInvalidMerge)
+		}
+		for _, response := range []*data.FormResponse{&original, duplicate} {
+			if response.AnonymizedAt != nil {
+				return nil, fmt.Errorf("%w: a response has been anonymized", ErrInvalidMerge)
+			}
+		}
+		for id, response := range map[string]*data.FormResponse{originalRef.ID: &original, duplicateRef.ID: duplicate} {
+			if response.Encrypted == nil {
+				continue
+			}
+			if err := s.encryptor.openResponseFields(ctx, id, response); err != nil {
+				return nil, err
+			}
+		}
+
+		answers, fromOriginal, err := mergeAnswers(original.Data, duplicate.Data, prefer, fields)
+		if err != nil {
+			return nil, err
+		}
+		merged = data.FormResponse{
+			OrganizationID: orgID,
+			FormID:         duplicate.FormID,
+			Data:           answers,
+			Metadata:       duplicate.Metadata,
+			SubmittedBy:    duplicate.SubmittedBy,
+			SubmittedAt:    duplicate.SubmittedAt,
+			FormTitle:      duplicate.FormTitle,
+			PatientName:    ExtractPatientName(answers),
+			MergedFrom:     []string{originalRef.ID, duplicateRef.ID},
+		}
+		if merged.PatientName == "" {
+			merged.PatientName = duplicate.PatientName
+		}
+		if merged.IdentityKeys, err = s.encryptor.PatientIdentityKeys(ctx, orgID, answers); err != nil {
+			return nil, err
+		}
+		sealed, err := s.encryptor.SealResponse(ctx, mergedRef.ID, merged)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tx.Create(mergedRef, sealed); err != nil {
+			return nil, err
+		}
+		if err := tx.Update(originalRef, []firestore.Update{{Path: "merged_into", Value: mergedRef.ID}}); err != nil {
+			return nil, err
+		}
+		updates := append(resolveDuplicate(DuplicateMerged, userID), firestore.Update{Path: "merged_into", Value: mergedRef.ID})
+		if err := tx.Update(duplicateRef, updates); err != nil {
+			return nil, err
+		}
+
+		merged.ID = mergedRef.ID
+		return []data.DomainEvent{
+			NewDomainEvent(DomainResponsesMerged, orgID, "response", mergedRef.ID, userID, map[string]interface{}{
+				"response_id":     mergedRef.ID,
+				"form_id":         merged.FormID,
+				"merged_from":     merged.MergedFrom,
+				"original_fields": fromOriginal,
+			}),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// pendingDuplicate reads a response in the transaction and checks it is an unresolved
+// duplicate of the organization
+func (s *DuplicateService) pendingDuplicate(tx *firestore.Transaction, ref *firestore.DocumentRef, orgID string) (*data.FormResponse, error) {
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrResponseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var response data.FormResponse
+	if err := doc.DataTo(&response); err != nil {
+		return nil, err
+	}
+	if response.OrganizationID != orgID || response.DeletedAt != nil {
+		return nil, ErrResponseNotFound
+	}
+	if response.Duplicate == nil || response.Duplicate.Status != DuplicatePending || response.MergedInto != "" {
+		return nil, ErrNotPendingDuplicate
+	}
+	return &response, nil
+}
+
+func resolveDuplicate(state, userID string) []firestore.Update {
+	return []firestore.Update{
+		{Path: "duplicate.status", Value: state},
+		{Path: "duplicate.resolved_by", Value: userID},
+		{Path: "duplicate.resolved_at", Value: time.Now().UTC()},
+	}
+}
+
+// mergeAnswers picks each answer of a merge and returns the merged answers and, sorted, the
+// questions whose answer came from the original
+func mergeAnswers(original, duplicate map[string]interface{}, prefer string, fields map[string]string) (map[string]interface{}, []string, error) {
+	for field := range fields {
+		_, inOriginal := original[field]
+		_, inDuplicate := duplicate[field]
+		if !inOriginal && !inDuplicate {
+			return nil, nil, fmt.Errorf("%w: %q is not answered in either response", ErrInvalidMerge, field)
+		}
+	}
+
+	answers := map[string]interface{}{}
+	fromOriginal := []string{}
+	questions := map[string]bool{}
+	for key := range original {
+		questions[key] = true
+	}
+	for key := range duplicate {
+		questions[key] = true
+	}
+	for key := range questions {
+		side := prefer
+		if chosen, ok := fields[key]; ok {
+			side = chosen
+		}
+		originalValue, inOriginal := original[key]
+		duplicateValue, inDuplicate := duplicate[key]
+		if (side == MergeOriginal && inOriginal) || !inDuplicate {
+			answers[key] = originalValue
+			fromOriginal = append(fromOriginal, key)
+		} else {
+			answers[key] = duplicateValue
+		}
+	}
+	sort.Strings(fromOriginal)
+	return answers, fromOriginal, nil
+}
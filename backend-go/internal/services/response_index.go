@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+
+	"backend-go/internal/data"
+
+	"cloud.google.com/go/firestore"
+)
+
+// ExtractPatientName derives the patient's full name from the first_name and last_name
+// answers of a response. It returns "" when neither is present.
+func ExtractPatientName(responseData map[string]interface{}) string {
+	firstName, _ := responseData["first_name"].(string)
+	lastName, _ := responseData["last_name"].(string)
+
+	switch {
+	case firstName != "" && lastName != "":
+		return firstName + " " + lastName
+	case firstName != "":
+		return firstName
+	default:
+		return lastName
+	}
+}
+
+// ReindexResponse recomputes a response's derived fields from its answers and seals it
+// under the organization's current data key. patient_name is the derived field: the API
+// fills it on submit, so responses written by older code or edited outside the API can
+// carry a stale or empty name. It reports whether the document was rewritten.
+func (e *FieldEncryptor) ReindexResponse(ctx context.Context, ref *firestore.DocumentRef) (bool, error) {
+	// Load the key ring up front so a missing one is created outside the transaction
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return false, err
+	}
+	orgID, _ := doc.Data()["organizationId"].(string)
+	if _, err := e.keyRing(ctx, orgID, 0); err != nil {
+		return false, err
+	}
+
+	rewritten := false
+	err = e.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		rewritten = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			return err
+		}
+		stale := e.needsRewrite(ctx, response.OrganizationID, response.Encrypted)
+
+		if response.Encrypted != nil {
+			if err := e.openResponseFields(ctx, ref.ID, &response); err != nil {
+				return err
+			}
+		}
+		patientName := response.PatientName
+		if derived := ExtractPatientName(response.Data); derived != "" {
+			patientName = derived
+		}
+		if !stale && patientName == response.PatientName {
+			return nil
+		}
+
+		response.PatientName = patientName
+		sealed, err := e.SealResponse(ctx, ref.ID, response)
+		if err != nil {
+			return err
+		}
+
+		rewritten = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "encrypted_phi", Value: sealed.Encrypted},
+			{Path: "response_data", Value: firestore.Delete},
+			{Path: "patient_name", Value: firestore.Delete},
+			{Path: "ip_address", Value: firestore.Delete},
+		})
+	})
+	return rewritten, err
+}
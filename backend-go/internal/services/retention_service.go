@@ -0,0 +1,912 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Retention actions an organization can choose for data past its retention window
+const (
+	RetentionPurge     = "purge"
+	RetentionAnonymize = "anonymize"
+)
+
+const (
+	retentionLockResource = "retention-sweeper"
+	retentionLockTTL      = 30 * time.Minute
+	deletionLogCollection = "deletion_log"
+	deletionLogHeads      = "deletion_log_heads"
+	maxRetentionItems     = 500
+)
+
+// ErrLegalHold is returned when a resource cannot be deleted because of an active legal hold
+var ErrLegalHold = errors.New("resource is under legal hold")
+
+// ErrDeletionLogTampered is returned when the deletion log hash chain does not verify
+var ErrDeletionLogTampered = errors.New("deletion log verification failed")
+
+// errRetentionSkipped aborts a retention transaction when the resource no longer qualifies
+var errRetentionSkipped = errors.New("resource no longer eligible for retention")
+
+// RetentionService enforces OrganizationSettings.DataRetentionDays. Each resource is retired
+// in its own transaction that re-checks eligibility and legal holds and appends to the
+// organization's hash-chained deletion log, so overlapping sweeps cannot double-delete or
+// fork the chain. The Redis lock only keeps instances from duplicating work.
+//
+// PDFs are rendered on demand and never stored on their own; the only archived PDFs are
+// the ones inside stored patient export archives, which the sweep retires along with
+// organization backups.
+type RetentionService struct {
+	client      *firestore.Client
+	rdb         *redis.Client
+	store       BlobStore
+	attachments *AttachmentService
+	encryptor   *FieldEncryptor
+	auditLogger *AuditTrail
+	interval    time.Duration
+}
+
+type retentionPolicy struct {
+	orgID  string
+	days   int
+	action string
+}
+
+// deletionLogHead tracks the tip of an organization's deletion log chain
+type deletionLogHead struct {
+	Sequence  int64     `firestore:"sequence"`
+	Hash      string    `firestore:"hash"`
+	UpdatedAt time.Time `firestore:"updated_at"`
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(client *firestore.Client, rdb *redis.Client, store BlobStore, attachments *AttachmentService, encryptor *FieldEncryptor, auditLogger *AuditTrail) *RetentionService {
+	return &RetentionService{
+		client:      client,
+		rdb:         rdb,
+		store:       store,
+		attachments: attachments,
+		encryptor:   encryptor,
+		auditLogger: auditLogger,
+		interval:    time.Hour,
+	}
+}
+
+// ValidateRetentionSettings checks retention settings supplied by an API client
+func ValidateRetentionSettings(days int, action string) error {
+	if days < 0 {
+		return fmt.Errorf("data_retention_days cannot be negative")
+	}
+	if action != "" && action != RetentionPurge && action != RetentionAnonymize {
+		return fmt.Errorf("retention_action must be %q or %q", RetentionPurge, RetentionAnonymize)
+	}
+	return nil
+}
+
+// Start runs the sweeper until ctx is cancelled
+func (s *RetentionService) Start(ctx context.Context) {
+	logging.FromContext(ctx).Info("RETENTION: sweeper started", "interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if retired, err := s.RunOnce(ctx); err != nil {
+			logging.FromContext(ctx).Error("RETENTION: sweep failed", "error", err)
+		} else if retired > 0 {
+			logging.FromContext(ctx).Info("RETENTION: sweep complete", "retired", retired)
+		}
+
+		select {
+		case <-ctx.Done():
+			logging.FromContext(ctx).Info("RETENTION: sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sweeps every organization with a retention window and returns the number of
+// resources purged or anonymized
+func (s *RetentionService) RunOnce(ctx context.Context) (int, error) {
+	if s.rdb != nil {
+		lock := NewDistributedLock(s.rdb, retentionLockResource, retentionLockTTL)
+		acquired, err := lock.Acquire(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if !acquired {
+			return 0, nil // Another instance is sweeping
+		}
+		defer lock.Release(context.Background())
+	}
+
+	policies, err := s.policies(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	retired := 0
+	for _, policy := range policies {
+		report, err := s.sweep(ctx, policy, false)
+		if err != nil {
+			logging.FromContext(ctx).Error("RETENTION: organization sweep failed", "organization_id", policy.orgID, "error", err)
+			continue
+		}
+		count := 0
+		for resourceType, n := range report.Counts {
+			if resourceType != "held" {
+				count += n
+			}
+		}
+		retired += count
+
+		if count > 0 && s.auditLogger != nil {
+			metadata := map[string]interface{}{"retention_days": policy.days, "action": policy.action}
+			for resourceType, n := range report.Counts {
+				metadata[resourceType] = n
+			}
+			s.auditLogger.LogAccess(ctx, AuditEntry{
+				Timestamp:    time.Now().UTC(),
+				UserID:       "system",
+				Action:       "RETENTION_SWEEP",
+				ResourceType: "organization",
+				ResourceID:   policy.orgID,
+				Success:      true,
+				Metadata:     metadata,
+			})
+		}
+	}
+	return retired, nil
+}
+
+// Report returns what a sweep of the organization would do right now, without changing anything
+func (s *RetentionService) Report(ctx context.Context, orgID string) (*data.RetentionReport, error) {
+	policy, err := s.policyFor(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if policy.days <= 0 {
+		return &data.RetentionReport{
+			OrganizationID: orgID,
+			Action:         policy.action,
+			DryRun:         true,
+			GeneratedAt:    time.Now().UTC(),
+			Counts:         map[string]int{},
+			Items:          []data.RetentionItem{},
+		}, nil
+	}
+	return s.sweep(ctx, policy, true)
+}
+
+// policies collects the retention settings of every organization that has a window.
+// Organization documents are keyed "org-<uid>" or "<uid>", while their data uses the UID.
+func (s *RetentionService) policies(ctx context.Context) ([]retentionPolicy, error) {
+	byOrg := map[string]retentionPolicy{}
+	iter := s.client.Collection("organizations").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organizations: %w", err)
+		}
+		var org data.Organization
+		if err := doc.DataTo(&org); err != nil || org.Settings.DataRetentionDays <= 0 {
+			continue
+		}
+		orgID := org.UID
+		if orgID == "" {
+			orgID = strings.TrimPrefix(doc.Ref.ID, "org-")
+		}
+		// Settings live on org-<uid>; a bare <uid> document only counts when that one is missing
+		if _, seen := byOrg[orgID]; !seen || strings.HasPrefix(doc.Ref.ID, "org-") {
+			byOrg[orgID] = newRetentionPolicy(orgID, org.Settings)
+		}
+	}
+
+	policies := make([]retentionPolicy, 0, len(byOrg))
+	for _, policy := range byOrg {
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// policyFor reads one organization's retention settings
+func (s *RetentionService) policyFor(ctx context.Context, orgID string) (retentionPolicy, error) {
+	for _, docID := range []string{"org-" + orgID, orgID} {
+		doc, err := s.client.Collection("organizations").Doc(docID).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return retentionPolicy{}, err
+		}
+		var org data.Organization
+		if err := doc.DataTo(&org); err != nil {
+			return retentionPolicy{}, err
+		}
+		if org.Settings.DataRetentionDays > 0 {
+			return newRetentionPolicy(orgID, org.Settings), nil
+		}
+	}
+	return retentionPolicy{orgID: orgID, action: RetentionPurge}, nil
+}
+
+// reason is the deletion log reason for resources this policy retires
+func (p retentionPolicy) reason() string {
+	return fmt.Sprintf("retention: older than %d days", p.days)
+}
+
+func newRetentionPolicy(orgID string, settings data.OrganizationSettings) retentionPolicy {
+	action := settings.RetentionAction
+	if action != RetentionAnonymize {
+		action = RetentionPurge
+	}
+	return retentionPolicy{orgID: orgID, days: settings.DataRetentionDays, action: action}
+}
+
+// sweep retires everything past the policy's window, or only reports it when dryRun is set
+func (s *RetentionService) sweep(ctx context.Context, policy retentionPolicy, dryRun bool) (*data.RetentionReport, error) {
+	now := time.Now().UTC()
+	cutoff := now.AddDate(0, 0, -policy.days)
+	report := &data.RetentionReport{
+		OrganizationID: policy.orgID,
+		RetentionDays:  policy.days,
+		Action:         policy.action,
+		Cutoff:         cutoff,
+		DryRun:         dryRun,
+		GeneratedAt:    now,
+		Counts:         map[string]int{},
+		Items:          []data.RetentionItem{},
+	}
+
+	holds, err := s.activeHolds(ctx, nil, policy.orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses, including unfinished drafts, together with their attachments
+	handled := map[string]bool{}
+	iter := s.client.Collection("form_responses").
+		Where("organizationId", "==", policy.orgID).
+		Where("submitted_at", "<", cutoff).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to list responses: %w", err)
+		}
+		handled[doc.Ref.ID] = true
+
+		var response data.FormResponse
+		if err := doc.DataTo(&response); err != nil {
+			logging.FromContext(ctx).Warn("RETENTION: skipping unparsable response", "response_id", doc.Ref.ID, "error", err)
+			continue
+		}
+		if policy.action == RetentionAnonymize && response.AnonymizedAt != nil {
+			continue
+		}
+
+		item := data.RetentionItem{ResourceType: "response", ResourceID: doc.Ref.ID, CreatedAt: response.SubmittedAt, Action: policy.action}
+		hold, err := s.matchHold(ctx, holds, doc)
+		if err != nil {
+			return report, err
+		}
+		if hold != nil {
+			item.Action, item.HoldID = "held", hold.ID
+			addRetentionItem(report, item)
+			continue
+		}
+		if !dryRun {
+			err := s.retireResponse(ctx, policy, doc.Ref, cutoff)
+			if errors.Is(err, errRetentionSkipped) {
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("response %s: %w", doc.Ref.ID, err)
+			}
+		}
+		addRetentionItem(report, item)
+	}
+
+	// Attachments left behind by responses that no longer exist
+	attachmentIter := s.client.Collection("attachments").
+		Where("organizationId", "==", policy.orgID).
+		Where("created_at", "<", cutoff).
+		Documents(ctx)
+	defer attachmentIter.Stop()
+	for {
+		doc, err := attachmentIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to list attachments: %w", err)
+		}
+		var record data.Attachment
+		if err := doc.DataTo(&record); err != nil || handled[record.ResponseID] {
+			continue
+		}
+		record.ID = doc.Ref.ID
+
+		item := data.RetentionItem{ResourceType: "attachment", ResourceID: record.ID, CreatedAt: record.CreatedAt, Action: RetentionPurge}
+		if hold := holdForResponseID(holds, record.ResponseID); hold != nil {
+			item.Action, item.HoldID = "held", hold.ID
+			addRetentionItem(report, item)
+			continue
+		}
+		if !dryRun {
+			err := s.retireAttachment(ctx, policy, record, cutoff)
+			if errors.Is(err, errRetentionSkipped) {
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("attachment %s: %w", record.ID, err)
+			}
+		}
+		addRetentionItem(report, item)
+	}
+
+	// Share links, which carry recipient contact details
+	linkIter := s.client.Collection("share_links").
+		Where("organizationId", "==", policy.orgID).
+		Where("created_at", "<", cutoff).
+		Documents(ctx)
+	defer linkIter.Stop()
+	for {
+		doc, err := linkIter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to list share links: %w", err)
+		}
+		var link data.ShareLink
+		if err := doc.DataTo(&link); err != nil || !shareLinkRetirable(&link, policy, cutoff) {
+			continue
+		}
+
+		if !dryRun {
+			err := s.retireShareLink(ctx, policy, doc.Ref, cutoff)
+			if errors.Is(err, errRetentionSkipped) {
+				continue
+			}
+			if err != nil {
+				return report, fmt.Errorf("share link %s: %w", doc.Ref.ID, err)
+			}
+		}
+		addRetentionItem(report, data.RetentionItem{ResourceType: "share_link", ResourceID: doc.Ref.ID, CreatedAt: link.CreatedAt, Action: policy.action})
+	}
+
+	// Stored patient export archives (with their PDFs) and organization backups
+	for _, collection := range []string{patientExportCollection, orgArchiveCollection} {
+		archiveIter := s.client.Collection(collection).
+			Where("organizationId", "==", policy.orgID).
+			Where("created_at", "<", cutoff).
+			Documents(ctx)
+		defer archiveIter.Stop()
+		for {
+			doc, err := archiveIter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return report, fmt.Errorf("failed to list %s: %w", collection, err)
+			}
+			archive, ok := storedArchiveFrom(doc)
+			if !ok {
+				continue
+			}
+
+			item := data.RetentionItem{ResourceType: archive.resourceType, ResourceID: doc.Ref.ID, CreatedAt: archive.createdAt, Action: RetentionPurge}
+			if hold := archive.hold(holds); hold != nil {
+				item.Action, item.HoldID = "held", hold.ID
+				addRetentionItem(report, item)
+				continue
+			}
+			if !dryRun {
+				err := s.retireArchive(ctx, policy, doc.Ref, archive.resourceType, cutoff)
+				if errors.Is(err, errRetentionSkipped) {
+					continue
+				}
+				if err != nil {
+					return report, fmt.Errorf("%s %s: %w", archive.resourceType, doc.Ref.ID, err)
+				}
+			}
+			addRetentionItem(report, item)
+		}
+	}
+
+	return report, nil
+}
+
+// storedArchive is an export or backup job whose archive is still in the blob store
+type storedArchive struct {
+	resourceType string
+	storageKey   string
+	createdAt    time.Time
+	responseIDs  []string
+}
+
+// storedArchiveFrom reads a patient export or organization archive job. It reports false
+// when the job has no archive stored: still being built, already downloaded or expired.
+func storedArchiveFrom(doc *firestore.DocumentSnapshot) (storedArchive, bool) {
+	switch doc.Ref.Parent.ID {
+	case patientExportCollection:
+		job, err := exportFromDoc(doc)
+		if err != nil || job.Status != ExportReady || job.StorageKey == "" {
+			return storedArchive{}, false
+		}
+		return storedArchive{resourceType: "export_archive", storageKey: job.StorageKey, createdAt: job.CreatedAt, responseIDs: job.ResponseIDs}, true
+	case orgArchiveCollection:
+		job, err := archiveJobFromDoc(doc)
+		if err != nil || job.Kind != ArchiveBackup || job.Status != ArchiveCompleted || job.StorageKey == "" {
+			return storedArchive{}, false
+		}
+		return storedArchive{resourceType: "backup_archive", storageKey: job.StorageKey, createdAt: job.CreatedAt}, true
+	}
+	return storedArchive{}, false
+}
+
+// hold returns the legal hold covering a response in an export archive. Backups copy the
+// whole organization, so holds are kept through the held responses themselves.
+func (a storedArchive) hold(holds []data.LegalHold) *data.LegalHold {
+	for _, id := range a.responseIDs {
+		if hold := holdForResponseID(holds, id); hold != nil {
+			return hold
+		}
+	}
+	return nil
+}
+
+func addRetentionItem(report *data.RetentionReport, item data.RetentionItem) {
+	if item.Action == "held" {
+		report.Counts["held"]++
+	} else {
+		report.Counts[item.ResourceType]++
+	}
+	if len(report.Items) >= maxRetentionItems {
+		report.Truncated = true
+		return
+	}
+	report.Items = append(report.Items, item)
+}
+
+// shareLinkRetirable reports whether a link is past the window: links still usable after
+// the cutoff are left alone
+func shareLinkRetirable(link *data.ShareLink, policy retentionPolicy, cutoff time.Time) bool {
+	if !link.CreatedAt.Before(cutoff) {
+		return false
+	}
+	if !link.ExpiresAt.IsZero() && link.ExpiresAt.After(cutoff) {
+		return false
+	}
+	return !(policy.action == RetentionAnonymize && link.AnonymizedAt != nil)
+}
+
+// retireResponse purges or anonymizes one response and deletes its attachments
+func (s *RetentionService) retireResponse(ctx context.Context, policy retentionPolicy, ref *firestore.DocumentRef, cutoff time.Time) error {
+	records, err := s.attachments.ForResponse(ctx, ref.ID)
+	if err != nil {
+		return err
+	}
+
+	action := "purged"
+	if policy.action == RetentionAnonymize {
+		action = "anonymized"
+	}
+	err = s.retire(ctx, policy.orgID, policy.reason(), ref, "response", action,
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			var response data.FormResponse
+			if err := doc.DataTo(&response); err != nil {
+				return time.Time{}, err
+			}
+			if !response.SubmittedAt.Before(cutoff) || (policy.action == RetentionAnonymize && response.AnonymizedAt != nil) {
+				return time.Time{}, errRetentionSkipped
+			}
+			// Re-check holds inside the transaction so a hold placed mid-sweep wins
+			holds, err := s.activeHolds(ctx, tx, policy.orgID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			hold, err := s.matchHold(ctx, holds, doc)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if hold != nil {
+				return time.Time{}, errRetentionSkipped
+			}
+			return response.SubmittedAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			if err := s.attachments.DeleteRecords(tx, records); err != nil {
+				return err
+			}
+			if policy.action == RetentionPurge {
+				return tx.Delete(ref)
+			}
+			updates := []firestore.Update{{Path: "anonymized_at", Value: time.Now().UTC()}}
+			for _, field := range []string{"encrypted_phi", "response_data", "patient_name", "ip_address", "user_agent", "session_id", "review_notes", "metadata", "identity_keys"} {
+				updates = append(updates, firestore.Update{Path: field, Value: firestore.Delete})
+			}
+			return tx.Update(ref, updates)
+		})
+	if err != nil {
+		return err
+	}
+
+	s.releaseBlobs(ctx, records)
+	return nil
+}
+
+// retireAttachment deletes an attachment whose response is already gone. Attachments are
+// purged under either policy since the files themselves identify the patient.
+func (s *RetentionService) retireAttachment(ctx context.Context, policy retentionPolicy, record data.Attachment, cutoff time.Time) error {
+	ref := s.client.Collection("attachments").Doc(record.ID)
+	err := s.retire(ctx, policy.orgID, policy.reason(), ref, "attachment", "purged",
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			holds, err := s.activeHolds(ctx, tx, policy.orgID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if holdForResponseID(holds, record.ResponseID) != nil {
+				return time.Time{}, errRetentionSkipped
+			}
+			return record.CreatedAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			return tx.Delete(ref)
+		})
+	if err != nil {
+		return err
+	}
+
+	s.releaseBlobs(ctx, []data.Attachment{record})
+	return nil
+}
+
+// retireShareLink deletes a share link, or strips its recipient details when anonymizing
+func (s *RetentionService) retireShareLink(ctx context.Context, policy retentionPolicy, ref *firestore.DocumentRef, cutoff time.Time) error {
+	action := "purged"
+	if policy.action == RetentionAnonymize {
+		action = "anonymized"
+	}
+	return s.retire(ctx, policy.orgID, policy.reason(), ref, "share_link", action,
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			var link data.ShareLink
+			if err := doc.DataTo(&link); err != nil {
+				return time.Time{}, err
+			}
+			if !shareLinkRetirable(&link, policy, cutoff) {
+				return time.Time{}, errRetentionSkipped
+			}
+			return link.CreatedAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			if policy.action == RetentionPurge {
+				return tx.Delete(ref)
+			}
+			return tx.Update(ref, []firestore.Update{
+				{Path: "recipient_email", Value: firestore.Delete},
+				{Path: "recipient_phone", Value: firestore.Delete},
+				{Path: "password_hash", Value: firestore.Delete},
+				{Path: "is_active", Value: false},
+				{Path: "anonymized_at", Value: time.Now().UTC()},
+			})
+		})
+}
+
+// retireArchive deletes a stored export or backup archive and marks its job expired.
+// Archives are purged under either policy since their contents identify patients.
+func (s *RetentionService) retireArchive(ctx context.Context, policy retentionPolicy, ref *firestore.DocumentRef, resourceType string, cutoff time.Time) error {
+	expired := ExportExpired
+	if ref.Parent.ID == orgArchiveCollection {
+		expired = ArchiveExpired
+	}
+	var archive storedArchive
+	err := s.retire(ctx, policy.orgID, policy.reason(), ref, resourceType, "purged",
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			var ok bool
+			if archive, ok = storedArchiveFrom(doc); !ok || !archive.createdAt.Before(cutoff) {
+				return time.Time{}, errRetentionSkipped
+			}
+			holds, err := s.activeHolds(ctx, tx, policy.orgID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if archive.hold(holds) != nil {
+				return time.Time{}, errRetentionSkipped
+			}
+			return archive.createdAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			return tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: expired},
+				{Path: "storage_key", Value: firestore.Delete},
+			})
+		})
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(ctx, archive.storageKey); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		logging.FromContext(ctx).Warn("RETENTION: failed to delete archive", "resource_type", archive.resourceType, "resource_id", ref.ID, "error", err)
+	}
+	return nil
+}
+
+// retire runs one deletion and its deletion log entry in a single transaction.
+// check re-validates the resource and returns its creation time, or errRetentionSkipped.
+func (s *RetentionService) retire(ctx context.Context, orgID, reason string, ref *firestore.DocumentRef, resourceType, action string,
+	check func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error),
+	apply func(tx *firestore.Transaction) error) error {
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errRetentionSkipped
+		}
+		if err != nil {
+			return err
+		}
+		createdAt, err := check(tx, doc)
+		if err != nil {
+			return err
+		}
+
+		headRef := s.client.Collection(deletionLogHeads).Doc(orgID)
+		var head deletionLogHead
+		headDoc, err := tx.Get(headRef)
+		if err == nil {
+			if err := headDoc.DataTo(&head); err != nil {
+				return err
+			}
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err := apply(tx); err != nil {
+			return err
+		}
+
+		entry := data.DeletionLogEntry{
+			OrganizationID:    orgID,
+			Sequence:          head.Sequence + 1,
+			ResourceType:      resourceType,
+			ResourceID:        ref.ID,
+			Action:            action,
+			Reason:            reason,
+			ResourceCreatedAt: createdAt.UTC().Truncate(time.Microsecond),
+			PerformedAt:       time.Now().UTC().Truncate(time.Microsecond),
+			PrevHash:          head.Hash,
+		}
+		entry.Hash = deletionLogHash(&entry)
+
+		entryRef := s.client.Collection(deletionLogCollection).Doc(fmt.Sprintf("%s_%012d", orgID, entry.Sequence))
+		if err := tx.Create(entryRef, entry); err != nil {
+			return err
+		}
+		return tx.Set(headRef, deletionLogHead{Sequence: entry.Sequence, Hash: entry.Hash, UpdatedAt: entry.PerformedAt})
+	})
+}
+
+func (s *RetentionService) releaseBlobs(ctx context.Context, records []data.Attachment) {
+	seen := map[string]bool{}
+	for _, record := range records {
+		if seen[record.StorageKey] {
+			continue
+		}
+		seen[record.StorageKey] = true
+		if err := s.attachments.ReleaseBlob(ctx, record.StorageKey); err != nil {
+			logging.FromContext(ctx).Warn("RETENTION: failed to delete attachment blob", "attachment_id", record.ID, "error", err)
+		}
+	}
+}
+
+// deletionLogHash chains an entry to its predecessor. Times are truncated to Firestore's
+// microsecond precision so stored entries hash the same when read back.
+func deletionLogHash(entry *data.DeletionLogEntry) string {
+	fields := []string{
+		entry.PrevHash,
+		entry.OrganizationID,
+		strconv.FormatInt(entry.Sequence, 10),
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.Action,
+		entry.Reason,
+		entry.ResourceCreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.PerformedAt.UTC().Format(time.RFC3339Nano),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyDeletionLog walks the organization's deletion log and checks every link of the
+// hash chain against the stored head. It returns the number of verified entries.
+func (s *RetentionService) VerifyDeletionLog(ctx context.Context, orgID string) (int, error) {
+	iter := s.client.Collection(deletionLogCollection).
+		Where("organizationId", "==", orgID).
+		OrderBy("sequence", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	prevHash := ""
+	expected := int64(1)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		var entry data.DeletionLogEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return 0, err
+		}
+		switch {
+		case entry.Sequence != expected:
+			return int(expected - 1), fmt.Errorf("%w: expected sequence %d, found %d", ErrDeletionLogTampered, expected, entry.Sequence)
+		case entry.PrevHash != prevHash:
+			return int(expected - 1), fmt.Errorf("%w: entry %d does not link to its predecessor", ErrDeletionLogTampered, entry.Sequence)
+		case deletionLogHash(&entry) != entry.Hash:
+			return int(expected - 1), fmt.Errorf("%w: entry %d has been modified", ErrDeletionLogTampered, entry.Sequence)
+		}
+		prevHash = entry.Hash
+		expected++
+	}
+
+	// The head catches entries deleted from the end of the chain
+	headDoc, err := s.client.Collection(deletionLogHeads).Doc(orgID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		if expected > 1 {
+			return int(expected - 1), fmt.Errorf("%w: chain head is missing", ErrDeletionLogTampered)
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var head deletionLogHead
+	if err := headDoc.DataTo(&head); err != nil {
+		return 0, err
+	}
+	if head.Sequence != expected-1 || head.Hash != prevHash {
+		return int(expected - 1), fmt.Errorf("%w: chain ends at %d but head is at %d", ErrDeletionLogTampered, expected-1, head.Sequence)
+	}
+	return int(expected - 1), nil
+}
+
+// DeletionLog returns the organization's most recent deletion log entries, newest first
+func (s *RetentionService) DeletionLog(ctx context.Context, orgID string, limit int) ([]data.DeletionLogEntry, error) {
+	docs, err := s.client.Collection(deletionLogCollection).
+		Where("organizationId", "==", orgID).
+		OrderBy("sequence", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]data.DeletionLogEntry, 0, len(docs))
+	for _, doc := range docs {
+		var entry data.DeletionLogEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, err
+		}
+		entry.ID = doc.Ref.ID
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// activeHolds loads the organization's unreleased legal holds, inside tx when given
+func (s *RetentionService) activeHolds(ctx context.Context, tx *firestore.Transaction, orgID string) ([]data.LegalHold, error) {
+	query := s.client.Collection("legal_holds").
+		Where("organizationId", "==", orgID).
+		Where("active", "==", true)
+
+	var docs []*firestore.DocumentSnapshot
+	var err error
+	if tx != nil {
+		docs, err = tx.Documents(query).GetAll()
+	} else {
+		docs, err = query.Documents(ctx).GetAll()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load legal holds: %w", err)
+	}
+
+	holds := make([]data.LegalHold, 0, len(docs))
+	for _, doc := range docs {
+		var hold data.LegalHold
+		if err := doc.DataTo(&hold); err != nil {
+			return nil, err
+		}
+		hold.ID = doc.Ref.ID
+		holds = append(holds, hold)
+	}
+	return holds, nil
+}
+
+// HoldFor returns the active legal hold covering a response document, if any
+func (s *RetentionService) HoldFor(ctx context.Context, orgID string, doc *firestore.DocumentSnapshot) (*data.LegalHold, error) {
+	holds, err := s.activeHolds(ctx, nil, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return s.matchHold(ctx, holds, doc)
+}
+
+// matchHold finds a hold on the response itself or on its patient. Patient holds need
+// the decrypted patient name, so the response is only opened when such holds exist.
+func (s *RetentionService) matchHold(ctx context.Context, holds []data.LegalHold, doc *firestore.DocumentSnapshot) (*data.LegalHold, error) {
+	if hold := holdForResponseID(holds, doc.Ref.ID); hold != nil {
+		return hold, nil
+	}
+
+	patientHolds := false
+	for _, hold := range holds {
+		if hold.PatientName != "" {
+			patientHolds = true
+			break
+		}
+	}
+	if !patientHolds {
+		return nil, nil
+	}
+
+	response, err := s.encryptor.OpenResponse(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	name := response.PatientName
+	if name == "" && response.Data != nil {
+		first, _ := response.Data["first_name"].(string)
+		last, _ := response.Data["last_name"].(string)
+		name = first + " " + last
+	}
+	name = normalizePatientName(name)
+	if name == "" {
+		return nil, nil
+	}
+	for i := range holds {
+		if holds[i].PatientName != "" && normalizePatientName(holds[i].PatientName) == name {
+			return &holds[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func holdForResponseID(holds []data.LegalHold, responseID string) *data.LegalHold {
+	for i := range holds {
+		if responseID != "" && holds[i].ResponseID == responseID {
+			return &holds[i]
+		}
+	}
+	return nil
+}
+
+func normalizePatientName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
@@ -4,35 +4,38 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"time"
 
 	"backend-go/internal/data"
+	"backend-go/internal/logging"
 	"github.com/redis/go-redis/v9"
 )
 
-const SessionTTL = 5 * 24 * time.Hour // 5 days - HIPAA compliant
-
-// CreateSession stores a new user session in Redis with HIPAA audit trail
-func CreateSession(ctx context.Context, rdb *redis.Client, sessionID string, sessionData *data.UserSession) error {
+// CreateSession stores a new user session in Redis with HIPAA audit trail. ttl matches the
+// session cookie lifetime (config session.ttl).
+func CreateSession(ctx context.Context, rdb *redis.Client, sessionID string, sessionData *data.UserSession, ttl time.Duration) error {
 	key := fmt.Sprintf("session:%s", sessionID)
 	
 	// Set expiration time
-	sessionData.ExpiresAt = time.Now().Add(SessionTTL)
+	sessionData.ExpiresAt = time.Now().Add(ttl)
 
 	jsonData, err := json.Marshal(sessionData)
 	if err != nil {
 		return fmt.Errorf("failed to marshal session data: %w", err)
 	}
 
+	sealed, err := SealCacheValue(ctx, key, jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session data: %w", err)
+	}
+
 	// Store with TTL
-	if err := rdb.Set(ctx, key, jsonData, SessionTTL).Err(); err != nil {
+	if err := rdb.Set(ctx, key, sealed, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to store session in Redis: %w", err)
 	}
 
 	// HIPAA audit log
-	log.Printf("AUDIT: Session created for user %s, org %s, IP %s, expires %v", 
-		sessionData.UserID, sessionData.OrganizationID, sessionData.IPAddress, sessionData.ExpiresAt)
+	logging.FromContext(ctx).Info("AUDIT: session created", "user_id", sessionData.UserID, "organization_id", sessionData.OrganizationID, "expires_at", sessionData.ExpiresAt)
 
 	return nil
 }
@@ -48,8 +51,16 @@ func GetSession(ctx context.Context, rdb *redis.Client, sessionID string) (*data
 		return nil, fmt.Errorf("failed to get session from redis: %w", err)
 	}
 
+	opened, err := OpenCacheValue(ctx, key, []byte(jsonData))
+	if err != nil {
+		// Unreadable sessions (e.g. written before encryption was enabled) force a fresh login
+		logging.FromContext(ctx).Warn("AUDIT: discarding unreadable session", "error", err)
+		rdb.Del(ctx, key)
+		return nil, nil
+	}
+
 	var sessionData data.UserSession
-	if err := json.Unmarshal([]byte(jsonData), &sessionData); err != nil {
+	if err := json.Unmarshal(opened, &sessionData); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
 	}
 
@@ -70,9 +81,48 @@ func DeleteSession(ctx context.Context, rdb *redis.Client, sessionID string) err
 	// Get session for audit before deletion
 	sessionData, _ := GetSession(ctx, rdb, sessionID)
 	if sessionData != nil {
-		log.Printf("AUDIT: Session deleted for user %s, org %s", 
-			sessionData.UserID, sessionData.OrganizationID)
+		logging.FromContext(ctx).Info("AUDIT: session deleted", "user_id", sessionData.UserID, "organization_id", sessionData.OrganizationID)
 	}
 	
 	return rdb.Del(ctx, key).Err()
-}
\ No newline at end of file
+}
+// RevokeSessions deletes every stored session belonging to userID or, when userID is empty,
+// to any user of orgID. Sessions that cannot be decrypted are left for GetSession to discard.
+// It returns the number of sessions removed.
+func RevokeSessions(ctx context.Context, rdb *redis.Client, userID, orgID string) (int, error) {
+	if userID == "" && orgID == "" {
+		return 0, fmt.Errorf("a user or organization is required")
+	}
+
+	revoked := 0
+	iter := rdb.Scan(ctx, 0, "session:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		stored, err := rdb.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return revoked, fmt.Errorf("failed to read session: %w", err)
+		}
+		opened, err := OpenCacheValue(ctx, key, stored)
+		if err != nil {
+			continue
+		}
+		var sessionData data.UserSession
+		if err := json.Unmarshal(opened, &sessionData); err != nil {
+			continue
+		}
+		if (userID != "" && sessionData.UserID != userID) || (userID == "" && sessionData.OrganizationID != orgID) {
+			continue
+		}
+		if err := rdb.Del(ctx, key).Err(); err != nil {
+			return revoked, fmt.Errorf("failed to delete session: %w", err)
+		}
+		revoked++
+		logging.FromContext(ctx).Info("AUDIT: session revoked", "user_id", sessionData.UserID, "organization_id", sessionData.OrganizationID)
+	}
+	if err := iter.Err(); err != nil {
+		return revoked, fmt.Errorf("failed to scan sessions: %w", err)
+	}
+	return revoked, nil
+}
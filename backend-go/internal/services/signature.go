@@ -42,7 +42,7 @@ func SignatureRenderer(metadata PatternMetadata, context *PDFContext) (string, e
 	hasSignature := false
 	for _, elementName := range metadata.ElementNames {
 		if value, exists := context.Answers[elementName]; exists {
-			if sigData, ok := value.(string); ok && strings.HasPrefix(sigData, "data:image/") {
+			if sigData, ok := context.imageAnswer(value); ok {
 				if !hasSignature {
 					// Add "Patient Signature:" header like in Oswestry
 					result.WriteString(`<p style="font-weight: bold; margin-bottom: 10px;">Patient Signature:</p>`)
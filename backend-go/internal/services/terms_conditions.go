@@ -73,7 +73,7 @@ func TermsConditionsRenderer(metadata PatternMetadata, context *PDFContext) (str
 					
 					// Check for signature
 					if elementType == "signaturepad" {
-						result.WriteString(renderSignatureStatus(element, elementName, answers))
+						result.WriteString(renderSignatureStatus(element, elementName, answers, context))
 					}
 					
 					// Check for date fields
@@ -206,13 +206,13 @@ func renderAcknowledgementStatus(element map[string]interface{}, elementName str
 	return result.String()
 }
 
-func renderSignatureStatus(element map[string]interface{}, elementName string, answers map[string]interface{}) string {
+func renderSignatureStatus(element map[string]interface{}, elementName string, answers map[string]interface{}, context *PDFContext) string {
 	var result bytes.Buffer
 	
 	title, _ := element["title"].(string)
 	
 	if value, exists := answers[elementName]; exists {
-		if sigData, ok := value.(string); ok && sigData != "" && strings.HasPrefix(sigData, "data:image/") {
+		if sigData, ok := context.imageAnswer(value); ok {
 			// Render the actual signature image
 			result.WriteString(`<div style="margin: 15px 0;">`)
 			result.WriteString(fmt.Sprintf(`<p style="margin-bottom: 10px; font-weight: bold;">%s:</p>`, html.EscapeString(title)))
@@ -356,12 +356,12 @@ func TestPerformanceBounds(t *testing.T) {
 
 type MockGotenbergService struct{}
 
-func (m *MockGotenbergService) ConvertHTMLToPDF(htmlContent string) ([]byte, error) {
+func (m *MockGotenbergService) ConvertHTMLToPDF(ctx context.Context, htmlContent string) ([]byte, error) {
 	// Return mock PDF content
 	return []byte("Mock PDF content for testing"), nil
 }
 
-func (m *MockGotenbergService) GetServiceHealth() error {
+func (m *MockGotenbergService) GetServiceHealth(ctx context.Context) error {
 	return nil
 }
 
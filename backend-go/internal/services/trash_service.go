@@ -0,0 +1,542 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Trash resource types
+const (
+	TrashForm     = "form"
+	TrashResponse = "response"
+)
+
+const (
+	trashLockResource = "trash-purge"
+	trashLockTTL      = 30 * time.Minute
+	trashPurgeBatch   = 200
+)
+
+// ErrTrashItemNotFound is returned for resources that do not exist, belong to another
+// organization, or are not in the state the action needs (deleted for restore, live for delete)
+var ErrTrashItemNotFound = errors.New("item not found")
+
+// trashCollections maps trash resource types to their Firestore collections
+var trashCollections = map[string]string{
+	TrashForm:     "forms",
+	TrashResponse: "form_responses",
+}
+
+// TrashService soft-deletes forms and responses. Deleted documents keep their data with a
+// deleted_at/deleted_by marker, are hidden from every read, and can be restored until the
+// grace period has passed; the purge worker then deletes them through the retention
+// service's deletion log. Deleting a form switches off its active share links, and
+// restoring it switches the same links back on.
+type TrashService struct {
+	client      *firestore.Client
+	rdb         *redis.Client
+	events      *EventBus
+	retention   *RetentionService
+	auditLogger *AuditTrail
+	gracePeriod time.Duration
+	interval    time.Duration
+}
+
+// NewTrashService creates a new trash service
+func NewTrashService(client *firestore.Client, rdb *redis.Client, events *EventBus, retention *RetentionService, auditLogger *AuditTrail, gracePeriod time.Duration) *TrashService {
+	return &TrashService{
+		client:      client,
+		rdb:         rdb,
+		events:      events,
+		retention:   retention,
+		auditLogger: auditLogger,
+		gracePeriod: gracePeriod,
+		interval:    time.Hour,
+	}
+}
+
+// DeleteForm moves a form to the trash and deactivates its share links. It returns the
+// number of links deactivated. When ifMatch is given the form must still have one of those
+// ETags, otherwise a FormVersionConflict is returned. The form's cache entries are dropped
+// before it returns, so a read that follows does not serve the deleted form.
+func (s *TrashService) DeleteForm(ctx context.Context, orgID, userID, formID string, ifMatch []string) (int, error) {
+	ref := s.client.Collection("forms").Doc(formID)
+	deactivated := 0
+	err := s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		doc, err := getOwned(tx, ref, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if _, deleted := doc.Data()["deleted_at"]; deleted {
+			return nil, ErrTrashItemNotFound
+		}
+		if ifMatch != nil {
+			var form data.Form
+			if err := doc.DataTo(&form); err != nil {
+				return nil, err
+			}
+			form.ID = formID
+			if err := CheckFormVersion(&form, ifMatch); err != nil {
+				return nil, err
+			}
+		}
+		links, err := tx.Documents(s.client.Collection("share_links").
+			Where("form_id", "==", formID).
+			Where("is_active", "==", true)).GetAll()
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "deleted_at", Value: now},
+			{Path: "deleted_by", Value: userID},
+			{Path: "version", Value: firestore.Increment(1)},
+			{Path: "updatedAt", Value: now},
+			{Path: "updatedBy", Value: userID},
+		}); err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if err := tx.Update(link.Ref, []firestore.Update{
+				{Path: "is_active", Value: false},
+				{Path: "deactivated_with_form", Value: true},
+			}); err != nil {
+				return nil, err
+			}
+		}
+		deactivated = len(links)
+		return []data.DomainEvent{
+			NewDomainEvent(DomainFormDeleted, orgID, "form", formID, userID,
+				map[string]interface{}{"form_id": formID, "share_links_deactivated": deactivated}),
+		}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.invalidateForm(ctx, orgID, formID)
+	return deactivated, nil
+}
+
+// invalidateForm drops a form's cache entries after a trash write. The FormDeleted and
+// FormRestored subscribers do the same, but only once the outbox is dispatched.
+func (s *TrashService) invalidateForm(ctx context.Context, orgID, formID string) {
+	if err := InvalidateFormCache(ctx, s.rdb, orgID, formID); err != nil {
+		logging.FromContext(ctx).Warn("form cache invalidation failed", "form_id", formID, "error", err)
+	}
+}
+
+// DeleteResponse moves a response to the trash. Legal holds are checked by the caller, and
+// again by the purge.
+func (s *TrashService) DeleteResponse(ctx context.Context, orgID, userID, responseID string) error {
+	ref := s.client.Collection("form_responses").Doc(responseID)
+	return s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		doc, err := getOwned(tx, ref, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if _, deleted := doc.Data()["deleted_at"]; deleted {
+			return nil, ErrTrashItemNotFound
+		}
+		formID, _ := doc.Data()["form"].(string)
+		if err := tx.Update(ref, []firestore.Update{
+			{Path: "deleted_at", Value: time.Now().UTC()},
+			{Path: "deleted_by", Value: userID},
+		}); err != nil {
+			return nil, err
+		}
+		return []data.DomainEvent{
+			NewDomainEvent(DomainResponseDeleted, orgID, "response", responseID, userID,
+				map[string]interface{}{"response_id": responseID, "form_id": formID}),
+		}, nil
+	})
+}
+
+// Restore takes a form or response out of the trash. Share links deactivated when a form
+// was deleted are switched back on, and a restored form's cache entries are dropped.
+func (s *TrashService) Restore(ctx context.Context, orgID, userID, resourceType, id string) error {
+	collection, ok := trashCollections[resourceType]
+	if !ok {
+		return ErrTrashItemNotFound
+	}
+	ref := s.client.Collection(collection).Doc(id)
+	err := s.events.Transact(ctx, func(ctx context.Context, tx *firestore.Transaction) ([]data.DomainEvent, error) {
+		doc, err := getOwned(tx, ref, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if _, deleted := doc.Data()["deleted_at"]; !deleted {
+			return nil, ErrTrashItemNotFound
+		}
+
+		var links []*firestore.DocumentSnapshot
+		if resourceType == TrashForm {
+			links, err = tx.Documents(s.client.Collection("share_links").
+				Where("form_id", "==", id).
+				Where("deactivated_with_form", "==", true)).GetAll()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		updates := []firestore.Update{
+			{Path: "deleted_at", Value: firestore.Delete},
+			{Path: "deleted_by", Value: firestore.Delete},
+		}
+		if resourceType == TrashForm {
+			// A restored form is a new version, so ETags from before the delete stay stale
+			updates = append(updates,
+				firestore.Update{Path: "version", Value: firestore.Increment(1)},
+				firestore.Update{Path: "updatedAt", Value: time.Now().UTC()},
+				firestore.Update{Path: "updatedBy", Value: userID})
+		}
+		if err := tx.Update(ref, updates); err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if err := tx.Update(link.Ref, []firestore.Update{
+				{Path: "is_active", Value: true},
+				{Path: "deactivated_with_form", Value: firestore.Delete},
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		if resourceType == TrashForm {
+			return []data.DomainEvent{
+				NewDomainEvent(DomainFormRestored, orgID, "form", id, userID,
+					map[string]interface{}{"form_id": id, "share_links_reactivated": len(links)}),
+			}, nil
+		}
+		return []data.DomainEvent{
+			NewDomainEvent(DomainResponseRestored, orgID, "response", id, userID,
+				map[string]interface{}{"response_id": id}),
+		}, nil
+	})
+	if err == nil && resourceType == TrashForm {
+		s.invalidateForm(ctx, orgID, id)
+	}
+	return err
+}
+
+// getOwned reads a document in the transaction and checks it belongs to the organization
+func getOwned(tx *firestore.Transaction, ref *firestore.DocumentRef, orgID string) (*firestore.DocumentSnapshot, error) {
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrTrashItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if owner, _ := doc.Data()["organizationId"].(string); owner != orgID {
+		return nil, ErrTrashItemNotFound
+	}
+	return doc, nil
+}
+
+// List returns the organization's deleted forms and responses, most recently deleted
+// first. resourceType limits the listing to forms or responses when set.
+func (s *TrashService) List(ctx context.Context, orgID, resourceType string, limit int) ([]data.TrashItem, error) {
+	items := []data.TrashItem{}
+	for _, kind := range []string{TrashForm, TrashResponse} {
+		if resourceType != "" && resourceType != kind {
+			continue
+		}
+		// Ordering on deleted_at also leaves out documents without the field
+		docs, err := s.client.Collection(trashCollections[kind]).
+			Where("organizationId", "==", orgID).
+			OrderBy("deleted_at", firestore.Desc).
+			Limit(limit).Documents(ctx).GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deleted %ss: %w", kind, err)
+		}
+		for _, doc := range docs {
+			item := data.TrashItem{ResourceType: kind, ResourceID: doc.Ref.ID}
+			if kind == TrashForm {
+				var form data.Form
+				if err := doc.DataTo(&form); err != nil || form.DeletedAt == nil {
+					continue
+				}
+				item.Title, item.DeletedAt, item.DeletedBy = form.Title, *form.DeletedAt, form.DeletedBy
+			} else {
+				var response data.FormResponse
+				if err := doc.DataTo(&response); err != nil || response.DeletedAt == nil {
+					continue
+				}
+				item.Title, item.FormID = response.FormTitle, response.FormID
+				item.DeletedAt, item.DeletedBy = *response.DeletedAt, response.DeletedBy
+			}
+			item.PurgeAfter = item.DeletedAt.Add(s.gracePeriod)
+			items = append(items, item)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// Start runs the purge worker until ctx is cancelled
+func (s *TrashService) Start(ctx context.Context) {
+	log.Printf("TRASH: purge worker started (interval %v, grace period %v)", s.interval, s.gracePeriod)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.RunOnce(ctx); err != nil {
+			log.Printf("TRASH: purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("TRASH: purged %d items", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("TRASH: purge worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce permanently deletes everything that has been in the trash longer than the grace
+// period and returns the number of forms and responses purged. Responses under a legal
+// hold stay in the trash until the hold is released.
+func (s *TrashService) RunOnce(ctx context.Context) (int, error) {
+	if s.rdb != nil {
+		lock := NewDistributedLock(s.rdb, trashLockResource, trashLockTTL)
+		acquired, err := lock.Acquire(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if !acquired {
+			return 0, nil // Another instance is purging
+		}
+		defer lock.Release(context.Background())
+	}
+
+	cutoff := time.Now().UTC().Add(-s.gracePeriod)
+	purged := 0
+	for _, kind := range []string{TrashResponse, TrashForm} {
+		docs, err := s.client.Collection(trashCollections[kind]).
+			Where("deleted_at", "<", cutoff).
+			Limit(trashPurgeBatch).Documents(ctx).GetAll()
+		if err != nil {
+			return purged, fmt.Errorf("failed to list deleted %ss: %w", kind, err)
+		}
+		for _, doc := range docs {
+			if ctx.Err() != nil {
+				return purged, ctx.Err()
+			}
+			orgID, _ := doc.Data()["organizationId"].(string)
+			if kind == TrashForm {
+				err = s.purgeForm(ctx, orgID, doc.Ref, cutoff)
+			} else {
+				err = s.purgeResponse(ctx, orgID, doc.Ref, cutoff)
+			}
+			if errors.Is(err, errRetentionSkipped) {
+				continue
+			}
+			if err != nil {
+				log.Printf("TRASH: failed to purge %s %s: %v", kind, doc.Ref.ID, err)
+				s.auditPurge(ctx, orgID, kind, doc.Ref.ID, err)
+				continue
+			}
+			s.auditPurge(ctx, orgID, kind, doc.Ref.ID, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// stillTrashed re-reads the deletion marker inside a purge transaction, so a restore that
+// lands mid-purge wins
+func stillTrashed(doc *firestore.DocumentSnapshot, cutoff time.Time) (*time.Time, string, error) {
+	var marker struct {
+		DeletedAt *time.Time `firestore:"deleted_at"`
+		DeletedBy string     `firestore:"deleted_by"`
+	}
+	if err := doc.DataTo(&marker); err != nil {
+		return nil, "", err
+	}
+	if marker.DeletedAt == nil || !marker.DeletedAt.Before(cutoff) {
+		return nil, "", errRetentionSkipped
+	}
+	return marker.DeletedAt, marker.DeletedBy, nil
+}
+
+func trashReason(deletedAt *time.Time, deletedBy string) string {
+	return fmt.Sprintf("trash: deleted by %s on %s", deletedBy, deletedAt.UTC().Format("2006-01-02"))
+}
+
+// purgeResponse deletes a trashed response and its attachments
+func (s *TrashService) purgeResponse(ctx context.Context, orgID string, ref *firestore.DocumentRef, cutoff time.Time) error {
+	r := s.retention
+	records, err := r.attachments.ForResponse(ctx, ref.ID)
+	if err != nil {
+		return err
+	}
+
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return err
+	}
+	deletedAt, deletedBy, err := stillTrashed(doc, cutoff)
+	if err != nil {
+		return err
+	}
+
+	err = r.retire(ctx, orgID, trashReason(deletedAt, deletedBy), ref, "response", "purged",
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			if _, _, err := stillTrashed(doc, cutoff); err != nil {
+				return time.Time{}, err
+			}
+			holds, err := r.activeHolds(ctx, tx, orgID)
+			if err != nil {
+				return time.Time{}, err
+			}
+			hold, err := r.matchHold(ctx, holds, doc)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if hold != nil {
+				return time.Time{}, errRetentionSkipped
+			}
+			var response data.FormResponse
+			if err := doc.DataTo(&response); err != nil {
+				return time.Time{}, err
+			}
+			return response.SubmittedAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			if err := r.attachments.DeleteRecords(tx, records); err != nil {
+				return err
+			}
+			return tx.Delete(ref)
+		})
+	if err != nil {
+		return err
+	}
+
+	r.releaseBlobs(ctx, records)
+	return nil
+}
+
+// purgeForm deletes a trashed form's share links and then the form. Each deletion is its
+// own logged transaction; if the purge stops part-way the form is still in the trash and
+// the next run finishes it. A form stays in the trash while any response, live or trashed,
+// still references it: responses follow their own retention, and a restored response
+// needs its form.
+func (s *TrashService) purgeForm(ctx context.Context, orgID string, ref *firestore.DocumentRef, cutoff time.Time) error {
+	r := s.retention
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return err
+	}
+	deletedAt, deletedBy, err := stillTrashed(doc, cutoff)
+	if err != nil {
+		return err
+	}
+	reason := trashReason(deletedAt, deletedBy)
+
+	responses := s.client.Collection("form_responses").Where("form", "==", ref.ID).Limit(1)
+	referenced, err := responses.Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	if len(referenced) > 0 {
+		log.Printf("TRASH: form %s stays in the trash while responses still reference it", ref.ID)
+		return errRetentionSkipped
+	}
+
+	links, err := s.client.Collection("share_links").Where("form_id", "==", ref.ID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		err := r.retire(ctx, orgID, reason, link.Ref, "share_link", "purged",
+			func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+				form, err := tx.Get(ref)
+				if err != nil {
+					return time.Time{}, err
+				}
+				if _, _, err := stillTrashed(form, cutoff); err != nil {
+					return time.Time{}, err
+				}
+				var link data.ShareLink
+				if err := doc.DataTo(&link); err != nil {
+					return time.Time{}, err
+				}
+				return link.CreatedAt, nil
+			},
+			func(tx *firestore.Transaction) error {
+				return tx.Delete(link.Ref)
+			})
+		if errors.Is(err, errRetentionSkipped) {
+			return err // Restored in the meantime
+		}
+		if err != nil {
+			return fmt.Errorf("share link %s: %w", link.Ref.ID, err)
+		}
+	}
+
+	err = r.retire(ctx, orgID, reason, ref, "form", "purged",
+		func(tx *firestore.Transaction, doc *firestore.DocumentSnapshot) (time.Time, error) {
+			if _, _, err := stillTrashed(doc, cutoff); err != nil {
+				return time.Time{}, err
+			}
+			// A response submitted since the check above keeps the form
+			referenced, err := tx.Documents(responses).GetAll()
+			if err != nil {
+				return time.Time{}, err
+			}
+			if len(referenced) > 0 {
+				return time.Time{}, errRetentionSkipped
+			}
+			var form data.Form
+			if err := doc.DataTo(&form); err != nil {
+				return time.Time{}, err
+			}
+			return form.CreatedAt, nil
+		},
+		func(tx *firestore.Transaction) error {
+			return tx.Delete(ref)
+		})
+	if err != nil {
+		return err
+	}
+	return InvalidateFormCache(ctx, s.rdb, orgID, ref.ID)
+}
+
+func (s *TrashService) auditPurge(ctx context.Context, orgID, resourceType, resourceID string, err error) {
+	if s.auditLogger == nil {
+		return
+	}
+	entry := AuditEntry{
+		Timestamp:      time.Now().UTC(),
+		UserID:         "system",
+		Action:         "TRASH_PURGE",
+		ResourceType:   resourceType,
+		ResourceID:     resourceID,
+		OrganizationID: orgID,
+		Success:        err == nil,
+		Metadata:       map[string]interface{}{"grace_period": s.gracePeriod.String()},
+	}
+	if err != nil {
+		entry.ErrorMsg = err.Error()
+	}
+	s.auditLogger.LogAccess(ctx, entry)
+}
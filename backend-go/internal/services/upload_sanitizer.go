@@ -0,0 +1,592 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers the GIF decoder; GIFs are converted to PNG
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend-go/internal/data"
+)
+
+// Upload types accepted by the sanitizer
+const (
+	MimeJPEG = "image/jpeg"
+	MimePNG  = "image/png"
+	MimeGIF  = "image/gif" // Converted to PNG
+	MimePDF  = "application/pdf"
+)
+
+// Image types that phones produce but that the sanitizer cannot decode. They are recognized
+// so the rejection can tell the patient what to do instead.
+const (
+	MimeHEIC = "image/heic"
+	MimeWebP = "image/webp"
+)
+
+var (
+	ImageUploadTypes      = []string{MimeJPEG, MimePNG}
+	PDFUploadTypes        = []string{MimePDF}
+	AttachmentUploadTypes = []string{MimeJPEG, MimePNG, MimeGIF, MimePDF}
+)
+
+// ErrUploadRejected wraps every sanitizer rejection; the message carries the reason
+var ErrUploadRejected = errors.New("upload rejected")
+
+// Markers that should never appear in an image, and never at the top of a PDF
+var polyglotMarkers = [][]byte{
+	[]byte("<script"), []byte("<html"), []byte("<?php"), []byte("<svg"), []byte("<!doctype"),
+}
+
+// PDF names that mean the document can run code or carry other files
+var dangerousPDFNames = map[string]bool{
+	"JavaScript":    true,
+	"JS":            true,
+	"EmbeddedFile":  true,
+	"EmbeddedFiles": true,
+	"Launch":        true,
+}
+
+// Upload is a file received from a client, with enough context to audit a rejection
+type Upload struct {
+	Data           []byte
+	DeclaredType   string
+	Allowed        []string
+	Source         string // e.g. "insurance_card", "pdf_import", "response_attachment"
+	UserID         string
+	OrganizationID string
+	IPAddress      string
+}
+
+// UploadSanitizer sniffs, validates and re-encodes uploaded files before they are stored
+// or sent to Vertex AI. Images are re-encoded to drop EXIF/GPS and other metadata, GIFs
+// become PNGs; PDFs are scanned for active content and passed through unchanged.
+type UploadSanitizer struct {
+	auditLogger  *AuditTrail
+	maxBytes     int
+	maxPixels    int
+	maxDimension int
+	maxInflate   int64
+}
+
+// NewUploadSanitizer creates a new upload sanitizer. auditLogger may be nil.
+func NewUploadSanitizer(auditLogger *AuditTrail) *UploadSanitizer {
+	return &UploadSanitizer{
+		auditLogger:  auditLogger,
+		maxBytes:     20 << 20,
+		maxPixels:    50_000_000, // Reject decompression bombs before decoding
+		maxDimension: 4096,       // Larger images are downscaled
+		maxInflate:   64 << 20,   // Budget for inflating PDF streams during the scan
+	}
+}
+
+// Sanitize validates an upload and returns the bytes to keep, plus a report of what changed.
+// Rejections are audited and returned wrapped in ErrUploadRejected.
+func (s *UploadSanitizer) Sanitize(ctx context.Context, upload Upload) ([]byte, *data.UploadReport, error) {
+	report := &data.UploadReport{
+		DeclaredType: normalizeMimeType(upload.DeclaredType),
+		OriginalSize: len(upload.Data),
+	}
+
+	out, err := s.sanitize(upload, report)
+	if err != nil {
+		s.auditRejection(ctx, upload, report, err)
+		return nil, report, fmt.Errorf("%w: %v", ErrUploadRejected, err)
+	}
+	report.SanitizedSize = len(out)
+	return out, report, nil
+}
+
+func (s *UploadSanitizer) sanitize(upload Upload, report *data.UploadReport) ([]byte, error) {
+	if len(upload.Data) == 0 {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if len(upload.Data) > s.maxBytes {
+		return nil, fmt.Errorf("file exceeds %d bytes", s.maxBytes)
+	}
+
+	report.DetectedType = sniffUploadType(upload.Data)
+	if report.DetectedType == "" {
+		return nil, fmt.Errorf("unrecognized file type")
+	}
+	if report.DeclaredType != "" && report.DeclaredType != report.DetectedType {
+		return nil, fmt.Errorf("declared type %s does not match content (%s)", report.DeclaredType, report.DetectedType)
+	}
+	if report.DetectedType == MimeHEIC || report.DetectedType == MimeWebP {
+		return nil, fmt.Errorf("%s images are not supported; upload a JPEG or PNG instead", report.DetectedType)
+	}
+	if !containsString(upload.Allowed, report.DetectedType) {
+		return nil, fmt.Errorf("file type %s is not allowed here", report.DetectedType)
+	}
+
+	switch report.DetectedType {
+	case MimeJPEG, MimePNG, MimeGIF:
+		return s.sanitizeImage(upload.Data, report)
+	case MimePDF:
+		return upload.Data, s.scanPDF(upload.Data)
+	}
+	return nil, fmt.Errorf("unsupported file type %s", report.DetectedType)
+}
+
+func (s *UploadSanitizer) auditRejection(ctx context.Context, upload Upload, report *data.UploadReport, reason error) {
+	log.Printf("UPLOAD: rejected %s upload (declared=%s detected=%s size=%d): %v",
+		upload.Source, report.DeclaredType, report.DetectedType, report.OriginalSize, reason)
+	if s.auditLogger == nil {
+		return
+	}
+	s.auditLogger.LogAccess(ctx, AuditEntry{
+		Timestamp:    time.Now().UTC(),
+		UserID:       upload.UserID,
+		Action:       "UPLOAD_REJECTED",
+		ResourceType: "upload",
+		ResourceID:   upload.Source,
+		IPAddress:    upload.IPAddress,
+		Success:      false,
+		ErrorMsg:     reason.Error(),
+		Metadata: map[string]interface{}{
+			"organization_id": upload.OrganizationID,
+			"declared_type":   report.DeclaredType,
+			"detected_type":   report.DetectedType,
+			"size":            report.OriginalSize,
+		},
+	})
+}
+
+// sniffUploadType identifies a file by its magic bytes. Only types the sanitizer can
+// fully handle are recognized.
+func sniffUploadType(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8, 0xFF}):
+		return MimeJPEG
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return MimePNG
+	case bytes.HasPrefix(b, []byte("GIF87a")), bytes.HasPrefix(b, []byte("GIF89a")):
+		return MimeGIF
+	case bytes.HasPrefix(b, []byte("%PDF-")):
+		return MimePDF
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		return MimeWebP
+	case len(b) >= 12 && string(b[4:8]) == "ftyp" && heicBrands[string(b[8:12])]:
+		return MimeHEIC
+	}
+	return ""
+}
+
+// heicBrands are the ISO base media file brands of HEIC/HEIF images
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+func normalizeMimeType(mimeType string) string {
+	mimeType, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(mimeType)), ";")
+	switch mimeType {
+	case "image/jpg", "image/pjpeg":
+		return MimeJPEG
+	case "image/heif":
+		return MimeHEIC
+	}
+	return mimeType
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeImage rejects polyglots, then decodes and re-encodes the image. Re-encoding drops
+// every metadata segment; EXIF orientation is applied to the pixels first. A GIF keeps only
+// its first frame, re-encoded as PNG.
+func (s *UploadSanitizer) sanitizeImage(b []byte, report *data.UploadReport) ([]byte, error) {
+	info := imageInfo{orientation: 1}
+	var err error
+	switch report.DetectedType {
+	case MimeJPEG:
+		info, err = inspectJPEG(b)
+	case MimePNG:
+		info, err = inspectPNG(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.MetadataStripped = info.hasMetadata
+	report.LocationRemoved = info.hasGPS
+
+	// Only the structural segments are scanned; compressed pixel data is effectively random
+	// and would produce false positives
+	lower := bytes.ToLower(info.structure)
+	for _, marker := range append([][]byte{[]byte("%pdf-")}, polyglotMarkers...) {
+		if bytes.Contains(lower, marker) {
+			return nil, fmt.Errorf("image contains embedded %q content", marker)
+		}
+	}
+	orientation := info.orientation
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > s.maxPixels {
+		return nil, fmt.Errorf("image dimensions %dx%d exceed the limit", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %v", err)
+	}
+
+	pixels := toNRGBA(img)
+	if orientation != 1 {
+		pixels = applyOrientation(pixels, orientation)
+		report.OrientationCorrected = true
+	}
+	if bounds := pixels.Bounds(); bounds.Dx() > s.maxDimension || bounds.Dy() > s.maxDimension {
+		pixels = downscale(pixels, s.maxDimension)
+		report.Resized = true
+	}
+	report.Width = pixels.Bounds().Dx()
+	report.Height = pixels.Bounds().Dy()
+
+	var buf bytes.Buffer
+	switch report.DetectedType {
+	case MimeJPEG:
+		err = jpeg.Encode(&buf, pixels, &jpeg.Options{Quality: 90})
+	case MimeGIF:
+		report.ConvertedTo = MimePNG
+		err = png.Encode(&buf, pixels)
+	default:
+		err = png.Encode(&buf, pixels)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-encode image: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// imageInfo is what the container walk learns about an image before it is decoded
+type imageInfo struct {
+	orientation int
+	hasMetadata bool
+	hasGPS      bool
+	structure   []byte // Segment/chunk bodies other than compressed pixel data
+}
+
+// inspectJPEG walks the marker segments up to the scan data, reading the EXIF orientation
+// and noting metadata, then rejects anything appended after the end-of-image marker.
+func inspectJPEG(b []byte) (imageInfo, error) {
+	info := imageInfo{orientation: 1}
+	i := 2
+	for i+4 <= len(b) {
+		if b[i] != 0xFF {
+			return info, fmt.Errorf("malformed JPEG segment")
+		}
+		marker := b[i+1]
+		if marker == 0xFF { // Fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // Start of scan / end of image
+			break
+		}
+		length := int(binary.BigEndian.Uint16(b[i+2:]))
+		if length < 2 || i+2+length > len(b) {
+			return info, fmt.Errorf("malformed JPEG segment")
+		}
+		segment := b[i+4 : i+2+length]
+		info.structure = append(info.structure, segment...)
+
+		// APP1-APP15 carry EXIF, XMP, ICC and vendor data; COM is a free-text comment
+		if (marker >= 0xE1 && marker <= 0xEF) || marker == 0xFE {
+			info.hasMetadata = true
+		}
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			orientation, hasGPS := parseEXIF(segment[6:])
+			if orientation >= 1 && orientation <= 8 {
+				info.orientation = orientation
+			}
+			info.hasGPS = info.hasGPS || hasGPS
+		}
+		i += 2 + length
+	}
+
+	end := bytes.LastIndex(b, []byte{0xFF, 0xD9})
+	if end < 0 {
+		return info, fmt.Errorf("JPEG has no end-of-image marker")
+	}
+	if len(bytes.Trim(b[end+2:], "\x00\r\n ")) > 0 {
+		return info, fmt.Errorf("data found after end of JPEG image")
+	}
+	return info, nil
+}
+
+// parseEXIF reads the orientation tag and checks for a GPS IFD in the first EXIF IFD
+func parseEXIF(tiff []byte) (orientation int, hasGPS bool) {
+	if len(tiff) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		switch order.Uint16(tiff[entry:]) {
+		case 0x0112: // Orientation, SHORT
+			orientation = int(order.Uint16(tiff[entry+8:]))
+		case 0x8825: // GPS IFD pointer
+			hasGPS = true
+		}
+	}
+	return orientation, hasGPS
+}
+
+// inspectPNG walks the chunk list, noting text and EXIF chunks and rejecting trailing data.
+// PNG has no orientation handling outside eXIf, which browsers already ignore.
+func inspectPNG(b []byte) (imageInfo, error) {
+	info := imageInfo{orientation: 1}
+	i := 8
+	for {
+		if i+12 > len(b) {
+			return info, fmt.Errorf("PNG is truncated")
+		}
+		length := int(binary.BigEndian.Uint32(b[i:]))
+		chunkType := string(b[i+4 : i+8])
+		if length < 0 || i+12+length > len(b) {
+			return info, fmt.Errorf("malformed PNG chunk")
+		}
+		switch chunkType {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+			info.hasMetadata = true
+		}
+		if chunkType != "IDAT" {
+			info.structure = append(info.structure, b[i+8:i+8+length]...)
+		}
+		i += 12 + length
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	if i != len(b) {
+		return info, fmt.Errorf("data found after end of PNG image")
+	}
+	return info, nil
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok && nrgba.Rect.Min == (image.Point{}) {
+		return nrgba
+	}
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// applyOrientation transforms pixels so the image displays upright without EXIF.
+// See the EXIF 2.3 specification, tag 0x0112, for the meaning of each value.
+func applyOrientation(src *image.NRGBA, orientation int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Transposed
+				sx, sy = y, x
+			case 6: // Needs 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // Needs 90 counter-clockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// downscale shrinks the image so its longest side is maxSide, averaging each source area
+func downscale(src *image.NRGBA, maxSide int) *image.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	scale := float64(maxSide) / float64(max(w, h))
+	dw, dh := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					p := src.PixOffset(sx, sy)
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[p+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[d+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// scanPDF rejects PDFs that carry scripts, launch actions or embedded files, including
+// names hidden inside compressed streams or written with #xx escapes.
+func (s *UploadSanitizer) scanPDF(b []byte) error {
+	head := bytes.ToLower(b[:min(len(b), 1024)])
+	for _, marker := range polyglotMarkers {
+		if bytes.Contains(head, marker) {
+			return fmt.Errorf("PDF header contains embedded %q content", marker)
+		}
+	}
+
+	if name := findDangerousPDFName(b); name != "" {
+		return fmt.Errorf("PDF contains /%s", name)
+	}
+	if findPDFName(b, "Encrypt") {
+		return fmt.Errorf("encrypted PDFs cannot be scanned")
+	}
+
+	// Object streams can hide dictionaries, so inflate Flate streams and scan them too
+	budget := s.maxInflate
+	rest := b
+	for {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			return nil
+		}
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			return nil
+		}
+
+		if zr, err := zlib.NewReader(bytes.NewReader(body[:end])); err == nil {
+			inflated, _ := io.ReadAll(io.LimitReader(zr, budget+1))
+			zr.Close()
+			budget -= int64(len(inflated))
+			if budget < 0 {
+				return fmt.Errorf("PDF streams are too large to scan")
+			}
+			if name := findDangerousPDFName(inflated); name != "" {
+				return fmt.Errorf("PDF contains /%s", name)
+			}
+		}
+		rest = body[end+len("endstream"):]
+	}
+}
+
+// findDangerousPDFName returns the first blocked name in a chunk of PDF syntax
+func findDangerousPDFName(b []byte) string {
+	for _, name := range pdfNames(b) {
+		if dangerousPDFNames[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+func findPDFName(b []byte, target string) bool {
+	for _, name := range pdfNames(b) {
+		if name == target {
+			return true
+		}
+	}
+	return false
+}
+
+// pdfNames extracts every /Name token, decoding #xx escapes
+func pdfNames(b []byte) []string {
+	var names []string
+	for i := 0; i < len(b); i++ {
+		if b[i] != '/' {
+			continue
+		}
+		j := i + 1
+		for j < len(b) && !isPDFDelimiter(b[j]) {
+			j++
+		}
+		if j > i+1 {
+			names = append(names, decodePDFName(b[i+1:j]))
+		}
+		i = j - 1
+	}
+	return names
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '/', '[', ']', '<', '>', '(', ')', '{', '}', '%':
+		return true
+	}
+	return false
+}
+
+func decodePDFName(raw []byte) string {
+	if !bytes.Contains(raw, []byte("#")) {
+		return string(raw)
+	}
+	var sb strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(raw[i])
+	}
+	return sb.String()
+}
@@ -4,17 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
 	"time"
 
+	"backend-go/internal/logging"
+	"backend-go/internal/telemetry"
+
 	"cloud.google.com/go/vertexai/genai"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/metadata"
 )
 
+// GenerativeModel is the part of a Vertex AI model the services call.
+// *genai.GenerativeModel implements it; the dev profile uses a deterministic fake.
+type GenerativeModel interface {
+	GenerateContent(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error)
+	CountTokens(ctx context.Context, parts ...genai.Part) (*genai.CountTokensResponse, error)
+	SetTemperature(t float32)
+}
+
 // VertexAIService provides methods for interacting with the Vertex AI API.
 type VertexAIService struct {
-	client *genai.GenerativeModel
+	client GenerativeModel
 }
 
 // NewVertexAIService creates a new instance of VertexAIService.
@@ -27,6 +39,11 @@ func NewVertexAIService(client *genai.Client, modelName string) *VertexAIService
 	model.GenerationConfig.SetMaxOutputTokens(100000)
 	model.GenerationConfig.SetCandidateCount(1)
 	
+	return NewVertexAIServiceWithModel(model)
+}
+
+// NewVertexAIServiceWithModel creates a VertexAIService on an already configured model
+func NewVertexAIServiceWithModel(model GenerativeModel) *VertexAIService {
 	return &VertexAIService{
 		client: model,
 	}
@@ -57,7 +74,7 @@ func (s *VertexAIService) GenerateClinicalSummary(ctx context.Context, questions
 	s.client.SetTemperature(0.2)
 
 	// Generate the content.
-	resp, err := s.client.GenerateContent(ctx, prompt)
+	resp, err := generateContent(ctx, s.client, "clinical_summary", prompt)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content from Vertex AI: %w", err)
 	}
@@ -77,9 +94,9 @@ func (s *VertexAIService) GenerateClinicalSummary(ctx context.Context, questions
 
 // GenerateFormFromPDF processes a PDF and generates a SurveyJS form structure using Vertex AI
 func (s *VertexAIService) GenerateFormFromPDF(ctx context.Context, pdfBytes []byte) (interface{}, error) {
-	// Log PDF processing start with size information
+	logger := logging.FromContext(ctx)
 	pdfSizeMB := float64(len(pdfBytes)) / (1024 * 1024)
-	log.Printf("DEBUG: Starting PDF-to-form generation. PDF size: %.2f MB (%d bytes)", pdfSizeMB, len(pdfBytes))
+	logger.Debug("starting PDF-to-form generation", "pdf_bytes", len(pdfBytes))
 	
 	// Validate PDF size against Vertex AI limits (15MB for documents)
 	if len(pdfBytes) > 15*1024*1024 {
@@ -278,23 +295,17 @@ Your instructions are complete. Now, analyze the user's request and provided con
 		MIMEType: "application/pdf",
 		Data:     pdfBytes,
 	}
-	
-	log.Printf("DEBUG: Created PDF blob with MIME type: %s, data size: %d bytes", pdfBlob.MIMEType, len(pdfBlob.Data))
 
 	// Set temperature for more deterministic output
 	s.client.SetTemperature(0.1)
 
 	// Generate the content with both prompt and PDF blob
-	log.Printf("DEBUG: Calling Vertex AI GenerateContent with prompt and PDF blob...")
-	resp, err := s.client.GenerateContent(ctx, prompt, pdfBlob)
+	resp, err := generateContent(ctx, s.client, "form_from_pdf", prompt, pdfBlob)
 	if err != nil {
-		processingDuration := time.Since(startTime)
-		log.Printf("ERROR: Vertex AI PDF processing failed after %v: %v", processingDuration, err)
+		logger.Error("Vertex AI PDF processing failed", "duration", time.Since(startTime), "error", err)
 		return nil, fmt.Errorf("failed to generate form from PDF: %w", err)
 	}
-	
-	processingDuration := time.Since(startTime)
-	log.Printf("DEBUG: Vertex AI PDF processing completed in %v", processingDuration)
+	logger.Debug("Vertex AI PDF processing completed", "duration", time.Since(startTime))
 
 	// Extract the JSON from the response
 	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
@@ -308,9 +319,9 @@ Your instructions are complete. Now, analyze the user's request and provided con
 
 	// Convert to string and clean the response - remove markdown code blocks if present
 	jsonStr := strings.TrimSpace(string(jsonContent))
-	log.Printf("DEBUG: Raw response length: %d chars", len(jsonStr))
+	logger.Debug("Vertex AI raw response", "chars", len(jsonStr))
 	if len(jsonStr) > 0 {
-		log.Printf("DEBUG: Raw response (first 500 chars): %s", jsonStr[:min(500, len(jsonStr))])
+		logging.Dump(ctx, "Vertex AI raw response", "content", jsonStr[:min(500, len(jsonStr))])
 	}
 
 	// Remove markdown code blocks if present
@@ -319,13 +330,13 @@ Your instructions are complete. Now, analyze the user's request and provided con
 		re := regexp.MustCompile("(?s)```(?:json)?\\s*([\\s\\S]*?)\\s*```")
 		if matches := re.FindStringSubmatch(jsonStr); len(matches) > 1 {
 			jsonStr = strings.TrimSpace(matches[1])
-			log.Printf("DEBUG: Extracted JSON from markdown code blocks")
+			logger.Debug("extracted JSON from markdown code block")
 		} else {
 			// Fallback: find JSON boundaries
 			if start := strings.Index(jsonStr, "{"); start != -1 {
 				if end := strings.LastIndex(jsonStr, "}"); end != -1 && end >= start {
 					jsonStr = jsonStr[start:end+1]
-					log.Printf("DEBUG: Extracted JSON using boundary detection")
+					logger.Debug("extracted JSON by boundary detection")
 				}
 			}
 		}
@@ -334,25 +345,24 @@ Your instructions are complete. Now, analyze the user's request and provided con
 		if start := strings.Index(jsonStr, "{"); start != -1 {
 			if end := strings.LastIndex(jsonStr, "}"); end != -1 && end >= start {
 				jsonStr = jsonStr[start:end+1]
-				log.Printf("DEBUG: Extracted JSON using boundary detection (no markdown)")
+				logger.Debug("extracted JSON by boundary detection", "markdown", false)
 			}
 		}
 	}
 
 	// Final trim after extraction
 	jsonStr = strings.TrimSpace(jsonStr)
-	log.Printf("DEBUG: Cleaned JSON length: %d chars", len(jsonStr))
+	logger.Debug("Vertex AI cleaned JSON", "chars", len(jsonStr))
 	if len(jsonStr) > 0 {
-		log.Printf("DEBUG: Cleaned JSON (first 500 chars): %s", jsonStr[:min(500, len(jsonStr))])
+		logging.Dump(ctx, "Vertex AI cleaned JSON", "content", jsonStr[:min(500, len(jsonStr))])
 	}
 
 	// Parse the cleaned JSON
 	var formStructure interface{}
 	if err := json.Unmarshal([]byte(jsonStr), &formStructure); err != nil {
-		// Enhanced error logging
-		log.Printf("ERROR: Failed to parse JSON: %v", err)
+		logger.Error("failed to parse Vertex AI JSON", "chars", len(jsonStr), "error", err)
 		if len(jsonStr) > 0 {
-			log.Printf("ERROR: JSON content (first 1000 chars): %s", jsonStr[:min(1000, len(jsonStr))])
+			logging.Dump(ctx, "Vertex AI unparsable JSON", "content", jsonStr[:min(1000, len(jsonStr))])
 		}
 		return nil, fmt.Errorf("failed to parse generated JSON: %w", err)
 	}
@@ -360,10 +370,50 @@ Your instructions are complete. Now, analyze the user's request and provided con
 	return formStructure, nil
 }
 
+// Ping checks that the model is reachable with a CountTokens call, which is not billed
+func (s *VertexAIService) Ping(ctx context.Context) error {
+	if _, err := s.client.CountTokens(vertexContext(ctx), genai.Text("ping")); err != nil {
+		return fmt.Errorf("vertex AI unreachable: %w", err)
+	}
+	return nil
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
+// vertexContext attaches the caller's request ID to an outbound Vertex AI call as gRPC
+// metadata, so the request can be found in Vertex audit logs. The genai client does not
+// expose per-request labels, so the metadata header is the only carrier.
+func vertexContext(ctx context.Context) context.Context {
+	id := logging.RequestID(ctx)
+	if id == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "x-request-id", id)
+}
+
+// generateContent calls Vertex AI inside a span, recording latency and the token usage
+// the API reports. operation names the caller for the metric labels.
+func generateContent(ctx context.Context, model GenerativeModel, operation string, parts ...genai.Part) (resp *genai.GenerateContentResponse, err error) {
+	ctx, span := telemetry.StartSpan(ctx, "vertex.generate_content", attribute.String("ai.operation", operation))
+	start := time.Now()
+	defer func() {
+		telemetry.AIRequestDuration.WithLabelValues(operation, telemetry.Outcome(err)).Observe(time.Since(start).Seconds())
+		if resp != nil && resp.UsageMetadata != nil {
+			usage := resp.UsageMetadata
+			telemetry.AITokens.WithLabelValues(operation, "prompt").Add(float64(usage.PromptTokenCount))
+			telemetry.AITokens.WithLabelValues(operation, "candidates").Add(float64(usage.CandidatesTokenCount))
+			telemetry.AITokens.WithLabelValues(operation, "thoughts").Add(float64(usage.ThoughtsTokenCount))
+			span.SetAttributes(
+				attribute.Int("ai.tokens.prompt", int(usage.PromptTokenCount)),
+				attribute.Int("ai.tokens.total", int(usage.TotalTokenCount)),
+			)
+		}
+		telemetry.EndSpan(span, err)
+	}()
+	return model.GenerateContent(vertexContext(ctx), parts...)
+}
@@ -0,0 +1,594 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"backend-go/internal/data"
+	"backend-go/internal/logging"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Webhook lifecycle events
+const (
+	EventResponseSubmitted  = "response.submitted"
+	EventResponseReviewed   = "response.reviewed"
+	EventResponseAmended    = "response.amended"
+	EventPDFGenerated       = "pdf.generated"
+	EventFormPublished      = "form.published"
+	EventShareLinkExhausted = "share_link.exhausted"
+)
+
+// ErrDeadLetterNotFound is returned when a replay targets an unknown dead letter
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrWebhookAddressBlocked is returned when a webhook endpoint resolves to an address that
+// is not on the public internet
+var ErrWebhookAddressBlocked = errors.New("webhook address is not public")
+
+// webhookBlockedPrefixes are special-purpose ranges that netip does not classify as private
+// but that must not be reachable from a webhook
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach any IPv4 address
+}
+
+// WebhookEvents lists every event an organization can subscribe to
+var WebhookEvents = []string{
+	EventResponseSubmitted,
+	EventResponseReviewed,
+	EventResponseAmended,
+	EventPDFGenerated,
+	EventFormPublished,
+	EventShareLinkExhausted,
+}
+
+// WebhookEvent describes something that happened inside an organization.
+// Response is optional and only used to build the FHIR payload mode. When ID is set
+// (the outbox event ID), publishing the same event twice queues each delivery once.
+type WebhookEvent struct {
+	ID             string
+	Type           string
+	OrganizationID string
+	IDs            map[string]string
+	Response       *data.FormResponse
+}
+
+// WebhookService queues signed webhook deliveries and runs the delivery worker
+type WebhookService struct {
+	client     *firestore.Client
+	rdb        *redis.Client
+	encryptor  *FieldEncryptor
+	accessLog  *PHIAccessLog
+	httpClient *http.Client
+	// allowLoopback admits subscriptions to this machine; development only
+	allowLoopback bool
+	maxAttempts   int
+	baseBackoff   time.Duration
+	maxBackoff    time.Duration
+	interval      time.Duration
+}
+
+// NewWebhookService creates a new webhook service. allowLoopback lets subscriptions
+// target this machine, which only local development receivers need.
+func NewWebhookService(client *firestore.Client, rdb *redis.Client, encryptor *FieldEncryptor, accessLog *PHIAccessLog, allowLoopback bool) *WebhookService {
+	return &WebhookService{
+		client:        client,
+		rdb:           rdb,
+		encryptor:     encryptor,
+		accessLog:     accessLog,
+		allowLoopback: allowLoopback,
+		httpClient:    newWebhookHTTPClient(allowLoopback),
+		maxAttempts:   8,
+		baseBackoff:   30 * time.Second,
+		maxBackoff:    2 * time.Hour,
+		interval:      10 * time.Second,
+	}
+}
+
+// GenerateWebhookSecret creates a random signing secret for a subscription
+func GenerateWebhookSecret() (string, error) {
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secretBytes), nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookAddressAllowed reports whether a webhook may connect to ip
+func webhookAddressAllowed(ip netip.Addr, allowLoopback bool) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() {
+		return allowLoopback
+	}
+	// IsGlobalUnicast excludes link-local addresses such as the metadata server at 169.254.169.254
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newWebhookHTTPClient returns a client that refuses to connect to non-public addresses.
+// The check runs on the resolved address of every connection, so DNS names that point
+// inside the network and redirects to internal hosts are blocked as well.
+func newWebhookHTTPClient(allowLoopback bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookAddressAllowed(addrPort.Addr(), allowLoopback) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			// No proxy: it would connect on our behalf and bypass the address check
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// ValidateSubscription checks an API-supplied subscription
+func (s *WebhookService) ValidateSubscription(sub *data.WebhookSubscription) error {
+	parsed, err := url.Parse(sub.URL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("webhook url is invalid")
+	}
+	allowLoopback := s.allowLoopback
+	host := parsed.Hostname()
+	isLocal := host == "localhost"
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !webhookAddressAllowed(ip, allowLoopback) {
+			return fmt.Errorf("webhook url must be a public address")
+		}
+		isLocal = ip.Unmap().IsLoopback()
+	} else if isLocal && !allowLoopback {
+		return fmt.Errorf("webhook url must be a public address")
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLocal) {
+		return fmt.Errorf("webhook url must use https")
+	}
+
+	if len(sub.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range sub.Events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf("unsupported webhook event: %s", event)
+		}
+	}
+
+	switch sub.PayloadMode {
+	case "":
+		sub.PayloadMode = data.WebhookPayloadIDs
+	case data.WebhookPayloadIDs, data.WebhookPayloadFHIR:
+	default:
+		return fmt.Errorf("payload_mode must be %q or %q", data.WebhookPayloadIDs, data.WebhookPayloadFHIR)
+	}
+	return nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish queues a delivery for every active subscription in the organization that
+// listens to the event. A nil service is a no-op so callers don't need to guard.
+func (s *WebhookService) Publish(ctx context.Context, event WebhookEvent) error {
+	if s == nil || event.OrganizationID == "" {
+		return nil
+	}
+
+	iter := s.client.Collection("webhook_subscriptions").
+		Where("organizationId", "==", event.OrganizationID).
+		Where("is_active", "==", true).
+		Where("events", "array-contains", event.Type).
+		Documents(ctx)
+	defer iter.Stop()
+
+	eventID := event.ID
+	if eventID == "" {
+		eventID = uuid.NewString()
+	}
+	now := time.Now().UTC()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list webhook subscriptions: %w", err)
+		}
+
+		var sub data.WebhookSubscription
+		if err := doc.DataTo(&sub); err != nil {
+			log.Printf("WEBHOOK: skipping unparsable subscription %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		sub.ID = doc.Ref.ID
+
+		deliveryRef := s.client.Collection("webhook_deliveries").NewDoc()
+		if event.ID != "" {
+			deliveryRef = s.client.Collection("webhook_deliveries").Doc(event.ID + "_" + sub.ID)
+		}
+		delivery := data.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			OrganizationID: event.OrganizationID,
+			Event:          event.Type,
+			RequestID:      logging.RequestID(ctx),
+			Payload:        buildWebhookPayload(eventID, now, event, sub.PayloadMode),
+			Status:         "pending",
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		}
+		if sub.PayloadMode == data.WebhookPayloadFHIR && event.Response != nil {
+			delivery.ResponseID = event.Response.ID
+		}
+		if sub.PayloadMode == data.WebhookPayloadFHIR && s.encryptor != nil {
+			if err := s.sealPayload(ctx, deliveryRef.ID, &delivery); err != nil {
+				return fmt.Errorf("failed to encrypt webhook payload: %w", err)
+			}
+		}
+		if _, err := deliveryRef.Create(ctx, delivery); err != nil && status.Code(err) != codes.AlreadyExists {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+func buildWebhookPayload(eventID string, occurredAt time.Time, event WebhookEvent, mode string) map[string]interface{} {
+	eventData := map[string]interface{}{}
+	for key, value := range event.IDs {
+		eventData[key] = value
+	}
+	if mode == data.WebhookPayloadFHIR && event.Response != nil {
+		eventData["resource"] = BuildQuestionnaireResponse(event.Response)
+	}
+
+	return map[string]interface{}{
+		"id":              eventID,
+		"type":            event.Type,
+		"organization_id": event.OrganizationID,
+		"occurred_at":     occurredAt.Format(time.RFC3339),
+		"payload_mode":    mode,
+		"data":            eventData,
+	}
+}
+
+// sealPayload encrypts a FHIR payload, which carries the patient's answers, before it is queued
+func (s *WebhookService) sealPayload(ctx context.Context, deliveryID string, delivery *data.WebhookDelivery) error {
+	raw, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.encryptor.Seal(ctx, delivery.OrganizationID, "webhook_deliveries/"+deliveryID, raw)
+	if err != nil {
+		return err
+	}
+	delivery.Payload = nil
+	delivery.SealedPayload = sealed
+	return nil
+}
+
+// deliveryBody returns the JSON body to send, decrypting sealed payloads
+func (s *WebhookService) deliveryBody(ctx context.Context, delivery *data.WebhookDelivery) ([]byte, error) {
+	if delivery.SealedPayload == "" {
+		return json.Marshal(delivery.Payload)
+	}
+	if s.encryptor == nil {
+		return nil, fmt.Errorf("payload is encrypted but no encryptor is configured")
+	}
+	return s.encryptor.Open(ctx, delivery.OrganizationID, "webhook_deliveries/"+delivery.ID, delivery.SealedPayload)
+}
+
+// webhookSecretAAD binds a sealed signing secret to its subscription
+func webhookSecretAAD(subscriptionID string) string {
+	return "webhook_subscriptions/" + subscriptionID + "/secret"
+}
+
+// SealWebhookSecret encrypts a subscription's signing secret with the organization's data key
+func (e *FieldEncryptor) SealWebhookSecret(ctx context.Context, orgID, subscriptionID, secret string) (string, error) {
+	return e.Seal(ctx, orgID, webhookSecretAAD(subscriptionID), []byte(secret))
+}
+
+// webhookSecret returns the subscription's signing secret, decrypting it when sealed
+func (s *WebhookService) webhookSecret(ctx context.Context, sub *data.WebhookSubscription) (string, error) {
+	if sub.SealedSecret == "" {
+		return sub.Secret, nil
+	}
+	if s.encryptor == nil {
+		return "", fmt.Errorf("secret is encrypted but no encryptor is configured")
+	}
+	secret, err := s.encryptor.Open(ctx, sub.OrganizationID, webhookSecretAAD(sub.ID), sub.SealedSecret)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// Start runs the delivery worker until ctx is cancelled
+func (s *WebhookService) Start(ctx context.Context) {
+	log.Printf("WEBHOOK: delivery worker started (interval %v)", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("WEBHOOK: delivery sweep failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("WEBHOOK: delivery worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce attempts every pending delivery whose backoff has elapsed
+func (s *WebhookService) RunOnce(ctx context.Context) error {
+	iter := s.client.Collection("webhook_deliveries").
+		Where("status", "==", "pending").
+		Where("next_attempt_at", "<=", time.Now().UTC()).
+		Limit(50).
+		Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Claim the delivery so concurrent instances don't send it twice
+		if s.rdb != nil {
+			lock := NewDistributedLock(s.rdb, "webhook-delivery:"+doc.Ref.ID, time.Minute)
+			acquired, err := lock.Acquire(ctx)
+			if err != nil || !acquired {
+				continue
+			}
+			s.attemptDelivery(ctx, doc.Ref)
+			lock.Release(context.Background())
+		} else {
+			s.attemptDelivery(ctx, doc.Ref)
+		}
+	}
+}
+
+// attemptDelivery sends one delivery and records the outcome
+func (s *WebhookService) attemptDelivery(ctx context.Context, ref *firestore.DocumentRef) {
+	// Re-read under the claim; another instance may have just finished it
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return
+	}
+	var delivery data.WebhookDelivery
+	if err := doc.DataTo(&delivery); err != nil || delivery.Status != "pending" {
+		return
+	}
+	delivery.ID = ref.ID
+	if delivery.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, delivery.RequestID)
+	}
+
+	subDoc, err := s.client.Collection("webhook_subscriptions").Doc(delivery.SubscriptionID).Get(ctx)
+	if err != nil {
+		s.deadLetter(ctx, ref, &delivery, "subscription no longer exists")
+		return
+	}
+	var sub data.WebhookSubscription
+	if err := subDoc.DataTo(&sub); err != nil || !sub.IsActive {
+		s.deadLetter(ctx, ref, &delivery, "subscription inactive")
+		return
+	}
+	sub.ID = subDoc.Ref.ID
+
+	statusCode, sendErr := s.send(ctx, &sub, &delivery)
+	delivery.Attempts++
+
+	if sendErr == nil {
+		now := time.Now().UTC()
+		_, err := ref.Update(ctx, []firestore.Update{
+			{Path: "status", Value: "delivered"},
+			{Path: "attempts", Value: delivery.Attempts},
+			{Path: "last_status_code", Value: statusCode},
+			{Path: "delivered_at", Value: now},
+		})
+		if err != nil {
+			log.Printf("WEBHOOK: failed to mark delivery %s delivered: %v", ref.ID, err)
+		}
+		log.Printf("WEBHOOK: delivered %s (%s) to subscription %s", ref.ID, delivery.Event, sub.ID)
+		s.recordDisclosure(ctx, &sub, &delivery)
+		return
+	}
+
+	log.Printf("WEBHOOK: delivery %s attempt %d failed: %v", ref.ID, delivery.Attempts, sendErr)
+	delivery.LastError = sendErr.Error()
+	delivery.LastStatusCode = statusCode
+	if delivery.Attempts >= s.maxAttempts {
+		s.deadLetter(ctx, ref, &delivery, sendErr.Error())
+		return
+	}
+
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "attempts", Value: delivery.Attempts},
+		{Path: "last_error", Value: delivery.LastError},
+		{Path: "last_status_code", Value: statusCode},
+		{Path: "next_attempt_at", Value: time.Now().UTC().Add(s.backoff(delivery.Attempts))},
+	})
+	if err != nil {
+		log.Printf("WEBHOOK: failed to reschedule delivery %s: %v", ref.ID, err)
+	}
+}
+
+// recordDisclosure logs a delivered FHIR payload as a disclosure of the response it carried
+func (s *WebhookService) recordDisclosure(ctx context.Context, sub *data.WebhookSubscription, delivery *data.WebhookDelivery) {
+	if s.accessLog == nil || delivery.ResponseID == "" {
+		return
+	}
+	err := s.accessLog.RecordByID(ctx, delivery.ResponseID, PHIAccess{
+		Action:    PHIActionWebhook,
+		Purpose:   PurposeOperations,
+		ActorType: "system",
+		ActorID:   "webhook:" + sub.ID,
+		Recipient: sub.URL,
+	})
+	if err != nil {
+		log.Printf("PHI_ACCESS: failed to record webhook delivery %s of response %s: %v", delivery.ID, delivery.ResponseID, err)
+	}
+}
+
+// send POSTs the signed payload and returns the HTTP status code
+func (s *WebhookService) send(ctx context.Context, sub *data.WebhookSubscription, delivery *data.WebhookDelivery) (int, error) {
+	body, err := s.deliveryBody(ctx, delivery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build payload: %w", err)
+	}
+	secret, err := s.webhookSecret(ctx, sub)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read signing secret: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "healthcare-forms-webhooks/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	if delivery.RequestID != "" {
+		req.Header.Set(logging.RequestIDHeader, delivery.RequestID)
+	}
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhookPayload(secret, timestamp, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the exponential delay before the next attempt
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := time.Duration(float64(s.baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if delay > s.maxBackoff {
+		delay = s.maxBackoff
+	}
+	return delay
+}
+
+// deadLetter moves a delivery into the dead-letter store
+func (s *WebhookService) deadLetter(ctx context.Context, ref *firestore.DocumentRef, delivery *data.WebhookDelivery, reason string) {
+	delivery.Status = "dead_letter"
+	delivery.LastError = reason
+
+	deadRef := s.client.Collection("webhook_dead_letters").Doc(ref.ID)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Set(deadRef, delivery); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		log.Printf("WEBHOOK: failed to dead-letter delivery %s: %v", ref.ID, err)
+		return
+	}
+	log.Printf("WEBHOOK: delivery %s dead-lettered after %d attempts: %s", ref.ID, delivery.Attempts, reason)
+}
+
+// Replay moves a dead-lettered delivery back into the queue with a fresh retry budget
+func (s *WebhookService) Replay(ctx context.Context, orgID, deliveryID string) error {
+	deadRef := s.client.Collection("webhook_dead_letters").Doc(deliveryID)
+	queueRef := s.client.Collection("webhook_deliveries").Doc(deliveryID)
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(deadRef)
+		if err != nil {
+			return ErrDeadLetterNotFound
+		}
+		var delivery data.WebhookDelivery
+		if err := doc.DataTo(&delivery); err != nil {
+			return err
+		}
+		if delivery.OrganizationID != orgID {
+			return ErrDeadLetterNotFound
+		}
+
+		delivery.Status = "pending"
+		delivery.Attempts = 0
+		delivery.LastError = ""
+		delivery.NextAttemptAt = time.Now().UTC()
+		if err := tx.Set(queueRef, delivery); err != nil {
+			return err
+		}
+		return tx.Delete(deadRef)
+	})
+}
@@ -0,0 +1,109 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "forms"
+
+// Registry holds every backend metric plus the Go runtime and process collectors. It is
+// separate from the Prometheus default registry so libraries cannot add unreviewed
+// series to /metrics. Labels never carry identifiers or form content.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// PDFSectionDuration is the time taken by each RendererRegistry.Render call
+	PDFSectionDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pdf",
+		Name:      "section_render_seconds",
+		Help:      "Time to render one PDF section, by section type.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"section"})
+
+	// PDFGenerationDuration is the end-to-end time of a PDF request
+	PDFGenerationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "pdf",
+		Name:      "generation_seconds",
+		Help:      "End-to-end PDF generation time, by outcome.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"outcome"})
+
+	// RenderErrors counts failed sections by RenderError.Code
+	RenderErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "pdf",
+		Name:      "render_errors_total",
+		Help:      "PDF section render failures, by RenderError code.",
+	}, []string{"code"})
+
+	// GotenbergDuration is the time spent in HTML-to-PDF conversion
+	GotenbergDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "gotenberg",
+		Name:      "conversion_seconds",
+		Help:      "Gotenberg HTML-to-PDF conversion time, by outcome.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60},
+	}, []string{"outcome"})
+
+	// RateLimitRejections counts requests answered with 429
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter, by limiter.",
+	}, []string{"limiter"})
+
+	// LockContention counts distributed lock acquisitions that found the lock held
+	LockContention = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "lock",
+		Name:      "contention_total",
+		Help:      "Distributed lock acquisitions that found the lock already held, by resource kind.",
+	}, []string{"resource"})
+
+	// AITokens counts Vertex AI token usage as reported by the API
+	AITokens = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "tokens_total",
+		Help:      "Vertex AI tokens consumed, by operation and token kind (prompt, candidates, thoughts).",
+	}, []string{"operation", "kind"})
+
+	// AIRequestDuration is the latency of Vertex AI calls
+	AIRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "ai",
+		Name:      "request_seconds",
+		Help:      "Vertex AI GenerateContent latency, by operation and outcome.",
+		Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"operation", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Outcome maps an error to the "outcome" label value
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// MetricsHandler serves the registry in the Prometheus exposition format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
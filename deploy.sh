@@ -75,11 +75,16 @@ gcloud run deploy ${SERVICE_NAME} \
   --cpu 1 \
   --max-instances 10 \
   --min-instances 0 \
+  --set-env-vars="ENVIRONMENT=production" \
   --set-env-vars="GCP_PROJECT_ID=${PROJECT_ID}" \
   --set-env-vars="GOTENBERG_URL=https://10.128.0.4" \
   --set-env-vars="CORS_ALLOWED_ORIGINS=http://localhost:3000;https://healthcare-forms-v2.web.app;https://healthcare-forms-v2.firebaseapp.com;https://form.easydocforms.com" \
   --set-env-vars="REDIS_ADDR=10.37.219.28:6378" \
   --set-env-vars="REDIS_TLS_ENABLED=true" \
+  --set-env-vars="ATTACHMENT_STORE=gcs" \
+  --set-env-vars="ATTACHMENT_BUCKET=${PROJECT_ID}-attachments" \
+  --set-env-vars="KEY_PROVIDER=kms" \
+  --set-env-vars="KMS_KEY_NAME=projects/${PROJECT_ID}/locations/${REGION}/keyRings/forms/cryptoKeys/kek" \
   --set-secrets="REDIS_PASSWORD=redis-password:latest" \
   --vpc-connector="backend-connector-new" \
   --vpc-egress="private-ranges-only" \